@@ -0,0 +1,50 @@
+package access
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Role is what an API caller may do. Each role may do everything the roles below it may.
+type Role int
+
+const (
+	RoleNone     Role = iota
+	RoleViewer        // Read jobs and results
+	RoleOperator      // Start and cancel jobs
+	RoleAdmin         // Change the configuration
+)
+
+var roleNames = map[Role]string{RoleNone: "none", RoleViewer: "viewer", RoleOperator: "operator", RoleAdmin: "admin"}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+// ParseRole reads a role name. Unknown names are an error.
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if role != RoleNone && strings.EqualFold(name, roleName) {
+			return role, nil
+		}
+	}
+	return RoleNone, fmt.Errorf("unknown role %q", name)
+}
+
+// Principal is an authenticated API caller.
+type Principal struct {
+	Name   string
+	Role   Role
+	Method string // "key", "jwt" or "open"
+}
+
+// AuditEntry records one mutating API call.
+type AuditEntry struct {
+	Time       time.Time
+	Principal  Principal
+	Method     string
+	Path       string
+	Status     int
+	RemoteAddr string
+}
@@ -0,0 +1,237 @@
+// Package access holds what the crawler and the data layer share about who may do what: the roles of API
+// callers and the providers of the credentials they use, from the environment, secret files or Vault.
+package access
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSecretNotFound is returned by a SecretsProvider that has no secret of the requested name.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// SecretPrefix marks configuration values that name a secret instead of holding it, e.g.
+// "secret:api/dashboard".
+const SecretPrefix = "secret:"
+
+// SecretsProvider looks up credentials by name. Names are slash-separated paths such as "db/dsn".
+type SecretsProvider interface {
+	Secret(name string) (string, error)
+}
+
+// EnvSecrets reads secrets from environment variables: "db/dsn" is read from CRAB_DB_DSN with the
+// default prefix.
+type EnvSecrets struct {
+	Prefix string
+}
+
+func (e EnvSecrets) Secret(name string) (string, error) {
+	key := e.Prefix + strings.ToUpper(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name))
+	if value, ok := os.LookupEnv(key); ok {
+		return value, nil
+	}
+	return "", ErrSecretNotFound
+}
+
+// FileSecrets reads secrets from the files under Dir, one secret per file, the way Docker and Kubernetes
+// mount them: "db/dsn" is read from Dir/db/dsn. A trailing newline is dropped.
+type FileSecrets struct {
+	Dir string
+}
+
+func (f FileSecrets) Secret(name string) (string, error) {
+	if strings.Contains(name, "..") {
+		return "", fmt.Errorf("invalid secret name %q", name)
+	}
+	data, err := os.ReadFile(filepath.Join(f.Dir, filepath.FromSlash(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// VaultSecrets reads secrets from a HashiCorp Vault KV version 2 engine. The last element of a name is the
+// key and the rest the path under Path: "db/dsn" is key "dsn" of the secret at <Mount>/data/<Path>/db.
+type VaultSecrets struct {
+	Address string
+	Token   string
+	Mount   string // "secret" when empty
+	Path    string
+	Client  *http.Client // A client with a 30 second timeout when nil
+}
+
+func (v VaultSecrets) Secret(name string) (string, error) {
+	mount := v.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	path, key := "", name
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		path, key = name[:i], name[i+1:]
+	}
+	path = strings.Trim(strings.Trim(v.Path, "/")+"/"+path, "/")
+	if path == "" {
+		return "", fmt.Errorf("secret %q has no Vault path", name)
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(v.Address, "/")+"/v1/"+mount+"/data/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	client := v.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", ErrSecretNotFound
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("vault answered %s for %s", resp.Status, path)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("reading vault secret %s: %v", path, err)
+	}
+	value, ok := body.Data.Data[key]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// ChainSecrets asks each provider in turn and returns the first secret found.
+type ChainSecrets []SecretsProvider
+
+func (c ChainSecrets) Secret(name string) (string, error) {
+	for _, provider := range c {
+		value, err := provider.Secret(name)
+		if !errors.Is(err, ErrSecretNotFound) {
+			return value, err
+		}
+	}
+	return "", ErrSecretNotFound
+}
+
+// SecretsConfig says where credentials are looked up. Each setting falls back to an environment
+// variable, so the zero value reads CRAB_* variables, the files under $CRAB_SECRETS_DIR and, when
+// $VAULT_ADDR is set, Vault.
+type SecretsConfig struct {
+	EnvPrefix  string `json:"env_prefix"`  // "CRAB_" when empty
+	Dir        string `json:"dir"`         // $CRAB_SECRETS_DIR when empty
+	VaultAddr  string `json:"vault_addr"`  // $VAULT_ADDR when empty
+	VaultToken string `json:"vault_token"` // $VAULT_TOKEN when empty
+	VaultMount string `json:"vault_mount"`
+	VaultPath  string `json:"vault_path"` // "crab" when empty
+}
+
+// Provider returns the providers the configuration names, in the order environment, files, Vault.
+func (c SecretsConfig) Provider() SecretsProvider {
+	prefix := c.EnvPrefix
+	if prefix == "" {
+		prefix = "CRAB_"
+	}
+	chain := ChainSecrets{EnvSecrets{Prefix: prefix}}
+	if dir := firstNonEmpty(c.Dir, os.Getenv("CRAB_SECRETS_DIR")); dir != "" {
+		chain = append(chain, FileSecrets{Dir: dir})
+	}
+	if addr := firstNonEmpty(c.VaultAddr, os.Getenv("VAULT_ADDR")); addr != "" {
+		chain = append(chain, VaultSecrets{
+			Address: addr,
+			Token:   firstNonEmpty(c.VaultToken, os.Getenv("VAULT_TOKEN")),
+			Mount:   c.VaultMount,
+			Path:    firstNonEmpty(c.VaultPath, "crab"),
+		})
+	}
+	return chain
+}
+
+// secrets is the configuration LookupSecret reads with, installed with UseSecrets.
+var secrets struct {
+	sync.RWMutex
+	config SecretsConfig
+}
+
+// UseSecrets installs the configuration LookupSecret reads with. crab installs the Secrets settings of its
+// configuration with it.
+func UseSecrets(config SecretsConfig) {
+	secrets.Lock()
+	defer secrets.Unlock()
+	secrets.config = config
+}
+
+// LookupSecret reads the named secret with the providers of the installed configuration.
+func LookupSecret(name string) (string, error) {
+	secrets.RLock()
+	config := secrets.config
+	secrets.RUnlock()
+	value, err := config.Provider().Secret(name)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %w", name, err)
+	}
+	return value, nil
+}
+
+// LookupCredential reads the named secret like LookupSecret, falling back to the unprefixed environment
+// variable conventional for it: "aws/secret_access_key" is read from AWS_SECRET_ACCESS_KEY when no
+// provider has it. It returns "" when neither does.
+func LookupCredential(name string) (string, error) {
+	value, err := LookupSecret(name)
+	if errors.Is(err, ErrSecretNotFound) {
+		if value, err = (EnvSecrets{}).Secret(name); errors.Is(err, ErrSecretNotFound) {
+			return "", nil
+		}
+	}
+	return value, err
+}
+
+// Resolve replaces value with the secret it names when it is written as "secret:<name>", looked up with
+// provider.
+func Resolve(provider SecretsProvider, value *string) error {
+	if !strings.HasPrefix(*value, SecretPrefix) {
+		return nil
+	}
+	name := strings.TrimPrefix(*value, SecretPrefix)
+	secret, err := provider.Secret(name)
+	if err != nil {
+		return fmt.Errorf("secret %s: %w", name, err)
+	}
+	*value = secret
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
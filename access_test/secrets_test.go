@@ -0,0 +1,60 @@
+package access_test
+
+import (
+	"cmpscfa23team2/access"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecretsProviders(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "db"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "db", "dsn"), []byte("file-dsn\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" || r.URL.Path != "/v1/secret/data/crab/proxy" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"data": {"data": {"password": "vault-pass"}}}`))
+	}))
+	defer vault.Close()
+	t.Setenv("TEST_API_DASHBOARD", "env-key")
+
+	provider := access.SecretsConfig{EnvPrefix: "TEST_", Dir: dir, VaultAddr: vault.URL, VaultToken: "token"}.Provider()
+	for name, want := range map[string]string{"api/dashboard": "env-key", "db/dsn": "file-dsn", "proxy/password": "vault-pass"} {
+		if got, err := provider.Secret(name); err != nil || got != want {
+			t.Errorf("Secret(%s) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := provider.Secret("proxy/missing"); !errors.Is(err, access.ErrSecretNotFound) {
+		t.Errorf("Secret(proxy/missing) error = %v, want ErrSecretNotFound", err)
+	}
+	if _, err := (access.FileSecrets{Dir: dir}).Secret("../etc/passwd"); err == nil || errors.Is(err, access.ErrSecretNotFound) {
+		t.Errorf("FileSecrets read outside its directory, error = %v", err)
+	}
+}
+
+func TestLookupCredential(t *testing.T) {
+	t.Setenv("TEST_AWS_ACCESS_KEY_ID", "provider-key")
+	t.Setenv("AWS_ACCESS_KEY_ID", "env-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+	access.UseSecrets(access.SecretsConfig{EnvPrefix: "TEST_"})
+	defer access.UseSecrets(access.SecretsConfig{})
+
+	for name, want := range map[string]string{"aws/access_key_id": "provider-key", "aws/secret_access_key": "env-secret", "aws/missing": ""} {
+		if got, err := access.LookupCredential(name); err != nil || got != want {
+			t.Errorf("LookupCredential(%s) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := access.LookupSecret("aws/secret_access_key"); !errors.Is(err, access.ErrSecretNotFound) {
+		t.Errorf("LookupSecret() read an unprefixed variable, error = %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+// Package analyze computes statistics, diffs and reports over the datasets crab's scrapes write, from
+// other Go programs:
+//
+//	report, err := analyze.Report(dir, runID)
+//
+// Its functions read datasets and runs as the store package returns them, and write nothing but the
+// charts asked for.
+package analyze
+
+import "cmpscfa23team2/crab"
+
+// Stats computes the statistics of each column of ds.
+func Stats(ds crab.Dataset) crab.DatasetStats {
+	return crab.SummarizeDataset(ds)
+}
+
+// StatsAsOf returns the statistics of the named dataset as of run runID in dir, or of its latest version
+// when runID is empty.
+func StatsAsOf(dir, name, runID string) (crab.DatasetStats, error) {
+	return crab.LoadDatasetStats(dir, name, runID)
+}
+
+// Diff compares two versions of a dataset row by row: the rows only in current are "added" and those only
+// in previous "removed", in the leading "change" column; unchanged rows are left out.
+func Diff(previous, current crab.Dataset) crab.Dataset {
+	return crab.DiffDatasets(previous, current)
+}
+
+// Anomalies returns the values of ds that rule flags, in series order.
+func Anomalies(ds crab.Dataset, rule crab.AnomalyRule) ([]crab.Anomaly, error) {
+	return crab.DetectAnomalies(ds, rule)
+}
+
+// Report gathers the report of run runID in dir: its summary statistics, and how each scraped dataset it
+// wrote changed since the previous run that wrote it.
+func Report(dir, runID string) (crab.RunReport, error) {
+	return crab.BuildRunReport(dir, runID, nil, nil)
+}
+
+// TrendCharts renders a line chart of every scraped time series in dataDir to outDir, in each of formats
+// ("png", "svg"; png when none), and returns the paths of the charts written.
+func TrendCharts(dataDir, outDir string, formats ...string) ([]string, error) {
+	return crab.GenerateTrendCharts(dataDir, outDir, formats...)
+}
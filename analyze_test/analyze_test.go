@@ -0,0 +1,63 @@
+package analyze_test
+
+import (
+	"cmpscfa23team2/analyze"
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/store"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoredRuns(t *testing.T) {
+	rows := `<tr><td>1978</td><td>0.652</td></tr>`
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<table><tr><th>Year</th><th>Average Gasoline Prices</th></tr>%s</table>`, rows)
+	}))
+	defer site.Close()
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{
+		Output:       crab.OutputConfig{Dir: dir},
+		TableTargets: []crab.TableTarget{{Name: "pump", URL: site.URL, Tables: []crab.NamedTable{{Name: "gasoline"}}}},
+	})
+	defer crab.SetConfig(crab.Config{})
+	for _, more := range []string{"", `<tr><td>1979</td><td>0.882</td></tr>`} {
+		rows += more
+		if err := crab.RunScraper("pump"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs, err := store.Runs(dir)
+	if err != nil || len(runs) != 2 {
+		t.Fatalf("Runs() = %v, %v, want 2 runs", runs, err)
+	}
+	latest, err := store.Latest(dir)
+	if err != nil || latest != runs[1] {
+		t.Errorf("Latest() = %q, %v, want %q", latest, err, runs[1])
+	}
+	if problems, err := store.Verify(dir, latest); err != nil || len(problems) > 0 {
+		t.Errorf("Verify() = %v, %v", problems, err)
+	}
+	datasets, err := store.Datasets(filepath.Join(dir, latest))
+	if err != nil || len(datasets) != 1 || len(datasets[0].Rows) != 2 {
+		t.Fatalf("Datasets() = %+v, %v, want the 2 rows of gasoline", datasets, err)
+	}
+	previous, err := store.DatasetAsOf(dir, "gasoline", runs[0])
+	if err != nil || len(previous.Rows) != 1 {
+		t.Fatalf("DatasetAsOf() = %+v, %v, want the first row only", previous, err)
+	}
+
+	if stats := analyze.Stats(datasets[0]); stats.Rows != 2 {
+		t.Errorf("Stats() = %+v, want 2 rows", stats)
+	}
+	if diff := analyze.Diff(previous, datasets[0]); len(diff.Rows) != 1 || diff.Rows[0][0] != "added" {
+		t.Errorf("Diff() = %+v, want 1979 added", diff)
+	}
+	report, err := analyze.Report(dir, latest)
+	if err != nil || len(report.Diffs) != 1 || report.Diffs[0].Added != 1 || report.Diffs[0].PreviousRun != runs[0] {
+		t.Errorf("Report() = %+v, %v, want 1979 added since the first run", report.Diffs, err)
+	}
+}
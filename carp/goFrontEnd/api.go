@@ -0,0 +1,139 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/dal"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// apiAuth protects the REST API: viewers read jobs and predictions, operators also start, cancel and pause
+// jobs, and admins also read and replace the crab configuration. Every mutating call is audited in the
+// log table.
+var apiAuth = &crab.APIAuth{RoleLookup: store.APIRole, Audit: store.AuditAPICall}
+
+// configHandler returns the crab configuration with its credentials redacted (GET), or reloads it from the
+// whole configuration (PUT) the way a change to the config file is reloaded: secrets written as
+// "secret:<name>" are resolved and the settings safe to change while running are applied. It answers with
+// the changes applied and the settings ignored until a restart.
+func configHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, crab.CurrentConfig().Redacted())
+	case http.MethodPut:
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		changes, ignored, err := crab.ReloadConfigJSON(body)
+		if err != nil {
+			http.Error(w, "Invalid configuration: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Configuration reloaded through the API: %d change(s) applied", len(changes))
+		writeJSON(w, http.StatusOK, map[string][]string{"applied": changes, "ignored": ignored})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// healthHandler reports whether the database is reachable (GET /api/health), with 503 Service Unavailable
+// while the dal's circuit breaker is open, so load balancers and monitors see an outage without every
+// other call failing to tell them.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	health := dal.Health()
+	status := http.StatusOK
+	if health.Status != "up" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, map[string]dal.DBHealth{"database": health})
+}
+
+// queryMetricsHandler returns the duration statistics of every database statement run since startup
+// (GET /api/db/queries), the costliest first, to spot queries that degrade under load.
+func queryMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, dal.QueryMetrics())
+}
+
+// enginesHandler lists the scraper engines (GET /api/engines) or creates one (POST {"name", "description"}).
+func enginesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		engines, err := store.ListScraperEngines()
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, engines)
+	case http.MethodPost:
+		var engine dal.ScraperEngine
+		if err := json.NewDecoder(r.Body).Decode(&engine); err != nil || engine.Name == "" {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		id, err := store.CreateScraperEngine(engine.Name, engine.Description)
+		if err == nil {
+			engine, err = store.GetScraperEngine(id)
+		}
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusCreated, engine)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// engineHandler returns a scraper engine (GET /api/engines/{id}), updates it (PUT with its name,
+// description and the version it was read at) or deletes it (DELETE ?version=N). An update or delete based
+// on a version that is no longer current fails with 409 Conflict instead of overwriting the other change.
+func engineHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/engines/")
+	var engine dal.ScraperEngine
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		engine, err = store.GetScraperEngine(id)
+	case http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(&engine); err != nil || engine.Version <= 0 {
+			http.Error(w, "Invalid request body, the version the engine was read at is required", http.StatusBadRequest)
+			return
+		}
+		engine.EngineID = id
+		engine, err = store.UpdateScraperEngine(engine)
+	case http.MethodDelete:
+		version, convErr := strconv.Atoi(r.URL.Query().Get("version"))
+		if convErr != nil {
+			http.Error(w, "The version the engine was read at is required", http.StatusBadRequest)
+			return
+		}
+		if err = store.DeleteScraperEngine(id, version); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	switch {
+	case err == sql.ErrNoRows:
+		http.Error(w, "Engine not found", http.StatusNotFound)
+	case err == dal.ErrVersionConflict:
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusOK, engine)
+	}
+}
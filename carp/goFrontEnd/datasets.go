@@ -0,0 +1,123 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"net/http"
+	"strings"
+)
+
+// runsHandler lists the IDs of the crawl and scrape runs kept in the output directory, oldest first
+// (GET /api/runs).
+func runsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dir := crab.CurrentConfig().Output.Dir
+	if dir == "" {
+		http.Error(w, "No output directory configured, runs are not kept", http.StatusNotFound)
+		return
+	}
+	runs, err := crab.ListRuns(dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// datasetHandler returns a scraped dataset as of a run (GET /api/datasets/{name}?run={run id}), or its
+// latest version without a run. The rows are filtered and paged by the from, to, columns, limit and offset
+// parameters and returned as JSON or CSV by the Accept header or format=csv (see crab.ServeDataset), and
+// with currency=EUR the prices are converted from dollars. GET /api/datasets/{name}/lineage returns where each row came from,
+// limited to the rows holding value in column with the value and column parameters, and GET
+// /api/datasets/{name}/quarantine the values held back from the run for review, GET
+// /api/datasets/{name}/stats its summary statistics and GET /api/datasets/{name}/quality the results of
+// its data quality expectations.
+func datasetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dir := crab.CurrentConfig().Output.Dir
+	if dir == "" {
+		http.Error(w, "No output directory configured, runs are not kept", http.StatusNotFound)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/api/datasets/")
+	query := r.URL.Query()
+	if strings.HasSuffix(name, "/lineage") {
+		name = strings.TrimSuffix(name, "/lineage")
+		var lineage []crab.RowLineage
+		var err error
+		if value := query.Get("value"); value != "" {
+			lineage, err = crab.TraceValue(dir, name, query.Get("run"), query.Get("column"), value)
+		} else {
+			lineage, err = crab.DatasetLineage(dir, name, query.Get("run"))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, lineage)
+		return
+	}
+	if strings.HasSuffix(name, "/stats") {
+		stats, err := crab.LoadDatasetStats(dir, strings.TrimSuffix(name, "/stats"), query.Get("run"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, stats)
+		return
+	}
+	if strings.HasSuffix(name, "/quality") {
+		results, err := crab.LoadQualityResults(dir, strings.TrimSuffix(name, "/quality"), query.Get("run"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, results)
+		return
+	}
+	if strings.HasSuffix(name, "/quarantine") {
+		report, err := crab.LoadQuarantine(dir, strings.TrimSuffix(name, "/quarantine"), query.Get("run"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, report)
+		return
+	}
+	ds, err := crab.LoadDatasetAsOf(dir, name, query.Get("run"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if currency := query.Get("currency"); currency != "" {
+		if ds, err = crab.ConvertScrapedDataset(ds, currency); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	crab.ServeDataset(w, r, ds)
+}
+
+// datasetsHandler lists the stored datasets with their latest run (GET /api/datasets).
+func datasetsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dir := crab.CurrentConfig().Output.Dir
+	if dir == "" {
+		http.Error(w, "No output directory configured, runs are not kept", http.StatusNotFound)
+		return
+	}
+	datasets, err := crab.ListDatasets(dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, datasets)
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/dal"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jobQueue runs crawl, scrape, archive and predict jobs submitted through the REST API and records them in the database.
+var jobQueue = crab.NewJobQueue(store)
+
+// startJobQueue starts the workers that process queued jobs, and the feed watcher if feeds are configured.
+// The crab configuration is read from $CRAB_CONFIG when set and reloaded whenever the file changes.
+func startJobQueue() {
+	if configFile := os.Getenv("CRAB_CONFIG"); configFile != "" {
+		config, err := crab.LoadConfig(configFile)
+		if err != nil {
+			log.Fatalf("Error loading crab config: %v", err)
+		}
+		crab.SetConfig(config)
+		if err := crab.WatchConfig(context.Background(), configFile, enqueueNewSeeds); err != nil {
+			log.Printf("Error watching %s, config changes need a restart: %v", configFile, err)
+		}
+	}
+	crab.SetSnapshotStore(store)            // Page snapshots, when enabled, go to the database with the jobs
+	crab.SetQualityStore(store)             // So do data quality results
+	crab.SetLatencyStore(store)             // And the response times of crawled domains, to follow them over time
+	crab.SetMetricsStore(store)             // And the metrics of every run, which the dashboard charts
+	crab.SetAlertStore(store)               // And the alerts the runs fire
+	crab.SetIdempotencyStore(store)         // And the idempotency keys of API requests, seen by every server
+	crab.SetRunLocker(dal.AdvisoryLocker{}) // Runs of the same job lock each other out across servers
+	crab.SetPredictionSource(storePredictions{})
+	jobQueue.Register("archive", runArchiveJob)
+	jobQueue.Register("predict", runPredictJob)
+	jobQueue.Start(context.Background(), 2)
+	if !crab.CurrentConfig().API.Enabled() {
+		log.Println("No API keys or JWT secret configured; the REST API is read-only and its operator and admin routes answer 403")
+	}
+
+	if feeds := crab.CurrentConfig().Feeds; len(feeds) > 0 {
+		source := crab.NewFeedSource(feeds, "feed_state.json")
+		go crab.WatchSource(context.Background(), source, time.Minute, enqueueFeedEntries)
+	}
+}
+
+// defaultArchiveAge is how old predictions get before an archive job without older_than moves them.
+const defaultArchiveAge = 90 * 24 * time.Hour
+
+// runArchiveJob moves old and soft-deleted predictions out of the prediction tables. Its params are
+// older_than (a duration such as "720h", 90 days by default), deleted_only ("true" to leave live
+// predictions alone) and file (a gzipped NDJSON file to append them to instead of the archive table).
+func runArchiveJob(ctx context.Context, job crab.Job) error {
+	age := defaultArchiveAge
+	if olderThan := job.Params["older_than"]; olderThan != "" {
+		var err error
+		if age, err = time.ParseDuration(olderThan); err != nil || age <= 0 {
+			return fmt.Errorf("invalid older_than %q", olderThan)
+		}
+	}
+	deletedOnly, _ := strconv.ParseBool(job.Params["deleted_only"])
+	archived, err := store.ArchivePredictions(dal.ArchiveOptions{
+		Before:      time.Now().Add(-age),
+		DeletedOnly: deletedOnly,
+		File:        job.Params["file"],
+	})
+	log.Printf("Archive job %s moved %d predictions", job.ID, archived)
+	return err
+}
+
+// enqueueFeedEntries queues a crawl of each new feed entry, so entries show up in the job history one by one.
+func enqueueFeedEntries(urls []crab.URLData) {
+	for _, u := range urls {
+		if _, err := jobQueue.Enqueue("crawl", map[string]string{"urls": u.URL, "workers": "1"}); err != nil {
+			log.Printf("Error queueing feed entry %s: %v", u.URL, err)
+		}
+	}
+}
+
+// enqueueNewSeeds queues a crawl of the seeds a config reload added.
+func enqueueNewSeeds(old, new crab.Config) {
+	known := map[string]bool{}
+	for _, u := range old.Seeds {
+		known[u] = true
+	}
+	var added []string
+	for _, u := range new.Seeds {
+		if !known[u] {
+			added = append(added, u)
+		}
+	}
+	if len(added) == 0 {
+		return
+	}
+	if _, err := jobQueue.Enqueue("crawl", map[string]string{"urls": strings.Join(added, ",")}); err != nil {
+		log.Printf("Error queueing the new seeds: %v", err)
+	}
+}
+
+// jobsHandler lists jobs (GET) or enqueues a new one (POST {"type": "crawl", "params": {...}}), once per
+// Idempotency-Key header.
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		jobs, err := jobQueue.List()
+		if err != nil {
+			log.Printf("Error listing jobs: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, jobs)
+	case http.MethodPost:
+		// A retry with the key of a queued job gets that job rather than queueing another
+		body, claim, previous, err := crab.ClaimIdempotency(r, "POST /api/jobs")
+		if err != nil {
+			crab.WriteIdempotencyError(w, err)
+			return
+		}
+		if previous != nil {
+			job, err := jobQueue.Get(previous.ResourceID)
+			if err != nil {
+				http.Error(w, "Job not found", http.StatusNotFound)
+				return
+			}
+			crab.WriteIdempotentReplay(w, previous, job)
+			return
+		}
+		var request struct {
+			Type   string            `json:"type"`
+			Params map[string]string `json:"params"`
+		}
+		if err := json.Unmarshal(body, &request); err != nil {
+			claim.Release()
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		job, err := jobQueue.Enqueue(request.Type, request.Params)
+		if err != nil {
+			claim.Release()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := claim.Complete(job.ID, http.StatusAccepted); err != nil {
+			log.Printf("Error recording the idempotency key of job %s: %v", job.ID, err)
+		}
+		writeJSON(w, http.StatusAccepted, job)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// jobHandler returns a single job (GET /api/jobs/{id}), cancels it (DELETE or POST /api/jobs/{id}/cancel),
+// or pauses or resumes a queued job (POST /api/jobs/{id}/pause or /resume).
+func jobHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/jobs/")
+	action := ""
+	if r.Method == http.MethodDelete {
+		action = "cancel"
+	}
+	if i := strings.LastIndex(id, "/"); i >= 0 && r.Method == http.MethodPost {
+		id, action = id[:i], id[i+1:]
+	}
+
+	var err error
+	switch action {
+	case "cancel":
+		err = jobQueue.Cancel(id)
+	case "pause":
+		err = jobQueue.Pause(id)
+	case "resume":
+		err = jobQueue.Resume(id)
+	case "":
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	job, err := jobQueue.Get(id)
+	if err != nil {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// pausesHandler lists the paused domains and jobs (GET /api/pauses), pauses crawling of a domain
+// (PUT /api/pauses/{domain}) or resumes it (DELETE /api/pauses/{domain}). Pauses survive restarts.
+func pausesHandler(w http.ResponseWriter, r *http.Request) {
+	domain := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/pauses"), "/")
+	var err error
+	switch {
+	case r.Method == http.MethodGet && domain == "":
+	case r.Method == http.MethodPut && domain != "":
+		err = crab.DefaultPauses.PauseDomain(domain)
+	case r.Method == http.MethodDelete && domain != "":
+		err = crab.DefaultPauses.ResumeDomain(domain)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating pauses: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, crab.DefaultPauses.List())
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
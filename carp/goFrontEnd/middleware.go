@@ -75,7 +75,7 @@ func handleLogin(w http.ResponseWriter, r *http.Request) {
 		password := r.FormValue("password")
 
 		// Call the DAL authentication function
-		token, err := dal.AuthenticateUser(username, password)
+		token, err := store.AuthenticateUser(username, password)
 		if err != nil {
 			// Log the authentication error
 			log.Printf("Authentication error: %v", err)
@@ -129,7 +129,7 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Call the DAL function to log out the user
-	err = dal.LogoutUser(userID)
+	err = store.LogoutUser(userID)
 	if err != nil {
 		http.Error(w, "Logout failed", http.StatusInternalServerError)
 		return
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/dal"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// syncPredictionLimit is the most inputs POST /api/predict predicts while the client waits; larger batches
+// run as jobs.
+const syncPredictionLimit = 5
+
+// maxPredictionInputs bounds the inputs of one prediction request.
+const maxPredictionInputs = 1000
+
+// predictHandler predicts a batch of inputs (POST /api/predict {"inputs": [...]}, or {"input": "..."} for
+// one). Small batches are predicted right away and returned with 200 OK; larger ones, or any with
+// "async": true, are queued as a predict job and returned with 202 Accepted, to be polled at
+// GET /api/predict/{id}. Either way the request and its results are stored. Retries sent with the
+// Idempotency-Key header of the first request get it back instead of predicting again.
+func predictHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// A retry with the key of an earlier request gets that request, so its predictions are neither made nor
+	// stored twice
+	data, claim, previous, err := crab.ClaimIdempotency(r, "POST /api/predict")
+	if err != nil {
+		crab.WriteIdempotencyError(w, err)
+		return
+	}
+	if previous != nil {
+		request, err := store.GetPredictionRequest(previous.ResourceID)
+		if err != nil {
+			http.Error(w, "Prediction request not found", http.StatusNotFound)
+			return
+		}
+		crab.WriteIdempotentReplay(w, previous, request)
+		return
+	}
+	var body struct {
+		Input  string   `json:"input"`
+		Inputs []string `json:"inputs"`
+		Async  bool     `json:"async"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		claim.Release()
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	inputs := body.Inputs
+	if body.Input != "" {
+		inputs = append([]string{body.Input}, inputs...)
+	}
+	if len(inputs) == 0 || len(inputs) > maxPredictionInputs {
+		claim.Release()
+		http.Error(w, fmt.Sprintf("Between 1 and %d inputs are required", maxPredictionInputs), http.StatusBadRequest)
+		return
+	}
+
+	request := dal.NewPredictionRequest(inputs)
+	if !body.Async && len(inputs) <= syncPredictionLimit {
+		runPredictions(r.Context(), &request)
+		status := http.StatusOK
+		if request.State != crab.JobSucceeded {
+			status = http.StatusBadGateway
+		}
+		if err := store.SavePredictionRequest(request); err != nil {
+			log.Printf("Error saving prediction request %s: %v", request.RequestID, err)
+			claim.Release() // A retry could not get it back
+		} else {
+			completePrediction(claim, request, status)
+		}
+		writeJSON(w, status, request)
+		return
+	}
+
+	if err := store.SavePredictionRequest(request); err != nil {
+		claim.Release()
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	job, err := jobQueue.Enqueue("predict", map[string]string{"request": request.RequestID})
+	if err != nil {
+		request.State, request.Error, request.FinishedAt = crab.JobFailed, err.Error(), time.Now()
+		store.SavePredictionRequest(request)
+		claim.Release()
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	request.JobID = job.ID
+	completePrediction(claim, request, http.StatusAccepted)
+	writeJSON(w, http.StatusAccepted, request)
+}
+
+// completePrediction records the prediction request answered under an idempotency key.
+func completePrediction(claim *crab.IdempotencyClaim, request dal.PredictionRequest, status int) {
+	if err := claim.Complete(request.RequestID, status); err != nil {
+		log.Printf("Error recording the idempotency key of prediction request %s: %v", request.RequestID, err)
+	}
+}
+
+// predictRequestHandler returns a prediction request with its results once finished
+// (GET /api/predict/{id}).
+func predictRequestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	request, err := store.GetPredictionRequest(strings.TrimPrefix(r.URL.Path, "/api/predict/"))
+	switch {
+	case err == sql.ErrNoRows:
+		http.Error(w, "Prediction request not found", http.StatusNotFound)
+	case err != nil:
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusOK, request)
+	}
+}
+
+// runPredictJob predicts the batch of the prediction request named by the job's request param, saving its
+// progress so pollers see it running, and its results.
+func runPredictJob(ctx context.Context, job crab.Job) error {
+	request, err := store.GetPredictionRequest(job.Params["request"])
+	if err != nil {
+		return fmt.Errorf("prediction request %q: %w", job.Params["request"], err)
+	}
+	request.JobID, request.State = job.ID, crab.JobRunning
+	if err := store.SavePredictionRequest(request); err != nil {
+		return err
+	}
+	runPredictions(ctx, &request)
+	if err := store.SavePredictionRequest(request); err != nil {
+		return err
+	}
+	if request.Error != "" {
+		return fmt.Errorf("%s", request.Error)
+	}
+	return nil
+}
+
+// runPredictions predicts the inputs of the request with dal.DefaultPredictors, recording the results or
+// why they stopped in it, and saves every prediction served for the predictor comparison report.
+func runPredictions(ctx context.Context, request *dal.PredictionRequest) {
+	outcomes := dal.DefaultPredictors.PredictRequest(ctx, request)
+	if err := store.SavePredictionOutcomes(outcomes); err != nil {
+		log.Printf("Error saving the predictions of request %s: %v", request.RequestID, err)
+	}
+}
+
+// defaultPredictorReportAge is how far back GET /api/predictors compares backends without since.
+const defaultPredictorReportAge = 7 * 24 * time.Hour
+
+// predictorsHandler compares the predictor backends (GET /api/predictors?since=168h): their current
+// traffic weights, and the output distribution and latencies of the predictions each served since then.
+func predictorsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	age := defaultPredictorReportAge
+	if since := r.URL.Query().Get("since"); since != "" {
+		var err error
+		if age, err = time.ParseDuration(since); err != nil || age <= 0 {
+			http.Error(w, "Invalid since duration", http.StatusBadRequest)
+			return
+		}
+	}
+	outcomes, err := store.ListPredictionOutcomes(time.Now().Add(-age))
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"weights":  dal.DefaultPredictors.Weights(),
+		"backends": dal.ComparePredictors(outcomes),
+	})
+}
+
+// storePredictions serves the stored prediction requests to the GraphQL API.
+type storePredictions struct{}
+
+// Prediction loads a prediction request.
+func (storePredictions) Prediction(id string) (crab.PredictionRecord, error) {
+	request, err := store.GetPredictionRequest(id)
+	if err == sql.ErrNoRows {
+		return crab.PredictionRecord{}, fmt.Errorf("no prediction %s", id)
+	} else if err != nil {
+		return crab.PredictionRecord{}, err
+	}
+	return predictionRecord(request), nil
+}
+
+// Predictions loads the prediction requests that served a prediction since a time. A zero time falls back
+// to the period of the predictor report.
+func (storePredictions) Predictions(since time.Time) ([]crab.PredictionRecord, error) {
+	if since.IsZero() {
+		since = time.Now().Add(-defaultPredictorReportAge)
+	}
+	outcomes, err := store.ListPredictionOutcomes(since)
+	if err != nil {
+		return nil, err
+	}
+	var records []crab.PredictionRecord
+	seen := map[string]bool{}
+	for _, outcome := range outcomes {
+		if seen[outcome.RequestID] {
+			continue
+		}
+		seen[outcome.RequestID] = true
+		request, err := store.GetPredictionRequest(outcome.RequestID)
+		if err != nil {
+			log.Printf("Error loading prediction request %s: %v", outcome.RequestID, err)
+			continue
+		}
+		records = append(records, predictionRecord(request))
+	}
+	return records, nil
+}
+
+// predictionRecord converts a stored prediction request for the GraphQL API.
+func predictionRecord(request dal.PredictionRequest) crab.PredictionRecord {
+	return crab.PredictionRecord{ID: request.RequestID, State: request.State, Inputs: request.Inputs, Results: request.Results,
+		Backends: request.Backends, Error: request.Error, CreatedAt: request.CreatedAt, FinishedAt: request.FinishedAt}
+}
@@ -6,6 +6,7 @@ package main
 // C:\Users\Public\GoLandProjects\PredictAi\carp\goFrontEnd
 
 import (
+	"cmpscfa23team2/crab"
 	"cmpscfa23team2/dal"
 	"encoding/json"
 	"html/template"
@@ -23,8 +24,15 @@ type PageData struct {
 	Users        []*dal.User
 }
 
+// store holds the users, predictions, engines and jobs the server works with. Handlers go through it rather
+// than the dal functions, so they can be tested against a dal.MemoryStore.
+var store dal.DataStore = dal.MySQLStore{}
+
 // main function sets up and starts the server.
 func main() {
+	if err := dal.Setup(); err != nil {
+		log.Fatal(err)
+	}
 	dir, err := os.Getwd()
 	if err != nil {
 		log.Fatal(err)
@@ -51,6 +59,7 @@ func setupServer() {
 	tmpl := template.Must(template.ParseGlob("templates/*.gohtml"))
 	log.Println("Templates loaded:", tmpl.DefinedTemplates())
 	setupRoutes(tmpl)
+	startJobQueue()
 
 	log.Println("Starting server on :8080")
 	err = http.ListenAndServe(":8080", nil)
@@ -73,7 +82,27 @@ func setupRoutes(tmpl *template.Template) {
 	})
 	//http.HandleFunc("/dashboard", requireAdmin(dashHandler(tmpl)))
 	//http.HandleFunc("/settings", requireAdmin(makeHandler(tmpl, "settings")))
-	http.HandleFunc("/api/predictions", predictionHandler)
+	http.HandleFunc("/api/predictions", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleOperator), predictionHandler))
+	http.HandleFunc("/api/predict", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleOperator), predictHandler))
+	http.HandleFunc("/api/predict/", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleOperator), predictRequestHandler))
+	http.HandleFunc("/api/predictors", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleViewer), predictorsHandler))
+	http.HandleFunc("/api/jobs", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleOperator), jobsHandler))
+	http.HandleFunc("/api/jobs/", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleOperator), jobHandler))
+	http.HandleFunc("/api/pauses", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleOperator), pausesHandler))
+	http.HandleFunc("/api/pauses/", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleOperator), pausesHandler))
+	http.HandleFunc("/api/engines", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleOperator), enginesHandler))
+	http.HandleFunc("/api/engines/", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleOperator), engineHandler))
+	http.HandleFunc("/api/runs", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleViewer), runsHandler))
+	http.HandleFunc("/api/datasets", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleViewer), datasetsHandler))
+	http.HandleFunc("/api/datasets/", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleViewer), datasetHandler))
+	http.HandleFunc("/api/latency", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleViewer), crab.LatencyHandler))
+	http.HandleFunc("/api/metrics/runs", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleViewer), crab.RunMetricsHandler))
+	http.HandleFunc("/api/metrics/chart", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleViewer), crab.RunMetricsChartHandler))
+	http.HandleFunc("/api/alerts", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleViewer), crab.AlertsHandler))
+	http.HandleFunc("/api/graphql", apiAuth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleViewer), crab.GraphQLHandler))
+	http.HandleFunc("/api/config", apiAuth.Require(crab.ByMethod(crab.RoleAdmin, crab.RoleAdmin), configHandler))
+	http.HandleFunc("/api/db/queries", apiAuth.Require(crab.ByMethod(crab.RoleAdmin, crab.RoleAdmin), queryMetricsHandler))
+	http.HandleFunc("/api/health", healthHandler)
 	fs := http.FileServer(http.Dir("static"))
 	http.Handle("/static/", http.StripPrefix("/static/", fs))
 }
@@ -136,7 +165,7 @@ func loginHandler(tmpl *template.Template, w http.ResponseWriter, r *http.Reques
 		email := r.FormValue("email")
 		password := r.FormValue("password")
 
-		token, err := dal.AuthenticateUser(email, password)
+		token, err := store.AuthenticateUser(email, password)
 		if err != nil {
 			renderLoginTemplate(tmpl, w, "Invalid email or password")
 			return
@@ -213,7 +242,7 @@ func registerHandler(tmpl *template.Template, w http.ResponseWriter, r *http.Req
 		active := true       // Set to false if you require email verification, etc.
 
 		// Call DAL function to register user
-		_, err := dal.RegisterUser(username, email, defaultRole, password, active)
+		_, err := store.RegisterUser(username, email, defaultRole, password, active)
 		if err != nil {
 			tmpl.ExecuteTemplate(w, "register", RegistrationPageData{
 				Title:        "Register",
@@ -246,7 +275,7 @@ func predictionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fetch the prediction data
-	predictionData, err := dal.FetchPredictionData(queryIdentifier, domain)
+	predictionData, err := store.FetchPredictionData(queryIdentifier, domain)
 	if err != nil {
 		log.Printf("Error fetching prediction data: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -276,7 +305,7 @@ func renderDashboardTemplate(tmpl *template.Template, w http.ResponseWriter, use
 func dashHandler(tmpl *template.Template, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 	log.Printf("beginning of dashHandler\n")
-	users, err := dal.GetAllUsers()
+	users, err := store.GetAllUsers()
 	if err != nil {
 		log.Printf("Error fetching users: %v", err)
 		http.Error(w, "Unable to fetch user data", http.StatusInternalServerError)
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runBackfill joins the historical pages of a table dataset into one series, and prints where the pages
+// overlap and which years are missing.
+func runBackfill(args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	configFile := flags.String("config", "", "crab config file, for the output directory and the backfill pages")
+	dir := flags.String("dir", "", "output directory to add the backfill run to (default: the configured one)")
+	pages := flags.String("pages", "", "comma-separated pages to walk, most authoritative first (default: the configured ones)")
+	from := flags.Int("from", 0, "first year of the series (default: the configured one, or 1913)")
+	asJSON := flags.Bool("json", false, "print the backfill report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one dataset name: %s", strings.Join(crab.BackfillDatasets(), ", "))
+	}
+	dataset := flags.Arg(0)
+
+	config := crab.CurrentConfig()
+	if *configFile != "" {
+		loaded, err := crab.LoadConfig(*configFile)
+		if err != nil {
+			return err
+		}
+		config = loaded
+	}
+	if *dir != "" {
+		config.Output.Dir = *dir
+	}
+	if config.Output.Dir == "" {
+		return fmt.Errorf("no output directory given")
+	}
+	backfill := config.Backfill[dataset]
+	if *pages != "" {
+		backfill.Pages = nil
+		for _, page := range strings.Split(*pages, ",") {
+			if page = strings.TrimSpace(page); page != "" {
+				backfill.Pages = append(backfill.Pages, page)
+			}
+		}
+	}
+	if *from != 0 {
+		backfill.From = *from
+	}
+	backfills := map[string]crab.BackfillConfig{}
+	for name, other := range config.Backfill {
+		backfills[name] = other
+	}
+	backfills[dataset] = backfill
+	config.Backfill = backfills
+	crab.SetConfig(config)
+
+	report, err := crab.Backfill(dataset)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	fmt.Printf("Backfilled %s: %d years from %d to %d into %s\n", report.Dataset, report.Years, report.From, report.To, report.File)
+	for _, page := range report.Pages {
+		fmt.Printf("  %s: %d rows, %d-%d\n", page.URL, page.Rows, page.FirstYear, page.LastYear)
+	}
+	for _, overlap := range report.Overlaps {
+		if len(overlap.Changes) == 0 {
+			fmt.Printf("  %d is on %d pages with the same values\n", overlap.Year, len(overlap.Pages))
+			continue
+		}
+		fmt.Printf("  %d is on %d pages, kept from %s:\n", overlap.Year, len(overlap.Pages), overlap.Pages[0])
+		for _, change := range overlap.Changes {
+			fmt.Printf("    %s: %q, elsewhere %q\n", change.Column, change.Previous, change.Current)
+		}
+	}
+	if !report.Continuous() {
+		fmt.Printf("  %d missing years: %v\n", len(report.Gaps), report.Gaps)
+	}
+	return nil
+}
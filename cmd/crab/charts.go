@@ -0,0 +1,54 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// runCharts draws the trend charts of the time series a run scraped, as runs with the charts config do
+// when they finish, to chart an older run or the datasets of the working directory.
+func runCharts(args []string) error {
+	flags := flag.NewFlagSet("charts", flag.ContinueOnError)
+	dir := flags.String("dir", "", "output directory holding the runs (default: the configured one, else the working directory's datasets)")
+	runID := flags.String("run", "", "run ID to chart (default: the latest run)")
+	out := flags.String("out", "", "directory to write the charts to (default: next to the datasets)")
+	formats := flags.String("formats", "png", "comma separated chart formats, png and svg")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+	if *dir == "" {
+		*dir = crab.CurrentConfig().Output.Dir
+	}
+	dataDir := "."
+	if *dir != "" {
+		if *runID == "" {
+			runs, err := crab.ListRuns(*dir)
+			if err != nil {
+				return err
+			}
+			if len(runs) == 0 {
+				return fmt.Errorf("no runs in %s", *dir)
+			}
+			*runID = runs[len(runs)-1]
+		}
+		dataDir = filepath.Join(*dir, *runID)
+	}
+	if *out == "" {
+		*out = dataDir
+	}
+
+	written, err := crab.GenerateTrendCharts(dataDir, *out, strings.Split(*formats, ",")...)
+	for _, file := range written {
+		fmt.Println(file)
+	}
+	if err == nil && len(written) == 0 {
+		return fmt.Errorf("no inflation, gasoline or airfare data in %s", dataDir)
+	}
+	return err
+}
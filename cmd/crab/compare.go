@@ -0,0 +1,39 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runCompare diffs two sitemaps and prints the result as a summary or, with -json, as JSON.
+func runCompare(args []string) error {
+	flags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the diff as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("expected two sitemap files, got %d", flags.NArg())
+	}
+
+	previous, err := crab.LoadSiteMap(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	current, err := crab.LoadSiteMap(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	diff := crab.DiffSiteMaps(previous, current)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(diff)
+	}
+	fmt.Print(diff.Summary())
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/crawler"
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// runCrawl crawls the given URLs with the crawler package and writes their sitemap like the job queue's
+// crawl jobs do.
+func runCrawl(args []string) error {
+	flags := flag.NewFlagSet("crawl", flag.ContinueOnError)
+	workers := flags.Int("workers", 10, "number of concurrent crawlers")
+	parseWorkers := flags.Int("parse-workers", 0, "number of pages parsed at once (default one per CPU)")
+	configFile := flags.String("config", "", "crab config file")
+	profile := flags.String("profile", "", "configuration profile to crawl with")
+	deterministic := flags.Bool("deterministic", false, "reproduce the same outputs for the same inputs")
+	seed := flags.Int64("seed", 0, "random seed for -deterministic")
+	trace := flags.Bool("trace", false, "write a per-request timeline to trace.json (Chrome trace format)")
+	audit := flags.Bool("seo-audit", false, "audit the pages for SEO issues and write a scored seo_audit.json")
+	security := flags.Bool("security-audit", false, "audit the security headers and mixed content of the pages into security_audit.json")
+	a11y := flags.Bool("a11y", false, "scan the pages with axe-core and write the violations to a11y_report.json")
+	certificates := flags.Bool("certificates", false, "record the TLS certificates of the hosts in the crawl report, flagging those about to expire")
+	follow := flags.Bool("follow", false, "also crawl the links found on the pages, on the hosts of the given URLs")
+	sitemaps := flags.Bool("sitemaps", false, "also crawl the pages listed in the sitemaps of each domain's robots.txt")
+	plugins := flags.String("plugins", "", "comma-separated Go plugins registering custom extractors, in addition to the config's")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("expected at least one URL")
+	}
+
+	if *configFile != "" {
+		config, err := crab.LoadConfig(*configFile)
+		if err != nil {
+			return err
+		}
+		crab.SetConfig(config)
+	}
+	var extractorPlugins []string
+	for _, plugin := range strings.Split(*plugins, ",") {
+		if plugin = strings.TrimSpace(plugin); plugin != "" {
+			extractorPlugins = append(extractorPlugins, plugin)
+		}
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	if *configFile != "" {
+		// Rate limit changes to the file apply to the running crawl
+		if err := crab.WatchConfig(ctx, *configFile, nil); err != nil {
+			fmt.Printf("Error watching %s: %v\n", *configFile, err)
+		}
+	}
+
+	_, err := crawler.New(crawler.Options{
+		Profile:       *profile,
+		Workers:       *workers,
+		ParseWorkers:  *parseWorkers,
+		Deterministic: *deterministic,
+		Seed:          *seed,
+		Trace:         *trace,
+		SEOAudit:      *audit,
+		SecurityAudit: *security,
+		A11y:          *a11y,
+		Certificates:  *certificates,
+		Follow:        *follow,
+		Sitemaps:      *sitemaps,
+		Plugins:       extractorPlugins,
+	}).Run(ctx, flags.Args())
+	return err
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// runDataset prints a scraped dataset as it stood after a run, to repeat an analysis on the same data or
+// to look past a bad scrape.
+func runDataset(args []string) error {
+	flags := flag.NewFlagSet("dataset", flag.ContinueOnError)
+	dir := flags.String("dir", "", "output directory holding the runs (default: the configured one)")
+	runID := flags.String("run", "", "run ID to read the dataset as of (default: the latest run)")
+	asJSON := flags.Bool("json", false, "print the dataset as JSON instead of CSV")
+	stats := flags.Bool("stats", false, "print the summary statistics the run recorded instead of the rows")
+	quality := flags.Bool("quality", false, "print the results of the data quality checks instead of the rows")
+	annotations := flags.Bool("annotations", false, "add the annotations stripped from the cells as <column>_annotation columns")
+	currency := flags.String("currency", "", "convert the prices from USD into this currency, e.g. EUR")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one dataset name, got %d", flags.NArg())
+	}
+	if *dir == "" {
+		*dir = crab.CurrentConfig().Output.Dir
+	}
+	if *dir == "" {
+		return fmt.Errorf("no output directory given")
+	}
+
+	if *stats {
+		summary, err := crab.LoadDatasetStats(*dir, flags.Arg(0), *runID)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(summary)
+		}
+		fmt.Printf("Run %s, %s\n", summary.RunID, summary)
+		return nil
+	}
+	if *quality {
+		results, err := crab.LoadQualityResults(*dir, flags.Arg(0), *runID)
+		if err != nil {
+			return err
+		}
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(results)
+		}
+		for _, result := range results {
+			status := "ok"
+			if !result.Success {
+				status = result.Severity
+			}
+			fmt.Printf("%-4s  %s: %d of %d values failed", status, result.Expectation, result.Failed, result.Checked)
+			if len(result.Unexpected) > 0 {
+				fmt.Printf(", e.g. %s", strings.Join(result.Unexpected, ", "))
+			}
+			fmt.Println()
+		}
+		return nil
+	}
+	ds, err := crab.LoadDatasetAsOf(*dir, flags.Arg(0), *runID)
+	if err != nil {
+		return err
+	}
+	if *currency != "" {
+		if ds, err = crab.ConvertScrapedDataset(ds, *currency); err != nil {
+			return err
+		}
+	}
+	if *annotations {
+		report, err := crab.LoadAnnotations(*dir, flags.Arg(0), ds.RunID)
+		if err != nil {
+			return err
+		}
+		ds = crab.WithAnnotationColumns(ds, report.Annotations)
+	}
+	fmt.Fprintf(os.Stderr, "%s as of run %s (%d rows)\n", ds.Name, ds.RunID, len(ds.Rows))
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(ds)
+	}
+	return ds.WriteCSV(os.Stdout)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runEstimate samples a domain and prints the projected size and duration of crawling it.
+func runEstimate(args []string) error {
+	flags := flag.NewFlagSet("estimate", flag.ContinueOnError)
+	sample := flags.Int("sample", 0, "number of pages to fetch (default 5)")
+	delay := flags.Duration("delay", 0, "average delay between requests (default: the crawler's rate limit)")
+	asJSON := flags.Bool("json", false, "print the estimate as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one URL, got %d", flags.NArg())
+	}
+
+	estimate, err := crab.EstimateCrawl(flags.Arg(0), crab.EstimateOptions{SampleSize: *sample, Delay: *delay})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(estimate)
+	}
+	fmt.Print(estimate.Summary())
+	return nil
+}
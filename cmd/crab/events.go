@@ -0,0 +1,60 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runEvents prints the event log of a crawl or scrape run, optionally only the events of one URL or type.
+func runEvents(args []string) error {
+	flags := flag.NewFlagSet("events", flag.ContinueOnError)
+	dir := flags.String("dir", "", "output directory holding the runs (default: the configured one)")
+	runID := flags.String("run", "", "run ID to read the events of (default: the latest run with an event log)")
+	url := flags.String("url", "", "only print the events of this URL")
+	eventType := flags.String("type", "", "only print the events of this type, e.g. fetch_completed")
+	asJSON := flags.Bool("json", false, "print the events as JSON lines")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+	if *dir == "" {
+		*dir = crab.CurrentConfig().Output.Dir
+	}
+	if *dir == "" {
+		return fmt.Errorf("no output directory given")
+	}
+
+	events, err := crab.LoadEvents(*dir, *runID)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	for _, event := range events {
+		if (*url != "" && event.URL != *url) || (*eventType != "" && event.Type != *eventType) {
+			continue
+		}
+		if *asJSON {
+			if err := encoder.Encode(event); err != nil {
+				return err
+			}
+			continue
+		}
+		line := fmt.Sprintf("%s  %s  %-17s %s", event.Time.Format("15:04:05.000"), event.ID, event.Type, event.URL)
+		if event.StatusCode != 0 {
+			line += fmt.Sprintf("  %d", event.StatusCode)
+		}
+		if event.DurationMS > 0 {
+			line += fmt.Sprintf("  %.1fms", event.DurationMS)
+		}
+		if event.Error != "" {
+			line += "  " + event.Error
+		}
+		fmt.Println(line)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"flag"
+	"fmt"
+	"path/filepath"
+)
+
+// runExport writes the scraped datasets of a run into one XLSX workbook, a sheet for each dataset, for
+// the people who read the data in Excel.
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	dir := flags.String("dir", "", "output directory holding the runs (default: the configured one, else the working directory's datasets)")
+	runID := flags.String("run", "", "run ID to export the datasets of (default: the latest run)")
+	out := flags.String("o", "datasets.xlsx", "workbook to write")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+	if *dir == "" {
+		*dir = crab.CurrentConfig().Output.Dir
+	}
+	dataDir := "."
+	if *dir != "" {
+		if *runID == "" {
+			runs, err := crab.ListRuns(*dir)
+			if err != nil {
+				return err
+			}
+			if len(runs) == 0 {
+				return fmt.Errorf("no runs in %s", *dir)
+			}
+			*runID = runs[len(runs)-1]
+		}
+		dataDir = filepath.Join(*dir, *runID)
+	}
+
+	if err := crab.ExportScrapedDatasetsXLSX(dataDir, *out); err != nil {
+		return err
+	}
+	fmt.Println(*out)
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"flag"
+	"fmt"
+)
+
+// runFixtures records sanitized copies of the scrapers' pages for the extraction tests.
+func runFixtures(args []string) error {
+	flags := flag.NewFlagSet("fixtures", flag.ContinueOnError)
+	dir := flags.String("dir", "crab_test/testdata/fixtures", "directory the fixtures are written to")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	names := flags.Args()
+	if len(names) == 0 {
+		names = crab.FixtureScrapers()
+	}
+
+	for _, name := range names {
+		path, records, err := crab.RecordFixture(*dir, name)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fmt.Printf("%-10s %s (%d records)\n", name, path, records)
+		if records == 0 {
+			fmt.Printf("%-10s warning: nothing was extracted, the page layout may have changed\n", name)
+		}
+	}
+	return nil
+}
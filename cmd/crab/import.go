@@ -0,0 +1,59 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// runImport loads a downloaded CSV, XLSX or JSON file into one of the scraped datasets, so it is stored,
+// merged and checked with the scraped versions.
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	configFile := flags.String("config", "", "crab config file, for the output directory and the dataset rules")
+	dir := flags.String("dir", "", "output directory to add the import run to (default: the configured one)")
+	format := flags.String("format", "", "file format: csv, tsv, xlsx, json or ndjson (default: from the extension)")
+	sheet := flags.String("sheet", "", "worksheet to read from an XLSX file (default: the one named like the dataset, or the first)")
+	columns := flags.String("columns", "", "comma-separated renames of file columns to dataset columns, e.g. bed=bedrooms,bath=bathrooms")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("expected a dataset name and a file")
+	}
+
+	config := crab.CurrentConfig()
+	if *configFile != "" {
+		loaded, err := crab.LoadConfig(*configFile)
+		if err != nil {
+			return err
+		}
+		config = loaded
+	}
+	if *dir != "" {
+		config.Output.Dir = *dir
+	}
+	if config.Output.Dir == "" {
+		return fmt.Errorf("no output directory given")
+	}
+	crab.SetConfig(config)
+
+	options := crab.ImportOptions{Format: *format, Sheet: *sheet, Columns: map[string]string{}}
+	for _, rename := range strings.Split(*columns, ",") {
+		if rename = strings.TrimSpace(rename); rename == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(rename, "=")
+		if !ok {
+			return fmt.Errorf("invalid column rename %q, expected from=to", rename)
+		}
+		options.Columns[strings.TrimSpace(from)] = strings.TrimSpace(to)
+	}
+	filename, err := crab.ImportDataset(flags.Arg(0), flags.Arg(1), options)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %s into %s\n", flags.Arg(1), filename)
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runLatency prints the response time percentiles of the crawled domains over the crawl runs, to spot
+// performance regressions of monitored sites.
+func runLatency(args []string) error {
+	flags := flag.NewFlagSet("latency", flag.ContinueOnError)
+	dir := flags.String("dir", "", "output directory holding the runs (default: the configured one)")
+	domain := flags.String("domain", "", "domain to print the latency of (default: every domain)")
+	from := flags.String("from", "", "print the runs started at or after this RFC 3339 time or date")
+	to := flags.String("to", "", "print the runs started at or before this RFC 3339 time or date")
+	asJSON := flags.Bool("json", false, "print the latencies as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+	if *dir == "" {
+		*dir = crab.CurrentConfig().Output.Dir
+	}
+	if *dir == "" {
+		return fmt.Errorf("no output directory given")
+	}
+	fromTime, err := crab.ParseLatencyTime("-from", *from)
+	if err != nil {
+		return err
+	}
+	toTime, err := crab.ParseLatencyTime("-to", *to)
+	if err != nil {
+		return err
+	}
+
+	samples, err := crab.LatencyHistory(*dir, *domain, fromTime, toTime)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(samples)
+	}
+	fmt.Printf("%-20s %-32s %8s %27s %27s\n", "RUN", "DOMAIN", "REQUESTS", "TTFB P50/P95/P99 MS", "FETCH P50/P95/P99 MS")
+	for _, sample := range samples {
+		fmt.Printf("%-20s %-32s %8d %8.1f %8.1f %8.1f  %8.1f %8.1f %8.1f\n", sample.RunID, sample.Domain, sample.Requests,
+			sample.TTFB.P50, sample.TTFB.P95, sample.TTFB.P99, sample.Fetch.P50, sample.Fetch.P95, sample.Fetch.P99)
+	}
+	return nil
+}
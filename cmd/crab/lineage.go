@@ -0,0 +1,60 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runLineage prints where the rows of a scraped dataset came from, or only the rows holding a value, to
+// trace a number back to the page and run that produced it.
+func runLineage(args []string) error {
+	flags := flag.NewFlagSet("lineage", flag.ContinueOnError)
+	dir := flags.String("dir", "", "output directory holding the runs (default: the configured one)")
+	runID := flags.String("run", "", "run ID to read the dataset as of (default: the latest run)")
+	column := flags.String("column", "", "column the value must be in (default: any column)")
+	asJSON := flags.Bool("json", false, "print the lineage as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		return fmt.Errorf("expected a dataset name and optionally a value")
+	}
+	if *dir == "" {
+		*dir = crab.CurrentConfig().Output.Dir
+	}
+	if *dir == "" {
+		return fmt.Errorf("no output directory given")
+	}
+
+	var lineage []crab.RowLineage
+	var err error
+	if flags.NArg() == 2 {
+		lineage, err = crab.TraceValue(*dir, flags.Arg(0), *runID, *column, flags.Arg(1))
+	} else {
+		lineage, err = crab.DatasetLineage(*dir, flags.Arg(0), *runID)
+	}
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(lineage)
+	}
+	if len(lineage) == 0 {
+		fmt.Println("No matching rows")
+	}
+	for _, row := range lineage {
+		fmt.Printf("%s row %d: %v\n", row.Dataset, row.Row, row.Values)
+		fmt.Printf("  page:       %s (fetched %s)\n", row.SourceURL, row.FetchedAt.Format("2006-01-02 15:04:05Z"))
+		fmt.Printf("  run:        %s\n", row.RunID)
+		fmt.Printf("  extractor:  %s v%s, rows from %q\n", row.Extractor, row.ExtractorVersion, row.Selector)
+		if row.Hash != "" {
+			fmt.Printf("  hash:       %s\n", row.Hash)
+		}
+	}
+	return nil
+}
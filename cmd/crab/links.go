@@ -0,0 +1,90 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// runLinks queries the link graph of a crawl: the pages linking to a URL, the orphan pages, or the pages
+// deeper than a number of clicks from the seeds.
+func runLinks(args []string) error {
+	flags := flag.NewFlagSet("links", flag.ContinueOnError)
+	dir := flags.String("dir", "", "output directory holding the runs (default: the configured one)")
+	runID := flags.String("run", "", "crawl run ID to query as of (default: the latest crawl)")
+	siteMapFile := flags.String("sitemap", "", "query this sitemap file instead of a run's")
+	seeds := flags.String("seeds", "", "comma-separated seeds of the -sitemap crawl, for deeper queries")
+	prefix := flags.String("prefix", "", "list only the pages starting with this")
+	limit := flags.Int("limit", 0, "list at most this many pages (default all)")
+	offset := flags.Int("offset", 0, "skip this many pages")
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	q := crab.LinkQuery{Kind: flags.Arg(0), Prefix: *prefix, Limit: *limit, Offset: *offset}
+	switch {
+	case q.Kind == "inlinks" && flags.NArg() == 2:
+		q.URL = flags.Arg(1)
+	case q.Kind == "deeper" && flags.NArg() == 2:
+		depth, err := strconv.Atoi(flags.Arg(1))
+		if err != nil {
+			return fmt.Errorf("invalid depth %q", flags.Arg(1))
+		}
+		q.Depth = depth
+	case q.Kind == "orphans" && flags.NArg() == 1:
+	default:
+		return fmt.Errorf("expected inlinks <url>, orphans or deeper <clicks>")
+	}
+
+	var graph *crab.LinkGraph
+	if *siteMapFile != "" {
+		siteMap, err := crab.LoadSiteMap(*siteMapFile)
+		if err != nil {
+			return err
+		}
+		var seedList []string
+		if *seeds != "" {
+			seedList = strings.Split(*seeds, ",")
+		}
+		graph = crab.NewLinkGraph(siteMap, seedList)
+	} else {
+		if *dir == "" {
+			*dir = crab.CurrentConfig().Output.Dir
+		}
+		if *dir == "" {
+			return fmt.Errorf("no output directory or sitemap given")
+		}
+		var err error
+		if graph, err = crab.LoadLinkGraph(*dir, *runID); err != nil {
+			return err
+		}
+	}
+	result, err := graph.Query(q)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "URL\tDEPTH\tINLINKS\tOUTLINKS")
+	for _, page := range result.Pages {
+		depth := strconv.Itoa(page.Depth)
+		if page.Depth < 0 {
+			depth = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", page.URL, depth, page.Inlinks, page.Outlinks)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d of %d page(s)\n", len(result.Pages), result.Total)
+	return nil
+}
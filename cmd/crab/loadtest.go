@@ -0,0 +1,74 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runLoadTest crawls the synthetic test site and prints the throughput and resource use of the crawl,
+// failing when it falls short of the given limits so performance regressions break the build.
+func runLoadTest(args []string) error {
+	flags := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	pages := flags.Int("pages", 0, "pages of the mock site to crawl (default 500)")
+	fanout := flags.Int("fanout", 0, "links on each page (default 10)")
+	paragraphs := flags.Int("paragraphs", 0, "paragraphs of text on each page (default 20)")
+	workers := flags.Int("workers", 10, "number of concurrent crawlers")
+	parseWorkers := flags.Int("parse-workers", 0, "number of pages parsed at once (default one per CPU)")
+	dir := flags.String("dir", "", "output directory of the crawl (default: a temporary one, removed afterwards)")
+	minRate := flags.Float64("min-pages-per-sec", 0, "fail when the crawl is slower than this")
+	maxAllocs := flags.Float64("max-allocs-per-page", 0, "fail when a page takes more allocations than this")
+	maxLeaked := flags.Int("max-leaked-goroutines", -1, "fail when more goroutines than this outlive the crawl")
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+	if *dir == "" {
+		temp, err := os.MkdirTemp("", "crab-loadtest-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(temp)
+		*dir = temp
+	}
+	config := crab.CurrentConfig()
+	config.Output.Dir = *dir
+	crab.SetConfig(config)
+
+	result, err := crab.RunLoadTest(context.Background(), crab.LoadTestOptions{
+		Pages:        *pages,
+		Fanout:       *fanout,
+		Paragraphs:   *paragraphs,
+		Workers:      *workers,
+		ParseWorkers: *parseWorkers,
+	})
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+	} else {
+		fmt.Print(result.Summary())
+	}
+
+	if *minRate > 0 && result.PagesPerSec < *minRate {
+		return fmt.Errorf("%.1f pages/sec is below the minimum of %g", result.PagesPerSec, *minRate)
+	}
+	if *maxAllocs > 0 && result.AllocsPerPage > *maxAllocs {
+		return fmt.Errorf("%.0f allocs/page is over the maximum of %g", result.AllocsPerPage, *maxAllocs)
+	}
+	if leaked := result.GoroutinesAfter - result.GoroutinesBefore; *maxLeaked >= 0 && leaked > *maxLeaked {
+		return fmt.Errorf("%d goroutines outlived the crawl, over the maximum of %d", leaked, *maxLeaked)
+	}
+	return nil
+}
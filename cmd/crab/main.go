@@ -0,0 +1,111 @@
+// Command crab runs crawler and scraper utilities from the command line.
+//
+// Usage:
+//
+//	crab [--log-level level] [--log-file file] <command> [arguments]
+//
+// Run "crab help" for the list of commands and logging flags.
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// command is one crab subcommand. run receives the arguments after the command name.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+// commands maps each subcommand name to its implementation.
+var commands = map[string]command{
+	"backfill":   {"backfill [-config file] [-dir d] [-pages url,...] [-from year] [-json] <dataset>  join the historical pages of a table dataset into one series", runBackfill},
+	"charts":     {"charts [-dir d] [-run id] [-out dir] [-formats png,svg]  draw the trend charts of the inflation, gasoline and airfare data of a run", runCharts},
+	"compare":    {"compare [-json] <old siteMap.json> <new siteMap.json>  diff the sitemaps of two crawl runs", runCompare},
+	"crawl":      {"crawl [-workers n] [-parse-workers n] [-config file] [-profile name] [-plugins a.so,...] [-deterministic] [-seed n] [-trace] [-seo-audit] [-security-audit] [-a11y] [-certificates] [-sitemaps] <url...>  crawl URLs and write their sitemap", runCrawl},
+	"dataset":    {"dataset [-dir d] [-run id] [-currency c] [-annotations] [-stats|-quality] [-json] <name>  print a scraped dataset as of a run", runDataset},
+	"estimate":   {"estimate [-sample n] [-delay d] [-json] <url>  project the pages, bandwidth and time of a crawl", runEstimate},
+	"events":     {"events [-dir d] [-run id] [-url u] [-type t] [-json]  print the event log of each URL's way through a run", runEvents},
+	"export":     {"export [-dir d] [-run id] [-o file]  write the scraped datasets of a run into one XLSX workbook, a sheet per dataset", runExport},
+	"fixtures":   {"fixtures [-dir d] [scraper...]  record sanitized scraper pages for the extraction tests", runFixtures},
+	"import":     {"import [-config file] [-dir d] [-format f] [-sheet s] [-columns from=to,...] <dataset> <file>  load a CSV, XLSX or JSON file into a scraped dataset", runImport},
+	"latency":    {"latency [-dir d] [-domain d] [-from t] [-to t] [-json]  print the response time percentiles of the crawled domains over the crawl runs", runLatency},
+	"lineage":    {"lineage [-dir d] [-run id] [-column c] [-json] <dataset> [value]  trace dataset rows back to their page and run", runLineage},
+	"links":      {"links [-dir d] [-run id] [-sitemap file [-seeds a,...]] [-prefix p] [-limit n] [-offset n] [-json] inlinks <url> | orphans | deeper <clicks>  query the link graph of a crawl", runLinks},
+	"loadtest":   {"loadtest [-pages n] [-fanout n] [-paragraphs n] [-workers n] [-parse-workers n] [-dir d] [-min-pages-per-sec r] [-max-allocs-per-page n] [-max-leaked-goroutines n] [-json]  crawl the synthetic test site and report pages/sec, allocs/page and goroutines", runLoadTest},
+	"openapi":    {"openapi [-o file] | -client file [-package p]  write the OpenAPI spec of the serve API, or its generated Go client", runOpenAPI},
+	"pause":      {"pause [-state file] [-job id] [domain...]  pause crawling of domains or a queued job, or list the pauses", runPause},
+	"pipeline":   {"pipeline run [-config file] [-dir d] [-json] <workflow> | resume <run-id> | list  run or resume a scrape-to-predict workflow of the config", runPipeline},
+	"quarantine": {"quarantine [-dir d] [-run id] [-json] <dataset>  list the anomalous values held back from a dataset", runQuarantine},
+	"report":     {"report [-dir d] [-run id] [-format f] <template>  render a report template on a run", runReport},
+	"resume":     {"resume [-state file] [-job id] [domain...]  resume paused domains or a paused job", runResume},
+	"revisions":  {"revisions [-dir d] [-run id] [-json] <dataset>  list the rows of a dataset whose values the source revised between runs", runRevisions},
+	"robots":     {"robots [-agent name] [-json] <url>  show which robots.txt rule allows or denies a URL", runRobots},
+	"schema":     {"schema infer [-dir d] [-run id] [-file f] [-type name] [-go file] [-schema file] [-json] <dataset>  infer the column types of a dataset and write a Go struct and JSON Schema for it", runSchema},
+	"scrape":     {"scrape [-config file] [-dir d] [-all] <scraper...> | -list [-json]  run the named or every enabled scraper, or list them", runScrape},
+	"security":   {"security [-dir d] [-run id] [-json]  print the per-domain security header audit of a crawl run", runSecurity},
+	"seo":        {"seo [-dir d] [-run id] [-json]  print the scored SEO audit of a crawl run", runSEO},
+	"serve":      {"serve [-addr a] [-data-dir d]  run as a service taking jobs over HTTP, configured by $CRAB_CONFIG and CRAB_* variables", runServe},
+}
+
+func main() {
+	// Logging flags come before the command
+	var logConfig crab.LogConfig
+	global := flag.NewFlagSet("crab", flag.ContinueOnError)
+	global.Usage = printUsage
+	global.StringVar(&logConfig.Level, "log-level", "info", "debug, info, warn or error")
+	global.StringVar(&logConfig.File, "log-file", "", "write the log to this file instead of standard error")
+	global.IntVar(&logConfig.MaxSizeMB, "log-max-size", 0, "rotate the log file past this many megabytes (default 100)")
+	global.StringVar(&logConfig.MaxAge, "log-max-age", "", "rotate the log file once it is this old, e.g. 24h")
+	global.IntVar(&logConfig.MaxBackups, "log-backups", 0, "rotated log files to keep (default all)")
+	global.BoolVar(&logConfig.Compress, "log-compress", false, "gzip rotated log files")
+	if err := global.Parse(os.Args[1:]); err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		os.Exit(2)
+	}
+	args := global.Args()
+	if len(args) < 1 || args[0] == "help" {
+		printUsage()
+		return
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "crab: unknown command %q\n\n", args[0])
+		printUsage()
+		os.Exit(2)
+	}
+	closeLog, err := crab.SetupLogging(logConfig)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "crab: %v\n", err)
+		os.Exit(2)
+	}
+	err = cmd.run(args[1:])
+	closeLog()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "crab %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+}
+
+// printUsage lists the available commands.
+func printUsage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Usage: crab [logging flags] <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nLogging flags:")
+	fmt.Fprintln(os.Stderr, "  --log-level debug|info|warn|error  --log-file file  --log-max-size mb  --log-max-age d  --log-backups n  --log-compress")
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runOpenAPI writes the OpenAPI spec of the daemon's REST API, or the Go client package crab/client
+// generates from its routes.
+func runOpenAPI(args []string) error {
+	flags := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	out := flags.String("o", "", "write the spec to this file instead of standard output")
+	client := flags.String("client", "", "write the Go client operations to this file instead of the spec")
+	pkg := flags.String("package", "client", "the package of the Go client")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+
+	routes := crab.NewDaemon(crab.DaemonConfig{}, nil).Routes()
+	if *client != "" {
+		source, err := crab.GenerateClient(routes, *pkg)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(*client, source, 0644)
+	}
+	spec, err := json.MarshalIndent(crab.OpenAPISpec(routes), "", "  ")
+	if err != nil {
+		return err
+	}
+	spec = append(spec, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(spec)
+		return err
+	}
+	return os.WriteFile(*out, spec, 0644)
+}
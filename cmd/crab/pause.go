@@ -0,0 +1,52 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"flag"
+	"fmt"
+)
+
+// runPause pauses crawling of domains, or lists what is paused when given none. Crawls and job queues
+// running in other processes with the same state file pick the change up within a second.
+func runPause(args []string) error {
+	return updatePauses("pause", args, (*crab.PauseList).PauseDomain, (*crab.PauseList).PauseJob)
+}
+
+// runResume resumes crawling of paused domains.
+func runResume(args []string) error {
+	return updatePauses("resume", args, (*crab.PauseList).ResumeDomain, (*crab.PauseList).ResumeJob)
+}
+
+// updatePauses applies domainFn to the domain arguments and jobFn to the -job IDs, then prints the pauses.
+func updatePauses(name string, args []string, domainFn, jobFn func(*crab.PauseList, string) error) error {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	stateFile := flags.String("state", "paused.json", "pause state file of the crawls to control")
+	job := flags.String("job", "", "ID of a queued job to "+name)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	pauses := crab.NewPauseList(*stateFile)
+	if *job != "" {
+		if err := jobFn(pauses, *job); err != nil {
+			return err
+		}
+	}
+	for _, domain := range flags.Args() {
+		if err := domainFn(pauses, domain); err != nil {
+			return err
+		}
+	}
+
+	list := pauses.List()
+	if len(list.Domains) == 0 && len(list.Jobs) == 0 {
+		fmt.Println("Nothing is paused")
+	}
+	for _, domain := range list.Domains {
+		fmt.Printf("paused domain  %s\n", domain)
+	}
+	for _, id := range list.Jobs {
+		fmt.Printf("paused job     %s\n", id)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/dal"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+func init() {
+	crab.RegisterWorkflowStage("predict", predictStage)
+	crab.RegisterWorkflowStage("store", storeStage)
+}
+
+// runPipeline runs a scrape-to-predict workflow of the crab config ("run <workflow>"), resumes a failed
+// run from the stages that did not succeed ("resume <run-id>") or lists the workflows ("list"). Runs are
+// persisted in the database when it is reachable; otherwise they run all the same but cannot be resumed.
+func runPipeline(args []string) error {
+	if len(args) == 0 || (args[0] != "run" && args[0] != "resume" && args[0] != "list") {
+		return fmt.Errorf("expected run <workflow>, resume <run-id> or list")
+	}
+	action := args[0]
+	flags := flag.NewFlagSet("pipeline "+action, flag.ContinueOnError)
+	configFile := flags.String("config", "", "crab config file declaring the workflows")
+	dir := flags.String("dir", "", "output directory for the scrape and import runs (default: the configured one)")
+	asJSON := flags.Bool("json", false, "print the stage results as JSON")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	config := crab.CurrentConfig()
+	if *configFile != "" {
+		loaded, err := crab.LoadConfig(*configFile)
+		if err != nil {
+			return err
+		}
+		config = loaded
+	}
+	if *dir != "" {
+		config.Output.Dir = *dir
+	}
+	crab.SetConfig(config)
+
+	if action == "list" {
+		for _, name := range crab.Workflows() {
+			workflow := config.Workflows[name]
+			fmt.Printf("%s  %s, %d stages\n", name, workflow.Dataset, len(workflow.Stages))
+		}
+		return nil
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one workflow name or run ID, got %d", flags.NArg())
+	}
+
+	if dal.DB == nil {
+		if err := dal.InitDB(); err != nil {
+			if action == "resume" {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Warning: not saving the run, so it cannot be resumed: %v\n", err)
+		}
+	}
+	if dal.DB != nil {
+		crab.SetWorkflowStore(dal.WorkflowStore{})
+	}
+
+	var run crab.WorkflowRun
+	var err error
+	if action == "resume" {
+		run, err = crab.ResumeWorkflow(context.Background(), flags.Arg(0))
+	} else {
+		run, err = crab.RunWorkflow(context.Background(), flags.Arg(0))
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(run); encodeErr != nil {
+			return encodeErr
+		}
+		return err
+	}
+	for _, stage := range run.Stages {
+		fmt.Printf("%-10s %-9s %d attempts  %5d rows  %s", stage.Name, stage.Status, stage.Attempts, stage.Rows,
+			stage.Duration.Round(time.Millisecond))
+		if stage.Error != "" {
+			fmt.Printf("  %s", stage.Error)
+		}
+		fmt.Println()
+	}
+	if file := run.Values["report_file"]; file != "" {
+		fmt.Println("Report written to", file)
+	}
+	if err != nil && run.RunID != "" && dal.DB != nil {
+		fmt.Printf("Resume with: crab pipeline resume %s\n", run.RunID)
+	}
+	return err
+}
+
+// predictStage predicts each row of the workflow's dataset from its features with the predictor backends
+// of dal.DefaultPredictors, adding the prediction and the backend that made it as the "prediction" and
+// "predictor" columns. The predictions are kept for the store stage.
+func predictStage(ctx context.Context, run *crab.WorkflowRun, params map[string]string) error {
+	if len(run.Features) == 0 {
+		return fmt.Errorf("no features to predict from, a features stage must come first")
+	}
+	inputs, err := run.FeatureInputs()
+	if err != nil {
+		return err
+	}
+	if len(inputs) == 0 {
+		return fmt.Errorf("no rows to predict")
+	}
+	request := dal.NewPredictionRequest(inputs)
+	outcomes := dal.DefaultPredictors.PredictRequest(ctx, &request)
+	if request.State != crab.JobSucceeded {
+		return fmt.Errorf("%s", request.Error)
+	}
+	if err := run.AddColumn("prediction", request.Results); err != nil {
+		return err
+	}
+	if err := run.AddColumn("predictor", request.Backends); err != nil {
+		return err
+	}
+	if err := run.SetData("prediction_request", request); err != nil {
+		return err
+	}
+	if err := run.SetData("prediction_outcomes", outcomes); err != nil {
+		return err
+	}
+	run.Values["prediction_request"] = request.RequestID
+	return nil
+}
+
+// storeStage saves the predictions of the predict stage in the database, where GET /api/predict/{id} and
+// the predictor comparison report find them. With a "table" param it also bulk loads the dataset into that
+// table, whose columns must be named like the dataset's.
+func storeStage(ctx context.Context, run *crab.WorkflowRun, params map[string]string) error {
+	var request dal.PredictionRequest
+	ok, err := run.GetData("prediction_request", &request)
+	if err != nil {
+		return err
+	}
+	if !ok && params["table"] == "" {
+		return fmt.Errorf("nothing to store, a predict stage or a table param is needed")
+	}
+	if dal.DB == nil {
+		if err := dal.InitDB(); err != nil {
+			return err
+		}
+	}
+	if ok {
+		if err := dal.SavePredictionRequest(request); err != nil {
+			return err
+		}
+		var outcomes []dal.PredictionOutcome
+		if _, err := run.GetData("prediction_outcomes", &outcomes); err != nil {
+			return err
+		}
+		if err := dal.SavePredictionOutcomes(outcomes); err != nil {
+			return err
+		}
+	}
+	if table := params["table"]; table != "" {
+		loaded, err := dal.BulkLoadDataset(table, run.Dataset, dal.BulkLoader{})
+		if err != nil {
+			return err
+		}
+		run.Values["stored_rows"] = strconv.Itoa(loaded)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runQuarantine lists the values of a scraped dataset that a run held back as probable extraction
+// errors, for review.
+func runQuarantine(args []string) error {
+	flags := flag.NewFlagSet("quarantine", flag.ContinueOnError)
+	dir := flags.String("dir", "", "output directory holding the runs (default: the configured one)")
+	runID := flags.String("run", "", "run ID to read the quarantine of (default: the latest run)")
+	asJSON := flags.Bool("json", false, "print the quarantined values as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected a dataset name")
+	}
+	if *dir == "" {
+		*dir = crab.CurrentConfig().Output.Dir
+	}
+	if *dir == "" {
+		return fmt.Errorf("no output directory given")
+	}
+
+	report, err := crab.LoadQuarantine(*dir, flags.Arg(0), *runID)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	if len(report.Anomalies) == 0 {
+		fmt.Printf("Run %s quarantined no %s values\n", report.RunID, report.Dataset)
+		return nil
+	}
+	fmt.Printf("Run %s quarantined %d %s values:\n", report.RunID, len(report.Anomalies), report.Dataset)
+	for _, anomaly := range report.Anomalies {
+		fmt.Printf("  row %d %s %s = %s: %s\n", anomaly.Row, anomaly.Period, anomaly.Column, anomaly.Value, anomaly.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runReport renders a report template on a finished run, as the configured reports are rendered at the
+// end of each run, to try a template out or report on an older run.
+func runReport(args []string) error {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	dir := flags.String("dir", "", "output directory holding the runs (default: the configured one)")
+	runID := flags.String("run", "", "run ID to report on (default: the latest run)")
+	format := flags.String("format", "", "report format, markdown or html (default: from the template's extension)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected a template file")
+	}
+	if *dir == "" {
+		*dir = crab.CurrentConfig().Output.Dir
+	}
+	if *dir == "" {
+		return fmt.Errorf("no output directory given")
+	}
+	if *runID == "" {
+		runs, err := crab.ListRuns(*dir)
+		if err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			return fmt.Errorf("no runs in %s", *dir)
+		}
+		*runID = runs[len(runs)-1]
+	}
+
+	report, err := crab.BuildRunReport(*dir, *runID, nil, nil)
+	if err != nil {
+		return err
+	}
+	return crab.ReportTemplate{File: flags.Arg(0), Format: *format}.Render(os.Stdout, report)
+}
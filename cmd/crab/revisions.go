@@ -0,0 +1,70 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// runRevisions lists the rows of a scraped dataset whose values the source revised between runs, with
+// their values before and after, over every run or for one.
+func runRevisions(args []string) error {
+	flags := flag.NewFlagSet("revisions", flag.ContinueOnError)
+	dir := flags.String("dir", "", "output directory holding the runs (default: the configured one)")
+	runID := flags.String("run", "", "run ID to list the revisions found by (default: every run)")
+	asJSON := flags.Bool("json", false, "print the revisions as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected a dataset name")
+	}
+	if *dir == "" {
+		*dir = crab.CurrentConfig().Output.Dir
+	}
+	if *dir == "" {
+		return fmt.Errorf("no output directory given")
+	}
+
+	var revisions []crab.Revision
+	if *runID != "" {
+		report, err := crab.LoadRevisions(*dir, flags.Arg(0), *runID)
+		if err != nil {
+			return err
+		}
+		revisions = report.Revisions
+	} else {
+		var err error
+		if revisions, err = crab.RevisionHistory(*dir, flags.Arg(0)); err != nil {
+			return err
+		}
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(revisions)
+	}
+	if len(revisions) == 0 {
+		fmt.Printf("No revisions of %s\n", flags.Arg(0))
+		return nil
+	}
+	for _, revision := range revisions {
+		keys := make([]string, 0, len(revision.Key))
+		for column := range revision.Key {
+			keys = append(keys, column)
+		}
+		sort.Strings(keys)
+		fmt.Printf("Run %s revised %s", revision.RunID, flags.Arg(0))
+		for _, column := range keys {
+			fmt.Printf(" %s=%s", column, revision.Key[column])
+		}
+		fmt.Printf(" since run %s:\n", revision.PreviousRun)
+		for _, change := range revision.Changes {
+			fmt.Printf("  %s: %s -> %s\n", change.Column, change.Previous, change.Current)
+		}
+	}
+	return nil
+}
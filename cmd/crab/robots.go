@@ -0,0 +1,55 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runRobots prints what a site's robots.txt says about a URL, to find out why the crawler skipped it.
+func runRobots(args []string) error {
+	flags := flag.NewFlagSet("robots", flag.ContinueOnError)
+	agent := flags.String("agent", "", "user agent to check (default: the configured crawler agent)")
+	asJSON := flags.Bool("json", false, "print the result as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one URL, got %d", flags.NArg())
+	}
+
+	check, err := crab.CheckRobots(flags.Arg(0), *agent)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(check)
+	}
+	verdict := "allowed"
+	if !check.Allowed {
+		verdict = "disallowed"
+	}
+	fmt.Printf("%s is %s for %s\n", check.URL, verdict, check.Agent)
+	fmt.Printf("  robots.txt:  %s (status %d)\n", check.RobotsURL, check.Status)
+	if check.FetchedURL != "" {
+		fmt.Printf("  served from: %s\n", check.FetchedURL)
+	}
+	if check.Group != "" {
+		fmt.Printf("  group:       User-agent: %s\n", check.Group)
+	}
+	if check.Rule != "" {
+		fmt.Printf("  rule:        %s\n", check.Rule)
+	}
+	fmt.Printf("  reason:      %s\n", check.Reason)
+	if check.CrawlDelay > 0 {
+		fmt.Printf("  crawl-delay: %v\n", check.CrawlDelay)
+	}
+	for _, sitemap := range check.Sitemaps {
+		fmt.Printf("  sitemap:     %s\n", sitemap)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// runSchema infers the column types of a dataset ("infer <dataset>") and writes a Go struct and a JSON
+// Schema for its records, to start a new typed dataset from what a scraper returns.
+func runSchema(args []string) error {
+	if len(args) == 0 || args[0] != "infer" {
+		return fmt.Errorf("expected infer <dataset>")
+	}
+	flags := flag.NewFlagSet("schema infer", flag.ContinueOnError)
+	dir := flags.String("dir", "", "output directory holding the runs (default: the configured one)")
+	runID := flags.String("run", "", "run ID to read the dataset as of (default: the latest run)")
+	file := flags.String("file", "", "read the rows from this CSV, TSV, XLSX, JSON or NDJSON file instead of a run")
+	typeName := flags.String("type", "", "name of the Go type (default: the dataset name in CamelCase with Data)")
+	goFile := flags.String("go", "", "write the Go struct to this file instead of printing it")
+	schemaFile := flags.String("schema", "", "write the JSON Schema to this file instead of printing it")
+	asJSON := flags.Bool("json", false, "print the inferred column types as JSON instead")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected a dataset name")
+	}
+	name := flags.Arg(0)
+
+	var ds crab.Dataset
+	var err error
+	if *file != "" {
+		ds, err = crab.ReadDatasetFile(name, *file, crab.ImportOptions{})
+	} else {
+		if *dir == "" {
+			*dir = crab.CurrentConfig().Output.Dir
+		}
+		if *dir == "" {
+			return fmt.Errorf("no output directory given")
+		}
+		ds, err = crab.LoadOutputDataset(*dir, name, *runID)
+	}
+	if err != nil {
+		return err
+	}
+	if len(ds.Rows) == 0 {
+		return fmt.Errorf("the %s dataset has no rows to infer types from", name)
+	}
+	schema := crab.InferSchema(ds)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(schema)
+	}
+
+	if *typeName == "" {
+		*typeName = crab.GoTypeName(name)
+	}
+	source, err := schema.GoStruct(*typeName)
+	if err != nil {
+		return err
+	}
+	jsonSchema, err := json.MarshalIndent(schema.JSONSchema(), "", "  ")
+	if err != nil {
+		return err
+	}
+	jsonSchema = append(jsonSchema, '\n')
+	if *goFile != "" {
+		if err := os.WriteFile(*goFile, source, 0644); err != nil {
+			return err
+		}
+	}
+	if *schemaFile != "" {
+		if err := os.WriteFile(*schemaFile, jsonSchema, 0644); err != nil {
+			return err
+		}
+	}
+	switch {
+	case *goFile == "" && *schemaFile == "":
+		fmt.Printf("%s\n%s", source, jsonSchema)
+	case *goFile == "":
+		fmt.Print(string(source))
+	case *schemaFile == "":
+		fmt.Print(string(jsonSchema))
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// runScrape lists the scrapers of the registry, or runs the named ones or every enabled one.
+func runScrape(args []string) error {
+	flags := flag.NewFlagSet("scrape", flag.ContinueOnError)
+	configFile := flags.String("config", "", "crab config file, for its scrapers list and JSON, GraphQL and table targets")
+	dir := flags.String("dir", "", "output directory (default: the configured one)")
+	list := flags.Bool("list", false, "list the scrapers with their source, schedule and output")
+	asJSON := flags.Bool("json", false, "with -list, print the scrapers and their schemas as JSON")
+	all := flags.Bool("all", false, "run every enabled scraper")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	config := crab.CurrentConfig()
+	if *configFile != "" {
+		loaded, err := crab.LoadConfig(*configFile)
+		if err != nil {
+			return err
+		}
+		config = loaded
+	}
+	if *dir != "" {
+		config.Output.Dir = *dir
+	}
+	crab.SetConfig(config)
+
+	if *list {
+		return printScrapers(crab.Scrapers(), *asJSON)
+	}
+	names := flags.Args()
+	if *all {
+		names = nil
+		for _, info := range crab.Scrapers() {
+			if info.Enabled {
+				names = append(names, info.Name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("expected scraper names, -all or -list")
+	}
+	var failed []string
+	for _, name := range names {
+		if err := crab.RunScraper(name); err != nil {
+			fmt.Fprintf(os.Stderr, "crab scrape: %s: %v\n", name, err)
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d scrapers failed: %s", len(failed), len(names), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// printScrapers prints the scrapers as a table, or as JSON.
+func printScrapers(scrapers []crab.ScraperInfo, asJSON bool) error {
+	if asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(scrapers)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKIND\tENABLED\tSCHEDULE\tOUTPUT\tSOURCE")
+	for _, info := range scrapers {
+		enabled := "yes"
+		if !info.Enabled {
+			enabled = "no"
+		}
+		schedule := info.Schedule
+		if schedule == "" {
+			schedule = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", info.Name, info.Kind, enabled, schedule, info.Output, info.SourceURL)
+	}
+	return w.Flush()
+}
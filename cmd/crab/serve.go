@@ -0,0 +1,49 @@
+package main
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// runServe runs crab as a service, as in a container: the config comes from the environment and the file
+// $CRAB_CONFIG names, crawl and scrape jobs are taken over HTTP, and SIGTERM shuts it down gracefully.
+func runServe(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("addr", "", "address to listen on (default $CRAB_DAEMON_ADDR or :8080)")
+	dataDir := flags.String("data-dir", os.Getenv("CRAB_DATA_DIR"), "where outputs go when no output directory is configured")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+
+	config, err := crab.LoadConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	config = crab.PrepareDaemonConfig(config, *dataDir)
+	if *addr != "" {
+		config.Daemon.Addr = *addr
+	}
+	crab.SetConfig(config)
+	if !config.API.Enabled() {
+		log.Println("No API keys or JWT secret configured; the API is read-only and its operator and admin routes answer 403")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	if configFile := os.Getenv("CRAB_CONFIG"); configFile != "" {
+		// Changes to the reloadable settings of the mounted file apply to the running service
+		if err := crab.WatchConfig(ctx, configFile, nil); err != nil {
+			log.Printf("Error watching %s, config changes need a restart: %v", configFile, err)
+		}
+	}
+	return crab.NewDaemon(config.Daemon, crab.NewJobQueue(crab.NewMemoryJobStore())).Run(ctx)
+}
@@ -0,0 +1,230 @@
+package crab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A11yConfig turns on the accessibility scan of crawls: every crawled HTML page is run through axe-core
+// and the violations are written per page and per site to the run's a11y_report.json.
+//
+// crab has no headless browser of its own, so pages are rendered and scanned by Command, which is given
+// the page URL as its last argument and must print axe-core's results as JSON, either one result object
+// or an array of them. The default is the axe CLI (npm install -g @axe-core/cli), which drives headless
+// Chrome.
+type A11yConfig struct {
+	Enabled bool     `json:"enabled"`
+	Command []string `json:"command"` // defaultA11yCommand when empty
+	Timeout string   `json:"timeout"` // Of one page's scan; defaultA11yTimeout when empty
+	Workers int      `json:"workers"` // Pages scanned at once; defaultA11yWorkers when zero
+}
+
+var defaultA11yCommand = []string{"axe", "--stdout"}
+
+const (
+	defaultA11yTimeout = time.Minute
+	defaultA11yWorkers = 2
+)
+
+// axeResult is the part of an axe-core result the report uses.
+type axeResult struct {
+	URL        string `json:"url"`
+	Violations []struct {
+		ID      string            `json:"id"`
+		Impact  string            `json:"impact"`
+		Help    string            `json:"help"`
+		HelpURL string            `json:"helpUrl"`
+		Nodes   []json.RawMessage `json:"nodes"`
+	} `json:"violations"`
+}
+
+// A11yViolation is an axe-core rule a page breaks, and on how many of its elements.
+type A11yViolation struct {
+	Rule     string `json:"rule"`
+	Impact   string `json:"impact"` // "minor", "moderate", "serious" or "critical"
+	Help     string `json:"help"`
+	HelpURL  string `json:"help_url,omitempty"`
+	Elements int    `json:"elements"`
+}
+
+// A11yPageReport is the scan of one page. Error says why a page could not be scanned.
+type A11yPageReport struct {
+	URL        string          `json:"url"`
+	Violations []A11yViolation `json:"violations"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// A11ySiteReport sums up the scans of a site's pages: the violations by impact and by rule, counted once
+// per page.
+type A11ySiteReport struct {
+	Host       string         `json:"host"`
+	Pages      int            `json:"pages"`
+	Failed     int            `json:"failed"` // Pages that could not be scanned
+	Violations int            `json:"violations"`
+	ByImpact   map[string]int `json:"by_impact"`
+	ByRule     map[string]int `json:"by_rule"`
+}
+
+// A11yReport is the accessibility scan of a crawl, its sites and pages sorted by URL.
+type A11yReport struct {
+	RunID string           `json:"run_id,omitempty"`
+	Sites []A11ySiteReport `json:"sites"`
+	Pages []A11yPageReport `json:"pages"`
+}
+
+// a11yImpactOrder sorts violations worst first.
+var a11yImpactOrder = map[string]int{"critical": 0, "serious": 1, "moderate": 2, "minor": 3}
+
+// ParseAxeResults reads the violations of the pages in the output of axe-core: one result object or an
+// array of them.
+func ParseAxeResults(output []byte) ([]A11yPageReport, error) {
+	output = bytes.TrimSpace(output)
+	var results []axeResult
+	if bytes.HasPrefix(output, []byte("{")) {
+		var result axeResult
+		if err := json.Unmarshal(output, &result); err != nil {
+			return nil, fmt.Errorf("parsing the axe-core results: %w", err)
+		}
+		results = append(results, result)
+	} else if err := json.Unmarshal(output, &results); err != nil {
+		return nil, fmt.Errorf("parsing the axe-core results: %w", err)
+	}
+	pages := make([]A11yPageReport, 0, len(results))
+	for _, result := range results {
+		page := A11yPageReport{URL: result.URL, Violations: []A11yViolation{}}
+		for _, v := range result.Violations {
+			page.Violations = append(page.Violations, A11yViolation{Rule: v.ID, Impact: v.Impact, Help: v.Help,
+				HelpURL: v.HelpURL, Elements: len(v.Nodes)})
+		}
+		sort.SliceStable(page.Violations, func(i, j int) bool {
+			return a11yImpactOrder[page.Violations[i].Impact] < a11yImpactOrder[page.Violations[j].Impact]
+		})
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// ScanA11y runs the scan command of config on each of urls, a few at a time, and reports the violations
+// found. A page whose scan fails is reported with the error; ctx stops the scans not yet started.
+func ScanA11y(ctx context.Context, urls []string, config A11yConfig) A11yReport {
+	command := config.Command
+	if len(command) == 0 {
+		command = defaultA11yCommand
+	}
+	timeout := defaultA11yTimeout
+	if config.Timeout != "" {
+		if d, err := time.ParseDuration(config.Timeout); err == nil {
+			timeout = d
+		}
+	}
+	workers := config.Workers
+	if workers <= 0 {
+		workers = defaultA11yWorkers
+	}
+
+	pages := make([]A11yPageReport, len(urls))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				pages[i] = scanA11yPage(ctx, command, urls[i], timeout)
+			}
+		}()
+	}
+	for i := range urls {
+		if ctx.Err() != nil {
+			pages[i] = A11yPageReport{URL: urls[i], Violations: []A11yViolation{}, Error: "not scanned: " + ctx.Err().Error()}
+			continue
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return BuildA11yReport(pages)
+}
+
+// scanA11yPage runs the scan command on one page.
+func scanA11yPage(ctx context.Context, command []string, pageURL string, timeout time.Duration) A11yPageReport {
+	failed := func(format string, args ...interface{}) A11yPageReport {
+		return A11yPageReport{URL: pageURL, Violations: []A11yViolation{}, Error: fmt.Sprintf(format, args...)}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], append(command[1:len(command):len(command)], pageURL)...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return failed("%s: %v %s", command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	pages, err := ParseAxeResults(stdout.Bytes())
+	if err != nil {
+		return failed("%v", err)
+	}
+	if len(pages) == 0 {
+		return failed("%s printed no results", command[0])
+	}
+	page := pages[0]
+	page.URL = pageURL // The scanned URL, whatever the page redirected to
+	return page
+}
+
+// BuildA11yReport sorts the scans of pages and sums them up by site.
+func BuildA11yReport(pages []A11yPageReport) A11yReport {
+	report := A11yReport{Sites: []A11ySiteReport{}, Pages: append([]A11yPageReport{}, pages...)}
+	sort.Slice(report.Pages, func(i, j int) bool { return report.Pages[i].URL < report.Pages[j].URL })
+	sites := map[string]*A11ySiteReport{}
+	var hosts []string
+	for _, page := range report.Pages {
+		host := page.URL
+		if u, err := url.Parse(page.URL); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		site := sites[host]
+		if site == nil {
+			site = &A11ySiteReport{Host: host, ByImpact: map[string]int{}, ByRule: map[string]int{}}
+			sites[host] = site
+			hosts = append(hosts, host)
+		}
+		site.Pages++
+		if page.Error != "" {
+			site.Failed++
+		}
+		for _, v := range page.Violations {
+			site.Violations++
+			site.ByImpact[v.Impact]++
+			site.ByRule[v.Rule]++
+		}
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		report.Sites = append(report.Sites, *sites[host])
+	}
+	return report
+}
+
+// writeA11yReport scans the HTML pages of a crawl run under config and writes the report to its
+// a11y_report.json.
+func writeA11yReport(ctx context.Context, config A11yConfig, run *Run, urls []string) error {
+	report := ScanA11y(ctx, urls, config)
+	report.RunID = run.RunID()
+	for _, site := range report.Sites {
+		log.Printf("Accessibility of %s: %d violation(s) over %d page(s), %d not scanned", site.Host, site.Violations, site.Pages, site.Failed)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(run.Path("a11y_report.json"), data)
+}
@@ -0,0 +1,334 @@
+package crab
+
+import (
+	"bufio"
+	"cmpscfa23team2/records"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Kinds of alert rules.
+const (
+	AlertErrorRate = "error_rate" // More than Threshold percent of the requests of a run failed
+	AlertRowDrop   = "row_drop"   // A dataset has more than Threshold percent fewer rows than in its previous run
+	AlertUnhealthy = "unhealthy"  // Threshold runs of a job in a row did not complete
+	AlertQuality   = "quality"    // More than Threshold expectations of a dataset failed
+)
+
+// AlertRule is a condition checked after each run. Jobs limits it to the runs of the named jobs (the
+// crawled domain or scraper) and datasets; an empty list checks every run. Alerts go to the webhooks
+// subscribed to the "alert" event and, with Email, to the report recipients of the job.
+type AlertRule struct {
+	Name      string   `json:"name"` // Defaults to the kind
+	Kind      string   `json:"kind"`
+	Threshold float64  `json:"threshold"`
+	Jobs      []string `json:"jobs"`
+	Email     bool     `json:"email"`
+}
+
+// name returns the name of the rule, its kind when it has none.
+func (r AlertRule) name() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Kind
+}
+
+// appliesTo reports whether the rule checks the runs of one of names.
+func (r AlertRule) appliesTo(names ...string) bool {
+	if len(r.Jobs) == 0 {
+		return true
+	}
+	for _, job := range r.Jobs {
+		for _, name := range names {
+			if job == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Alert is a rule that fired after a run.
+type Alert = records.Alert
+
+// errorRate returns the percentage of the requests of the run that failed. A crawl counts its failed pages
+// among its pages, a scrape does not.
+func (s RunSummary) errorRate() float64 {
+	requests := s.Pages + s.Errors
+	if s.Kind == "crawl" {
+		requests = s.Pages
+	}
+	if requests == 0 {
+		return 0
+	}
+	return 100 * float64(s.Errors) / float64(requests)
+}
+
+// EvaluateAlerts checks the configured alert rules against a finished run, whose metrics are already in the
+// metrics store, and returns the alerts that fire. The data quality rules are checked with the expectations
+// instead.
+func EvaluateAlerts(summary RunSummary) []Alert {
+	return evaluateAlerts(CurrentConfig().Alerts, summary)
+}
+
+// evaluateAlerts is EvaluateAlerts with the given rules.
+func evaluateAlerts(rules []AlertRule, summary RunSummary) []Alert {
+	var alerts []Alert
+	now := time.Now().UTC()
+	for _, rule := range rules {
+		fire := func(label string, value float64, message string) {
+			alerts = append(alerts, Alert{Rule: rule.name(), Kind: rule.Kind, RunID: summary.RunID, Job: summary.Name,
+				Label: label, Value: value, Threshold: rule.Threshold, Message: message, FiredAt: now})
+		}
+		switch rule.Kind {
+		case AlertErrorRate:
+			if rate := summary.errorRate(); rule.appliesTo(summary.Name) && rate > rule.Threshold {
+				fire("", rate, fmt.Sprintf("%.1f%% of the requests of %s %s failed, over %g%%", rate, summary.Kind, summary.Name, rule.Threshold))
+			}
+		case AlertRowDrop:
+			for _, dataset := range summary.Datasets {
+				if !rule.appliesTo(summary.Name, dataset.Dataset) {
+					continue
+				}
+				previous, ok := previousMetric(summary, MetricDatasetRows, dataset.Dataset)
+				if !ok || previous.Value <= 0 {
+					continue
+				}
+				if drop := 100 * (previous.Value - float64(dataset.Rows)) / previous.Value; drop > rule.Threshold {
+					fire(dataset.Dataset, drop, fmt.Sprintf("dataset %s dropped from %d to %d rows (%.1f%%) since run %s, over %g%%",
+						dataset.Dataset, int(previous.Value), dataset.Rows, drop, previous.RunID, rule.Threshold))
+				}
+			}
+		case AlertUnhealthy:
+			if streak := unhealthyStreak(summary); rule.appliesTo(summary.Name) && rule.Threshold > 0 && streak == int(rule.Threshold) {
+				fire("", float64(streak), fmt.Sprintf("%s %s has not completed for %d runs, the last with %s", summary.Kind, summary.Name, streak, summary.Event))
+			}
+		}
+	}
+	return alerts
+}
+
+// previousMetric returns the metric of the run before summary's of the same kind and name.
+func previousMetric(summary RunSummary, metric, label string) (RunMetric, bool) {
+	metrics, err := LoadRunMetrics(MetricQuery{Kind: summary.Kind, Name: summary.Name, Metric: metric, Label: label, To: summary.StartedAt})
+	if err != nil {
+		log.Printf("Error loading the %s of earlier runs: %v", metric, err)
+		return RunMetric{}, false
+	}
+	for i := len(metrics) - 1; i >= 0; i-- {
+		if metrics[i].RunID != summary.RunID {
+			return metrics[i], true
+		}
+	}
+	return RunMetric{}, false
+}
+
+// unhealthyStreak returns how many runs of summary's job in a row, up to and including it, did not
+// complete. A streak is only counted up as it grows, so a rule fires once per streak.
+func unhealthyStreak(summary RunSummary) int {
+	if summary.Event == EventCompleted {
+		return 0
+	}
+	metrics, err := LoadRunMetrics(MetricQuery{Kind: summary.Kind, Name: summary.Name, Metric: MetricHealthy, To: summary.StartedAt})
+	if err != nil {
+		log.Printf("Error loading the health of earlier runs: %v", err)
+		return 0
+	}
+	streak := 1
+	for i := len(metrics) - 1; i >= 0 && metrics[i].Value == 0; i-- {
+		if metrics[i].RunID != summary.RunID {
+			streak++
+		}
+	}
+	return streak
+}
+
+// qualityAlerts checks the data quality rules against the expectation results of a dataset.
+func qualityAlerts(dataset, runID string, results []ExpectationResult) []Alert {
+	failed := 0
+	for _, result := range results {
+		if !result.Success {
+			failed++
+		}
+	}
+	var alerts []Alert
+	for _, rule := range CurrentConfig().Alerts {
+		if rule.Kind == AlertQuality && rule.appliesTo(dataset) && float64(failed) > rule.Threshold {
+			alerts = append(alerts, Alert{Rule: rule.name(), Kind: rule.Kind, RunID: runID, Job: dataset, Label: dataset,
+				Value: float64(failed), Threshold: rule.Threshold, FiredAt: time.Now().UTC(),
+				Message: fmt.Sprintf("%d of %d expectations of dataset %s failed, over %g", failed, len(results), dataset, rule.Threshold)})
+		}
+	}
+	return alerts
+}
+
+// reportRun records the metrics of a finished run, notifies the webhooks of config of its outcome, emails
+// its report to the recipients of its job and raises the alerts of config it fires.
+func reportRun(config Config, summary RunSummary) {
+	saveRunMetrics(summary)
+	notifyWebhooks(config.Webhooks, summary)
+	emailRunReport(config, summary)
+	raiseAlerts(config, summary, evaluateAlerts(config.Alerts, summary))
+}
+
+// raiseAlerts records alerts in the alert history and sends them to the webhooks of config subscribed to
+// the alert event and, for the rules that ask for it, by email.
+func raiseAlerts(config Config, summary RunSummary, alerts []Alert) {
+	if len(alerts) == 0 {
+		return
+	}
+	for _, alert := range alerts {
+		log.Printf("Alert %s: %s", alert.Rule, alert.Message)
+	}
+	if store := currentAlertStore(); store != nil {
+		if err := store.SaveAlerts(alerts); err != nil {
+			log.Printf("Error saving the alerts of run %s: %v", summary.RunID, err)
+		}
+	}
+	summary.Event = EventAlert
+	summary.Alerts = alerts
+	notifyWebhooks(config.Webhooks, summary)
+	for _, alert := range alerts {
+		if emailsAlert(config.Alerts, alert) {
+			emailRunReport(config, summary)
+			break
+		}
+	}
+}
+
+// emailsAlert reports whether the rule of rules that fired alert asks for the run report by email.
+func emailsAlert(rules []AlertRule, alert Alert) bool {
+	for _, rule := range rules {
+		if rule.name() == alert.Rule && rule.Kind == alert.Kind && rule.Email {
+			return true
+		}
+	}
+	return false
+}
+
+// AlertStore keeps the history of fired alerts; the dal package keeps it in the alert_history table.
+type AlertStore interface {
+	SaveAlerts(alerts []Alert) error
+	// LoadAlerts returns the alerts of job (every job when empty) fired since the given time (ever when
+	// zero), oldest first.
+	LoadAlerts(job string, since time.Time) ([]Alert, error)
+}
+
+var (
+	alertMu    sync.RWMutex
+	alertStore AlertStore
+)
+
+// SetAlertStore sets where fired alerts are recorded. Passing nil appends them to alerts.jsonl in the
+// output directory instead.
+func SetAlertStore(store AlertStore) {
+	alertMu.Lock()
+	defer alertMu.Unlock()
+	alertStore = store
+}
+
+// currentAlertStore returns the store set, else the file in the output directory, else nil.
+func currentAlertStore() AlertStore {
+	alertMu.RLock()
+	defer alertMu.RUnlock()
+	if alertStore != nil {
+		return alertStore
+	}
+	if dir := CurrentConfig().Output.Dir; dir != "" {
+		return FileAlertStore{Path: filepath.Join(dir, "alerts.jsonl")}
+	}
+	return nil
+}
+
+// LoadAlerts returns the alerts of job (every job when empty) fired since the given time (ever when zero),
+// oldest first, from the alert store.
+func LoadAlerts(job string, since time.Time) ([]Alert, error) {
+	store := currentAlertStore()
+	if store == nil {
+		return []Alert{}, nil
+	}
+	return store.LoadAlerts(job, since)
+}
+
+// fileAlertsMu serializes the appends of the runs of a process to alert files.
+var fileAlertsMu sync.Mutex
+
+// FileAlertStore keeps fired alerts as JSON lines appended to a file.
+type FileAlertStore struct {
+	Path string
+}
+
+// SaveAlerts appends the alerts to the file, creating it when needed.
+func (s FileAlertStore) SaveAlerts(alerts []Alert) error {
+	fileAlertsMu.Lock()
+	defer fileAlertsMu.Unlock()
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	for _, alert := range alerts {
+		if err := encoder.Encode(alert); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// LoadAlerts reads the alerts of job fired since the given time, oldest first. A missing file has none.
+func (s FileAlertStore) LoadAlerts(job string, since time.Time) ([]Alert, error) {
+	fileAlertsMu.Lock()
+	defer fileAlertsMu.Unlock()
+	alerts := []Alert{}
+	f, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return alerts, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var alert Alert
+		if err := json.Unmarshal(scanner.Bytes(), &alert); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", s.Path, line, err)
+		}
+		if (job == "" || alert.Job == job) && (since.IsZero() || !alert.FiredAt.Before(since)) {
+			alerts = append(alerts, alert)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(alerts, func(i, j int) bool { return alerts[i].FiredAt.Before(alerts[j].FiredAt) })
+	return alerts, nil
+}
+
+// AlertsHandler serves the alert history (GET ?job=&since=), oldest first.
+func AlertsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	since, err := ParseLatencyTime("since", r.URL.Query().Get("since"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	alerts, err := LoadAlerts(r.URL.Query().Get("job"), since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, alerts)
+}
@@ -0,0 +1,207 @@
+package crab
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// annotationsSuffix names the file of the annotations stripped from a run's dataset, next to its data file.
+const annotationsSuffix = ".annotations.json"
+
+// AnnotationRule strips the annotations scraped cells carry after their value, such as the footnote
+// markers of "4.1[1]", "3.2*" or "5.0¹" and the preliminary or revised flags of "4.1 (p)", from the
+// columns of a dataset. The stripped markers are kept in an annotations file beside the data, as metadata
+// columns of their own (see WithAnnotationColumns), and the values are left clean for the number formats.
+type AnnotationRule struct {
+	Columns  []string `json:"columns"`  // The columns to strip; every column when empty
+	Patterns []string `json:"patterns"` // More annotations as regexps, matched at the end of a cell
+}
+
+// annotationPatterns are the annotations stripped under every rule: flags in parentheses, footnote
+// references in brackets, superscript digits and footnote symbols.
+var annotationPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\s*\(\s*(p|r|e|f|c|est|prelim|preliminary|revised|provisional|projected|forecast)\s*\)$`),
+	regexp.MustCompile(`\s*\[\s*[\p{L}\p{N}*†‡]{1,4}\s*\]$`),
+	regexp.MustCompile(`\s*[¹²³⁴⁵⁶⁷⁸⁹⁰]+$`),
+	regexp.MustCompile(`\s*[*†‡§¶]+$`),
+}
+
+// Annotation is the markers stripped from one cell of a dataset.
+type Annotation struct {
+	Row     int      `json:"row"`    // Position of the row in the dataset, from 0
+	Period  string   `json:"period"` // The row's value of the first column, e.g. its year
+	Column  string   `json:"column"`
+	Value   string   `json:"value"` // As scraped
+	Clean   string   `json:"clean"` // As written to the dataset
+	Markers []string `json:"markers"`
+}
+
+// AnnotationReport lists the annotations stripped from a dataset by a run.
+type AnnotationReport struct {
+	Dataset     string       `json:"dataset"`
+	RunID       string       `json:"run_id,omitempty"`
+	Annotations []Annotation `json:"annotations"`
+}
+
+// compile returns the patterns of the rule after the built-in ones.
+func (r AnnotationRule) compile() ([]*regexp.Regexp, error) {
+	patterns := append([]*regexp.Regexp(nil), annotationPatterns...)
+	for _, pattern := range r.Patterns {
+		re, err := regexp.Compile(`\s*(?:` + pattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("annotation pattern %q: %w", pattern, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// StripAnnotations removes the annotations patterns match at the end of value, as many as it carries, and
+// returns the value with its spaces normalized and the markers in the order they were written.
+func StripAnnotations(value string, patterns []*regexp.Regexp) (string, []string) {
+	clean := strings.Join(strings.Fields(strings.NewReplacer("\u00a0", " ", "\u202f", " ").Replace(value)), " ")
+	var markers []string
+	for stripped := true; stripped; {
+		stripped = false
+		for _, re := range patterns {
+			if loc := re.FindStringIndex(clean); loc != nil && loc[1] > loc[0] {
+				markers = append([]string{strings.TrimSpace(clean[loc[0]:loc[1]])}, markers...)
+				clean, stripped = strings.TrimSpace(clean[:loc[0]]), true
+			}
+		}
+	}
+	return clean, markers
+}
+
+// AnnotateDataset strips the annotations of the columns of rule from ds. It returns the clean dataset and
+// the annotations stripped, in the order of the cells.
+func AnnotateDataset(ds Dataset, rule AnnotationRule) (Dataset, []Annotation, error) {
+	patterns, err := rule.compile()
+	if err != nil {
+		return ds, nil, err
+	}
+	columns := map[string]bool{}
+	for _, column := range rule.Columns {
+		columns[column] = true
+	}
+	clean := ds
+	clean.Rows = make([][]string, len(ds.Rows))
+	annotations := []Annotation{}
+	for i, row := range ds.Rows {
+		clean.Rows[i] = append([]string(nil), row...)
+		var stripped []Annotation
+		for j, column := range ds.Columns {
+			if len(columns) > 0 && !columns[column] {
+				continue
+			}
+			value, markers := StripAnnotations(row[j], patterns)
+			clean.Rows[i][j] = value
+			if len(markers) > 0 {
+				stripped = append(stripped, Annotation{Row: i, Column: column, Value: row[j], Clean: value, Markers: markers})
+			}
+		}
+		for _, annotation := range stripped {
+			annotation.Period = clean.Rows[i][0]
+			annotations = append(annotations, annotation)
+		}
+	}
+	return clean, annotations, nil
+}
+
+// annotationColumn names the metadata column of the annotations of column.
+func annotationColumn(column string) string {
+	return column + "_annotation"
+}
+
+// WithAnnotationColumns returns ds with a metadata column after each column that had annotations stripped,
+// named "<column>_annotation", holding the markers of its cells separated by spaces.
+func WithAnnotationColumns(ds Dataset, annotations []Annotation) Dataset {
+	markers := map[string]map[int]string{}
+	for _, annotation := range annotations {
+		if markers[annotation.Column] == nil {
+			markers[annotation.Column] = map[int]string{}
+		}
+		markers[annotation.Column][annotation.Row] = strings.Join(annotation.Markers, " ")
+	}
+	if len(markers) == 0 {
+		return ds
+	}
+	annotated := ds
+	annotated.Columns = nil
+	for _, column := range ds.Columns {
+		annotated.Columns = append(annotated.Columns, column)
+		if markers[column] != nil {
+			annotated.Columns = append(annotated.Columns, annotationColumn(column))
+		}
+	}
+	annotated.Rows = make([][]string, len(ds.Rows))
+	for i, row := range ds.Rows {
+		for j, column := range ds.Columns {
+			annotated.Rows[i] = append(annotated.Rows[i], row[j])
+			if byRow := markers[column]; byRow != nil {
+				annotated.Rows[i] = append(annotated.Rows[i], byRow[i])
+			}
+		}
+	}
+	return annotated
+}
+
+// annotationsFilename returns the name of the annotations file of a data file.
+func annotationsFilename(dataFile string) string {
+	return strings.TrimSuffix(lineageFilename(dataFile), lineageSuffix) + annotationsSuffix
+}
+
+// annotateScrapedRecords strips the annotations of records about to be written to a run under the
+// configured annotation rule of the dataset. The clean records are returned with the name of the
+// annotations file written next to the run's data file, when any were stripped.
+func annotateScrapedRecords(dataset, name string, records interface{}, run *Run) (interface{}, string, error) {
+	rule, ok := CurrentConfig().Annotations[dataset]
+	if !ok {
+		return records, "", nil
+	}
+	ds, err := NewDataset(dataset, records)
+	if err != nil {
+		return records, "", err
+	}
+	clean, annotations, err := AnnotateDataset(ds, rule)
+	if err != nil {
+		return records, "", err
+	}
+	cleaned, err := datasetRecords(clean, records)
+	if err != nil {
+		return records, "", err
+	}
+	if len(annotations) == 0 {
+		return cleaned, "", nil
+	}
+	log.Printf("Stripped %d annotations from %s", len(annotations), dataset)
+	filename := annotationsFilename(run.Path(OutputFilename(name)))
+	data, err := json.MarshalIndent(AnnotationReport{Dataset: dataset, RunID: run.RunID(), Annotations: annotations}, "", "  ")
+	if err != nil {
+		return records, "", err
+	}
+	if err := WriteFileAtomic(filename, data); err != nil {
+		return records, "", err
+	}
+	return cleaned, filename, nil
+}
+
+// LoadAnnotations returns the annotations stripped from the named dataset by run runID (the latest run
+// that produced the dataset when empty), resolved like LoadDatasetAsOf. A run that stripped none returns
+// an empty report.
+func LoadAnnotations(dir, name, runID string) (AnnotationReport, error) {
+	runID, dataFile, err := findDatasetRun(dir, name, runID)
+	if err != nil {
+		return AnnotationReport{}, err
+	}
+	report := AnnotationReport{Dataset: name, RunID: runID, Annotations: []Annotation{}}
+	if filename := annotationsFilename(dataFile); outputFileExists(filename) {
+		if err := readJSONFile(filename, &report); err != nil {
+			return AnnotationReport{}, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,266 @@
+package crab
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+)
+
+// quarantineSuffix replaces the extension of a dataset file to name the file holding its quarantined
+// values.
+const quarantineSuffix = ".quarantine.json"
+
+// AnomalyRule flags the values of a numeric series that look like extraction errors. Each of Columns is
+// a series running down the rows ordered by OrderBy, or with Across set the columns are consecutive
+// periods of one row, e.g. "jan" to "dec", and the rows continue one series. A value is anomalous when it
+// moved more than MaxChange (0.5 for 50%) from the previous value, unless it returns near the level before
+// a flagged value, or lies more than MaxZScore robust standard deviations from the series median. A limit
+// of 0 is not checked.
+type AnomalyRule struct {
+	Columns   []string `json:"columns"`
+	OrderBy   string   `json:"order_by"` // Column ordering the rows in time, e.g. "year"; the scraped order when empty
+	Across    bool     `json:"across"`
+	MaxChange float64  `json:"max_change"`
+	MaxZScore float64  `json:"max_z_score"`
+}
+
+// Anomaly is one value flagged by an AnomalyRule.
+type Anomaly struct {
+	Row      int     `json:"row"`    // Position of the row in the dataset, from 0
+	Period   string  `json:"period"` // The row's OrderBy value, if any
+	Column   string  `json:"column"`
+	Value    string  `json:"value"`
+	Previous string  `json:"previous"` // The value it was compared with, if any
+	Change   float64 `json:"change"`   // Relative change from Previous
+	ZScore   float64 `json:"z_score"`
+	Reason   string  `json:"reason"`
+}
+
+// QuarantineReport lists the values held back from a dataset for review.
+type QuarantineReport struct {
+	Dataset   string    `json:"dataset"`
+	RunID     string    `json:"run_id,omitempty"`
+	Anomalies []Anomaly `json:"anomalies"`
+}
+
+// seriesPoint is one numeric value of a series and the cell it came from.
+type seriesPoint struct {
+	row, column int
+	value       float64
+}
+
+// DetectAnomalies returns the values of ds that rule flags, in series order. Cells that are empty or not
+// numbers are skipped.
+func DetectAnomalies(ds Dataset, rule AnomalyRule) ([]Anomaly, error) {
+	columnIndex := func(name string) (int, error) {
+		for i, column := range ds.Columns {
+			if strings.EqualFold(column, name) {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("column %q is not in %s", name, ds.Name)
+	}
+	columns := make([]int, len(rule.Columns))
+	for i, name := range rule.Columns {
+		index, err := columnIndex(name)
+		if err != nil {
+			return nil, err
+		}
+		columns[i] = index
+	}
+
+	rows := make([]int, len(ds.Rows))
+	for i := range rows {
+		rows[i] = i
+	}
+	orderBy := -1
+	if rule.OrderBy != "" {
+		index, err := columnIndex(rule.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		orderBy = index
+		sort.SliceStable(rows, func(i, j int) bool {
+			a, b := ds.Rows[rows[i]][orderBy], ds.Rows[rows[j]][orderBy]
+			x, errX := parseChartNumber(a)
+			y, errY := parseChartNumber(b)
+			if errX == nil && errY == nil {
+				return x < y
+			}
+			return a < b
+		})
+	}
+
+	addPoint := func(points []seriesPoint, row, column int) []seriesPoint {
+		if value, err := parseChartNumber(ds.Rows[row][column]); err == nil {
+			points = append(points, seriesPoint{row, column, value})
+		}
+		return points
+	}
+	var series [][]seriesPoint
+	if rule.Across {
+		var points []seriesPoint
+		for _, row := range rows {
+			for _, column := range columns {
+				points = addPoint(points, row, column)
+			}
+		}
+		series = append(series, points)
+	} else {
+		for _, column := range columns {
+			var points []seriesPoint
+			for _, row := range rows {
+				points = addPoint(points, row, column)
+			}
+			series = append(series, points)
+		}
+	}
+
+	var anomalies []Anomaly
+	for _, points := range series {
+		median, spread := robustSpread(points)
+		var previous, kept *seriesPoint // The point before, and the last one not flagged
+		for i := range points {
+			point := points[i]
+			anomaly := Anomaly{Row: point.row, Column: ds.Columns[point.column], Value: ds.Rows[point.row][point.column]}
+			if orderBy >= 0 {
+				anomaly.Period = ds.Rows[point.row][orderBy]
+			}
+			var reasons []string
+			if previous != nil {
+				anomaly.Previous = ds.Rows[previous.row][previous.column]
+				anomaly.Change = relativeChange(previous.value, point.value)
+				// A value back near the level before a flagged one ends the spike rather than starting another
+				jumped := kept == nil || previous == kept || math.Abs(relativeChange(kept.value, point.value)) > rule.MaxChange
+				if rule.MaxChange > 0 && math.Abs(anomaly.Change) > rule.MaxChange && jumped {
+					reasons = append(reasons, fmt.Sprintf("changed %+.0f%% from %s", anomaly.Change*100, anomaly.Previous))
+				}
+			}
+			if spread > 0 {
+				anomaly.ZScore = (point.value - median) / spread
+				if rule.MaxZScore > 0 && math.Abs(anomaly.ZScore) > rule.MaxZScore {
+					reasons = append(reasons, fmt.Sprintf("%.1f deviations from the median %g", anomaly.ZScore, median))
+				}
+			}
+			previous = &points[i]
+			if len(reasons) == 0 {
+				kept = &points[i]
+				continue
+			}
+			anomaly.Reason = strings.Join(reasons, "; ")
+			anomalies = append(anomalies, anomaly)
+		}
+	}
+	return anomalies, nil
+}
+
+// relativeChange returns the change from a to b relative to a, or 0 when a is 0.
+func relativeChange(a, b float64) float64 {
+	if a == 0 {
+		return 0
+	}
+	return (b - a) / math.Abs(a)
+}
+
+// robustSpread returns the median of the series and its median absolute deviation scaled to match the
+// standard deviation of normally distributed values. Unlike the mean and standard deviation, a few bad
+// values barely move either.
+func robustSpread(points []seriesPoint) (float64, float64) {
+	if len(points) == 0 {
+		return 0, 0
+	}
+	values := make([]float64, len(points))
+	for i, point := range points {
+		values[i] = point.value
+	}
+	median := medianOf(values)
+	for i := range values {
+		values[i] = math.Abs(values[i] - median)
+	}
+	return median, 1.4826 * medianOf(values)
+}
+
+// medianOf returns the median of values, sorting them in place.
+func medianOf(values []float64) float64 {
+	sort.Float64s(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// QuarantineAnomalies returns a copy of ds with the flagged values blanked, so they are not published
+// until reviewed.
+func QuarantineAnomalies(ds Dataset, anomalies []Anomaly) Dataset {
+	clean := ds
+	clean.Rows = make([][]string, len(ds.Rows))
+	for i, row := range ds.Rows {
+		clean.Rows[i] = append([]string(nil), row...)
+	}
+	for _, anomaly := range anomalies {
+		for j, column := range ds.Columns {
+			if column == anomaly.Column {
+				clean.Rows[anomaly.Row][j] = ""
+			}
+		}
+	}
+	return clean
+}
+
+// quarantineFilename returns the quarantine file of a dataset file, e.g. inflation_data.quarantine.json
+// for inflation_data.json.
+func quarantineFilename(dataFile string) string {
+	return strings.TrimSuffix(lineageFilename(dataFile), lineageSuffix) + quarantineSuffix
+}
+
+// quarantineScrapedRecords checks the records about to be written to a run against the configured
+// anomaly rule of the dataset. Flagged values are blanked in the records returned and listed in a
+// quarantine file next to the run's data file, whose name is returned.
+func quarantineScrapedRecords(dataset, name string, records interface{}, run *Run) (interface{}, string, error) {
+	rule, ok := CurrentConfig().Anomalies[dataset]
+	if !ok {
+		return records, "", nil
+	}
+	ds, err := NewDataset(dataset, records)
+	if err != nil {
+		return records, "", err
+	}
+	anomalies, err := DetectAnomalies(ds, rule)
+	if err != nil || len(anomalies) == 0 {
+		return records, "", err
+	}
+	for _, anomaly := range anomalies {
+		log.Printf("Quarantined %s %s %s = %s: %s", dataset, anomaly.Period, anomaly.Column, anomaly.Value, anomaly.Reason)
+	}
+	filename := quarantineFilename(run.Path(OutputFilename(name)))
+	data, err := json.MarshalIndent(QuarantineReport{Dataset: dataset, RunID: run.RunID(), Anomalies: anomalies}, "", "  ")
+	if err != nil {
+		return records, "", err
+	}
+	if err := WriteFileAtomic(filename, data); err != nil {
+		return records, "", err
+	}
+	clean, err := datasetRecords(QuarantineAnomalies(ds, anomalies), records)
+	return clean, filename, err
+}
+
+// LoadQuarantine returns the values held back from the named dataset by run runID (the latest run that
+// produced the dataset when empty), resolved like LoadDatasetAsOf. A run that quarantined nothing
+// returns an empty report.
+func LoadQuarantine(dir, name, runID string) (QuarantineReport, error) {
+	runID, dataFile, err := findDatasetRun(dir, name, runID)
+	if err != nil {
+		return QuarantineReport{}, err
+	}
+	report := QuarantineReport{Dataset: name, RunID: runID, Anomalies: []Anomaly{}}
+	if filename := quarantineFilename(dataFile); outputFileExists(filename) {
+		if err := readJSONFile(filename, &report); err != nil {
+			return QuarantineReport{}, err
+		}
+	}
+	return report, nil
+}
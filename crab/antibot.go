@@ -0,0 +1,204 @@
+package crab
+
+import (
+	"bytes"
+	"github.com/gocolly/colly"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// breakerCooldown is how long a domain stays blocked after its first challenge page.
+	breakerCooldown = 10 * time.Minute
+	// maxBreakerCooldown caps the cooldown after repeated challenges.
+	maxBreakerCooldown = 6 * time.Hour
+	// probeTimeout lets another probe through if the previous one never got a response.
+	probeTimeout = time.Minute
+	// smallPageSize is the body size below which CAPTCHA widgets are treated as a challenge; larger pages
+	// usually embed them in an ordinary form.
+	smallPageSize = 20000
+)
+
+// challengeMarkers identify interstitial pages served by bot protection services. They are checked on
+// every response.
+var challengeMarkers = []struct{ marker, reason string }{
+	{"cf-browser-verification", "Cloudflare challenge"},
+	{"challenge-platform", "Cloudflare challenge"},
+	{"cf_chl_", "Cloudflare challenge"},
+	{"<title>Just a moment...</title>", "Cloudflare challenge"},
+	{"Attention Required! | Cloudflare", "Cloudflare block page"},
+	{"captcha-delivery.com", "DataDome CAPTCHA"},
+	{"_Incapsula_Resource", "Imperva Incapsula challenge"},
+	{"px-captcha", "PerimeterX CAPTCHA"},
+	{"/_Incapsula_", "Imperva Incapsula challenge"},
+}
+
+// captchaMarkers identify CAPTCHA widgets. They only count on error responses or small pages.
+var captchaMarkers = []struct{ marker, reason string }{
+	{"g-recaptcha", "reCAPTCHA"},
+	{"www.google.com/recaptcha", "reCAPTCHA"},
+	{"h-captcha", "hCaptcha"},
+	{"hcaptcha.com", "hCaptcha"},
+	{"challenges.cloudflare.com/turnstile", "Cloudflare Turnstile"},
+	{"Are you a robot", "CAPTCHA"},
+}
+
+// DetectAntiBot reports whether a response is a bot-protection interstitial rather than real content, and
+// which kind it is.
+func DetectAntiBot(statusCode int, header http.Header, body []byte) (reason string, blocked bool) {
+	if header.Get("cf-mitigated") == "challenge" {
+		return "Cloudflare challenge", true
+	}
+	for _, m := range challengeMarkers {
+		if bytes.Contains(body, []byte(m.marker)) {
+			return m.reason, true
+		}
+	}
+	if statusCode < 400 && len(body) > smallPageSize {
+		return "", false
+	}
+	for _, m := range captchaMarkers {
+		if bytes.Contains(body, []byte(m.marker)) {
+			return m.reason, true
+		}
+	}
+	return "", false
+}
+
+// BlockedDomain records a domain whose requests are being answered with anti-bot pages.
+type BlockedDomain struct {
+	Domain     string    `json:"domain"`
+	Reason     string    `json:"reason"`
+	URL        string    `json:"url"` // First URL that returned a challenge
+	Count      int       `json:"count"`
+	DetectedAt time.Time `json:"detected_at"`
+	RetryAfter time.Time `json:"retry_after"`
+}
+
+// CircuitBreaker stops requests to domains that serve anti-bot pages. A domain's breaker opens on the first
+// challenge and rejects requests until its cooldown passes; the next request is then let through as a probe.
+// A probe that is challenged again reopens the breaker with double the cooldown, and a normal response
+// closes it.
+type CircuitBreaker struct {
+	mu      sync.Mutex
+	domains map[string]*breakerState
+}
+
+type breakerState struct {
+	blocked  BlockedDomain
+	cooldown time.Duration
+	probeAt  time.Time // When the current half-open probe was let through
+}
+
+// DefaultCircuitBreaker is shared by all crawlers and scrapers.
+var DefaultCircuitBreaker = NewCircuitBreaker()
+
+// NewCircuitBreaker creates a breaker with every domain closed.
+func NewCircuitBreaker() *CircuitBreaker {
+	return &CircuitBreaker{domains: make(map[string]*breakerState)}
+}
+
+// Allow reports whether a request to host may be sent.
+func (b *CircuitBreaker) Allow(host string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state, ok := b.domains[host]
+	if !ok {
+		return true
+	}
+	now := time.Now()
+	if now.Before(state.blocked.RetryAfter) || now.Sub(state.probeAt) < probeTimeout {
+		return false
+	}
+	state.probeAt = now // Half-open: let one request through
+	return true
+}
+
+// RecordBlocked opens the breaker for host after a challenge page was returned for url.
+func (b *CircuitBreaker) RecordBlocked(host, url, reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	state, ok := b.domains[host]
+	if !ok {
+		state = &breakerState{
+			blocked:  BlockedDomain{Domain: host, Reason: reason, URL: url, DetectedAt: now},
+			cooldown: breakerCooldown,
+		}
+		b.domains[host] = state
+	} else if !state.probeAt.IsZero() {
+		state.cooldown *= 2
+		if state.cooldown > maxBreakerCooldown {
+			state.cooldown = maxBreakerCooldown
+		}
+	}
+	state.probeAt = time.Time{}
+	state.blocked.Count++
+	state.blocked.RetryAfter = now.Add(state.cooldown)
+	log.Printf("%s is serving %s pages, blocking it until %s", host, reason, state.blocked.RetryAfter.Format(time.RFC3339))
+}
+
+// RecordSuccess closes the breaker for host.
+func (b *CircuitBreaker) RecordSuccess(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.domains[host]; ok {
+		delete(b.domains, host)
+		log.Printf("%s is no longer blocked", host)
+	}
+}
+
+// Status returns the block recorded for host, if its breaker is open.
+func (b *CircuitBreaker) Status(host string) (BlockedDomain, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if state, ok := b.domains[host]; ok {
+		return state.blocked, true
+	}
+	return BlockedDomain{}, false
+}
+
+// BlockedSince returns the blocked domains first detected at or after t.
+func (b *CircuitBreaker) BlockedSince(t time.Time) []BlockedDomain {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var blocked []BlockedDomain
+	for _, state := range b.domains {
+		if !state.blocked.DetectedAt.Before(t) {
+			blocked = append(blocked, state.blocked)
+		}
+	}
+	return blocked
+}
+
+// Attach hooks the breaker into a collector. Requests to blocked domains are aborted, and challenge pages
+// are recorded and emptied so no OnHTML handler extracts or stores them.
+func (b *CircuitBreaker) Attach(c *colly.Collector) {
+	c.OnRequest(func(r *colly.Request) {
+		if !b.Allow(r.URL.Host) {
+			log.Printf("Skipping %s, domain is blocked by anti-bot protection", r.URL)
+			r.Abort()
+		}
+	})
+	check := func(r *colly.Response) {
+		var header http.Header
+		if r.Headers != nil {
+			header = *r.Headers
+		}
+		host := r.Request.URL.Host
+		if reason, blocked := DetectAntiBot(r.StatusCode, header, r.Body); blocked {
+			b.RecordBlocked(host, r.Request.URL.String(), reason)
+			r.Body = nil
+		} else if r.StatusCode > 0 && r.StatusCode < 400 {
+			b.RecordSuccess(host)
+		}
+	}
+	c.OnResponse(check)
+	c.OnError(func(r *colly.Response, err error) {
+		if r != nil && r.Request != nil && r.StatusCode > 0 {
+			check(r)
+		}
+	})
+}
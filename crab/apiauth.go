@@ -0,0 +1,194 @@
+package crab
+
+import (
+	"cmpscfa23team2/access"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Role is what an API caller may do, as package access defines it for crab and the dal.
+type Role = access.Role
+
+const (
+	RoleNone     = access.RoleNone
+	RoleViewer   = access.RoleViewer
+	RoleOperator = access.RoleOperator
+	RoleAdmin    = access.RoleAdmin
+)
+
+// ParseRole reads a role name. Unknown names are an error.
+func ParseRole(name string) (Role, error) {
+	return access.ParseRole(name)
+}
+
+// APIKey grants its role to the callers presenting it.
+type APIKey struct {
+	Name string `json:"name"` // Who the key belongs to, for the audit log
+	Key  string `json:"key"`
+	Role string `json:"role"` // "viewer", "operator" or "admin"
+}
+
+// APIConfig protects the REST API. Callers authenticate with an API key, sent as "X-API-Key: <key>" or
+// "Authorization: Bearer <key>", or with an HS256 JWT signed with JWTSecret, whose "sub" claim names the
+// caller and "role" claim gives the role. With neither keys nor a secret configured the API is open for
+// reading only: every caller is an anonymous viewer, so the operator and admin routes answer 403.
+type APIConfig struct {
+	Keys      []APIKey `json:"keys"`
+	JWTSecret string   `json:"jwt_secret"`
+}
+
+// Enabled reports whether the API requires authentication.
+func (c APIConfig) Enabled() bool {
+	return len(c.Keys) > 0 || c.JWTSecret != ""
+}
+
+// Principal is an authenticated API caller, and AuditEntry records one mutating API call. They are
+// defined in package access, which the dal audits them with.
+type (
+	Principal  = access.Principal
+	AuditEntry = access.AuditEntry
+)
+
+// APIAuth authenticates API requests and checks their role.
+type APIAuth struct {
+	// RoleLookup gives the role of a JWT subject whose token carries no role claim, e.g. from the users
+	// table. Such tokens are rejected when it is nil.
+	RoleLookup func(subject string) (Role, error)
+	// Audit is called after every call that is not a GET, HEAD or OPTIONS request, whatever its outcome.
+	Audit func(entry AuditEntry)
+}
+
+// Authenticate identifies the caller of r under the current configuration.
+func (a *APIAuth) Authenticate(r *http.Request) (Principal, error) {
+	config := CurrentConfig().API
+	if !config.Enabled() {
+		return Principal{Name: "anonymous", Role: RoleViewer, Method: "open"}, nil
+	}
+	credential := r.Header.Get("X-API-Key")
+	if credential == "" {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			return Principal{}, fmt.Errorf("missing credentials")
+		}
+		credential = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+
+	for _, key := range config.Keys {
+		if key.Key != "" && subtle.ConstantTimeCompare([]byte(key.Key), []byte(credential)) == 1 {
+			role, err := ParseRole(key.Role)
+			if err != nil {
+				return Principal{}, fmt.Errorf("API key %s: %v", key.Name, err)
+			}
+			return Principal{Name: key.Name, Role: role, Method: "key"}, nil
+		}
+	}
+	if config.JWTSecret == "" || strings.Count(credential, ".") != 2 {
+		return Principal{}, fmt.Errorf("invalid API key")
+	}
+	return a.authenticateJWT(credential, config.JWTSecret)
+}
+
+// authenticateJWT verifies an HS256 token and reads its subject and role.
+func (a *APIAuth) authenticateJWT(tokenString, secret string) (Principal, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return []byte(secret), nil
+	})
+	if err != nil {
+		return Principal{}, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return Principal{}, fmt.Errorf("invalid token")
+	}
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		subject, _ = claims["uid"].(string) // Tokens issued by dal.GenerateToken
+	}
+	if subject == "" {
+		return Principal{}, fmt.Errorf("token has no subject")
+	}
+
+	principal := Principal{Name: subject, Method: "jwt"}
+	if name, ok := claims["role"].(string); ok {
+		principal.Role, err = ParseRole(name)
+	} else if a.RoleLookup != nil {
+		principal.Role, err = a.RoleLookup(subject)
+	} else {
+		err = fmt.Errorf("token has no role")
+	}
+	return principal, err
+}
+
+// Require wraps next so only callers with at least the role returned by roleFor reach it, with the caller
+// for RequestPrincipal. Unauthenticated callers get 401 and callers with too small a role 403.
+func (a *APIAuth) Require(roleFor func(r *http.Request) Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.Authenticate(r)
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			if a.Audit != nil && r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions {
+				a.Audit(AuditEntry{
+					Time:       time.Now(),
+					Principal:  principal,
+					Method:     r.Method,
+					Path:       r.URL.Path,
+					Status:     recorder.status,
+					RemoteAddr: r.RemoteAddr,
+				})
+			}
+		}()
+
+		if err != nil {
+			log.Printf("API authentication failed for %s %s: %v", r.Method, r.URL.Path, err)
+			recorder.Header().Set("WWW-Authenticate", `Bearer realm="crab"`)
+			http.Error(recorder, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if required := roleFor(r); principal.Role < required {
+			http.Error(recorder, fmt.Sprintf("Forbidden: %s role required", required), http.StatusForbidden)
+			return
+		}
+		next(recorder, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	}
+}
+
+// principalKey is the context key of the caller Require authenticated.
+type principalKey struct{}
+
+// RequestPrincipal returns the caller Require authenticated for r, and false when r did not go through
+// Require.
+func RequestPrincipal(r *http.Request) (Principal, bool) {
+	principal, ok := r.Context().Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// ByMethod requires read for GET, HEAD and OPTIONS requests and write for every other method.
+func ByMethod(read, write Role) func(r *http.Request) Role {
+	return func(r *http.Request) Role {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return read
+		}
+		return write
+	}
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
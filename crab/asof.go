@@ -0,0 +1,99 @@
+package crab
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// RunStartTime returns the start time encoded in a run ID made by NewRunID.
+func RunStartTime(runID string) (time.Time, error) {
+	if !runIDPattern.MatchString(runID) {
+		return time.Time{}, fmt.Errorf("invalid run ID %q", runID)
+	}
+	return time.Parse("20060102T150405.000Z", runID[:len("20060102T150405.000Z")])
+}
+
+// LoadDatasetAsOf returns the named scraped dataset ("inflation", "gasoline", "housing" or "airfare") as
+// it stood after run runID: the version written by the newest run in dir that started no later than
+// runID and produced the dataset. An empty runID returns the latest version. The dataset's RunID tells
+// which run wrote it, so an analysis can be repeated on the same data, and a bad scrape rolled back by
+// reading the dataset as of the run before it.
+func LoadDatasetAsOf(dir, name, runID string) (Dataset, error) {
+	runID, dataFile, err := findDatasetRun(dir, name, runID)
+	if err != nil {
+		return Dataset{}, err
+	}
+	for _, source := range scrapedDatasetFiles {
+		if source.Name != name {
+			continue
+		}
+		ds, err := source.Load(source.Name, dataFile)
+		if err != nil {
+			return Dataset{}, fmt.Errorf("loading %s: %w", dataFile, err)
+		}
+		ds.RunID = runID
+		return ds, nil
+	}
+	return Dataset{}, fmt.Errorf("unknown dataset %q", name)
+}
+
+// findDatasetRun returns the newest run in dir that started no later than runID (any run when empty) and
+// produced the named dataset, with the path of its data file.
+func findDatasetRun(dir, name, runID string) (string, string, error) {
+	dataFile := ""
+	for _, source := range scrapedDatasetFiles {
+		if source.Name == name {
+			dataFile = source.DataFile
+		}
+	}
+	if dataFile == "" {
+		return "", "", fmt.Errorf("unknown dataset %q", name)
+	}
+	if runID != "" {
+		if _, err := RunStartTime(runID); err != nil {
+			return "", "", err
+		}
+	}
+
+	runs, err := ListRuns(dir)
+	if err != nil {
+		return "", "", err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runID != "" && runs[i] > runID {
+			continue
+		}
+		if path := filepath.Join(dir, runs[i], dataFile); outputFileExists(path) {
+			return runs[i], path, nil
+		}
+	}
+	if runID == "" {
+		return "", "", fmt.Errorf("no run in %s produced the %s dataset", dir, name)
+	}
+	return "", "", fmt.Errorf("no run in %s up to %s produced the %s dataset", dir, runID, name)
+}
+
+// SnapshotAsOf returns the snapshot of rawURL, body included, as it stood after run runID: the newest
+// one fetched by that run or an earlier one. Snapshots stored before pages were tagged with their run
+// are placed by their fetch time.
+func SnapshotAsOf(store SnapshotStore, rawURL, runID string) (Snapshot, error) {
+	started, err := RunStartTime(runID)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snapshots, err := store.ListSnapshots(rawURL)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].FetchedAt.Before(snapshots[j].FetchedAt) })
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		snapshot := snapshots[i]
+		if snapshot.RunID != "" && snapshot.RunID > runID || snapshot.RunID == "" && !snapshot.FetchedAt.Before(started) {
+			continue
+		}
+		return store.LoadSnapshot(rawURL, snapshot.FetchedAt)
+	}
+	return Snapshot{}, fmt.Errorf("no snapshot of %s as of run %s", rawURL, runID)
+}
@@ -0,0 +1,86 @@
+package crab
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// AtomicFile is a file that only appears under its final name once it has been completely written.
+// Data goes to a temporary file in the same directory, and Commit renames it into place, so a crash or
+// error part way through never leaves a truncated output behind.
+type AtomicFile struct {
+	*os.File
+	filename string
+	done     bool
+}
+
+// CreateAtomic starts writing filename atomically. Callers must call Commit to publish the file, and
+// should defer Abort to clean up after errors; Abort does nothing once Commit has succeeded.
+func CreateAtomic(filename string) (*AtomicFile, error) {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicFile{File: tmp, filename: filename}, nil
+}
+
+// Commit flushes the data to disk and renames the temporary file to its final name.
+func (f *AtomicFile) Commit() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.filename); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Abort discards the temporary file if the file has not been committed.
+func (f *AtomicFile) Abort() error {
+	if f.done {
+		return nil
+	}
+	f.done = true
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// WriteFileAtomic writes data to filename through a temporary file and rename. Data written to a file
+// whose name ends in .gz is gzip compressed.
+func WriteFileAtomic(filename string, data []byte) error {
+	if isGzipName(filename) {
+		compressed, err := gzipBytes(data)
+		if err != nil {
+			return err
+		}
+		data = compressed
+	}
+	f, err := CreateAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return f.Commit()
+}
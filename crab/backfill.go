@@ -0,0 +1,269 @@
+package crab
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// backfillSuffix replaces the extension of a dataset file to name the report of its backfill.
+const backfillSuffix = ".backfill.json"
+
+// defaultBackfillFrom is the first year of the backfilled series, the first year of the CPI.
+const defaultBackfillFrom = 1913
+
+// BackfillConfig lists the pages a table dataset's history is split across, such as the archived pages of
+// earlier decades, for Backfill to join into one series.
+type BackfillConfig struct {
+	Pages []string `json:"pages"` // Where pages overlap, the years of the page listed first are kept; the scraper's page when empty
+	From  int      `json:"from"`  // First year of the series, for finding gaps; 1913 when zero
+}
+
+// BackfillPage is one page walked by a backfill and the years it held.
+type BackfillPage struct {
+	URL       string `json:"url"`
+	Rows      int    `json:"rows"`
+	FirstYear int    `json:"first_year,omitempty"`
+	LastYear  int    `json:"last_year,omitempty"`
+}
+
+// BackfillOverlap is a year found on more than one page. Changes lists the values the pages disagree on;
+// the year is kept from the first page.
+type BackfillOverlap struct {
+	Year    int            `json:"year"`
+	Pages   []string       `json:"pages"`
+	Changes []ColumnChange `json:"changes,omitempty"`
+}
+
+// BackfillReport describes a backfill: the pages walked, the years they overlap on and the years none
+// of them had.
+type BackfillReport struct {
+	Dataset  string            `json:"dataset"`
+	File     string            `json:"file"`
+	From     int               `json:"from"`
+	To       int               `json:"to"`
+	Years    int               `json:"years"`
+	Pages    []BackfillPage    `json:"pages"`
+	Overlaps []BackfillOverlap `json:"overlaps"`
+	Gaps     []int             `json:"gaps"`
+}
+
+// Continuous reports whether the series has every year from From to To.
+func (r BackfillReport) Continuous() bool {
+	return len(r.Gaps) == 0 && r.Years > 0
+}
+
+// backfillRow is one year row read from a page, with the values compared across pages.
+type backfillRow struct {
+	Year    int
+	Page    string
+	Columns []string
+	Values  []string
+	Record  interface{}
+}
+
+// backfillSource reads the year rows of one of the table datasets and builds its records back.
+type backfillSource struct {
+	URL      string
+	DataFile string
+	Extract  func(doc *goquery.Document, pageURL string) []backfillRow
+	Records  func(rows []backfillRow) interface{}
+}
+
+// backfillSources lists the datasets Backfill supports by name.
+var backfillSources = map[string]backfillSource{
+	"inflation": {inflationURL, "inflation_data.json", func(doc *goquery.Document, pageURL string) []backfillRow {
+		var rows []backfillRow
+		for _, record := range ExtractInflationData(doc) {
+			columns, values := recordValues(record)
+			rows = append(rows, backfillRow{Year: parseYear(record.Year), Columns: columns, Values: values, Record: record})
+		}
+		return rows
+	}, func(rows []backfillRow) interface{} {
+		records := make([]YearData, len(rows))
+		for i, row := range rows {
+			records[i] = row.Record.(YearData)
+		}
+		return records
+	}},
+	"gasoline": {gasolineURL, "gasoline_data.json", func(doc *goquery.Document, pageURL string) []backfillRow {
+		var rows []backfillRow
+		for _, record := range ExtractGasolineData(doc) {
+			columns, values := recordValues(record)
+			rows = append(rows, backfillRow{Year: parseYear(record.Year), Columns: columns, Values: values, Record: record})
+		}
+		return rows
+	}, func(rows []backfillRow) interface{} {
+		records := make([]GasolineData, len(rows))
+		for i, row := range rows {
+			records[i] = row.Record.(GasolineData)
+		}
+		return records
+	}},
+	"airfare": {airfareURL, "airfare_data_inflation.json", func(doc *goquery.Document, pageURL string) []backfillRow {
+		var rows []backfillRow
+		for _, record := range ExtractAirfareData(doc, pageURL) {
+			months := []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+			values := make([]string, len(months))
+			for _, month := range record.Data.AdditionalInfo.MonthsData {
+				for i := range months {
+					if months[i] == month.Month {
+						values[i] = strings.TrimSpace(month.Rate)
+					}
+				}
+			}
+			rows = append(rows, backfillRow{Year: parseYear(record.Data.Year), Columns: months, Values: values, Record: record})
+		}
+		return rows
+	}, func(rows []backfillRow) interface{} {
+		records := make([]AirfareData, len(rows))
+		for i, row := range rows {
+			records[i] = row.Record.(AirfareData)
+		}
+		return records
+	}},
+}
+
+// BackfillDatasets returns the names of the datasets Backfill supports, sorted.
+func BackfillDatasets() []string {
+	names := make([]string, 0, len(backfillSources))
+	for name := range backfillSources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Backfill walks the pages of a table dataset's history configured under backfill, joins their rows by
+// year and writes the years from From on, oldest first, as one version of the dataset in a run of its
+// own. Years found on
+// several pages are kept from the page listed first and reported as overlaps, with the values the pages
+// disagree on; the years between From and the latest year that no page had are reported as gaps. The
+// report is written next to the dataset file. A page that cannot be fetched fails the backfill before
+// anything is written.
+func Backfill(dataset string) (BackfillReport, error) {
+	report := BackfillReport{Dataset: dataset, Overlaps: []BackfillOverlap{}, Gaps: []int{}}
+	source, ok := backfillSources[dataset]
+	if !ok {
+		return report, fmt.Errorf("no backfill for dataset %q, expected one of %s", dataset, strings.Join(BackfillDatasets(), ", "))
+	}
+	config := CurrentConfig().Backfill[dataset]
+	pages := config.Pages
+	if len(pages) == 0 {
+		pages = []string{source.URL}
+	}
+	report.From = config.From
+	if report.From == 0 {
+		report.From = defaultBackfillFrom
+	}
+
+	fetchedAt := time.Now()
+	byYear := map[int]backfillRow{}
+	overlaps := map[int]*BackfillOverlap{}
+	for _, pageURL := range pages {
+		doc, err := fetchScraperDocument(scraperClient, pageURL, tableRegions...)
+		if err != nil {
+			return report, fmt.Errorf("backfilling %s: %w", dataset, err)
+		}
+		page := BackfillPage{URL: pageURL}
+		for _, row := range source.Extract(doc, pageURL) {
+			if row.Year == 0 {
+				continue // A header or footnote row
+			}
+			row.Page = pageURL
+			page.Rows++
+			if page.FirstYear == 0 || row.Year < page.FirstYear {
+				page.FirstYear = row.Year
+			}
+			if row.Year > page.LastYear {
+				page.LastYear = row.Year
+			}
+			kept, seen := byYear[row.Year]
+			if !seen {
+				byYear[row.Year] = row
+				continue
+			}
+			overlap := overlaps[row.Year]
+			if overlap == nil {
+				overlap = &BackfillOverlap{Year: row.Year, Pages: []string{kept.Page}}
+				overlaps[row.Year] = overlap
+			}
+			overlap.Pages = append(overlap.Pages, pageURL)
+			overlap.Changes = append(overlap.Changes, rowChanges(row.Columns, kept.Values, row.Values)...)
+		}
+		report.Pages = append(report.Pages, page)
+		log.Printf("Backfill of %s read %d rows from %s", dataset, page.Rows, pageURL)
+	}
+
+	years := make([]int, 0, len(byYear))
+	for year := range byYear {
+		years = append(years, year)
+	}
+	sort.Ints(years)
+	rows := make([]backfillRow, 0, len(years))
+	for _, year := range years {
+		if year >= report.From {
+			rows = append(rows, byYear[year])
+		}
+	}
+	report.Years = len(rows)
+	if len(rows) == 0 {
+		return report, fmt.Errorf("backfilling %s: no years from %d on the %d pages", dataset, report.From, len(pages))
+	}
+	report.To = rows[len(rows)-1].Year
+	for year := report.From; year <= report.To; year++ {
+		if _, ok := byYear[year]; !ok {
+			report.Gaps = append(report.Gaps, year)
+		}
+	}
+	for _, overlap := range overlaps {
+		report.Overlaps = append(report.Overlaps, *overlap)
+	}
+	sort.Slice(report.Overlaps, func(i, j int) bool { return report.Overlaps[i].Year < report.Overlaps[j].Year })
+
+	filename, err := writeDatasetRun("backfill", dataset, source.DataFile, source.Records(rows), PageSource{URL: pages[0], FetchedAt: fetchedAt})
+	report.File = filename
+	if err != nil {
+		return report, err
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = WriteFileAtomic(backfillReportFilename(filename), data)
+	}
+	if err != nil {
+		log.Printf("Error writing the backfill report of %s: %v", dataset, err)
+	}
+	return report, nil
+}
+
+// recordValues returns the columns of a flat record and its trimmed values.
+func recordValues(record interface{}) ([]string, []string) {
+	records := reflect.Append(reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(record)), 0, 1), reflect.ValueOf(record))
+	ds, err := NewDataset("", records.Interface())
+	if err != nil || len(ds.Rows) != 1 {
+		return nil, nil
+	}
+	return ds.Columns, ds.Rows[0]
+}
+
+// parseYear reads the year of a table row, or returns 0 when the cell holds no year.
+func parseYear(cell string) int {
+	year, err := strconv.Atoi(strings.TrimSpace(cell))
+	if err != nil || year < 1000 || year > 9999 {
+		return 0
+	}
+	return year
+}
+
+// backfillReportFilename returns the backfill report of a dataset file, e.g. inflation_data.backfill.json
+// for inflation_data.json.
+func backfillReportFilename(dataFile string) string {
+	return strings.TrimSuffix(lineageFilename(dataFile), lineageSuffix) + backfillSuffix
+}
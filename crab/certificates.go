@@ -0,0 +1,143 @@
+package crab
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CertificateConfig turns on the inspection of TLS certificates during crawls: the certificate each HTTPS
+// host presents is recorded once per crawl, with its issuer, expiry and subject alternative names, and
+// listed in the crawl report, flagged when it expires within ExpiryDays. Certificates that fail
+// verification are recorded too, with the reason, since their hosts cannot be crawled.
+type CertificateConfig struct {
+	Enabled    bool `json:"enabled"`
+	ExpiryDays int  `json:"expiry_days"` // defaultCertificateExpiryDays when zero
+}
+
+const defaultCertificateExpiryDays = 30
+
+// HostCertificate is the TLS certificate a host presented to the crawler.
+type HostCertificate struct {
+	Host      string    `json:"host"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	DaysLeft  int       `json:"days_left"` // Negative once expired
+	SANs      []string  `json:"sans"`
+	Expiring  bool      `json:"expiring,omitempty"` // Expires within the configured days, or has expired
+	Error     string    `json:"error,omitempty"`    // Why the certificate failed verification
+}
+
+// CertificateInspector records the certificates of the hosts a crawl connects to.
+type CertificateInspector struct {
+	expiry time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]HostCertificate
+}
+
+// NewCertificateInspector returns an inspector flagging the certificates that expire within the days of
+// config.
+func NewCertificateInspector(config CertificateConfig) *CertificateInspector {
+	days := config.ExpiryDays
+	if days <= 0 {
+		days = defaultCertificateExpiryDays
+	}
+	return &CertificateInspector{expiry: time.Duration(days) * 24 * time.Hour, now: time.Now, hosts: map[string]HostCertificate{}}
+}
+
+// Record keeps the leaf certificate of a TLS connection to host, unless one was kept for it already.
+// verifyErr is why the certificate failed verification, if it did.
+func (i *CertificateInspector) Record(host string, cert *x509.Certificate, verifyErr error) {
+	if i == nil || cert == nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if _, ok := i.hosts[host]; ok {
+		return
+	}
+	now := i.now()
+	info := HostCertificate{
+		Host:      host,
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		DaysLeft:  int(cert.NotAfter.Sub(now).Hours() / 24),
+		SANs:      append([]string{}, cert.DNSNames...),
+		Expiring:  cert.NotAfter.Before(now.Add(i.expiry)),
+	}
+	for _, ip := range cert.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+	if verifyErr != nil {
+		info.Error = verifyErr.Error()
+	}
+	i.hosts[host] = info
+	if info.Expiring {
+		log.Printf("Warning: the TLS certificate of %s expires on %s, in %d day(s)", host, info.NotAfter.Format("2006-01-02"), info.DaysLeft)
+	}
+}
+
+// Certificates returns the certificates recorded, sorted by host.
+func (i *CertificateInspector) Certificates() []HostCertificate {
+	if i == nil {
+		return nil
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	certs := make([]HostCertificate, 0, len(i.hosts))
+	for _, info := range i.hosts {
+		certs = append(certs, info)
+	}
+	sort.Slice(certs, func(a, b int) bool { return certs[a].Host < certs[b].Host })
+	return certs
+}
+
+// Transport wraps next so the certificate of every host it connects to over TLS is recorded. next is the
+// crawl transport when nil.
+func (i *CertificateInspector) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = crawlTransport()
+	}
+	if i == nil {
+		return next
+	}
+	return &certificateTransport{inspector: i, next: next}
+}
+
+// certificateTransport records the certificates of the connections of the requests it sends.
+type certificateTransport struct {
+	inspector *CertificateInspector
+	next      http.RoundTripper
+}
+
+func (rt *certificateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.next.RoundTrip(req)
+	var verifyErr *tls.CertificateVerificationError
+	if err != nil && errors.As(err, &verifyErr) && len(verifyErr.UnverifiedCertificates) > 0 {
+		rt.inspector.Record(req.URL.Host, verifyErr.UnverifiedCertificates[0], verifyErr.Err)
+	} else if err == nil && resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		rt.inspector.Record(req.URL.Host, resp.TLS.PeerCertificates[0], nil)
+	}
+	return resp, err
+}
+
+// beginCertificates returns the certificate inspector of a crawl when config enables inspection, or nil.
+// The crawl hands it to the collectors of its fetches, so crawls running at once report only their own
+// hosts.
+func beginCertificates(config CertificateConfig) *CertificateInspector {
+	if !config.Enabled {
+		return nil
+	}
+	return NewCertificateInspector(config)
+}
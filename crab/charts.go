@@ -0,0 +1,237 @@
+package crab
+
+import (
+	"encoding/json"
+	"fmt"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/vg"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ChartConfig renders the trend charts of the time series a run scraped into the run's directory as it
+// finishes, next to the datasets they are drawn from, where the dashboard can embed them. Runs written to
+// the working directory get no charts; "crab charts" draws them on request.
+type ChartConfig struct {
+	Enabled bool     `json:"enabled"`
+	Formats []string `json:"formats"` // "png" and "svg"; png when empty
+}
+
+// TrendChart describes a single line chart rendered from one of the scraped JSON datasets. DataFile is the
+// JSON output written by the matching scraper and Load turns that file into the points to plot.
+type TrendChart struct {
+	Name     string // Base name of the chart file, without extension
+	Title    string
+	XLabel   string
+	YLabel   string
+	DataFile string
+	Load     func(filename string) (plotter.XYs, error)
+}
+
+// trendCharts lists the charts produced by GenerateTrendCharts, one per scraped time series.
+var trendCharts = []TrendChart{
+	{
+		Name:     "inflation_trend",
+		Title:    "US Inflation Rate",
+		XLabel:   "Year",
+		YLabel:   "Inflation rate (%)",
+		DataFile: "inflation_data.json",
+		Load:     LoadInflationSeries,
+	},
+	{
+		Name:     "gasoline_trend",
+		Title:    "Average Gasoline Prices",
+		XLabel:   "Year",
+		YLabel:   "Price per gallon ($)",
+		DataFile: "gasoline_data.json",
+		Load:     LoadGasolineSeries,
+	},
+	{
+		Name:     "airfare_trend",
+		Title:    "Airfare Inflation Rate",
+		XLabel:   "Year",
+		YLabel:   "Inflation rate (%)",
+		DataFile: "airfare_data_inflation.json",
+		Load:     LoadAirfareSeries,
+	},
+}
+
+// GenerateTrendCharts renders a line chart for every scraped time series found in dataDir and saves it to
+// outDir in each of the requested formats ("png", "svg"). Datasets that have not been scraped yet are skipped.
+// Pointing outDir at the dashboard's static assets folder makes the charts embeddable in the dashboard.
+// It returns the paths of the chart files that were written.
+func GenerateTrendCharts(dataDir, outDir string, formats ...string) ([]string, error) {
+	if len(formats) == 0 {
+		formats = []string{"png"}
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, err
+	}
+
+	var written []string
+	for _, chart := range trendCharts {
+		dataPath := filepath.Join(dataDir, chart.DataFile)
+		if !outputFileExists(dataPath) {
+			log.Printf("Skipping %s chart, %s not found", chart.Name, dataPath)
+			continue
+		}
+
+		points, err := chart.Load(dataPath)
+		if err != nil {
+			return written, fmt.Errorf("loading %s: %w", dataPath, err)
+		}
+		if len(points) == 0 {
+			log.Printf("Skipping %s chart, no numeric data in %s", chart.Name, dataPath)
+			continue
+		}
+
+		for _, format := range formats {
+			filename := filepath.Join(outDir, chart.Name+"."+strings.TrimPrefix(format, "."))
+			if err := RenderLineChart(points, chart.Title, chart.XLabel, chart.YLabel, filename); err != nil {
+				return written, err
+			}
+			written = append(written, filename)
+		}
+	}
+
+	log.Println("Trend charts written:", written)
+	return written, nil
+}
+
+// renderCharts renders the trend charts of the datasets of a run about to finish into its directory when
+// the charts are enabled. Charts that cannot be rendered are logged and left out rather than failing the
+// run. It returns the files written.
+func (r *Run) renderCharts() []string {
+	config := CurrentConfig().Charts
+	if !config.Enabled {
+		return nil
+	}
+	written, err := GenerateTrendCharts(r.Dir, r.Dir, config.Formats...)
+	if err != nil {
+		log.Printf("Error rendering the charts of run %s: %v", r.ID, err)
+	}
+	return written
+}
+
+// RenderLineChart draws the given points as a line chart and saves it to filename. The image format is
+// picked from the file extension, so both .png and .svg are supported.
+func RenderLineChart(points plotter.XYs, title, xLabel, yLabel, filename string) error {
+	p := plot.New()
+	p.Title.Text = title
+	p.X.Label.Text = xLabel
+	p.Y.Label.Text = yLabel
+	p.Add(plotter.NewGrid())
+
+	line, err := plotter.NewLine(points)
+	if err != nil {
+		return fmt.Errorf("creating line for %s: %w", title, err)
+	}
+	p.Add(line)
+
+	if err := p.Save(8*vg.Inch, 4*vg.Inch, filename); err != nil {
+		return fmt.Errorf("saving chart %s: %w", filename, err)
+	}
+	return nil
+}
+
+// LoadInflationSeries reads inflation_data.json and returns one point per month, with the X value
+// expressed as a fractional year so the series reads left to right in time order.
+func LoadInflationSeries(filename string) (plotter.XYs, error) {
+	file, err := ReadOutputFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []YearData
+	if err := json.Unmarshal(file, &data); err != nil {
+		return nil, err
+	}
+
+	var points plotter.XYs
+	for _, yd := range data {
+		year, err := parseChartNumber(yd.Year)
+		if err != nil {
+			continue
+		}
+		months := []string{yd.Jan, yd.Feb, yd.Mar, yd.Apr, yd.May, yd.Jun, yd.July, yd.Aug, yd.Sept, yd.Oct, yd.Nov, yd.Dec}
+		for i, rate := range months {
+			value, err := parseChartNumber(rate)
+			if err != nil {
+				continue // Cells such as "Avail.Dec.12" are placeholders, not data
+			}
+			points = append(points, plotter.XY{X: year + float64(i)/12, Y: value})
+		}
+	}
+	sortPoints(points)
+	return points, nil
+}
+
+// LoadGasolineSeries reads gasoline_data.json and returns the average gasoline price for each year.
+func LoadGasolineSeries(filename string) (plotter.XYs, error) {
+	file, err := ReadOutputFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []GasolineData
+	if err := json.Unmarshal(file, &data); err != nil {
+		return nil, err
+	}
+
+	var points plotter.XYs
+	for _, gd := range data {
+		year, err := parseChartNumber(gd.Year)
+		if err != nil {
+			continue
+		}
+		price, err := parseChartNumber(gd.AverageGasolinePrices)
+		if err != nil {
+			continue
+		}
+		points = append(points, plotter.XY{X: year, Y: price})
+	}
+	sortPoints(points)
+	return points, nil
+}
+
+// LoadAirfareSeries reads the airfare JSON written by Airdatatest and returns one point per month.
+func LoadAirfareSeries(filename string) (plotter.XYs, error) {
+	records, err := readAirfareFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	months := map[string]float64{"Jan": 0, "Feb": 1, "Mar": 2, "Apr": 3, "May": 4, "Jun": 5, "Jul": 6, "Aug": 7, "Sep": 8, "Oct": 9, "Nov": 10, "Dec": 11}
+
+	var points plotter.XYs
+	for _, airfare := range records {
+		year, err := parseChartNumber(airfare.Data.Year)
+		if err != nil {
+			continue
+		}
+		for _, md := range airfare.Data.AdditionalInfo.MonthsData {
+			value, err := parseChartNumber(md.Rate)
+			if err != nil {
+				continue
+			}
+			points = append(points, plotter.XY{X: year + months[md.Month]/12, Y: value})
+		}
+	}
+	sortPoints(points)
+	return points, nil
+}
+
+// parseChartNumber converts a scraped cell such as "$4.37 " or "1,234.5" into a float.
+func parseChartNumber(s string) (float64, error) {
+	number, err := ParseNumber(s, NumberFormat{})
+	return number.Value, err
+}
+
+// sortPoints orders points by X, since the scraped tables list the newest year first.
+func sortPoints(points plotter.XYs) {
+	sort.Slice(points, func(i, j int) bool { return points[i].X < points[j].X })
+}
@@ -0,0 +1,226 @@
+package crab
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// CheckpointConfig makes paginated scrapes resumable. With checkpoints enabled, a scrape appends its items
+// to a partial dataset as it goes and, every EveryPages pages, flushes it to disk along with a checkpoint
+// of the next page to scrape. A scrape of the same domain and start URL that finds the checkpoint picks up
+// from that page with the items already scraped, instead of starting again from page one. The checkpoint
+// is removed once a scrape gets through every page without errors.
+type CheckpointConfig struct {
+	Enabled    bool   `json:"enabled"`
+	Dir        string `json:"dir"`         // The output directory's checkpoints directory when empty
+	EveryPages int    `json:"every_pages"` // 1 when zero
+}
+
+// ScrapeCheckpoint is where a paginated scrape got to.
+type ScrapeCheckpoint struct {
+	Domain      string    `json:"domain"`
+	StartURL    string    `json:"start_url"`
+	NextURL     string    `json:"next_url"` // The first page not yet scraped
+	Pages       int       `json:"pages"`    // Pages scraped before NextURL
+	Items       int       `json:"items"`    // Items in the partial dataset
+	PartialFile string    `json:"partial_file"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// unsafeFileChars are replaced in the names of checkpoint files.
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// checkpointDir returns where checkpoints are kept under config.
+func checkpointDir(config Config) string {
+	if config.Checkpoints.Dir != "" {
+		return config.Checkpoints.Dir
+	}
+	return filepath.Join(config.Output.Dir, "checkpoints")
+}
+
+// CheckpointFile returns the file of domain's scrape checkpoint.
+func CheckpointFile(domain string) string {
+	return checkpointFile(checkpointDir(CurrentConfig()), domain)
+}
+
+// checkpointFile returns the file of domain's scrape checkpoint in dir.
+func checkpointFile(dir, domain string) string {
+	return filepath.Join(dir, unsafeFileChars.ReplaceAllString(domain, "_")+".json")
+}
+
+// LoadScrapeCheckpoint reads domain's scrape checkpoint; ok is false when there is none.
+func LoadScrapeCheckpoint(domain string) (checkpoint ScrapeCheckpoint, ok bool, err error) {
+	return loadScrapeCheckpoint(checkpointDir(CurrentConfig()), domain)
+}
+
+// loadScrapeCheckpoint is LoadScrapeCheckpoint with the checkpoints kept in dir.
+func loadScrapeCheckpoint(dir, domain string) (checkpoint ScrapeCheckpoint, ok bool, err error) {
+	data, err := os.ReadFile(checkpointFile(dir, domain))
+	if os.IsNotExist(err) {
+		return checkpoint, false, nil
+	}
+	if err != nil {
+		return checkpoint, false, err
+	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return checkpoint, false, fmt.Errorf("reading checkpoint of %s: %w", domain, err)
+	}
+	return checkpoint, true, nil
+}
+
+// scrapeCheckpointer keeps the checkpoint of a running scrape. A nil scrapeCheckpointer keeps none.
+type scrapeCheckpointer struct {
+	ScrapeCheckpoint
+	dir     string // Where the checkpoint is kept
+	every   int
+	partial *os.File
+	w       *bufio.Writer
+	encoder *json.Encoder
+	unsaved int // Pages scraped since the last save
+}
+
+// startScrapeCheckpoint opens the checkpoint of a scrape of domain from startURL when config enables
+// checkpoints. It resumes the checkpoint left by an earlier scrape from startURL, and returns the items of
+// its partial dataset; any other checkpoint of domain is started over.
+func startScrapeCheckpoint(config Config, domain, startURL string) (*scrapeCheckpointer, []GenericData) {
+	every := config.Checkpoints.EveryPages
+	if !config.Checkpoints.Enabled {
+		return nil, nil
+	}
+	if every <= 0 {
+		every = 1
+	}
+	dir := checkpointDir(config)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("Error creating checkpoint directory, scraping without checkpoints: %v", err)
+		return nil, nil
+	}
+
+	c := &scrapeCheckpointer{dir: dir, every: every}
+	c.Domain, c.StartURL = domain, startURL
+	c.PartialFile = filepath.Join(dir, unsafeFileChars.ReplaceAllString(domain, "_")+".partial.jsonl")
+	var items []GenericData
+	if previous, ok, err := loadScrapeCheckpoint(dir, domain); err != nil {
+		log.Printf("Error loading checkpoint, scraping from the start: %v", err)
+	} else if ok && previous.StartURL == startURL && previous.NextURL != "" {
+		if items, err = readPartialItems(c.PartialFile, previous.Items); err != nil {
+			log.Printf("Error reading the partial dataset of %s, scraping from the start: %v", domain, err)
+		} else {
+			c.ScrapeCheckpoint = previous
+			log.Printf("Resuming %s from page %d at %s with %d items", domain, previous.Pages+1, previous.NextURL, len(items))
+		}
+	}
+
+	// The partial dataset is rewritten with the items resumed, dropping any written after the checkpoint
+	file, err := os.Create(c.PartialFile)
+	if err != nil {
+		log.Printf("Error creating partial dataset, scraping without checkpoints: %v", err)
+		return nil, nil
+	}
+	c.partial, c.w = file, bufio.NewWriter(file)
+	c.encoder = json.NewEncoder(c.w)
+	for _, item := range items {
+		c.encoder.Encode(item)
+	}
+	if c.NextURL == "" {
+		items = nil
+	}
+	return c, items
+}
+
+// readPartialItems reads the first count items of a partial dataset.
+func readPartialItems(filename string, count int) ([]GenericData, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	items := make([]GenericData, 0, count)
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for len(items) < count {
+		var item GenericData
+		if err := decoder.Decode(&item); err != nil {
+			return nil, fmt.Errorf("item %d of %d: %w", len(items)+1, count, err)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// resumeURL returns the page to start scraping from.
+func (c *scrapeCheckpointer) resumeURL(startURL string) string {
+	if c == nil || c.NextURL == "" {
+		return startURL
+	}
+	return c.NextURL
+}
+
+// pagesDone returns the pages scraped before the resumed page.
+func (c *scrapeCheckpointer) pagesDone() int {
+	if c == nil {
+		return 0
+	}
+	return c.Pages
+}
+
+// add appends a scraped item to the partial dataset.
+func (c *scrapeCheckpointer) add(item interface{}) error {
+	if c == nil {
+		return nil
+	}
+	c.Items++
+	return c.encoder.Encode(item)
+}
+
+// pageDone records that the pages before next are scraped, saving the checkpoint every EveryPages pages.
+// The items of those pages must have been added.
+func (c *scrapeCheckpointer) pageDone(pages int, next string) error {
+	if c == nil {
+		return nil
+	}
+	c.unsaved++
+	if c.unsaved < c.every {
+		return nil
+	}
+	c.unsaved = 0
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	if err := c.partial.Sync(); err != nil {
+		return err
+	}
+	c.NextURL, c.Pages, c.UpdatedAt = next, pages, time.Now()
+	data, err := json.MarshalIndent(c.ScrapeCheckpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(checkpointFile(c.dir, c.Domain), data)
+}
+
+// finish closes the partial dataset, and removes it with the checkpoint when the scrape is complete.
+func (c *scrapeCheckpointer) finish(complete bool) {
+	if c == nil {
+		return
+	}
+	if err := c.w.Flush(); err != nil {
+		log.Printf("Error writing the partial dataset of %s: %v", c.Domain, err)
+	}
+	c.partial.Close()
+	if !complete {
+		if c.NextURL != "" {
+			log.Printf("Kept the checkpoint of %s at page %d to resume from", c.Domain, c.Pages+1)
+		}
+		return
+	}
+	for _, name := range []string{checkpointFile(c.dir, c.Domain), c.PartialFile} {
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing checkpoint file: %v", err)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Package client calls the REST API of a crab daemon, as "crab serve" runs it, with the request and
+// response types of package crab. Its operations are generated from the daemon's routes; run go generate
+// after changing them.
+package client
+
+//go:generate go run ../../cmd/crab openapi -client operations.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client calls a crab daemon.
+type Client struct {
+	BaseURL    string       // e.g. http://localhost:8080
+	APIKey     string       // Sent as X-API-Key when set
+	Token      string       // A JWT sent as a bearer token when set
+	HTTPClient *http.Client // http.DefaultClient when nil
+}
+
+// New creates a client of the daemon at baseURL.
+func New(baseURL string) *Client {
+	return &Client{BaseURL: baseURL}
+}
+
+// Error is a response with an error status.
+type Error struct {
+	StatusCode int
+	Message    string // The body of the response
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// idempotencyKey is the context key of the key WithIdempotencyKey sets.
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a context under which the requests of a client send key as their
+// Idempotency-Key header, for the operations that take one such as CreateJob. A retry sent under the same
+// key gets the response to the first request instead of, say, queueing a second job.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// do sends a request with query parameters and body as JSON, and decodes the response into result. A
+// *[]byte result takes the body as it is, and a nil result ignores it.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, result interface{}) error {
+	target := strings.TrimSuffix(c.BaseURL, "/") + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if _, raw := result.(*[]byte); !raw {
+		req.Header.Set("Accept", "application/json")
+	}
+	if key, ok := ctx.Value(idempotencyKey{}).(string); ok && key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	if c.APIKey != "" {
+		req.Header.Set("X-API-Key", c.APIKey)
+	} else if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	switch result := result.(type) {
+	case nil:
+		return nil
+	case *[]byte:
+		*result, err = io.ReadAll(resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("decoding the response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package crab
+
+import (
+	"expvar"
+	"fmt"
+	"github.com/gocolly/colly"
+	"net/http/cookiejar"
+	"sync"
+	"time"
+)
+
+// collectorMetrics counts the fetch collectors created and those reused from the pool.
+var collectorMetrics = expvar.NewMap("crab_collectors")
+
+// defaultFetchTimeout is colly's own request timeout, which fetches without a configured one keep.
+const defaultFetchTimeout = 10 * time.Second
+
+// fetchCollector is a collector of the fetch stage kept in a pool between fetches. Its callbacks are
+// registered once and report to the fetch it is checked out to, so it serves one fetch at a time; the
+// connections of its transport are shared by all of them.
+type fetchCollector struct {
+	c       *colly.Collector
+	profile string
+	fetches int // Fetches it was checked out to
+
+	// The fetch the collector is checked out to
+	config   func() Config // Settings of its crawl, read by the callbacks as it goes
+	page     *FetchedPage
+	fetchErr error
+	tracer   *Tracer
+	runID    string    // ID of the run of its crawl, for the snapshots
+	parsing  time.Time // When the response arrived, for the parse span of the trace
+}
+
+// maxIdleCollectors bounds the idle collectors kept per profile, past the fetch workers of any crawl.
+const maxIdleCollectors = 64
+
+// collectorPools holds the idle fetch collectors by the configuration profile they were built under, so
+// the collectors of one profile never carry the cookies or settings of another into its fetches. Each is a
+// bounded free list rather than a sync.Pool, which drops its collectors on every garbage collection.
+var collectorPools struct {
+	sync.Mutex
+	pools map[string]chan *fetchCollector
+}
+
+// collectorPool returns the free list of the idle collectors of profile.
+func collectorPool(profile string) chan *fetchCollector {
+	collectorPools.Lock()
+	defer collectorPools.Unlock()
+	if collectorPools.pools == nil {
+		collectorPools.pools = map[string]chan *fetchCollector{}
+	}
+	pool := collectorPools.pools[profile]
+	if pool == nil {
+		pool = make(chan *fetchCollector, maxIdleCollectors)
+		collectorPools.pools[profile] = pool
+	}
+	return pool
+}
+
+// checkoutCollector returns an idle collector of the profile of the settings config returns, set up to
+// fetch page under them: with a user agent of its own, a new cookie jar, the configured timeout and the
+// tracing and certificate inspection of the crawl of scope when they are enabled. Return it with checkin
+// once the fetch is done.
+func checkoutCollector(config func() Config, scope crawlScope, page *FetchedPage) *fetchCollector {
+	settings := config()
+	var fc *fetchCollector
+	select {
+	case fc = <-collectorPool(settings.profile):
+	default:
+		fc = newFetchCollector(settings.profile)
+	}
+	if fc.fetches++; fc.fetches > 1 {
+		collectorMetrics.Add("reused", 1)
+	}
+	fc.config, fc.page, fc.fetchErr, fc.tracer, fc.runID = config, page, nil, scope.tracer, scope.runID
+	fc.c.UserAgent = requestUserAgent(settings.Fingerprint) // A random user agent unless in honest mode
+	if jar, err := cookiejar.New(nil); err == nil {
+		fc.c.SetCookieJar(jar) // Cookies last for the redirects of one fetch, as with a collector per fetch
+	}
+	timeout := fetchTimeout(settings.Pipeline)
+	if timeout <= 0 {
+		timeout = defaultFetchTimeout
+	}
+	fc.c.SetRequestTimeout(timeout)
+	// Time the response, through the tracer and the certificate inspection when they are enabled
+	next := scope.certificates.Transport(fc.tracer.Transport(proxyTransport(settings.Proxy, settings.URLGuard)))
+	fc.c.WithTransport(&timingTransport{next: next, timing: &page.timing})
+	return fc
+}
+
+// checkin returns the collector to the pool of its profile, or drops it when the pool is full.
+func (fc *fetchCollector) checkin() {
+	fc.config, fc.page, fc.fetchErr, fc.tracer, fc.runID = nil, nil, nil, nil, ""
+	select {
+	case collectorPool(fc.profile) <- fc:
+	default:
+	}
+}
+
+// newFetchCollector creates a collector for the pool of profile, with the callbacks of the fetch stage.
+func newFetchCollector(profile string) *fetchCollector {
+	collectorMetrics.Add("created", 1)
+	fc := &fetchCollector{profile: profile}
+	fc.c = colly.NewCollector(colly.AllowURLRevisit())
+	c := fc.c
+	settings := func() Config { return fc.config() }
+	runID := func() string { return fc.runID }
+	applyFingerprint(c, settings)
+	DefaultCircuitBreaker.Attach(c)     // Stop on anti-bot challenge pages
+	DefaultThrottle.Attach(c)           // Back off domains that answer 429/503
+	attachRateLimit(c, settings)        // Space out requests when a rate limit is configured
+	AttachPauses(c)                     // Hold requests to paused domains
+	attachSnapshots(c, settings, runID) // Keep the raw HTML when snapshots are enabled
+	// Time the parsing of each response when the trace is enabled
+	c.OnResponse(func(r *colly.Response) {
+		fc.parsing = time.Now()
+	})
+	c.OnScraped(func(r *colly.Response) {
+		if fc.tracer != nil {
+			fc.tracer.traceParse(r.Request.URL.String(), fc.parsing)
+		}
+	})
+	// Export fetch and extract spans when telemetry is configured
+	attachTelemetry(c, func() *Span { return fc.page.span })
+
+	// Handler for errors during the crawl
+	c.OnError(func(r *colly.Response, err error) {
+		page := fc.page
+		page.StatusCode = r.StatusCode
+		page.Error = err.Error()
+		fc.fetchErr = err
+		warnf("Error occurred while crawling %s: %s", page.URL, err)
+	})
+
+	// Handler for successful HTTP responses
+	c.OnResponse(func(r *colly.Response) {
+		page := fc.page
+		page.StatusCode = r.StatusCode
+		if r.Headers != nil {
+			page.Header = *r.Headers
+		}
+		if r.StatusCode == 200 {
+			page.ContentType = r.Headers.Get("Content-Type")
+			page.Body = r.Body
+			page.pageURL = r.Request.URL
+			debugf("Crawled URL: %s", page.URL)
+		} else {
+			// Handle cases where the status code is not 200
+			page.Error = fmt.Sprintf("HTTP %d", r.StatusCode)
+			warnf("Non-200 status code while crawling %s: %d", page.URL, r.StatusCode)
+		}
+	})
+	return fc
+}
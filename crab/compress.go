@@ -0,0 +1,95 @@
+package crab
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// Output files whose names end in .gz are gzip compressed when written and decompressed when read back,
+// so every writer and reader in this package handles compression by file name alone. OutputConfig.Gzip
+// turns it on for sitemaps and scraped datasets; ObjectStoreSink.Gzip does the same for uploads.
+
+// isGzipName reports whether a file name calls for gzip compression.
+func isGzipName(filename string) bool {
+	return strings.HasSuffix(filename, ".gz")
+}
+
+// gzipBytes compresses data in memory.
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// OpenOutputFile opens an output file for reading, decompressing it if it is gzipped. If filename does not
+// exist but filename.gz does, the compressed file is opened instead.
+func OpenOutputFile(filename string) (io.ReadCloser, error) {
+	file, err := os.Open(filename)
+	if errors.Is(err, fs.ErrNotExist) && !isGzipName(filename) {
+		if gzFile, gzErr := os.Open(filename + ".gz"); gzErr == nil {
+			file, err = gzFile, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the magic number rather than the name so renamed or downloaded files still work.
+	header := make([]byte, 2)
+	n, _ := io.ReadFull(file, header)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if n < 2 || header[0] != 0x1f || header[1] != 0x8b {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return gzipReadCloser{gz, file}, nil
+}
+
+// outputFileExists reports whether filename, or its gzipped form, exists.
+func outputFileExists(filename string) bool {
+	if _, err := os.Stat(filename); err == nil {
+		return true
+	}
+	_, err := os.Stat(filename + ".gz")
+	return err == nil
+}
+
+// ReadOutputFile reads a whole output file, decompressing it if needed.
+func ReadOutputFile(filename string) ([]byte, error) {
+	file, err := OpenOutputFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// gzipReadCloser closes both the gzip reader and the file under it.
+type gzipReadCloser struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
@@ -0,0 +1,190 @@
+package crab
+
+import (
+	"expvar"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConcurrencyConfig lets each domain's concurrency follow how well it copes, instead of every domain
+// getting as many requests at once as there are fetch workers. With Adaptive set, a domain starts at
+// Initial requests in flight; after every round of as many responses as its limit, the limit grows by
+// one while the round's mean latency stays under TargetLatencyMS and its error rate under MaxErrorRate,
+// and halves as soon as either is exceeded (additive increase, multiplicative decrease). The fetch
+// workers remain the ceiling across all domains.
+type ConcurrencyConfig struct {
+	Adaptive        bool    `json:"adaptive"`
+	Initial         int     `json:"initial"`           // defaultInitialConcurrency when zero
+	Min             int     `json:"min"`               // 1 when zero
+	Max             int     `json:"max"`               // defaultMaxConcurrency when zero
+	TargetLatencyMS int     `json:"target_latency_ms"` // defaultTargetLatency when zero
+	MaxErrorRate    float64 `json:"max_error_rate"`    // defaultMaxErrorRate when zero
+}
+
+const (
+	defaultInitialConcurrency = 2
+	defaultMaxConcurrency     = 32
+	defaultTargetLatency      = 2 * time.Second
+	defaultMaxErrorRate       = 0.1
+)
+
+// concurrencyMetrics publishes the adaptive concurrency of every domain under /debug/vars as
+// "crab_concurrency": "<host>.limit" (requests allowed in flight) and "<host>.in_flight".
+var concurrencyMetrics = expvar.NewMap("crab_concurrency")
+
+// withDefaults returns the config with the defaults for its zero fields.
+func (c ConcurrencyConfig) withDefaults() ConcurrencyConfig {
+	if c.Min <= 0 {
+		c.Min = 1
+	}
+	if c.Max <= 0 {
+		c.Max = defaultMaxConcurrency
+	}
+	if c.Max < c.Min {
+		c.Max = c.Min
+	}
+	if c.Initial <= 0 {
+		c.Initial = defaultInitialConcurrency
+	}
+	if c.Initial < c.Min {
+		c.Initial = c.Min
+	}
+	if c.Initial > c.Max {
+		c.Initial = c.Max
+	}
+	if c.TargetLatencyMS <= 0 {
+		c.TargetLatencyMS = int(defaultTargetLatency / time.Millisecond)
+	}
+	if c.MaxErrorRate <= 0 {
+		c.MaxErrorRate = defaultMaxErrorRate
+	}
+	return c
+}
+
+// ConcurrencyController hands out request slots per domain under limits it adapts to the responses.
+type ConcurrencyController struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	domains map[string]*domainConcurrency
+}
+
+type domainConcurrency struct {
+	limit    int
+	inFlight int
+
+	// The round under way
+	responses int
+	errors    int
+	latency   time.Duration
+}
+
+// DefaultConcurrency is shared by all crawls, so what one learns about a domain the next starts from.
+var DefaultConcurrency = NewConcurrencyController()
+
+// NewConcurrencyController creates a controller that has seen no domains.
+func NewConcurrencyController() *ConcurrencyController {
+	c := &ConcurrencyController{domains: make(map[string]*domainConcurrency)}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Acquire waits for a request slot for host under config and returns the function that gives it back
+// with the latency of the request and whether it failed in a way that tells the domain is struggling.
+func (c *ConcurrencyController) Acquire(host string, config ConcurrencyConfig) func(latency time.Duration, failed bool) {
+	config = config.withDefaults()
+	c.mu.Lock()
+	d, ok := c.domains[host]
+	if !ok {
+		d = &domainConcurrency{limit: config.Initial}
+		c.domains[host] = d
+		setConcurrencyMetric(host+".limit", d.limit)
+	}
+	for d.inFlight >= d.limit {
+		c.cond.Wait()
+	}
+	d.inFlight++
+	setConcurrencyMetric(host+".in_flight", d.inFlight)
+	c.mu.Unlock()
+
+	return func(latency time.Duration, failed bool) {
+		c.release(host, d, config, latency, failed)
+	}
+}
+
+// release gives back a slot of host and adapts its limit at the end of a round.
+func (c *ConcurrencyController) release(host string, d *domainConcurrency, config ConcurrencyConfig, latency time.Duration, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer c.cond.Broadcast()
+	d.inFlight--
+	setConcurrencyMetric(host+".in_flight", d.inFlight)
+	d.responses++
+	d.latency += latency
+	if failed {
+		d.errors++
+	}
+
+	limit := d.limit
+	errorRate := float64(d.errors) / float64(d.responses)
+	switch {
+	case d.errors > 0 && errorRate > config.MaxErrorRate, d.latency/time.Duration(d.responses) > time.Duration(config.TargetLatencyMS)*time.Millisecond:
+		// Back off at once rather than at the end of the round, as the domain is already struggling
+		limit = d.limit / 2
+	case d.responses >= d.limit:
+		limit = d.limit + 1
+	default:
+		return
+	}
+	if limit < config.Min {
+		limit = config.Min
+	}
+	if limit > config.Max {
+		limit = config.Max
+	}
+	d.limit = limit
+	d.responses, d.errors, d.latency = 0, 0, 0
+	setConcurrencyMetric(host+".limit", d.limit)
+}
+
+// Limit returns the number of requests host may have in flight; zero when it has not been requested.
+func (c *ConcurrencyController) Limit(host string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d, ok := c.domains[host]; ok {
+		return d.limit
+	}
+	return 0
+}
+
+// acquireFetchSlot waits for a slot of rawURL's domain when config enables adaptive concurrency and
+// returns the function that releases it with the page fetched.
+func acquireFetchSlot(config ConcurrencyConfig, rawURL string) func(page FetchedPage, latency time.Duration) {
+	u, err := url.Parse(rawURL)
+	if !config.Adaptive || err != nil || u.Host == "" {
+		return func(FetchedPage, time.Duration) {}
+	}
+	release := DefaultConcurrency.Acquire(strings.ToLower(u.Host), config)
+	return func(page FetchedPage, latency time.Duration) {
+		release(latency, overloaded(page))
+	}
+}
+
+// overloaded reports whether a fetched page tells its domain is struggling: it timed out, failed to
+// connect, or was answered with 429 or a server error.
+func overloaded(page FetchedPage) bool {
+	switch page.Status {
+	case StatusTimeout, StatusHTTP5xx, StatusFetchError:
+		return true
+	}
+	return page.StatusCode == http.StatusTooManyRequests
+}
+
+// setConcurrencyMetric publishes a value of the adaptive concurrency.
+func setConcurrencyMetric(name string, value int) {
+	v := new(expvar.Int)
+	v.Set(int64(value))
+	concurrencyMetrics.Set(name, v)
+}
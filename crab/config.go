@@ -0,0 +1,116 @@
+package crab
+
+import (
+	"cmpscfa23team2/access"
+	"cmpscfa23team2/telemetry"
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+)
+
+// Config holds the optional settings for crawls and scrapes. It is read from a JSON file with LoadConfig
+// and installed with SetConfig; the zero value keeps the historical behavior of the crawler and scrapers.
+type Config struct {
+	Webhooks         []WebhookConfig                    `json:"webhooks"`
+	Email            EmailConfig                        `json:"email"`
+	Fingerprint      FingerprintConfig                  `json:"fingerprint"`
+	Output           OutputConfig                       `json:"output"`
+	Snapshots        SnapshotConfig                     `json:"snapshots"`
+	Checkpoints      CheckpointConfig                   `json:"checkpoints"`
+	Feeds            []FeedConfig                       `json:"feeds"`
+	Render           RenderConfig                       `json:"render"`
+	JSONTargets      []JSONTarget                       `json:"json_targets"`
+	GraphQLTargets   []GraphQLTarget                    `json:"graphql_targets"`
+	TableTargets     []TableTarget                      `json:"table_targets"`
+	Deterministic    DeterministicConfig                `json:"deterministic"`
+	Trace            TraceConfig                        `json:"trace"`
+	Telemetry        TelemetryConfig                    `json:"telemetry"`
+	Pipeline         PipelineConfig                     `json:"pipeline"`
+	Frontier         FrontierConfig                     `json:"frontier"`
+	RateLimit        RateLimitConfig                    `json:"rate_limit"`
+	Concurrency      ConcurrencyConfig                  `json:"concurrency"`
+	Profiles         map[string]Profile                 `json:"profiles"`
+	API              APIConfig                          `json:"api"`
+	Daemon           DaemonConfig                       `json:"daemon"`
+	RunLock          RunLockConfig                      `json:"run_lock"`
+	Proxy            ProxyConfig                        `json:"proxy"`
+	URLGuard         URLGuardConfig                     `json:"url_guard"`
+	Traps            TrapConfig                         `json:"traps"`
+	Certificates     CertificateConfig                  `json:"certificates"`
+	Watchdog         WatchdogConfig                     `json:"watchdog"`
+	SEOAudit         SEOAuditConfig                     `json:"seo_audit"`
+	SecurityAudit    SecurityAuditConfig                `json:"security_audit"`
+	A11y             A11yConfig                         `json:"a11y"`
+	Secrets          SecretsConfig                      `json:"secrets"`
+	Alerts           []AlertRule                        `json:"alerts"`        // Checked after each run
+	Seeds            []string                           `json:"seeds"`         // Crawled by crawl jobs without "urls", with the default seeds
+	Scrapers         []string                           `json:"scrapers"`      // Scrapers scrape jobs may run; all when empty
+	Merge            map[string]MergeRule               `json:"merge"`         // Merge rules of the scraped datasets by name
+	Anomalies        map[string]AnomalyRule             `json:"anomalies"`     // Anomaly checks of the scraped datasets by name
+	Numbers          map[string]map[string]NumberFormat `json:"numbers"`       // Number formats of the scraped datasets by name and column
+	TableHeaders     map[string]map[string][]string     `json:"table_headers"` // More header names of the table datasets' columns, by name and column
+	Annotations      map[string]AnnotationRule          `json:"annotations"`   // Annotation stripping of the scraped datasets by name
+	Currency         CurrencyConfig                     `json:"currency"`
+	Quality          map[string][]Expectation           `json:"quality"`           // Expectations of the scraped datasets by name
+	Backfill         map[string]BackfillConfig          `json:"backfill"`          // Historical pages of the table datasets by name
+	Workflows        map[string]WorkflowConfig          `json:"workflows"`         // Scrape-to-predict workflows by name
+	Reports          []ReportTemplate                   `json:"reports"`           // Rendered into the directory of each run as it finishes
+	Charts           ChartConfig                        `json:"charts"`            // Trend charts drawn into the directory of each run as it finishes
+	ExtractorPlugins []string                           `json:"extractor_plugins"` // Go plugins registering custom extractors
+	ScriptExtractors []ScriptExtractor                  `json:"script_extractors"` // Extractors written as expressions
+	RespectRobots    bool                               `json:"respect_robots"`    // Crawls skip the pages robots.txt disallows
+
+	profile string // Applied by WithProfile, "" for none
+}
+
+var (
+	configMu      sync.RWMutex
+	currentConfig Config
+)
+
+// LoadConfig reads a crab configuration from a JSON file. Credentials written as "secret:<name>" are
+// looked up with the providers of its Secrets settings.
+func LoadConfig(filename string) (Config, error) {
+	file, err := os.ReadFile(filename)
+	if err != nil {
+		log.Printf("Error reading config file '%s': %s", filename, err)
+		return Config{}, err
+	}
+
+	config, err := ParseConfig(file)
+	if err != nil {
+		log.Printf("Error parsing config file '%s': %s", filename, err)
+		return config, err
+	}
+	log.Println("Successfully read and parsed crab config file.")
+	return config, nil
+}
+
+// ParseConfig reads a crab configuration in JSON, as LoadConfig reads it from a file.
+func ParseConfig(data []byte) (Config, error) {
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, err
+	}
+	if err := config.resolveSecrets(); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// SetConfig installs the configuration used by subsequent crawls and scrapes.
+func SetConfig(config Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	currentConfig = config
+	access.UseSecrets(config.Secrets)
+	telemetry.Use(config.Telemetry)
+}
+
+// CurrentConfig returns the configuration currently in use.
+func CurrentConfig() Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return currentConfig
+}
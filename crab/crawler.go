@@ -1,15 +1,10 @@
 package crab
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
-	"github.com/gocolly/colly"
-	"github.com/temoto/robotstxt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"net/url"
-	"os"
 	"sync"
 	"time"
 )
@@ -43,7 +38,7 @@ func InsertData(data ItemData, filename string) error {
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile(filename, jsonData, 0644)
+	err = WriteFileAtomic(filename, jsonData)
 	if err != nil {
 		return err
 	}
@@ -51,67 +46,58 @@ func InsertData(data ItemData, filename string) error {
 }
 
 // crawlURL is the core function responsible for crawling a single URL. It takes URLData, a channel to send
-// crawled data, and a WaitGroup to handle concurrency. It uses the Colly library for crawling and processes
-// each URL based on the received HTML content.
-func CrawlURL(urlData URLData, ch chan<- URLData, wg *sync.WaitGroup) {
+// the result of the crawl, and a WaitGroup to handle concurrency. It fetches the URL and parses the response
+// on the calling goroutine, sending exactly one result even when the fetch fails; ThreadedCrawl runs the two
+// steps in separate worker pools instead.
+func CrawlURL(urlData URLData, ch chan<- CrawlResult, wg *sync.WaitGroup) {
 	defer wg.Done() // Ensure the WaitGroup counter is decremented on function exit
-	c := colly.NewCollector(
-		colly.UserAgent(GetRandomUserAgent()), // Set a random user agent
-		colly.AllowURLRevisit(),               // Allow URL revisit
-	)
-
-	// Handler for errors during the crawl
-	c.OnError(func(r *colly.Response, err error) {
-		fmt.Printf("Error occurred while crawling %s: %s\n", urlData.URL, err)
-	})
-
-	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
-		link := e.Request.AbsoluteURL(e.Attr("href"))
-		urlData.Links = append(urlData.Links, link)
-		urlQueue <- link
-	})
-
-	// Handler for successful HTTP responses
-	c.OnResponse(func(r *colly.Response) {
-		if r.StatusCode == 200 {
-			// Successful crawl, process the response here
-			ch <- urlData // Send the URLData to the channel
-			fmt.Printf("Crawled URL: %s\n", urlData.URL)
-		} else {
-			// Handle cases where the status code is not 200
-			fmt.Printf("Non-200 status code while crawling %s: %d\n", urlData.URL, r.StatusCode)
-		}
-	})
-
-	// Start the crawl
-	c.Visit(urlData.URL)
-
-	ch <- urlData
+	ch <- parsePageSafely(ParsePage, FetchPage(urlData))
 }
 
 // createSiteMap generates a sitemap from the given slice of URLData. Each URLData contains links found
 // at a specific URL. The function marshals this data into JSON format and writes it to a file named "siteMap.json".
 // It returns an error if the marshaling or file operations fail.
 func CreateSiteMap(urls []URLData) error {
-	siteMap := make(map[string][]string)
-	for _, u := range urls {
-		siteMap[u.URL] = u.Links
-	}
+	return writeSiteMap(urls, "siteMap.json")
+}
 
-	jsonData, err := json.Marshal(siteMap)
-	err = ioutil.WriteFile("siteMap.json", jsonData, 0644)
+// writeSiteMap writes the sitemap of urls to filename.
+func writeSiteMap(urls []URLData, filename string) error {
+	stream, err := CreateStream(filename, StreamJSONObject)
 	if err != nil {
 		log.Printf("Error writing sitemap to file: %v\n", err)
 		return err
 	}
+	for _, u := range urls {
+		if err := stream.WriteEntry(u.URL, u.Links); err != nil {
+			stream.Abort()
+			log.Printf("Error writing sitemap to file: %v\n", err)
+			return err
+		}
+	}
+	if err := stream.Close(); err != nil {
+		log.Printf("Error writing sitemap to file: %v\n", err)
+		return err
+	}
 
 	log.Println("Sitemap created successfully.")
 	return nil
 }
 
+// WriteCrawlReport writes the run summary, including any domains blocked by anti-bot protection, to a
+// JSON file next to the sitemap.
+func WriteCrawlReport(summary RunSummary, filename string) error {
+	jsonData, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(filename, jsonData)
+}
+
 // isURLAllowedByRobotsTXT checks if the given URL is allowed by the site's robots.txt file.
 // It parses the URL to extract the domain, fetches the robots.txt file from the domain, and tests
-// if the URL is allowed. It returns true if allowed, false otherwise.
+// if the URL's path is allowed for the crawler's robots agent. It returns true if allowed, false otherwise.
+// CheckRobots gives the reasons behind the answer.
 func IsURLAllowedByRobotsTXT(urlStr string) bool {
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
@@ -124,21 +110,12 @@ func IsURLAllowedByRobotsTXT(urlStr string) bool {
 		return false
 	}
 
-	robotsURL := "http://" + parsedURL.Host + "/robots.txt"
-
-	resp, err := http.Get(robotsURL)
+	check, err := CheckRobots(urlStr, "")
 	if err != nil {
 		log.Println("Error fetching robots.txt:", err)
 		return true
 	}
-
-	data, err := robotstxt.FromResponse(resp)
-	if err != nil {
-		log.Println("Error parsing robots.txt:", err)
-		return true
-	}
-
-	return data.TestAgent(urlStr, "GoEngine")
+	return check.Allowed
 }
 
 //end robot.txt ========================================================================================================
@@ -147,46 +124,224 @@ func IsURLAllowedByRobotsTXT(urlStr string) bool {
 // an integer specifying the number of concurrent crawlers. The function sets up each crawler with rate limiting
 // and starts the crawling process. The resulting crawled data is used to create a sitemap.
 func ThreadedCrawl(urls []URLData, concurrentCrawlers int) {
-	var wg sync.WaitGroup
-	ch := make(chan URLData, len(urls))
+	Crawl(context.Background(), urls, concurrentCrawlers)
+}
 
-	rateLimitRule := &colly.LimitRule{
-		DomainGlob:  "*",             // Apply to all domains
-		Delay:       5 * time.Second, // Wait 5 seconds between requests
-		RandomDelay: 5 * time.Second, // Add up to 5 seconds of random delay
-	}
+// Crawl is ThreadedCrawl for callers that need to stop the crawl and see how it went: once ctx is done no
+// more seeds are fetched, the pages already fetched are written out, and the summary of the run, as sent
+// to the webhooks, is returned.
+func Crawl(ctx context.Context, urls []URLData, concurrentCrawlers int) RunSummary {
+	return CrawlWithConfig(ctx, CurrentConfig, urls, concurrentCrawlers)
+}
 
-	log.Println("Starting crawling...")
+// CrawlWithConfig is Crawl under the settings config returns instead of the current configuration, so
+// programs embedding crab can crawl with settings of their own without changing those of the rest of the
+// process. The settings of the run itself, such as its output directory and audits, are read once at the
+// start; those of each request, such as the rate limit and proxies, as the crawl goes, so a config
+// following reloads applies them to a running crawl. The extractor plugins and script extractors of config
+// only apply to this crawl.
+func CrawlWithConfig(ctx context.Context, config func() Config, urls []URLData, concurrentCrawlers int) RunSummary {
+	settings := config()
+	summary := RunSummary{Kind: "crawl", Name: "crawl", StartedAt: time.Now()}
 	for _, urlData := range urls {
-		wg.Add(1)
-
-		go func(u URLData) {
-			c := colly.NewCollector(
-				colly.UserAgent(GetRandomUserAgent()),
-			)
-			c.Limit(rateLimitRule) // Set the rate limit rule
+		summary.Seeds = append(summary.Seeds, urlData.URL)
+	}
+	extractors, err := crawlExtractors(settings)
+	if err != nil {
+		summary.Event, summary.Error, summary.FinishedAt = EventFailed, err.Error(), time.Now()
+		return summary
+	}
+	run, err := startRun(settings.Output, "crawl")
+	if err != nil {
+		log.Println("Error starting run, writing to the working directory:", err)
+	}
+	summary.RunID = run.RunID()
+	tracer := beginTrace(settings.Trace)
+	traps := beginTraps(settings)
+	certificates := beginCertificates(settings.Certificates)
+	runSpan := startRunSpan("crawl", summary.RunID)
+	scope := crawlScope{tracer: tracer, traps: traps, certificates: certificates, robots: newRobotsCache(), span: runSpan, runID: summary.RunID}
+	endWatchdog := beginWatchdog(settings.Watchdog, settings.Output.Dir)
+	latencies := NewLatencyRecorder()
+	events := beginEvents(run)
+	// The channel is bounded rather than sized to the seed list: parsers wait for the sitemap writer
+	// below, so memory does not grow with the size of the crawl.
+	ch := make(chan CrawlResult, resultBuffer)
 
-			CrawlURL(u, ch, &wg)
-		}(urlData)
+	// Requests are spaced out by the configured rate limit, which the pooled collectors apply (see
+	// AttachRateLimit). In deterministic mode the seeds are crawled one after another in sorted order, so
+	// pages reach the sitemap in the same order every run, and the random part of each delay comes from
+	// the seed.
+	seedRun(settings.Deterministic)
+	if settings.Deterministic.Enabled {
+		urls = sortedURLData(urls)
+	}
 
+	log.Println("Starting crawling...")
+	fetchWorkers, parseWorkers, queue := pipelineWorkers(settings.Pipeline, concurrentCrawlers)
+	if settings.Deterministic.Enabled {
+		fetchWorkers, parseWorkers = 1, 1
+	}
+	fetch := func(urlData URLData) FetchedPage {
 		log.Println("Crawling URL:", urlData.URL)
-		if len(urls) >= concurrentCrawlers {
-			break
-		}
+		return fetchPage(ctx, config, scope, urlData)
+	}
+	parse := func(page FetchedPage) CrawlResult {
+		return parsePage(settings, extractors, scope, page)
 	}
-
-	log.Println("Waiting for crawlers to finish...")
 	go func() {
-		wg.Wait()
-		close(ch)
+		crawlPipeline(ctx, settings.Frontier, traps, urls, fetchWorkers, parseWorkers, queue, fetch, parse, ch, events)
 		log.Println("All goroutines finished, channel closed.")
 	}()
+	log.Println("Waiting for crawlers to finish...")
 
-	var crawledURLs []URLData
-	for urlData := range ch {
-		crawledURLs = append(crawledURLs, urlData)
+	// Stream the sitemap to disk as pages arrive instead of holding every page's links in memory.
+	summary.Event = EventCompleted
+	siteMapFile := run.Path(outputFilename(settings.Output, "siteMap.json"))
+	statusFile := run.Path(outputFilename(settings.Output, "url_status.jsonl"))
+	summary.Outputs = []string{siteMapFile, statusFile, run.Path("crawl_report.json")}
+	if tracer != nil {
+		summary.Outputs = append(summary.Outputs, run.Path("trace.json"))
+	}
+	format := StreamJSONObject
+	if settings.Output.Format == OutputFormatNDJSON {
+		format = StreamJSONLines
+	}
+	siteMap, err := CreateStream(siteMapFile, format)
+	// Every URL's status goes to url_status.jsonl, the failed ones included, which the sitemap leaves out
+	var statuses *StreamWriter
+	if err == nil {
+		statuses, err = CreateStream(statusFile, StreamJSONLines)
+	}
+	var extracted *StreamWriter // Created with the first record an extractor finds
+	var audited []SEOPage
+	var secured []SecurityPage
+	var scanned []string // The HTML pages for the accessibility scan
+	summary.Statuses = map[string]int{}
+	for result := range ch {
+		summary.Statuses[result.Status]++
+		urlStatusMetrics.Add(result.Status, 1)
+		if result.Error != "" {
+			summary.Errors++
+		}
+		if err == nil {
+			err = statuses.Write(CrawlResult{URL: result.URL, Status: result.Status, StatusCode: result.StatusCode, Error: result.Error})
+		}
+		if result.skipped {
+			events.Emit(CrawlEvent{Type: EventStored, URL: result.URL, Status: result.Status, Error: result.Error})
+			continue
+		}
+		summary.Pages++
+		summary.Items += len(result.Links)
+		if result.seo != nil {
+			audited = append(audited, *result.seo)
+		}
+		if result.StatusCode != 0 {
+			latencies.Add(result.URL, result.timing.firstByte, result.timing.total)
+		}
+		if result.security != nil {
+			secured = append(secured, *result.security)
+		}
+		if result.html && settings.A11y.Enabled {
+			scanned = append(scanned, result.URL)
+		}
+		endStore := tracer.Region("store", result.URL)
+		if err == nil && format == StreamJSONLines {
+			err = siteMap.Write(SiteMapEntry{URL: result.URL, Links: result.Links})
+		} else if err == nil {
+			err = siteMap.WriteEntry(result.URL, result.Links)
+		}
+		if err == nil && len(result.Records) > 0 && extracted == nil {
+			extractedFile := run.Path(outputFilename(settings.Output, "extracted.jsonl"))
+			if extracted, err = CreateStream(extractedFile, StreamJSONLines); err == nil {
+				summary.Outputs = append(summary.Outputs, extractedFile)
+			}
+		}
+		for _, record := range result.Records {
+			if err == nil {
+				err = extracted.Write(record)
+			}
+		}
+		endStore()
+		if err == nil {
+			events.Emit(CrawlEvent{Type: EventStored, URL: result.URL, Status: result.Status, Links: len(result.Links), Records: len(result.Records)})
+		}
+	}
+	if err := events.Close(); err != nil {
+		log.Println("Error writing the event log:", err)
+	} else if events != nil {
+		summary.Outputs = append(summary.Outputs, events.Path())
 	}
-	if err := CreateSiteMap(crawledURLs); err != nil {
+	if err == nil && extracted != nil {
+		err = extracted.Close()
+	} else if extracted != nil {
+		extracted.Abort()
+	}
+	if err == nil {
+		err = statuses.Close()
+	} else if statuses != nil {
+		statuses.Abort()
+	}
+	if err == nil {
+		err = siteMap.Close()
+	} else if siteMap != nil {
+		siteMap.Abort()
+	}
+	if err != nil {
 		log.Println("Error creating sitemap:", err)
+		summary.Event = EventFailed
+		summary.Error = err.Error()
+		summary.Errors++
+	} else {
+		log.Println("Sitemap created successfully.")
+	}
+	if ctx.Err() != nil && summary.Error == "" {
+		summary.Event = EventFailed
+		summary.Error = "crawl stopped: " + ctx.Err().Error()
+	}
+
+	if settings.SEOAudit.Enabled {
+		if err := writeSEOReport(settings.SEOAudit, run, audited); err != nil {
+			log.Println("Error writing the SEO audit:", err)
+		} else {
+			summary.Outputs = append(summary.Outputs, run.Path("seo_audit.json"))
+		}
+	}
+	if settings.SecurityAudit.Enabled {
+		if err := writeSecurityReport(run, secured); err != nil {
+			log.Println("Error writing the security audit:", err)
+		} else {
+			summary.Outputs = append(summary.Outputs, run.Path("security_audit.json"))
+		}
+	}
+	if settings.A11y.Enabled {
+		if err := writeA11yReport(ctx, settings.A11y, run, scanned); err != nil {
+			log.Println("Error writing the accessibility report:", err)
+		} else {
+			summary.Outputs = append(summary.Outputs, run.Path("a11y_report.json"))
+		}
+	}
+
+	summary.FinishedAt = time.Now()
+	summary.Blocked = DefaultCircuitBreaker.BlockedSince(summary.StartedAt)
+	for _, blocked := range summary.Blocked {
+		log.Printf("Domain %s was blocked by %s after %d challenge page(s)", blocked.Domain, blocked.Reason, blocked.Count)
+	}
+	summary.Traps = traps.Detections()
+	for domain, detections := range summary.Traps {
+		log.Printf("Skipped crawler traps on %s: %v", domain, detections)
+	}
+	endWatchdog()
+	summary.Certificates = certificates.Certificates()
+	summary.Latency = latencies.Domains()
+	saveLatency(summary)
+	if err := WriteCrawlReport(summary, run.Path("crawl_report.json")); err != nil {
+		log.Println("Error writing crawl report:", err)
 	}
+	endTrace(tracer, run)
+	runSpan.SetAttribute("crab.pages", summary.Pages)
+	endRunSpan(runSpan)
+	run.finishReported(&summary)
+	reportRun(settings, summary)
+	return summary
 }
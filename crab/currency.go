@@ -0,0 +1,243 @@
+package crab
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// baseCurrency is the currency the scraped prices are in.
+const baseCurrency = "USD"
+
+// rateCacheTTL is how long a rate fetched from an exchange-rate service is reused.
+const rateCacheTTL = time.Hour
+
+// ExchangeRate converts amounts in From into To as of Date.
+type ExchangeRate struct {
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Rate   float64   `json:"rate"`
+	Date   time.Time `json:"date"`
+	Source string    `json:"source"`
+}
+
+// RateSource looks up exchange rates.
+type RateSource interface {
+	Rate(from, to string) (ExchangeRate, error)
+}
+
+// StaticRates are fixed rates from the base currency, e.g. {"EUR": 0.92}, as published on Date.
+type StaticRates struct {
+	Rates map[string]float64
+	Date  time.Time
+}
+
+// Rate returns the configured rate from the base currency to to, or its inverse.
+func (s StaticRates) Rate(from, to string) (ExchangeRate, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	rate := ExchangeRate{From: from, To: to, Rate: 1, Date: s.Date, Source: "config"}
+	switch {
+	case from == to:
+	case from == baseCurrency && s.Rates[to] > 0:
+		rate.Rate = s.Rates[to]
+	case to == baseCurrency && s.Rates[from] > 0:
+		rate.Rate = 1 / s.Rates[from]
+	default:
+		return ExchangeRate{}, fmt.Errorf("no configured exchange rate from %s to %s", from, to)
+	}
+	return rate, nil
+}
+
+// HTTPRates fetches rates from a Frankfurter-style service: URL?from=USD&to=EUR answering
+// {"date": "2024-01-02", "rates": {"EUR": 0.91}}. Rates are cached for rateCacheTTL.
+type HTTPRates struct {
+	URL    string
+	Client *http.Client // http.DefaultClient when nil
+
+	mu    sync.Mutex
+	cache map[[2]string]cachedRate
+}
+
+type cachedRate struct {
+	rate    ExchangeRate
+	fetched time.Time
+}
+
+// Rate fetches the rate from from to to, or reuses one fetched within rateCacheTTL.
+func (h *HTTPRates) Rate(from, to string) (ExchangeRate, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return ExchangeRate{From: from, To: to, Rate: 1, Date: time.Now().UTC().Truncate(24 * time.Hour), Source: h.URL}, nil
+	}
+	key := [2]string{from, to}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if cached, ok := h.cache[key]; ok && time.Since(cached.fetched) < rateCacheTTL {
+		cacheMetrics.Add("exchange_rates.hits", 1)
+		return cached.rate, nil
+	}
+	cacheMetrics.Add("exchange_rates.misses", 1)
+
+	u, err := url.Parse(h.URL)
+	if err != nil {
+		return ExchangeRate{}, err
+	}
+	query := u.Query()
+	query.Set("from", from)
+	query.Set("to", to)
+	u.RawQuery = query.Encode()
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Get(u.String())
+	if err != nil {
+		return ExchangeRate{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return ExchangeRate{}, fmt.Errorf("exchange rate service %s returned %s", h.URL, res.Status)
+	}
+	var body struct {
+		Date  string             `json:"date"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return ExchangeRate{}, fmt.Errorf("reading exchange rates from %s: %w", h.URL, err)
+	}
+	if body.Rates[to] <= 0 {
+		return ExchangeRate{}, fmt.Errorf("exchange rate service %s has no rate from %s to %s", h.URL, from, to)
+	}
+	date, err := time.Parse("2006-01-02", body.Date)
+	if err != nil {
+		return ExchangeRate{}, fmt.Errorf("exchange rate service %s returned an invalid date %q", h.URL, body.Date)
+	}
+	rate := ExchangeRate{From: from, To: to, Rate: body.Rates[to], Date: date, Source: h.URL}
+	if h.cache == nil {
+		h.cache = map[[2]string]cachedRate{}
+	}
+	h.cache[key] = cachedRate{rate, time.Now()}
+	return rate, nil
+}
+
+// CurrencyConfig sets where exchange rates come from: the service at RatesURL, or else the fixed Rates
+// from USD published on Date (YYYY-MM-DD). PriceColumns overrides which columns of each dataset hold
+// dollar amounts.
+type CurrencyConfig struct {
+	RatesURL     string              `json:"rates_url"`
+	Rates        map[string]float64  `json:"rates"`
+	Date         string              `json:"date"`
+	PriceColumns map[string][]string `json:"price_columns"`
+}
+
+// defaultPriceColumns are the dollar-denominated columns of the scraped datasets.
+var defaultPriceColumns = map[string][]string{
+	"gasoline": {"average_gasoline_prices", "gas_prices_adjusted_for_inflation"},
+	"housing":  {"price"},
+}
+
+// httpRates keeps the HTTPRates of the configured service, so its cache outlives one conversion.
+var httpRates struct {
+	sync.Mutex
+	source *HTTPRates
+}
+
+// Source returns the configured rate source.
+func (c CurrencyConfig) Source() (RateSource, error) {
+	if c.RatesURL != "" {
+		httpRates.Lock()
+		defer httpRates.Unlock()
+		if httpRates.source == nil || httpRates.source.URL != c.RatesURL {
+			httpRates.source = &HTTPRates{URL: c.RatesURL}
+		}
+		return httpRates.source, nil
+	}
+	if len(c.Rates) == 0 {
+		return nil, fmt.Errorf("no exchange rates configured")
+	}
+	rates := StaticRates{Rates: map[string]float64{}}
+	for currency, rate := range c.Rates {
+		rates.Rates[strings.ToUpper(currency)] = rate
+	}
+	if c.Date != "" {
+		date, err := time.Parse("2006-01-02", c.Date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exchange rate date %q", c.Date)
+		}
+		rates.Date = date
+	}
+	return rates, nil
+}
+
+// PriceColumnsOf returns the dollar-denominated columns of the named dataset.
+func (c CurrencyConfig) PriceColumnsOf(dataset string) []string {
+	if columns, ok := c.PriceColumns[dataset]; ok {
+		return columns
+	}
+	return defaultPriceColumns[dataset]
+}
+
+// ConvertDataset returns a copy of ds with the amounts in columns converted at rate. Every row gains
+// "currency", "exchange_rate" and "rate_date" columns recording the conversion. Cells that are not
+// numbers are left as they are.
+func ConvertDataset(ds Dataset, columns []string, rate ExchangeRate) Dataset {
+	convert := map[int]bool{}
+	for i, column := range ds.Columns {
+		for _, name := range columns {
+			if strings.EqualFold(column, name) {
+				convert[i] = true
+			}
+		}
+	}
+	converted := ds
+	converted.Columns = append(append([]string(nil), ds.Columns...), "currency", "exchange_rate", "rate_date")
+	converted.Rows = make([][]string, len(ds.Rows))
+	rateText := strconv.FormatFloat(rate.Rate, 'f', -1, 64)
+	date := ""
+	if !rate.Date.IsZero() {
+		date = rate.Date.Format("2006-01-02")
+	}
+	for i, row := range ds.Rows {
+		out := append(make([]string, 0, len(row)+3), row...)
+		for j := range out {
+			if !convert[j] || strings.TrimSpace(out[j]) == "" {
+				continue
+			}
+			if number, err := ParseNumber(out[j], NumberFormat{}); err == nil {
+				out[j] = strconv.FormatFloat(roundCents(number.Value*rate.Rate), 'f', -1, 64)
+			}
+		}
+		converted.Rows[i] = append(out, rate.To, rateText, date)
+	}
+	return converted
+}
+
+// roundCents rounds an amount to two decimals.
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// ConvertScrapedDataset converts the named dataset from dollars into currency with the configured rate
+// source and price columns.
+func ConvertScrapedDataset(ds Dataset, currency string) (Dataset, error) {
+	config := CurrentConfig().Currency
+	columns := config.PriceColumnsOf(ds.Name)
+	if len(columns) == 0 {
+		return Dataset{}, fmt.Errorf("the %s dataset has no prices to convert", ds.Name)
+	}
+	source, err := config.Source()
+	if err != nil {
+		return Dataset{}, err
+	}
+	rate, err := source.Rate(baseCurrency, currency)
+	if err != nil {
+		return Dataset{}, err
+	}
+	return ConvertDataset(ds, columns, rate), nil
+}
@@ -0,0 +1,436 @@
+package crab
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DaemonConfig sets up the service mode of "crab serve", which runs the job queue behind an HTTP server
+// for containers and process supervisors.
+type DaemonConfig struct {
+	Addr            string `json:"addr"`             // defaultDaemonAddr when empty
+	Workers         int    `json:"workers"`          // Jobs run at once; defaultDaemonWorkers when zero
+	ShutdownTimeout string `json:"shutdown_timeout"` // How long running jobs get to finish on SIGTERM; defaultShutdownTimeout when empty
+}
+
+const (
+	defaultDaemonAddr      = ":8080"
+	defaultDaemonWorkers   = 2
+	defaultShutdownTimeout = 30 * time.Second
+)
+
+// Daemon serves the job queue with liveness and metrics endpoints:
+//
+//	GET  /healthz               200 while serving, 503 once shutting down
+//	GET  /metrics               every expvar metric in the Prometheus text format
+//	GET  /openapi.json          the OpenAPI spec of the endpoints below (see Routes)
+//	GET  /jobs                  the job history; POST {"type", "params"} queues a job, once per Idempotency-Key
+//	GET  /jobs/{id}             a job; DELETE cancels it
+//	GET  /api/datasets          the stored datasets
+//	GET  /api/datasets/{name}   a dataset as of the run parameter, filtered and paged (see ServeDataset)
+//	GET  /api/links             the pages linking to a URL, orphan pages or deep pages of a crawl (see LinkQuery)
+//	POST /graphql               a GraphQL query over the datasets and runs (see GraphQLSchema)
+//	GET  /api/admin/debug       the frontier, queues and workers of the crawls in progress (see DebugState)
+//	GET  /debug/pprof/{name}    the runtime profiles, for go tool pprof (see ProfileHandler)
+//
+// The jobs, datasets, links and GraphQL endpoints take the API keys and tokens of the config's API settings;
+// the debugging endpoints need the admin role, and answer 403 until API keys or a JWT secret are set.
+type Daemon struct {
+	config    DaemonConfig
+	queue     *JobQueue
+	auth      *APIAuth
+	startedAt time.Time
+	stopping  atomic.Bool
+}
+
+// NewDaemon creates a daemon running queue's jobs.
+func NewDaemon(config DaemonConfig, queue *JobQueue) *Daemon {
+	if config.Addr == "" {
+		config.Addr = defaultDaemonAddr
+	}
+	if config.Workers <= 0 {
+		config.Workers = defaultDaemonWorkers
+	}
+	return &Daemon{config: config, queue: queue, auth: &APIAuth{}, startedAt: time.Now()}
+}
+
+// PrepareDaemonConfig fills in what a service run needs of config: its outputs, checkpoints and other
+// files go under dataDir when no output directory is set, as the working directory of a container may not
+// be writable or kept.
+func PrepareDaemonConfig(config Config, dataDir string) Config {
+	if config.Output.Dir == "" {
+		if dataDir == "" {
+			dataDir = filepath.Join(os.TempDir(), "crab")
+		}
+		config.Output.Dir = dataDir
+	}
+	return config
+}
+
+// Handler returns the daemon's HTTP endpoints, those of Routes.
+func (d *Daemon) Handler() http.Handler {
+	mux := http.NewServeMux()
+	var patterns []string
+	byPattern := map[string][]Route{}
+	for _, route := range d.Routes() {
+		pattern := routePattern(route.Path)
+		if byPattern[pattern] == nil {
+			patterns = append(patterns, pattern)
+		}
+		byPattern[pattern] = append(byPattern[pattern], route)
+	}
+	for _, pattern := range patterns {
+		mux.HandleFunc(pattern, d.serveRoutes(byPattern[pattern]))
+	}
+	return mux
+}
+
+// Routes returns the operations of the daemon's REST API. The handler serves them, and the OpenAPI spec
+// and the client of package crab/client are generated from them.
+func (d *Daemon) Routes() []Route {
+	datasetQuery := []RouteParam{
+		{Name: "run", Type: "string", Description: "the run to read the dataset as of; the latest when empty"},
+		{Name: "from", Type: "integer", Description: "the first year of the rows"},
+		{Name: "to", Type: "integer", Description: "the last year of the rows"},
+		{Name: "columns", Type: "array", Description: "the columns to return; all when empty"},
+		{Name: "limit", Type: "integer", Description: "the rows of a page; all when zero"},
+		{Name: "offset", Type: "integer", Description: "the row the page starts at"},
+		{Name: "format", Type: "string", Description: "json or csv, over the Accept header"},
+	}
+	linkQuery := []RouteParam{
+		{Name: "query", Type: "string", Description: "inlinks, orphans or deeper"},
+		{Name: "url", Type: "string", Description: "the page whose inlinks to return"},
+		{Name: "depth", Type: "integer", Description: "the clicks from a seed deeper pages are past"},
+		{Name: "prefix", Type: "string", Description: "return only the pages starting with it"},
+		{Name: "run", Type: "string", Description: "the crawl run as of which to query; the latest when empty"},
+		{Name: "limit", Type: "integer", Description: "the pages of a result page; all when zero"},
+		{Name: "offset", Type: "integer", Description: "the page the result page starts at"},
+	}
+	latencyQuery := []RouteParam{
+		{Name: "domain", Type: "string", Description: "the domain whose latency to return; every domain when empty"},
+		{Name: "from", Type: "string", Description: "the RFC 3339 time or date the runs started at or after"},
+		{Name: "to", Type: "string", Description: "the RFC 3339 time or date the runs started at or before"},
+	}
+	metricQuery := []RouteParam{
+		{Name: "kind", Type: "string", Description: "crawl or scrape; both when empty"},
+		{Name: "name", Type: "string", Description: "the domain or job name of the runs; every one when empty"},
+		{Name: "metric", Type: "string", Description: "the metric, e.g. pages, errors, fetch_p95_ms or dataset_rows; every one when empty"},
+		{Name: "label", Type: "string", Description: "the domain or dataset of the metric; every one when empty"},
+		{Name: "from", Type: "string", Description: "the RFC 3339 time or date the runs started at or after"},
+		{Name: "to", Type: "string", Description: "the RFC 3339 time or date the runs started at or before"},
+	}
+	alertQuery := []RouteParam{
+		{Name: "job", Type: "string", Description: "the crawled domain, scraper or dataset whose alerts to return; every one when empty"},
+		{Name: "since", Type: "string", Description: "the RFC 3339 time or date the alerts fired at or after"},
+	}
+	profileQuery := []RouteParam{
+		{Name: "seconds", Type: "integer", Description: "how long the CPU profile or execution trace runs; 30 when zero"},
+		{Name: "debug", Type: "integer", Description: "1 or 2 for a named profile in text rather than for go tool pprof"},
+		{Name: "gc", Type: "integer", Description: "1 to collect garbage before taking the heap profile"},
+	}
+	graphQLQuery := []RouteParam{
+		{Name: "query", Type: "string", Description: "the GraphQL query"},
+		{Name: "variables", Type: "string", Description: "the variables of the query as a JSON object"},
+		{Name: "operationName", Type: "string", Description: "the query to run of a document with several"},
+	}
+	return []Route{
+		{Method: http.MethodGet, Path: "/healthz", Operation: "Health", Summary: "reports whether the daemon is up",
+			Response: DaemonHealth{}, Errors: []int{http.StatusServiceUnavailable}, handler: d.healthz},
+		{Method: http.MethodGet, Path: "/metrics", Operation: "Metrics", Summary: "returns every expvar metric in the Prometheus text format",
+			Produces: []string{"text/plain"}, handler: metricsHandler},
+		{Method: http.MethodGet, Path: "/openapi.json", Operation: "OpenAPI", Summary: "returns the OpenAPI spec of the API",
+			Response: OpenAPIDocument{}, handler: d.openAPI},
+		{Method: http.MethodGet, Path: "/jobs", Operation: "ListJobs", Summary: "lists the job history", Role: RoleViewer,
+			Response: []Job{}, handler: d.jobs},
+		{Method: http.MethodPost, Path: "/jobs", Operation: "CreateJob", Summary: "queues a job", Role: RoleOperator,
+			Request: JobRequest{}, Response: Job{}, Status: http.StatusAccepted, Idempotent: true,
+			Errors: []int{http.StatusBadRequest, http.StatusServiceUnavailable}, handler: d.jobs},
+		{Method: http.MethodGet, Path: "/jobs/{id}", Operation: "GetJob", Summary: "returns a job", Role: RoleViewer,
+			Response: Job{}, Errors: []int{http.StatusNotFound}, handler: d.job},
+		{Method: http.MethodDelete, Path: "/jobs/{id}", Operation: "CancelJob", Summary: "cancels a job", Role: RoleOperator,
+			Status: http.StatusNoContent, Errors: []int{http.StatusBadRequest}, handler: d.job},
+		{Method: http.MethodGet, Path: "/api/datasets", Operation: "ListDatasets", Summary: "lists the stored datasets", Role: RoleViewer,
+			Response: []DatasetInfo{}, handler: d.datasets},
+		{Method: http.MethodGet, Path: "/api/datasets/{name}", Operation: "GetDataset", Summary: "returns a dataset as of a run, filtered and paged",
+			Role: RoleViewer, Query: datasetQuery, Response: Dataset{}, Produces: []string{"application/json", "text/csv"},
+			Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusNotAcceptable}, handler: d.datasets},
+		{Method: http.MethodGet, Path: "/api/links", Operation: "QueryLinks", Summary: "queries the link graph of a crawl run",
+			Role: RoleViewer, Query: linkQuery, Response: LinkQueryResult{}, Errors: []int{http.StatusBadRequest, http.StatusNotFound}, handler: d.links},
+		{Method: http.MethodGet, Path: "/api/latency", Operation: "GetLatency", Summary: "returns the response time percentiles of the crawled domains over the crawl runs",
+			Role: RoleViewer, Query: latencyQuery, Response: []LatencySample{}, Errors: []int{http.StatusBadRequest}, handler: LatencyHandler},
+		{Method: http.MethodGet, Path: "/api/metrics/runs", Operation: "ListRunMetrics", Summary: "returns the metrics of the runs, oldest run first",
+			Role: RoleViewer, Query: metricQuery, Response: []RunMetric{}, Errors: []int{http.StatusBadRequest}, handler: RunMetricsHandler},
+		{Method: http.MethodGet, Path: "/api/metrics/chart", Operation: "ChartRunMetric", Summary: "charts the trend of a metric of the runs",
+			Role: RoleViewer, Query: metricQuery, Produces: []string{"image/png"}, Errors: []int{http.StatusBadRequest}, handler: RunMetricsChartHandler},
+		{Method: http.MethodGet, Path: "/api/alerts", Operation: "ListAlerts", Summary: "returns the history of the alerts fired by the runs, oldest first",
+			Role: RoleViewer, Query: alertQuery, Response: []Alert{}, Errors: []int{http.StatusBadRequest}, handler: AlertsHandler},
+		{Method: http.MethodGet, Path: "/api/admin/debug", Operation: "GetDebugState", Summary: "returns the frontier, queues and workers of the crawls in progress and the hit rates of the caches",
+			Role: RoleAdmin, Response: DebugState{}, handler: requireAPIAuth(d.debugState)},
+		{Method: http.MethodGet, Path: "/debug/pprof/{profile}", Operation: "GetProfile", Summary: "returns a runtime profile for go tool pprof, or the list of profiles",
+			Role: RoleAdmin, Query: profileQuery, Produces: []string{"application/octet-stream", "text/plain"},
+			Errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}, handler: requireAPIAuth(ProfileHandler)},
+		{Method: http.MethodGet, Path: "/graphql", Operation: "QueryGraphQL", Summary: "runs a GraphQL query given in the URL",
+			Role: RoleViewer, Query: graphQLQuery, Response: GraphQLResponse{}, Errors: []int{http.StatusBadRequest}, handler: GraphQLHandler},
+		{Method: http.MethodPost, Path: "/graphql", Operation: "GraphQL", Summary: "runs a GraphQL query over the datasets, runs and predictions",
+			Role: RoleViewer, Request: GraphQLRequest{}, Response: GraphQLResponse{}, Errors: []int{http.StatusBadRequest, http.StatusRequestEntityTooLarge}, handler: GraphQLHandler},
+	}
+}
+
+// Run serves until ctx is done, then shuts down gracefully: the health check starts failing, the server
+// stops taking requests, and running jobs get the shutdown timeout to finish before they are cancelled.
+func (d *Daemon) Run(ctx context.Context) error {
+	timeout := defaultShutdownTimeout
+	if d.config.ShutdownTimeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(d.config.ShutdownTimeout); err != nil {
+			return fmt.Errorf("daemon shutdown_timeout: %w", err)
+		}
+	}
+	listener, err := net.Listen("tcp", d.config.Addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: d.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	queueCtx, stopQueue := context.WithCancel(context.Background())
+	defer stopQueue()
+	d.queue.Start(queueCtx, d.config.Workers)
+
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+	log.Printf("Serving on %s with %d workers", listener.Addr(), d.config.Workers)
+	select {
+	case err = <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, waiting up to %s for running jobs", timeout)
+	d.stopping.Store(true)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down the server: %v", err)
+	}
+	if err := d.queue.Drain(shutdownCtx); err != nil {
+		log.Printf("Cancelled the jobs still running after %s", timeout)
+	}
+	stopQueue()
+	d.queue.Wait()
+	log.Println("Shut down")
+	return nil
+}
+
+// DaemonHealth is the response of the daemon's health check.
+type DaemonHealth struct {
+	Status        string           `json:"status"` // "ok", or "shutting down"
+	UptimeSeconds int              `json:"uptime_seconds"`
+	Jobs          map[JobState]int `json:"jobs,omitempty"` // The number of jobs in each state
+}
+
+// healthz reports whether the daemon is up.
+func (d *Daemon) healthz(w http.ResponseWriter, r *http.Request) {
+	health, code := DaemonHealth{Status: "ok", UptimeSeconds: int(time.Since(d.startedAt).Seconds())}, http.StatusOK
+	if d.stopping.Load() {
+		health.Status, code = "shutting down", http.StatusServiceUnavailable
+	}
+	if jobs, err := d.queue.List(); err == nil {
+		health.Jobs = map[JobState]int{}
+		for _, job := range jobs {
+			health.Jobs[job.State]++
+		}
+	}
+	writeJSONResponse(w, code, health)
+}
+
+// debugState reports the debug state of the process with the jobs of the queue.
+func (d *Daemon) debugState(w http.ResponseWriter, r *http.Request) {
+	state := CurrentDebugState()
+	if jobs, err := d.queue.List(); err == nil {
+		state.Jobs = map[JobState]int{}
+		for _, job := range jobs {
+			state.Jobs[job.State]++
+		}
+	}
+	writeJSONResponse(w, http.StatusOK, state)
+}
+
+// openAPI serves the OpenAPI spec of the daemon's routes.
+func (d *Daemon) openAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, http.StatusOK, OpenAPISpec(d.Routes()))
+}
+
+// JobRequest is the body of a request queueing a job.
+type JobRequest struct {
+	Type   string            `json:"type"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// jobs lists the jobs or queues one.
+func (d *Daemon) jobs(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		jobs, err := d.queue.List()
+		if err != nil {
+			log.Printf("Error listing jobs: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, jobs)
+	case http.MethodPost:
+		if d.stopping.Load() {
+			http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		// A retry with the key of a queued job gets that job rather than queueing another
+		body, claim, previous, err := ClaimIdempotency(r, "POST /jobs")
+		if err != nil {
+			WriteIdempotencyError(w, err)
+			return
+		}
+		if previous != nil {
+			job, err := d.queue.Get(previous.ResourceID)
+			if err != nil {
+				http.Error(w, "Job not found", http.StatusNotFound)
+				return
+			}
+			WriteIdempotentReplay(w, previous, job)
+			return
+		}
+		var request JobRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			claim.Release()
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		job, err := d.queue.Enqueue(request.Type, request.Params)
+		if err != nil {
+			claim.Release()
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := claim.Complete(job.ID, http.StatusAccepted); err != nil {
+			log.Printf("Error recording the idempotency key of job %s: %v", job.ID, err)
+		}
+		writeJSONResponse(w, http.StatusAccepted, job)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// job returns or cancels a job.
+func (d *Daemon) job(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	switch r.Method {
+	case http.MethodGet:
+		job, err := d.queue.Get(id)
+		if err != nil {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, job)
+	case http.MethodDelete:
+		if err := d.queue.Cancel(id); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// datasets lists the stored datasets or serves one of them.
+func (d *Daemon) datasets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dir := CurrentConfig().Output.Dir
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/datasets"), "/")
+	if name == "" {
+		datasets, err := ListDatasets(dir)
+		if err != nil {
+			log.Printf("Error listing datasets: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeJSONResponse(w, http.StatusOK, datasets)
+		return
+	}
+	ds, err := LoadDatasetAsOf(dir, name, r.URL.Query().Get("run"))
+	if err != nil {
+		http.Error(w, "Dataset not found", http.StatusNotFound)
+		return
+	}
+	ServeDataset(w, r, ds)
+}
+
+// links answers a query of the link graph of a crawl run.
+func (d *Daemon) links(w http.ResponseWriter, r *http.Request) {
+	q, err := ParseLinkQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	graph, err := LoadLinkGraph(CurrentConfig().Output.Dir, r.URL.Query().Get("run"))
+	if err != nil {
+		http.Error(w, "No crawl found: "+err.Error(), http.StatusNotFound)
+		return
+	}
+	result, err := graph.Query(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(result.Total))
+	writeJSONResponse(w, http.StatusOK, result)
+}
+
+// writeJSONResponse writes v as the JSON body of a response with status code.
+func writeJSONResponse(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+// metricNameChars are replaced in Prometheus metric names.
+var metricNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// metricsHandler writes the numeric expvar metrics in the Prometheus text format. An integer or float
+// variable is a gauge of its name, and a map a gauge with a "key" label per entry; other variables, such
+// as memstats and cmdline, are left out.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	expvar.Do(func(kv expvar.KeyValue) {
+		name := metricNameChars.ReplaceAllString(kv.Key, "_")
+		switch v := kv.Value.(type) {
+		case *expvar.Int, *expvar.Float:
+			fmt.Fprintf(w, "# TYPE %s gauge\n%s %s\n", name, name, v.String())
+		case *expvar.Map:
+			var samples []string
+			v.Do(func(entry expvar.KeyValue) {
+				switch entry.Value.(type) {
+				case *expvar.Int, *expvar.Float:
+					samples = append(samples, fmt.Sprintf("%s{key=%q} %s\n", name, entry.Key, entry.Value.String()))
+				}
+			})
+			if len(samples) > 0 {
+				fmt.Fprintf(w, "# TYPE %s gauge\n%s", name, strings.Join(samples, ""))
+			}
+		}
+	})
+}
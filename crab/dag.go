@@ -0,0 +1,394 @@
+package crab
+
+import (
+	"cmpscfa23team2/records"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Workflow run statuses.
+const (
+	WorkflowRunning   = "running"
+	WorkflowSucceeded = "succeeded"
+	WorkflowFailed    = "failed"
+)
+
+// The state of workflow runs a WorkflowStore keeps.
+type (
+	WorkflowRecord = records.WorkflowRecord
+	StageOutput    = records.StageOutput
+)
+
+// WorkflowStore persists workflow runs. The dal package provides a MySQL backed implementation.
+type WorkflowStore interface {
+	SaveWorkflowRun(record WorkflowRecord) error
+	LoadWorkflowRun(runID string) (WorkflowRecord, error)
+}
+
+var (
+	workflowStoreMu sync.RWMutex
+	workflowStore   WorkflowStore
+)
+
+// SetWorkflowStore sets where workflow runs are persisted. Passing nil keeps them in memory only, so
+// failed runs cannot be resumed.
+func SetWorkflowStore(store WorkflowStore) {
+	workflowStoreMu.Lock()
+	defer workflowStoreMu.Unlock()
+	workflowStore = store
+}
+
+// currentWorkflowStore returns the store set with SetWorkflowStore, or nil.
+func currentWorkflowStore() WorkflowStore {
+	workflowStoreMu.RLock()
+	defer workflowStoreMu.RUnlock()
+	return workflowStore
+}
+
+// RunWorkflow runs the named workflow of the configuration. It returns the run, holding the result of
+// each stage that finished and the state the last stage of the workflow left, and an error if a stage
+// stopped the workflow. The workflow is checked before any stage runs.
+func RunWorkflow(ctx context.Context, name string) (WorkflowRun, error) {
+	now := time.Now().UTC()
+	record := WorkflowRecord{RunID: NewRunID(now), Workflow: name, StartedAt: now, UpdatedAt: now, Outputs: map[string]StageOutput{}}
+	return executeWorkflow(ctx, &record)
+}
+
+// ResumeWorkflow runs the stages of a failed workflow run that did not succeed, with the workflow's
+// current configuration, starting from the state the others left. It needs a WorkflowStore.
+func ResumeWorkflow(ctx context.Context, runID string) (WorkflowRun, error) {
+	store := currentWorkflowStore()
+	if store == nil {
+		return WorkflowRun{RunID: runID}, fmt.Errorf("workflow runs are not persisted, run %s cannot be resumed", runID)
+	}
+	record, err := store.LoadWorkflowRun(runID)
+	if err != nil {
+		return WorkflowRun{RunID: runID}, err
+	}
+	if record.Status == WorkflowSucceeded {
+		return WorkflowRun{RunID: runID, Workflow: record.Workflow}, fmt.Errorf("run %s of workflow %s already succeeded", runID, record.Workflow)
+	}
+	if record.Outputs == nil {
+		record.Outputs = map[string]StageOutput{}
+	}
+	log.Printf("Resuming run %s of workflow %s after %d stages", runID, record.Workflow, len(record.Outputs))
+	return executeWorkflow(ctx, &record)
+}
+
+// stageNeeds returns the names of the stages the i-th stage of config waits for.
+func stageNeeds(config WorkflowConfig, i int) []string {
+	if needs := config.Stages[i].Needs; needs != nil {
+		return needs
+	}
+	if i == 0 {
+		return nil
+	}
+	return []string{config.Stages[i-1].name()}
+}
+
+// validateWorkflow checks the stages of a workflow: known types and error handling, valid timeouts, unique
+// names, and needs that name other stages without a cycle.
+func validateWorkflow(name string, config WorkflowConfig) error {
+	if len(config.Stages) == 0 {
+		return fmt.Errorf("workflow %s has no stages", name)
+	}
+	index := map[string]int{}
+	for i, stage := range config.Stages {
+		if _, ok := workflowStage(stage.Type); !ok {
+			return fmt.Errorf("workflow %s: unknown stage type %q", name, stage.Type)
+		}
+		switch stage.OnError {
+		case "", "fail", "skip", "retry":
+		default:
+			return fmt.Errorf("workflow %s: stage %s: unknown on_error %q", name, stage.name(), stage.OnError)
+		}
+		if stage.Timeout != "" {
+			if timeout, err := time.ParseDuration(stage.Timeout); err != nil || timeout <= 0 {
+				return fmt.Errorf("workflow %s: stage %s: invalid timeout %q", name, stage.name(), stage.Timeout)
+			}
+		}
+		if _, ok := index[stage.name()]; ok {
+			return fmt.Errorf("workflow %s: two stages are named %s", name, stage.name())
+		}
+		index[stage.name()] = i
+	}
+
+	// Depth-first search for a cycle: a stage reached again while its own needs are being visited
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(config.Stages))
+	var visit func(i int, path []string) error
+	visit = func(i int, path []string) error {
+		path = append(path, config.Stages[i].name())
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("workflow %s: stages need each other: %s", name, strings.Join(path, " -> "))
+		case visited:
+			return nil
+		}
+		state[i] = visiting
+		for _, need := range stageNeeds(config, i) {
+			j, ok := index[need]
+			if !ok {
+				return fmt.Errorf("workflow %s: stage %s needs unknown stage %q", name, config.Stages[i].name(), need)
+			}
+			if err := visit(j, path); err != nil {
+				return err
+			}
+		}
+		state[i] = visited
+		return nil
+	}
+	for i := range config.Stages {
+		if err := visit(i, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stageDone is a finished stage, reported by the goroutine that ran it.
+type stageDone struct {
+	name   string
+	result StageResult
+	output StageOutput
+}
+
+// executeWorkflow runs the stages of record's workflow that have no output yet, each as soon as the
+// stages it needs have, and persists record after every stage. After a stage fails no other starts, but
+// those running are waited for.
+func executeWorkflow(ctx context.Context, record *WorkflowRecord) (WorkflowRun, error) {
+	config, ok := CurrentConfig().Workflows[record.Workflow]
+	if !ok {
+		return WorkflowRun{RunID: record.RunID, Workflow: record.Workflow}, fmt.Errorf("unknown workflow %q", record.Workflow)
+	}
+	if err := validateWorkflow(record.Workflow, config); err != nil {
+		return WorkflowRun{RunID: record.RunID, Workflow: record.Workflow}, err
+	}
+
+	// Results of the stages that did not succeed are dropped, as they are run again
+	pending := map[string]bool{}
+	for _, stage := range config.Stages {
+		if _, done := record.Outputs[stage.name()]; !done {
+			pending[stage.name()] = true
+		}
+	}
+	var kept []StageResult
+	for _, result := range record.Stages {
+		if !pending[result.Name] {
+			kept = append(kept, result)
+		}
+	}
+	record.Stages, record.Status, record.Error = kept, WorkflowRunning, ""
+	saveWorkflowRecord(record)
+
+	done := make(chan stageDone)
+	running := 0
+	var failure error
+	for {
+		if failure == nil && ctx.Err() == nil {
+			for i, stage := range config.Stages {
+				if !pending[stage.name()] || !needsMet(record, stageNeeds(config, i)) {
+					continue
+				}
+				delete(pending, stage.name())
+				running++
+				input := stageInput(record, config, stageNeeds(config, i))
+				go func(stage WorkflowStage) {
+					result, output := runWorkflowStage(ctx, input, stage)
+					done <- stageDone{stage.name(), result, output}
+				}(stage)
+			}
+		}
+		if running == 0 {
+			break
+		}
+
+		finished := <-done
+		running--
+		log.Printf("Workflow %s stage %s %s after %d attempts, %d rows", record.Workflow, finished.name,
+			finished.result.Status, finished.result.Attempts, finished.result.Rows)
+		record.Stages = append(record.Stages, finished.result)
+		if finished.result.Status == "failed" {
+			if failure == nil {
+				failure = fmt.Errorf("workflow %s: stage %s: %s", record.Workflow, finished.name, finished.result.Error)
+			}
+		} else {
+			record.Outputs[finished.name] = finished.output
+		}
+		record.UpdatedAt = time.Now().UTC()
+		saveWorkflowRecord(record)
+	}
+	if failure == nil && len(pending) > 0 {
+		if failure = ctx.Err(); failure == nil {
+			failure = fmt.Errorf("workflow %s: %d stages could not run", record.Workflow, len(pending))
+		}
+	}
+
+	record.Status = WorkflowSucceeded
+	if failure != nil {
+		record.Status, record.Error = WorkflowFailed, failure.Error()
+	}
+	record.UpdatedAt = time.Now().UTC()
+	saveWorkflowRecord(record)
+
+	// The run ends in the state of the workflow's last stage, or the latest one that got that far
+	var last []string
+	for i := len(config.Stages) - 1; i >= 0 && last == nil; i-- {
+		if _, ok := record.Outputs[config.Stages[i].name()]; ok {
+			last = []string{config.Stages[i].name()}
+		}
+	}
+	return stageInput(record, config, last), failure
+}
+
+// needsMet reports whether every stage of needs has handed on its output.
+func needsMet(record *WorkflowRecord, needs []string) bool {
+	for _, need := range needs {
+		if _, ok := record.Outputs[need]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// stageInput builds the run a stage starts from: the dataset and features of the first stage it needs,
+// the values and data of all of them, later ones winning, and the results of the stages finished so far
+// in the order of the workflow.
+func stageInput(record *WorkflowRecord, config WorkflowConfig, needs []string) WorkflowRun {
+	run := WorkflowRun{RunID: record.RunID, Workflow: record.Workflow, Dataset: Dataset{Name: config.Dataset},
+		Values: map[string]string{}, Data: map[string]json.RawMessage{}}
+	for i, need := range needs {
+		output := record.Outputs[need]
+		if i == 0 {
+			run.Dataset, run.Features = output.Dataset, append([]string(nil), output.Features...)
+		}
+		for k, v := range output.Values {
+			run.Values[k] = v
+		}
+		for k, v := range output.Data {
+			run.Data[k] = v
+		}
+	}
+	for _, stage := range config.Stages {
+		for _, result := range record.Stages {
+			if result.Name == stage.name() {
+				run.Stages = append(run.Stages, result)
+			}
+		}
+	}
+	return run
+}
+
+// runWorkflowStage runs one stage on a copy of input, retrying it and timing it out as configured, and
+// returns how it went and the state it hands on: what it left when it succeeded, its input when skipped.
+func runWorkflowStage(ctx context.Context, input WorkflowRun, stage WorkflowStage) (StageResult, StageOutput) {
+	fn, _ := workflowStage(stage.Type)
+	result := StageResult{Name: stage.name(), Type: stage.Type}
+	start := time.Now()
+	attempts := 1
+	if stage.OnError == "retry" {
+		attempts += defaultStageRetries
+		if stage.Retries > 0 {
+			attempts = 1 + stage.Retries
+		}
+	}
+	timeout, _ := time.ParseDuration(stage.Timeout)
+	delay := workflowRetryDelay
+
+	var run WorkflowRun
+	var err error
+retries:
+	for {
+		result.Attempts++
+		run = input.copy()
+		if err = ctx.Err(); err == nil {
+			err = runStageAttempt(ctx, fn, &run, stage.Params, timeout)
+		}
+		if err == nil || result.Attempts >= attempts {
+			break
+		}
+		log.Printf("Retrying workflow %s stage %s in %s: %v", input.Workflow, result.Name, delay, err)
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+			err = ctx.Err()
+			break retries
+		}
+	}
+
+	result.Duration = time.Since(start)
+	switch {
+	case err == nil:
+		result.Status = "succeeded"
+	case stage.OnError == "skip":
+		result.Status, result.Error = "skipped", err.Error()
+		run = input
+	default:
+		result.Status, result.Error = "failed", err.Error()
+		run = input
+	}
+	result.Rows = len(run.Dataset.Rows)
+	return result, StageOutput{Dataset: run.Dataset, Features: run.Features, Values: run.Values, Data: run.Data}
+}
+
+// runStageAttempt runs fn once, giving up after timeout if it is not zero. A stage that ignores its
+// context and overruns is abandoned to finish on its own, on its own copy of the run.
+func runStageAttempt(ctx context.Context, fn WorkflowStageFunc, run *WorkflowRun, params map[string]string, timeout time.Duration) error {
+	if timeout <= 0 {
+		return fn(ctx, run, params)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	attempt := run.copy()
+	errc := make(chan error, 1)
+	go func() { errc <- fn(ctx, &attempt, params) }()
+	select {
+	case err := <-errc:
+		if err == nil {
+			*run = attempt
+		}
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+}
+
+// copy copies the parts of the run a stage may change, so stages never share them.
+func (run WorkflowRun) copy() WorkflowRun {
+	copied := run
+	copied.Features = append([]string(nil), run.Features...)
+	copied.Values = make(map[string]string, len(run.Values))
+	for k, v := range run.Values {
+		copied.Values[k] = v
+	}
+	copied.Data = make(map[string]json.RawMessage, len(run.Data))
+	for k, v := range run.Data {
+		copied.Data[k] = v
+	}
+	copied.Stages = append([]StageResult(nil), run.Stages...)
+	copied.Dataset.Columns = append([]string(nil), run.Dataset.Columns...)
+	copied.Dataset.Rows = append([][]string(nil), run.Dataset.Rows...)
+	return copied
+}
+
+// saveWorkflowRecord persists the run, if workflow runs are persisted. A run that cannot be saved still
+// goes on, it just cannot be resumed.
+func saveWorkflowRecord(record *WorkflowRecord) {
+	store := currentWorkflowStore()
+	if store == nil {
+		return
+	}
+	if err := store.SaveWorkflowRun(*record); err != nil {
+		log.Printf("Error saving run %s of workflow %s: %v", record.RunID, record.Workflow, err)
+	}
+}
@@ -0,0 +1,204 @@
+package crab
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxDatasetPageSize caps the rows of one page of a dataset served over HTTP.
+const maxDatasetPageSize = 10000
+
+// DatasetInfo describes the latest version of a stored dataset, as listed by GET /api/datasets.
+type DatasetInfo struct {
+	Name    string   `json:"name"`
+	RunID   string   `json:"run_id"`
+	Columns []string `json:"columns"`
+	Rows    int      `json:"rows"`
+	URL     string   `json:"url"`
+}
+
+// ListDatasets describes the latest version of every scraped dataset stored in dir. Datasets no run has
+// produced yet are left out.
+func ListDatasets(dir string) ([]DatasetInfo, error) {
+	datasets := []DatasetInfo{}
+	for _, source := range scrapedDatasetFiles {
+		if _, _, err := findDatasetRun(dir, source.Name, ""); err != nil {
+			continue
+		}
+		ds, err := LoadDatasetAsOf(dir, source.Name, "")
+		if err != nil {
+			return datasets, err
+		}
+		datasets = append(datasets, DatasetInfo{Name: ds.Name, RunID: ds.RunID, Columns: ds.Columns, Rows: len(ds.Rows),
+			URL: "/api/datasets/" + url.PathEscape(ds.Name)})
+	}
+	return datasets, nil
+}
+
+// DatasetQuery selects rows and columns of a dataset served over HTTP: the rows whose year is from From
+// to To, inclusive, of the Columns listed, Limit rows at a time from Offset.
+type DatasetQuery struct {
+	From    int      // No lower bound when zero
+	To      int      // No upper bound when zero
+	Columns []string // Every column when empty
+	Limit   int      // Every row when zero
+	Offset  int
+}
+
+// ParseDatasetQuery reads a DatasetQuery from the from, to, columns, limit and offset parameters.
+func ParseDatasetQuery(query url.Values) (DatasetQuery, error) {
+	var q DatasetQuery
+	for _, param := range []struct {
+		name string
+		v    *int
+	}{{"from", &q.From}, {"to", &q.To}, {"limit", &q.Limit}, {"offset", &q.Offset}} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("invalid %s %q", param.name, value)
+		}
+		*param.v = n
+	}
+	if q.Limit > maxDatasetPageSize {
+		return q, fmt.Errorf("limit %d is over %d", q.Limit, maxDatasetPageSize)
+	}
+	for _, column := range strings.Split(query.Get("columns"), ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			q.Columns = append(q.Columns, column)
+		}
+	}
+	return q, nil
+}
+
+// Apply returns the page of ds the query selects, and the number of rows matching it on every page.
+// Filtering by year needs a year column.
+func (q DatasetQuery) Apply(ds Dataset) (Dataset, int, error) {
+	page := Dataset{Name: ds.Name, Columns: ds.Columns, RunID: ds.RunID}
+	rows := ds.Rows
+	if q.From != 0 || q.To != 0 {
+		year := datasetColumn(ds, "year")
+		if year < 0 {
+			return page, 0, fmt.Errorf("dataset %s has no year column to filter by", ds.Name)
+		}
+		rows = nil
+		for _, row := range ds.Rows {
+			y := parseYear(row[year])
+			if y != 0 && (q.From == 0 || y >= q.From) && (q.To == 0 || y <= q.To) {
+				rows = append(rows, row)
+			}
+		}
+	}
+	total := len(rows)
+	if q.Offset >= len(rows) {
+		rows = nil
+	} else {
+		rows = rows[q.Offset:]
+	}
+	if q.Limit > 0 && len(rows) > q.Limit {
+		rows = rows[:q.Limit]
+	}
+	if len(q.Columns) == 0 {
+		page.Rows = rows
+		return page, total, nil
+	}
+	indexes := make([]int, len(q.Columns))
+	for i, column := range q.Columns {
+		if indexes[i] = datasetColumn(ds, column); indexes[i] < 0 {
+			return page, 0, fmt.Errorf("dataset %s has no column %q", ds.Name, column)
+		}
+	}
+	page.Columns = q.Columns
+	page.Rows = make([][]string, len(rows))
+	for i, row := range rows {
+		page.Rows[i] = make([]string, len(indexes))
+		for j, index := range indexes {
+			page.Rows[i][j] = row[index]
+		}
+	}
+	return page, total, nil
+}
+
+// datasetColumn returns the index of a column of ds, or -1.
+func datasetColumn(ds Dataset, column string) int {
+	for i, name := range ds.Columns {
+		if strings.EqualFold(name, column) {
+			return i
+		}
+	}
+	return -1
+}
+
+// NegotiateDatasetFormat picks "json" or "csv" for a dataset response: the format parameter when given,
+// else the first of the request's accepted media types that is served. It returns "" when the request
+// accepts neither.
+func NegotiateDatasetFormat(r *http.Request) string {
+	switch format := strings.ToLower(r.URL.Query().Get("format")); format {
+	case "json", "csv":
+		return format
+	case "":
+	default:
+		return ""
+	}
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return "json"
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+			return "json"
+		case "text/csv", "text/*":
+			return "csv"
+		}
+	}
+	return ""
+}
+
+// ServeDataset writes the page of ds selected by the request's query parameters as JSON or CSV, as the
+// request negotiates. The X-Total-Count header gives the rows matching on every page, and a Link header
+// the next page when there is one.
+func ServeDataset(w http.ResponseWriter, r *http.Request, ds Dataset) {
+	w.Header().Add("Vary", "Accept")
+	format := NegotiateDatasetFormat(r)
+	if format == "" {
+		http.Error(w, "Not acceptable, the dataset is served as application/json or text/csv", http.StatusNotAcceptable)
+		return
+	}
+	q, err := ParseDatasetQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, total, err := q.Apply(ds)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("X-Run-ID", page.RunID)
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if q.Limit > 0 && q.Offset+q.Limit < total {
+		next := r.URL.Query()
+		next.Set("offset", strconv.Itoa(q.Offset+q.Limit))
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, next.Encode()))
+	}
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		if err := page.WriteCSV(w); err != nil {
+			log.Printf("Error writing the %s dataset: %v", ds.Name, err)
+		}
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, page)
+}
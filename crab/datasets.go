@@ -0,0 +1,197 @@
+package crab
+
+import (
+	"bytes"
+	"cmpscfa23team2/records"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// Dataset is a flat, named table built from one of the scraped outputs; see records.Dataset.
+type Dataset = records.Dataset
+
+// scrapedDatasetFiles maps dataset names to the JSON files written by the scrapers and the loader for each.
+var scrapedDatasetFiles = []struct {
+	Name     string
+	DataFile string
+	Load     func(name, filename string) (Dataset, error)
+}{
+	{"inflation", "inflation_data.json", loadYearDataset},
+	{"gasoline", "gasoline_data.json", loadGasolineDataset},
+	{"housing", "property_data.json", loadPropertyDataset},
+	{"airfare", "airfare_data_inflation.json", loadAirfareDataset},
+}
+
+// NewDataset converts a slice of flat structs (YearData, GasolineData, PropertyData, ...) into a Dataset.
+// Column names come from the json tags of the struct fields, falling back to the field name.
+func NewDataset(name string, records interface{}) (Dataset, error) {
+	v := reflect.ValueOf(records)
+	if v.Kind() != reflect.Slice {
+		return Dataset{}, fmt.Errorf("dataset %s: expected a slice of structs, got %s", name, v.Kind())
+	}
+
+	elem := v.Type().Elem()
+	if elem.Kind() != reflect.Struct {
+		return Dataset{}, fmt.Errorf("dataset %s: expected a slice of structs, got slice of %s", name, elem.Kind())
+	}
+
+	ds := Dataset{Name: name}
+	var fields []int
+	for i := 0; i < elem.NumField(); i++ {
+		field := elem.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		column := strings.Split(field.Tag.Get("json"), ",")[0]
+		if column == "-" {
+			continue
+		}
+		if column == "" {
+			column = field.Name
+		}
+		ds.Columns = append(ds.Columns, column)
+		fields = append(fields, i)
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		record := v.Index(i)
+		row := make([]string, len(fields))
+		for j, idx := range fields {
+			row[j] = strings.TrimSpace(fmt.Sprint(record.Field(idx).Interface()))
+		}
+		ds.Rows = append(ds.Rows, row)
+	}
+	return ds, nil
+}
+
+// LoadScrapedDatasets reads every scraped dataset found in dir. Outputs that have not been written yet
+// are skipped, so the result only holds the datasets produced by the last run.
+func LoadScrapedDatasets(dir string) ([]Dataset, error) {
+	var datasets []Dataset
+	for _, source := range scrapedDatasetFiles {
+		path := filepath.Join(dir, source.DataFile)
+		if !outputFileExists(path) {
+			continue
+		}
+		ds, err := source.Load(source.Name, path)
+		if err != nil {
+			return datasets, fmt.Errorf("loading %s: %w", path, err)
+		}
+		if runID := filepath.Base(dir); runIDPattern.MatchString(runID) {
+			ds.RunID = runID
+		}
+		datasets = append(datasets, ds)
+	}
+	return datasets, nil
+}
+
+// loadYearDataset loads inflation_data.json into a Dataset.
+func loadYearDataset(name, filename string) (Dataset, error) {
+	var data []YearData
+	if err := readJSONFile(filename, &data); err != nil {
+		return Dataset{}, err
+	}
+	return NewDataset(name, data)
+}
+
+// loadGasolineDataset loads gasoline_data.json into a Dataset.
+func loadGasolineDataset(name, filename string) (Dataset, error) {
+	var data []GasolineData
+	if err := readJSONFile(filename, &data); err != nil {
+		return Dataset{}, err
+	}
+	return NewDataset(name, data)
+}
+
+// loadPropertyDataset loads property_data.json into a Dataset.
+func loadPropertyDataset(name, filename string) (Dataset, error) {
+	var data []PropertyData
+	if err := readJSONFile(filename, &data); err != nil {
+		return Dataset{}, err
+	}
+	return NewDataset(name, data)
+}
+
+// loadAirfareDataset flattens the airfare output into one row per year and month.
+func loadAirfareDataset(name, filename string) (Dataset, error) {
+	records, err := readAirfareFile(filename)
+	if err != nil {
+		return Dataset{}, err
+	}
+
+	ds := Dataset{Name: name, Columns: []string{"year", "month", "rate"}}
+	for _, airfare := range records {
+		for _, md := range airfare.Data.AdditionalInfo.MonthsData {
+			ds.Rows = append(ds.Rows, []string{strings.TrimSpace(airfare.Data.Year), md.Month, strings.TrimSpace(md.Rate)})
+		}
+	}
+	return ds, nil
+}
+
+// readAirfareFile reads the JSON written by Airdatatest. That file is a comma separated run of AirfareData
+// objects rather than a JSON array, so the objects are decoded one at a time. Backfills write an array.
+func readAirfareFile(filename string) ([]AirfareData, error) {
+	file, err := ReadOutputFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []AirfareData
+	if bytes.HasPrefix(bytes.TrimSpace(file), []byte("[")) {
+		err := json.Unmarshal(file, &records)
+		return records, err
+	}
+	rest := file
+	for {
+		rest = bytes.TrimLeft(rest, " \t\r\n,")
+		if len(rest) == 0 {
+			break
+		}
+		var airfare AirfareData
+		decoder := json.NewDecoder(bytes.NewReader(rest))
+		if err := decoder.Decode(&airfare); err != nil {
+			return nil, err
+		}
+		rest = rest[decoder.InputOffset():]
+		records = append(records, airfare)
+	}
+	return records, nil
+}
+
+// readJSONFile unmarshals the JSON file at filename into v.
+func readJSONFile(filename string, v interface{}) error {
+	file, err := ReadOutputFile(filename)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(file, v)
+}
+
+// DiffDatasets compares two versions of a dataset row by row. The result has a leading "change" column
+// set to "added" for rows only in current and "removed" for rows only in previous; unchanged rows are
+// left out.
+func DiffDatasets(previous, current Dataset) Dataset {
+	diff := Dataset{Name: current.Name + "_diff", Columns: append([]string{"change"}, current.Columns...)}
+
+	previousRows := make(map[string]bool, len(previous.Rows))
+	for _, row := range previous.Rows {
+		previousRows[strings.Join(row, "\x1f")] = true
+	}
+	currentRows := make(map[string]bool, len(current.Rows))
+	for _, row := range current.Rows {
+		key := strings.Join(row, "\x1f")
+		currentRows[key] = true
+		if !previousRows[key] {
+			diff.Rows = append(diff.Rows, append([]string{"added"}, row...))
+		}
+	}
+	for _, row := range previous.Rows {
+		if !currentRows[strings.Join(row, "\x1f")] {
+			diff.Rows = append(diff.Rows, append([]string{"removed"}, row...))
+		}
+	}
+	return diff
+}
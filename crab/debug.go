@@ -0,0 +1,281 @@
+package crab
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultProfileSeconds is how long CPU profiles and execution traces run when no seconds are given.
+	defaultProfileSeconds = 30
+	// maxProfileSeconds caps how long a CPU profile or execution trace may run.
+	maxProfileSeconds = 300
+)
+
+// cacheMetrics counts the hits and misses of the caches, as "<cache>.hits" and "<cache>.misses".
+var cacheMetrics = expvar.NewMap("crab_cache")
+
+// WorkerState is what a worker of a crawl pipeline is doing.
+type WorkerState struct {
+	Stage string    `json:"stage"` // "fetch" or "parse"
+	State string    `json:"state"` // "idle", "busy", or "blocked" for a fetcher waiting for the parsers
+	URL   string    `json:"url,omitempty"`
+	Since time.Time `json:"since"`
+}
+
+// CrawlDebugState is the state of a crawl pipeline in progress.
+type CrawlDebugState struct {
+	StartedAt time.Time      `json:"started_at"`
+	Frontier  int            `json:"frontier"` // URLs not yet fetched
+	Domains   map[string]int `json:"domains"`  // URLs not yet fetched by host
+	Parsing   int            `json:"parsing"`  // Fetched pages waiting for a parser
+	Workers   []WorkerState  `json:"workers"`
+}
+
+// CacheStats are the hits and misses of a cache since the process started.
+type CacheStats struct {
+	Name    string  `json:"name"`
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"` // Hits over lookups, 0 before the first
+}
+
+// DebugState is a snapshot of the internals of the process, for debugging it in production.
+type DebugState struct {
+	Time       time.Time         `json:"time"`
+	Goroutines int               `json:"goroutines"`
+	HeapBytes  uint64            `json:"heap_bytes"`
+	Crawls     []CrawlDebugState `json:"crawls"`
+	Caches     []CacheStats      `json:"caches"`
+	Jobs       map[JobState]int  `json:"jobs,omitempty"` // The number of jobs in each state, in server mode
+}
+
+// pipelineDebug follows a crawl pipeline for the debug state.
+type pipelineDebug struct {
+	startedAt time.Time
+	frontier  *Frontier
+	pages     chan FetchedPage
+
+	mu      sync.Mutex
+	workers []WorkerState
+}
+
+// activePipelines are the crawl pipelines in progress.
+var activePipelines struct {
+	sync.Mutex
+	pipelines map[*pipelineDebug]struct{}
+}
+
+// beginPipelineDebug registers a crawl pipeline with its fetch workers first, then its parse workers.
+func beginPipelineDebug(frontier *Frontier, pages chan FetchedPage, fetchWorkers, parseWorkers int) *pipelineDebug {
+	now := time.Now()
+	p := &pipelineDebug{startedAt: now, frontier: frontier, pages: pages}
+	for i := 0; i < fetchWorkers+parseWorkers; i++ {
+		stage := "fetch"
+		if i >= fetchWorkers {
+			stage = "parse"
+		}
+		p.workers = append(p.workers, WorkerState{Stage: stage, State: "idle", Since: now})
+	}
+	activePipelines.Lock()
+	defer activePipelines.Unlock()
+	if activePipelines.pipelines == nil {
+		activePipelines.pipelines = map[*pipelineDebug]struct{}{}
+	}
+	activePipelines.pipelines[p] = struct{}{}
+	return p
+}
+
+// endPipelineDebug unregisters a crawl pipeline once it is done.
+func endPipelineDebug(p *pipelineDebug) {
+	activePipelines.Lock()
+	defer activePipelines.Unlock()
+	delete(activePipelines.pipelines, p)
+}
+
+// set records what worker is doing.
+func (p *pipelineDebug) set(worker int, state, url string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.workers[worker] = WorkerState{Stage: p.workers[worker].Stage, State: state, URL: url, Since: time.Now()}
+}
+
+// state returns the state of the pipeline.
+func (p *pipelineDebug) state() CrawlDebugState {
+	p.mu.Lock()
+	workers := append([]WorkerState(nil), p.workers...)
+	p.mu.Unlock()
+	return CrawlDebugState{StartedAt: p.startedAt, Frontier: p.frontier.Len(), Domains: p.frontier.Domains(),
+		Parsing: len(p.pages), Workers: workers}
+}
+
+// CurrentDebugState returns the state of the crawls in progress, oldest first, and the hit rates of the
+// caches.
+func CurrentDebugState() DebugState {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	state := DebugState{Time: time.Now(), Goroutines: runtime.NumGoroutine(), HeapBytes: memory.HeapAlloc,
+		Crawls: []CrawlDebugState{}, Caches: cacheStats()}
+	activePipelines.Lock()
+	for p := range activePipelines.pipelines {
+		state.Crawls = append(state.Crawls, p.state())
+	}
+	activePipelines.Unlock()
+	sort.Slice(state.Crawls, func(i, j int) bool { return state.Crawls[i].StartedAt.Before(state.Crawls[j].StartedAt) })
+	return state
+}
+
+// cacheStats returns the hit rates of the caches, the pool of fetch collectors among them.
+func cacheStats() []CacheStats {
+	counts := map[string]*CacheStats{}
+	count := func(name string, hit bool, n int64) {
+		stats := counts[name]
+		if stats == nil {
+			stats = &CacheStats{Name: name}
+			counts[name] = stats
+		}
+		if hit {
+			stats.Hits += n
+		} else {
+			stats.Misses += n
+		}
+	}
+	cacheMetrics.Do(func(kv expvar.KeyValue) {
+		v, ok := kv.Value.(*expvar.Int)
+		if !ok {
+			return
+		}
+		if name := strings.TrimSuffix(kv.Key, ".hits"); name != kv.Key {
+			count(name, true, v.Value())
+		} else if name := strings.TrimSuffix(kv.Key, ".misses"); name != kv.Key {
+			count(name, false, v.Value())
+		}
+	})
+	count("fetch_collectors", true, collectorCount("reused"))
+	count("fetch_collectors", false, collectorCount("created"))
+
+	stats := make([]CacheStats, 0, len(counts))
+	for _, s := range counts {
+		if lookups := s.Hits + s.Misses; lookups > 0 {
+			s.HitRate = float64(s.Hits) / float64(lookups)
+		}
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// requireAPIAuth wraps a debugging handler so it answers 403 while the API has neither keys nor a JWT
+// secret: the profiles and crawl state are never served to anonymous callers, whatever role they get.
+func requireAPIAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !CurrentConfig().API.Enabled() {
+			http.Error(w, "Forbidden: the debugging endpoints need API keys or a JWT secret", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// DebugStateHandler serves the debug state (GET).
+func DebugStateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, CurrentDebugState())
+}
+
+// ProfileHandler serves the runtime profiles of the process under /debug/pprof/ for go tool pprof, as
+// net/http/pprof does, without registering them on the default ServeMux:
+//
+//	/debug/pprof/                 the list of profiles
+//	/debug/pprof/profile          a CPU profile of the seconds parameter, 30 by default
+//	/debug/pprof/trace            an execution trace of the seconds parameter, 30 by default
+//	/debug/pprof/{name}           the named profile, e.g. heap or goroutine; debug=1 or 2 for text
+func ProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/debug/pprof"), "/")
+	switch name {
+	case "":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, profile := range pprof.Profiles() {
+			fmt.Fprintf(w, "%-14s %d\n", profile.Name(), profile.Count())
+		}
+		fmt.Fprintf(w, "%-14s CPU profile, ?seconds=%d\n", "profile", defaultProfileSeconds)
+		fmt.Fprintf(w, "%-14s execution trace, ?seconds=%d\n", "trace", defaultProfileSeconds)
+	case "profile", "trace":
+		seconds, err := profileSeconds(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		if name == "profile" {
+			err = pprof.StartCPUProfile(w)
+		} else {
+			err = trace.Start(w)
+		}
+		if err != nil {
+			// Another profile or trace is running
+			w.Header().Del("Content-Disposition")
+			http.Error(w, "Could not start the "+name+": "+err.Error(), http.StatusConflict)
+			return
+		}
+		select {
+		case <-time.After(time.Duration(seconds) * time.Second):
+		case <-r.Context().Done():
+		}
+		if name == "profile" {
+			pprof.StopCPUProfile()
+		} else {
+			trace.Stop()
+		}
+	default:
+		profile := pprof.Lookup(name)
+		if profile == nil {
+			http.Error(w, "Unknown profile "+name, http.StatusNotFound)
+			return
+		}
+		debug, _ := strconv.Atoi(r.URL.Query().Get("debug"))
+		if name == "heap" && r.URL.Query().Get("gc") != "" {
+			runtime.GC()
+		}
+		if debug > 0 {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		}
+		profile.WriteTo(w, debug)
+	}
+}
+
+// profileSeconds returns the seconds parameter of a CPU profile or execution trace.
+func profileSeconds(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("seconds")
+	if value == "" {
+		return defaultProfileSeconds, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 || seconds > maxProfileSeconds {
+		return 0, fmt.Errorf("seconds must be from 1 to %d", maxProfileSeconds)
+	}
+	return seconds, nil
+}
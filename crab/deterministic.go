@@ -0,0 +1,67 @@
+package crab
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DeterministicConfig makes crawls and scrapes reproducible for regression testing and debugging. With
+// Enabled set, every run reseeds the user agent, header and delay choices from Seed, crawls its seed URLs
+// one at a time in sorted order, and stamps scraped items with the Unix epoch instead of the current time,
+// so identical inputs produce byte-identical sitemaps and datasets. Run IDs, manifests and run reports
+// still record when the run actually happened.
+type DeterministicConfig struct {
+	Enabled bool  `json:"enabled"`
+	Seed    int64 `json:"seed"`
+}
+
+var (
+	crawlRandMu sync.Mutex
+	crawlRand   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// randIntn returns a random number in [0, n) from the source shared by the user agent, fingerprint and
+// delay choices.
+func randIntn(n int) int {
+	crawlRandMu.Lock()
+	defer crawlRandMu.Unlock()
+	return crawlRand.Intn(n)
+}
+
+// randDuration returns a random duration in [0, max).
+func randDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	crawlRandMu.Lock()
+	defer crawlRandMu.Unlock()
+	return time.Duration(crawlRand.Int63n(int64(max)))
+}
+
+// seedRun restarts the shared random source from the seed of config at the start of a deterministic run,
+// so every run makes the same sequence of choices.
+func seedRun(config DeterministicConfig) {
+	if !config.Enabled {
+		return
+	}
+	crawlRandMu.Lock()
+	defer crawlRandMu.Unlock()
+	crawlRand.Seed(config.Seed)
+}
+
+// itemTimestamp returns the timestamp recorded on an item scraped under config.
+func itemTimestamp(config DeterministicConfig) string {
+	if config.Enabled {
+		return time.Unix(0, 0).UTC().Format(time.RFC3339)
+	}
+	return time.Now().Format(time.RFC3339)
+}
+
+// sortedURLData returns a copy of urls sorted by URL. The sort is stable, so duplicates keep their order.
+func sortedURLData(urls []URLData) []URLData {
+	sorted := append([]URLData(nil), urls...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].URL < sorted[j].URL })
+	return sorted
+}
@@ -0,0 +1,201 @@
+package crab
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EmailConfig configures SMTP delivery of run reports. Recipients maps a job name (the scraped domain or
+// "crawl") to the addresses that receive its report; DefaultRecipients is used for jobs not listed.
+// The SMTP password may name a secret as "secret:<name>"; when it is not set it is the secret smtp/password,
+// e.g. from CRAB_SMTP_PASSWORD.
+type EmailConfig struct {
+	Host              string              `json:"host"`
+	Port              int                 `json:"port"`
+	Username          string              `json:"username"`
+	Password          string              `json:"password"`
+	From              string              `json:"from"`
+	DefaultRecipients []string            `json:"default_recipients"`
+	Recipients        map[string][]string `json:"recipients"`
+}
+
+// reportTemplate renders the HTML summary at the top of a report email.
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{"number": formatStat}).Parse(`<html><body>
+<h2>{{.Summary.Kind}} {{.Summary.Name}}: {{.Summary.Event}}</h2>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th align="left">Started</th><td>{{.Summary.StartedAt.Format "2006-01-02 15:04:05"}}</td></tr>
+<tr><th align="left">Duration</th><td>{{.Duration}}</td></tr>
+<tr><th align="left">Pages</th><td>{{.Summary.Pages}}</td></tr>
+<tr><th align="left">Items</th><td>{{.Summary.Items}}</td></tr>
+<tr><th align="left">Errors</th><td>{{.Summary.Errors}}</td></tr>
+{{range $status, $count := .Summary.Statuses}}<tr><th align="left">URLs {{$status}}</th><td>{{$count}}</td></tr>
+{{end}}{{if .Summary.Error}}<tr><th align="left">Error</th><td>{{.Summary.Error}}</td></tr>{{end}}
+</table>
+{{if .Summary.Alerts}}<h3>Alerts</h3><ul>{{range .Summary.Alerts}}<li>{{.Rule}}: {{.Message}}</li>{{end}}</ul>{{end}}
+{{range .Summary.Datasets}}<h3>Dataset {{.Dataset}}: {{.Rows}} rows</h3>
+<table border="1" cellpadding="4" cellspacing="0">
+<tr><th align="left">Column</th><th>Empty</th><th>Min</th><th>Max</th><th>Mean</th></tr>
+{{range .Columns}}<tr><td>{{.Column}}</td><td>{{.Nulls}}</td>{{if .Mean}}<td>{{number .Min}}</td><td>{{number .Max}}</td><td>{{number .Mean}}</td>{{else}}<td></td><td></td><td></td>{{end}}</tr>
+{{end}}</table>
+{{end}}{{if .Attachments}}<h3>Attached datasets</h3><ul>{{range .Attachments}}<li>{{.Name}} ({{len .Rows}} rows)</li>{{end}}</ul>{{end}}
+{{if .Summary.Outputs}}<h3>Outputs</h3><ul>{{range .Summary.Outputs}}<li>{{.}}</li>{{end}}</ul>{{end}}
+</body></html>`))
+
+// formatStat renders a column statistic to four significant digits.
+func formatStat(value *float64) string {
+	return fmt.Sprintf("%.4g", *value)
+}
+
+// RecipientsFor returns the report recipients configured for a job.
+func (c EmailConfig) RecipientsFor(job string) []string {
+	if recipients, ok := c.Recipients[job]; ok {
+		return recipients
+	}
+	return c.DefaultRecipients
+}
+
+// SendRunReport emails the run summary to the recipients of the job, with each dataset and each
+// dataset diff attached as a CSV file. Nothing is sent when email is not configured for the job.
+func SendRunReport(config EmailConfig, summary RunSummary, datasets []Dataset, diffs []Dataset) error {
+	recipients := config.RecipientsFor(summary.Name)
+	if config.Host == "" || len(recipients) == 0 {
+		return nil
+	}
+
+	message, err := BuildRunReportEmail(config.From, recipients, summary, append(datasets, diffs...))
+	if err != nil {
+		return err
+	}
+
+	port := config.Port
+	if port == 0 {
+		port = 587
+	}
+	var auth smtp.Auth
+	if config.Username != "" {
+		password := config.Password
+		if password == "" {
+			if secret, err := LookupSecret("smtp/password"); err == nil {
+				password = secret
+			} else if !errors.Is(err, ErrSecretNotFound) {
+				return err
+			}
+		}
+		auth = smtp.PlainAuth("", config.Username, password, config.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", config.Host, port)
+	if err := smtp.SendMail(addr, auth, config.From, recipients, message); err != nil {
+		log.Printf("Error emailing %s report: %v", summary.Name, err)
+		return err
+	}
+	log.Printf("Emailed %s report to %s", summary.Name, strings.Join(recipients, ", "))
+	return nil
+}
+
+// emailRunReport emails the report of a finished run to the recipients of its job with the scraped datasets
+// the run wrote and their diffs with the previous run attached. Failures are logged rather than failing the
+// run.
+func emailRunReport(config Config, summary RunSummary) {
+	if config.Email.Host == "" || len(config.Email.RecipientsFor(summary.Name)) == 0 {
+		return
+	}
+	datasets, diffs := runAttachments(config.Output, summary)
+	if err := SendRunReport(config.Email, summary, datasets, diffs); err != nil {
+		log.Printf("Error sending the %s report of run %s: %v", summary.Name, summary.RunID, err)
+	}
+}
+
+// runAttachments loads the scraped datasets a finished run wrote and, for each, the rows added and
+// removed since the previous run that wrote it. Runs written outside a run directory have neither.
+func runAttachments(config OutputConfig, summary RunSummary) (datasets []Dataset, diffs []Dataset) {
+	if config.Dir == "" || summary.RunID == "" {
+		return nil, nil
+	}
+	datasets, err := LoadScrapedDatasets(filepath.Join(config.Dir, summary.RunID))
+	if err != nil {
+		log.Printf("Error loading the datasets of run %s: %v", summary.RunID, err)
+	}
+	report, err := BuildRunReport(config.Dir, summary.RunID, summary.Outputs, &summary)
+	if err != nil {
+		log.Printf("Error diffing the datasets of run %s: %v", summary.RunID, err)
+	}
+	for _, diff := range report.Diffs {
+		diffs = append(diffs, diff.Rows)
+	}
+	return datasets, diffs
+}
+
+// BuildRunReportEmail builds a multipart MIME message with an HTML summary and one CSV attachment
+// per dataset.
+func BuildRunReportEmail(from string, to []string, summary RunSummary, attachments []Dataset) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	var html bytes.Buffer
+	err := reportTemplate.Execute(&html, struct {
+		Summary     RunSummary
+		Duration    time.Duration
+		Attachments []Dataset
+	}{summary, summary.FinishedAt.Sub(summary.StartedAt).Round(time.Second), attachments})
+	if err != nil {
+		return nil, err
+	}
+
+	part, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/html; charset=UTF-8"}})
+	if err != nil {
+		return nil, err
+	}
+	part.Write(html.Bytes())
+
+	for _, ds := range attachments {
+		var csvData bytes.Buffer
+		if err := ds.WriteCSV(&csvData); err != nil {
+			return nil, err
+		}
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"text/csv; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {fmt.Sprintf("attachment; filename=%q", ds.Name+".csv")},
+		})
+		if err != nil {
+			return nil, err
+		}
+		part.Write(wrapBase64(csvData.Bytes()))
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&message, "Subject: [crab] %s %s %s\r\n", summary.Kind, summary.Name, summary.Event)
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// wrapBase64 base64 encodes data in 76 character lines as required for MIME bodies.
+func wrapBase64(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b bytes.Buffer
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n")
+	return b.Bytes()
+}
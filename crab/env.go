@@ -0,0 +1,111 @@
+package crab
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// envPrefix starts the names of the environment variables that override config settings.
+const envPrefix = "CRAB_"
+
+// LoadConfigFromEnv reads the config of a service run: the JSON file named by $CRAB_CONFIG, if set, with
+// the settings of CRAB_* environment variables on top of it (see ApplyEnv). Credentials set to
+// "secret:<name>" are looked up like those of the file.
+func LoadConfigFromEnv() (Config, error) {
+	var config Config
+	if filename := os.Getenv("CRAB_CONFIG"); filename != "" {
+		var err error
+		if config, err = LoadConfig(filename); err != nil {
+			return config, err
+		}
+	}
+	if err := ApplyEnv(&config, os.Environ()); err != nil {
+		return config, err
+	}
+	err := config.resolveSecrets()
+	return config, err
+}
+
+// ApplyEnv sets the config settings named by environment variables in environ, given as "NAME=value".
+// A setting's variable is CRAB_ followed by the JSON names of its path in upper case, joined with
+// underscores: CRAB_OUTPUT_DIR sets output.dir and CRAB_PIPELINE_FETCH_TIMEOUT pipeline.fetch_timeout.
+// Strings, numbers and booleans are parsed from the value, and lists of strings are comma separated.
+// Settings of other types, such as maps and lists of objects, can only be set in the file.
+func ApplyEnv(config *Config, environ []string) error {
+	values := map[string]string{}
+	for _, entry := range environ {
+		if name, value, ok := strings.Cut(entry, "="); ok && strings.HasPrefix(name, envPrefix) {
+			values[name] = value
+		}
+	}
+	return applyEnvStruct(reflect.ValueOf(config).Elem(), strings.TrimSuffix(envPrefix, "_"), values)
+}
+
+// applyEnvStruct sets the fields of struct v whose variables under prefix are in values.
+func applyEnvStruct(v reflect.Value, prefix string, values map[string]string) error {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || tag == "" || tag == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnvStruct(v.Field(i), name, values); err != nil {
+				return err
+			}
+			continue
+		}
+		value, ok := values[name]
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(v.Field(i), value); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setEnvValue parses value into the setting f.
+func setEnvValue(f reflect.Value, value string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Slice:
+		if f.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("a list of %s cannot be set from the environment", f.Type().Elem())
+		}
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		f.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("a %s cannot be set from the environment", f.Type())
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+package crab
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"github.com/temoto/robotstxt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultEstimateSample is the number of pages fetched to measure page size and latency.
+	defaultEstimateSample = 5
+	// maxEstimateSitemaps caps the child sitemaps read from a sitemap index; the rest are extrapolated.
+	maxEstimateSitemaps = 20
+)
+
+// EstimateOptions controls how EstimateCrawl samples a domain. The zero value samples five pages and
+// projects a crawl paced like ThreadedCrawl.
+type EstimateOptions struct {
+	SampleSize int           // Pages to fetch, 5 when zero
+	Delay      time.Duration // Average delay between requests, the configured rate limit when zero
+	Client     *http.Client
+}
+
+// CrawlEstimate is the result of a pre-flight check of a domain.
+type CrawlEstimate struct {
+	URL               string        `json:"url"`
+	RobotsFound       bool          `json:"robots_found"`
+	CrawlDelay        time.Duration `json:"crawl_delay"` // Crawl-delay from robots.txt, if any
+	Disallowed        bool          `json:"disallowed"`  // robots.txt disallows the start URL
+	Sitemaps          []string      `json:"sitemaps"`
+	SitemapURLs       int           `json:"sitemap_urls"`
+	SampledPages      int           `json:"sampled_pages"`
+	AvgPageBytes      int64         `json:"avg_page_bytes"`
+	AvgLatency        time.Duration `json:"avg_latency"`
+	ProjectedPages    int           `json:"projected_pages"`
+	ProjectedBytes    int64         `json:"projected_bytes"`
+	ProjectedDuration time.Duration `json:"projected_duration"`
+	Notes             []string      `json:"notes,omitempty"`
+}
+
+// sitemapDocument matches both <urlset> sitemaps and <sitemapindex> indexes.
+type sitemapDocument struct {
+	XMLName xml.Name
+	URLs    []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// EstimateCrawl samples the domain of startURL before a long crawl: it reads robots.txt and the
+// sitemaps, fetches a few pages to measure their size and latency, and projects the total pages,
+// bandwidth and time the crawl will take.
+func EstimateCrawl(startURL string, options EstimateOptions) (CrawlEstimate, error) {
+	estimate := CrawlEstimate{URL: startURL, Sitemaps: []string{}}
+	start, err := url.Parse(startURL)
+	if err != nil || start.Host == "" {
+		return estimate, fmt.Errorf("invalid URL: %s", startURL)
+	}
+	if options.SampleSize <= 0 {
+		options.SampleSize = defaultEstimateSample
+	}
+	if options.Delay <= 0 {
+		config := CurrentConfig().RateLimit
+		options.Delay = time.Duration(config.DelayMS)*time.Millisecond + time.Duration(config.RandomDelayMS)*time.Millisecond/2
+	}
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	root := start.Scheme + "://" + start.Host
+	if start.Path == "" {
+		start.Path = "/"
+	}
+
+	// robots.txt gives the crawl delay, the sitemaps and whether we may crawl at all.
+	var group *robotstxt.Group
+	if body, status, err := estimateFetch(options.Client, root+"/robots.txt"); err == nil && status == http.StatusOK {
+		if robots, err := robotstxt.FromStatusAndBytes(status, body); err == nil {
+			estimate.RobotsFound = true
+			estimate.Sitemaps = append(estimate.Sitemaps, robots.Sitemaps...)
+			group = robots.FindGroup(RobotsAgent())
+			estimate.CrawlDelay = group.CrawlDelay
+			estimate.Disallowed = !group.Test(start.Path)
+		}
+	}
+	if !estimate.RobotsFound {
+		estimate.Notes = append(estimate.Notes, "No robots.txt found; every path is assumed crawlable.")
+	}
+	if estimate.Disallowed {
+		estimate.Notes = append(estimate.Notes, "robots.txt disallows the start URL for "+RobotsAgent()+".")
+	}
+	if len(estimate.Sitemaps) == 0 {
+		estimate.Sitemaps = append(estimate.Sitemaps, root+"/sitemap.xml")
+	}
+
+	// Count the URLs listed in the sitemaps, following sitemap indexes.
+	var pageURLs []string
+	queue := append([]string{}, estimate.Sitemaps...)
+	read, skipped := 0, 0
+	for len(queue) > 0 {
+		sitemapURL := queue[0]
+		queue = queue[1:]
+		if read >= maxEstimateSitemaps {
+			skipped++
+			continue
+		}
+		read++
+		doc, err := fetchSitemap(options.Client, sitemapURL)
+		if err != nil {
+			continue
+		}
+		for _, child := range doc.Sitemaps {
+			queue = append(queue, strings.TrimSpace(child.Loc))
+		}
+		for _, u := range doc.URLs {
+			pageURLs = append(pageURLs, strings.TrimSpace(u.Loc))
+		}
+	}
+	estimate.SitemapURLs = len(pageURLs)
+	if skipped > 0 && read > 0 {
+		// Assume the unread sitemaps are about as large as the ones read.
+		estimate.SitemapURLs += len(pageURLs) * skipped / read
+		estimate.Notes = append(estimate.Notes, fmt.Sprintf("Only %d of %d sitemaps were read; the rest were extrapolated.", read, read+skipped))
+	}
+
+	// Sample the start page and the first sitemap pages the crawler would be allowed to visit.
+	sample := []string{startURL}
+	for _, pageURL := range pageURLs {
+		if len(sample) >= options.SampleSize {
+			break
+		}
+		if parsed, err := url.Parse(pageURL); err == nil && pageURL != startURL && (group == nil || group.Test(parsed.Path)) {
+			sample = append(sample, pageURL)
+		}
+	}
+	var totalBytes int64
+	var totalLatency time.Duration
+	var startLinks int
+	for i, pageURL := range sample {
+		began := time.Now()
+		body, status, err := estimateFetch(options.Client, pageURL)
+		if err != nil || status >= 400 {
+			continue
+		}
+		totalLatency += time.Since(began)
+		totalBytes += int64(len(body))
+		estimate.SampledPages++
+		if i == 0 {
+			startLinks = bytes.Count(body, []byte("<a "))
+		}
+	}
+	if estimate.SampledPages == 0 {
+		return estimate, fmt.Errorf("could not fetch any page of %s", root)
+	}
+	estimate.AvgPageBytes = totalBytes / int64(estimate.SampledPages)
+	estimate.AvgLatency = totalLatency / time.Duration(estimate.SampledPages)
+
+	// Project the crawl. Without a sitemap, the links on the start page are the only size hint.
+	estimate.ProjectedPages = estimate.SitemapURLs
+	if estimate.ProjectedPages == 0 {
+		estimate.ProjectedPages = startLinks + 1
+		estimate.Notes = append(estimate.Notes, "No sitemap URLs found; the projection counts the start page and its links only.")
+	}
+	perPage := options.Delay
+	if estimate.CrawlDelay > perPage {
+		perPage = estimate.CrawlDelay
+	}
+	estimate.ProjectedBytes = int64(estimate.ProjectedPages) * estimate.AvgPageBytes
+	estimate.ProjectedDuration = time.Duration(estimate.ProjectedPages) * (perPage + estimate.AvgLatency)
+	return estimate, nil
+}
+
+// Summary renders the estimate for people reading a terminal.
+func (e CrawlEstimate) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Estimate for %s\n", e.URL)
+	if e.RobotsFound {
+		b.WriteString("  robots.txt:      found\n")
+	} else {
+		b.WriteString("  robots.txt:      not found\n")
+	}
+	if e.CrawlDelay > 0 {
+		fmt.Fprintf(&b, "  crawl-delay:     %s\n", e.CrawlDelay)
+	}
+	fmt.Fprintf(&b, "  sitemap URLs:    %d\n", e.SitemapURLs)
+	fmt.Fprintf(&b, "  sampled pages:   %d (avg %s, %s)\n", e.SampledPages, formatBytes(e.AvgPageBytes), e.AvgLatency.Round(time.Millisecond))
+	fmt.Fprintf(&b, "  projected pages: %d\n", e.ProjectedPages)
+	fmt.Fprintf(&b, "  bandwidth:       %s\n", formatBytes(e.ProjectedBytes))
+	fmt.Fprintf(&b, "  duration:        %s\n", e.ProjectedDuration.Round(time.Second))
+	for _, note := range e.Notes {
+		fmt.Fprintf(&b, "  note: %s\n", note)
+	}
+	return b.String()
+}
+
+// estimateFetch GETs a URL with the crawler's identity and returns the body and status code.
+func estimateFetch(client *http.Client, rawURL string) ([]byte, int, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("User-Agent", RequestUserAgent())
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return body, resp.StatusCode, err
+}
+
+// fetchSitemap downloads and parses a sitemap or sitemap index, gzipped or not.
+func fetchSitemap(client *http.Client, rawURL string) (sitemapDocument, error) {
+	var doc sitemapDocument
+	body, status, err := estimateFetch(client, rawURL)
+	if err != nil {
+		return doc, err
+	}
+	if status != http.StatusOK {
+		return doc, fmt.Errorf("fetching %s: status %d", rawURL, status)
+	}
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return doc, err
+		}
+		if body, err = io.ReadAll(gz); err != nil {
+			return doc, err
+		}
+	}
+	err = xml.Unmarshal(body, &doc)
+	return doc, err
+}
+
+// formatBytes renders a byte count with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
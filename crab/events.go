@@ -0,0 +1,217 @@
+package crab
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/gocolly/colly"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Types of the events of a run's event log, in the order a URL goes through them.
+const (
+	EventURLEnqueued      = "url_enqueued"      // The URL joined the frontier of the crawl
+	EventFetchStarted     = "fetch_started"     // A request for the URL was sent
+	EventFetchCompleted   = "fetch_completed"   // The response arrived, or the request failed
+	EventExtractCompleted = "extract_completed" // The links and records of the page were extracted
+	EventStored           = "stored"            // The result was written to the outputs of the run
+)
+
+// eventLogFile is the name of the event log in a run's directory.
+const eventLogFile = "events.jsonl"
+
+// CrawlEvent is one step of a URL through a run. ID correlates the events of a URL within the run.
+type CrawlEvent struct {
+	Time       time.Time `json:"time"`
+	Type       string    `json:"type"`
+	RunID      string    `json:"run_id"`
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	Status     string    `json:"status,omitempty"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS float64   `json:"duration_ms,omitempty"` // Of the fetch or extraction
+	Bytes      int       `json:"bytes,omitempty"`
+	Links      int       `json:"links,omitempty"`
+	Records    int       `json:"records,omitempty"`
+}
+
+// EventID returns the correlation ID of the events of rawURL.
+func EventID(rawURL string) string {
+	sum := sha1.Sum([]byte(rawURL))
+	return hex.EncodeToString(sum[:8])
+}
+
+// durationMS returns d in milliseconds.
+func durationMS(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// EventLog appends the events of a run to its events.jsonl, one JSON object per line, as they happen. Its
+// methods are safe for concurrent use, and do nothing on a nil log.
+type EventLog struct {
+	runID string
+
+	mu   sync.Mutex
+	file *os.File
+	err  error // The first write error, after which events are dropped
+}
+
+// OpenEventLog opens the event log at path for appending the events of run runID.
+func OpenEventLog(path, runID string) (*EventLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &EventLog{runID: runID, file: file}, nil
+}
+
+// beginEvents opens the event log of a run, or returns nil for runs without a directory.
+func beginEvents(run *Run) *EventLog {
+	if run == nil {
+		return nil
+	}
+	events, err := OpenEventLog(run.Path(eventLogFile), run.RunID())
+	if err != nil {
+		log.Printf("Error opening the event log: %v", err)
+		return nil
+	}
+	return events
+}
+
+// Emit appends event, filling in its time, run and correlation ID when unset.
+func (l *EventLog) Emit(event CrawlEvent) {
+	if l == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if event.RunID == "" {
+		event.RunID = l.runID
+	}
+	if event.ID == "" {
+		event.ID = EventID(event.URL)
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.err != nil {
+		return
+	}
+	// One write per line, so a crash leaves at most the last line cut short
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		l.err = err
+		log.Printf("Error writing the event log, dropping the events after: %v", err)
+	}
+}
+
+// Close closes the log and returns the first error writing it.
+func (l *EventLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.file.Close(); l.err == nil {
+		l.err = err
+	}
+	return l.err
+}
+
+// Path returns the file of the log.
+func (l *EventLog) Path() string {
+	if l == nil {
+		return ""
+	}
+	return l.file.Name()
+}
+
+// attachEvents sends the requests of a scrape's collector to its event log.
+func attachEvents(c *colly.Collector, events *EventLog) {
+	if events == nil {
+		return
+	}
+	c.OnRequest(func(r *colly.Request) {
+		r.Ctx.Put("events_start", time.Now())
+		events.Emit(CrawlEvent{Type: EventFetchStarted, URL: r.URL.String()})
+	})
+	fetched := func(r *colly.Response, err error) {
+		event := CrawlEvent{Type: EventFetchCompleted, URL: r.Request.URL.String(), StatusCode: r.StatusCode, Bytes: len(r.Body)}
+		if start, ok := r.Ctx.GetAny("events_start").(time.Time); ok {
+			event.DurationMS = durationMS(time.Since(start))
+		}
+		if err != nil {
+			event.Error = err.Error()
+		}
+		events.Emit(event)
+		r.Ctx.Put("events_parse", time.Now())
+	}
+	c.OnResponse(func(r *colly.Response) { fetched(r, nil) })
+	c.OnError(fetched)
+	c.OnScraped(func(r *colly.Response) {
+		event := CrawlEvent{Type: EventExtractCompleted, URL: r.Request.URL.String()}
+		if start, ok := r.Ctx.GetAny("events_parse").(time.Time); ok {
+			event.DurationMS = durationMS(time.Since(start))
+		}
+		events.Emit(event)
+	})
+}
+
+// ReadEvents reads an event log. A last line cut short by a crash is left out.
+func ReadEvents(path string) ([]CrawlEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	events := []CrawlEvent{}
+	reader := bufio.NewReader(f)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(data) > 0 && data[len(data)-1] == '\n' {
+			var event CrawlEvent
+			if err := json.Unmarshal(data, &event); err != nil {
+				return nil, fmt.Errorf("%s line %d: %w", path, line, err)
+			}
+			events = append(events, event)
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+// LoadEvents reads the event log of run runID in dir, of the latest run with one when runID is empty.
+func LoadEvents(dir, runID string) ([]CrawlEvent, error) {
+	if runID != "" {
+		if _, err := RunStartTime(runID); err != nil {
+			return nil, err
+		}
+		return ReadEvents(filepath.Join(dir, runID, eventLogFile))
+	}
+	runs, err := ListRuns(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		path := filepath.Join(dir, runs[i], eventLogFile)
+		if _, err := os.Stat(path); err == nil {
+			return ReadEvents(path)
+		}
+	}
+	return nil, fmt.Errorf("no run with an event log in %s", dir)
+}
@@ -0,0 +1,214 @@
+package crab
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// maxSheetNameLength is the longest worksheet name Excel accepts.
+const maxSheetNameLength = 31
+
+// ExportXLSX writes all of the given datasets into a single XLSX workbook at filename, one worksheet per
+// dataset. The first row of each sheet holds the column names and is frozen so it stays visible while
+// scrolling. Cells that hold plain numbers are written as numeric cells so they can be used in formulas,
+// everything else is written as text.
+func ExportXLSX(datasets []Dataset, filename string) error {
+	if len(datasets) == 0 {
+		return fmt.Errorf("no datasets to export")
+	}
+
+	file, err := CreateAtomic(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Abort()
+
+	zw := zip.NewWriter(file)
+	sheetNames := uniqueSheetNames(datasets)
+
+	if err := writeZipEntry(zw, "[Content_Types].xml", xlsxContentTypes(len(datasets))); err != nil {
+		return err
+	}
+	if err := writeZipEntry(zw, "_rels/.rels", xlsxRootRels); err != nil {
+		return err
+	}
+	if err := writeZipEntry(zw, "xl/workbook.xml", xlsxWorkbook(sheetNames)); err != nil {
+		return err
+	}
+	if err := writeZipEntry(zw, "xl/_rels/workbook.xml.rels", xlsxWorkbookRels(len(datasets))); err != nil {
+		return err
+	}
+
+	for i, ds := range datasets {
+		w, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return err
+		}
+		if err := writeWorksheet(w, ds); err != nil {
+			return fmt.Errorf("writing sheet %s: %w", ds.Name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := file.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Exported %d datasets to %s", len(datasets), filename)
+	return nil
+}
+
+// ExportScrapedDatasetsXLSX loads every scraped dataset in dataDir and writes them into one workbook.
+func ExportScrapedDatasetsXLSX(dataDir, filename string) error {
+	datasets, err := LoadScrapedDatasets(dataDir)
+	if err != nil {
+		return err
+	}
+	return ExportXLSX(datasets, filename)
+}
+
+// writeWorksheet streams a single dataset as a SpreadsheetML worksheet with a frozen header row.
+func writeWorksheet(w io.Writer, ds Dataset) error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0">`)
+	b.WriteString(`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>`)
+	b.WriteString(`</sheetView></sheetViews><sheetData>`)
+
+	writeRow := func(rowNum int, cells []string, typed bool) {
+		fmt.Fprintf(&b, `<row r="%d">`, rowNum)
+		for col, value := range cells {
+			ref := xlsxColumnName(col) + strconv.Itoa(rowNum)
+			if number, ok := xlsxNumber(value); typed && ok {
+				fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, number)
+				continue
+			}
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, xmlEscape(value))
+		}
+		b.WriteString(`</row>`)
+	}
+
+	writeRow(1, ds.Columns, false)
+	for i, row := range ds.Rows {
+		writeRow(i+2, row, true)
+	}
+
+	b.WriteString(`</sheetData></worksheet>`)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// xlsxNumber reports whether a cell is a plain number and returns it in the form Excel expects.
+func xlsxNumber(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", false
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return "", false
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64), true
+}
+
+// xlsxColumnName converts a zero based column index into a spreadsheet column name (0 -> A, 27 -> AB).
+func xlsxColumnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// uniqueSheetNames derives valid, unique worksheet names from the dataset names.
+func uniqueSheetNames(datasets []Dataset) []string {
+	invalid := strings.NewReplacer(":", "_", "\\", "_", "/", "_", "?", "_", "*", "_", "[", "_", "]", "_")
+	seen := make(map[string]bool)
+	names := make([]string, len(datasets))
+	for i, ds := range datasets {
+		base := invalid.Replace(ds.Name)
+		if base == "" {
+			base = "Sheet"
+		}
+		if len(base) > maxSheetNameLength {
+			base = base[:maxSheetNameLength]
+		}
+		name := base
+		for n := 2; seen[strings.ToLower(name)]; n++ {
+			suffix := fmt.Sprintf("_%d", n)
+			if len(base)+len(suffix) > maxSheetNameLength {
+				name = base[:maxSheetNameLength-len(suffix)] + suffix
+			} else {
+				name = base + suffix
+			}
+		}
+		seen[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+// writeZipEntry adds a file with the given content to the workbook archive.
+func writeZipEntry(zw *zip.Writer, name, content string) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, content)
+	return err
+}
+
+// xmlEscape escapes text for use inside an XML element.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+const xlsxRootRels = xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+	`</Relationships>`
+
+func xlsxContentTypes(sheets int) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+func xlsxWorkbook(sheetNames []string) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	for i, name := range sheetNames {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(name), i+1, i+1)
+	}
+	b.WriteString(`</sheets></workbook>`)
+	return b.String()
+}
+
+func xlsxWorkbookRels(sheets int) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := 1; i <= sheets; i++ {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
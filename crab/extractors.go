@@ -0,0 +1,329 @@
+package crab
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"log"
+	"net/url"
+	"path"
+	"plugin"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Extractor pulls records out of crawled pages, such as the products of a shop or the posts of a forum.
+// Extractors are registered for the domains and URL patterns they understand with RegisterExtractor; the
+// crawler runs the one matching each page it fetches and writes what it returns to extracted.jsonl.
+type Extractor interface {
+	Extract(page *ExtractorPage) ([]map[string]interface{}, error)
+}
+
+// ExtractorFunc adapts a function to an Extractor.
+type ExtractorFunc func(page *ExtractorPage) ([]map[string]interface{}, error)
+
+// Extract calls f.
+func (f ExtractorFunc) Extract(page *ExtractorPage) ([]map[string]interface{}, error) { return f(page) }
+
+// ExtractorPage is a fetched page handed to an Extractor.
+type ExtractorPage struct {
+	URL         *url.URL // The URL the body was served from
+	StatusCode  int
+	ContentType string
+	Body        []byte
+
+	doc    *goquery.Document
+	docErr error
+}
+
+// Document parses the page's HTML, once however often it is called.
+func (p *ExtractorPage) Document() (*goquery.Document, error) {
+	if p.doc == nil && p.docErr == nil {
+		p.doc, p.docErr = ParseDocument(p.Body)
+	}
+	return p.doc, p.docErr
+}
+
+// ExtractedRecord is one record an extractor found on a page.
+type ExtractedRecord struct {
+	Extractor string                 `json:"extractor"`
+	URL       string                 `json:"url"`
+	Fields    map[string]interface{} `json:"fields"`
+}
+
+// registeredExtractor is an extractor with the pattern of the URLs it handles.
+type registeredExtractor struct {
+	name      string
+	pattern   string
+	host      string // Glob of the host, e.g. "*.example.com"
+	path      string // Glob of the path; empty matches any
+	rest      bool   // The path ended in "/**", so it matches any path under it
+	extractor Extractor
+}
+
+var (
+	customExtractorsMu sync.RWMutex
+	customExtractors   []registeredExtractor
+)
+
+// RegisterExtractor registers extractor under name for the pages matching pattern, or replaces the
+// extractor registered under name. A pattern is a host, such as "books.toscrape.com" or "*.example.com",
+// optionally followed by a path, such as "shop.example.com/products/*". Both are globs in which *
+// matches within a dot or slash; a path ending in ** matches everything under it. When several patterns
+// match a page, the longest wins.
+func RegisterExtractor(name, pattern string, extractor Extractor) error {
+	registered, err := newRegisteredExtractor(name, pattern, extractor)
+	if err != nil {
+		return err
+	}
+	customExtractorsMu.Lock()
+	defer customExtractorsMu.Unlock()
+	customExtractors = addExtractor(customExtractors, registered)
+	return nil
+}
+
+// newRegisteredExtractor checks the name and pattern of an extractor as RegisterExtractor does.
+func newRegisteredExtractor(name, pattern string, extractor Extractor) (registeredExtractor, error) {
+	if name == "" || extractor == nil {
+		return registeredExtractor{}, fmt.Errorf("extractor %q needs a name and an implementation", name)
+	}
+	host, urlPath, _ := strings.Cut(strings.ToLower(pattern), "/")
+	if host == "" {
+		return registeredExtractor{}, fmt.Errorf("extractor %s: pattern %q has no host", name, pattern)
+	}
+	registered := registeredExtractor{name: name, pattern: pattern, host: host, extractor: extractor}
+	if urlPath != "" {
+		registered.path = "/" + urlPath
+		if strings.HasSuffix(registered.path, "/**") {
+			registered.path, registered.rest = strings.TrimSuffix(registered.path, "/**"), true
+		}
+		if strings.Contains(registered.path, "**") {
+			return registeredExtractor{}, fmt.Errorf("extractor %s: pattern %q may only end in /**", name, pattern)
+		}
+	}
+	if _, err := path.Match(registered.host, ""); err != nil {
+		return registeredExtractor{}, fmt.Errorf("extractor %s: invalid pattern %q: %v", name, pattern, err)
+	}
+	if _, err := path.Match(registered.path, ""); err != nil {
+		return registeredExtractor{}, fmt.Errorf("extractor %s: invalid pattern %q: %v", name, pattern, err)
+	}
+	return registered, nil
+}
+
+// addExtractor adds e to extractors, replacing the one of the same name, and keeps them ordered from the
+// longest pattern to the shortest.
+func addExtractor(extractors []registeredExtractor, e registeredExtractor) []registeredExtractor {
+	extractors = removeExtractor(extractors, e.name)
+	extractors = append(extractors, e)
+	sort.SliceStable(extractors, func(i, j int) bool { return len(extractors[i].pattern) > len(extractors[j].pattern) })
+	return extractors
+}
+
+// removeExtractor removes the extractor named name from extractors, if there is one.
+func removeExtractor(extractors []registeredExtractor, name string) []registeredExtractor {
+	for i := range extractors {
+		if extractors[i].name == name {
+			return append(extractors[:i:i], extractors[i+1:]...)
+		}
+	}
+	return extractors
+}
+
+// registeredExtractors returns a copy of the registered extractors.
+func registeredExtractors() []registeredExtractor {
+	customExtractorsMu.RLock()
+	defer customExtractorsMu.RUnlock()
+	return append([]registeredExtractor(nil), customExtractors...)
+}
+
+// UnregisterExtractor removes the extractor registered under name, if any.
+func UnregisterExtractor(name string) {
+	customExtractorsMu.Lock()
+	defer customExtractorsMu.Unlock()
+	customExtractors = removeExtractor(customExtractors, name)
+}
+
+// Extractors returns the registered customExtractors' patterns by name.
+func Extractors() map[string]string {
+	customExtractorsMu.RLock()
+	defer customExtractorsMu.RUnlock()
+	patterns := make(map[string]string, len(customExtractors))
+	for _, e := range customExtractors {
+		patterns[e.name] = e.pattern
+	}
+	return patterns
+}
+
+// matches reports whether the extractor handles pageURL.
+func (e registeredExtractor) matches(pageURL *url.URL) bool {
+	if ok, _ := path.Match(e.host, strings.ToLower(pageURL.Hostname())); !ok {
+		return false
+	}
+	if e.path == "" {
+		return true
+	}
+	urlPath := pageURL.EscapedPath()
+	if urlPath == "" {
+		urlPath = "/"
+	}
+	if e.rest {
+		// Only as many leading segments of the path as the pattern has need to match it
+		segments := strings.SplitAfter(urlPath, "/")
+		if depth := strings.Count(e.path, "/"); len(segments) > depth {
+			urlPath = strings.TrimSuffix(strings.Join(segments[:depth+1], ""), "/")
+		}
+	}
+	ok, _ := path.Match(e.path, urlPath)
+	return ok
+}
+
+// ExtractorFor returns the name and extractor registered for the most specific pattern matching rawURL.
+func ExtractorFor(rawURL string) (string, Extractor, bool) {
+	pageURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", nil, false
+	}
+	return extractorForURL(pageURL)
+}
+
+// extractorForURL is ExtractorFor of a parsed URL.
+func extractorForURL(pageURL *url.URL) (string, Extractor, bool) {
+	customExtractorsMu.RLock()
+	defer customExtractorsMu.RUnlock()
+	return findExtractor(customExtractors, pageURL)
+}
+
+// findExtractor returns the first of extractors, which are ordered by pattern length, matching pageURL.
+func findExtractor(extractors []registeredExtractor, pageURL *url.URL) (string, Extractor, bool) {
+	for _, e := range extractors {
+		if e.matches(pageURL) {
+			return e.name, e.extractor, true
+		}
+	}
+	return "", nil, false
+}
+
+// crawlExtractors returns the extractors of a crawl under config: the registered ones, and those of its
+// extractor plugins and script extractors, which are the crawl's own and replace registered ones of the
+// same name.
+func crawlExtractors(config Config) ([]registeredExtractor, error) {
+	extractors := registeredExtractors()
+	for _, file := range config.ExtractorPlugins {
+		opened, err := openExtractorPlugin(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range opened {
+			extractors = addExtractor(extractors, e)
+		}
+	}
+	for _, script := range config.ScriptExtractors {
+		extractor, err := CompileScriptExtractor(script)
+		if err != nil {
+			return nil, err
+		}
+		e, err := newRegisteredExtractor(script.Name, script.Pattern, extractor)
+		if err != nil {
+			return nil, err
+		}
+		extractors = addExtractor(extractors, e)
+	}
+	return extractors, nil
+}
+
+// extractPage runs the extractor of extractors matching a fetched HTML page, if any. An extractor that
+// panics fails its page rather than the crawl.
+func extractPage(extractors []registeredExtractor, page FetchedPage) (records []ExtractedRecord, err error) {
+	if page.Body == nil || page.pageURL == nil {
+		return nil, nil
+	}
+	name, extractor, ok := findExtractor(extractors, page.pageURL)
+	if !ok {
+		return nil, nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			records, err = nil, fmt.Errorf("extractor %s panicked on %s: %v", name, page.URL, r)
+		}
+	}()
+	fields, err := extractor.Extract(&ExtractorPage{URL: page.pageURL, StatusCode: page.StatusCode,
+		ContentType: page.ContentType, Body: page.Body})
+	if err != nil {
+		return nil, fmt.Errorf("extractor %s on %s: %w", name, page.URL, err)
+	}
+	for _, f := range fields {
+		records = append(records, ExtractedRecord{Extractor: name, URL: page.URL, Fields: f})
+	}
+	return records, nil
+}
+
+// LoadExtractorPlugins opens Go plugins (built with go build -buildmode=plugin) whose init functions
+// register extractors with RegisterExtractor. Plugins must be built with the same Go version and crab
+// sources as the program loading them, and only load on the platforms the plugin package supports.
+func LoadExtractorPlugins(paths []string) error {
+	for _, file := range paths {
+		opened, err := openExtractorPlugin(file)
+		if err != nil {
+			return err
+		}
+		customExtractorsMu.Lock()
+		for _, e := range opened {
+			customExtractors = addExtractor(customExtractors, e)
+		}
+		customExtractorsMu.Unlock()
+		log.Printf("Loaded extractor plugin %s, %d extractors registered", file, len(opened))
+	}
+	return nil
+}
+
+// extractorPlugins holds the extractors each opened plugin registered by its path, as a plugin's init
+// functions only run the first time it is opened.
+var extractorPlugins struct {
+	sync.Mutex
+	opened map[string][]registeredExtractor
+}
+
+// openExtractorPlugin opens a plugin and returns the extractors its init functions register, taking them
+// back out of the registry so they only apply where the plugin is asked for.
+func openExtractorPlugin(file string) ([]registeredExtractor, error) {
+	extractorPlugins.Lock()
+	defer extractorPlugins.Unlock()
+	if opened, ok := extractorPlugins.opened[file]; ok {
+		return opened, nil
+	}
+	before := registeredExtractors()
+	if _, err := plugin.Open(file); err != nil {
+		return nil, fmt.Errorf("loading extractor plugin %s: %w", file, err)
+	}
+	var opened []registeredExtractor
+	customExtractorsMu.Lock()
+	for _, e := range customExtractors {
+		if !containsExtractor(before, e) {
+			opened = append(opened, e)
+		}
+	}
+	for _, e := range opened {
+		customExtractors = removeExtractor(customExtractors, e.name)
+		for _, previous := range before {
+			if previous.name == e.name {
+				customExtractors = addExtractor(customExtractors, previous)
+			}
+		}
+	}
+	customExtractorsMu.Unlock()
+	if extractorPlugins.opened == nil {
+		extractorPlugins.opened = map[string][]registeredExtractor{}
+	}
+	extractorPlugins.opened[file] = opened
+	return opened, nil
+}
+
+// containsExtractor reports whether extractors holds an extractor of e's name and pattern.
+func containsExtractor(extractors []registeredExtractor, e registeredExtractor) bool {
+	for _, other := range extractors {
+		if other.name == e.name && other.pattern == e.pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,300 @@
+package crab
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultFeedInterval is how often a feed is polled when its config gives no interval.
+	defaultFeedInterval = time.Hour
+	// feedSeenRetention is how long entries are remembered; feeds rarely carry entries this old.
+	feedSeenRetention = 90 * 24 * time.Hour
+	// maxFeedSize bounds the feed documents read.
+	maxFeedSize = 10 << 20
+)
+
+// URLSource discovers URLs to crawl. GetURLsToCrawl's seed list and RSS/Atom feeds are both sources, so
+// the crawler can be fed from either without deep recursion.
+type URLSource interface {
+	Discover(ctx context.Context) ([]URLData, error)
+}
+
+// StaticSource always returns the same URLs.
+type StaticSource []URLData
+
+// Discover returns the static URL list.
+func (s StaticSource) Discover(ctx context.Context) ([]URLData, error) {
+	return s, nil
+}
+
+// FeedConfig is one RSS or Atom feed to poll for new entries.
+type FeedConfig struct {
+	URL             string `json:"url"`
+	IntervalMinutes int    `json:"interval_minutes"` // Poll interval, 60 when zero
+}
+
+// FeedEntry is one item of an RSS feed or entry of an Atom feed.
+type FeedEntry struct {
+	ID        string    `json:"id"` // guid or id, falling back to the link
+	Title     string    `json:"title"`
+	Link      string    `json:"link"`
+	Published time.Time `json:"published"`
+}
+
+// feedDocument matches RSS 2.0 (<rss><channel><item>), RSS 1.0 (<rdf:RDF><item>) and Atom
+// (<feed><entry>) documents.
+type feedDocument struct {
+	XMLName xml.Name
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []rssItem   `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title   string `xml:"title"`
+	Link    string `xml:"link"`
+	GUID    string `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+	Date    string `xml:"date"` // Dublin Core date used by RSS 1.0
+}
+
+type atomEntry struct {
+	Title     string `xml:"title"`
+	ID        string `xml:"id"`
+	Updated   string `xml:"updated"`
+	Published string `xml:"published"`
+	Links     []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+	} `xml:"link"`
+}
+
+// feedTimeLayouts are the date formats found in the wild, RFC 822 variants for RSS and RFC 3339 for Atom.
+var feedTimeLayouts = []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700", "2 Jan 2006 15:04:05 -0700"}
+
+// ParseFeed parses an RSS or Atom document. Relative links are resolved against feedURL.
+func ParseFeed(data []byte, feedURL string) ([]FeedEntry, error) {
+	var doc feedDocument
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing feed %s: %w", feedURL, err)
+	}
+	base, _ := url.Parse(feedURL)
+
+	entries := []FeedEntry{}
+	add := func(id, title, link, date string) {
+		link = strings.TrimSpace(link)
+		if link == "" {
+			return
+		}
+		if base != nil {
+			if ref, err := url.Parse(link); err == nil {
+				link = base.ResolveReference(ref).String()
+			}
+		}
+		if id = strings.TrimSpace(id); id == "" {
+			id = link
+		}
+		entries = append(entries, FeedEntry{ID: id, Title: strings.TrimSpace(title), Link: link, Published: parseFeedTime(date)})
+	}
+
+	switch doc.XMLName.Local {
+	case "rss", "RDF":
+		for _, item := range append(doc.Channel.Items, doc.Items...) {
+			date := item.PubDate
+			if date == "" {
+				date = item.Date
+			}
+			add(item.GUID, item.Title, item.Link, date)
+		}
+	case "feed":
+		for _, entry := range doc.Entries {
+			var link string
+			for _, l := range entry.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					link = l.Href
+					break
+				}
+			}
+			date := entry.Published
+			if date == "" {
+				date = entry.Updated
+			}
+			add(entry.ID, entry.Title, link, date)
+		}
+	default:
+		return nil, fmt.Errorf("%s is not an RSS or Atom feed (root element <%s>)", feedURL, doc.XMLName.Local)
+	}
+	return entries, nil
+}
+
+// parseFeedTime parses a feed date, returning the zero time if the format is not recognized.
+func parseFeedTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range feedTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// FeedSource polls RSS and Atom feeds and discovers the links of entries it has not seen before. With a
+// StateFile, the entries seen survive restarts so old entries are not crawled again.
+type FeedSource struct {
+	Feeds     []FeedConfig
+	StateFile string
+	Client    *http.Client
+
+	mu       sync.Mutex
+	seen     map[string]time.Time // Entry ID -> when it was first seen
+	lastPoll map[string]time.Time // Feed URL -> last poll
+	loaded   bool
+}
+
+// NewFeedSource creates a source for the given feeds, remembering seen entries in stateFile if it is
+// not empty.
+func NewFeedSource(feeds []FeedConfig, stateFile string) *FeedSource {
+	return &FeedSource{Feeds: feeds, StateFile: stateFile, Client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Discover polls every feed that is due and returns the links of new entries.
+func (s *FeedSource) Discover(ctx context.Context) ([]URLData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.loaded {
+		s.loadState()
+	}
+
+	now := time.Now()
+	var found []URLData
+	var errs []string
+	for _, feed := range s.Feeds {
+		interval := time.Duration(feed.IntervalMinutes) * time.Minute
+		if interval <= 0 {
+			interval = defaultFeedInterval
+		}
+		if last, ok := s.lastPoll[feed.URL]; ok && now.Sub(last) < interval {
+			continue
+		}
+		s.lastPoll[feed.URL] = now
+
+		entries, err := s.fetch(ctx, feed.URL)
+		if err != nil {
+			log.Printf("Error polling feed %s: %v", feed.URL, err)
+			errs = append(errs, err.Error())
+			continue
+		}
+		for _, entry := range entries {
+			if _, ok := s.seen[entry.ID]; ok {
+				continue
+			}
+			s.seen[entry.ID] = now
+			found = append(found, URLData{URL: entry.Link})
+		}
+	}
+	if len(found) > 0 {
+		log.Printf("Discovered %d new feed entries", len(found))
+		s.saveState(now)
+	}
+	if len(errs) > 0 {
+		return found, fmt.Errorf("polling feeds: %s", strings.Join(errs, "; "))
+	}
+	return found, nil
+}
+
+// fetch downloads and parses one feed.
+func (s *FeedSource) fetch(ctx context.Context, feedURL string) ([]FeedEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", RequestUserAgent())
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8")
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching feed %s: status %d", feedURL, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedSize))
+	if err != nil {
+		return nil, err
+	}
+	return ParseFeed(data, feedURL)
+}
+
+// loadState reads the seen entries from the state file, if there is one.
+func (s *FeedSource) loadState() {
+	s.loaded = true
+	s.seen = make(map[string]time.Time)
+	s.lastPoll = make(map[string]time.Time)
+	if s.StateFile == "" {
+		return
+	}
+	data, err := os.ReadFile(s.StateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading feed state %s: %v", s.StateFile, err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &s.seen); err != nil {
+		log.Printf("Error parsing feed state %s: %v", s.StateFile, err)
+		s.seen = make(map[string]time.Time)
+	}
+}
+
+// saveState forgets entries older than feedSeenRetention and writes the rest to the state file.
+func (s *FeedSource) saveState(now time.Time) {
+	for id, seen := range s.seen {
+		if now.Sub(seen) > feedSeenRetention {
+			delete(s.seen, id)
+		}
+	}
+	if s.StateFile == "" {
+		return
+	}
+	data, err := json.MarshalIndent(s.seen, "", "  ")
+	if err == nil {
+		err = WriteFileAtomic(s.StateFile, data)
+	}
+	if err != nil {
+		log.Printf("Error writing feed state %s: %v", s.StateFile, err)
+	}
+}
+
+// WatchSource asks source for URLs every interval and passes any it discovers to enqueue, until ctx is
+// cancelled.
+func WatchSource(ctx context.Context, source URLSource, interval time.Duration, enqueue func([]URLData)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if urls, _ := source.Discover(ctx); len(urls) > 0 {
+			enqueue(urls)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package crab
+
+import (
+	"github.com/gocolly/colly"
+	"sort"
+	"strings"
+)
+
+// DefaultAgentName is the product token the crawler identifies itself with and looks up in robots.txt.
+const DefaultAgentName = "GoEngine"
+
+// HonestUserAgent identifies the crawler truthfully. It is sent instead of a random browser user agent
+// when honest mode is on and no identity is configured, and matches the agent name checked against
+// robots.txt.
+const HonestUserAgent = DefaultAgentName + "/1.0 (+" + defaultInfoURL + ")"
+
+const defaultInfoURL = "https://github.com/hseitaj/JustAFork"
+
+// FingerprintConfig controls how much requests vary from one to the next. With RandomizeHeaders set,
+// every request picks its Accept and Accept-Language values from the configured lists (or built-in
+// browser-like defaults) and randomly includes optional browser headers. Go's HTTP client always writes
+// headers in sorted order, so varying which headers are present is the closest available substitute for
+// shuffling their order.
+//
+// HonestMode overrides everything else: requests use the crawler's identity (see IdentityUserAgent) and
+// plain, fixed headers, with a From header when Contact is set. AgentName is also the agent robots.txt
+// rules are matched against, in and out of honest mode.
+type FingerprintConfig struct {
+	HonestMode       bool     `json:"honest_mode"`
+	RandomizeHeaders bool     `json:"randomize_headers"`
+	Accept           []string `json:"accept"`
+	AcceptLanguage   []string `json:"accept_language"`
+	AgentName        string   `json:"agent_name"` // DefaultAgentName when empty
+	InfoURL          string   `json:"info_url"`   // Page describing the crawler and how to reach its operator
+	Contact          string   `json:"contact"`    // Operator email, e.g. "admin@example.com"
+}
+
+// RobotsAgent returns the product token matched against robots.txt user-agent lines.
+func (f FingerprintConfig) RobotsAgent() string {
+	if f.AgentName == "" {
+		return DefaultAgentName
+	}
+	return f.AgentName
+}
+
+// IdentityUserAgent returns the user agent sent in honest mode, e.g.
+// "GoEngine/1.0 (+https://example.com/bot; admin@example.com)".
+func (f FingerprintConfig) IdentityUserAgent() string {
+	infoURL := f.InfoURL
+	if infoURL == "" {
+		infoURL = defaultInfoURL
+	}
+	comment := []string{"+" + infoURL}
+	if f.Contact != "" {
+		comment = append(comment, f.Contact)
+	}
+	return f.RobotsAgent() + "/1.0 (" + strings.Join(comment, "; ") + ")"
+}
+
+// RobotsAgent returns the robots.txt agent of the current configuration.
+func RobotsAgent() string {
+	return CurrentConfig().Fingerprint.RobotsAgent()
+}
+
+var defaultAcceptValues = []string{
+	"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+	"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,*/*;q=0.8",
+	"text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,image/apng,*/*;q=0.8",
+	"text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
+}
+
+var defaultAcceptLanguageValues = []string{
+	"en-US,en;q=0.9",
+	"en-US,en;q=0.5",
+	"en-GB,en;q=0.9,en-US;q=0.8",
+	"en-US,en;q=0.9,es;q=0.8",
+	"en-CA,en-US;q=0.9,en;q=0.8",
+}
+
+// optionalHeaders are sent or left out at random so consecutive requests do not share one header set.
+var optionalHeaders = map[string]string{
+	"Upgrade-Insecure-Requests": "1",
+	"DNT":                       "1",
+	"Sec-Fetch-Dest":            "document",
+	"Sec-Fetch-Mode":            "navigate",
+	"Sec-Fetch-Site":            "none",
+	"Cache-Control":             "max-age=0",
+}
+
+// RequestUserAgent returns the user agent for a new collector: the configured identity in honest mode, a
+// random browser user agent otherwise.
+func RequestUserAgent() string {
+	return requestUserAgent(CurrentConfig().Fingerprint)
+}
+
+// requestUserAgent is RequestUserAgent under config.
+func requestUserAgent(config FingerprintConfig) string {
+	if config.HonestMode {
+		return config.IdentityUserAgent()
+	}
+	return GetRandomUserAgent()
+}
+
+// RequestHeaders returns the headers to add to one request under the given config.
+func (f FingerprintConfig) RequestHeaders() map[string]string {
+	if f.HonestMode {
+		headers := map[string]string{"Accept": "text/html,application/xhtml+xml,*/*"}
+		if f.Contact != "" {
+			headers["From"] = f.Contact
+		}
+		return headers
+	}
+	if !f.RandomizeHeaders {
+		return nil
+	}
+
+	accept := f.Accept
+	if len(accept) == 0 {
+		accept = defaultAcceptValues
+	}
+	languages := f.AcceptLanguage
+	if len(languages) == 0 {
+		languages = defaultAcceptLanguageValues
+	}
+
+	headers := map[string]string{
+		"Accept":          accept[randIntn(len(accept))],
+		"Accept-Language": languages[randIntn(len(languages))],
+	}
+	// Visit the optional headers in a fixed order so a seeded run makes the same choices.
+	names := make([]string, 0, len(optionalHeaders))
+	for name := range optionalHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if randIntn(2) == 0 {
+			headers[name] = optionalHeaders[name]
+		}
+	}
+	return headers
+}
+
+// ApplyFingerprint sets the configured headers on every request made by the collector.
+func ApplyFingerprint(c *colly.Collector) {
+	applyFingerprint(c, CurrentConfig)
+}
+
+// applyFingerprint is ApplyFingerprint with the settings of config, read at every request.
+func applyFingerprint(c *colly.Collector, config func() Config) {
+	c.OnRequest(func(r *colly.Request) {
+		config := config().Fingerprint
+		if config.HonestMode {
+			r.Headers.Set("User-Agent", config.IdentityUserAgent())
+		}
+		for name, value := range config.RequestHeaders() {
+			r.Headers.Set(name, value)
+		}
+	})
+}
@@ -0,0 +1,241 @@
+package crab
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Source pages of the single-page table scrapers.
+const (
+	airfareURL   = "https://www.usinflationcalculator.com/inflation/airfare-inflation/"
+	inflationURL = "https://www.usinflationcalculator.com/inflation/current-inflation-rates/"
+	gasolineURL  = "https://www.usinflationcalculator.com/gasoline-prices-adjusted-for-inflation/"
+	housingURL   = "https://www.kaggle.com/datasets/ahmedshahriarsakib/usa-real-estate-dataset"
+)
+
+// scraperClient fetches the pages of the single-page scrapers. Its transport is swapped for a
+// FixtureTransport by UseFixtures.
+var scraperClient = &http.Client{Timeout: 60 * time.Second}
+
+// fixtureScraper is a single-page scraper split into the page it fetches and its extraction logic, so the
+// extraction can be run against a recorded copy of the page.
+type fixtureScraper struct {
+	URL     string
+	Extract func(doc *goquery.Document) interface{}
+	Regions []string // The only elements Extract reads, or nil for the whole page
+}
+
+// fixtureScrapers lists the scrapers that support fixtures by name.
+var fixtureScrapers = map[string]fixtureScraper{
+	"airfare": {airfareURL, func(doc *goquery.Document) interface{} {
+		return ExtractAirfareData(doc, airfareURL)
+	}, tableRegions},
+	"inflation": {inflationURL, func(doc *goquery.Document) interface{} { return ExtractInflationData(doc) }, tableRegions},
+	"gasoline":  {gasolineURL, func(doc *goquery.Document) interface{} { return ExtractGasolineData(doc) }, tableRegions},
+	"housing":   {housingURL, func(doc *goquery.Document) interface{} { return ExtractPropertyData(doc) }, nil},
+}
+
+// FixtureScrapers returns the names of the scrapers that can be recorded and replayed, sorted.
+func FixtureScrapers() []string {
+	names := make([]string, 0, len(fixtureScrapers))
+	for name := range fixtureScrapers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FixtureTransport records responses into Dir or replays them from it. Recorded pages are sanitized and
+// only their body is kept, so cookies and other response headers never reach the fixtures.
+type FixtureTransport struct {
+	Dir    string
+	Record bool              // Fetch through Next and save the page; otherwise serve it from Dir
+	Next   http.RoundTripper // http.DefaultTransport when nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *FixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := FixturePath(t.Dir, req.URL.String())
+	if !t.Record {
+		body, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("no fixture for %s: %w", req.URL, err)
+		}
+		return fixtureResponse(req, http.StatusOK, body), nil
+	}
+
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Error pages are passed through but not recorded.
+		return fixtureResponse(req, resp.StatusCode, body), nil
+	}
+	body = SanitizeFixture(body)
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := WriteFileAtomic(path, body); err != nil {
+		return nil, err
+	}
+	return fixtureResponse(req, resp.StatusCode, body), nil
+}
+
+// fixtureResponse builds the response served for a fixture.
+func fixtureResponse(req *http.Request, status int, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// FixturePath returns the file a page is recorded to: its host and path flattened into one name, with a
+// hash of the query string when there is one.
+func FixturePath(dir, rawURL string) string {
+	name := rawURL
+	query := ""
+	if u, err := url.Parse(rawURL); err == nil {
+		name, query = u.Host+u.Path, u.RawQuery
+	}
+	name = strings.Trim(fixtureNameChars.ReplaceAllString(name, "_"), "_")
+	if query != "" {
+		sum := sha256.Sum256([]byte(query))
+		name += "_" + hex.EncodeToString(sum[:])[:12]
+	}
+	return filepath.Join(dir, name+".html")
+}
+
+var fixtureNameChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// Patterns removed from recorded pages: scripts and embeds carry tracking IDs and session state but no
+// data, comments often hold build details, and hidden input values are usually CSRF tokens.
+var (
+	fixtureStrip       = regexp.MustCompile(`(?is)<script\b.*?</script>|<noscript\b.*?</noscript>|<iframe\b.*?</iframe>|<!--.*?-->`)
+	fixtureHiddenValue = regexp.MustCompile(`(?i)(<input\b[^>]*type=["']?hidden["']?[^>]*\bvalue=)("[^"]*"|'[^']*'|[^\s>]+)`)
+)
+
+// SanitizeFixture removes scripts, embeds, comments and hidden form values from a recorded page.
+func SanitizeFixture(body []byte) []byte {
+	body = fixtureStrip.ReplaceAll(body, nil)
+	return fixtureHiddenValue.ReplaceAll(body, []byte(`$1""`))
+}
+
+// UseFixtures makes the single-page scrapers record their pages into dir, or replay them from it when
+// record is false, so they can run without network access. It returns a function restoring the network.
+func UseFixtures(dir string, record bool) (restore func()) {
+	previous := scraperClient.Transport
+	scraperClient.Transport = &FixtureTransport{Dir: dir, Record: record, Next: previous}
+	return func() { scraperClient.Transport = previous }
+}
+
+// tableRegions is the region list of scrapers that only read the page's tables.
+var tableRegions = []string{"table"}
+
+// fetchScraperDocument fetches a scraper's page and parses it, or only the given regions of it (see
+// ParseRegions).
+func fetchScraperDocument(client *http.Client, rawURL string, regions ...string) (*goquery.Document, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", RequestUserAgent())
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("status code error: %d %s", res.StatusCode, res.Status)
+	}
+	if body, ok := renderedBody(context.Background(), CurrentConfig(), rawURL); ok {
+		if len(regions) == 0 {
+			return readDocument(bytes.NewReader(body))
+		}
+		return ParseRegions(body, regions...)
+	}
+	if len(regions) == 0 {
+		return readDocument(res.Body)
+	}
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if _, err := buf.ReadFrom(res.Body); err != nil {
+		return nil, err
+	}
+	return ParseRegions(buf.Bytes(), regions...)
+}
+
+// RecordFixture fetches a scraper's page and saves a sanitized copy under dir/<name>/. It returns the
+// fixture's path and the number of records extracted from it, so an empty extraction is noticed while
+// recording rather than in the tests.
+func RecordFixture(dir, name string) (string, int, error) {
+	scraper, ok := fixtureScrapers[name]
+	if !ok {
+		return "", 0, fmt.Errorf("no scraper named %q (have %s)", name, strings.Join(FixtureScrapers(), ", "))
+	}
+	client := &http.Client{Timeout: scraperClient.Timeout, Transport: &FixtureTransport{Dir: filepath.Join(dir, name), Record: true}}
+	doc, err := fetchScraperDocument(client, scraper.URL, scraper.Regions...)
+	if err != nil {
+		return "", 0, err
+	}
+	return FixturePath(filepath.Join(dir, name), scraper.URL), recordCount(scraper.Extract(doc)), nil
+}
+
+// ExtractFixture runs a scraper's extraction against its fixture in dir/<name>/ and returns the records,
+// e.g. []YearData for "inflation".
+func ExtractFixture(dir, name string) (interface{}, error) {
+	scraper, ok := fixtureScrapers[name]
+	if !ok {
+		return nil, fmt.Errorf("no scraper named %q (have %s)", name, strings.Join(FixtureScrapers(), ", "))
+	}
+	client := &http.Client{Transport: &FixtureTransport{Dir: filepath.Join(dir, name)}}
+	doc, err := fetchScraperDocument(client, scraper.URL, scraper.Regions...)
+	if err != nil {
+		return nil, err
+	}
+	return scraper.Extract(doc), nil
+}
+
+// recordCount returns the length of an extracted slice of records.
+func recordCount(records interface{}) int {
+	switch r := records.(type) {
+	case []AirfareData:
+		return len(r)
+	case []YearData:
+		return len(r)
+	case []GasolineData:
+		return len(r)
+	case []PropertyData:
+		return len(r)
+	}
+	return 0
+}
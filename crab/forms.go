@@ -0,0 +1,127 @@
+package crab
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// FormConfig describes a form to fill in and submit before scraping, such as a site search. The result
+// pages are scraped with the domain's usual selectors and pagination.
+type FormConfig struct {
+	Selector string            // Selector of the form, e.g. "form#search"
+	Fields   map[string]string // Field values by input name; other fields keep their defaults
+	Submit   string            // Optional selector of the submit button whose name and value are sent
+}
+
+// FormSubmission is the request a browser would send when submitting a form.
+type FormSubmission struct {
+	Method string
+	URL    string
+	Values url.Values
+}
+
+// BuildFormSubmission reads the form's fields and their default values, hidden inputs and CSRF tokens
+// included, overrides them with fields, and resolves the form's action against pageURL.
+func BuildFormSubmission(form *goquery.Selection, pageURL *url.URL, config FormConfig) (FormSubmission, error) {
+	if form.Length() == 0 {
+		return FormSubmission{}, fmt.Errorf("form %q not found on %s", config.Selector, pageURL)
+	}
+	submission := FormSubmission{Method: http.MethodGet, URL: pageURL.String(), Values: url.Values{}}
+	if method := strings.ToUpper(strings.TrimSpace(form.AttrOr("method", ""))); method == http.MethodPost {
+		submission.Method = http.MethodPost
+	}
+	if action := strings.TrimSpace(form.AttrOr("action", "")); action != "" {
+		ref, err := url.Parse(action)
+		if err != nil {
+			return FormSubmission{}, fmt.Errorf("invalid form action %q: %w", action, err)
+		}
+		submission.URL = pageURL.ResolveReference(ref).String()
+	}
+
+	form.Find("input[name], select[name], textarea[name]").Each(func(_ int, field *goquery.Selection) {
+		name := field.AttrOr("name", "")
+		if _, disabled := field.Attr("disabled"); disabled {
+			return
+		}
+		switch goquery.NodeName(field) {
+		case "select":
+			option := field.Find("option[selected]").First()
+			if option.Length() == 0 {
+				option = field.Find("option").First()
+			}
+			if option.Length() > 0 {
+				submission.Values.Add(name, option.AttrOr("value", strings.TrimSpace(option.Text())))
+			}
+		case "textarea":
+			submission.Values.Add(name, field.Text())
+		default:
+			switch strings.ToLower(field.AttrOr("type", "text")) {
+			case "submit", "button", "image", "reset", "file":
+				return // Buttons are only sent when they are the one clicked
+			case "checkbox", "radio":
+				if _, checked := field.Attr("checked"); !checked {
+					return
+				}
+				submission.Values.Add(name, field.AttrOr("value", "on"))
+			default:
+				submission.Values.Add(name, field.AttrOr("value", ""))
+			}
+		}
+	})
+
+	if config.Submit != "" {
+		if button := form.Find(config.Submit).First(); button.Length() > 0 {
+			if name := button.AttrOr("name", ""); name != "" {
+				submission.Values.Set(name, button.AttrOr("value", ""))
+			}
+		}
+	}
+	for name, value := range config.Fields {
+		submission.Values.Set(name, value)
+	}
+
+	if submission.Method == http.MethodGet {
+		target, err := url.Parse(submission.URL)
+		if err != nil {
+			return FormSubmission{}, err
+		}
+		target.RawQuery = submission.Values.Encode()
+		submission.URL = target.String()
+	}
+	return submission, nil
+}
+
+// AttachForm makes the collector submit the configured form the first time it sees it, so the scrape
+// continues on the result pages. Result pages that repeat the form, as search results usually do, do
+// not submit it again.
+func AttachForm(c *colly.Collector, config FormConfig) {
+	if config.Selector == "" {
+		return
+	}
+	submitted := false
+	c.OnHTML(config.Selector, func(e *colly.HTMLElement) {
+		if submitted {
+			return
+		}
+		submitted = true
+		submission, err := BuildFormSubmission(e.DOM, e.Request.URL, config)
+		if err != nil {
+			log.Printf("Error submitting form on %s: %v", e.Request.URL, err)
+			return
+		}
+		log.Printf("Submitting form %s to %s", config.Selector, submission.URL)
+		if submission.Method == http.MethodPost {
+			err = e.Request.PostRaw(submission.URL, []byte(submission.Values.Encode()))
+		} else {
+			err = e.Request.Visit(submission.URL)
+		}
+		if err != nil {
+			log.Printf("Error submitting form on %s: %v", e.Request.URL, err)
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package crab
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// defaultFrontierMemory is how many pending URLs a frontier keeps in memory when FrontierConfig sets none.
+const defaultFrontierMemory = 100000
+
+// FrontierConfig bounds the memory of a crawl's pending URLs. Past about MemoryURLs, the most recently
+// added URLs are spilled to files under Dir and read back when the crawl gets to them, so the queue keeps
+// its order however long it grows.
+type FrontierConfig struct {
+	MemoryURLs int    `json:"memory_urls"` // defaultFrontierMemory when zero
+	Dir        string `json:"dir"`         // Where to spill; the system's temporary directory when empty
+	Follow     bool   `json:"follow"`      // Also crawl the links found on the pages, on the hosts of the seeds
+}
+
+// Frontier is a first-in first-out queue of the URLs a crawl has yet to fetch that holds each URL once
+// and spills to disk past its memory budget. It remembers the URLs it was given by 64-bit hash, so a
+// repeat is dropped at a fraction of the memory of the URL. Its methods are safe for concurrent use.
+type Frontier struct {
+	config FrontierConfig
+
+	mu       sync.Mutex
+	head     []URLData         // Next to pop
+	segments []frontierSegment // Spilled files, oldest first, which come after head
+	tail     []URLData         // Last pushed, which come after the segments
+	length   int
+	domains  map[string]int // Pending URLs by host
+	seen     map[uint64]struct{}
+	dir      string // Created with the first spill
+	spilled  int
+}
+
+// frontierSegment is a file of spilled URLs.
+type frontierSegment struct {
+	name string
+	urls int
+}
+
+// NewFrontier creates an empty frontier.
+func NewFrontier(config FrontierConfig) *Frontier {
+	if config.MemoryURLs <= 0 {
+		config.MemoryURLs = defaultFrontierMemory
+	}
+	return &Frontier{config: config, seen: make(map[uint64]struct{}), domains: map[string]int{}}
+}
+
+// Push adds urlData to the end of the queue and reports whether it was added, which it is not when its
+// URL was pushed before.
+func (f *Frontier) Push(urlData URLData) (bool, error) {
+	h := fnv.New64a()
+	h.Write([]byte(urlData.URL))
+	key := h.Sum64()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.seen[key]; ok {
+		return false, nil
+	}
+	f.seen[key] = struct{}{}
+	f.tail = append(f.tail, urlData)
+	f.length++
+	f.domains[frontierDomain(urlData.URL)]++
+	// Spilling in files of half the budget keeps them few, and what is loaded back within the budget
+	if len(f.head)+len(f.tail) <= f.config.MemoryURLs || len(f.tail) < (f.config.MemoryURLs+1)/2 {
+		return true, nil
+	}
+	if err := f.spill(); err != nil {
+		// The URLs stay in memory, to be spilled with the next ones
+		return true, err
+	}
+	return true, nil
+}
+
+// spill writes the tail to a new segment file.
+func (f *Frontier) spill() error {
+	if f.dir == "" {
+		dir, err := os.MkdirTemp(f.config.Dir, "crab-frontier-")
+		if err != nil {
+			return fmt.Errorf("spilling the frontier: %w", err)
+		}
+		f.dir = dir
+	}
+	name := filepath.Join(f.dir, fmt.Sprintf("segment-%06d.jsonl", f.spilled))
+	file, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("spilling the frontier: %w", err)
+	}
+	w := bufio.NewWriter(file)
+	encoder := json.NewEncoder(w)
+	for _, urlData := range f.tail {
+		if err = encoder.Encode(urlData); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(name)
+		return fmt.Errorf("spilling the frontier: %w", err)
+	}
+	pipelineMetrics.Add("frontier_spilled", int64(len(f.tail)))
+	f.segments = append(f.segments, frontierSegment{name: name, urls: len(f.tail)})
+	f.spilled++
+	f.tail = nil
+	return nil
+}
+
+// Pop removes the URL at the front of the queue and returns it; ok is false when the queue is empty. The
+// URLs of a spilled file that can no longer be read are logged and skipped.
+func (f *Frontier) Pop() (urlData URLData, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.head) == 0 {
+		if len(f.segments) == 0 {
+			f.head, f.tail = f.tail, nil
+			break
+		}
+		segment := f.segments[0]
+		f.segments = f.segments[1:]
+		f.load(segment)
+	}
+	if len(f.head) == 0 {
+		return URLData{}, false
+	}
+	urlData, f.head = f.head[0], f.head[1:]
+	f.length--
+	if domain := frontierDomain(urlData.URL); f.domains[domain] <= 1 {
+		delete(f.domains, domain)
+	} else {
+		f.domains[domain]--
+	}
+	return urlData, true
+}
+
+// frontierDomain returns the host of rawURL the frontier counts it under.
+func frontierDomain(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Hostname() != "" {
+		return strings.ToLower(u.Hostname())
+	}
+	return ""
+}
+
+// load reads a segment file into head and removes it.
+func (f *Frontier) load(segment frontierSegment) {
+	defer os.Remove(segment.name)
+	urls := make([]URLData, 0, segment.urls)
+	file, err := os.Open(segment.name)
+	if err == nil {
+		decoder := json.NewDecoder(bufio.NewReader(file))
+		for err == nil && decoder.More() {
+			var urlData URLData
+			if err = decoder.Decode(&urlData); err == nil {
+				urls = append(urls, urlData)
+			}
+		}
+		file.Close()
+	}
+	if err != nil {
+		log.Printf("Error reading the spilled frontier, %d URLs lost: %v", segment.urls-len(urls), err)
+		f.length -= segment.urls - len(urls)
+	}
+	f.head = urls
+}
+
+// Len returns the number of URLs in the queue.
+func (f *Frontier) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.length
+}
+
+// Domains returns the number of URLs in the queue by host. The URLs of a spilled file that could not be
+// read back are still counted.
+func (f *Frontier) Domains() map[string]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	domains := make(map[string]int, len(f.domains))
+	for domain, n := range f.domains {
+		domains[domain] = n
+	}
+	return domains
+}
+
+// Close empties the queue and removes its spilled files.
+func (f *Frontier) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.head, f.tail, f.segments, f.length = nil, nil, nil, 0
+	f.domains = map[string]int{}
+	if f.dir == "" {
+		return nil
+	}
+	dir := f.dir
+	f.dir = ""
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("Error removing the spilled frontier %s: %v", dir, err)
+		return err
+	}
+	return nil
+}
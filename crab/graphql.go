@@ -0,0 +1,186 @@
+package crab
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// GraphQLTarget is a GraphQL endpoint ingested like a JSON target: the query's items are selected with
+// ItemsPath and mapped into records with Fields. Relay-style cursor pagination is supported by passing
+// the cursor found at CursorPath back as the CursorVariable until HasNextPath is false.
+type GraphQLTarget struct {
+	Name           string                 `json:"name"`
+	URL            string                 `json:"url"`
+	Query          string                 `json:"query"`
+	Variables      map[string]interface{} `json:"variables"`
+	Headers        map[string]string      `json:"headers"`
+	Token          string                 `json:"token"`      // Bearer token, usually "secret:<name>"
+	TokenEnv       string                 `json:"token_env"`  // Environment variable holding the token, when Token is empty
+	ItemsPath      string                 `json:"items_path"` // e.g. "$.data.products.edges[*].node"
+	Fields         []JSONField            `json:"fields"`
+	CursorVariable string                 `json:"cursor_variable"` // e.g. "after"
+	CursorPath     string                 `json:"cursor_path"`     // e.g. "$.data.products.pageInfo.endCursor"
+	HasNextPath    string                 `json:"has_next_path"`   // e.g. "$.data.products.pageInfo.hasNextPage"
+	MaxPages       int                    `json:"max_pages"`       // 100 when zero
+	Schema         map[string]interface{} `json:"schema"`          // Optional JSON Schema of every response
+}
+
+// graphQLResponse is the envelope of every GraphQL response.
+type graphQLResponse struct {
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// ScrapeGraphQLTarget runs the target's query, following its cursor while there are more pages, and
+// maps the items into records keyed by field name.
+func ScrapeGraphQLTarget(target GraphQLTarget, client *http.Client) ([]map[string]interface{}, error) {
+	if target.Query == "" || target.ItemsPath == "" {
+		return nil, fmt.Errorf("GraphQL target %s needs a query and an items_path", target.Name)
+	}
+	for _, field := range target.Fields {
+		if _, err := parseJSONPath(field.Path); err != nil {
+			return nil, fmt.Errorf("GraphQL target %s field %s: %w", target.Name, field.Name, err)
+		}
+	}
+	headers := make(map[string]string, len(target.Headers)+1)
+	for name, value := range target.Headers {
+		headers[name] = value
+	}
+	if target.Token != "" {
+		headers["Authorization"] = "Bearer " + target.Token
+	} else if target.TokenEnv != "" {
+		token := os.Getenv(target.TokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("GraphQL target %s: %s is not set", target.Name, target.TokenEnv)
+		}
+		headers["Authorization"] = "Bearer " + token
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	maxPages := target.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultMaxPages
+	}
+
+	variables := make(map[string]interface{}, len(target.Variables)+1)
+	for name, value := range target.Variables {
+		variables[name] = value
+	}
+	records := []map[string]interface{}{}
+	for page := 1; page <= maxPages; page++ {
+		doc, err := postGraphQL(client, target.URL, target.Query, variables, headers)
+		if err != nil {
+			return records, err
+		}
+		if err := checkSchema(target.Schema, doc, target.URL); err != nil {
+			return records, err
+		}
+		items, err := EvalJSONPath(doc, target.ItemsPath)
+		if err != nil {
+			return records, err
+		}
+		for _, item := range items {
+			records = append(records, mapJSONItem(item, target.Fields))
+		}
+
+		if target.CursorVariable == "" || target.CursorPath == "" || len(items) == 0 {
+			return records, nil
+		}
+		if target.HasNextPath != "" {
+			hasNext, err := EvalJSONPath(doc, target.HasNextPath)
+			if err != nil {
+				return records, err
+			}
+			if len(hasNext) == 0 || hasNext[0] != true {
+				return records, nil
+			}
+		}
+		cursors, err := EvalJSONPath(doc, target.CursorPath)
+		if err != nil {
+			return records, err
+		}
+		if len(cursors) == 0 || cursors[0] == nil || cursors[0] == variables[target.CursorVariable] {
+			return records, nil
+		}
+		variables[target.CursorVariable] = cursors[0]
+	}
+	log.Printf("GraphQL target %s stopped after %d pages", target.Name, maxPages)
+	return records, nil
+}
+
+// postGraphQL sends one query and returns the decoded response, failing if the server reported errors.
+func postGraphQL(client *http.Client, endpoint, query string, variables map[string]interface{}, headers map[string]string) (interface{}, error) {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", RequestUserAgent())
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var envelope graphQLResponse
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("decoding GraphQL response from %s (status %d): %w", endpoint, resp.StatusCode, err)
+	}
+	if len(envelope.Errors) > 0 {
+		messages := make([]string, len(envelope.Errors))
+		for i, e := range envelope.Errors {
+			messages[i] = e.Message
+		}
+		return nil, fmt.Errorf("GraphQL errors from %s: %s", endpoint, strings.Join(messages, "; "))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("querying %s: status %d", endpoint, resp.StatusCode)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// RunGraphQLTarget scrapes a GraphQL target into <name>_data.json in the run directory and notifies
+// webhooks.
+func RunGraphQLTarget(target GraphQLTarget) error {
+	return runRecordsTarget(target.Name, func() ([]map[string]interface{}, error) {
+		return ScrapeGraphQLTarget(target, nil)
+	})
+}
+
+// findGraphQLTarget returns the configured GraphQL target with the given name.
+func findGraphQLTarget(name string) (GraphQLTarget, bool) {
+	for _, target := range CurrentConfig().GraphQLTargets {
+		if target.Name == name {
+			return target, true
+		}
+	}
+	return GraphQLTarget{}, false
+}
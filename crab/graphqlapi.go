@@ -0,0 +1,479 @@
+package crab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// GraphQLSchema is the schema of the GraphQL API over the stored datasets, runs and predictions.
+// Dataset.total counts the rows before paging. Prediction.dataset is the version of a dataset the
+// prediction was made with: the latest one written before the prediction was requested. asOf and since
+// take RFC 3339 times, and times are returned in RFC 3339.
+const GraphQLSchema = `type Query {
+  datasets: [Dataset]
+  dataset(name: String!, run: String, asOf: String): Dataset
+  runs(kind: String, limit: Int): [Run]
+  run(id: String!): Run
+  predictions(since: String, limit: Int): [Prediction]
+  prediction(id: String!): Prediction
+}
+
+type Dataset {
+  name: String
+  runId: String
+  columns: [String]
+  total: Int
+  rows(from: Int, to: Int, columns: [String], limit: Int, offset: Int): [[String]]
+  records(from: Int, to: Int, columns: [String], limit: Int, offset: Int): [Object]
+  run: Run
+}
+
+type Run {
+  id: String
+  kind: String
+  startedAt: String
+  finishedAt: String
+  files: [String]
+  datasets: [Dataset]
+  dataset(name: String!): Dataset
+}
+
+type Prediction {
+  id: String
+  state: String
+  inputs: [String]
+  results: [String]
+  backends: [String]
+  error: String
+  createdAt: String
+  finishedAt: String
+  dataset(name: String!): Dataset
+}
+`
+
+// PredictionRecord is a prediction request as the GraphQL API serves it.
+type PredictionRecord struct {
+	ID         string
+	State      JobState
+	Inputs     []string
+	Results    []string
+	Backends   []string
+	Error      string
+	CreatedAt  time.Time
+	FinishedAt time.Time
+}
+
+// PredictionSource looks up the stored predictions. Predictions are stored in the database, so the
+// programs that have one set it with SetPredictionSource; without it, the predictions fields fail.
+type PredictionSource interface {
+	Prediction(id string) (PredictionRecord, error)
+	Predictions(since time.Time) ([]PredictionRecord, error)
+}
+
+var (
+	predictionSourceMu sync.RWMutex
+	predictionSource   PredictionSource
+)
+
+// SetPredictionSource sets where the GraphQL API reads predictions from.
+func SetPredictionSource(source PredictionSource) {
+	predictionSourceMu.Lock()
+	defer predictionSourceMu.Unlock()
+	predictionSource = source
+}
+
+// currentPredictionSource returns the prediction source, or an error when none is set.
+func currentPredictionSource() (PredictionSource, error) {
+	predictionSourceMu.RLock()
+	defer predictionSourceMu.RUnlock()
+	if predictionSource == nil {
+		return nil, errors.New("predictions are not available without a database")
+	}
+	return predictionSource, nil
+}
+
+// defaultGraphQLListLimit caps the runs and predictions lists when no limit is given.
+const defaultGraphQLListLimit = 100
+
+// gqlDatasetArgs are the arguments selecting the rows of a dataset.
+var gqlDatasetArgs = []string{"from", "to", "columns", "limit", "offset"}
+
+// gqlRun is a run directory as the GraphQL API serves it.
+type gqlRun struct {
+	dir string
+	RunManifest
+}
+
+// loadGQLRun reads the manifest of a run, or what its ID tells of a run not finished yet.
+func loadGQLRun(dir, id string) (gqlRun, error) {
+	startedAt, err := RunStartTime(id)
+	if err != nil {
+		return gqlRun{}, err
+	}
+	run := gqlRun{dir: dir, RunManifest: RunManifest{RunID: id, StartedAt: startedAt}}
+	data, err := os.ReadFile(filepath.Join(dir, id, "manifest.json"))
+	if os.IsNotExist(err) {
+		if _, statErr := os.Stat(filepath.Join(dir, id)); statErr != nil {
+			return gqlRun{}, fmt.Errorf("no run %s", id)
+		}
+		return run, nil
+	} else if err != nil {
+		return gqlRun{}, err
+	}
+	if err := json.Unmarshal(data, &run.RunManifest); err != nil {
+		return gqlRun{}, fmt.Errorf("reading the manifest of run %s: %w", id, err)
+	}
+	return run, nil
+}
+
+// runIDAt returns an ID sorting after every run started up to t, to find the datasets as they stood then.
+func runIDAt(t time.Time) string {
+	return t.UTC().Format("20060102T150405.000Z") + "-ffffff"
+}
+
+// gqlTime formats a time of the API, or returns nil for the zero time.
+func gqlTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// gqlStrings returns a list of strings as a GraphQL scalar list.
+func gqlStrings(values []string) interface{} {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// gqlScalar is a field of a scalar read from the object.
+func gqlScalar(get func(v interface{}) interface{}) gqlFieldDef {
+	return gqlFieldDef{Resolve: func(v interface{}, _ gqlArgs) (interface{}, error) { return get(v), nil }}
+}
+
+// gqlDatasetQuery reads the row selection arguments of a dataset field.
+func gqlDatasetQuery(args gqlArgs) (DatasetQuery, error) {
+	var q DatasetQuery
+	var err error
+	for _, arg := range []struct {
+		name string
+		v    *int
+	}{{"from", &q.From}, {"to", &q.To}, {"limit", &q.Limit}, {"offset", &q.Offset}} {
+		if *arg.v, err = args.Int(arg.name); err != nil {
+			return q, err
+		}
+		if *arg.v < 0 {
+			return q, fmt.Errorf("argument %s must not be negative", arg.name)
+		}
+	}
+	if q.Limit > maxDatasetPageSize {
+		return q, fmt.Errorf("limit %d is over %d", q.Limit, maxDatasetPageSize)
+	}
+	q.Columns, err = args.Strings("columns")
+	return q, err
+}
+
+// datasetAsOf loads a dataset as of a run, or returns nil when no run up to it produced the dataset.
+func datasetAsOf(dir, name, runID string) (interface{}, error) {
+	if _, _, err := findDatasetRun(dir, name, runID); err != nil {
+		if known := datasetKnown(name); !known {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return LoadDatasetAsOf(dir, name, runID)
+}
+
+// datasetKnown reports whether name is one of the scraped datasets.
+func datasetKnown(name string) bool {
+	for _, source := range scrapedDatasetFiles {
+		if source.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// graphQLRoot builds the schema of the GraphQL API over the runs in dir.
+func graphQLRoot(dir string) *gqlType {
+	datasetType := &gqlType{Name: "Dataset"}
+	runType := &gqlType{Name: "Run"}
+	predictionType := &gqlType{Name: "Prediction"}
+	queryType := &gqlType{Name: "Query"}
+
+	datasetType.Fields = map[string]gqlFieldDef{
+		"name":    gqlScalar(func(v interface{}) interface{} { return v.(Dataset).Name }),
+		"runId":   gqlScalar(func(v interface{}) interface{} { return v.(Dataset).RunID }),
+		"columns": gqlScalar(func(v interface{}) interface{} { return gqlStrings(v.(Dataset).Columns) }),
+		"total":   gqlScalar(func(v interface{}) interface{} { return len(v.(Dataset).Rows) }),
+		"rows": {Args: gqlDatasetArgs, Resolve: func(v interface{}, args gqlArgs) (interface{}, error) {
+			q, err := gqlDatasetQuery(args)
+			if err != nil {
+				return nil, err
+			}
+			page, _, err := q.Apply(v.(Dataset))
+			if page.Rows == nil {
+				page.Rows = [][]string{}
+			}
+			return page.Rows, err
+		}},
+		"records": {Args: gqlDatasetArgs, Resolve: func(v interface{}, args gqlArgs) (interface{}, error) {
+			q, err := gqlDatasetQuery(args)
+			if err != nil {
+				return nil, err
+			}
+			page, _, err := q.Apply(v.(Dataset))
+			records := make([]map[string]string, len(page.Rows))
+			for i, row := range page.Rows {
+				records[i] = make(map[string]string, len(page.Columns))
+				for j, column := range page.Columns {
+					records[i][column] = row[j]
+				}
+			}
+			return records, err
+		}},
+		"run": {Type: runType, Resolve: func(v interface{}, _ gqlArgs) (interface{}, error) {
+			if v.(Dataset).RunID == "" {
+				return nil, nil
+			}
+			return loadGQLRun(dir, v.(Dataset).RunID)
+		}},
+	}
+
+	runType.Fields = map[string]gqlFieldDef{
+		"id":         gqlScalar(func(v interface{}) interface{} { return v.(gqlRun).RunID }),
+		"kind":       gqlScalar(func(v interface{}) interface{} { return v.(gqlRun).Kind }),
+		"startedAt":  gqlScalar(func(v interface{}) interface{} { return gqlTime(v.(gqlRun).StartedAt) }),
+		"finishedAt": gqlScalar(func(v interface{}) interface{} { return gqlTime(v.(gqlRun).FinishedAt) }),
+		"files": {Resolve: func(v interface{}, _ gqlArgs) (interface{}, error) {
+			files := []string{}
+			for _, file := range v.(gqlRun).Files {
+				files = append(files, file.Path)
+			}
+			return files, nil
+		}},
+		"datasets": {Type: datasetType, Resolve: func(v interface{}, _ gqlArgs) (interface{}, error) {
+			run := v.(gqlRun)
+			datasets := []interface{}{}
+			for _, source := range scrapedDatasetFiles {
+				if !outputFileExists(filepath.Join(run.dir, run.RunID, source.DataFile)) {
+					continue
+				}
+				ds, err := LoadDatasetAsOf(run.dir, source.Name, run.RunID)
+				if err != nil {
+					return nil, err
+				}
+				datasets = append(datasets, ds)
+			}
+			return datasets, nil
+		}},
+		"dataset": {Type: datasetType, Args: []string{"name"}, Resolve: func(v interface{}, args gqlArgs) (interface{}, error) {
+			name, err := args.String("name")
+			if err != nil {
+				return nil, err
+			}
+			return datasetAsOf(dir, name, v.(gqlRun).RunID)
+		}},
+	}
+
+	predictionType.Fields = map[string]gqlFieldDef{
+		"id":         gqlScalar(func(v interface{}) interface{} { return v.(PredictionRecord).ID }),
+		"state":      gqlScalar(func(v interface{}) interface{} { return string(v.(PredictionRecord).State) }),
+		"inputs":     gqlScalar(func(v interface{}) interface{} { return gqlStrings(v.(PredictionRecord).Inputs) }),
+		"results":    gqlScalar(func(v interface{}) interface{} { return gqlStrings(v.(PredictionRecord).Results) }),
+		"backends":   gqlScalar(func(v interface{}) interface{} { return gqlStrings(v.(PredictionRecord).Backends) }),
+		"error":      gqlScalar(func(v interface{}) interface{} { return v.(PredictionRecord).Error }),
+		"createdAt":  gqlScalar(func(v interface{}) interface{} { return gqlTime(v.(PredictionRecord).CreatedAt) }),
+		"finishedAt": gqlScalar(func(v interface{}) interface{} { return gqlTime(v.(PredictionRecord).FinishedAt) }),
+		"dataset": {Type: datasetType, Args: []string{"name"}, Resolve: func(v interface{}, args gqlArgs) (interface{}, error) {
+			name, err := args.String("name")
+			if err != nil {
+				return nil, err
+			}
+			return datasetAsOf(dir, name, runIDAt(v.(PredictionRecord).CreatedAt))
+		}},
+	}
+
+	queryType.Fields = map[string]gqlFieldDef{
+		"datasets": {Type: datasetType, Resolve: func(_ interface{}, _ gqlArgs) (interface{}, error) {
+			datasets := []interface{}{}
+			for _, source := range scrapedDatasetFiles {
+				if _, _, err := findDatasetRun(dir, source.Name, ""); err != nil {
+					continue
+				}
+				ds, err := LoadDatasetAsOf(dir, source.Name, "")
+				if err != nil {
+					return nil, err
+				}
+				datasets = append(datasets, ds)
+			}
+			return datasets, nil
+		}},
+		"dataset": {Type: datasetType, Args: []string{"name", "run", "asOf"}, Resolve: func(_ interface{}, args gqlArgs) (interface{}, error) {
+			name, err := args.String("name")
+			if err != nil {
+				return nil, err
+			}
+			runID, err := args.String("run")
+			if err != nil {
+				return nil, err
+			}
+			if asOf, err := args.String("asOf"); err != nil {
+				return nil, err
+			} else if asOf != "" {
+				t, err := time.Parse(time.RFC3339, asOf)
+				if err != nil {
+					return nil, fmt.Errorf("argument asOf must be an RFC 3339 time")
+				}
+				runID = runIDAt(t)
+			}
+			return datasetAsOf(dir, name, runID)
+		}},
+		"runs": {Type: runType, Args: []string{"kind", "limit"}, Resolve: func(_ interface{}, args gqlArgs) (interface{}, error) {
+			kind, err := args.String("kind")
+			if err != nil {
+				return nil, err
+			}
+			limit, err := args.Int("limit")
+			if err != nil {
+				return nil, err
+			}
+			if limit <= 0 {
+				limit = defaultGraphQLListLimit
+			}
+			ids, err := ListRuns(dir)
+			if err != nil {
+				return nil, err
+			}
+			runs := []interface{}{}
+			for i := len(ids) - 1; i >= 0 && len(runs) < limit; i-- {
+				run, err := loadGQLRun(dir, ids[i])
+				if err != nil {
+					log.Printf("Error reading run %s: %v", ids[i], err)
+					continue
+				}
+				if kind == "" || run.Kind == kind {
+					runs = append(runs, run)
+				}
+			}
+			return runs, nil
+		}},
+		"run": {Type: runType, Args: []string{"id"}, Resolve: func(_ interface{}, args gqlArgs) (interface{}, error) {
+			id, err := args.String("id")
+			if err != nil {
+				return nil, err
+			}
+			return loadGQLRun(dir, id)
+		}},
+		"predictions": {Type: predictionType, Args: []string{"since", "limit"}, Resolve: func(_ interface{}, args gqlArgs) (interface{}, error) {
+			source, err := currentPredictionSource()
+			if err != nil {
+				return nil, err
+			}
+			var since time.Time
+			if value, err := args.String("since"); err != nil {
+				return nil, err
+			} else if value != "" {
+				if since, err = time.Parse(time.RFC3339, value); err != nil {
+					return nil, fmt.Errorf("argument since must be an RFC 3339 time")
+				}
+			}
+			limit, err := args.Int("limit")
+			if err != nil {
+				return nil, err
+			}
+			if limit <= 0 {
+				limit = defaultGraphQLListLimit
+			}
+			predictions, err := source.Predictions(since)
+			if err != nil {
+				return nil, err
+			}
+			sort.SliceStable(predictions, func(i, j int) bool { return predictions[i].CreatedAt.After(predictions[j].CreatedAt) })
+			list := []interface{}{}
+			for i := 0; i < len(predictions) && i < limit; i++ {
+				list = append(list, predictions[i])
+			}
+			return list, nil
+		}},
+		"prediction": {Type: predictionType, Args: []string{"id"}, Resolve: func(_ interface{}, args gqlArgs) (interface{}, error) {
+			source, err := currentPredictionSource()
+			if err != nil {
+				return nil, err
+			}
+			id, err := args.String("id")
+			if err != nil {
+				return nil, err
+			}
+			return source.Prediction(id)
+		}},
+	}
+	return queryType
+}
+
+// ExecuteGraphQL runs a GraphQL query against the datasets and runs of the configured output directory
+// and the predictions of the prediction source. Errors of single fields are returned along with the rest
+// of the data.
+func ExecuteGraphQL(query string, variables map[string]interface{}, operationName string) GraphQLResponse {
+	return executeGraphQL(graphQLRoot(CurrentConfig().Output.Dir), query, variables, operationName)
+}
+
+// GraphQLRequest is the body of a POST to the GraphQL API.
+type GraphQLRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	OperationName string                 `json:"operationName,omitempty"`
+}
+
+// maxGraphQLBody bounds the body of a POST to the GraphQL API; larger ones are refused with 413.
+const maxGraphQLBody = 1 << 20
+
+// GraphQLHandler serves the GraphQL API: a POST of a GraphQLRequest, or a GET with its fields as query
+// parameters, returns {"data", "errors"}. Queries nesting their fields too deeply or selecting too many
+// of them get an error instead (see maxGraphQLDepth and maxGraphQLFields).
+func GraphQLHandler(w http.ResponseWriter, r *http.Request) {
+	var request GraphQLRequest
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		request.Query, request.OperationName = query.Get("query"), query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				http.Error(w, "Invalid variables", http.StatusBadRequest)
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBody)).Decode(&request); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, fmt.Sprintf("Request body larger than %d bytes", maxGraphQLBody), http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if request.Query == "" {
+		http.Error(w, "No query given", http.StatusBadRequest)
+		return
+	}
+	response := ExecuteGraphQL(request.Query, request.Variables, request.OperationName)
+	code := http.StatusOK
+	if response.Data == nil {
+		code = http.StatusBadRequest
+	}
+	writeJSONResponse(w, code, response)
+}
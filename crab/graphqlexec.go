@@ -0,0 +1,856 @@
+package crab
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// This file holds the small GraphQL query engine behind the GraphQL API (see graphqlapi.go): a parser of
+// query documents and an executor resolving their selections against a schema of Go resolvers. It covers
+// what read-only clients send: named and anonymous queries, variables with defaults, aliases, arguments,
+// fragments and inline fragments, and __typename. Mutations, subscriptions, directives and
+// introspection are rejected.
+
+const (
+	// maxGraphQLDepth is how deeply the fields of a query may nest.
+	maxGraphQLDepth = 10
+	// maxGraphQLFields is how many fields a query may select once its fragments are expanded, so a short
+	// document spreading fragments within fragments cannot ask for an exponential number of them.
+	maxGraphQLFields = 1000
+	// maxGraphQLNesting is how deeply the selection sets, lists and objects of a document may nest, which
+	// bounds the recursion of the parser.
+	maxGraphQLNesting = 32
+)
+
+// gqlSelection is a field, a fragment spread or an inline fragment of a selection set.
+type gqlSelection struct {
+	Alias, Name string
+	Args        map[string]interface{} // Literal values, with gqlVariable for variables
+	Selections  []gqlSelection
+	Spread      string         // The fragment spread, when not a field
+	Inline      []gqlSelection // The selections of an inline fragment, when not a field
+	isInline    bool
+}
+
+// gqlVariable is a reference to a variable in an argument.
+type gqlVariable string
+
+// gqlOperation is a query of a document.
+type gqlOperation struct {
+	Name       string
+	Variables  map[string]interface{} // Defaults by name, nil when none
+	Selections []gqlSelection
+}
+
+// gqlDocument is a parsed query document.
+type gqlDocument struct {
+	Operations []gqlOperation
+	Fragments  map[string][]gqlSelection
+}
+
+// gqlParser reads a query document token by token.
+type gqlParser struct {
+	src   string
+	pos   int
+	tok   string // The current token; strings keep their opening quote, so "\"x" is the string x
+	depth int    // Selection sets, lists and objects the current token is in
+}
+
+// parseGraphQL parses a query document.
+func parseGraphQL(src string) (gqlDocument, error) {
+	p := &gqlParser{src: src}
+	doc := gqlDocument{Fragments: map[string][]gqlSelection{}}
+	if err := p.next(); err != nil {
+		return doc, err
+	}
+	for p.tok != "" {
+		switch {
+		case p.tok == "{":
+			selections, err := p.selectionSet()
+			if err != nil {
+				return doc, err
+			}
+			doc.Operations = append(doc.Operations, gqlOperation{Selections: selections})
+		case p.tok == "query":
+			op, err := p.operation()
+			if err != nil {
+				return doc, err
+			}
+			doc.Operations = append(doc.Operations, op)
+		case p.tok == "fragment":
+			name, selections, err := p.fragment()
+			if err != nil {
+				return doc, err
+			}
+			doc.Fragments[name] = selections
+		case p.tok == "mutation" || p.tok == "subscription":
+			return doc, fmt.Errorf("%ss are not supported, the API is read-only", p.tok)
+		default:
+			return doc, p.errorf("expected a query or fragment")
+		}
+	}
+	if len(doc.Operations) == 0 {
+		return doc, fmt.Errorf("the document has no query")
+	}
+	return doc, nil
+}
+
+// errorf returns a syntax error at the current position.
+func (p *gqlParser) errorf(format string, args ...interface{}) error {
+	line := strings.Count(p.src[:p.pos], "\n") + 1
+	return fmt.Errorf("syntax error on line %d near %q: %s", line, p.tok, fmt.Sprintf(format, args...))
+}
+
+// enter goes into a selection set, list or object, failing past maxGraphQLNesting of them.
+func (p *gqlParser) enter() error {
+	if p.depth++; p.depth > maxGraphQLNesting {
+		return p.errorf("nested deeper than %d levels", maxGraphQLNesting)
+	}
+	return nil
+}
+
+// leave comes out of the selection set, list or object entered last.
+func (p *gqlParser) leave() {
+	p.depth--
+}
+
+// next reads the next token into p.tok, or "" at the end.
+func (p *gqlParser) next() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			p.pos++
+		} else if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		} else {
+			break
+		}
+	}
+	if p.pos >= len(p.src) {
+		p.tok = ""
+		return nil
+	}
+	start := p.pos
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+	case strings.IndexByte("!$():=@[]{}|", c) >= 0:
+		p.pos++
+	case c == '"':
+		value, err := p.readString()
+		if err != nil {
+			return err
+		}
+		p.tok = "\"" + value
+		return nil
+	case c == '-' || c >= '0' && c <= '9':
+		p.pos++
+		for p.pos < len(p.src) && strings.IndexByte("0123456789.eE+-", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || p.src[p.pos] >= 'a' && p.src[p.pos] <= 'z' ||
+			p.src[p.pos] >= 'A' && p.src[p.pos] <= 'Z' || p.src[p.pos] >= '0' && p.src[p.pos] <= '9') {
+			p.pos++
+		}
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		return fmt.Errorf("syntax error: unexpected character %q", r)
+	}
+	p.tok = p.src[start:p.pos]
+	return nil
+}
+
+// readString reads a string or block string literal at p.pos.
+func (p *gqlParser) readString() (string, error) {
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := strings.Index(p.src[p.pos+3:], `"""`)
+		if end < 0 {
+			return "", fmt.Errorf("syntax error: unterminated block string")
+		}
+		value := p.src[p.pos+3 : p.pos+3+end]
+		p.pos += end + 6
+		return strings.TrimSpace(value), nil
+	}
+	for end := p.pos + 1; end < len(p.src); end++ {
+		switch p.src[end] {
+		case '\\':
+			end++
+		case '\n':
+			return "", fmt.Errorf("syntax error: unterminated string")
+		case '"':
+			value, err := strconv.Unquote(p.src[p.pos : end+1])
+			if err != nil {
+				// \u escapes and the like are JSON's
+				if jsonErr := json.Unmarshal([]byte(p.src[p.pos:end+1]), &value); jsonErr != nil {
+					return "", fmt.Errorf("syntax error: invalid string %s", p.src[p.pos:end+1])
+				}
+			}
+			p.pos = end + 1
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("syntax error: unterminated string")
+}
+
+// expect consumes tok or fails.
+func (p *gqlParser) expect(tok string) error {
+	if p.tok != tok {
+		return p.errorf("expected %q", tok)
+	}
+	return p.next()
+}
+
+// name consumes a name.
+func (p *gqlParser) name() (string, error) {
+	if p.tok == "" || !(p.tok[0] == '_' || p.tok[0] >= 'a' && p.tok[0] <= 'z' || p.tok[0] >= 'A' && p.tok[0] <= 'Z') {
+		return "", p.errorf("expected a name")
+	}
+	name := p.tok
+	return name, p.next()
+}
+
+// operation parses "query Name($var: Type = default) { ... }".
+func (p *gqlParser) operation() (gqlOperation, error) {
+	var op gqlOperation
+	if err := p.expect("query"); err != nil {
+		return op, err
+	}
+	if p.tok != "(" && p.tok != "{" && p.tok != "@" {
+		var err error
+		if op.Name, err = p.name(); err != nil {
+			return op, err
+		}
+	}
+	if p.tok == "(" {
+		op.Variables = map[string]interface{}{}
+		if err := p.next(); err != nil {
+			return op, err
+		}
+		for p.tok != ")" {
+			if err := p.expect("$"); err != nil {
+				return op, err
+			}
+			name, err := p.name()
+			if err != nil {
+				return op, err
+			}
+			if err := p.expect(":"); err != nil {
+				return op, err
+			}
+			if err := p.skipType(); err != nil {
+				return op, err
+			}
+			op.Variables[name] = nil
+			if p.tok == "=" {
+				if err := p.next(); err != nil {
+					return op, err
+				}
+				if op.Variables[name], err = p.value(true); err != nil {
+					return op, err
+				}
+			}
+		}
+		if err := p.next(); err != nil {
+			return op, err
+		}
+	}
+	if p.tok == "@" {
+		return op, p.errorf("directives are not supported")
+	}
+	var err error
+	op.Selections, err = p.selectionSet()
+	return op, err
+}
+
+// skipType consumes a variable type such as [String!]!, which the executor does not check.
+func (p *gqlParser) skipType() error {
+	if p.tok == "[" {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.skipType(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.name(); err != nil {
+		return err
+	}
+	if p.tok == "!" {
+		return p.next()
+	}
+	return nil
+}
+
+// fragment parses "fragment Name on Type { ... }".
+func (p *gqlParser) fragment() (string, []gqlSelection, error) {
+	if err := p.expect("fragment"); err != nil {
+		return "", nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return "", nil, err
+	}
+	if err := p.expect("on"); err != nil {
+		return "", nil, err
+	}
+	if _, err := p.name(); err != nil {
+		return "", nil, err
+	}
+	selections, err := p.selectionSet()
+	return name, selections, err
+}
+
+// selectionSet parses "{ field(arg: value) { ... } ...Fragment ... on Type { ... } }".
+func (p *gqlParser) selectionSet() ([]gqlSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	var selections []gqlSelection
+	for p.tok != "}" {
+		if p.tok == "" {
+			return nil, p.errorf("unterminated selection set")
+		}
+		if p.tok == "..." {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if p.tok == "on" || p.tok == "{" {
+				if p.tok == "on" {
+					if err := p.next(); err != nil {
+						return nil, err
+					}
+					if _, err := p.name(); err != nil {
+						return nil, err
+					}
+				}
+				inline, err := p.selectionSet()
+				if err != nil {
+					return nil, err
+				}
+				selections = append(selections, gqlSelection{Inline: inline, isInline: true})
+				continue
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			selections = append(selections, gqlSelection{Spread: name})
+			continue
+		}
+		field := gqlSelection{}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		field.Alias, field.Name = name, name
+		if p.tok == ":" {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if field.Name, err = p.name(); err != nil {
+				return nil, err
+			}
+		}
+		if p.tok == "(" {
+			if field.Args, err = p.arguments(); err != nil {
+				return nil, err
+			}
+		}
+		if p.tok == "@" {
+			return nil, p.errorf("directives are not supported")
+		}
+		if p.tok == "{" {
+			if field.Selections, err = p.selectionSet(); err != nil {
+				return nil, err
+			}
+		}
+		selections = append(selections, field)
+	}
+	return selections, p.next()
+}
+
+// arguments parses "(name: value ...)".
+func (p *gqlParser) arguments() (map[string]interface{}, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	args := map[string]interface{}{}
+	for p.tok != ")" {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if args[name], err = p.value(false); err != nil {
+			return nil, err
+		}
+	}
+	return args, p.next()
+}
+
+// value parses a literal or, unless constant, a variable.
+func (p *gqlParser) value(constant bool) (interface{}, error) {
+	tok := p.tok
+	switch {
+	case tok == "$" && !constant:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		return gqlVariable(name), err
+	case tok == "[":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		list := []interface{}{}
+		for p.tok != "]" {
+			if p.tok == "" {
+				return nil, p.errorf("unterminated list")
+			}
+			item, err := p.value(constant)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		return list, p.next()
+	case tok == "{":
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		object := map[string]interface{}{}
+		for p.tok != "}" {
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			if object[name], err = p.value(constant); err != nil {
+				return nil, err
+			}
+		}
+		return object, p.next()
+	case strings.HasPrefix(tok, "\""):
+		return tok[1:], p.next()
+	case tok == "true", tok == "false":
+		return tok == "true", p.next()
+	case tok == "null":
+		return nil, p.next()
+	case tok != "" && (tok[0] == '-' || tok[0] >= '0' && tok[0] <= '9'):
+		if n, err := strconv.ParseInt(tok, 10, 64); err == nil {
+			return int(n), p.next()
+		}
+		f, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number")
+		}
+		return f, p.next()
+	case tok != "" && (tok[0] == '_' || tok[0] >= 'a' && tok[0] <= 'z' || tok[0] >= 'A' && tok[0] <= 'Z'):
+		return tok, p.next() // An enum value
+	}
+	return nil, p.errorf("expected a value")
+}
+
+// gqlType is an object type of the schema.
+type gqlType struct {
+	Name   string
+	Fields map[string]gqlFieldDef
+}
+
+// gqlFieldDef is a field of an object type. A field of an object or list of objects type has Type set
+// and needs a selection set; a scalar field, or list of them, has none.
+type gqlFieldDef struct {
+	Type    *gqlType
+	Args    []string // The arguments it takes
+	Resolve func(parent interface{}, args gqlArgs) (interface{}, error)
+}
+
+// gqlArgs are the arguments of a field with their variables substituted.
+type gqlArgs map[string]interface{}
+
+// String returns a string argument, or "" when not given.
+func (a gqlArgs) String(name string) (string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("argument %s must be a string", name)
+}
+
+// Int returns an integer argument, or 0 when not given.
+func (a gqlArgs) Int(name string) (int, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return 0, nil
+	case int:
+		return v, nil
+	case float64: // From JSON variables
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	}
+	return 0, fmt.Errorf("argument %s must be an integer", name)
+}
+
+// Strings returns a list of strings argument; a single string is a list of one.
+func (a gqlArgs) Strings(name string) ([]string, error) {
+	switch v := a[name].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		list := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("argument %s must be a list of strings", name)
+			}
+			list[i] = s
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("argument %s must be a list of strings", name)
+}
+
+// GraphQLError is an error of a GraphQL response, at the path of the field that failed if any.
+type GraphQLError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// GraphQLResponse is the result of a GraphQL query. Data is nil when the query could not be run.
+type GraphQLResponse struct {
+	Data   interface{}    `json:"data"`
+	Errors []GraphQLError `json:"errors,omitempty"`
+}
+
+// gqlObject is a result object, keeping its fields in the order they were selected.
+type gqlObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// set adds a field, or merges the fields of a field selected twice.
+func (o *gqlObject) set(key string, value interface{}) {
+	if o.values == nil {
+		o.values = map[string]interface{}{}
+	}
+	if previous, ok := o.values[key]; ok {
+		if a, ok := previous.(*gqlObject); ok {
+			if b, ok := value.(*gqlObject); ok {
+				for _, k := range b.keys {
+					a.set(k, b.values[k])
+				}
+				return
+			}
+		}
+		o.values[key] = value
+		return
+	}
+	o.keys = append(o.keys, key)
+	o.values[key] = value
+}
+
+// MarshalJSON writes the fields in order.
+func (o *gqlObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(key)
+		value, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// gqlExecution runs one operation of a document.
+type gqlExecution struct {
+	fragments map[string][]gqlSelection
+	variables map[string]interface{}
+	errors    []GraphQLError
+	collected map[*gqlSelection]gqlCollected // The fields of the selection sets, by their first selection
+}
+
+// gqlCollected is a selection set with its fragments expanded.
+type gqlCollected struct {
+	fields []gqlSelection
+	err    error
+}
+
+// executeGraphQL runs the operation of a query document against the root type.
+func executeGraphQL(root *gqlType, query string, variables map[string]interface{}, operationName string) GraphQLResponse {
+	doc, err := parseGraphQL(query)
+	if err != nil {
+		return GraphQLResponse{Errors: []GraphQLError{{Message: err.Error()}}}
+	}
+	var op *gqlOperation
+	for i := range doc.Operations {
+		if operationName == "" || doc.Operations[i].Name == operationName {
+			if op != nil {
+				return GraphQLResponse{Errors: []GraphQLError{{Message: "the document has several queries, operationName must name one"}}}
+			}
+			op = &doc.Operations[i]
+		}
+	}
+	if op == nil {
+		return GraphQLResponse{Errors: []GraphQLError{{Message: fmt.Sprintf("no query named %q", operationName)}}}
+	}
+	exec := &gqlExecution{fragments: doc.Fragments, variables: map[string]interface{}{}, collected: map[*gqlSelection]gqlCollected{}}
+	for name, value := range op.Variables {
+		exec.variables[name] = value
+	}
+	for name, value := range variables {
+		if _, declared := op.Variables[name]; !declared {
+			return GraphQLResponse{Errors: []GraphQLError{{Message: fmt.Sprintf("variable $%s is not declared", name)}}}
+		}
+		exec.variables[name] = value
+	}
+	if err := exec.checkLimits(op.Selections, 1, new(int)); err != nil {
+		return GraphQLResponse{Errors: []GraphQLError{{Message: err.Error()}}}
+	}
+	data := exec.selectObject(root, nil, op.Selections, nil)
+	if data == nil {
+		return GraphQLResponse{Errors: exec.errors}
+	}
+	return GraphQLResponse{Data: data, Errors: exec.errors}
+}
+
+// fail records an error at path.
+func (e *gqlExecution) fail(path []interface{}, err error) {
+	e.errors = append(e.errors, GraphQLError{Message: err.Error(), Path: append([]interface{}{}, path...)})
+}
+
+// checkLimits returns an error when the fields of selections, at depth, nest deeper than maxGraphQLDepth
+// or bring those counted in fields past maxGraphQLFields. Selection sets that do not expand are left to
+// fail where they are resolved.
+func (e *gqlExecution) checkLimits(selections []gqlSelection, depth int, fields *int) error {
+	if depth > maxGraphQLDepth {
+		return fmt.Errorf("the query nests fields deeper than %d levels", maxGraphQLDepth)
+	}
+	collected, err := e.fieldsOf(selections)
+	if err != nil {
+		return nil
+	}
+	for _, field := range collected {
+		if *fields++; *fields > maxGraphQLFields {
+			return fmt.Errorf("the query selects more than %d fields", maxGraphQLFields)
+		}
+		if len(field.Selections) > 0 {
+			if err := e.checkLimits(field.Selections, depth+1, fields); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fieldsOf returns the fields of a selection set with its fragments expanded. Each set is expanded once,
+// however many objects it is selected on.
+func (e *gqlExecution) fieldsOf(selections []gqlSelection) ([]gqlSelection, error) {
+	if len(selections) == 0 {
+		return nil, nil
+	}
+	collected, ok := e.collected[&selections[0]]
+	if !ok {
+		collected.fields, collected.err = e.collect(selections, map[string]bool{}, map[string]bool{})
+		e.collected[&selections[0]] = collected
+	}
+	return collected.fields, collected.err
+}
+
+// collect flattens fragments into the fields of a selection set. seen holds the fragments being spread,
+// and spread those already spread into the set, whose fields a second spread would only repeat.
+func (e *gqlExecution) collect(selections []gqlSelection, seen, spread map[string]bool) ([]gqlSelection, error) {
+	var fields []gqlSelection
+	for _, selection := range selections {
+		switch {
+		case selection.isInline:
+			inline, err := e.collect(selection.Inline, seen, spread)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, inline...)
+		case selection.Spread != "":
+			fragment, ok := e.fragments[selection.Spread]
+			if !ok {
+				return nil, fmt.Errorf("unknown fragment %s", selection.Spread)
+			}
+			if seen[selection.Spread] {
+				return nil, fmt.Errorf("fragment %s spreads itself", selection.Spread)
+			}
+			if spread[selection.Spread] {
+				continue
+			}
+			seen[selection.Spread] = true
+			expanded, err := e.collect(fragment, seen, spread)
+			delete(seen, selection.Spread)
+			if err != nil {
+				return nil, err
+			}
+			spread[selection.Spread] = true
+			fields = append(fields, expanded...)
+		default:
+			fields = append(fields, selection)
+		}
+	}
+	return fields, nil
+}
+
+// selectObject resolves the selections of an object of type t.
+func (e *gqlExecution) selectObject(t *gqlType, parent interface{}, selections []gqlSelection, path []interface{}) *gqlObject {
+	fields, err := e.fieldsOf(selections)
+	if err != nil {
+		e.fail(path, err)
+		return nil
+	}
+	result := &gqlObject{}
+	for _, field := range fields {
+		fieldPath := append(append([]interface{}{}, path...), field.Alias)
+		if field.Name == "__typename" {
+			result.set(field.Alias, t.Name)
+			continue
+		}
+		def, ok := t.Fields[field.Name]
+		if !ok {
+			e.fail(fieldPath, fmt.Errorf("%s has no field %s", t.Name, field.Name))
+			result.set(field.Alias, nil)
+			continue
+		}
+		args, err := e.arguments(def, field)
+		if err != nil {
+			e.fail(fieldPath, err)
+			result.set(field.Alias, nil)
+			continue
+		}
+		value, err := def.Resolve(parent, args)
+		if err != nil {
+			e.fail(fieldPath, err)
+			result.set(field.Alias, nil)
+			continue
+		}
+		result.set(field.Alias, e.complete(def.Type, value, field, fieldPath))
+	}
+	return result
+}
+
+// arguments checks the arguments of a field and substitutes its variables.
+func (e *gqlExecution) arguments(def gqlFieldDef, field gqlSelection) (gqlArgs, error) {
+	args := gqlArgs{}
+	names := make([]string, 0, len(field.Args))
+	for name := range field.Args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		known := false
+		for _, arg := range def.Args {
+			known = known || arg == name
+		}
+		if !known {
+			return nil, fmt.Errorf("field %s has no argument %s", field.Name, name)
+		}
+		value, err := e.substitute(field.Args[name])
+		if err != nil {
+			return nil, err
+		}
+		args[name] = value
+	}
+	return args, nil
+}
+
+// substitute replaces the variables in an argument value.
+func (e *gqlExecution) substitute(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case gqlVariable:
+		value, ok := e.variables[string(v)]
+		if !ok {
+			return nil, fmt.Errorf("variable $%s is not declared", v)
+		}
+		return value, nil
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			var err error
+			if list[i], err = e.substitute(item); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			var err error
+			if object[k], err = e.substitute(item); err != nil {
+				return nil, err
+			}
+		}
+		return object, nil
+	}
+	return value, nil
+}
+
+// complete turns a resolved value into its result: scalars as they are, objects and lists of them by
+// their selections.
+func (e *gqlExecution) complete(t *gqlType, value interface{}, field gqlSelection, path []interface{}) interface{} {
+	if t == nil {
+		if len(field.Selections) > 0 {
+			e.fail(path, fmt.Errorf("field %s is a scalar and takes no selections", field.Name))
+			return nil
+		}
+		return value
+	}
+	if len(field.Selections) == 0 {
+		e.fail(path, fmt.Errorf("field %s of type %s needs a selection of its fields", field.Name, t.Name))
+		return nil
+	}
+	if value == nil {
+		return nil
+	}
+	if list, ok := value.([]interface{}); ok {
+		results := make([]interface{}, len(list))
+		for i, item := range list {
+			results[i] = e.complete(t, item, field, append(append([]interface{}{}, path...), i))
+		}
+		return results
+	}
+	return e.selectObject(t, value, field.Selections, path)
+}
@@ -0,0 +1,185 @@
+package crab
+
+import (
+	"cmpscfa23team2/records"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// IdempotencyHeader carries the key a client picks for a POST it may retry, e.g. a UUID. Retries with the
+	// same key and body get the response of the first request instead of starting another job.
+	IdempotencyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set on the responses to retries.
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	// IdempotencyKeyTTL is how long a key is remembered; after it the key may be used again.
+	IdempotencyKeyTTL = 24 * time.Hour
+	// maxIdempotencyKeyLength bounds the keys, as the database column does.
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBody bounds the bodies of the requests read to hash them; larger ones are refused.
+	maxIdempotentBody = 1 << 20
+)
+
+// IdempotencyRecord is a key a client sent with a request to an endpoint, and the response it got.
+type IdempotencyRecord = records.IdempotencyRecord
+
+// IdempotencyStore remembers the idempotency keys of API requests. The dal keeps them in the
+// idempotency_keys table, so retries reaching another server are caught too.
+type IdempotencyStore interface {
+	// ClaimIdempotencyKey stores record unless its key is already stored for its scope since expiredBefore,
+	// in which case it returns the stored record and false. Keys stored before expiredBefore are replaced.
+	ClaimIdempotencyKey(record IdempotencyRecord, expiredBefore time.Time) (IdempotencyRecord, bool, error)
+	// CompleteIdempotencyKey records the resource and status of the response to a claimed key.
+	CompleteIdempotencyKey(record IdempotencyRecord) error
+	// ReleaseIdempotencyKey forgets a claimed key whose request failed, so a retry can go through.
+	ReleaseIdempotencyKey(scope, key string) error
+}
+
+// MemoryIdempotencyStore is an in-process IdempotencyStore.
+type MemoryIdempotencyStore = records.MemoryIdempotencyStore
+
+// NewMemoryIdempotencyStore creates an empty in-process idempotency store.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return records.NewMemoryIdempotencyStore()
+}
+
+var (
+	idempotencyMu    sync.RWMutex
+	idempotencyStore IdempotencyStore = NewMemoryIdempotencyStore()
+)
+
+// SetIdempotencyStore sets where the idempotency keys of API requests are kept. Passing nil keeps them in
+// process, where they last until a restart.
+func SetIdempotencyStore(store IdempotencyStore) {
+	idempotencyMu.Lock()
+	defer idempotencyMu.Unlock()
+	if store == nil {
+		store = NewMemoryIdempotencyStore()
+	}
+	idempotencyStore = store
+}
+
+func currentIdempotencyStore() IdempotencyStore {
+	idempotencyMu.RLock()
+	defer idempotencyMu.RUnlock()
+	return idempotencyStore
+}
+
+// IdempotencyError is why a request with an idempotency key cannot be handled.
+type IdempotencyError struct {
+	Status  int // 400 for a bad key, 409 while the first request is handled, 413 for a body too large, 422 for a key of another request
+	Message string
+}
+
+func (e *IdempotencyError) Error() string {
+	return e.Message
+}
+
+// IdempotencyClaim is the claim of a request on its idempotency key. Once the request is handled, Complete
+// records its response for the retries; if it fails, Release lets a retry go through. Both do nothing on a
+// nil claim, that of a request without a key.
+type IdempotencyClaim struct {
+	record IdempotencyRecord
+	store  IdempotencyStore
+}
+
+// ClaimIdempotency reads the body of r, which it returns, and claims the key of its Idempotency-Key header
+// for scope and the caller of r, as RequestPrincipal has it, so callers picking the same key never get each
+// other's responses. Without the header the claim is nil. When the key was seen before, the record of the
+// first request is returned instead of a claim; its ResourceID is the resource to respond with again. A
+// body over maxIdempotentBody, a key that is still being handled or a key sent with another body fails
+// with an *IdempotencyError.
+func ClaimIdempotency(r *http.Request, scope string) ([]byte, *IdempotencyClaim, *IdempotencyRecord, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+	if err != nil {
+		return nil, nil, nil, &IdempotencyError{Status: http.StatusBadRequest, Message: "Invalid request body"}
+	}
+	if len(body) > maxIdempotentBody {
+		return nil, nil, nil, &IdempotencyError{Status: http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("Request body larger than %d bytes", maxIdempotentBody)}
+	}
+	key := r.Header.Get(IdempotencyHeader)
+	if key == "" {
+		return body, nil, nil, nil
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, nil, nil, &IdempotencyError{Status: http.StatusBadRequest,
+			Message: fmt.Sprintf("%s longer than %d characters", IdempotencyHeader, maxIdempotencyKeyLength)}
+	}
+	sum := sha256.Sum256(canonicalJSON(body))
+	if principal, ok := RequestPrincipal(r); ok {
+		scope += " for " + principal.Method + ":" + principal.Name
+	}
+	record := IdempotencyRecord{Scope: scope, Key: key, RequestHash: hex.EncodeToString(sum[:]), CreatedAt: time.Now().UTC()}
+	store := currentIdempotencyStore()
+	stored, claimed, err := store.ClaimIdempotencyKey(record, record.CreatedAt.Add(-IdempotencyKeyTTL))
+	switch {
+	case err != nil:
+		return nil, nil, nil, err
+	case claimed:
+		return body, &IdempotencyClaim{record: record, store: store}, nil, nil
+	case stored.RequestHash != record.RequestHash:
+		return nil, nil, nil, &IdempotencyError{Status: http.StatusUnprocessableEntity,
+			Message: fmt.Sprintf("%s %q was used for another request", IdempotencyHeader, key)}
+	case stored.ResourceID == "":
+		return nil, nil, nil, &IdempotencyError{Status: http.StatusConflict,
+			Message: fmt.Sprintf("A request with %s %q is in progress", IdempotencyHeader, key)}
+	}
+	return body, nil, &stored, nil
+}
+
+// canonicalJSON returns a JSON body with its object keys sorted and no spaces, so that retries encoding the
+// same request differently hash the same. Other bodies are returned as they are.
+func canonicalJSON(body []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return canonical
+}
+
+// Complete records that the request created resourceID and was answered with status.
+func (c *IdempotencyClaim) Complete(resourceID string, status int) error {
+	if c == nil {
+		return nil
+	}
+	c.record.ResourceID, c.record.Status = resourceID, status
+	return c.store.CompleteIdempotencyKey(c.record)
+}
+
+// Release forgets the key of a request that failed.
+func (c *IdempotencyClaim) Release() error {
+	if c == nil {
+		return nil
+	}
+	return c.store.ReleaseIdempotencyKey(c.record.Scope, c.record.Key)
+}
+
+// WriteIdempotencyError answers a request whose key could not be claimed with the error of
+// ClaimIdempotency.
+func WriteIdempotencyError(w http.ResponseWriter, err error) {
+	if idempotencyErr, ok := err.(*IdempotencyError); ok {
+		http.Error(w, idempotencyErr.Message, idempotencyErr.Status)
+		return
+	}
+	log.Printf("Error claiming an idempotency key: %v", err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+// WriteIdempotentReplay answers a retry with the response to the first request, v being the resource it
+// created as it is now.
+func WriteIdempotentReplay(w http.ResponseWriter, record *IdempotencyRecord, v interface{}) {
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	writeJSONResponse(w, record.Status, v)
+}
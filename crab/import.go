@@ -0,0 +1,413 @@
+package crab
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// importRecordTypes are the record types the importable datasets are written as. The airfare dataset is
+// nested and cannot be read from a flat file.
+var importRecordTypes = map[string]interface{}{
+	"inflation": []YearData(nil),
+	"gasoline":  []GasolineData(nil),
+	"housing":   []PropertyData(nil),
+}
+
+// ImportOptions says how to read a file into a dataset.
+type ImportOptions struct {
+	Format  string            // "csv", "tsv", "xlsx", "json" or "ndjson"; taken from the file extension when empty
+	Sheet   string            // The worksheet of an XLSX workbook; the one named like the dataset, or else the first
+	Columns map[string]string // Renames file columns to dataset columns, e.g. {"bed": "bedrooms"}
+}
+
+// ReadDatasetFile reads a CSV, TSV, XLSX, JSON or NDJSON file into a Dataset named name, taking the column
+// names from its header row (or the keys of its objects) as they are.
+func ReadDatasetFile(name, filename string, options ImportOptions) (Dataset, error) {
+	format := strings.ToLower(options.Format)
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(strings.TrimSuffix(filename, ".gz"))), ".")
+	}
+	if format == "xlsx" {
+		sheet := options.Sheet
+		if sheet == "" {
+			sheet = name
+		}
+		return readXLSXDataset(name, filename, sheet, options.Sheet != "")
+	}
+
+	file, err := OpenOutputFile(filename)
+	if err != nil {
+		return Dataset{}, err
+	}
+	defer file.Close()
+	switch format {
+	case "csv", "tsv", "txt":
+		reader := csv.NewReader(file)
+		if format == "tsv" {
+			reader.Comma = '\t'
+		}
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		records, err := reader.ReadAll()
+		if err != nil {
+			return Dataset{}, fmt.Errorf("reading %s: %w", filename, err)
+		}
+		return tableDataset(name, records)
+	case "json", "ndjson", "jsonl":
+		return readJSONDataset(name, file)
+	}
+	return Dataset{}, fmt.Errorf("unsupported import format %q", format)
+}
+
+// tableDataset builds a Dataset from rows whose first row is the header. Rows are padded or cut to the
+// width of the header.
+func tableDataset(name string, rows [][]string) (Dataset, error) {
+	if len(rows) == 0 {
+		return Dataset{}, fmt.Errorf("dataset %s: no header row", name)
+	}
+	ds := Dataset{Name: name, Columns: make([]string, len(rows[0]))}
+	for j, column := range rows[0] {
+		ds.Columns[j] = strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))
+	}
+	for _, row := range rows[1:] {
+		cells := make([]string, len(ds.Columns))
+		empty := true
+		for j := range cells {
+			if j < len(row) {
+				cells[j] = strings.TrimSpace(row[j])
+				empty = empty && cells[j] == ""
+			}
+		}
+		if !empty {
+			ds.Rows = append(ds.Rows, cells)
+		}
+	}
+	return ds, nil
+}
+
+// readJSONDataset reads a JSON array of objects, or one object per line, into a Dataset. Its columns are
+// every key found, sorted; numbers and booleans are written as text and nulls as empty cells.
+func readJSONDataset(name string, r io.Reader) (Dataset, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var objects []map[string]interface{}
+	for {
+		var value interface{}
+		if err := decoder.Decode(&value); err == io.EOF {
+			break
+		} else if err != nil {
+			return Dataset{}, fmt.Errorf("dataset %s: %w", name, err)
+		}
+		switch value := value.(type) {
+		case []interface{}:
+			for _, item := range value {
+				object, ok := item.(map[string]interface{})
+				if !ok {
+					return Dataset{}, fmt.Errorf("dataset %s: expected an array of objects", name)
+				}
+				objects = append(objects, object)
+			}
+		case map[string]interface{}:
+			objects = append(objects, value)
+		default:
+			return Dataset{}, fmt.Errorf("dataset %s: expected objects, got %T", name, value)
+		}
+	}
+
+	seen := map[string]bool{}
+	ds := Dataset{Name: name}
+	for _, object := range objects {
+		for key := range object {
+			if !seen[key] {
+				seen[key] = true
+				ds.Columns = append(ds.Columns, key)
+			}
+		}
+	}
+	sort.Strings(ds.Columns)
+	for _, object := range objects {
+		row := make([]string, len(ds.Columns))
+		for j, column := range ds.Columns {
+			if value := object[column]; value != nil {
+				row[j] = strings.TrimSpace(fmt.Sprint(value))
+			}
+		}
+		ds.Rows = append(ds.Rows, row)
+	}
+	return ds, nil
+}
+
+// readXLSXDataset reads a worksheet of an XLSX workbook. Without a sheet of the given name the first
+// sheet is read, unless required is set.
+func readXLSXDataset(name, filename, sheet string, required bool) (Dataset, error) {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return Dataset{}, err
+	}
+	defer archive.Close()
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+			ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := readZipXML(files, "xl/workbook.xml", &workbook); err != nil {
+		return Dataset{}, err
+	}
+	if err := readZipXML(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return Dataset{}, err
+	}
+	if len(workbook.Sheets) == 0 {
+		return Dataset{}, fmt.Errorf("%s has no worksheets", filename)
+	}
+	chosen := workbook.Sheets[0]
+	found := false
+	for _, s := range workbook.Sheets {
+		if strings.EqualFold(s.Name, sheet) {
+			chosen, found = s, true
+		}
+	}
+	if !found && required {
+		return Dataset{}, fmt.Errorf("%s has no worksheet %q", filename, sheet)
+	}
+	sheetFile := ""
+	for _, rel := range rels.Relationships {
+		if rel.ID == chosen.ID {
+			sheetFile = strings.TrimPrefix(rel.Target, "/")
+			if !strings.HasPrefix(sheetFile, "xl/") {
+				sheetFile = path.Join("xl", sheetFile)
+			}
+		}
+	}
+
+	var shared struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if files["xl/sharedStrings.xml"] != nil {
+		if err := readZipXML(files, "xl/sharedStrings.xml", &shared); err != nil {
+			return Dataset{}, err
+		}
+	}
+	var worksheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := readZipXML(files, sheetFile, &worksheet); err != nil {
+		return Dataset{}, err
+	}
+
+	var rows [][]string
+	for _, row := range worksheet.Rows {
+		var cells []string
+		for i, cell := range row.Cells {
+			col := i
+			if ref := xlsxCellColumn.FindString(cell.Ref); ref != "" {
+				col = xlsxColumnIndex(ref)
+			}
+			for len(cells) <= col {
+				cells = append(cells, "")
+			}
+			switch cell.Type {
+			case "s":
+				if n, err := strconv.Atoi(cell.Value); err == nil && n >= 0 && n < len(shared.Items) {
+					cells[col] = shared.Items[n].String()
+				}
+			case "inlineStr":
+				cells[col] = cell.Inline.String()
+			case "b":
+				cells[col] = strconv.FormatBool(cell.Value == "1")
+			default:
+				cells[col] = cell.Value
+			}
+		}
+		rows = append(rows, cells)
+	}
+	return tableDataset(name, rows)
+}
+
+// xlsxText is a string item or inline string: plain text, or runs of formatted text.
+type xlsxText struct {
+	Text string   `xml:"t"`
+	Runs []string `xml:"r>t"`
+}
+
+func (t xlsxText) String() string {
+	return t.Text + strings.Join(t.Runs, "")
+}
+
+// xlsxCellColumn matches the column letters of a cell reference.
+var xlsxCellColumn = regexp.MustCompile(`^[A-Z]+`)
+
+// xlsxColumnIndex converts a spreadsheet column name into a zero based index (A -> 0, AB -> 27), undoing
+// xlsxColumnName.
+func xlsxColumnIndex(name string) int {
+	index := 0
+	for _, r := range name {
+		index = index*26 + int(r-'A') + 1
+	}
+	return index - 1
+}
+
+// readZipXML decodes an XML part of a workbook.
+func readZipXML(files map[string]*zip.File, name string, v interface{}) error {
+	file, ok := files[name]
+	if !ok {
+		return fmt.Errorf("workbook has no %s", name)
+	}
+	r, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := xml.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("reading %s: %w", name, err)
+	}
+	return nil
+}
+
+// columnKey normalizes a column name for matching: "Zip Code" and "zip_code" are the same column.
+func columnKey(column string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToLower(strings.TrimSpace(column)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if underscore && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			underscore = false
+		} else {
+			underscore = true
+		}
+	}
+	return b.String()
+}
+
+// ConformDataset maps the columns of ds onto columns, the schema of a dataset, matching names regardless
+// of case and punctuation after applying renames. Schema columns the file lacks are left empty; file
+// columns the schema lacks are dropped and returned.
+func ConformDataset(ds Dataset, columns []string, renames map[string]string) (Dataset, []string, error) {
+	schema := map[string]int{}
+	for j, column := range columns {
+		schema[columnKey(column)] = j
+	}
+	renamed := map[string]string{}
+	for from, to := range renames {
+		renamed[columnKey(from)] = to
+	}
+
+	source := make([]int, len(columns))
+	for j := range source {
+		source[j] = -1
+	}
+	var dropped []string
+	for i, column := range ds.Columns {
+		key := columnKey(column)
+		if to, ok := renamed[key]; ok {
+			key = columnKey(to)
+		}
+		if j, ok := schema[key]; ok && source[j] < 0 {
+			source[j] = i
+		} else {
+			dropped = append(dropped, column)
+		}
+	}
+	if len(dropped) == len(ds.Columns) {
+		return Dataset{}, dropped, fmt.Errorf("dataset %s: none of the columns %v is in the schema %v", ds.Name, ds.Columns, columns)
+	}
+
+	conformed := Dataset{Name: ds.Name, Columns: columns, Rows: make([][]string, len(ds.Rows))}
+	for r, row := range ds.Rows {
+		cells := make([]string, len(columns))
+		for j, i := range source {
+			if i >= 0 && i < len(row) {
+				cells[j] = row[i]
+			}
+		}
+		conformed.Rows[r] = cells
+	}
+	return conformed, dropped, nil
+}
+
+// ImportDataset reads filename into the named scraped dataset and writes it through the same steps as
+// a scrape, into an import run of its own: it is cleaned, merged, checked and summarized as configured,
+// and its rows trace back to the file. It returns the name of the file written.
+func ImportDataset(dataset, filename string, options ImportOptions) (string, error) {
+	like, ok := importRecordTypes[dataset]
+	if !ok {
+		names := make([]string, 0, len(importRecordTypes))
+		for name := range importRecordTypes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("cannot import into dataset %q, only into %s", dataset, strings.Join(names, ", "))
+	}
+	var dataFile string
+	for _, source := range scrapedDatasetFiles {
+		if source.Name == dataset {
+			dataFile = source.DataFile
+		}
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		return "", err
+	}
+
+	ds, err := ReadDatasetFile(dataset, filename, options)
+	if err != nil {
+		return "", err
+	}
+	schema, err := NewDataset(dataset, like)
+	if err != nil {
+		return "", err
+	}
+	ds, dropped, err := ConformDataset(ds, schema.Columns, options.Columns)
+	if err != nil {
+		return "", err
+	}
+	if len(dropped) > 0 {
+		log.Printf("Importing %s into %s without the columns %s", filename, dataset, strings.Join(dropped, ", "))
+	}
+	records, err := datasetRecords(ds, like)
+	if err != nil {
+		return "", err
+	}
+
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		abs = filename
+	}
+	source := PageSource{URL: "file://" + filepath.ToSlash(abs), FetchedAt: info.ModTime().UTC().Truncate(time.Second),
+		Extractor: "import"}
+	return writeDatasetRun("import", dataset, dataFile, records, source)
+}
@@ -0,0 +1,532 @@
+package crab
+
+import (
+	"cmpscfa23team2/records"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Jobs and their states live in the records package, so the dal can store jobs without importing crab.
+type (
+	JobState = records.JobState
+	Job      = records.Job
+)
+
+// The states of a Job.
+const (
+	JobQueued    = records.JobQueued
+	JobRunning   = records.JobRunning
+	JobSucceeded = records.JobSucceeded
+	JobFailed    = records.JobFailed
+	JobCancelled = records.JobCancelled
+	JobSkipped   = records.JobSkipped // Another run of the same job held the run lock
+)
+
+// JobStore persists jobs. MemoryJobStore keeps them in process; the dal package provides a MySQL backed
+// implementation.
+type JobStore interface {
+	SaveJob(job Job) error
+	GetJob(id string) (Job, error)
+	ListJobs() ([]Job, error)
+}
+
+// JobRunner executes one job. It should return promptly once ctx is cancelled.
+type JobRunner func(ctx context.Context, job Job) error
+
+// MemoryJobStore is an in-process JobStore.
+type MemoryJobStore = records.MemoryJobStore
+
+// NewMemoryJobStore creates an empty in-process job store.
+func NewMemoryJobStore() *MemoryJobStore {
+	return records.NewMemoryJobStore()
+}
+
+// JobQueue runs jobs on a fixed pool of workers and records every state change in its JobStore.
+type JobQueue struct {
+	store   JobStore
+	runners map[string]JobRunner
+	pending chan string
+
+	mu       sync.Mutex
+	stop     <-chan struct{} // Closed once the workers stop, after which paused jobs are not put back in line
+	inLine   map[string]bool // The jobs in pending, which are not put in line twice
+	cancels  map[string]context.CancelFunc
+	draining bool           // Set by Drain, after which no job starts
+	running  sync.WaitGroup // Jobs under way
+	wg       sync.WaitGroup
+}
+
+// NewJobQueue creates a queue backed by store with the default "crawl" and "scrape" runners registered.
+func NewJobQueue(store JobStore) *JobQueue {
+	q := &JobQueue{
+		store:   store,
+		runners: make(map[string]JobRunner),
+		pending: make(chan string, 1000),
+		inLine:  make(map[string]bool),
+		cancels: make(map[string]context.CancelFunc),
+	}
+	q.Register("crawl", runCrawlJob)
+	q.Register("scrape", runScrapeJob)
+	return q
+}
+
+// Register sets the runner used for jobs of the given type.
+func (q *JobQueue) Register(jobType string, runner JobRunner) {
+	q.runners[jobType] = runner
+}
+
+// Start launches workers that process queued jobs until ctx is cancelled. The jobs left queued in the
+// store, by a drain, a restart or a full queue, are put back in line first, oldest first.
+func (q *JobQueue) Start(ctx context.Context, workers int) {
+	q.mu.Lock()
+	q.stop = ctx.Done()
+	q.mu.Unlock()
+	q.requeueStored()
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-q.pending:
+					q.mu.Lock()
+					delete(q.inLine, id)
+					q.mu.Unlock()
+					q.run(ctx, id)
+				}
+			}
+		}()
+	}
+}
+
+// Wait blocks until all workers have exited.
+func (q *JobQueue) Wait() {
+	q.wg.Wait()
+}
+
+// Enqueue records a new job and schedules it for execution. A "profile" param runs the job with that
+// configuration profile (see JobConfig). With the URL guard enabled, jobs whose "urls" or "url" the guard
+// refuses are not queued.
+func (q *JobQueue) Enqueue(jobType string, params map[string]string) (Job, error) {
+	if _, ok := q.runners[jobType]; !ok {
+		return Job{}, fmt.Errorf("unknown job type: %s", jobType)
+	}
+	settings, err := CurrentConfig().WithProfile(params["profile"])
+	if err != nil {
+		return Job{}, err
+	}
+	if err := checkTargetURLs(settings.URLGuard, jobTargets(params)); err != nil {
+		return Job{}, err
+	}
+	job := Job{
+		ID:        uuid.New().String(),
+		Type:      jobType,
+		Params:    params,
+		State:     JobQueued,
+		CreatedAt: time.Now(),
+	}
+	if err := q.store.SaveJob(job); err != nil {
+		return Job{}, err
+	}
+
+	if !q.putInLine(job.ID) {
+		job.State = JobFailed
+		job.Error = "job queue is full"
+		job.FinishedAt = time.Now()
+		q.store.SaveJob(job)
+		return job, fmt.Errorf("job queue is full")
+	}
+	log.Printf("Enqueued %s job %s", jobType, job.ID)
+	return job, nil
+}
+
+// Cancel stops a queued or running job. Cancelling a finished job is an error.
+func (q *JobQueue) Cancel(id string) error {
+	// Holding mu keeps a worker from starting the job between the state check and the save.
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, err := q.store.GetJob(id)
+	if err != nil {
+		return err
+	}
+	if job.Finished() {
+		return fmt.Errorf("job %s already %s", id, job.State)
+	}
+
+	if cancel, running := q.cancels[id]; running {
+		cancel() // The worker records the cancelled state once the runner returns
+		return nil
+	}
+
+	job.State = JobCancelled
+	job.FinishedAt = time.Now()
+	return q.store.SaveJob(job)
+}
+
+// Pause keeps a queued job from starting until Resume, across restarts. Running jobs cannot be paused;
+// pause the domains they crawl instead.
+func (q *JobQueue) Pause(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, err := q.store.GetJob(id)
+	if err != nil {
+		return err
+	}
+	if job.State != JobQueued {
+		return fmt.Errorf("job %s is %s, only queued jobs can be paused", id, job.State)
+	}
+	return DefaultPauses.PauseJob(id)
+}
+
+// Resume lets a paused job start, putting it back in line if it is still queued.
+func (q *JobQueue) Resume(id string) error {
+	job, err := q.store.GetJob(id)
+	if err != nil {
+		return err
+	}
+	if err := DefaultPauses.ResumeJob(id); err != nil {
+		return err
+	}
+	if job.State == JobQueued && !q.putInLine(id) {
+		log.Printf("Job %s stays queued in the store, the job queue is full", id)
+	}
+	return nil
+}
+
+// Drain stops the queue from starting jobs and waits for the running ones to finish. Those still running
+// when ctx is done are cancelled, and Drain returns ctx's error once their runners have returned. Jobs
+// not started stay queued in the store, and the next Start puts them back in line.
+func (q *JobQueue) Drain(ctx context.Context) error {
+	q.mu.Lock()
+	q.draining = true
+	q.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		q.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+	q.mu.Lock()
+	for _, cancel := range q.cancels {
+		cancel()
+	}
+	q.mu.Unlock()
+	<-done
+	return ctx.Err()
+}
+
+// putInLine queues job id for the workers unless it is in line already. It reports false when the queue
+// is full.
+func (q *JobQueue) putInLine(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.inLine[id] {
+		return true
+	}
+	select {
+	case q.pending <- id:
+		q.inLine[id] = true
+		return true
+	default:
+		return false
+	}
+}
+
+// requeueStored puts the jobs queued in the store back in line, oldest first. Those that do not fit stay
+// queued in the store until the next start.
+func (q *JobQueue) requeueStored() {
+	jobs, err := q.store.ListJobs()
+	if err != nil {
+		log.Printf("Error listing the stored jobs, queued jobs are not resumed: %v", err)
+		return
+	}
+	for i := len(jobs) - 1; i >= 0; i-- { // ListJobs is newest first
+		if jobs[i].State != JobQueued {
+			continue
+		}
+		if !q.putInLine(jobs[i].ID) {
+			log.Printf("Job %s stays queued in the store, the job queue is full", jobs[i].ID)
+		}
+	}
+}
+
+// recheckLater puts the paused job id back in line after pauseRecheck. Once the workers have stopped, or
+// when the queue is full, it is left queued in the store instead, for the next Start to put back in line.
+func (q *JobQueue) recheckLater(id string) {
+	q.mu.Lock()
+	stop := q.stop
+	q.mu.Unlock()
+	time.AfterFunc(pauseRecheck, func() {
+		select {
+		case <-stop: // Checked first, as a stopped queue may still have room
+		default:
+			if !q.putInLine(id) {
+				log.Printf("Job %s stays queued in the store, the job queue is full", id)
+			}
+		}
+	})
+}
+
+// Get returns a job by ID.
+func (q *JobQueue) Get(id string) (Job, error) {
+	return q.store.GetJob(id)
+}
+
+// List returns the job history, newest first.
+func (q *JobQueue) List() ([]Job, error) {
+	return q.store.ListJobs()
+}
+
+// run executes a single job, skipping it if it was cancelled while queued.
+func (q *JobQueue) run(parent context.Context, id string) {
+	job, err := q.store.GetJob(id)
+	if err != nil {
+		log.Printf("Error loading job %s: %v", id, err)
+		return
+	}
+	if job.State != JobQueued {
+		return
+	}
+	if DefaultPauses.JobPaused(id) {
+		q.recheckLater(id) // Look again once it may have been resumed
+		return
+	}
+	work := &backgroundWork{}
+	if locker := currentRunLocker(); locker != nil {
+		release, err := locker.TryLock(JobLockName(job))
+		if err != nil {
+			if errors.Is(err, ErrRunLocked) {
+				job.State = JobSkipped
+				log.Printf("Job %s skipped, the previous run of the same job is still under way", id)
+			} else {
+				job.State = JobFailed
+			}
+			job.Error, job.FinishedAt = err.Error(), time.Now()
+			q.store.SaveJob(job)
+			return
+		}
+		// A cancelled scrape may still be writing its outputs: the lock is held until it returns
+		defer work.then(func() {
+			if err := release(); err != nil {
+				log.Printf("Error releasing the run lock of job %s: %v", id, err)
+			}
+		})
+	}
+
+	q.mu.Lock()
+	job, err = q.store.GetJob(id) // The job may have been cancelled while taking its run lock
+	if err != nil || job.State != JobQueued {
+		q.mu.Unlock()
+		if err != nil {
+			log.Printf("Error loading job %s: %v", id, err)
+		}
+		return
+	}
+	if DefaultPauses.JobPaused(id) { // Or paused
+		q.mu.Unlock()
+		q.recheckLater(id)
+		return
+	}
+	if q.draining {
+		q.mu.Unlock() // The job stays queued in the store
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(parent, backgroundWorkKey{}, work))
+	q.cancels[id] = cancel
+	q.running.Add(1)
+	defer q.running.Done()
+	job.State = JobRunning
+	job.StartedAt = time.Now()
+	if err := q.store.SaveJob(job); err != nil {
+		log.Printf("Error saving job %s: %v", id, err)
+	}
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.cancels, id)
+		q.mu.Unlock()
+		cancel()
+	}()
+
+	err = q.runners[job.Type](ctx, job)
+
+	job.FinishedAt = time.Now()
+	switch {
+	case ctx.Err() != nil:
+		job.State = JobCancelled
+	case err != nil:
+		job.State = JobFailed
+		job.Error = err.Error()
+	default:
+		job.State = JobSucceeded
+	}
+	if err := q.store.SaveJob(job); err != nil {
+		log.Printf("Error saving job %s: %v", id, err)
+	}
+	log.Printf("Job %s %s", id, job.State)
+}
+
+// jobTargets returns the URLs a job's params ask it to fetch: the comma separated "urls" of a crawl job and
+// the "url" of a scrape job.
+func jobTargets(params map[string]string) []string {
+	var targets []string
+	if urls := params["urls"]; urls != "" {
+		for _, u := range strings.Split(urls, ",") {
+			targets = append(targets, strings.TrimSpace(u))
+		}
+	}
+	if u := params["url"]; u != "" {
+		targets = append(targets, u)
+	}
+	return targets
+}
+
+// runCrawlJob crawls the comma separated "urls" param (or the default and configured seeds) using the "workers"
+// param as the number of concurrent crawlers. With "sitemaps" set to "true", the pages listed in the
+// robots.txt sitemaps of the seeds' domains are crawled too, up to "sitemap_limit" per domain. The crawl
+// runs under the job's ctx, so cancelling the job stops it fetching, and with the settings of its profile.
+func runCrawlJob(ctx context.Context, job Job) error {
+	settings := func() Config { return JobConfig(job) }
+	seeds := GetURLsToCrawl()
+	for _, u := range settings().Seeds {
+		seeds = append(seeds, URLData{URL: u})
+	}
+	if urls := job.Params["urls"]; urls != "" {
+		seeds = nil
+		for _, u := range strings.Split(urls, ",") {
+			seeds = append(seeds, URLData{URL: strings.TrimSpace(u)})
+		}
+	}
+	workers := 10
+	if w, err := strconv.Atoi(job.Params["workers"]); err == nil && w > 0 {
+		workers = w
+	}
+	if useSitemaps, _ := strconv.ParseBool(job.Params["sitemaps"]); useSitemaps {
+		limit, _ := strconv.Atoi(job.Params["sitemap_limit"])
+		seeds = AddSitemapSeeds(seeds, limit)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if summary := CrawlWithConfig(ctx, settings, seeds, workers); summary.Error != "" && ctx.Err() == nil {
+		return errors.New(summary.Error)
+	}
+	return nil
+}
+
+// runScrapeJob scrapes the "domain" param, starting from the "url" param when it names a domain
+// configuration, and otherwise runs the scraper of the registry by that name (see Scrapers), which
+// includes the configured JSON and GraphQL targets. Domain scrapes run with the settings of the job's
+// profile; the scrapers of the registry read the configuration of the process, so they take no profile.
+func runScrapeJob(ctx context.Context, job Job) error {
+	domainName := job.Params["domain"]
+	if domainConfig, exists := domainConfigurations[domainName]; exists && job.Params["url"] != "" {
+		settings := func() Config { return JobConfig(job) }
+		if !settings().ScraperEnabled(domainName) {
+			return fmt.Errorf("scraper %s is not enabled", domainName)
+		}
+		return runUntilCancelled(ctx, func() {
+			scrape(ctx, settings, job.Params["url"], domainConfig)
+		})
+	}
+	info, exists := LookupScraper(domainName)
+	if !exists {
+		return fmt.Errorf("invalid domain name provided: %s", domainName)
+	}
+	if !info.Enabled {
+		return fmt.Errorf("scraper %s is not enabled", info.Name)
+	}
+	if job.Params["profile"] != "" {
+		return fmt.Errorf("scraper %s cannot run with a profile, only crawls and domain scrapes can", info.Name)
+	}
+	var err error
+	if cancelErr := runUntilCancelled(ctx, func() { err = RunScraper(info.Name) }); cancelErr != nil {
+		return cancelErr
+	}
+	return err
+}
+
+// runUntilCancelled runs fn in the background and returns when it finishes or ctx is cancelled. The
+// scrapers have no cancellation hooks of their own, so a cancelled scrape is abandoned and finishes on its
+// own; the job queue holds the job's run lock until it has.
+func runUntilCancelled(ctx context.Context, fn func()) error {
+	work, _ := ctx.Value(backgroundWorkKey{}).(*backgroundWork)
+	work.start()
+	done := make(chan struct{})
+	go func() {
+		defer work.end()
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backgroundWorkKey is the context key of the backgroundWork of a job.
+type backgroundWorkKey struct{}
+
+// backgroundWork counts the work a job's runner started that may outlive the runner when the job is
+// cancelled. The methods of a nil backgroundWork do nothing.
+type backgroundWork struct {
+	mu       sync.Mutex
+	running  int
+	whenDone func()
+}
+
+// start records work under way.
+func (w *backgroundWork) start() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.running++
+}
+
+// end records work returned, calling the function passed to then once none is left.
+func (w *backgroundWork) end() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.running--
+	var fn func()
+	if w.running == 0 {
+		fn, w.whenDone = w.whenDone, nil
+	}
+	w.mu.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+// then calls fn once no work is under way: right away if there is none, and otherwise when the last of it
+// returns.
+func (w *backgroundWork) then(fn func()) {
+	w.mu.Lock()
+	if w.running > 0 {
+		w.whenDone = fn
+		w.mu.Unlock()
+		return
+	}
+	w.mu.Unlock()
+	fn()
+}
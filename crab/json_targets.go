@@ -0,0 +1,274 @@
+package crab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// JSON target pagination types.
+const (
+	JSONPageCursor = "cursor" // Send the cursor found at CursorPath in the previous response
+	JSONPageOffset = "offset" // Send the number of items fetched so far
+	JSONPageNumber = "page"   // Send 1, 2, 3, ...
+)
+
+// JSONTarget is a site's JSON/XHR endpoint scraped directly instead of its HTML. Items are selected with
+// a JSONPath expression and each field of the dataset is a JSONPath relative to the item.
+type JSONTarget struct {
+	Name       string            `json:"name"`
+	URL        string            `json:"url"`
+	Headers    map[string]string `json:"headers"`
+	ItemsPath  string            `json:"items_path"` // e.g. "$.data.results[*]"
+	Fields     []JSONField       `json:"fields"`
+	Pagination JSONPagination    `json:"pagination"`
+	// Schema is an optional JSON Schema every response must match. A response that does not stops the
+	// scrape with a SchemaError, so an API change is reported instead of producing a wrong dataset.
+	Schema map[string]interface{} `json:"schema"`
+}
+
+// JSONField maps one dataset column to a JSONPath relative to an item, e.g. {"title", "$.name"}.
+type JSONField struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// JSONPagination describes how a JSON endpoint pages its results. An empty Type fetches one page.
+type JSONPagination struct {
+	Type       string `json:"type"`        // "cursor", "offset" or "page"
+	Param      string `json:"param"`       // Query parameter carrying the cursor, offset or page number
+	CursorPath string `json:"cursor_path"` // JSONPath of the next cursor, for cursor pagination
+	LimitParam string `json:"limit_param"` // Optional page size parameter, e.g. "limit"
+	Limit      int    `json:"limit"`
+	MaxPages   int    `json:"max_pages"` // 100 when zero
+}
+
+// ScrapeJSONTarget fetches every page of a JSON target and maps its items into records keyed by field
+// name. Fields whose path matches nothing are null; paths matching several values give a list.
+func ScrapeJSONTarget(target JSONTarget, client *http.Client) ([]map[string]interface{}, error) {
+	if target.ItemsPath == "" {
+		return nil, fmt.Errorf("JSON target %s has no items_path", target.Name)
+	}
+	for _, field := range target.Fields {
+		if _, err := parseJSONPath(field.Path); err != nil {
+			return nil, fmt.Errorf("JSON target %s field %s: %w", target.Name, field.Name, err)
+		}
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	maxPages := target.Pagination.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultMaxPages
+	}
+
+	records := []map[string]interface{}{}
+	cursor := ""
+	for page := 1; page <= maxPages; page++ {
+		pageURL, err := jsonPageURL(target, page, len(records), cursor)
+		if err != nil {
+			return records, err
+		}
+		doc, err := fetchJSON(client, pageURL, target.Headers)
+		if err != nil {
+			return records, err
+		}
+		if err := checkSchema(target.Schema, doc, pageURL); err != nil {
+			return records, err
+		}
+		items, err := EvalJSONPath(doc, target.ItemsPath)
+		if err != nil {
+			return records, err
+		}
+		for _, item := range items {
+			records = append(records, mapJSONItem(item, target.Fields))
+		}
+
+		pagination := target.Pagination
+		switch pagination.Type {
+		case JSONPageCursor:
+			values, err := EvalJSONPath(doc, pagination.CursorPath)
+			if err != nil {
+				return records, err
+			}
+			if len(values) == 0 || values[0] == nil || fmt.Sprint(values[0]) == "" {
+				return records, nil
+			}
+			next := fmt.Sprint(values[0])
+			if next == cursor {
+				return records, nil // An endpoint repeating its cursor would loop forever
+			}
+			cursor = next
+		case JSONPageOffset, JSONPageNumber:
+			if len(items) == 0 || (pagination.Limit > 0 && len(items) < pagination.Limit) {
+				return records, nil
+			}
+		case "":
+			return records, nil
+		default:
+			return records, fmt.Errorf("JSON target %s: unknown pagination type %q", target.Name, pagination.Type)
+		}
+	}
+	log.Printf("JSON target %s stopped after %d pages", target.Name, maxPages)
+	return records, nil
+}
+
+// jsonPageURL builds the URL of one page of a JSON target.
+func jsonPageURL(target JSONTarget, page, fetched int, cursor string) (string, error) {
+	u, err := url.Parse(target.URL)
+	if err != nil {
+		return "", err
+	}
+	pagination := target.Pagination
+	query := u.Query()
+	if pagination.LimitParam != "" && pagination.Limit > 0 {
+		query.Set(pagination.LimitParam, strconv.Itoa(pagination.Limit))
+	}
+	switch pagination.Type {
+	case JSONPageCursor:
+		if cursor != "" {
+			query.Set(pagination.Param, cursor)
+		}
+	case JSONPageOffset:
+		query.Set(pagination.Param, strconv.Itoa(fetched))
+	case JSONPageNumber:
+		query.Set(pagination.Param, strconv.Itoa(page))
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// fetchJSON GETs a URL and decodes its JSON body, keeping numbers exact.
+func fetchJSON(client *http.Client, rawURL string, headers map[string]string) (interface{}, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", RequestUserAgent())
+	req.Header.Set("Accept", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("fetching %s: status %d: %s", rawURL, resp.StatusCode, body)
+	}
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", rawURL, err)
+	}
+	return doc, nil
+}
+
+// mapJSONItem applies the field paths to one item.
+func mapJSONItem(item interface{}, fields []JSONField) map[string]interface{} {
+	record := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		values, _ := EvalJSONPath(item, field.Path) // Paths were validated up front
+		switch len(values) {
+		case 0:
+			record[field.Name] = nil
+		case 1:
+			record[field.Name] = values[0]
+		default:
+			record[field.Name] = values
+		}
+	}
+	return record
+}
+
+// RunJSONTarget scrapes a JSON target into <name>_data.json in the run directory and notifies webhooks,
+// like Scrape does for HTML targets.
+func RunJSONTarget(target JSONTarget) error {
+	return runRecordsTarget(target.Name, func() ([]map[string]interface{}, error) {
+		return ScrapeJSONTarget(target, nil)
+	})
+}
+
+// runRecordsTarget runs a scrape that produces records, writes them to <name>_data.json in the run
+// directory and notifies webhooks.
+func runRecordsTarget(name string, scrape func() ([]map[string]interface{}, error)) error {
+	summary := RunSummary{Kind: "scrape", Name: name, StartedAt: time.Now()}
+	run, err := StartRun("scrape")
+	if err != nil {
+		log.Printf("Error starting run, writing to the working directory: %v", err)
+	}
+	summary.RunID = run.RunID()
+
+	records, scrapeErr := scrape()
+	var schemaErr *SchemaError
+	if errors.As(scrapeErr, &schemaErr) {
+		// Records from a changed API cannot be trusted, so none are written.
+		summary.FinishedAt = time.Now()
+		summary.Event = EventSchemaDrift
+		summary.Error = schemaErr.Error()
+		log.Printf("Scrape %s: %v", name, schemaErr)
+		run.Finish(nil)
+		reportRun(CurrentConfig(), summary)
+		return schemaErr
+	}
+	outputs, datasetStats, err := writeTargetRecords(name, run.Path(fmt.Sprintf("%s_data.json", name)), records, summary.RunID)
+	if err != nil {
+		log.Printf("Error saving data to JSON file: %v", err)
+	}
+
+	summary.FinishedAt = time.Now()
+	summary.Items = len(records)
+	summary.Outputs = outputs
+	if err == nil {
+		summary.Datasets = []DatasetStats{datasetStats}
+	}
+	switch {
+	case scrapeErr != nil:
+		summary.Event = EventFailed
+		summary.Error = scrapeErr.Error()
+		err = scrapeErr
+	case err != nil:
+		summary.Event = EventFailed
+		summary.Error = err.Error()
+	default:
+		summary.Event = EventCompleted
+	}
+	run.finishReported(&summary)
+	reportRun(CurrentConfig(), summary)
+	return err
+}
+
+// writeTargetRecords writes the records of a target to filename and the statistics of the dataset next to
+// it. It returns the files written, the data file first, with the statistics.
+func writeTargetRecords(name, filename string, records []map[string]interface{}, runID string) ([]string, DatasetStats, error) {
+	filename, err := WriteRecords(filename, records)
+	if err != nil {
+		return []string{filename}, DatasetStats{}, err
+	}
+	stats := newStatsBuilder(name)
+	for _, record := range records {
+		stats.addRecord(record)
+	}
+	datasetStats := stats.stats()
+	datasetStats.RunID = runID
+	return append([]string{filename}, recordStats(datasetStats, filename)...), datasetStats, nil
+}
+
+// findJSONTarget returns the configured JSON target with the given name.
+func findJSONTarget(name string) (JSONTarget, bool) {
+	for _, target := range CurrentConfig().JSONTargets {
+		if target.Name == name {
+			return target, true
+		}
+	}
+	return JSONTarget{}, false
+}
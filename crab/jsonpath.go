@@ -0,0 +1,159 @@
+package crab
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep is one step of a compiled JSONPath expression.
+type jsonPathStep struct {
+	key       string // Object member to select; "*" selects every member or element
+	index     int    // Array element to select when isIndex is set; negative counts from the end
+	isIndex   bool
+	recursive bool // ".." descends into every nested value before selecting
+}
+
+// EvalJSONPath evaluates a JSONPath expression against a decoded JSON document and returns every value it
+// selects, in document order. The supported subset is what JSON targets need: $ for the root, .name and
+// ['name'] for members, [n] for elements (negative n counts from the end), * and [*] for all members or
+// elements, and .. for recursive descent.
+func EvalJSONPath(doc interface{}, path string) ([]interface{}, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	values := []interface{}{doc}
+	for _, step := range steps {
+		var next []interface{}
+		for _, value := range values {
+			if step.recursive {
+				for _, nested := range descendants(value) {
+					next = append(next, selectJSONStep(nested, step)...)
+				}
+			} else {
+				next = append(next, selectJSONStep(value, step)...)
+			}
+		}
+		values = next
+	}
+	return values, nil
+}
+
+// parseJSONPath compiles a JSONPath expression into steps.
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("JSONPath %q must start with $", path)
+	}
+	var steps []jsonPathStep
+	rest := path[1:]
+	for rest != "" {
+		var step jsonPathStep
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.recursive = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(rest, "."):
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("JSONPath %q has an empty member name", path)
+			}
+			step.key, rest = rest[:end], rest[end:]
+			steps = append(steps, step)
+			continue
+		case !strings.HasPrefix(rest, "["):
+			return nil, fmt.Errorf("JSONPath %q: unexpected %q", path, rest)
+		}
+
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("JSONPath %q has an unclosed [", path)
+		}
+		inner := strings.TrimSpace(rest[1:end])
+		rest = rest[end+1:]
+		switch {
+		case inner == "*":
+			step.key = "*"
+		case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+			step.key = inner[1 : len(inner)-1]
+		default:
+			n, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("JSONPath %q: unsupported selector [%s]", path, inner)
+			}
+			step.index, step.isIndex = n, true
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// selectJSONStep applies one non-recursive step to a value.
+func selectJSONStep(value interface{}, step jsonPathStep) []interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if step.isIndex {
+			return nil
+		}
+		if step.key == "*" {
+			keys := make([]string, 0, len(v))
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys) // Objects have no order; sorting keeps results stable
+			out := make([]interface{}, 0, len(keys))
+			for _, key := range keys {
+				out = append(out, v[key])
+			}
+			return out
+		}
+		if member, ok := v[step.key]; ok {
+			return []interface{}{member}
+		}
+	case []interface{}:
+		if step.key == "*" {
+			return append([]interface{}{}, v...)
+		}
+		if step.isIndex {
+			i := step.index
+			if i < 0 {
+				i += len(v)
+			}
+			if i >= 0 && i < len(v) {
+				return []interface{}{v[i]}
+			}
+		}
+	}
+	return nil
+}
+
+// descendants returns value and every value nested in it, depth first.
+func descendants(value interface{}) []interface{} {
+	out := []interface{}{value}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			out = append(out, descendants(v[key])...)
+		}
+	case []interface{}:
+		for _, element := range v {
+			out = append(out, descendants(element)...)
+		}
+	}
+	return out
+}
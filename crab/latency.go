@@ -0,0 +1,248 @@
+package crab
+
+import (
+	"cmpscfa23team2/records"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// responseTiming is how long the response to a fetch took to start arriving (the time to first byte)
+// and to arrive in full, from sending the request. Waiting for a rate limit or a fetch slot is left out,
+// so the timings measure the site rather than the crawler.
+type responseTiming struct {
+	firstByte time.Duration
+	total     time.Duration
+}
+
+// timingTransport times the responses to the requests it sends. A fetch sends one request at a time,
+// so after redirects the timing is that of the last response.
+type timingTransport struct {
+	next   http.RoundTripper
+	timing *responseTiming
+}
+
+func (rt *timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := rt.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	rt.timing.firstByte = time.Since(start)
+	rt.timing.total = rt.timing.firstByte
+	resp.Body = &timedBody{ReadCloser: resp.Body, done: func() { rt.timing.total = time.Since(start) }}
+	return resp, nil
+}
+
+// timedBody calls done once the body has been read to the end or closed.
+type timedBody struct {
+	io.ReadCloser
+	done func()
+	once sync.Once
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.done)
+	}
+	return n, err
+}
+
+func (b *timedBody) Close() error {
+	b.once.Do(b.done)
+	return b.ReadCloser.Close()
+}
+
+// The latencies a LatencyStore keeps.
+type (
+	LatencyPercentiles = records.LatencyPercentiles
+	DomainLatency      = records.DomainLatency
+	LatencySample      = records.LatencySample
+)
+
+// LatencyRecorder collects the response timings of a crawl by domain.
+type LatencyRecorder struct {
+	mu      sync.Mutex
+	domains map[string]*domainTimings
+}
+
+// domainTimings are the timings of the responses of one domain.
+type domainTimings struct {
+	ttfb, fetch []time.Duration
+}
+
+// NewLatencyRecorder returns a recorder without timings.
+func NewLatencyRecorder() *LatencyRecorder {
+	return &LatencyRecorder{domains: map[string]*domainTimings{}}
+}
+
+// Add records the timings of the response for rawURL.
+func (r *LatencyRecorder) Add(rawURL string, ttfb, fetch time.Duration) {
+	domain := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Hostname() != "" {
+		domain = strings.ToLower(u.Hostname())
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	timings := r.domains[domain]
+	if timings == nil {
+		timings = &domainTimings{}
+		r.domains[domain] = timings
+	}
+	timings.ttfb = append(timings.ttfb, ttfb)
+	timings.fetch = append(timings.fetch, fetch)
+}
+
+// Domains returns the latency percentiles of every domain recorded, sorted by domain.
+func (r *LatencyRecorder) Domains() []DomainLatency {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	latencies := make([]DomainLatency, 0, len(r.domains))
+	for domain, timings := range r.domains {
+		latencies = append(latencies, DomainLatency{Domain: domain, Requests: len(timings.ttfb),
+			TTFB: latencyPercentiles(timings.ttfb), Fetch: latencyPercentiles(timings.fetch)})
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i].Domain < latencies[j].Domain })
+	return latencies
+}
+
+// latencyPercentiles returns the p50, p95 and p99 of timings, which it sorts.
+func latencyPercentiles(timings []time.Duration) LatencyPercentiles {
+	sort.Slice(timings, func(i, j int) bool { return timings[i] < timings[j] })
+	at := func(q float64) float64 {
+		rank := int(math.Ceil(q * float64(len(timings))))
+		if rank < 1 {
+			rank = 1
+		}
+		return float64(timings[rank-1]) / float64(time.Millisecond)
+	}
+	return LatencyPercentiles{P50: at(0.50), P95: at(0.95), P99: at(0.99)}
+}
+
+// LatencyStore persists the latencies of crawls, so they can be followed over time; the dal package keeps
+// them in the crawl_latency table.
+type LatencyStore interface {
+	SaveLatency(runID string, startedAt time.Time, domains []DomainLatency) error
+	// LoadLatency returns the samples of domain (every domain when empty) of the runs started between from
+	// and to (unbounded when zero), oldest first.
+	LoadLatency(domain string, from, to time.Time) ([]LatencySample, error)
+}
+
+var (
+	latencyMu    sync.RWMutex
+	latencyStore LatencyStore
+)
+
+// SetLatencyStore sets where crawl latencies are persisted besides the crawl report. Passing nil keeps them
+// in the crawl reports only.
+func SetLatencyStore(store LatencyStore) {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	latencyStore = store
+}
+
+func currentLatencyStore() LatencyStore {
+	latencyMu.RLock()
+	defer latencyMu.RUnlock()
+	return latencyStore
+}
+
+// saveLatency persists the latencies of a crawl run when a latency store is set.
+func saveLatency(summary RunSummary) {
+	store := currentLatencyStore()
+	if store == nil || len(summary.Latency) == 0 {
+		return
+	}
+	if err := store.SaveLatency(summary.RunID, summary.StartedAt, summary.Latency); err != nil {
+		log.Printf("Error saving the latencies of run %s: %v", summary.RunID, err)
+	}
+}
+
+// LatencyHistory returns the latencies of domain (every domain when empty) over the crawl runs started
+// between from and to (unbounded when zero), oldest first. They come from the latency store when one is
+// set, else from the crawl reports of the runs in dir.
+func LatencyHistory(dir, domain string, from, to time.Time) ([]LatencySample, error) {
+	domain = strings.ToLower(domain)
+	if store := currentLatencyStore(); store != nil {
+		return store.LoadLatency(domain, from, to)
+	}
+	runs, err := ListRuns(dir)
+	if err != nil {
+		return nil, err
+	}
+	samples := []LatencySample{}
+	for _, runID := range runs {
+		data, err := os.ReadFile(filepath.Join(dir, runID, "crawl_report.json"))
+		if os.IsNotExist(err) {
+			continue // Not a crawl
+		} else if err != nil {
+			return nil, err
+		}
+		var summary RunSummary
+		if err := json.Unmarshal(data, &summary); err != nil {
+			return nil, fmt.Errorf("parsing the crawl report of run %s: %w", runID, err)
+		}
+		if (!from.IsZero() && summary.StartedAt.Before(from)) || (!to.IsZero() && summary.StartedAt.After(to)) {
+			continue
+		}
+		for _, latency := range summary.Latency {
+			if domain == "" || latency.Domain == domain {
+				samples = append(samples, LatencySample{RunID: runID, Time: summary.StartedAt, DomainLatency: latency})
+			}
+		}
+	}
+	return samples, nil
+}
+
+// ParseLatencyTime reads a from or to parameter: an RFC 3339 time or a date. Empty is the zero time.
+func ParseLatencyTime(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, fmt.Errorf("%s must be an RFC 3339 time or a date, not %q", name, value)
+	}
+	return t, nil
+}
+
+// LatencyHandler serves the latency history of the crawled domains (GET ?domain=&from=&to=), from the
+// latency store or the crawl reports in the output directory.
+func LatencyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	from, err := ParseLatencyTime("from", query.Get("from"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	to, err := ParseLatencyTime("to", query.Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	samples, err := LatencyHistory(CurrentConfig().Output.Dir, query.Get("domain"), from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, samples)
+}
@@ -0,0 +1,157 @@
+package crab
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// lineageSuffix replaces the extension of a dataset file to name the file holding its lineage.
+const lineageSuffix = ".lineage.json"
+
+// extractor describes how a single-page scraper reads its rows. Version changes whenever the extraction
+// logic does, so rows extracted by an older version can be told apart.
+type extractor struct {
+	Version  string
+	Selector string // The selector each row is read from
+}
+
+// extractors lists the single-page scrapers by dataset name, and the file importer.
+var extractors = map[string]extractor{
+	"inflation": {"1", "table tbody tr"},
+	"gasoline":  {"1", "table tbody tr"},
+	"housing":   {"1", ".sc-fLdTid.sc-eZkIzG.iXbLwD.cefCfQ"},
+	"airfare":   {"1", "table tbody tr"},
+	"import":    {"1", ""},
+}
+
+// PageSource is the page a scraper extracted a dataset from.
+type PageSource struct {
+	URL       string
+	FetchedAt time.Time
+	Extractor string // What read the rows when not the dataset's scraper, e.g. "import"
+}
+
+// RowLineage is the provenance of one dataset row: the page and run it came from, the extractor that
+// read it and the hash of its values.
+type RowLineage struct {
+	Dataset          string            `json:"dataset"`
+	Row              int               `json:"row"`    // Position of the row in the dataset, from 0
+	Values           map[string]string `json:"values"` // The row's cells by column
+	SourceURL        string            `json:"source_url"`
+	FetchedAt        time.Time         `json:"fetched_at"`
+	RunID            string            `json:"run_id"`
+	Extractor        string            `json:"extractor"`
+	ExtractorVersion string            `json:"extractor_version"`
+	Selector         string            `json:"selector"`
+	Hash             string            `json:"hash"` // RowHash of the values, to tell a revised row from the one first scraped
+}
+
+// lineageFilename returns the lineage file of a dataset file, e.g. gasoline_data.lineage.json for
+// gasoline_data.json or gasoline_data.ndjson.gz.
+func lineageFilename(dataFile string) string {
+	name := strings.TrimSuffix(dataFile, ".gz")
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".json"), ".ndjson")
+	return name + lineageSuffix
+}
+
+// writeDatasetLineage reads back the dataset just written to dataFile and records the lineage of each of
+// its rows next to it. Rows found in inherited, by their values, keep the lineage of the earlier run they
+// were merged from. It returns the name of the lineage file.
+func writeDatasetLineage(name, dataFile string, source PageSource, runID string, inherited map[string]RowLineage) (string, error) {
+	var load func(name, filename string) (Dataset, error)
+	for _, dataset := range scrapedDatasetFiles {
+		if dataset.Name == name {
+			load = dataset.Load
+		}
+	}
+	if load == nil {
+		return "", fmt.Errorf("unknown dataset %q", name)
+	}
+	ds, err := load(name, dataFile)
+	if err != nil {
+		return "", err
+	}
+
+	extractedBy := name
+	if source.Extractor != "" {
+		extractedBy = source.Extractor
+	}
+	info := extractors[extractedBy]
+	lineage := make([]RowLineage, len(ds.Rows))
+	for i, row := range ds.Rows {
+		if earlier, ok := inherited[strings.Join(row, "\x1f")]; ok {
+			earlier.Row = i
+			lineage[i] = earlier
+			continue
+		}
+		values := make(map[string]string, len(row))
+		for j, column := range ds.Columns {
+			values[column] = row[j]
+		}
+		lineage[i] = RowLineage{
+			Dataset:          name,
+			Row:              i,
+			Values:           values,
+			SourceURL:        source.URL,
+			FetchedAt:        source.FetchedAt.UTC(),
+			RunID:            runID,
+			Extractor:        extractedBy,
+			ExtractorVersion: info.Version,
+			Selector:         info.Selector,
+			Hash:             RowHash(ds.Columns, row),
+		}
+	}
+	data, err := json.MarshalIndent(lineage, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	filename := lineageFilename(dataFile)
+	return filename, WriteFileAtomic(filename, data)
+}
+
+// recordLineage is writeDatasetLineage for the scrapers, which log a lineage that cannot be written
+// rather than fail the scrape. It returns the files to add to the run's outputs.
+func recordLineage(name, dataFile string, source PageSource, run *Run, inherited map[string]RowLineage) []string {
+	filename, err := writeDatasetLineage(name, dataFile, source, run.RunID(), inherited)
+	if err != nil {
+		log.Printf("Error recording the lineage of %s: %v", dataFile, err)
+		return nil
+	}
+	return []string{filename}
+}
+
+// DatasetLineage returns the lineage of every row of the named dataset as of run runID (the latest run
+// when empty), resolved like LoadDatasetAsOf.
+func DatasetLineage(dir, name, runID string) ([]RowLineage, error) {
+	runID, dataFile, err := findDatasetRun(dir, name, runID)
+	if err != nil {
+		return nil, err
+	}
+	var lineage []RowLineage
+	if err := readJSONFile(lineageFilename(dataFile), &lineage); err != nil {
+		return nil, fmt.Errorf("no lineage for the %s dataset of run %s: %w", name, runID, err)
+	}
+	return lineage, nil
+}
+
+// TraceValue returns the lineage of the rows of the named dataset, as of run runID, holding value in
+// column, or in any column when column is empty. It answers where a number in a dataset came from.
+func TraceValue(dir, name, runID, column, value string) ([]RowLineage, error) {
+	lineage, err := DatasetLineage(dir, name, runID)
+	if err != nil {
+		return nil, err
+	}
+	matches := []RowLineage{}
+	for _, row := range lineage {
+		for col, v := range row.Values {
+			if (column == "" || col == column) && strings.TrimSpace(v) == strings.TrimSpace(value) {
+				matches = append(matches, row)
+				break
+			}
+		}
+	}
+	return matches, nil
+}
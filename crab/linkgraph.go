@@ -0,0 +1,271 @@
+package crab
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LinkGraph is the link structure of a crawl: the links found on each crawled page, and the seeds the
+// crawl started from. It answers the questions otherwise asked by post-processing siteMap.json: which
+// pages link to a URL, which pages nothing links to, and how many clicks from a seed each page is.
+type LinkGraph struct {
+	RunID    string
+	Seeds    []string
+	outlinks map[string][]string // By page, of crawled pages only
+	inlinks  map[string][]string // By page, of every page linked to
+	pages    []string            // Every crawled or linked page, sorted
+	depths   map[string]int
+}
+
+// LinkGraphPage is a page of a link graph query.
+type LinkGraphPage struct {
+	URL      string `json:"url"`
+	Crawled  bool   `json:"crawled"`  // Whether the crawl fetched the page, rather than only found links to it
+	Depth    int    `json:"depth"`    // Clicks from the nearest seed; -1 when no seed leads to it
+	Inlinks  int    `json:"inlinks"`  // Other pages linking to it
+	Outlinks int    `json:"outlinks"` // Pages it links to
+}
+
+// LinkQuery selects pages of a link graph: those linking to URL ("inlinks"), those no other page links
+// to ("orphans"), or those more than Depth clicks from a seed ("deeper"). Only pages starting with Prefix
+// are returned, Limit at a time from Offset.
+type LinkQuery struct {
+	Kind   string
+	URL    string
+	Depth  int
+	Prefix string
+	Limit  int // Every page when zero
+	Offset int
+}
+
+// LinkQueryResult is a page of the results of a LinkQuery, and the number matching on every page.
+type LinkQueryResult struct {
+	RunID string          `json:"run_id,omitempty"`
+	Query string          `json:"query"`
+	Total int             `json:"total"`
+	Pages []LinkGraphPage `json:"pages"`
+}
+
+// linkKey is how a URL is compared in a link graph: without its fragment or trailing slash, as links to
+// one page differ in those.
+func linkKey(rawURL string) string {
+	if i := strings.IndexByte(rawURL, '#'); i >= 0 {
+		rawURL = rawURL[:i]
+	}
+	if u, err := url.Parse(rawURL); err == nil && u.Path != "/" {
+		return strings.TrimSuffix(rawURL, "/")
+	}
+	return rawURL
+}
+
+// NewLinkGraph builds the link graph of a sitemap, as LoadSiteMap returns it, crawled from seeds.
+func NewLinkGraph(siteMap map[string][]string, seeds []string) *LinkGraph {
+	g := &LinkGraph{outlinks: map[string][]string{}, inlinks: map[string][]string{}}
+	known := map[string]bool{}
+	for page, links := range siteMap {
+		page = linkKey(page)
+		known[page] = true
+		seen := map[string]bool{page: true} // Links to itself and repeated links count once, or not at all
+		for _, link := range links {
+			if link = linkKey(link); !seen[link] {
+				seen[link] = true
+				g.outlinks[page] = append(g.outlinks[page], link)
+				g.inlinks[link] = append(g.inlinks[link], page)
+				known[link] = true
+			}
+		}
+		if _, ok := g.outlinks[page]; !ok {
+			g.outlinks[page] = nil
+		}
+	}
+	for _, seed := range seeds {
+		seed = linkKey(seed)
+		g.Seeds = append(g.Seeds, seed)
+		known[seed] = true
+	}
+	for page := range known {
+		g.pages = append(g.pages, page)
+	}
+	sort.Strings(g.pages)
+	for _, links := range g.inlinks {
+		sort.Strings(links)
+	}
+
+	// Breadth first from every seed at once gives each page its distance from the nearest one
+	g.depths = map[string]int{}
+	queue := []string{}
+	for _, seed := range g.Seeds {
+		if _, ok := g.depths[seed]; !ok {
+			g.depths[seed] = 0
+			queue = append(queue, seed)
+		}
+	}
+	for len(queue) > 0 {
+		page := queue[0]
+		queue = queue[1:]
+		for _, link := range g.outlinks[page] {
+			if _, ok := g.depths[link]; !ok {
+				g.depths[link] = g.depths[page] + 1
+				queue = append(queue, link)
+			}
+		}
+	}
+	return g
+}
+
+// LoadLinkGraph reads the link graph of the newest crawl run in dir that started no later than runID
+// (any crawl run when empty), from its sitemap and crawl report.
+func LoadLinkGraph(dir, runID string) (*LinkGraph, error) {
+	if runID != "" {
+		if _, err := RunStartTime(runID); err != nil {
+			return nil, err
+		}
+	}
+	runs, err := ListRuns(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runID != "" && runs[i] > runID {
+			continue
+		}
+		for _, name := range []string{"siteMap.json", "siteMap.ndjson"} {
+			path := filepath.Join(dir, runs[i], name)
+			if !outputFileExists(path) {
+				continue
+			}
+			siteMap, err := LoadSiteMap(path)
+			if err != nil {
+				return nil, err
+			}
+			var report RunSummary
+			if data, err := ReadOutputFile(filepath.Join(dir, runs[i], "crawl_report.json")); err == nil {
+				json.Unmarshal(data, &report)
+			}
+			g := NewLinkGraph(siteMap, report.Seeds)
+			g.RunID = runs[i]
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("no crawl run in %s wrote a sitemap", dir)
+}
+
+// Page describes a page of the graph.
+func (g *LinkGraph) Page(rawURL string) LinkGraphPage {
+	key := linkKey(rawURL)
+	page := LinkGraphPage{URL: key, Depth: -1, Inlinks: len(g.inlinks[key]), Outlinks: len(g.outlinks[key])}
+	_, page.Crawled = g.outlinks[key]
+	if depth, ok := g.depths[key]; ok {
+		page.Depth = depth
+	}
+	return page
+}
+
+// Inlinks returns the pages linking to rawURL, sorted.
+func (g *LinkGraph) Inlinks(rawURL string) []string {
+	return g.inlinks[linkKey(rawURL)]
+}
+
+// Orphans returns the crawled pages no other page links to, sorted. Seeds are not orphans, as the crawl
+// was pointed at them.
+func (g *LinkGraph) Orphans() []string {
+	seeds := map[string]bool{}
+	for _, seed := range g.Seeds {
+		seeds[seed] = true
+	}
+	var orphans []string
+	for _, page := range g.pages {
+		if _, crawled := g.outlinks[page]; crawled && len(g.inlinks[page]) == 0 && !seeds[page] {
+			orphans = append(orphans, page)
+		}
+	}
+	return orphans
+}
+
+// DeeperThan returns the pages more than depth clicks from the nearest seed, deepest first. Pages no
+// seed leads to are left out; they are orphans or only linked to by orphans.
+func (g *LinkGraph) DeeperThan(depth int) []string {
+	var deeper []string
+	for _, page := range g.pages {
+		if d, ok := g.depths[page]; ok && d > depth {
+			deeper = append(deeper, page)
+		}
+	}
+	sort.SliceStable(deeper, func(i, j int) bool { return g.depths[deeper[i]] > g.depths[deeper[j]] })
+	return deeper
+}
+
+// Query runs q against the graph.
+func (g *LinkGraph) Query(q LinkQuery) (LinkQueryResult, error) {
+	result := LinkQueryResult{RunID: g.RunID, Query: q.Kind, Pages: []LinkGraphPage{}}
+	var urls []string
+	switch q.Kind {
+	case "inlinks":
+		if q.URL == "" {
+			return result, fmt.Errorf("an inlinks query needs a URL")
+		}
+		urls = g.Inlinks(q.URL)
+	case "orphans":
+		urls = g.Orphans()
+	case "deeper":
+		if q.Depth < 0 {
+			return result, fmt.Errorf("invalid depth %d", q.Depth)
+		}
+		if len(g.Seeds) == 0 {
+			return result, fmt.Errorf("the crawl recorded no seeds to measure depth from")
+		}
+		urls = g.DeeperThan(q.Depth)
+	default:
+		return result, fmt.Errorf("unknown link query %q, want inlinks, orphans or deeper", q.Kind)
+	}
+	if q.Prefix != "" {
+		var matching []string
+		for _, u := range urls {
+			if strings.HasPrefix(u, q.Prefix) {
+				matching = append(matching, u)
+			}
+		}
+		urls = matching
+	}
+	result.Total = len(urls)
+	if q.Offset >= len(urls) {
+		urls = nil
+	} else {
+		urls = urls[q.Offset:]
+	}
+	if q.Limit > 0 && len(urls) > q.Limit {
+		urls = urls[:q.Limit]
+	}
+	for _, u := range urls {
+		result.Pages = append(result.Pages, g.Page(u))
+	}
+	return result, nil
+}
+
+// ParseLinkQuery reads a LinkQuery from the query, url, depth, prefix, limit and offset parameters.
+func ParseLinkQuery(query url.Values) (LinkQuery, error) {
+	q := LinkQuery{Kind: query.Get("query"), URL: query.Get("url"), Prefix: query.Get("prefix")}
+	for _, param := range []struct {
+		name string
+		v    *int
+	}{{"depth", &q.Depth}, {"limit", &q.Limit}, {"offset", &q.Offset}} {
+		value := query.Get(param.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("invalid %s %q", param.name, value)
+		}
+		*param.v = n
+	}
+	if q.Limit > maxDatasetPageSize {
+		return q, fmt.Errorf("limit %d is over %d", q.Limit, maxDatasetPageSize)
+	}
+	return q, nil
+}
@@ -0,0 +1,155 @@
+package crab
+
+import (
+	"cmpscfa23team2/internal/testsite"
+	"context"
+	"expvar"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultLoadTestPages is the number of pages of the mock site a load test crawls.
+	defaultLoadTestPages = 500
+	// defaultLoadTestWorkers is the number of fetch workers of a load test, as for the crawl command.
+	defaultLoadTestWorkers = 10
+	// defaultLoadTestFanout is the number of links on each page of the mock site.
+	defaultLoadTestFanout = 10
+	// defaultLoadTestParagraphs is the number of paragraphs of text on each page of the mock site.
+	defaultLoadTestParagraphs = 20
+)
+
+// LoadTestOptions sets the scale of a load test. Zero fields take their defaults.
+type LoadTestOptions struct {
+	Pages        int // Pages of the mock site to crawl, 500 when zero
+	Fanout       int // Links on each page, 10 when zero
+	Paragraphs   int // Paragraphs of text on each page, 20 when zero
+	Workers      int // Fetch workers, 10 when zero
+	ParseWorkers int // Parse workers, one per CPU when zero
+}
+
+// LoadTestResult is the throughput and resource use of a crawl of the mock site.
+type LoadTestResult struct {
+	Pages             int           `json:"pages"`
+	Errors            int           `json:"errors"`
+	Duration          time.Duration `json:"duration"`
+	PagesPerSec       float64       `json:"pages_per_sec"`
+	AllocsPerPage     float64       `json:"allocs_per_page"`
+	BytesPerPage      float64       `json:"bytes_per_page"` // Bytes allocated, not retained
+	GoroutinesBefore  int           `json:"goroutines_before"`
+	GoroutinesPeak    int           `json:"goroutines_peak"`
+	GoroutinesAfter   int           `json:"goroutines_after"` // Once the crawl returned, to spot leaks
+	FetchWorkers      int           `json:"fetch_workers"`
+	ParseWorkers      int           `json:"parse_workers"`
+	CollectorsCreated int64         `json:"collectors_created"`
+}
+
+// RunLoadTest serves the synthetic site of the integration tests on a local port and crawls every page of
+// it through the full fetch, parse and store pipeline under the current configuration, measuring pages per
+// second, allocations per page and goroutines. The site runs in the process, so its allocations are
+// counted too. The crawl writes its outputs like any other, so point the output directory somewhere
+// disposable; a URL guard must allow loopback addresses.
+func RunLoadTest(ctx context.Context, options LoadTestOptions) (LoadTestResult, error) {
+	if options.Pages <= 0 {
+		options.Pages = defaultLoadTestPages
+	}
+	if options.Fanout <= 0 {
+		options.Fanout = defaultLoadTestFanout
+	}
+	if options.Paragraphs <= 0 {
+		options.Paragraphs = defaultLoadTestParagraphs
+	}
+	workers := options.Workers
+	if workers <= 0 {
+		workers = defaultLoadTestWorkers
+	}
+	config := CurrentConfig()
+	if options.ParseWorkers > 0 {
+		load := config
+		load.Pipeline.ParseWorkers = options.ParseWorkers
+		SetConfig(load)
+		defer SetConfig(config)
+	}
+
+	site := testsite.New(testsite.Config{Pages: options.Pages, Links: testsite.Tree(options.Pages, options.Fanout), Paragraphs: options.Paragraphs})
+	defer site.Close()
+	urls := make([]URLData, options.Pages)
+	for n := range urls {
+		urls[n] = URLData{URL: site.PageURL(n)}
+	}
+
+	result := LoadTestResult{GoroutinesBefore: runtime.NumGoroutine()}
+	result.FetchWorkers, result.ParseWorkers, _ = pipelineWorkers(CurrentConfig().Pipeline, workers)
+	created := collectorCount("created")
+	// Sample the goroutines while the crawl runs, for their peak
+	done := make(chan struct{})
+	peak := make(chan int)
+	go func() {
+		max := runtime.NumGoroutine()
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				peak <- max
+				return
+			case <-ticker.C:
+				if n := runtime.NumGoroutine(); n > max {
+					max = n
+				}
+			}
+		}
+	}()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	summary := Crawl(ctx, urls, workers)
+	result.Duration = time.Since(start)
+	runtime.ReadMemStats(&after)
+	close(done)
+	result.GoroutinesPeak = <-peak
+	site.Close()
+	result.GoroutinesAfter = runtime.NumGoroutine()
+
+	result.Pages, result.Errors = summary.Pages, summary.Errors
+	result.CollectorsCreated = collectorCount("created") - created
+	if result.Duration > 0 {
+		result.PagesPerSec = float64(result.Pages) / result.Duration.Seconds()
+	}
+	if result.Pages > 0 {
+		result.AllocsPerPage = float64(after.Mallocs-before.Mallocs) / float64(result.Pages)
+		result.BytesPerPage = float64(after.TotalAlloc-before.TotalAlloc) / float64(result.Pages)
+	}
+	if summary.Error != "" {
+		return result, fmt.Errorf("crawling the mock site: %s", summary.Error)
+	}
+	return result, nil
+}
+
+// collectorCount returns a count of the crab_collectors metric.
+func collectorCount(name string) int64 {
+	if count, ok := collectorMetrics.Get(name).(*expvar.Int); ok {
+		return count.Value()
+	}
+	return 0
+}
+
+// Summary describes the result for people.
+func (r LoadTestResult) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Load test of %d pages\n", r.Pages)
+	fmt.Fprintf(&b, "  workers:         %d fetch, %d parse\n", r.FetchWorkers, r.ParseWorkers)
+	fmt.Fprintf(&b, "  duration:        %s\n", r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(&b, "  throughput:      %.1f pages/sec\n", r.PagesPerSec)
+	fmt.Fprintf(&b, "  allocations:     %.0f allocs/page, %s/page\n", r.AllocsPerPage, formatBytes(int64(r.BytesPerPage)))
+	fmt.Fprintf(&b, "  goroutines:      %d before, %d peak, %d after\n", r.GoroutinesBefore, r.GoroutinesPeak, r.GoroutinesAfter)
+	fmt.Fprintf(&b, "  collectors:      %d created\n", r.CollectorsCreated)
+	if r.Errors > 0 {
+		fmt.Fprintf(&b, "  errors:          %d\n", r.Errors)
+	}
+	return b.String()
+}
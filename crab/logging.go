@@ -0,0 +1,290 @@
+package crab
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LogConfig sets how much crab logs and where, as given by the crab command's logging flags. With File
+// set, the log goes to that file instead of standard error, and the file is rotated once it grows past
+// MaxSizeMB or gets older than MaxAge. Rotated files are renamed with the time of the rotation, gzip
+// compressed when Compress is set, and only the newest MaxBackups are kept.
+type LogConfig struct {
+	Level      string `json:"level"`       // debug, info, warn or error; info when empty
+	File       string `json:"file"`        // Standard error when empty
+	MaxSizeMB  int    `json:"max_size_mb"` // defaultLogSizeMB when zero
+	MaxAge     string `json:"max_age"`     // Rotate files older than this, e.g. "24h"; never when empty
+	MaxBackups int    `json:"max_backups"` // Rotated files to keep; all when zero
+	Compress   bool   `json:"compress"`
+}
+
+// defaultLogSizeMB is the size at which a log file is rotated when LogConfig sets none.
+const defaultLogSizeMB = 100
+
+// LogLevel is how severe a log message is. Messages below the level set are dropped.
+type LogLevel int32
+
+const (
+	LevelDebug LogLevel = iota - 1 // Every page fetched, for following a crawl
+	LevelInfo                      // Progress of runs
+	LevelWarn                      // Something failed that the run works around
+	LevelError                     // Something failed that the run cannot do without
+)
+
+var logLevelNames = map[LogLevel]string{LevelDebug: "debug", LevelInfo: "info", LevelWarn: "warn", LevelError: "error"}
+
+func (l LogLevel) String() string {
+	if name, ok := logLevelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// ParseLogLevel parses a level name; "warning" is taken for "warn".
+func ParseLogLevel(name string) (LogLevel, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "warning" {
+		name = "warn"
+	}
+	for level, levelName := range logLevelNames {
+		if levelName == name {
+			return level, nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, want debug, info, warn or error", name)
+}
+
+var logLevel atomic.Int32 // LevelInfo when zero
+
+// SetLogLevel sets the level below which messages are dropped.
+func SetLogLevel(level LogLevel) {
+	logLevel.Store(int32(level))
+}
+
+// CurrentLogLevel returns the level below which messages are dropped.
+func CurrentLogLevel() LogLevel {
+	return LogLevel(logLevel.Load())
+}
+
+// logf logs a message of level when the log level lets it through.
+func logf(level LogLevel, format string, args ...interface{}) {
+	if level < CurrentLogLevel() {
+		return
+	}
+	log.Output(3, strings.ToUpper(level.String())+" "+fmt.Sprintf(format, args...))
+}
+
+func debugf(format string, args ...interface{}) { logf(LevelDebug, format, args...) }
+func infof(format string, args ...interface{})  { logf(LevelInfo, format, args...) }
+func warnf(format string, args ...interface{})  { logf(LevelWarn, format, args...) }
+func errorf(format string, args ...interface{}) { logf(LevelError, format, args...) }
+
+// SetupLogging applies config to the standard logger and returns the function that closes its log file.
+func SetupLogging(config LogConfig) (func() error, error) {
+	level := LevelInfo
+	if config.Level != "" {
+		var err error
+		if level, err = ParseLogLevel(config.Level); err != nil {
+			return nil, err
+		}
+	}
+	SetLogLevel(level)
+	if config.File == "" {
+		return func() error { return nil }, nil
+	}
+	w, err := OpenLogFile(config)
+	if err != nil {
+		return nil, err
+	}
+	log.SetOutput(w)
+	return func() error {
+		log.SetOutput(os.Stderr)
+		return w.Close()
+	}, nil
+}
+
+// LogFile is a log file that rotates itself by size and age. Its methods are safe for concurrent use.
+type LogFile struct {
+	config  LogConfig
+	maxSize int64
+	maxAge  time.Duration
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	pending  sync.WaitGroup // Rotated files being compressed
+}
+
+// OpenLogFile opens config.File for appending, creating its directory if needed.
+func OpenLogFile(config LogConfig) (*LogFile, error) {
+	f := &LogFile{config: config, maxSize: int64(config.MaxSizeMB) << 20}
+	if f.maxSize <= 0 {
+		f.maxSize = defaultLogSizeMB << 20
+	}
+	if config.MaxAge != "" {
+		maxAge, err := time.ParseDuration(config.MaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("log max_age: %w", err)
+		}
+		f.maxAge = maxAge
+	}
+	if err := os.MkdirAll(filepath.Dir(config.File), 0755); err != nil {
+		return nil, err
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// open opens the log file, taking its age from when it was last modified.
+func (f *LogFile) open() error {
+	file, err := os.OpenFile(f.config.File, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size, f.openedAt = file, info.Size(), time.Now()
+	if info.Size() > 0 {
+		f.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+// Write appends p to the log file, rotating it first when p would take it past its size or it is too old.
+func (f *LogFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	tooBig := f.size > 0 && f.size+int64(len(p)) > f.maxSize
+	tooOld := f.maxAge > 0 && f.size > 0 && time.Since(f.openedAt) >= f.maxAge
+	if tooBig || tooOld {
+		if err := f.rotate(); err != nil {
+			// Keep logging to the file rather than lose the message
+			fmt.Fprintf(os.Stderr, "Error rotating %s: %v\n", f.config.File, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate renames the log file with the current time and starts a new one.
+func (f *LogFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+func (f *LogFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	ext := filepath.Ext(f.config.File)
+	rotated := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(f.config.File, ext), time.Now().UTC().Format("20060102T150405.000000000Z"), ext)
+	renameErr := os.Rename(f.config.File, rotated)
+	if err := f.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	if f.config.Compress {
+		f.pending.Add(1)
+		go func() {
+			defer f.pending.Done()
+			if err := compressLogFile(rotated); err != nil {
+				fmt.Fprintf(os.Stderr, "Error compressing %s: %v\n", rotated, err)
+			}
+			f.prune()
+		}()
+		return nil
+	}
+	f.prune()
+	return nil
+}
+
+// compressLogFile gzips a rotated log file into name.gz and removes it.
+func compressLogFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := CreateAtomic(name + ".gz")
+	if err != nil {
+		return err
+	}
+	defer out.Abort()
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := out.Commit(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(name)
+}
+
+// prune removes the oldest rotated files beyond MaxBackups.
+func (f *LogFile) prune() {
+	if f.config.MaxBackups <= 0 {
+		return
+	}
+	backups := f.Backups()
+	for len(backups) > f.config.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Error removing old log %s: %v\n", backups[0], err)
+		}
+		backups = backups[1:]
+	}
+}
+
+// Backups returns the rotated log files, oldest first.
+func (f *LogFile) Backups() []string {
+	ext := filepath.Ext(f.config.File)
+	backups, _ := filepath.Glob(strings.TrimSuffix(f.config.File, ext) + "-*" + ext)
+	if ext != "" {
+		compressed, _ := filepath.Glob(strings.TrimSuffix(f.config.File, ext) + "-*" + ext + ".gz")
+		backups = append(backups, compressed...)
+	}
+	sort.Strings(backups) // By the time of their rotation
+	return backups
+}
+
+// Close waits for rotated files to be compressed and closes the log file.
+func (f *LogFile) Close() error {
+	f.mu.Lock()
+	file := f.file
+	f.file = nil
+	f.mu.Unlock()
+	f.pending.Wait()
+	if file == nil {
+		return nil
+	}
+	return file.Close()
+}
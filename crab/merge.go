@@ -0,0 +1,275 @@
+package crab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// conflictsSuffix replaces the extension of a dataset file to name the conflict report of its merge.
+const conflictsSuffix = ".conflicts.json"
+
+// MergeStrategy decides which version of a row wins when a scrape returns a row whose key is already in
+// the dataset with other values.
+type MergeStrategy string
+
+const (
+	MergeKeepLatest      MergeStrategy = "keep-latest"       // The newly scraped values replace the old ones
+	MergeKeepFirst       MergeStrategy = "keep-first"        // The values first scraped are kept
+	MergeErrorOnConflict MergeStrategy = "error-on-conflict" // The scrape fails and nothing is written
+)
+
+// ErrMergeConflict is returned by MergeDatasets under MergeErrorOnConflict when a row changed.
+var ErrMergeConflict = errors.New("merge conflict")
+
+// MergeRule makes a scrape merge its rows into the dataset of the previous run instead of replacing it.
+// Rows are identified by the Key columns, e.g. ["year"]: rows of the previous run the scrape no longer
+// returns are kept, new keys are added and rows with a known key are resolved by Strategy, which is also
+// applied to duplicate keys within one scrape.
+type MergeRule struct {
+	Strategy MergeStrategy `json:"strategy"`
+	Key      []string      `json:"key"`
+}
+
+// ColumnChange is one cell of a row that differs between runs.
+type ColumnChange struct {
+	Column   string `json:"column"`
+	Previous string `json:"previous"`
+	Current  string `json:"current"`
+}
+
+// RowConflict is a row whose values changed between runs, and the version the merge kept.
+type RowConflict struct {
+	Key     map[string]string `json:"key"`
+	Changes []ColumnChange    `json:"changes"`
+	Kept    string            `json:"kept"` // "previous" or "current"
+}
+
+// MergeReport describes a merge: how many rows it added and kept, and every row whose values changed.
+type MergeReport struct {
+	Dataset     string        `json:"dataset"`
+	Strategy    MergeStrategy `json:"strategy"`
+	PreviousRun string        `json:"previous_run,omitempty"`
+	RunID       string        `json:"run_id,omitempty"`
+	Added       int           `json:"added"`
+	Unchanged   int           `json:"unchanged"`
+	Carried     int           `json:"carried"` // Rows of the previous run missing from the scrape
+	Conflicts   []RowConflict `json:"conflicts"`
+}
+
+// MergeDatasets merges current into previous under rule. The merged rows keep the order of previous,
+// followed by the rows with new keys in the order of current. Under MergeErrorOnConflict a changed row
+// returns ErrMergeConflict along with the report listing the changes.
+func MergeDatasets(previous, current Dataset, rule MergeRule) (Dataset, MergeReport, error) {
+	report := MergeReport{Dataset: current.Name, Strategy: rule.Strategy, PreviousRun: previous.RunID, Conflicts: []RowConflict{}}
+	switch rule.Strategy {
+	case MergeKeepLatest, MergeKeepFirst, MergeErrorOnConflict:
+	default:
+		return Dataset{}, report, fmt.Errorf("unknown merge strategy %q", rule.Strategy)
+	}
+	if len(rule.Key) == 0 {
+		return Dataset{}, report, fmt.Errorf("merge rule for %s has no key columns", current.Name)
+	}
+	if len(previous.Rows) > 0 && !reflect.DeepEqual(previous.Columns, current.Columns) {
+		return Dataset{}, report, fmt.Errorf("cannot merge %s: columns changed from %v to %v", current.Name, previous.Columns, current.Columns)
+	}
+	keyColumns := make([]int, len(rule.Key))
+	for i, column := range rule.Key {
+		keyColumns[i] = -1
+		for j, c := range current.Columns {
+			if strings.EqualFold(c, column) {
+				keyColumns[i] = j
+			}
+		}
+		if keyColumns[i] < 0 {
+			return Dataset{}, report, fmt.Errorf("merge key column %q is not in %s", column, current.Name)
+		}
+	}
+	rowKey := func(row []string) string {
+		parts := make([]string, len(keyColumns))
+		for i, j := range keyColumns {
+			parts[i] = strings.TrimSpace(row[j])
+		}
+		return strings.Join(parts, "\x1f")
+	}
+
+	merged := Dataset{Name: current.Name, Columns: current.Columns}
+	index := map[string]int{}         // Row of merged by key
+	fromPrevious := map[string]bool{} // Keys whose row came from previous and was not scraped again yet
+	for _, row := range previous.Rows {
+		key := rowKey(row)
+		if _, seen := index[key]; seen {
+			continue
+		}
+		index[key] = len(merged.Rows)
+		fromPrevious[key] = true
+		merged.Rows = append(merged.Rows, row)
+	}
+
+	for _, row := range current.Rows {
+		key := rowKey(row)
+		at, seen := index[key]
+		if !seen {
+			index[key] = len(merged.Rows)
+			merged.Rows = append(merged.Rows, row)
+			report.Added++
+			continue
+		}
+		old := merged.Rows[at]
+		wasPrevious := fromPrevious[key]
+		delete(fromPrevious, key)
+		changes := rowChanges(current.Columns, old, row)
+		if len(changes) == 0 {
+			if wasPrevious {
+				report.Unchanged++
+			}
+			continue
+		}
+		conflict := RowConflict{Key: map[string]string{}, Changes: changes, Kept: "previous"}
+		for i, j := range keyColumns {
+			conflict.Key[rule.Key[i]] = strings.TrimSpace(row[j])
+		}
+		if rule.Strategy == MergeKeepLatest {
+			merged.Rows[at] = row
+			conflict.Kept = "current"
+		}
+		report.Conflicts = append(report.Conflicts, conflict)
+	}
+	report.Carried = len(fromPrevious)
+	if rule.Strategy == MergeErrorOnConflict && len(report.Conflicts) > 0 {
+		return Dataset{}, report, fmt.Errorf("%w: %d rows of %s changed", ErrMergeConflict, len(report.Conflicts), current.Name)
+	}
+	return merged, report, nil
+}
+
+// rowChanges lists the cells that differ between two versions of a row.
+func rowChanges(columns, previous, current []string) []ColumnChange {
+	var changes []ColumnChange
+	for i, column := range columns {
+		if strings.TrimSpace(previous[i]) != strings.TrimSpace(current[i]) {
+			changes = append(changes, ColumnChange{Column: column, Previous: previous[i], Current: current[i]})
+		}
+	}
+	return changes
+}
+
+// datasetRecords converts a Dataset back into a slice of the flat struct type of like, matching columns
+// to the json tags of its string fields the way NewDataset names them.
+func datasetRecords(ds Dataset, like interface{}) (interface{}, error) {
+	sliceType := reflect.TypeOf(like)
+	if sliceType == nil || sliceType.Kind() != reflect.Slice || sliceType.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("dataset %s: expected a slice of structs, got %T", ds.Name, like)
+	}
+	elem := sliceType.Elem()
+	fields := make([]int, len(ds.Columns))
+	for i, column := range ds.Columns {
+		fields[i] = -1
+		for j := 0; j < elem.NumField(); j++ {
+			field := elem.Field(j)
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "" {
+				name = field.Name
+			}
+			if name == column && field.Type.Kind() == reflect.String {
+				fields[i] = j
+			}
+		}
+		if fields[i] < 0 {
+			return nil, fmt.Errorf("dataset %s: no string field for column %q in %s", ds.Name, column, elem)
+		}
+	}
+	records := reflect.MakeSlice(sliceType, len(ds.Rows), len(ds.Rows))
+	for i, row := range ds.Rows {
+		for j, field := range fields {
+			records.Index(i).Field(field).SetString(row[j])
+		}
+	}
+	return records.Interface(), nil
+}
+
+// scrapeMerge is the outcome of merging a scrape into the dataset of the previous run.
+type scrapeMerge struct {
+	Records    interface{}           // The records to write
+	ReportFile string                // The conflict report written, if any
+	Inherited  map[string]RowLineage // Lineage of the rows kept from earlier runs, by their values
+}
+
+// mergeScrapedRecords applies the configured merge rule of the dataset to records scraped in run: it
+// merges them into the dataset of the previous run and writes the conflict report next to the run's data
+// file. Rows kept from earlier runs carry their lineage over. Without a rule, or without runs to merge
+// across, the records are returned unchanged.
+func mergeScrapedRecords(dataset, name string, records interface{}, run *Run) (scrapeMerge, error) {
+	result := scrapeMerge{Records: records}
+	rule, ok := CurrentConfig().Merge[dataset]
+	if !ok || run == nil {
+		return result, nil
+	}
+	current, err := NewDataset(dataset, records)
+	if err != nil {
+		return result, err
+	}
+	dir := filepath.Dir(run.Dir)
+	previous, err := LoadDatasetAsOf(dir, dataset, "")
+	if err != nil {
+		previous = Dataset{Name: dataset} // The first run of the dataset has nothing to merge into
+	}
+
+	merged, report, mergeErr := MergeDatasets(previous, current, rule)
+	report.RunID = run.ID
+	if len(report.Conflicts) > 0 {
+		for _, conflict := range report.Conflicts {
+			log.Printf("Merge of %s: row %v changed %v, kept %s", dataset, conflict.Key, conflict.Changes, conflict.Kept)
+		}
+		result.ReportFile = conflictsFilename(run.Path(OutputFilename(name)))
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = WriteFileAtomic(result.ReportFile, data)
+		}
+		if err != nil {
+			log.Printf("Error writing merge report %s: %v", result.ReportFile, err)
+			result.ReportFile = ""
+		}
+	}
+	if mergeErr != nil {
+		return result, mergeErr
+	}
+	log.Printf("Merged %s with run %s: %d rows added, %d unchanged, %d carried over, %d changed",
+		dataset, report.PreviousRun, report.Added, report.Unchanged, report.Carried, len(report.Conflicts))
+	if result.Records, err = datasetRecords(merged, records); err != nil {
+		return result, err
+	}
+
+	scraped := make(map[string]bool, len(current.Rows))
+	for _, row := range current.Rows {
+		scraped[strings.Join(row, "\x1f")] = true
+	}
+	if lineage, err := DatasetLineage(dir, dataset, previous.RunID); err == nil {
+		result.Inherited = map[string]RowLineage{}
+		for _, row := range lineage {
+			key := lineageRowKey(previous.Columns, row)
+			if !scraped[key] {
+				result.Inherited[key] = row
+			}
+		}
+	}
+	return result, nil
+}
+
+// lineageRowKey joins the values of a lineage row in column order, to match it with a dataset row.
+func lineageRowKey(columns []string, row RowLineage) string {
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		values[i] = row.Values[column]
+	}
+	return strings.Join(values, "\x1f")
+}
+
+// conflictsFilename returns the merge conflict report of a dataset file, e.g. gasoline_data.conflicts.json
+// for gasoline_data.json.
+func conflictsFilename(dataFile string) string {
+	return strings.TrimSuffix(lineageFilename(dataFile), lineageSuffix) + conflictsSuffix
+}
@@ -0,0 +1,96 @@
+package crab
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Output formats selected by OutputConfig.Format.
+const (
+	OutputFormatJSON   = "json"   // Indented JSON documents (the default)
+	OutputFormatNDJSON = "ndjson" // Newline-delimited JSON, one record per line
+)
+
+// SiteMapEntry is one line of an NDJSON sitemap.
+type SiteMapEntry struct {
+	URL   string   `json:"url"`
+	Links []string `json:"links"`
+}
+
+// ndjsonOutput reports whether outputs should be written as newline-delimited JSON.
+func ndjsonOutput() bool {
+	return CurrentConfig().Output.Format == OutputFormatNDJSON
+}
+
+// OutputFilename returns the file name used for a .json output in the configured format and
+// compression. Calling it on a name it already returned leaves the name unchanged.
+func OutputFilename(name string) string {
+	return outputFilename(CurrentConfig().Output, name)
+}
+
+// outputFilename is OutputFilename in the format and compression of config.
+func outputFilename(config OutputConfig, name string) string {
+	if config.Format == OutputFormatNDJSON && strings.HasSuffix(name, ".json") {
+		name = strings.TrimSuffix(name, ".json") + ".ndjson"
+	}
+	if config.Gzip && !isGzipName(name) {
+		name += ".gz"
+	}
+	return name
+}
+
+// WriteRecords writes a slice of records to filename as an indented JSON array, or as one record per line
+// in NDJSON mode, where the .json extension becomes .ndjson. It returns the name of the file written.
+func WriteRecords(filename string, records interface{}) (string, error) {
+	filename = OutputFilename(filename)
+	if !strings.HasSuffix(strings.TrimSuffix(filename, ".gz"), ".ndjson") {
+		jsonData, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return filename, err
+		}
+		return filename, WriteFileAtomic(filename, jsonData)
+	}
+
+	v := reflect.ValueOf(records)
+	if v.Kind() != reflect.Slice {
+		return filename, fmt.Errorf("NDJSON output needs a slice of records, got %T", records)
+	}
+	stream, err := CreateStream(filename, StreamJSONLines)
+	if err != nil {
+		return filename, err
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := stream.Write(v.Index(i).Interface()); err != nil {
+			stream.Abort()
+			return filename, err
+		}
+	}
+	return filename, stream.Close()
+}
+
+// loadNDJSONSiteMap reads a sitemap written as SiteMapEntry lines.
+func loadNDJSONSiteMap(filename string) (map[string][]string, error) {
+	file, err := OpenOutputFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	siteMap := make(map[string][]string)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var entry SiteMapEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("parsing sitemap %s line %d: %w", filename, line, err)
+		}
+		siteMap[entry.URL] = entry.Links
+	}
+	return siteMap, scanner.Err()
+}
@@ -0,0 +1,196 @@
+package crab
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NumberFormat says how a scraped column writes its numbers. Decimal is the decimal separator, "." when
+// empty, and Thousands the grouping separator, "," when the decimal separator is "." and "." otherwise;
+// spaces are always allowed as grouping. Unit is the unit values are expressed in: a value written in
+// another unit it converts from, such as acres for "sq ft", is converted, and one in an unrelated unit is
+// an error. Without a Unit, any unit is dropped.
+type NumberFormat struct {
+	Decimal   string `json:"decimal"`
+	Thousands string `json:"thousands"`
+	Unit      string `json:"unit"`
+}
+
+// Number is a parsed number and the unit it was written with, if any.
+type Number struct {
+	Value float64
+	Unit  string
+}
+
+// unitAliases maps the ways units are written on scraped pages to their canonical name.
+var unitAliases = map[string][]string{
+	"$":     {"usd", "us$", "$"},
+	"€":     {"eur", "€"},
+	"£":     {"gbp", "£"},
+	"%":     {"percent", "pct", "%"},
+	"sq ft": {"square feet", "sq. ft.", "sq.ft.", "sq ft", "sqft", "ft²"},
+	"acres": {"acres", "acre", "ac"},
+}
+
+// unitFactors converts between units: a value in the first unit times the factor is in the second.
+var unitFactors = map[[2]string]float64{
+	{"acres", "sq ft"}: 43560,
+	{"sq ft", "acres"}: 1.0 / 43560,
+}
+
+// unitSpellings lists every alias with its unit, longest alias first, so matching is greedy.
+var unitSpellings = func() [][2]string {
+	var spellings [][2]string
+	for unit, aliases := range unitAliases {
+		for _, alias := range aliases {
+			spellings = append(spellings, [2]string{alias, unit})
+		}
+	}
+	sort.Slice(spellings, func(i, j int) bool {
+		if len(spellings[i][0]) != len(spellings[j][0]) {
+			return len(spellings[i][0]) > len(spellings[j][0])
+		}
+		return spellings[i][0] < spellings[j][0]
+	})
+	return spellings
+}()
+
+// cutUnit removes a unit written at the start (prefix) or end of s and returns what is left and the
+// canonical unit, or s unchanged and "".
+func cutUnit(s string, prefix bool) (string, string) {
+	lower := strings.ToLower(s)
+	for _, spelling := range unitSpellings {
+		alias, unit := spelling[0], spelling[1]
+		if prefix && strings.HasPrefix(lower, alias) {
+			rest := s[len(alias):]
+			// A letter unit must not run into the number's letters, e.g. "acre" in "acres"
+			if isLetter(alias[0]) && rest != "" && isLetter(rest[0]) {
+				continue
+			}
+			return strings.TrimSpace(rest), unit
+		}
+		if !prefix && strings.HasSuffix(lower, alias) {
+			rest := s[:len(s)-len(alias)]
+			if isLetter(alias[0]) && rest != "" && isLetter(rest[len(rest)-1]) {
+				continue
+			}
+			return strings.TrimSpace(rest), unit
+		}
+	}
+	return s, ""
+}
+
+func isLetter(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// ParseNumber reads a scraped number such as "$1,234.50", "(12.5)", "1.234,5 €", "5.2%" or "0.12 acres"
+// under format. Parentheses and a leading minus sign make it negative.
+func ParseNumber(s string, format NumberFormat) (Number, error) {
+	text := strings.TrimSpace(strings.NewReplacer("\u00a0", " ", "\u202f", " ", "\u2212", "-").Replace(s))
+	negative := false
+	if strings.HasPrefix(text, "(") && strings.HasSuffix(text, ")") {
+		negative, text = true, strings.TrimSpace(text[1:len(text)-1])
+	}
+	var number Number
+	takeSign := func() {
+		if strings.HasPrefix(text, "-") {
+			negative, text = !negative, strings.TrimSpace(text[1:])
+		}
+	}
+	takeSign()
+	text, number.Unit = cutUnit(text, true)
+	takeSign()
+	if number.Unit == "" {
+		text, number.Unit = cutUnit(text, false)
+	}
+	if text == "" {
+		return Number{}, fmt.Errorf("no number in %q", s)
+	}
+
+	decimal, thousands := format.Decimal, format.Thousands
+	if decimal == "" {
+		decimal = "."
+	}
+	if thousands == "" {
+		thousands = ","
+		if decimal == "," {
+			thousands = "."
+		}
+	}
+	text = strings.NewReplacer(thousands, "", " ", "", "'", "").Replace(text)
+	if decimal != "." {
+		text = strings.Replace(text, decimal, ".", 1)
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return Number{}, fmt.Errorf("invalid number %q", s)
+	}
+	if negative {
+		value = -value
+	}
+	number.Value = value
+
+	if format.Unit == "" || number.Unit == format.Unit {
+		return number, nil
+	}
+	if number.Unit == "" {
+		number.Unit = format.Unit
+		return number, nil
+	}
+	factor, ok := unitFactors[[2]string{number.Unit, format.Unit}]
+	if !ok {
+		return Number{}, fmt.Errorf("%q is in %s, not %s", s, number.Unit, format.Unit)
+	}
+	return Number{Value: value * factor, Unit: format.Unit}, nil
+}
+
+// CleanDataset rewrites the cells of the columns with a number format as plain numbers, e.g. "$1,234.50"
+// as "1234.5", so every consumer reads them the same way. Empty cells stay empty; cells that do not parse
+// are left as scraped and returned as errors.
+func CleanDataset(ds Dataset, formats map[string]NumberFormat) (Dataset, []error) {
+	clean := ds
+	clean.Rows = make([][]string, len(ds.Rows))
+	var errs []error
+	for i, row := range ds.Rows {
+		clean.Rows[i] = append([]string(nil), row...)
+		for j, column := range ds.Columns {
+			format, ok := formats[column]
+			if !ok || strings.TrimSpace(row[j]) == "" {
+				continue
+			}
+			number, err := ParseNumber(row[j], format)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s row %d %s: %w", ds.Name, i, column, err))
+				continue
+			}
+			clean.Rows[i][j] = strconv.FormatFloat(number.Value, 'f', -1, 64)
+		}
+	}
+	return clean, errs
+}
+
+// cleanScrapedRecords applies the configured number formats of the dataset's columns to records about to
+// be written, logging the cells that do not parse.
+func cleanScrapedRecords(dataset string, records interface{}) (interface{}, error) {
+	formats, ok := CurrentConfig().Numbers[dataset]
+	if !ok {
+		return records, nil
+	}
+	ds, err := NewDataset(dataset, records)
+	if err != nil {
+		return records, err
+	}
+	clean, errs := CleanDataset(ds, formats)
+	for _, err := range errs {
+		log.Printf("Leaving a value as scraped: %v", err)
+	}
+	cleaned, err := datasetRecords(clean, records)
+	if err != nil {
+		return records, err
+	}
+	return cleaned, nil
+}
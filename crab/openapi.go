@@ -0,0 +1,497 @@
+package crab
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Route is one operation of the daemon's REST API. The daemon's handler, its OpenAPI spec and the Go
+// client of package crab/client are all made from the same routes, so they cannot drift apart.
+type Route struct {
+	Method    string
+	Path      string // With {name} path parameters, e.g. /jobs/{id}
+	Operation string // The operation ID, also the name of the client method
+	Summary   string // What the operation does, as a lower-case phrase, e.g. "lists the jobs"
+	Role      Role   // The role a caller needs; RoleNone when anyone may call it
+	Query     []RouteParam
+	Request   interface{} // A value of the type of the JSON request body, or nil for none
+	Response  interface{} // A value of the type of the JSON response, or nil
+	Status    int         // The status of a success; http.StatusOK when zero
+	Produces  []string    // The media types of the response; application/json when empty
+	Errors    []int       // The error statuses of the operation besides those of authentication
+	// Idempotent routes take an Idempotency-Key header, under which a retried request is answered as the
+	// first was rather than handled again.
+	Idempotent bool
+	handler    http.HandlerFunc
+}
+
+// RouteParam is a query parameter of a Route.
+type RouteParam struct {
+	Name        string
+	Type        string // "string", "integer", or "array" for a comma-separated list of strings
+	Description string
+}
+
+// routePattern returns the ServeMux pattern of a route path: the path up to its first parameter.
+func routePattern(path string) string {
+	if i := strings.Index(path, "{"); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+// routePathParams returns the names of the parameters of a route path.
+func routePathParams(path string) []string {
+	var names []string
+	for _, part := range strings.Split(path, "/") {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			names = append(names, strings.Trim(part, "{}"))
+		}
+	}
+	return names
+}
+
+// serveRoutes dispatches the requests to one ServeMux pattern by method, to the route of the method. A
+// HEAD request is served by the GET route. Only routes needing a role are authenticated.
+func (d *Daemon) serveRoutes(routes []Route) http.HandlerFunc {
+	byMethod := map[string]Route{}
+	var allowed []string
+	open := true
+	for _, route := range routes {
+		byMethod[route.Method] = route
+		allowed = append(allowed, route.Method)
+		open = open && route.Role == RoleNone
+	}
+	routeFor := func(r *http.Request) (Route, bool) {
+		if r.Method == http.MethodHead {
+			route, ok := byMethod[http.MethodGet]
+			return route, ok
+		}
+		route, ok := byMethod[r.Method]
+		return route, ok
+	}
+	serve := func(w http.ResponseWriter, r *http.Request) {
+		route, ok := routeFor(r)
+		if !ok {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		route.handler(w, r)
+	}
+	if open {
+		return serve
+	}
+	return d.auth.Require(func(r *http.Request) Role {
+		if route, ok := routeFor(r); ok {
+			return route.Role
+		}
+		return RoleViewer
+	}, serve)
+}
+
+// OpenAPIDocument is an OpenAPI 3 description of an HTTP API.
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+// OpenAPIInfo is the info object of an OpenAPI document.
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// OpenAPIComponents holds the named schemas and security schemes an OpenAPI document refers to.
+type OpenAPIComponents struct {
+	Schemas         map[string]*OpenAPISchema         `json:"schemas"`
+	SecuritySchemes map[string]*OpenAPISecurityScheme `json:"securitySchemes"`
+}
+
+// OpenAPISecurityScheme is a way of authenticating to an API.
+type OpenAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+}
+
+// OpenAPIOperation is one method of a path of an OpenAPI document.
+type OpenAPIOperation struct {
+	OperationID  string                      `json:"operationId"`
+	Summary      string                      `json:"summary"`
+	Parameters   []OpenAPIParameter          `json:"parameters,omitempty"`
+	RequestBody  *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses    map[string]*OpenAPIResponse `json:"responses"`
+	Security     []map[string][]string       `json:"security,omitempty"`
+	RequiredRole string                      `json:"x-required-role,omitempty"`
+}
+
+// OpenAPIParameter is a path or query parameter of an operation.
+type OpenAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *OpenAPISchema `json:"schema"`
+	Style       string         `json:"style,omitempty"`
+	Explode     *bool          `json:"explode,omitempty"`
+}
+
+// OpenAPIRequestBody is the body of a request to an operation.
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse is a response of an operation.
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType is the schema of a body in one media type.
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPISchema is a JSON schema of an OpenAPI document. The empty schema allows any value.
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+}
+
+// openAPIVersion is the version of the API in its spec. It changes when an operation changes
+// incompatibly.
+const openAPIVersion = "1.0.0"
+
+// OpenAPISpec describes routes as an OpenAPI 3 document. The schemas of the request and response types
+// are named after their Go types.
+func OpenAPISpec(routes []Route) OpenAPIDocument {
+	doc := OpenAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: OpenAPIInfo{Title: "crab", Version: openAPIVersion,
+			Description: "The crawl and scrape jobs, datasets and GraphQL API of a crab daemon."},
+		Paths: map[string]map[string]*OpenAPIOperation{},
+		Components: OpenAPIComponents{
+			Schemas: map[string]*OpenAPISchema{},
+			SecuritySchemes: map[string]*OpenAPISecurityScheme{
+				"apiKey":     {Type: "apiKey", Name: "X-API-Key", In: "header"},
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			},
+		},
+	}
+	schemas := openAPISchemas{doc.Components.Schemas}
+	for _, route := range routes {
+		op := &OpenAPIOperation{OperationID: route.Operation, Summary: upperFirst(route.Summary),
+			Responses: map[string]*OpenAPIResponse{}}
+		for _, name := range routePathParams(route.Path) {
+			op.Parameters = append(op.Parameters, OpenAPIParameter{Name: name, In: "path", Required: true,
+				Schema: &OpenAPISchema{Type: "string"}})
+		}
+		for _, param := range route.Query {
+			p := OpenAPIParameter{Name: param.Name, In: "query", Description: param.Description,
+				Schema: &OpenAPISchema{Type: param.Type}}
+			if param.Type == "array" {
+				explode := false
+				p.Schema.Items = &OpenAPISchema{Type: "string"}
+				p.Style, p.Explode = "form", &explode
+			}
+			op.Parameters = append(op.Parameters, p)
+		}
+		errors := route.Errors
+		if route.Idempotent {
+			op.Parameters = append(op.Parameters, OpenAPIParameter{Name: IdempotencyHeader, In: "header",
+				Description: "a key of the client's choosing, under which retries get the response to the first request",
+				Schema:      &OpenAPISchema{Type: "string"}})
+			errors = append(errors, http.StatusConflict, http.StatusUnprocessableEntity)
+		}
+		if route.Request != nil {
+			op.RequestBody = &OpenAPIRequestBody{Required: true, Content: map[string]*OpenAPIMediaType{
+				"application/json": {Schema: schemas.of(reflect.TypeOf(route.Request))}}}
+		}
+
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := &OpenAPIResponse{Description: http.StatusText(status)}
+		if route.Response != nil || len(route.Produces) > 0 {
+			success.Content = map[string]*OpenAPIMediaType{}
+			for _, mediaType := range routeMediaTypes(route) {
+				schema := &OpenAPISchema{Type: "string"}
+				if mediaType == "application/json" {
+					schema = schemas.of(reflect.TypeOf(route.Response))
+				}
+				success.Content[mediaType] = &OpenAPIMediaType{Schema: schema}
+			}
+		}
+		op.Responses[fmt.Sprint(status)] = success
+		if route.Role != RoleNone {
+			errors = append(errors, http.StatusUnauthorized, http.StatusForbidden)
+			op.Security = []map[string][]string{{"apiKey": {}}, {"bearerAuth": {}}}
+			op.RequiredRole = route.Role.String()
+		}
+		for _, code := range errors {
+			op.Responses[fmt.Sprint(code)] = &OpenAPIResponse{Description: http.StatusText(code),
+				Content: map[string]*OpenAPIMediaType{"text/plain": {Schema: &OpenAPISchema{Type: "string"}}}}
+		}
+
+		if doc.Paths[route.Path] == nil {
+			doc.Paths[route.Path] = map[string]*OpenAPIOperation{}
+		}
+		doc.Paths[route.Path][strings.ToLower(route.Method)] = op
+	}
+	return doc
+}
+
+// routeMediaTypes returns the media types a route responds with.
+func routeMediaTypes(route Route) []string {
+	if len(route.Produces) == 0 {
+		return []string{"application/json"}
+	}
+	return route.Produces
+}
+
+// upperFirst capitalizes the first letter of s.
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// openAPISchemas builds the schemas of Go types, adding those of named structs to the components.
+type openAPISchemas struct {
+	named map[string]*OpenAPISchema
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// of returns the schema of a value of type t as encoding/json writes it.
+func (s openAPISchemas) of(t reflect.Type) *OpenAPISchema {
+	if t == nil {
+		return &OpenAPISchema{}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		if _, ok := s.named[t.Name()]; !ok {
+			// Registered before its fields so that types referring to themselves end
+			s.named[t.Name()] = &OpenAPISchema{}
+			*s.named[t.Name()] = *s.object(t)
+		}
+		return &OpenAPISchema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return s.object(t)
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &OpenAPISchema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &OpenAPISchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &OpenAPISchema{Type: "object", AdditionalProperties: s.of(t.Elem())}
+	}
+	return &OpenAPISchema{}
+}
+
+// object returns the schema of a struct: its exported fields under their JSON names, those without
+// omitempty required. The fields of embedded structs are its own.
+func (s openAPISchemas) object(t reflect.Type) *OpenAPISchema {
+	schema := &OpenAPISchema{Type: "object", Properties: map[string]*OpenAPISchema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			embedded := s.object(field.Type)
+			for property, fieldSchema := range embedded.Properties {
+				schema.Properties[property] = fieldSchema
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = s.of(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// clientOperation is a route as a method of the generated Go client.
+type clientOperation struct {
+	Route
+	Doc        string
+	PathExpr   string // The Go expression of the request path
+	PathParams []string
+	Params     []clientParam
+	Body       string // The Go type of the request body, or ""
+	Result     string // The Go type of the result, or "" when there is none
+}
+
+// clientParam is a query parameter of a client method, as a field of its params struct.
+type clientParam struct {
+	RouteParam
+	Field  string
+	GoType string
+}
+
+var clientTemplate = template.Must(template.New("client").Parse(`// Code generated by "crab openapi -client"; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- if .Crab}}
+	"cmpscfa23team2/crab"
+{{- end}}
+	"context"
+	"net/url"
+{{- if .Strconv}}
+	"strconv"
+{{- end}}
+{{- if .Strings}}
+	"strings"
+{{- end}}
+)
+
+{{range .Operations}}
+{{- if .Params}}
+// {{.Operation}}Params are the query parameters of {{.Operation}}.
+type {{.Operation}}Params struct {
+{{- range .Params}}
+	{{.Field}} {{.GoType}}{{if .Description}} // {{.Description}}{{end}}
+{{- end}}
+}
+
+// values returns the parameters that are set.
+func (p {{.Operation}}Params) values() url.Values {
+	query := url.Values{}
+{{- range .Params}}
+{{- if eq .Type "integer"}}
+	if p.{{.Field}} != 0 {
+		query.Set("{{.Name}}", strconv.Itoa(p.{{.Field}}))
+	}
+{{- else if eq .Type "array"}}
+	if len(p.{{.Field}}) > 0 {
+		query.Set("{{.Name}}", strings.Join(p.{{.Field}}, ","))
+	}
+{{- else}}
+	if p.{{.Field}} != "" {
+		query.Set("{{.Name}}", p.{{.Field}})
+	}
+{{- end}}
+{{- end}}
+	return query
+}
+{{end}}
+// {{.Doc}}
+func (c *Client) {{.Operation}}(ctx context.Context
+{{- range .PathParams}}, {{.}} string{{end}}
+{{- if .Params}}, params {{.Operation}}Params{{end}}
+{{- if .Body}}, body {{.Body}}{{end}}) {{if .Result}}({{.Result}}, error){{else}}error{{end}} {
+{{- if .Result}}
+	var result {{.Result}}
+	err := c.do(ctx, "{{.Method}}", {{.PathExpr}}, {{if .Params}}params.values(){{else}}nil{{end}}, {{if .Body}}body{{else}}nil{{end}}, &result)
+	return result, err
+{{- else}}
+	return c.do(ctx, "{{.Method}}", {{.PathExpr}}, {{if .Params}}params.values(){{else}}nil{{end}}, {{if .Body}}body{{else}}nil{{end}}, nil)
+{{- end}}
+}
+{{end}}`))
+
+// GenerateClient writes the Go source of the methods calling routes, in package pkg, for a Client type
+// with a do method as package crab/client defines. A route with a JSON response returns its Go type;
+// other responses are returned as bytes.
+func GenerateClient(routes []Route, pkg string) ([]byte, error) {
+	data := struct {
+		Package                string
+		Crab, Strconv, Strings bool
+		Operations             []clientOperation
+	}{Package: pkg}
+	for _, route := range routes {
+		op := clientOperation{Route: route, PathParams: routePathParams(route.Path)}
+		op.Doc = fmt.Sprintf("%s %s (%s %s).", route.Operation, route.Summary, route.Method, route.Path)
+		var path []string
+		for _, part := range strings.SplitAfter(route.Path, "/") {
+			if name := strings.TrimSuffix(part, "/"); strings.HasPrefix(name, "{") {
+				path = append(path, "url.PathEscape("+strings.Trim(name, "{}")+")")
+				if strings.HasSuffix(part, "/") {
+					path = append(path, `"/"`)
+				}
+			} else if part != "" {
+				path = append(path, fmt.Sprintf("%q", part))
+			}
+		}
+		op.PathExpr = strings.ReplaceAll(strings.Join(path, " + "), `" + "`, "")
+		for _, param := range route.Query {
+			p := clientParam{RouteParam: param, Field: upperFirst(param.Name), GoType: "string"}
+			switch param.Type {
+			case "integer":
+				p.GoType, data.Strconv = "int", true
+			case "array":
+				p.GoType, data.Strings = "[]string", true
+			}
+			op.Params = append(op.Params, p)
+		}
+		if route.Request != nil {
+			op.Body = clientType(reflect.TypeOf(route.Request))
+		}
+		if route.Response != nil && routeMediaTypes(route)[0] == "application/json" {
+			op.Result = clientType(reflect.TypeOf(route.Response))
+		} else if route.Response != nil || len(route.Produces) > 0 {
+			op.Result = "[]byte"
+		}
+		data.Crab = data.Crab || strings.Contains(op.Body+op.Result, "crab.")
+		data.Operations = append(data.Operations, op)
+	}
+	var source bytes.Buffer
+	if err := clientTemplate.Execute(&source, data); err != nil {
+		return nil, err
+	}
+	return format.Source(source.Bytes())
+}
+
+// clientType names t in the client's code. The records crab aliases are named from crab, as the client's
+// callers know them.
+func clientType(t reflect.Type) string {
+	return strings.ReplaceAll(t.String(), "records.", "crab.")
+}
@@ -0,0 +1,175 @@
+package crab
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// defaultMaxPages stops pagination that never ends, such as a ?page=N listing that keeps serving the last page.
+const defaultMaxPages = 100
+
+// PaginationConfig tells list and table scrapers how to find the next page of a multi-page dataset. The
+// zero value disables pagination, so only the first page is scraped.
+type PaginationConfig struct {
+	FollowRelNext bool   // Follow <link rel="next"> and <a rel="next">
+	NextSelector  string // Selector of the "next page" link, e.g. "li.next a"
+	PageParam     string // Query parameter holding the page number, e.g. "page" for ?page=N
+	MaxPages      int    // Pages to visit at most, 100 when zero
+}
+
+// Enabled reports whether any way of finding the next page is configured.
+func (p PaginationConfig) Enabled() bool {
+	return p.FollowRelNext || p.NextSelector != "" || p.PageParam != ""
+}
+
+// maxPages returns the page limit.
+func (p PaginationConfig) maxPages() int {
+	if p.MaxPages > 0 {
+		return p.MaxPages
+	}
+	return defaultMaxPages
+}
+
+// NextPageURL returns the absolute URL of the page after page, which was fetched from pageURL, or "" if it
+// is the last page. rel=next links win over the next selector, which wins over the page parameter. The
+// page parameter is only incremented while the page still contains items matching itemSelector, since
+// ?page=N listings usually answer past their end with an empty page rather than an error.
+func NextPageURL(page *goquery.Selection, pageURL *url.URL, config PaginationConfig, itemSelector string) string {
+	resolve := func(href string) string {
+		href = strings.TrimSpace(href)
+		if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+			return ""
+		}
+		ref, err := url.Parse(href)
+		if err != nil {
+			return ""
+		}
+		return pageURL.ResolveReference(ref).String()
+	}
+
+	if config.FollowRelNext {
+		var next string
+		page.Find("link[rel], a[rel]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+			for _, rel := range strings.Fields(strings.ToLower(s.AttrOr("rel", ""))) {
+				if rel == "next" {
+					next = resolve(s.AttrOr("href", ""))
+					return next == ""
+				}
+			}
+			return true
+		})
+		if next != "" {
+			return next
+		}
+	}
+
+	if config.NextSelector != "" {
+		if next := resolve(page.Find(config.NextSelector).First().AttrOr("href", "")); next != "" {
+			return next
+		}
+	}
+
+	if config.PageParam != "" && (itemSelector == "" || page.Find(itemSelector).Length() > 0) {
+		query := pageURL.Query()
+		number := 1
+		if value := query.Get(config.PageParam); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return ""
+			}
+			number = n
+		}
+		query.Set(config.PageParam, strconv.Itoa(number+1))
+		next := *pageURL
+		next.RawQuery = query.Encode()
+		return next.String()
+	}
+	return ""
+}
+
+// AttachPagination makes the collector follow next-page links after each page's items have been scraped.
+// Register it after the item handlers. Pages already visited are never visited again, so circular
+// "next" links end the walk.
+func AttachPagination(c *colly.Collector, config PaginationConfig, itemSelector string) {
+	attachPagination(c, config, itemSelector, 0, nil)
+}
+
+// attachPagination is AttachPagination for a walk that already visited done pages, as when resumed from a
+// checkpoint. beforeNext, when set, is called with the number of pages done and the next page's URL
+// before it is visited, once the items of the pages done have been handed on.
+func attachPagination(c *colly.Collector, config PaginationConfig, itemSelector string, done int, beforeNext func(pages int, next string)) {
+	if !config.Enabled() {
+		return
+	}
+	visited := make(map[string]bool)
+	c.OnResponse(func(r *colly.Response) {
+		visited[r.Request.URL.String()] = true
+	})
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		if done+len(visited) >= config.maxPages() {
+			return
+		}
+		next := NextPageURL(e.DOM, e.Request.URL, config, itemSelector)
+		if next == "" || visited[next] {
+			return
+		}
+		if beforeNext != nil {
+			beforeNext(done+len(visited), next)
+		}
+		e.Request.Visit(next)
+	})
+}
+
+// WalkPages fetches startURL and the pages after it with client, calling visit with each page, for the
+// scrapers that read pages with goquery instead of colly.
+func WalkPages(client *http.Client, startURL string, config PaginationConfig, itemSelector string, visit func(doc *goquery.Document) error) error {
+	visited := make(map[string]bool)
+	for next := startURL; next != "" && !visited[next] && len(visited) < config.maxPages(); {
+		visited[next] = true
+		pageURL, err := url.Parse(next)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodGet, next, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", RequestUserAgent())
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			if len(visited) > 1 && res.StatusCode == http.StatusNotFound {
+				return nil // Walked past the last page
+			}
+			return fmt.Errorf("fetching %s: status code %d", next, res.StatusCode)
+		}
+		var doc *goquery.Document
+		if body, ok := renderedBody(context.Background(), CurrentConfig(), next); ok {
+			doc, err = readDocument(bytes.NewReader(body))
+		} else {
+			doc, err = readDocument(res.Body)
+		}
+		res.Body.Close()
+		if err != nil {
+			return err
+		}
+		if err := visit(doc); err != nil {
+			return err
+		}
+		if !config.Enabled() {
+			return nil
+		}
+		next = NextPageURL(doc.Selection, pageURL, config, itemSelector)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package crab
+
+import (
+	"bytes"
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// maxPooledBuffer is the largest buffer returned to the pool; the occasional huge page should not pin
+// its memory for the rest of the crawl.
+const maxPooledBuffer = 4 << 20
+
+var (
+	bufferPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+	readerPool = sync.Pool{New: func() interface{} { return new(bytes.Reader) }}
+)
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns a buffer to the pool. The caller must not use it, or slices of it, afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBuffer {
+		bufferPool.Put(buf)
+	}
+}
+
+// ParseDocument parses an HTML body through a pooled reader. The document copies what it needs from
+// body, so body may be reused once ParseDocument returns.
+func ParseDocument(body []byte) (*goquery.Document, error) {
+	r := readerPool.Get().(*bytes.Reader)
+	r.Reset(body)
+	defer func() {
+		r.Reset(nil)
+		readerPool.Put(r)
+	}()
+	return goquery.NewDocumentFromReader(r)
+}
+
+// readDocument reads a response body into a pooled buffer and parses it.
+func readDocument(body io.Reader) (*goquery.Document, error) {
+	buf := getBuffer()
+	defer putBuffer(buf)
+	if _, err := buf.ReadFrom(body); err != nil {
+		return nil, err
+	}
+	return ParseDocument(buf.Bytes())
+}
+
+// ParseRegions parses only the elements with the given tag names, e.g. "table" or "a", together with their
+// contents, and a <base> element if the page has one. The regions become children of <body> in document
+// order, so selectors like "table tbody tr" or "a[href]" work as on the full page, while the rest of the
+// page is skipped by the tokenizer without ever being turned into nodes.
+func ParseRegions(body []byte, tags ...string) (*goquery.Document, error) {
+	wanted := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		wanted[strings.ToLower(tag)] = true
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+	buf.WriteString("<html><body>")
+	z := html.NewTokenizer(bytes.NewReader(body))
+	region, depth := "", 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if region == "" {
+			if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+				continue
+			}
+			name, _ := z.TagName()
+			tag := string(name)
+			if tag == "base" {
+				buf.Write(z.Raw())
+				continue
+			}
+			if !wanted[tag] {
+				continue
+			}
+			buf.Write(z.Raw())
+			if tt == html.StartTagToken {
+				region, depth = tag, 1
+			}
+			continue
+		}
+
+		buf.Write(z.Raw())
+		if tt == html.StartTagToken || tt == html.EndTagToken {
+			name, _ := z.TagName()
+			if string(name) == region {
+				if tt == html.StartTagToken {
+					depth++
+				} else if depth--; depth == 0 {
+					region = ""
+				}
+			}
+		}
+	}
+	buf.WriteString("</body></html>")
+	return ParseDocument(buf.Bytes())
+}
+
+// ExtractLinks returns the href of every <a> element of an HTML page, in document order, resolved the way
+// colly's AbsoluteURL resolves them: against the page's <base href> if it has one, with fragments removed.
+// Links that are only a fragment or do not parse are skipped. No document tree is built.
+func ExtractLinks(body []byte, pageURL *url.URL) []string {
+	base := pageURL
+	var links []string
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return links
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		name, hasAttr := z.TagName()
+		if !hasAttr || (string(name) != "a" && string(name) != "base") {
+			continue
+		}
+		href, ok := tokenAttr(z, "href")
+		if !ok {
+			continue
+		}
+		if string(name) == "base" {
+			if u, err := url.Parse(href); err == nil && base == pageURL {
+				base = u // colly uses the first <base href>, as is, for every link
+			}
+			continue
+		}
+		if strings.HasPrefix(href, "#") {
+			continue
+		}
+		link, err := base.Parse(href)
+		if err != nil {
+			continue
+		}
+		link.Fragment = ""
+		if link.Scheme == "//" {
+			link.Scheme = pageURL.Scheme
+		}
+		links = append(links, link.String())
+	}
+}
+
+// tokenAttr returns an attribute of the current start tag. It consumes the tag's attributes.
+func tokenAttr(z *html.Tokenizer, name string) (string, bool) {
+	for {
+		key, value, more := z.TagAttr()
+		if string(key) == name {
+			return string(value), true
+		}
+		if !more {
+			return "", false
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package crab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gocolly/colly"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pauseRecheck is how often a paused fetch or job looks again, and how stale the paused state read
+// from the file may be.
+const pauseRecheck = time.Second
+
+// PauseList records the domains and jobs an operator paused. It lives in a JSON file, so pauses survive
+// restarts and "crab pause" reaches crawls running in other processes, which re-read the file every
+// pauseRecheck.
+type PauseList struct {
+	file string
+
+	mu      sync.Mutex
+	state   pauseState
+	checked time.Time // When the file was last read
+}
+
+// pauseState is the content of the pause file: when each domain and job was paused.
+type pauseState struct {
+	Domains map[string]time.Time `json:"domains"`
+	Jobs    map[string]time.Time `json:"jobs"`
+}
+
+// Pauses lists what is paused.
+type Pauses struct {
+	Domains []string `json:"domains"`
+	Jobs    []string `json:"jobs"`
+}
+
+// NewPauseList keeps its pauses in file.
+func NewPauseList(file string) *PauseList {
+	return &PauseList{file: file}
+}
+
+// DefaultPauses is the pause list of crawls and job queues, kept in paused.json in the working directory.
+var DefaultPauses = NewPauseList("paused.json")
+
+// normalizeDomain lower-cases a domain and drops any port.
+func normalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		domain = host
+	}
+	return strings.TrimSuffix(domain, ".")
+}
+
+// PauseDomain holds the requests to domain and its subdomains until ResumeDomain.
+func (p *PauseList) PauseDomain(domain string) error {
+	domain = normalizeDomain(domain)
+	if domain == "" {
+		return fmt.Errorf("no domain given")
+	}
+	return p.update(func(s *pauseState) { s.Domains[domain] = time.Now() })
+}
+
+// ResumeDomain lets the requests to domain go again.
+func (p *PauseList) ResumeDomain(domain string) error {
+	domain = normalizeDomain(domain)
+	return p.update(func(s *pauseState) { delete(s.Domains, domain) })
+}
+
+// PauseJob keeps the job from starting until ResumeJob.
+func (p *PauseList) PauseJob(id string) error {
+	if id == "" {
+		return fmt.Errorf("no job given")
+	}
+	return p.update(func(s *pauseState) { s.Jobs[id] = time.Now() })
+}
+
+// ResumeJob lets the job start.
+func (p *PauseList) ResumeJob(id string) error {
+	return p.update(func(s *pauseState) { delete(s.Jobs, id) })
+}
+
+// DomainPaused reports whether requests to host are paused, by a pause of host or of a parent domain.
+func (p *PauseList) DomainPaused(host string) bool {
+	host = normalizeDomain(host)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refresh(false)
+	for domain := range p.state.Domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// JobPaused reports whether the job is paused.
+func (p *PauseList) JobPaused(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refresh(false)
+	_, paused := p.state.Jobs[id]
+	return paused
+}
+
+// List returns the paused domains and jobs, sorted.
+func (p *PauseList) List() Pauses {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refresh(true)
+	pauses := Pauses{Domains: []string{}, Jobs: []string{}}
+	for domain := range p.state.Domains {
+		pauses.Domains = append(pauses.Domains, domain)
+	}
+	for id := range p.state.Jobs {
+		pauses.Jobs = append(pauses.Jobs, id)
+	}
+	sort.Strings(pauses.Domains)
+	sort.Strings(pauses.Jobs)
+	return pauses
+}
+
+// WaitDomain blocks while requests to host are paused.
+func (p *PauseList) WaitDomain(host string) {
+	if !p.DomainPaused(host) {
+		return
+	}
+	log.Printf("Crawling of %s is paused; waiting for it to be resumed", host)
+	for p.DomainPaused(host) {
+		time.Sleep(pauseRecheck)
+	}
+	log.Printf("Crawling of %s resumed", host)
+}
+
+// refresh re-reads the pause file, at most every pauseRecheck unless force is set. The file is read again
+// whether or not its modification time changed, as writes within one tick of the file system's clock
+// leave it the same. p.mu must be held.
+func (p *PauseList) refresh(force bool) {
+	if !force && time.Since(p.checked) < pauseRecheck {
+		return
+	}
+	p.checked = time.Now()
+	data, err := os.ReadFile(p.file)
+	if errors.Is(err, os.ErrNotExist) {
+		p.state = pauseState{}
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading pause file %s: %v", p.file, err)
+		return
+	}
+	var state pauseState
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("Error parsing pause file %s: %v", p.file, err)
+		return
+	}
+	p.state = state
+}
+
+// update applies change to the latest paused state and writes it back.
+func (p *PauseList) update(change func(s *pauseState)) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refresh(true)
+	state := pauseState{Domains: map[string]time.Time{}, Jobs: map[string]time.Time{}}
+	for domain, at := range p.state.Domains {
+		state.Domains[domain] = at
+	}
+	for id, at := range p.state.Jobs {
+		state.Jobs[id] = at
+	}
+	change(&state)
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(p.file, data); err != nil {
+		return err
+	}
+	p.state, p.checked = state, time.Now()
+	return nil
+}
+
+// AttachPauses holds the collector's requests to paused domains until they are resumed.
+func AttachPauses(c *colly.Collector) {
+	c.OnRequest(func(r *colly.Request) {
+		DefaultPauses.WaitDomain(r.URL.Hostname())
+	})
+}
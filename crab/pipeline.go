@@ -0,0 +1,336 @@
+package crab
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PipelineConfig sizes the two stages of a crawl. Fetch workers only do network I/O and hand each page to
+// the parse workers over a bounded queue, so a page that is slow to parse holds up a parser, not a
+// connection; once the queue is full, fetchers wait for the parsers to catch up.
+type PipelineConfig struct {
+	FetchWorkers int    `json:"fetch_workers"` // ThreadedCrawl's concurrentCrawlers when zero
+	ParseWorkers int    `json:"parse_workers"` // One per CPU when zero
+	Queue        int    `json:"queue"`         // Fetched pages waiting for a parser; resultBuffer when zero
+	FetchTimeout string `json:"fetch_timeout"` // Time a page may take to fetch, e.g. "30s"; colly's 10s when empty
+}
+
+// pipelineMetrics counts the pages through each stage, and the times a fetcher had to wait for a parser.
+var pipelineMetrics = expvar.NewMap("crab_pipeline")
+
+// FetchedPage is a page handed from the fetch stage to the parse stage. Body is nil when the fetch failed,
+// and Status and Error then say why.
+type FetchedPage struct {
+	URLData
+	StatusCode  int
+	ContentType string
+	Header      http.Header // Of the response
+	Body        []byte
+	Status      string // One of the Status constants
+	Error       string
+
+	pageURL *url.URL       // The URL the body was served from, for resolving its links
+	span    *Span          // The page's span, ended by ParsePage
+	elapsed time.Duration  // From sending the request to having the whole response
+	timing  responseTiming // Of the response, without waiting for rate limits
+}
+
+// CrawlResult is what crawling one URL came to. A crawl delivers exactly one for every URL it is given,
+// whether it was fetched, failed or never got its turn, so failed URLs are reported rather than lost.
+type CrawlResult struct {
+	URL        string            `json:"url"`
+	Status     string            `json:"status"`                // One of the Status constants, e.g. "fetched" or "timeout"
+	StatusCode int               `json:"status_code,omitempty"` // Of the response; 0 when there was none
+	Error      string            `json:"error,omitempty"`       // Why the page was not fetched or parsed
+	Links      []string          `json:"links,omitempty"`
+	Records    []ExtractedRecord `json:"records,omitempty"` // What the extractor registered for the page found on it
+
+	skipped  bool          // Never fetched, as the crawl was stopped first
+	seo      *SEOPage      // What the SEO audit checks of the page, when it is enabled
+	security *SecurityPage // What the security audit checks of the page, when it is enabled
+	html     bool          // The page was HTML, which the accessibility scan renders
+	timing   responseTiming
+}
+
+// crawlScope is what belongs to one crawl rather than to the process, handed to each of its fetches and
+// parses so crawls running at once, as the jobs of the daemon do, never record into each other. The zero
+// value records nothing, as with FetchPage and ParsePage outside a crawl.
+type crawlScope struct {
+	tracer       *Tracer               // The crawl's trace, nil when it is off
+	traps        *TrapDetector         // Catches the crawl's trap links, nil when detection is off
+	certificates *CertificateInspector // Records the crawl's certificates, nil when inspection is off
+	robots       *robotsCache          // The robots.txt files the crawl fetched, nil to fetch them every time
+	span         *Span                 // Root span of the crawl, parent of its pages' spans; nil without one
+	runID        string                // ID of the crawl's run, tagging the snapshots of its pages
+}
+
+// FetchPage is the fetch stage of a crawl: it requests urlData.URL and returns the response without
+// looking into it. A failed fetch still returns the page, so the crawl records it without links. Its
+// snapshot is tagged with the newest run in progress.
+func FetchPage(urlData URLData) FetchedPage {
+	return fetchPage(context.Background(), CurrentConfig, crawlScope{runID: CurrentRunID()}, urlData)
+}
+
+// fetchPage is FetchPage under the settings config returns, which it reads as the fetch goes, recording
+// to the crawl of scope. Rendering the page stops once ctx is done.
+func fetchPage(ctx context.Context, config func() Config, scope crawlScope, urlData URLData) FetchedPage {
+	page := FetchedPage{URLData: urlData, span: StartSpan(scope.span.Context(), "crawl.page")}
+	page.span.SetAttribute("url.full", urlData.URL)
+	fc := checkoutCollector(config, scope, &page)
+	defer fc.checkin()
+
+	settings := config()
+	if settings.RespectRobots {
+		if check, err := checkRobots(settings, scope.robots, urlData.URL, ""); err == nil && !check.Allowed {
+			page.Status, page.Error = StatusRobotsDenied, "disallowed by robots.txt: "+check.Rule
+			page.span.SetAttribute("crab.status", page.Status)
+			return page
+		}
+	}
+	release := acquireFetchSlot(settings.Concurrency, urlData.URL) // Wait for the domain's adaptive concurrency, when enabled
+	start := time.Now()
+	// Requests colly refuses to send, such as to invalid URLs, fail without calling OnError
+	if err := fc.c.Visit(urlData.URL); err != nil && page.Error == "" {
+		page.Error = err.Error()
+		fc.fetchErr = err
+	}
+	page.Status = fetchStatus(page.StatusCode, fc.fetchErr)
+	page.elapsed = time.Since(start)
+	release(page, page.elapsed)
+	if page.Body != nil && strings.Contains(strings.ToLower(page.ContentType), "html") {
+		if body, ok := renderedBody(ctx, settings, page.pageURL.String()); ok {
+			page.Body = body
+		}
+	}
+	page.span.SetAttribute("crab.status", page.Status)
+	pipelineMetrics.Add("fetched", 1)
+	return page
+}
+
+// ParsePage is the parse stage of a crawl: it collects the links of a fetched HTML page, which the crawl
+// queues when it follows links, and runs the extractor registered for the page's URL, if any. The crawler
+// itself needs nothing else from the page, so no document tree is built for it unless the extractor asks
+// for one.
+func ParsePage(page FetchedPage) CrawlResult {
+	return parsePage(CurrentConfig(), registeredExtractors(), crawlScope{}, page)
+}
+
+// parsePage is ParsePage with the audits of config and the given extractors, recording to the crawl of
+// scope.
+func parsePage(config Config, extractors []registeredExtractor, scope crawlScope, page FetchedPage) CrawlResult {
+	defer page.span.End()
+	result := CrawlResult{URL: page.URL, Status: page.Status, StatusCode: page.StatusCode, Error: page.Error, timing: page.timing}
+	records, err := extractPage(extractors, page)
+	if err != nil {
+		log.Println("Error extracting page:", err)
+		pipelineMetrics.Add("extract_errors", 1)
+		result.Status, result.Error = StatusParseError, err.Error()
+	}
+	result.Records = records
+	if page.Body == nil || page.pageURL == nil || !strings.Contains(strings.ToLower(page.ContentType), "html") {
+		return result
+	}
+	start := time.Now()
+	result.html = true
+	if config.SEOAudit.Enabled {
+		seo := ScanSEOPage(page.URL, page.Body)
+		seo.ResponseTime = page.elapsed
+		result.seo = &seo
+	}
+	if config.SecurityAudit.Enabled {
+		security := ScanSecurityPage(page.URL, page.Header, page.Body)
+		result.security = &security
+	}
+	for _, link := range ExtractLinks(page.Body, page.pageURL) {
+		if scope.traps.Check(link) != "" {
+			continue
+		}
+		result.Links = append(result.Links, link)
+	}
+	if tracer := scope.tracer; tracer != nil {
+		if lane, ok := tracer.lane(result.URL); ok {
+			tracer.Span("extract", "request", lane, start, time.Now(), map[string]interface{}{"links": len(result.Links)})
+		}
+	}
+	pipelineMetrics.Add("parsed", 1)
+	return result
+}
+
+// parsePageSafely runs parse for the parse workers: a page that panics the parser fails on its own instead
+// of taking the crawl down and going unreported.
+func parsePageSafely(parse func(FetchedPage) CrawlResult, page FetchedPage) (result CrawlResult) {
+	defer func() {
+		if r := recover(); r != nil {
+			pipelineMetrics.Add("parse_panics", 1)
+			result = CrawlResult{URL: page.URL, Status: StatusParseError, StatusCode: page.StatusCode,
+				Error: fmt.Sprintf("parsing failed: %v", r)}
+		}
+	}()
+	return parse(page)
+}
+
+// crawlPipeline crawls urls with fetchWorkers fetching and parseWorkers parsing, sends the result of every
+// URL to ch and closes ch when all are done. URLs wait their turn in a frontier set up by frontierConfig,
+// which the links of the pages on the seeds' hosts join when it follows links. Each URL gets exactly one
+// result, repeated URLs included only once; URLs traps catches, and once ctx is done the URLs
+// not yet fetched, get a result saying so. With one worker in each stage results reach ch in the order
+// the URLs were queued. Each URL's way through the stages goes to events.
+func crawlPipeline(ctx context.Context, frontierConfig FrontierConfig, traps *TrapDetector, urls []URLData, fetchWorkers, parseWorkers, queue int,
+	fetch func(URLData) FetchedPage, parse func(FetchedPage) CrawlResult, ch chan<- CrawlResult, events *EventLog) {
+	if fetchWorkers < 1 {
+		fetchWorkers = 1
+	}
+	if parseWorkers < 1 {
+		parseWorkers = 1
+	}
+	if queue < 1 {
+		queue = resultBuffer
+	}
+	seeds := make(chan URLData)
+	pages := make(chan FetchedPage, queue)
+
+	var skipped []CrawlResult // URLs left when ctx was done or caught as traps, reported after the pages in flight
+	frontier := NewFrontier(frontierConfig)
+	var spillFailed sync.Once
+	push := func(urlData URLData) {
+		added, err := frontier.Push(urlData)
+		if err != nil {
+			spillFailed.Do(func() { log.Println("Error spilling the frontier, keeping it in memory:", err) })
+		}
+		if added {
+			events.Emit(CrawlEvent{Type: EventURLEnqueued, URL: urlData.URL})
+		}
+	}
+	hosts := map[string]bool{} // Whose links a frontier following links queues
+	for _, urlData := range urls {
+		hosts[frontierDomain(urlData.URL)] = true
+		push(urlData)
+	}
+
+	// The frontier is only done once it is empty with no page in flight, whose links could still join it
+	var flight sync.Mutex
+	landed := sync.NewCond(&flight)
+	inFlight := 0
+	go func() {
+		defer close(seeds)
+		defer frontier.Close()
+		for {
+			urlData, ok := frontier.Pop()
+			if !ok {
+				flight.Lock()
+				for inFlight > 0 && frontier.Len() == 0 {
+					landed.Wait()
+				}
+				done := inFlight == 0 && frontier.Len() == 0
+				flight.Unlock()
+				if done {
+					break
+				}
+				continue
+			}
+			if trap := traps.Check(urlData.URL); trap != "" {
+				skipped = append(skipped, CrawlResult{URL: urlData.URL, Status: StatusTrap, Error: "crawler trap: " + trap, skipped: true})
+				continue
+			}
+			if ctx.Err() == nil {
+				flight.Lock()
+				inFlight++
+				flight.Unlock()
+				select {
+				case seeds <- urlData:
+					continue
+				case <-ctx.Done():
+					flight.Lock()
+					inFlight--
+					flight.Unlock()
+				}
+			}
+			skipped = append(skipped, CrawlResult{URL: urlData.URL, Status: StatusNotCrawled,
+				Error: "not crawled: " + ctx.Err().Error(), skipped: true})
+		}
+	}()
+
+	debug := beginPipelineDebug(frontier, pages, fetchWorkers, parseWorkers)
+	defer endPipelineDebug(debug)
+	var fetchers sync.WaitGroup
+	for i := 0; i < fetchWorkers; i++ {
+		fetchers.Add(1)
+		go func(worker int) {
+			defer fetchers.Done()
+			for urlData := range seeds {
+				debug.set(worker, "busy", urlData.URL)
+				events.Emit(CrawlEvent{Type: EventFetchStarted, URL: urlData.URL})
+				page := fetch(urlData)
+				events.Emit(CrawlEvent{Type: EventFetchCompleted, URL: urlData.URL, Status: page.Status, StatusCode: page.StatusCode,
+					Error: page.Error, DurationMS: durationMS(page.elapsed), Bytes: len(page.Body)})
+				select {
+				case pages <- page:
+				default:
+					pipelineMetrics.Add("fetch_waits", 1)
+					debug.set(worker, "blocked", urlData.URL)
+					pages <- page
+				}
+				debug.set(worker, "idle", "")
+			}
+		}(i)
+	}
+	go func() {
+		fetchers.Wait()
+		close(pages)
+	}()
+
+	var parsers sync.WaitGroup
+	for i := 0; i < parseWorkers; i++ {
+		parsers.Add(1)
+		go func(worker int) {
+			defer parsers.Done()
+			for page := range pages {
+				debug.set(worker, "busy", page.URL)
+				start := time.Now()
+				result := parsePageSafely(parse, page)
+				events.Emit(CrawlEvent{Type: EventExtractCompleted, URL: page.URL, Status: result.Status, Error: result.Error,
+					DurationMS: durationMS(time.Since(start)), Links: len(result.Links), Records: len(result.Records)})
+				if frontierConfig.Follow && ctx.Err() == nil {
+					for _, link := range result.Links {
+						if hosts[frontierDomain(link)] {
+							push(URLData{URL: link})
+						}
+					}
+				}
+				flight.Lock()
+				inFlight--
+				landed.Broadcast()
+				flight.Unlock()
+				ch <- result
+				debug.set(worker, "idle", "")
+			}
+		}(fetchWorkers + i)
+	}
+	parsers.Wait()
+	// The seeds are closed, and skipped complete, before the last fetcher and so the last parser is done
+	for _, result := range skipped {
+		ch <- result
+	}
+	close(ch)
+}
+
+// pipelineWorkers returns the sizes of a crawl's stages from config, defaulting the fetch stage to
+// concurrentCrawlers.
+func pipelineWorkers(config PipelineConfig, concurrentCrawlers int) (fetchWorkers, parseWorkers, queue int) {
+	fetchWorkers, parseWorkers, queue = config.FetchWorkers, config.ParseWorkers, config.Queue
+	if fetchWorkers <= 0 {
+		fetchWorkers = concurrentCrawlers
+	}
+	if parseWorkers <= 0 {
+		parseWorkers = runtime.NumCPU()
+	}
+	return fetchWorkers, parseWorkers, queue
+}
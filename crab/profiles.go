@@ -0,0 +1,78 @@
+package crab
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Profile is a named bundle of crawl settings, e.g. "polite-external" or "aggressive-internal", so teams
+// sharing one crab deployment can each run their jobs with their own rate limit, user agent policy, page
+// rendering and output location. Every setting a profile leaves out keeps its value from the rest of the
+// configuration.
+type Profile struct {
+	RateLimit   *RateLimitConfig   `json:"rate_limit"`
+	Fingerprint *FingerprintConfig `json:"fingerprint"`
+	Pipeline    *PipelineConfig    `json:"pipeline"`
+	Render      *RenderConfig      `json:"render"`
+	Output      *OutputConfig      `json:"output"`
+	Snapshots   *SnapshotConfig    `json:"snapshots"`
+	Webhooks    []WebhookConfig    `json:"webhooks"`
+}
+
+// WithProfile returns the configuration with the named profile applied, which the pooled collectors of
+// its crawls are kept apart by. The empty name returns the configuration unchanged.
+func (c Config) WithProfile(name string) (Config, error) {
+	if name == "" {
+		return c, nil
+	}
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return c, fmt.Errorf("no profile named %q (have %s)", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	if profile.RateLimit != nil {
+		c.RateLimit = *profile.RateLimit
+	}
+	if profile.Fingerprint != nil {
+		c.Fingerprint = *profile.Fingerprint
+	}
+	if profile.Pipeline != nil {
+		c.Pipeline = *profile.Pipeline
+	}
+	if profile.Render != nil {
+		c.Render = *profile.Render
+	}
+	if profile.Output != nil {
+		c.Output = *profile.Output
+	}
+	if profile.Snapshots != nil {
+		c.Snapshots = *profile.Snapshots
+	}
+	if profile.Webhooks != nil {
+		c.Webhooks = profile.Webhooks
+	}
+	c.profile = name
+	return c, nil
+}
+
+// ProfileNames returns the names of the configured profiles, sorted.
+func (c Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// JobConfig returns the settings job runs under: the current configuration with the job's "profile"
+// applied. Jobs of different profiles run side by side, each with its own settings, and runners call it
+// as they go to follow configuration reloads. A profile that went missing from a reloaded configuration
+// leaves it as it is.
+func JobConfig(job Job) Config {
+	config := CurrentConfig()
+	if profiled, err := config.WithProfile(job.Params["profile"]); err == nil {
+		config = profiled
+	}
+	return config
+}
@@ -0,0 +1,101 @@
+package crab
+
+import (
+	"github.com/gocolly/colly"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ProxyConfig sends crawl and scrape requests through proxies, rotating over URLs request by request.
+// Username and Password are added to the URLs that carry no credentials of their own; like the URLs they
+// may be written as "secret:<name>".
+type ProxyConfig struct {
+	URLs     []string `json:"urls"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+}
+
+// proxyTransports keeps one transport per proxy configuration and URL guard that crawls run under, so
+// their collectors share its connections.
+var proxyTransports struct {
+	sync.Mutex
+	transports map[string]*http.Transport
+}
+
+// key identifies the configuration among those of proxyTransports.
+func (c ProxyConfig) key() string {
+	return strings.Join(c.URLs, "\n") + "\n" + c.Username + "\n" + c.Password
+}
+
+// crawlTransport returns the transport for crawl requests under the current configuration: a proxying
+// transport when proxies are configured, else a direct one. Both check connections with the URL guard.
+func crawlTransport() http.RoundTripper {
+	config := CurrentConfig()
+	return proxyTransport(config.Proxy, config.URLGuard)
+}
+
+// proxyTransport is crawlTransport under config and guard.
+func proxyTransport(config ProxyConfig, guard URLGuardConfig) http.RoundTripper {
+	direct := guardTransport(guard)
+	if len(config.URLs) == 0 {
+		return direct
+	}
+	key := guard.key() + "\n" + config.key()
+	proxyTransports.Lock()
+	defer proxyTransports.Unlock()
+	if transport := proxyTransports.transports[key]; transport != nil {
+		return transport
+	}
+
+	urls := make([]*url.URL, 0, len(config.URLs))
+	for _, raw := range config.URLs {
+		u, err := url.Parse(raw)
+		if err != nil {
+			log.Printf("Ignoring invalid proxy URL: %v", err)
+			continue
+		}
+		if u.User == nil && config.Username != "" {
+			u.User = url.UserPassword(config.Username, config.Password)
+		}
+		urls = append(urls, u)
+	}
+	if len(urls) == 0 {
+		return direct
+	}
+	transport := direct.Clone()
+	transport.Proxy = roundRobinProxy(urls)
+	if proxyTransports.transports == nil {
+		proxyTransports.transports = map[string]*http.Transport{}
+	}
+	proxyTransports.transports[key] = transport
+	return transport
+}
+
+// roundRobinProxy returns the Proxy function of a transport that picks urls in turn, request by request.
+// Unlike colly's RoundRobinProxySwitcher it leaves the request alone, which the transport may be reading
+// from other goroutines while it picks.
+func roundRobinProxy(urls []*url.URL) func(*http.Request) (*url.URL, error) {
+	var next uint32
+	return func(*http.Request) (*url.URL, error) {
+		i := atomic.AddUint32(&next, 1) - 1
+		return urls[int(i%uint32(len(urls)))], nil
+	}
+}
+
+// AttachProxy sends the collector's requests through the configured proxies. Attach it before the
+// tracer, which wraps whatever transport is in place.
+func AttachProxy(c *colly.Collector) {
+	attachProxy(c, CurrentConfig())
+}
+
+// attachProxy is AttachProxy with the proxies of config, checking the connections with its URL guard when
+// it is enabled.
+func attachProxy(c *colly.Collector, config Config) {
+	if len(config.Proxy.URLs) > 0 || config.URLGuard.Enabled {
+		c.WithTransport(proxyTransport(config.Proxy, config.URLGuard))
+	}
+}
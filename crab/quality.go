@@ -0,0 +1,293 @@
+package crab
+
+import (
+	"cmpscfa23team2/records"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// qualitySuffix replaces the extension of a dataset file to name the file holding its quality results.
+const qualitySuffix = ".quality.json"
+
+// maxUnexpected caps the offending values kept as examples in an expectation result.
+const maxUnexpected = 5
+
+// Expectation kinds.
+const (
+	ExpectBetween  = "between"  // Numbers from Min to Max; either may be left out
+	ExpectPositive = "positive" // Numbers above 0
+	ExpectNotNull  = "not_null" // No empty cells
+	ExpectUnique   = "unique"   // No value twice
+	ExpectInSet    = "in_set"   // Values from Values
+	ExpectMatches  = "matches"  // Values matching the regular expression Pattern
+)
+
+// Severities of a failed expectation.
+const (
+	SeverityFail = "fail" // The dataset is not written
+	SeverityWarn = "warn" // The dataset is written and the failure reported
+)
+
+// ErrQualityFailed is returned when a dataset fails an expectation of severity "fail".
+var ErrQualityFailed = errors.New("data quality check failed")
+
+// Expectation is a rule a dataset column must satisfy, e.g. {"column": "year", "kind": "between", "min":
+// 1935, "max": 2035}. Empty cells only fail "not_null"; the other kinds skip them. Severity is "fail"
+// when empty.
+type Expectation struct {
+	Column   string   `json:"column"`
+	Kind     string   `json:"kind"`
+	Min      *float64 `json:"min,omitempty"`
+	Max      *float64 `json:"max,omitempty"`
+	Values   []string `json:"values,omitempty"`
+	Pattern  string   `json:"pattern,omitempty"`
+	Severity string   `json:"severity,omitempty"`
+}
+
+// String describes the expectation, e.g. "year between 1935 and 2035".
+func (e Expectation) String() string {
+	switch e.Kind {
+	case ExpectBetween:
+		switch {
+		case e.Min != nil && e.Max != nil:
+			return fmt.Sprintf("%s between %g and %g", e.Column, *e.Min, *e.Max)
+		case e.Min != nil:
+			return fmt.Sprintf("%s at least %g", e.Column, *e.Min)
+		case e.Max != nil:
+			return fmt.Sprintf("%s at most %g", e.Column, *e.Max)
+		}
+	case ExpectInSet:
+		return fmt.Sprintf("%s in %v", e.Column, e.Values)
+	case ExpectMatches:
+		return fmt.Sprintf("%s matches %q", e.Column, e.Pattern)
+	}
+	return e.Column + " " + strings.ReplaceAll(e.Kind, "_", " ")
+}
+
+// ExpectationResult is the outcome of checking one expectation against a dataset.
+type ExpectationResult = records.ExpectationResult
+
+// QualityStore persists expectation results; the dal package keeps them in the data_quality table.
+type QualityStore interface {
+	SaveQualityResults(results []ExpectationResult) error
+}
+
+var (
+	qualityMu    sync.RWMutex
+	qualityStore QualityStore
+)
+
+// SetQualityStore sets where expectation results are persisted besides the run directory. Passing nil
+// keeps them in the run directory only.
+func SetQualityStore(store QualityStore) {
+	qualityMu.Lock()
+	defer qualityMu.Unlock()
+	qualityStore = store
+}
+
+// CheckExpectations checks every expectation against ds. An expectation naming a column that is not in
+// the dataset, or with an unknown kind, fails.
+func CheckExpectations(ds Dataset, expectations []Expectation) []ExpectationResult {
+	now := time.Now().UTC()
+	results := make([]ExpectationResult, 0, len(expectations))
+	for _, expectation := range expectations {
+		result := ExpectationResult{Dataset: ds.Name, RunID: ds.RunID, Expectation: expectation.String(),
+			Column: expectation.Column, Severity: expectation.Severity, Success: true, CheckedAt: now}
+		if result.Severity == "" {
+			result.Severity = SeverityFail
+		}
+		fail := func(value string) {
+			result.Success = false
+			result.Failed++
+			if len(result.Unexpected) < maxUnexpected {
+				result.Unexpected = append(result.Unexpected, value)
+			}
+		}
+
+		column := -1
+		for j, name := range ds.Columns {
+			if strings.EqualFold(name, expectation.Column) {
+				column = j
+			}
+		}
+		check, err := expectation.checker()
+		if column < 0 || err != nil {
+			if err == nil {
+				err = fmt.Errorf("no column %q", expectation.Column)
+			}
+			result.Success = false
+			result.Unexpected = []string{err.Error()}
+			results = append(results, result)
+			continue
+		}
+
+		seen := map[string]bool{}
+		for _, row := range ds.Rows {
+			value := ""
+			if column < len(row) {
+				value = strings.TrimSpace(row[column])
+			}
+			if value == "" {
+				if expectation.Kind == ExpectNotNull {
+					result.Checked++
+					fail(value)
+				}
+				continue
+			}
+			result.Checked++
+			if expectation.Kind == ExpectUnique {
+				if seen[value] {
+					fail(value)
+				}
+				seen[value] = true
+				continue
+			}
+			if !check(value) {
+				fail(value)
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// checker returns the test a non-empty cell must pass.
+func (e Expectation) checker() (func(value string) bool, error) {
+	number := func(value string) (float64, bool) {
+		n, err := ParseNumber(value, NumberFormat{})
+		return n.Value, err == nil
+	}
+	switch e.Kind {
+	case ExpectBetween:
+		return func(value string) bool {
+			n, ok := number(value)
+			return ok && (e.Min == nil || n >= *e.Min) && (e.Max == nil || n <= *e.Max)
+		}, nil
+	case ExpectPositive:
+		return func(value string) bool {
+			n, ok := number(value)
+			return ok && n > 0
+		}, nil
+	case ExpectNotNull, ExpectUnique:
+		return func(string) bool { return true }, nil
+	case ExpectInSet:
+		return func(value string) bool {
+			for _, allowed := range e.Values {
+				if value == allowed {
+					return true
+				}
+			}
+			return false
+		}, nil
+	case ExpectMatches:
+		re, err := regexp.Compile(e.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", e.Pattern, err)
+		}
+		return re.MatchString, nil
+	}
+	return nil, fmt.Errorf("unknown expectation kind %q", e.Kind)
+}
+
+// qualityFailed reports whether any result of severity "fail" failed.
+func qualityFailed(results []ExpectationResult) bool {
+	for _, result := range results {
+		if !result.Success && result.Severity != SeverityWarn {
+			return true
+		}
+	}
+	return false
+}
+
+// qualityFilename returns the quality results file of a dataset file, e.g. gasoline_data.quality.json
+// for gasoline_data.json.
+func qualityFilename(dataFile string) string {
+	return strings.TrimSuffix(lineageFilename(dataFile), lineageSuffix) + qualitySuffix
+}
+
+// checkScrapedQuality checks records about to be written to run against the configured expectations of
+// the dataset. The results are written next to the run's data file and saved to the quality store, and
+// violations are logged. It returns the results file, and ErrQualityFailed when an expectation of
+// severity "fail" failed.
+func checkScrapedQuality(dataset, name string, records interface{}, run *Run) (string, error) {
+	expectations := CurrentConfig().Quality[dataset]
+	if len(expectations) == 0 {
+		return "", nil
+	}
+	ds, err := NewDataset(dataset, records)
+	if err != nil {
+		return "", err
+	}
+	ds.RunID = run.RunID()
+	results := CheckExpectations(ds, expectations)
+	for _, result := range results {
+		if !result.Success {
+			log.Printf("Data quality %s: %s %s failed for %d of %d values, e.g. %s", result.Severity, dataset,
+				result.Expectation, result.Failed, result.Checked, strings.Join(result.Unexpected, ", "))
+		}
+	}
+
+	qualityMu.RLock()
+	store := qualityStore
+	qualityMu.RUnlock()
+	if store != nil {
+		if err := store.SaveQualityResults(results); err != nil {
+			log.Printf("Error saving the data quality results of %s: %v", dataset, err)
+		}
+	}
+	filename := qualityFilename(run.Path(OutputFilename(name)))
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err == nil {
+		err = WriteFileAtomic(filename, data)
+	}
+	if err != nil {
+		log.Printf("Error writing data quality results %s: %v", filename, err)
+		filename = ""
+	}
+	now := time.Now()
+	raiseAlerts(CurrentConfig(), RunSummary{Kind: "scrape", Name: dataset, RunID: run.RunID(), StartedAt: now, FinishedAt: now},
+		qualityAlerts(dataset, run.RunID(), results))
+	if qualityFailed(results) {
+		return filename, fmt.Errorf("%w for %s", ErrQualityFailed, dataset)
+	}
+	return filename, nil
+}
+
+// LoadQualityResults returns the expectation results of the named dataset as of run runID (the latest
+// run when empty). Unlike LoadDatasetAsOf it also finds runs whose dataset failed a check and so was not
+// written.
+func LoadQualityResults(dir, name, runID string) ([]ExpectationResult, error) {
+	dataFile := ""
+	for _, source := range scrapedDatasetFiles {
+		if source.Name == name {
+			dataFile = source.DataFile
+		}
+	}
+	if dataFile == "" {
+		return nil, fmt.Errorf("unknown dataset %q", name)
+	}
+	runs, err := ListRuns(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runID != "" && runs[i] > runID {
+			continue
+		}
+		if path := qualityFilename(filepath.Join(dir, runs[i], dataFile)); outputFileExists(path) {
+			var results []ExpectationResult
+			if err := readJSONFile(path, &results); err != nil {
+				return nil, err
+			}
+			return results, nil
+		}
+	}
+	return nil, fmt.Errorf("no data quality results for the %s dataset in %s", name, dir)
+}
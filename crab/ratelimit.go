@@ -0,0 +1,88 @@
+package crab
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocolly/colly"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig spaces out the requests to each domain. The zero value sends requests as fast as the
+// workers make them, as the crawler always has; the throttle still backs off domains that answer 429 or
+// 503 either way.
+type RateLimitConfig struct {
+	DelayMS       int `json:"delay_ms"`        // Minimum time between two requests to one domain
+	RandomDelayMS int `json:"random_delay_ms"` // Up to this much more, drawn for every request
+}
+
+// domainPacer hands out request slots per domain. It is shared by all collectors, so the limit holds
+// however many workers fetch from a domain.
+type domainPacer struct {
+	mu   sync.Mutex
+	next map[string]time.Time
+}
+
+var defaultPacer = &domainPacer{next: make(map[string]time.Time)}
+
+// reserve books the next request to host under config and returns how long to wait for it.
+func (p *domainPacer) reserve(host string, config RateLimitConfig) time.Duration {
+	spacing := time.Duration(config.DelayMS)*time.Millisecond + randDuration(time.Duration(config.RandomDelayMS)*time.Millisecond)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	start := now
+	if next := p.next[host]; next.After(start) {
+		start = next
+	}
+	p.next[host] = start.Add(spacing)
+	return start.Sub(now)
+}
+
+// AttachRateLimit makes the collector's requests wait for their domain's next slot under the configured
+// rate limit.
+func AttachRateLimit(c *colly.Collector) {
+	attachRateLimit(c, CurrentConfig)
+}
+
+// attachRateLimit is AttachRateLimit with the rate limit of config, read at every request.
+func attachRateLimit(c *colly.Collector, config func() Config) {
+	c.OnRequest(func(r *colly.Request) {
+		config := config().RateLimit
+		if config.DelayMS <= 0 && config.RandomDelayMS <= 0 {
+			return
+		}
+		if wait := defaultPacer.reserve(r.URL.Host, config); wait > 0 {
+			time.Sleep(wait)
+		}
+	})
+}
+
+// waitForSlot holds a request to host sent outside the collectors, such as a robots.txt fetch or a page's
+// rendering, to their pacing: it is refused while DefaultCircuitBreaker blocks host, and waits for host's
+// next slot under the rate limit of config and then under DefaultThrottle. It returns ctx's error when ctx
+// is done first.
+func waitForSlot(ctx context.Context, config Config, host string) error {
+	if !DefaultCircuitBreaker.Allow(host) {
+		return fmt.Errorf("%s is blocked by anti-bot protection", host)
+	}
+	if err := sleepContext(ctx, defaultPacer.reserve(host, config.RateLimit)); err != nil {
+		return err
+	}
+	return sleepContext(ctx, DefaultThrottle.Delay(host))
+}
+
+// sleepContext waits for d, or returns ctx's error when ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
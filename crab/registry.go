@@ -0,0 +1,210 @@
+package crab
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ScraperInfo describes a named scraper of the registry.
+type ScraperInfo struct {
+	Name        string        `json:"name"`
+	Kind        string        `json:"kind"` // "table" for single-page scrapers, "tables", "listing", "json" or "graphql"
+	Description string        `json:"description"`
+	SourceURL   string        `json:"source_url"`
+	Schedule    string        `json:"schedule,omitempty"` // How often its source changes, e.g. "@daily", for schedulers
+	Output      string        `json:"output"`             // Name of the dataset file it writes, comma separated for several
+	Schema      []SchemaField `json:"schema,omitempty"`   // Fields of its records
+	// Enabled is whether it runs; the registration sets the default, and the config's scrapers list
+	// overrides it both ways.
+	Enabled bool `json:"enabled"`
+
+	run func() error
+}
+
+// SchemaField is a field of a scraper's records, with a JSON type: string, number, boolean, array or
+// object, or any when it is only known once scraped.
+type SchemaField struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+var (
+	scraperRegistryMu sync.RWMutex
+	scraperRegistry   = map[string]ScraperInfo{}
+)
+
+// RegisterScraper adds a scraper to the registry under info.Name, replacing any of the same name. record
+// is a value of the type of its records, from which its schema is read; run scrapes it.
+func RegisterScraper(info ScraperInfo, record interface{}, run func() error) {
+	info.Schema = RecordSchema(record)
+	info.run = run
+	scraperRegistryMu.Lock()
+	defer scraperRegistryMu.Unlock()
+	scraperRegistry[info.Name] = info
+}
+
+func init() {
+	tableScraper := func(name, description, url, output string, record interface{}, scrape func()) {
+		RegisterScraper(ScraperInfo{Name: name, Kind: "table", Description: description, SourceURL: url,
+			Schedule: "@monthly", Output: output, Enabled: true}, record, func() error { scrape(); return nil })
+	}
+	tableScraper("inflation", "Monthly US inflation rates by year", inflationURL, "inflation_data.json", YearData{}, ScrapeInflationData)
+	tableScraper("gasoline", "Gasoline prices adjusted for inflation by year", gasolineURL, "gasoline_data.json", GasolineData{}, ScrapeGasInflationData)
+	tableScraper("airfare-inflation", "Airfare inflation and prices by month", airfareURL, "airfare_data_inflation.json", AirfareData{}, Airdatatest)
+	// The Kaggle dataset page has no property cards to scrape, so housing only runs when listed in the config
+	RegisterScraper(ScraperInfo{Name: "housing", Kind: "table", Description: "US real estate listings",
+		SourceURL: housingURL, Output: "property_data.json"}, PropertyData{}, func() error { ScrapeHousingData(); return nil })
+
+	for name, domainConfig := range domainConfigurations {
+		name, domainConfig := name, domainConfig
+		var source string
+		if urls := scrapeTestURLs[name]; len(urls) > 0 {
+			source = urls[0]
+		}
+		RegisterScraper(ScraperInfo{
+			Name:        name,
+			Kind:        "listing",
+			Description: fmt.Sprintf("Items matching %q, following the next page links", domainConfig.ItemSelector),
+			SourceURL:   source,
+			Schedule:    "@daily",
+			Output:      name + "_data.json",
+			Enabled:     !strings.Contains(source, "example.com"), // Placeholder sources have nothing to scrape
+		}, GenericData{}, func() error { return runListingScraper(name) })
+	}
+}
+
+// runListingScraper scrapes the start pages of a domain configuration.
+func runListingScraper(domain string) error {
+	if _, ok := domainConfigurations[domain]; !ok {
+		return fmt.Errorf("invalid domain name provided: %s", domain)
+	}
+	TestScrape(domain)
+	return nil
+}
+
+// Scrapers returns every scraper of the registry, with the JSON, GraphQL and table targets of the config,
+// sorted by name and with their enabled flags as the config sets them.
+func Scrapers() []ScraperInfo {
+	config := CurrentConfig()
+	scraperRegistryMu.RLock()
+	scrapers := make([]ScraperInfo, 0, len(scraperRegistry))
+	for _, info := range scraperRegistry {
+		scrapers = append(scrapers, info)
+	}
+	scraperRegistryMu.RUnlock()
+	for _, target := range config.JSONTargets {
+		scrapers = append(scrapers, ScraperInfo{Name: target.Name, Kind: "json", Description: "JSON API target",
+			SourceURL: target.URL, Output: target.Name + "_data.json", Schema: targetSchema(target.Fields), Enabled: true})
+	}
+	for _, target := range config.GraphQLTargets {
+		scrapers = append(scrapers, ScraperInfo{Name: target.Name, Kind: "graphql", Description: "GraphQL API target",
+			SourceURL: target.URL, Output: target.Name + "_data.json", Schema: targetSchema(target.Fields), Enabled: true})
+	}
+	for _, target := range config.TableTargets {
+		scrapers = append(scrapers, ScraperInfo{Name: target.Name, Kind: "tables", Description: "Named tables of a page",
+			SourceURL: target.URL, Output: strings.Join(target.outputFiles(), ","), Enabled: true})
+	}
+	for i := range scrapers {
+		scrapers[i].Enabled = config.scraperEnabled(scrapers[i].Name, scrapers[i].Enabled)
+	}
+	sort.Slice(scrapers, func(i, j int) bool { return scrapers[i].Name < scrapers[j].Name })
+	return scrapers
+}
+
+// LookupScraper returns the scraper of the registry or config named name.
+func LookupScraper(name string) (ScraperInfo, bool) {
+	for _, info := range Scrapers() {
+		if strings.EqualFold(info.Name, name) {
+			return info, true
+		}
+	}
+	return ScraperInfo{}, false
+}
+
+// RunScraper runs the named scraper of the registry, or the JSON, GraphQL or table target of that name. A
+// disabled scraper is not run.
+func RunScraper(name string) error {
+	info, ok := LookupScraper(name)
+	if !ok {
+		return fmt.Errorf("no scraper named %q", name)
+	}
+	if !info.Enabled {
+		return fmt.Errorf("scraper %s is not enabled", info.Name)
+	}
+	if target, ok := findJSONTarget(info.Name); ok {
+		return RunJSONTarget(target)
+	}
+	if target, ok := findGraphQLTarget(info.Name); ok {
+		return RunGraphQLTarget(target)
+	}
+	if target, ok := findTableTarget(info.Name); ok {
+		return RunTableTarget(target)
+	}
+	scraperRegistryMu.RLock()
+	run := scraperRegistry[info.Name].run
+	scraperRegistryMu.RUnlock()
+	return run()
+}
+
+// scraperEnabled applies the config's scrapers list to a scraper enabled by default or not: a scraper it
+// lists runs, and when it lists any, the others do not.
+func (c Config) scraperEnabled(name string, byDefault bool) bool {
+	if len(c.Scrapers) == 0 {
+		return byDefault
+	}
+	return c.ScraperEnabled(name)
+}
+
+// targetSchema lists the fields of a JSON or GraphQL target, whose types are only known once scraped.
+func targetSchema(fields []JSONField) []SchemaField {
+	schema := make([]SchemaField, 0, len(fields))
+	for _, field := range fields {
+		schema = append(schema, SchemaField{Name: field.Name, Type: "any"})
+	}
+	return schema
+}
+
+// RecordSchema lists the JSON fields of a record type with their JSON types.
+func RecordSchema(record interface{}) []SchemaField {
+	t := reflect.TypeOf(record)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	var schema []SchemaField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema = append(schema, SchemaField{Name: name, Type: jsonType(field.Type)})
+	}
+	return schema
+}
+
+// jsonType returns the JSON type values of t are encoded as.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8,
+		reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Pointer:
+		return jsonType(t.Elem())
+	}
+	return "object"
+}
@@ -0,0 +1,153 @@
+package crab
+
+import (
+	"context"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// reloadDebounce is how long WatchConfig waits for writes to the config file to settle before reading it.
+const reloadDebounce = 200 * time.Millisecond
+
+// ScraperEnabled reports whether scrape jobs may run the named scraper: any scraper when Scrapers is
+// empty, else only the listed ones.
+func (c Config) ScraperEnabled(name string) bool {
+	if len(c.Scrapers) == 0 {
+		return true
+	}
+	for _, scraper := range c.Scrapers {
+		if strings.EqualFold(scraper, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyReload copies the settings that are safe to change while crawls run from next into c and
+// describes each change.
+func applyReload(c *Config, next Config) []string {
+	var changes []string
+	if !reflect.DeepEqual(c.Seeds, next.Seeds) {
+		changes = append(changes, fmt.Sprintf("seeds: %d -> %d URLs", len(c.Seeds), len(next.Seeds)))
+		c.Seeds = next.Seeds
+	}
+	if c.RateLimit != next.RateLimit {
+		changes = append(changes, fmt.Sprintf("rate limit: %+v -> %+v", c.RateLimit, next.RateLimit))
+		c.RateLimit = next.RateLimit
+	}
+	if !reflect.DeepEqual(c.Scrapers, next.Scrapers) {
+		changes = append(changes, fmt.Sprintf("enabled scrapers: %v -> %v", c.Scrapers, next.Scrapers))
+		c.Scrapers = next.Scrapers
+	}
+	return changes
+}
+
+// ReloadConfig applies the seeds, rate limit and enabled scrapers of next to the running configuration,
+// logging each change, and returns the changes. Running crawls pick up the rate limit with their next
+// request and scrape jobs check the enabled scrapers when they start. Other settings need a restart.
+func ReloadConfig(next Config) []string {
+	current := CurrentConfig()
+	changes := applyReload(&current, next)
+	SetConfig(current)
+	for _, change := range changes {
+		log.Printf("Config reload applied %s", change)
+	}
+	return changes
+}
+
+// ReloadConfigJSON reloads the running configuration from data, a whole configuration in JSON, the way
+// WatchConfig reloads its file: the secrets are resolved, the settings ReloadConfig applies take effect,
+// and the top-level settings that changed otherwise, which need a restart, are returned as ignored.
+func ReloadConfigJSON(data []byte) (changes, ignored []string, err error) {
+	next, err := ParseConfig(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ignored = ignoredChanges(CurrentConfig(), next); len(ignored) > 0 {
+		log.Printf("Config reload ignored changes to %s; restart to apply them", strings.Join(ignored, ", "))
+	}
+	return ReloadConfig(next), ignored, nil
+}
+
+// ignoredChanges names the top-level settings that differ between old and next other than the ones
+// ReloadConfig applies.
+func ignoredChanges(old, next Config) []string {
+	applyReload(&old, next)
+	var fields []string
+	vo, vn := reflect.ValueOf(old), reflect.ValueOf(next)
+	for i := 0; i < vo.NumField(); i++ {
+		if !vo.Type().Field(i).IsExported() {
+			continue
+		}
+		if !reflect.DeepEqual(vo.Field(i).Interface(), vn.Field(i).Interface()) {
+			fields = append(fields, vo.Type().Field(i).Tag.Get("json"))
+		}
+	}
+	return fields
+}
+
+// WatchConfig reloads filename with ReloadConfig whenever it changes, until ctx is cancelled. onChange,
+// when not nil, is called with the configurations before and after each reload, e.g. to queue crawls of
+// new seeds. A file that cannot be read or parsed is logged and the running configuration kept.
+func WatchConfig(ctx context.Context, filename string, onChange func(old, new Config)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	// Watch the directory: editors and WriteFileAtomic replace the file rather than write to it
+	if err := watcher.Add(filepath.Dir(filename)); err != nil {
+		watcher.Close()
+		return err
+	}
+	last, err := LoadConfig(filename)
+	if err != nil {
+		watcher.Close()
+		return err
+	}
+	log.Printf("Watching %s for configuration changes", filename)
+
+	go func() {
+		defer watcher.Close()
+		name := filepath.Clean(filename)
+		var settle <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == name && event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+					settle = time.After(reloadDebounce)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Error watching %s: %v", filename, err)
+			case <-settle:
+				settle = nil
+				next, err := LoadConfig(filename)
+				if err != nil {
+					log.Printf("Config reload of %s failed, keeping the running configuration: %v", filename, err)
+					continue
+				}
+				if fields := ignoredChanges(last, next); len(fields) > 0 {
+					log.Printf("Config reload ignored changes to %s; restart to apply them", strings.Join(fields, ", "))
+				}
+				last = next
+				old := CurrentConfig()
+				if changes := ReloadConfig(next); len(changes) > 0 && onChange != nil {
+					onChange(old, CurrentConfig())
+				}
+			}
+		}
+	}()
+	return nil
+}
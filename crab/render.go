@@ -0,0 +1,138 @@
+package crab
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// RenderConfig renders pages in a headless browser before they are parsed, so listings that load their
+// items with JavaScript as they are scrolled, such as Kaggle's search results, are captured whole.
+//
+// crab has no headless browser of its own, so pages are rendered by Command, which is given the page URL
+// as its last argument and must print the HTML of the rendered page. Scrolling is up to the command: it
+// finds MaxScrolls, and ScrollIdle in milliseconds, in the CRAB_RENDER_MAX_SCROLLS and
+// CRAB_RENDER_SCROLL_IDLE_MS environment variables, and the user agent to ask as in
+// CRAB_RENDER_USER_AGENT, and scrolls to the bottom until the page has not grown for ScrollIdle or it has
+// scrolled MaxScrolls times. crab/render_scroll.js does so with Node.js and Puppeteer (npm install
+// puppeteer):
+//
+//	"render": {"enabled": true, "command": ["node", "crab/render_scroll.js"], "domains": ["www.kaggle.com"]}
+//
+// Pages are still fetched over HTTP first, under the rate limit, robots.txt and the rest of the settings,
+// and only rendered once they were fetched as HTML. The rendering is paced and guarded like the fetch. A
+// page whose rendering fails keeps the fetched HTML.
+type RenderConfig struct {
+	Enabled    bool     `json:"enabled"`
+	Command    []string `json:"command"`
+	Timeout    string   `json:"timeout"`     // Of one page's rendering; defaultRenderTimeout when empty
+	MaxScrolls int      `json:"max_scrolls"` // Scrolls to the bottom at most; defaultMaxScrolls when zero
+	ScrollIdle string   `json:"scroll_idle"` // How long the page must not grow to be fully loaded; defaultScrollIdle when empty
+	Domains    []string `json:"domains"`     // Hosts whose pages are rendered; all when empty
+}
+
+const (
+	defaultRenderTimeout = time.Minute
+	defaultMaxScrolls    = 10
+	defaultScrollIdle    = 2 * time.Second
+	renderWaitDelay      = time.Second
+)
+
+// renders reports whether the pages of rawURL are rendered under the config.
+func (c RenderConfig) renders(rawURL string) bool {
+	if !c.Enabled {
+		return false
+	}
+	if len(c.Domains) == 0 {
+		return true
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	for _, domain := range c.Domains {
+		if strings.EqualFold(domain, u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// RenderPage runs the render command of config on pageURL and returns the HTML it prints. The browser asks
+// for the page with the user agent of the configured fingerprint.
+func RenderPage(ctx context.Context, config RenderConfig, pageURL string) ([]byte, error) {
+	return renderPage(ctx, config, requestUserAgent(CurrentConfig().Fingerprint), pageURL)
+}
+
+// renderPage is RenderPage with the browser asking for the page as userAgent.
+func renderPage(ctx context.Context, config RenderConfig, userAgent, pageURL string) ([]byte, error) {
+	if len(config.Command) == 0 {
+		return nil, fmt.Errorf("rendering %s: no render command configured", pageURL)
+	}
+	timeout := defaultRenderTimeout
+	if d, err := time.ParseDuration(config.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	idle := defaultScrollIdle
+	if d, err := time.ParseDuration(config.ScrollIdle); err == nil && d > 0 {
+		idle = d
+	}
+	scrolls := config.MaxScrolls
+	if scrolls <= 0 {
+		scrolls = defaultMaxScrolls
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	command := config.Command
+	cmd := exec.CommandContext(ctx, command[0], append(command[1:len(command):len(command)], pageURL)...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("CRAB_RENDER_MAX_SCROLLS=%d", scrolls),
+		fmt.Sprintf("CRAB_RENDER_SCROLL_IDLE_MS=%d", idle.Milliseconds()), "CRAB_RENDER_USER_AGENT="+userAgent)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	// Once the command is killed, stop waiting on the output of any browser it left behind
+	cmd.WaitDelay = renderWaitDelay
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("rendering %s: %s: %v %s", pageURL, command[0], err, strings.TrimSpace(stderr.String()))
+	}
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil, fmt.Errorf("rendering %s: %s printed no HTML", pageURL, command[0])
+	}
+	return stdout.Bytes(), nil
+}
+
+// renderedBody returns the rendered HTML of rawURL when the render settings of config render its pages, and
+// false when they do not or the rendering failed, in which case the fetched HTML is used. The browser
+// fetches the page again, so it is held to what the fetch was: the URL guard of config vets the page, the
+// site's rate limit, throttle and circuit breaker pace it, the browser asks as config's user agent, and
+// the rendering stops with ctx.
+func renderedBody(ctx context.Context, config Config, rawURL string) ([]byte, bool) {
+	if !config.Render.renders(rawURL) {
+		return nil, false
+	}
+	if config.URLGuard.Enabled {
+		if err := config.URLGuard.CheckURL(ctx, rawURL); err != nil {
+			warnf("Not rendering %s, using the fetched page: %v", rawURL, err)
+			return nil, false
+		}
+	}
+	target, err := url.Parse(rawURL)
+	if err == nil {
+		err = waitForSlot(ctx, config, target.Host)
+	}
+	if err != nil {
+		warnf("Not rendering %s, using the fetched page: %v", rawURL, err)
+		return nil, false
+	}
+	body, err := renderPage(ctx, config.Render, requestUserAgent(config.Fingerprint), rawURL)
+	if err != nil {
+		warnf("Error rendering %s, using the fetched page: %v", rawURL, err)
+		return nil, false
+	}
+	return body, true
+}
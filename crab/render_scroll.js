@@ -0,0 +1,42 @@
+// render_scroll.js renders a page in headless Chrome for crab's "render" setting and prints its HTML. It
+// scrolls to the bottom until the page stops growing, so listings that load more items as they are
+// scrolled are captured whole. It needs Node.js and Puppeteer (npm install puppeteer).
+//
+// Usage: node render_scroll.js URL, with CRAB_RENDER_MAX_SCROLLS, CRAB_RENDER_SCROLL_IDLE_MS and
+// CRAB_RENDER_USER_AGENT set by crab.
+const puppeteer = require('puppeteer');
+
+const url = process.argv[process.argv.length - 1];
+const maxScrolls = parseInt(process.env.CRAB_RENDER_MAX_SCROLLS || '10', 10);
+const idleMs = parseInt(process.env.CRAB_RENDER_SCROLL_IDLE_MS || '2000', 10);
+const userAgent = process.env.CRAB_RENDER_USER_AGENT;
+
+(async () => {
+  const browser = await puppeteer.launch({headless: 'new'});
+  try {
+    const page = await browser.newPage();
+    // Ask as crab's configured identity rather than as headless Chrome
+    if (userAgent) {
+      await page.setUserAgent(userAgent);
+    }
+    await page.goto(url, {waitUntil: 'networkidle2'});
+    let height = await page.evaluate(() => document.body.scrollHeight);
+    for (let i = 0; i < maxScrolls; i++) {
+      await page.evaluate(() => window.scrollTo(0, document.body.scrollHeight));
+      // The page is fully loaded once scrolling to the bottom no longer makes it grow within idleMs
+      const grown = await page
+        .waitForFunction(h => document.body.scrollHeight > h, {timeout: idleMs}, height)
+        .then(() => true, () => false);
+      if (!grown) {
+        break;
+      }
+      height = await page.evaluate(() => document.body.scrollHeight);
+    }
+    process.stdout.write(await page.content());
+  } finally {
+    await browser.close();
+  }
+})().catch(err => {
+  console.error(err.message);
+  process.exit(1);
+});
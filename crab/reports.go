@@ -0,0 +1,273 @@
+package crab
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Report formats of a ReportTemplate.
+const (
+	ReportMarkdown = "markdown" // Rendered with text/template into <name>.md
+	ReportHTML     = "html"     // Rendered with html/template, which escapes the values, into <name>.html
+)
+
+// ReportTemplate is a report of the users' own format rendered from a Go template at the end of each run
+// into the run's directory, from a RunReport: the run's summary, the statistics of the datasets it wrote
+// and their diffs with the previous run. The template is read from File, or given inline as Template.
+type ReportTemplate struct {
+	Name     string   `json:"name"`     // Names the report file, report-<name>.md or .html
+	File     string   `json:"file"`     // The template file
+	Template string   `json:"template"` // The template itself, when there is no file
+	Format   string   `json:"format"`   // "markdown" or "html"; from the extension of File when empty, else markdown
+	Kinds    []string `json:"kinds"`    // The kinds of runs to report on, e.g. ["scrape"]; every run when empty
+}
+
+// RunReport is what report templates render.
+type RunReport struct {
+	RunID      string
+	Kind       string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Duration   time.Duration
+	Summary    *RunSummary    // The summary of crawls and scrapes that report one; nil for dataset writes
+	Outputs    []string       // The files of the run, relative to its directory
+	Datasets   []DatasetStats // Summary statistics of the datasets written
+	Diffs      []DatasetDiff  // Changes of the scraped datasets written since the previous run
+}
+
+// DatasetDiff is how a scraped dataset changed between the run and the previous run that wrote it.
+type DatasetDiff struct {
+	Dataset     string
+	PreviousRun string // Empty for the first run of the dataset, whose rows are all added
+	Added       int
+	Removed     int
+	Rows        Dataset    // The rows added and removed, as DiffDatasets returns them
+	Revisions   []Revision // The rows whose values changed
+}
+
+// reportFuncs are the functions report templates may call besides the built-in ones.
+var reportFuncs = map[string]interface{}{
+	"number": formatStat,
+	"join":   strings.Join,
+	"limit": func(n int, rows [][]string) [][]string {
+		if n >= 0 && len(rows) > n {
+			return rows[:n]
+		}
+		return rows
+	},
+	"date": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04:05Z") },
+}
+
+// format returns the report format of the template.
+func (t ReportTemplate) format() string {
+	switch {
+	case t.Format != "":
+		return strings.ToLower(t.Format)
+	case strings.HasSuffix(strings.ToLower(t.File), ".html") || strings.HasSuffix(strings.ToLower(t.File), ".htm"):
+		return ReportHTML
+	}
+	return ReportMarkdown
+}
+
+// filename returns the name of the report file in a run's directory.
+func (t ReportTemplate) filename() string {
+	name := t.Name
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(t.File), filepath.Ext(t.File))
+	}
+	if name == "" || name == "." {
+		name = "report"
+	}
+	if t.format() == ReportHTML {
+		return "report-" + name + ".html"
+	}
+	return "report-" + name + ".md"
+}
+
+// wants reports whether the template reports on runs of kind.
+func (t ReportTemplate) wants(kind string) bool {
+	if len(t.Kinds) == 0 {
+		return true
+	}
+	for _, k := range t.Kinds {
+		if strings.EqualFold(k, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// Render executes the template on report into w.
+func (t ReportTemplate) Render(w io.Writer, report RunReport) error {
+	text := t.Template
+	if t.File != "" {
+		data, err := os.ReadFile(t.File)
+		if err != nil {
+			return err
+		}
+		text = string(data)
+	}
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("report %s has no template", t.filename())
+	}
+	switch t.format() {
+	case ReportMarkdown:
+		tmpl, err := template.New(t.filename()).Funcs(reportFuncs).Parse(text)
+		if err != nil {
+			return err
+		}
+		return tmpl.Execute(w, report)
+	case ReportHTML:
+		tmpl, err := htmltemplate.New(t.filename()).Funcs(reportFuncs).Parse(text)
+		if err != nil {
+			return err
+		}
+		return tmpl.Execute(w, report)
+	}
+	return fmt.Errorf("unknown report format %q", t.Format)
+}
+
+// BuildRunReport gathers the report of run runID in dir from its files: its manifest once it finished,
+// the statistics files among outputs (every file of the run when nil) and the scraped datasets among
+// them, diffed with the previous run that wrote each. summary may be nil.
+func BuildRunReport(dir, runID string, outputs []string, summary *RunSummary) (RunReport, error) {
+	started, err := RunStartTime(runID)
+	if err != nil {
+		return RunReport{}, err
+	}
+	runDir := filepath.Join(dir, runID)
+	report := RunReport{RunID: runID, StartedAt: started, FinishedAt: time.Now(), Summary: summary}
+	var manifest RunManifest
+	if err := readJSONFile(filepath.Join(runDir, "manifest.json"), &manifest); err == nil {
+		report.Kind, report.StartedAt, report.FinishedAt = manifest.Kind, manifest.StartedAt, manifest.FinishedAt
+	}
+	if summary != nil {
+		report.Kind = summary.Kind
+	}
+	report.Duration = report.FinishedAt.Sub(report.StartedAt).Round(time.Millisecond)
+
+	if outputs == nil {
+		entries, err := os.ReadDir(runDir)
+		if err != nil {
+			return RunReport{}, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				outputs = append(outputs, entry.Name())
+			}
+		}
+	}
+	for _, output := range outputs {
+		if rel, err := filepath.Rel(runDir, output); err == nil && !strings.HasPrefix(rel, "..") {
+			output = rel
+		}
+		report.Outputs = append(report.Outputs, output)
+		if strings.HasSuffix(output, statsSuffix) {
+			var stats DatasetStats
+			if err := readJSONFile(filepath.Join(runDir, output), &stats); err == nil {
+				report.Datasets = append(report.Datasets, stats)
+			}
+		}
+	}
+	if len(report.Datasets) == 0 && summary != nil {
+		report.Datasets = summary.Datasets
+	}
+
+	written := map[string]bool{}
+	for _, output := range report.Outputs {
+		written[strings.TrimSuffix(output, ".gz")] = true
+	}
+	runs, err := ListRuns(dir)
+	if err != nil {
+		return report, err
+	}
+	var previousRun string
+	for _, id := range runs {
+		if id < runID {
+			previousRun = id
+		}
+	}
+	for _, source := range scrapedDatasetFiles {
+		if !written[source.DataFile] && !written[strings.TrimSuffix(source.DataFile, ".json")+".ndjson"] {
+			continue
+		}
+		current, err := LoadDatasetAsOf(dir, source.Name, runID)
+		if err != nil || current.RunID != runID {
+			continue
+		}
+		diff := DatasetDiff{Dataset: source.Name, Revisions: []Revision{}}
+		previous := Dataset{Name: source.Name, Columns: current.Columns}
+		if previousRun != "" {
+			if ds, err := LoadDatasetAsOf(dir, source.Name, previousRun); err == nil {
+				previous, diff.PreviousRun = ds, ds.RunID
+			}
+		}
+		diff.Rows = DiffDatasets(previous, current)
+		for _, row := range diff.Rows.Rows {
+			if row[0] == "added" {
+				diff.Added++
+			} else {
+				diff.Removed++
+			}
+		}
+		if revisions, err := LoadRevisions(dir, source.Name, runID); err == nil {
+			diff.Revisions = revisions.Revisions
+		}
+		report.Diffs = append(report.Diffs, diff)
+	}
+	return report, nil
+}
+
+// renderReports renders the configured report templates of a run about to finish with outputs into its
+// directory. A report that cannot be rendered is logged and left out rather than failing the run. It
+// returns the files written.
+func (r *Run) renderReports(outputs []string) []string {
+	var templates []ReportTemplate
+	for _, t := range CurrentConfig().Reports {
+		if t.wants(r.Kind) {
+			templates = append(templates, t)
+		}
+	}
+	if len(templates) == 0 {
+		return nil
+	}
+	report, err := BuildRunReport(filepath.Dir(r.Dir), r.ID, outputs, r.summary)
+	if err != nil {
+		log.Printf("Error gathering the report of run %s: %v", r.ID, err)
+		return nil
+	}
+	report.Kind, report.StartedAt, report.FinishedAt = r.Kind, r.StartedAt, time.Now()
+	report.Duration = report.FinishedAt.Sub(report.StartedAt).Round(time.Millisecond)
+	var files []string
+	for _, t := range templates {
+		var b bytes.Buffer
+		if err := t.Render(&b, report); err != nil {
+			log.Printf("Error rendering report %s of run %s: %v", t.filename(), r.ID, err)
+			continue
+		}
+		filename := r.Path(t.filename())
+		if err := WriteFileAtomic(filename, b.Bytes()); err != nil {
+			log.Printf("Error writing report %s: %v", filename, err)
+			continue
+		}
+		files = append(files, filename)
+	}
+	return files
+}
+
+// finishReported finishes a run that reports summary, which its report templates render. The reports
+// written are added to the summary's outputs.
+func (r *Run) finishReported(summary *RunSummary) error {
+	if r != nil {
+		r.summary = summary
+	}
+	return r.Finish(summary.Outputs)
+}
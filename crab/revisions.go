@@ -0,0 +1,223 @@
+package crab
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// revisionsSuffix replaces the extension of a dataset file to name the file of the revisions its run
+// found.
+const revisionsSuffix = ".revisions.json"
+
+// RowHash returns the provenance hash of a dataset row: the SHA-256 of its cells by column, so a row
+// scraped again with the same values hashes the same and any revision of a value changes it.
+func RowHash(columns, row []string) string {
+	h := sha256.New()
+	for i, column := range columns {
+		fmt.Fprintf(h, "%s\x1f%s\x1e", column, strings.TrimSpace(row[i]))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Revision is a row of a dataset whose values changed upstream between two runs, e.g. a year of
+// inflation rates the source revised after it was first published.
+type Revision struct {
+	Key          map[string]string `json:"key"`
+	PreviousRun  string            `json:"previous_run"`
+	RunID        string            `json:"run_id,omitempty"`
+	PreviousHash string            `json:"previous_hash"`
+	Hash         string            `json:"hash"`
+	Changes      []ColumnChange    `json:"changes"`
+	Previous     map[string]string `json:"previous"` // The row's cells by column before the revision
+	Current      map[string]string `json:"current"`  // And after
+}
+
+// RevisionReport lists the revisions a run found in a dataset.
+type RevisionReport struct {
+	Dataset     string     `json:"dataset"`
+	RunID       string     `json:"run_id,omitempty"`
+	PreviousRun string     `json:"previous_run,omitempty"`
+	Revisions   []Revision `json:"revisions"`
+}
+
+// revisionKey returns the columns identifying the rows of dataset across runs: the key of its merge
+// rule, or else its first column, e.g. the year.
+func revisionKey(dataset string, columns []string) []string {
+	if rule, ok := CurrentConfig().Merge[dataset]; ok && len(rule.Key) > 0 {
+		return rule.Key
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	return columns[:1]
+}
+
+// DetectRevisions matches the rows of current with those of previous by the key columns and returns the
+// rows whose hash changed, in the order of current. Rows only in one of the datasets are not revisions;
+// of rows repeating a key, the first is compared.
+func DetectRevisions(previous, current Dataset, key []string) ([]Revision, error) {
+	if len(key) == 0 {
+		return nil, fmt.Errorf("no key columns to match the rows of %s", current.Name)
+	}
+	keyColumns := func(ds Dataset) ([]int, error) {
+		indexes := make([]int, len(key))
+		for i, column := range key {
+			indexes[i] = -1
+			for j, c := range ds.Columns {
+				if strings.EqualFold(c, column) {
+					indexes[i] = j
+				}
+			}
+			if indexes[i] < 0 {
+				return nil, fmt.Errorf("key column %q is not in %s", column, ds.Name)
+			}
+		}
+		return indexes, nil
+	}
+	previousKey, err := keyColumns(previous)
+	if err != nil {
+		return nil, err
+	}
+	currentKey, err := keyColumns(current)
+	if err != nil {
+		return nil, err
+	}
+	rowKey := func(indexes []int, row []string) string {
+		parts := make([]string, len(indexes))
+		for i, j := range indexes {
+			parts[i] = strings.TrimSpace(row[j])
+		}
+		return strings.Join(parts, "\x1f")
+	}
+	values := func(columns, row []string) map[string]string {
+		cells := make(map[string]string, len(columns))
+		for i, column := range columns {
+			cells[column] = row[i]
+		}
+		return cells
+	}
+
+	earlier := map[string][]string{}
+	for _, row := range previous.Rows {
+		if k := rowKey(previousKey, row); earlier[k] == nil {
+			earlier[k] = row
+		}
+	}
+	revisions := []Revision{}
+	compared := map[string]bool{}
+	for _, row := range current.Rows {
+		k := rowKey(currentKey, row)
+		old := earlier[k]
+		if old == nil || compared[k] {
+			continue
+		}
+		compared[k] = true
+		previousHash, hash := RowHash(previous.Columns, old), RowHash(current.Columns, row)
+		if previousHash == hash {
+			continue
+		}
+		revision := Revision{Key: map[string]string{}, PreviousRun: previous.RunID, PreviousHash: previousHash, Hash: hash,
+			Previous: values(previous.Columns, old), Current: values(current.Columns, row)}
+		for i, j := range currentKey {
+			revision.Key[key[i]] = strings.TrimSpace(row[j])
+		}
+		for _, column := range current.Columns {
+			if before, after := revision.Previous[column], revision.Current[column]; strings.TrimSpace(before) != strings.TrimSpace(after) {
+				revision.Changes = append(revision.Changes, ColumnChange{Column: column, Previous: before, Current: after})
+			}
+		}
+		for _, column := range previous.Columns {
+			if _, ok := revision.Current[column]; !ok {
+				revision.Changes = append(revision.Changes, ColumnChange{Column: column, Previous: revision.Previous[column]})
+			}
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+// revisionsFilename returns the revisions file of a dataset file, e.g. inflation_data.revisions.json for
+// inflation_data.json.
+func revisionsFilename(dataFile string) string {
+	return strings.TrimSuffix(lineageFilename(dataFile), lineageSuffix) + revisionsSuffix
+}
+
+// recordRevisions compares the records about to be written to a run with the dataset of the previous
+// run, so values revised upstream are not overwritten silently: each row whose values changed is logged
+// and listed in a revisions file next to the run's data file, whose name is returned. The first run of a
+// dataset has nothing to compare with.
+func recordRevisions(dataset, name string, records interface{}, run *Run) (string, error) {
+	if run == nil {
+		return "", nil
+	}
+	previous, err := LoadDatasetAsOf(filepath.Dir(run.Dir), dataset, "")
+	if err != nil {
+		return "", nil
+	}
+	current, err := NewDataset(dataset, records)
+	if err != nil {
+		return "", err
+	}
+	revisions, err := DetectRevisions(previous, current, revisionKey(dataset, current.Columns))
+	if err != nil || len(revisions) == 0 {
+		return "", err
+	}
+	for i, revision := range revisions {
+		revisions[i].RunID = run.ID
+		log.Printf("Revision of %s %v since run %s: %v", dataset, revision.Key, revision.PreviousRun, revision.Changes)
+	}
+	filename := revisionsFilename(run.Path(OutputFilename(name)))
+	data, err := json.MarshalIndent(RevisionReport{Dataset: dataset, RunID: run.ID, PreviousRun: previous.RunID, Revisions: revisions}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return filename, WriteFileAtomic(filename, data)
+}
+
+// LoadRevisions returns the revisions found in the named dataset by run runID (the latest run that
+// produced the dataset when empty), resolved like LoadDatasetAsOf. A run that found none returns an empty
+// report.
+func LoadRevisions(dir, name, runID string) (RevisionReport, error) {
+	runID, dataFile, err := findDatasetRun(dir, name, runID)
+	if err != nil {
+		return RevisionReport{}, err
+	}
+	report := RevisionReport{Dataset: name, RunID: runID, Revisions: []Revision{}}
+	if filename := revisionsFilename(dataFile); outputFileExists(filename) {
+		if err := readJSONFile(filename, &report); err != nil {
+			return RevisionReport{}, err
+		}
+	}
+	return report, nil
+}
+
+// RevisionHistory returns every revision of the named dataset found by the runs in dir, oldest first:
+// the history of the values the source revised.
+func RevisionHistory(dir, name string) ([]Revision, error) {
+	_, dataFile, err := findDatasetRun(dir, name, "")
+	if err != nil {
+		return nil, err
+	}
+	runs, err := ListRuns(dir)
+	if err != nil {
+		return nil, err
+	}
+	history := []Revision{}
+	for _, runID := range runs {
+		filename := revisionsFilename(filepath.Join(dir, runID, filepath.Base(dataFile)))
+		if !outputFileExists(filename) {
+			continue
+		}
+		var report RevisionReport
+		if err := readJSONFile(filename, &report); err != nil {
+			return nil, err
+		}
+		history = append(history, report.Revisions...)
+	}
+	return history, nil
+}
@@ -0,0 +1,320 @@
+package crab
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/temoto/robotstxt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRobotsRedirects is how many redirects are followed to a robots.txt file; RFC 9309 asks for at least
+// five. A robots.txt behind more is treated as unavailable.
+const maxRobotsRedirects = 5
+
+// robotsClient fetches robots.txt files, following redirects only to other http and https URLs.
+var robotsClient = &http.Client{
+	Timeout:   30 * time.Second,
+	Transport: guardedTransport,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) > maxRobotsRedirects || (req.URL.Scheme != "http" && req.URL.Scheme != "https") {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	},
+}
+
+// RobotsCheck explains what a site's robots.txt says about one URL.
+type RobotsCheck struct {
+	URL        string        `json:"url"`
+	RobotsURL  string        `json:"robots_url"`
+	FetchedURL string        `json:"fetched_url,omitempty"` // Where the robots.txt was served from, when redirected
+	Status     int           `json:"status"`                // Status of the robots.txt response
+	Agent      string        `json:"agent"`                 // The agent that was checked
+	Group      string        `json:"group"`                 // User-agent of the group that applied, "" when none did
+	Allowed    bool          `json:"allowed"`
+	Rule       string        `json:"rule"` // The deciding line, e.g. "Disallow: /private"; "" when no rule matched
+	CrawlDelay time.Duration `json:"crawl_delay"`
+	Sitemaps   []string      `json:"sitemaps"`
+	Reason     string        `json:"reason"`
+}
+
+// CheckRobots fetches the robots.txt of rawURL's site and reports whether agent may fetch rawURL, the
+// rule that decided it and the crawl delay that applies. agent is the configured RobotsAgent when empty.
+// The verdict is robotstxt's, so it is the one the crawler acts on.
+//
+// robots.txt is read from the scheme, host and port of rawURL, over https when rawURL has no scheme, as
+// RFC 9309 scopes it to them. A robots.txt that is missing allows everything, and one that needs
+// authentication (401 or 403) or fails with a server error disallows everything.
+func CheckRobots(rawURL, agent string) (RobotsCheck, error) {
+	return checkRobots(CurrentConfig(), nil, rawURL, agent)
+}
+
+// checkRobots is CheckRobots under config, reading robots.txt through cache, which fetches each site's
+// once. A nil cache fetches it for every check.
+func checkRobots(config Config, cache *robotsCache, rawURL, agent string) (RobotsCheck, error) {
+	if agent == "" {
+		agent = config.Fingerprint.RobotsAgent()
+	}
+	check := RobotsCheck{URL: rawURL, Agent: agent}
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return check, err
+	}
+	if target.Host == "" {
+		return check, fmt.Errorf("invalid URL, no host found: %s", rawURL)
+	}
+	scheme := strings.ToLower(target.Scheme)
+	switch scheme {
+	case "":
+		scheme = "https"
+	case "http", "https":
+	default:
+		return check, fmt.Errorf("unsupported URL scheme %q: %s", target.Scheme, rawURL)
+	}
+	check.RobotsURL = (&url.URL{Scheme: scheme, Host: target.Host, Path: "/robots.txt"}).String()
+
+	file := cache.get(check.RobotsURL, func() robotsFile { return fetchRobots(config, check.RobotsURL) })
+	if file.err != nil {
+		return check, file.err
+	}
+	check.Status = file.status
+	if file.fetchedURL != check.RobotsURL {
+		check.FetchedURL = file.fetchedURL
+	}
+	explainRobots(&check, target.RequestURI(), file.body)
+	return check, nil
+}
+
+// robotsFile is a robots.txt response: its status, where it was served from and its body, or why it could
+// not be fetched.
+type robotsFile struct {
+	status     int
+	fetchedURL string
+	body       []byte
+	err        error
+}
+
+// fetchRobots requests the robots.txt at robotsURL under config. The request is paced like the pages of
+// its site, by the rate limit and DefaultThrottle, is refused while DefaultCircuitBreaker blocks the site,
+// goes past the URL guard of config, and asks as the configured identity, the agent its rules are matched
+// against.
+func fetchRobots(config Config, robotsURL string) robotsFile {
+	req, err := http.NewRequest(http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return robotsFile{err: err}
+	}
+	host := req.URL.Host
+	if err := waitForSlot(context.Background(), config, host); err != nil {
+		return robotsFile{err: err}
+	}
+	req.Header.Set("User-Agent", config.Fingerprint.IdentityUserAgent())
+	client := *robotsClient
+	client.Transport = guardTransport(config.URLGuard)
+	resp, err := client.Do(req)
+	if err != nil {
+		return robotsFile{err: err}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return robotsFile{err: err}
+	}
+	DefaultThrottle.Observe(host, resp.StatusCode, resp.Header)
+	if reason, blocked := DetectAntiBot(resp.StatusCode, resp.Header, body); blocked {
+		DefaultCircuitBreaker.RecordBlocked(host, robotsURL, reason)
+	} else if resp.StatusCode < 400 {
+		DefaultCircuitBreaker.RecordSuccess(host)
+	}
+	return robotsFile{status: resp.StatusCode, fetchedURL: resp.Request.URL.String(), body: body}
+}
+
+// robotsCache keeps the robots.txt files of one crawl by URL, so a site's robots.txt is fetched once
+// however many of its pages the crawl checks.
+type robotsCache struct {
+	mu    sync.Mutex
+	files map[string]*robotsEntry
+}
+
+// robotsEntry is a robots.txt of a robotsCache; ready is closed once file is fetched.
+type robotsEntry struct {
+	ready chan struct{}
+	file  robotsFile
+}
+
+// newRobotsCache creates an empty cache.
+func newRobotsCache() *robotsCache {
+	return &robotsCache{files: make(map[string]*robotsEntry)}
+}
+
+// get returns the robots.txt at robotsURL, calling fetch for it the first time. Checks made while it is
+// being fetched wait for it. A nil cache calls fetch every time.
+func (c *robotsCache) get(robotsURL string, fetch func() robotsFile) robotsFile {
+	if c == nil {
+		return fetch()
+	}
+	c.mu.Lock()
+	entry, cached := c.files[robotsURL]
+	if !cached {
+		entry = &robotsEntry{ready: make(chan struct{})}
+		c.files[robotsURL] = entry
+	}
+	c.mu.Unlock()
+	if !cached {
+		entry.file = fetch()
+		close(entry.ready)
+	}
+	<-entry.ready
+	return entry.file
+}
+
+// explainRobots fills in the verdict of a robots.txt body with the given response status for path.
+func explainRobots(check *RobotsCheck, path string, body []byte) {
+	robots, err := robotstxt.FromStatusAndBytes(check.Status, body)
+	switch {
+	case check.Status == http.StatusUnauthorized || check.Status == http.StatusForbidden:
+		check.Reason = fmt.Sprintf("robots.txt answered %d; everything is disallowed", check.Status)
+		return
+	case check.Status >= 300 && check.Status < 400:
+		check.Allowed = true
+		check.Reason = fmt.Sprintf("robots.txt redirects could not be followed (%d); everything is allowed", check.Status)
+		return
+	case err != nil:
+		check.Allowed = true
+		check.Reason = fmt.Sprintf("robots.txt could not be parsed (%v); everything is allowed", err)
+		return
+	case check.Status >= 400 && check.Status < 500:
+		check.Allowed = true
+		check.Reason = fmt.Sprintf("robots.txt answered %d; everything is allowed", check.Status)
+		return
+	case check.Status >= 500:
+		check.Reason = fmt.Sprintf("robots.txt answered %d; everything is disallowed", check.Status)
+		return
+	}
+
+	group := robots.FindGroup(check.Agent)
+	check.Allowed = group.Test(path)
+	check.CrawlDelay = group.CrawlDelay
+	check.Sitemaps = robots.Sitemaps
+	groups := parseRobotsGroups(body)
+	check.Group = findRobotsGroup(groups, check.Agent)
+	if rule := findRobotsRule(groups[check.Group], path); rule != "" {
+		check.Rule = rule
+		check.Reason = fmt.Sprintf("%q matches the rules for user-agent %q", rule, check.Group)
+	} else if check.Group != "" {
+		check.Reason = fmt.Sprintf("no rule for user-agent %q matches %s", check.Group, path)
+	} else {
+		check.Reason = "no group applies to " + check.Agent
+	}
+}
+
+// robotsRule is an Allow or Disallow line of robots.txt.
+type robotsRule struct {
+	line    string         // As written, e.g. "Disallow: /private"
+	path    string         // The path prefix, for rules without wildcards
+	pattern *regexp.Regexp // The path pattern, for rules with wildcards
+}
+
+// robotsDirectives spells the rule directives the way robots.txt files usually do.
+var robotsDirectives = map[string]string{"allow": "Allow", "disallow": "Disallow"}
+
+// parseRobotsGroups reads the rules of a robots.txt file by lower-cased user agent, the way robotstxt
+// reads them. robotstxt keeps its rules to itself, and CheckRobots needs them to tell which one applied.
+func parseRobotsGroups(body []byte) map[string][]robotsRule {
+	groups := map[string][]robotsRule{}
+	var agents []string
+	members := false // Whether the current group has lines other than User-agent
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		switch key {
+		case "user-agent":
+			if members {
+				agents, members = nil, false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			members = true
+			rule := robotsRule{line: robotsDirectives[key] + ": " + value, path: value}
+			if !strings.HasPrefix(rule.path, "*") && !strings.HasPrefix(rule.path, "/") {
+				rule.path = "/" + rule.path
+			}
+			rule.path = strings.TrimRight(rule.path, "*")
+			if strings.ContainsAny(rule.path, "*$") {
+				pattern := strings.NewReplacer(`\*`, `.*`, `\$`, `$`).Replace(regexp.QuoteMeta(rule.path))
+				re, err := regexp.Compile(pattern)
+				if err != nil {
+					continue
+				}
+				rule.pattern = re
+			}
+			for _, agent := range agents {
+				groups[agent] = append(groups[agent], rule)
+			}
+		case "crawl-delay":
+			members = true
+			for _, agent := range agents {
+				if _, ok := groups[agent]; !ok {
+					groups[agent] = nil // The group exists without rules
+				}
+			}
+		}
+	}
+	return groups
+}
+
+// findRobotsGroup returns the user agent of the group that applies to agent: the longest one agent starts
+// with, else "*", else "".
+func findRobotsGroup(groups map[string][]robotsRule, agent string) string {
+	agent = strings.ToLower(agent)
+	best := ""
+	if _, ok := groups["*"]; ok {
+		best = "*"
+	}
+	for name := range groups {
+		if name != "*" && strings.HasPrefix(agent, name) && (best == "*" || len(name) > len(best)) {
+			best = name
+		}
+	}
+	return best
+}
+
+// findRobotsRule returns the line of the rule that decides path: the longest matching path, with
+// wildcards matched as unanchored patterns, as in robotstxt. It returns "" when no rule matches.
+func findRobotsRule(rules []robotsRule, path string) string {
+	best, bestLen := "", 0
+	for _, rule := range rules {
+		length := 0
+		if rule.pattern != nil {
+			if rule.pattern.MatchString(path) {
+				length = len(rule.pattern.String())
+			}
+		} else if rule.path == "/" {
+			length = 1
+		} else if strings.HasPrefix(path, rule.path) {
+			length = len(rule.path)
+		}
+		if length > bestLen {
+			best, bestLen = rule.line, length
+		}
+	}
+	return best
+}
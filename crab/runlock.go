@@ -0,0 +1,174 @@
+package crab
+
+import (
+	"cmpscfa23team2/records"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// RunLockConfig keeps two runs of the same job from overlapping, as when a scheduler triggers a scrape
+// again while the previous one is still writing its outputs. With it enabled, a job that finds another
+// run of the same type and params under way is skipped. Runs are locked with files in Dir on one machine;
+// a MySQL backed locker takes over across machines (see SetRunLocker).
+type RunLockConfig struct {
+	Enabled    bool   `json:"enabled"`
+	Dir        string `json:"dir"`         // The output directory's locks directory when empty
+	StaleAfter string `json:"stale_after"` // A lock file not refreshed for this long is taken over; defaultLockStaleAfter when empty
+}
+
+// defaultLockStaleAfter is how long a lock file may go without being refreshed before its run is taken
+// for dead. Holders refresh it every third of that.
+const defaultLockStaleAfter = 2 * time.Minute
+
+// ErrRunLocked is returned by RunLocker.TryLock while another run holds the lock.
+var ErrRunLocked = records.ErrRunLocked
+
+// RunLocker gives runs exclusive locks by name. TryLock returns ErrRunLocked, wrapped or not, when the
+// lock is held, and otherwise the function that releases it.
+type RunLocker interface {
+	TryLock(name string) (release func() error, err error)
+}
+
+var (
+	runLockerMu sync.RWMutex
+	runLocker   RunLocker
+)
+
+// SetRunLocker replaces the locker of the runs of jobs when run locks are enabled. Passing nil goes back
+// to lock files.
+func SetRunLocker(locker RunLocker) {
+	runLockerMu.Lock()
+	defer runLockerMu.Unlock()
+	runLocker = locker
+}
+
+// currentRunLocker returns the locker of the runs of jobs, or nil when run locks are disabled.
+func currentRunLocker() RunLocker {
+	config := CurrentConfig()
+	if !config.RunLock.Enabled {
+		return nil
+	}
+	runLockerMu.RLock()
+	defer runLockerMu.RUnlock()
+	if runLocker != nil {
+		return runLocker
+	}
+	dir := config.RunLock.Dir
+	if dir == "" {
+		dir = filepath.Join(config.Output.Dir, "locks")
+	}
+	staleAfter := defaultLockStaleAfter
+	if config.RunLock.StaleAfter != "" {
+		if d, err := time.ParseDuration(config.RunLock.StaleAfter); err == nil && d > 0 {
+			staleAfter = d
+		} else {
+			log.Printf("Invalid run_lock stale_after %q, using %s", config.RunLock.StaleAfter, staleAfter)
+		}
+	}
+	return FileRunLocker{Dir: dir, StaleAfter: staleAfter}
+}
+
+// JobLockName returns the lock name of a job's runs, which is the same for every job of its type and
+// params.
+func JobLockName(job Job) string {
+	params, _ := json.Marshal(job.Params) // Map keys are sorted
+	sum := sha256.Sum256(params)
+	return job.Type + "-" + hex.EncodeToString(sum[:8])
+}
+
+// FileRunLocker locks runs with files created exclusively in Dir. A holder refreshes its file's
+// modification time while it runs, so the file of a run that died without releasing it goes stale and
+// is taken over after StaleAfter.
+type FileRunLocker struct {
+	Dir        string
+	StaleAfter time.Duration // defaultLockStaleAfter when zero
+}
+
+// lockOwner is written to a lock file to tell who holds it.
+type lockOwner struct {
+	Host     string    `json:"host"`
+	PID      int       `json:"pid"`
+	Acquired time.Time `json:"acquired"`
+}
+
+// TryLock creates the lock file of name, or takes it over when it is stale.
+func (l FileRunLocker) TryLock(name string) (func() error, error) {
+	staleAfter := l.StaleAfter
+	if staleAfter <= 0 {
+		staleAfter = defaultLockStaleAfter
+	}
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return nil, err
+	}
+	filename := filepath.Join(l.Dir, unsafeFileChars.ReplaceAllString(name, "_")+".lock")
+	host, _ := os.Hostname()
+	owner, _ := json.Marshal(lockOwner{Host: host, PID: os.Getpid(), Acquired: time.Now().UTC()})
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		info, statErr := os.Stat(filename)
+		if statErr != nil || time.Since(info.ModTime()) < staleAfter {
+			return nil, fmt.Errorf("%s: %w", name, ErrRunLocked)
+		}
+		// Of the runs finding the file stale, only the one whose rename succeeds takes it over
+		stale := fmt.Sprintf("%s.stale-%d", filename, os.Getpid())
+		if os.Rename(filename, stale) != nil {
+			return nil, fmt.Errorf("%s: %w", name, ErrRunLocked)
+		}
+		if info, err := os.Stat(stale); err == nil && time.Since(info.ModTime()) < staleAfter {
+			// Another run took it over in between: give the file back
+			os.Link(stale, filename)
+			os.Remove(stale)
+			return nil, fmt.Errorf("%s: %w", name, ErrRunLocked)
+		}
+		os.Remove(stale)
+		log.Printf("Took over the stale run lock %s", filename)
+		file, err = os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			return nil, fmt.Errorf("%s: %w", name, ErrRunLocked)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, err = file.Write(owner)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filename)
+		return nil, err
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(staleAfter / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				if err := os.Chtimes(filename, now, now); err != nil {
+					log.Printf("Error refreshing the run lock %s: %v", filename, err)
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() error {
+		var err error
+		once.Do(func() {
+			close(stop)
+			err = os.Remove(filename)
+		})
+		return err
+	}, nil
+}
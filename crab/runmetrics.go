@@ -0,0 +1,283 @@
+package crab
+
+import (
+	"bufio"
+	"cmpscfa23team2/records"
+	"encoding/json"
+	"fmt"
+	"gonum.org/v1/plot"
+	"gonum.org/v1/plot/plotter"
+	"gonum.org/v1/plot/plotutil"
+	"gonum.org/v1/plot/vg"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Metrics recorded for every crawl and scrape run.
+const (
+	MetricPages           = "pages"
+	MetricItems           = "items"
+	MetricErrors          = "errors"
+	MetricDurationSeconds = "duration_seconds"
+	MetricHealthy         = "healthy"      // 1 when the run completed, else 0
+	MetricTTFBP50         = "ttfb_p50_ms"  // Labelled with the domain
+	MetricTTFBP95         = "ttfb_p95_ms"  // Labelled with the domain
+	MetricFetchP50        = "fetch_p50_ms" // Labelled with the domain
+	MetricFetchP95        = "fetch_p95_ms" // Labelled with the domain
+	MetricDatasetRows     = "dataset_rows" // Labelled with the dataset
+)
+
+// RunMetric is one measurement of a run.
+type RunMetric = records.RunMetric
+
+// RunMetrics returns the metrics of the run summary describes.
+func RunMetrics(summary RunSummary) []RunMetric {
+	var metrics []RunMetric
+	add := func(metric, label string, value float64) {
+		metrics = append(metrics, RunMetric{RunID: summary.RunID, Kind: summary.Kind, Name: summary.Name,
+			Time: summary.StartedAt, Metric: metric, Label: label, Value: value})
+	}
+	add(MetricPages, "", float64(summary.Pages))
+	add(MetricItems, "", float64(summary.Items))
+	add(MetricErrors, "", float64(summary.Errors))
+	healthy := 0.0
+	if summary.Event == EventCompleted {
+		healthy = 1
+	}
+	add(MetricHealthy, "", healthy)
+	if !summary.FinishedAt.IsZero() {
+		add(MetricDurationSeconds, "", summary.FinishedAt.Sub(summary.StartedAt).Seconds())
+	}
+	for _, latency := range summary.Latency {
+		add(MetricTTFBP50, latency.Domain, latency.TTFB.P50)
+		add(MetricTTFBP95, latency.Domain, latency.TTFB.P95)
+		add(MetricFetchP50, latency.Domain, latency.Fetch.P50)
+		add(MetricFetchP95, latency.Domain, latency.Fetch.P95)
+	}
+	for _, dataset := range summary.Datasets {
+		add(MetricDatasetRows, dataset.Dataset, float64(dataset.Rows))
+	}
+	return metrics
+}
+
+// MetricQuery selects run metrics.
+type MetricQuery = records.MetricQuery
+
+// MetricsStore persists the metrics of runs so their trends can be followed across weeks of scheduled
+// runs; the dal package keeps them in the run_metrics table.
+type MetricsStore interface {
+	SaveRunMetrics(metrics []RunMetric) error
+	// LoadRunMetrics returns the metrics q selects, oldest run first.
+	LoadRunMetrics(q MetricQuery) ([]RunMetric, error)
+}
+
+var (
+	metricsMu    sync.RWMutex
+	metricsStore MetricsStore
+)
+
+// SetMetricsStore sets where run metrics are persisted. Passing nil appends them to run_metrics.jsonl in
+// the output directory instead.
+func SetMetricsStore(store MetricsStore) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metricsStore = store
+}
+
+// currentMetricsStore returns the store set, else the file in the output directory, else nil.
+func currentMetricsStore() MetricsStore {
+	metricsMu.RLock()
+	defer metricsMu.RUnlock()
+	if metricsStore != nil {
+		return metricsStore
+	}
+	if dir := CurrentConfig().Output.Dir; dir != "" {
+		return FileMetricsStore{Path: filepath.Join(dir, "run_metrics.jsonl")}
+	}
+	return nil
+}
+
+// saveRunMetrics persists the metrics of a finished run, when there is a store for them.
+func saveRunMetrics(summary RunSummary) {
+	store := currentMetricsStore()
+	if store == nil || summary.RunID == "" {
+		return
+	}
+	if err := store.SaveRunMetrics(RunMetrics(summary)); err != nil {
+		log.Printf("Error saving the metrics of run %s: %v", summary.RunID, err)
+	}
+}
+
+// LoadRunMetrics returns the run metrics q selects, oldest run first, from the metrics store.
+func LoadRunMetrics(q MetricQuery) ([]RunMetric, error) {
+	store := currentMetricsStore()
+	if store == nil {
+		return []RunMetric{}, nil
+	}
+	return store.LoadRunMetrics(q)
+}
+
+// fileMetricsMu serializes the appends of the runs of a process to metrics files.
+var fileMetricsMu sync.Mutex
+
+// FileMetricsStore keeps run metrics as JSON lines appended to a file.
+type FileMetricsStore struct {
+	Path string
+}
+
+// SaveRunMetrics appends the metrics to the file, creating it when needed.
+func (s FileMetricsStore) SaveRunMetrics(metrics []RunMetric) error {
+	fileMetricsMu.Lock()
+	defer fileMetricsMu.Unlock()
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(f)
+	for _, metric := range metrics {
+		if err := encoder.Encode(metric); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// LoadRunMetrics reads the metrics q selects, oldest run first. A missing file has none.
+func (s FileMetricsStore) LoadRunMetrics(q MetricQuery) ([]RunMetric, error) {
+	fileMetricsMu.Lock()
+	defer fileMetricsMu.Unlock()
+	metrics := []RunMetric{}
+	f, err := os.Open(s.Path)
+	if os.IsNotExist(err) {
+		return metrics, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var metric RunMetric
+		if err := json.Unmarshal(scanner.Bytes(), &metric); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", s.Path, line, err)
+		}
+		if q.Matches(metric) {
+			metrics = append(metrics, metric)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(metrics, func(i, j int) bool { return metrics[i].Time.Before(metrics[j].Time) })
+	return metrics, nil
+}
+
+// parseMetricQuery reads a metric query from the kind, name, metric, label, from and to parameters.
+func parseMetricQuery(r *http.Request) (MetricQuery, error) {
+	query := r.URL.Query()
+	q := MetricQuery{Kind: query.Get("kind"), Name: query.Get("name"), Metric: query.Get("metric"), Label: query.Get("label")}
+	var err error
+	if q.From, err = ParseLatencyTime("from", query.Get("from")); err != nil {
+		return q, err
+	}
+	q.To, err = ParseLatencyTime("to", query.Get("to"))
+	return q, err
+}
+
+// RunMetricsHandler serves the run metrics selected by the kind, name, metric, label, from and to
+// parameters (GET), oldest run first.
+func RunMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := parseMetricQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metrics, err := LoadRunMetrics(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, metrics)
+}
+
+// RunMetricsChartHandler renders the trend of the metric selected by the same parameters as
+// RunMetricsHandler as a PNG line chart, with one line per run name and label.
+func RunMetricsChartHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q, err := parseMetricQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Metric == "" {
+		http.Error(w, "metric is required", http.StatusBadRequest)
+		return
+	}
+	metrics, err := LoadRunMetrics(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	chart, err := metricsChart(q.Metric, metrics)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writer, err := chart.WriterTo(8*vg.Inch, 4*vg.Inch, "png")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	if _, err := writer.WriteTo(w); err != nil {
+		log.Printf("Error writing metrics chart: %v", err)
+	}
+}
+
+// metricsChart plots metrics over the start time of their runs, one line per run name and label.
+func metricsChart(metric string, metrics []RunMetric) (*plot.Plot, error) {
+	p := plot.New()
+	p.Title.Text = metric
+	p.X.Label.Text = "Run"
+	p.Y.Label.Text = metric
+	p.X.Tick.Marker = plot.TimeTicks{Format: "2006-01-02"}
+	p.Add(plotter.NewGrid())
+
+	var series []string
+	points := map[string]plotter.XYs{}
+	for _, m := range metrics {
+		key := m.Name
+		if m.Label != "" && m.Label != m.Name {
+			key += " " + m.Label
+		}
+		if points[key] == nil {
+			series = append(series, key)
+		}
+		points[key] = append(points[key], plotter.XY{X: float64(m.Time.Unix()), Y: m.Value})
+	}
+	sort.Strings(series)
+	for i, key := range series {
+		line, err := plotter.NewLine(points[key])
+		if err != nil {
+			return nil, fmt.Errorf("plotting %s of %s: %w", metric, key, err)
+		}
+		line.Color = plotutil.Color(i)
+		p.Add(line)
+		p.Legend.Add(key, line)
+	}
+	p.Legend.Top = true
+	return p, nil
+}
@@ -0,0 +1,277 @@
+package crab
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// OutputConfig controls where run outputs are written. With Dir empty, outputs keep their historical
+// fixed names in the working directory. With Dir set, every crawl or scrape writes into its own
+// Dir/{run_id}/ directory, Dir/latest.json (and a Dir/latest symlink where supported) points at the newest
+// run, and only the newest Retain runs are kept (0 keeps all of them).
+//
+// Format selects "json" (the default) or "ndjson"; in NDJSON mode scraped datasets and the sitemap are
+// written one record per line to .ndjson files. Gzip compresses those files and adds a .gz extension.
+type OutputConfig struct {
+	Dir    string `json:"dir"`
+	Retain int    `json:"retain"`
+	Format string `json:"format"`
+	Gzip   bool   `json:"gzip"`
+}
+
+// Run is one crawl or scrape with its own output directory.
+type Run struct {
+	ID        string
+	Kind      string // "crawl", "scrape" or "import"
+	Dir       string
+	StartedAt time.Time
+
+	retain  int         // Newest runs kept when it finishes; all when 0
+	summary *RunSummary // What the run reports, for its report templates
+}
+
+// RunManifest is written to the run's manifest.json and to latest.json when a run finishes. Downstream
+// consumers can check the run's files against it with VerifyRunManifest.
+type RunManifest struct {
+	RunID      string         `json:"run_id"`
+	Kind       string         `json:"kind"`
+	Path       string         `json:"path"`
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	Files      []ManifestFile `json:"files"`
+}
+
+// ManifestFile is one output file of a run. Path is relative to the run directory.
+type ManifestFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// runIDPattern matches IDs made by NewRunID. Only directories matching it are ever pruned.
+var runIDPattern = regexp.MustCompile(`^\d{8}T\d{6}\.\d{3}Z-[0-9a-f]{6}$`)
+
+// NewRunID returns a unique ID that sorts in start order, e.g. 20240102T150405.123Z-3fa9c1.
+func NewRunID(t time.Time) string {
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	return t.UTC().Format("20060102T150405.000Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// StartRun creates the output directory for a new run. It returns a nil Run when no output directory
+// is configured, in which case Path leaves file names unchanged.
+func StartRun(kind string) (*Run, error) {
+	return startRun(CurrentConfig().Output, kind)
+}
+
+// startRun is StartRun in the output directory of config.
+func startRun(config OutputConfig, kind string) (*Run, error) {
+	if config.Dir == "" {
+		return nil, nil
+	}
+	now := time.Now()
+	run := &Run{ID: NewRunID(now), Kind: kind, StartedAt: now, retain: config.Retain}
+	run.Dir = filepath.Join(config.Dir, run.ID)
+	if err := os.MkdirAll(run.Dir, 0755); err != nil {
+		log.Printf("Error creating run directory '%s': %s", run.Dir, err)
+		return nil, err
+	}
+	log.Printf("Started %s run %s", kind, run.ID)
+	activeRuns.Lock()
+	activeRuns.run = run
+	activeRuns.Unlock()
+	return run, nil
+}
+
+// activeRuns holds the newest run still in progress, whose ID tags the pages fetched meanwhile.
+var activeRuns struct {
+	sync.Mutex
+	run *Run
+}
+
+// CurrentRunID returns the ID of the newest run in progress, or "" when there is none.
+func CurrentRunID() string {
+	activeRuns.Lock()
+	defer activeRuns.Unlock()
+	return activeRuns.run.RunID()
+}
+
+// RunID returns the run's ID, or "" for the working directory layout.
+func (r *Run) RunID() string {
+	if r == nil {
+		return ""
+	}
+	return r.ID
+}
+
+// Path returns where an output file of the run is written.
+func (r *Run) Path(name string) string {
+	if r == nil {
+		return name
+	}
+	return filepath.Join(r.Dir, name)
+}
+
+// Finish renders the run's charts and reports when they are configured, writes the run's manifest.json
+// with the size and SHA-256 checksum of each output file, records the run as the latest one, pushes its
+// datasets to Google Sheets and uploads its outputs to object storage when those are set up, and prunes
+// runs beyond the retention limit. Files that were not written are left out of the manifest.
+func (r *Run) Finish(files []string) error {
+	if r == nil {
+		return nil
+	}
+	activeRuns.Lock()
+	if activeRuns.run == r {
+		activeRuns.run = nil
+	}
+	activeRuns.Unlock()
+	if charts := r.renderCharts(); len(charts) > 0 {
+		files = append(files, charts...)
+		if r.summary != nil {
+			r.summary.Outputs = append(r.summary.Outputs, charts...)
+		}
+	}
+	if reports := r.renderReports(files); len(reports) > 0 {
+		files = append(files, reports...)
+		if r.summary != nil {
+			r.summary.Outputs = append(r.summary.Outputs, reports...)
+		}
+	}
+	base := filepath.Dir(r.Dir)
+	manifest := RunManifest{
+		RunID:      r.ID,
+		Kind:       r.Kind,
+		Path:       r.Dir,
+		StartedAt:  r.StartedAt,
+		FinishedAt: time.Now(),
+		Files:      []ManifestFile{},
+	}
+	for _, file := range files {
+		entry, err := hashManifestFile(r.Dir, file)
+		if err != nil {
+			log.Printf("Leaving %s out of the run manifest: %s", file, err)
+			continue
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(filepath.Join(r.Dir, "manifest.json"), data); err != nil {
+		log.Printf("Error writing run manifest: %s", err)
+		return err
+	}
+	if err := WriteFileAtomic(filepath.Join(base, "latest.json"), data); err != nil {
+		log.Printf("Error writing latest run manifest: %s", err)
+		return err
+	}
+
+	// The symlink is a convenience; on systems without symlink support latest.json is enough.
+	latest := filepath.Join(base, "latest")
+	os.Remove(latest)
+	if err := os.Symlink(r.ID, latest); err != nil {
+		log.Printf("Could not link %s to run %s: %s", latest, r.ID, err)
+	}
+	r.pushToSheets()
+	r.uploadOutputs()
+
+	if r.retain > 0 {
+		if _, err := PruneRuns(base, r.retain); err != nil {
+			log.Printf("Error pruning old runs: %s", err)
+		}
+	}
+	return nil
+}
+
+// VerifyRunManifest checks every file listed in a run directory's manifest.json and returns a
+// description of each missing, resized or modified file. An empty result means the run is intact.
+func VerifyRunManifest(runDir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(runDir, "manifest.json"))
+	if err != nil {
+		return nil, err
+	}
+	var manifest RunManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	for _, want := range manifest.Files {
+		got, err := hashManifestFile(runDir, filepath.Join(runDir, want.Path))
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %s", want.Path, err))
+		case got.Size != want.Size:
+			problems = append(problems, fmt.Sprintf("%s: size %d, manifest says %d", want.Path, got.Size, want.Size))
+		case got.SHA256 != want.SHA256:
+			problems = append(problems, fmt.Sprintf("%s: checksum mismatch", want.Path))
+		}
+	}
+	return problems, nil
+}
+
+// hashManifestFile computes the manifest entry of file, with its path made relative to runDir.
+func hashManifestFile(runDir, file string) (ManifestFile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	rel, err := filepath.Rel(runDir, file)
+	if err != nil {
+		rel = file
+	}
+	return ManifestFile{Path: filepath.ToSlash(rel), Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// ListRuns returns the IDs of the runs in dir, oldest first.
+func ListRuns(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var runs []string
+	for _, entry := range entries {
+		if entry.IsDir() && runIDPattern.MatchString(entry.Name()) {
+			runs = append(runs, entry.Name())
+		}
+	}
+	sort.Strings(runs)
+	return runs, nil
+}
+
+// PruneRuns deletes all but the newest keep runs in dir and returns the IDs it removed.
+func PruneRuns(dir string, keep int) ([]string, error) {
+	runs, err := ListRuns(dir)
+	if err != nil || len(runs) <= keep {
+		return nil, err
+	}
+	var removed []string
+	for _, id := range runs[:len(runs)-keep] {
+		if err := os.RemoveAll(filepath.Join(dir, id)); err != nil {
+			return removed, err
+		}
+		log.Printf("Removed old run %s", id)
+		removed = append(removed, id)
+	}
+	return removed, nil
+}
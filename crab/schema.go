@@ -0,0 +1,236 @@
+package crab
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSchemaViolations caps the violations reported for one document; a changed API usually breaks
+// every item the same way.
+const maxSchemaViolations = 20
+
+// SchemaError reports that an API response no longer matches the target's JSON Schema.
+type SchemaError struct {
+	URL        string
+	Violations []string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("response from %s does not match the schema: %s", e.URL, strings.Join(e.Violations, "; "))
+}
+
+// checkSchema validates one response of a JSON or GraphQL target against its schema, if it has one.
+func checkSchema(schema map[string]interface{}, doc interface{}, url string) error {
+	if len(schema) == 0 {
+		return nil
+	}
+	if violations := ValidateJSONSchema(schema, doc); len(violations) > 0 {
+		return &SchemaError{URL: url, Violations: violations}
+	}
+	return nil
+}
+
+// ValidateJSONSchema checks a decoded JSON document against a JSON Schema and returns the violations
+// found, each prefixed with the JSONPath of the offending value. The supported keywords are type, enum,
+// const, properties, required, additionalProperties, items, minItems, maxItems, minimum, maximum,
+// minLength, maxLength, pattern and anyOf; other keywords are ignored.
+func ValidateJSONSchema(schema map[string]interface{}, doc interface{}) []string {
+	v := schemaValidator{}
+	v.validate(schema, doc, "$")
+	return v.violations
+}
+
+type schemaValidator struct {
+	violations []string
+}
+
+func (v *schemaValidator) fail(path, format string, args ...interface{}) {
+	if len(v.violations) < maxSchemaViolations {
+		v.violations = append(v.violations, path+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *schemaValidator) validate(schema map[string]interface{}, value interface{}, path string) {
+	if len(v.violations) >= maxSchemaViolations {
+		return
+	}
+	if types, ok := schema["type"]; ok && !matchesSchemaType(types, value) {
+		v.fail(path, "expected %v, got %s", types, jsonTypeOf(value))
+		return // The other keywords would only repeat the mismatch
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if jsonEqual(allowed, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			v.fail(path, "%v is not one of %v", value, enum)
+		}
+	}
+	if constant, ok := schema["const"]; ok && !jsonEqual(constant, value) {
+		v.fail(path, "expected %v, got %v", constant, value)
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		matched := false
+		for _, option := range anyOf {
+			if sub, ok := option.(map[string]interface{}); ok && len(ValidateJSONSchema(sub, value)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			v.fail(path, "matches none of the anyOf schemas")
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		v.validateObject(schema, value, path)
+	case []interface{}:
+		if n, ok := schemaNumber(schema["minItems"]); ok && float64(len(value)) < n {
+			v.fail(path, "has %d items, want at least %v", len(value), n)
+		}
+		if n, ok := schemaNumber(schema["maxItems"]); ok && float64(len(value)) > n {
+			v.fail(path, "has %d items, want at most %v", len(value), n)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range value {
+				v.validate(items, item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(value))
+		if n, ok := schemaNumber(schema["minLength"]); ok && length < n {
+			v.fail(path, "is shorter than %v characters", n)
+		}
+		if n, ok := schemaNumber(schema["maxLength"]); ok && length > n {
+			v.fail(path, "is longer than %v characters", n)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				v.fail(path, "schema pattern %q is invalid: %v", pattern, err)
+			} else if !re.MatchString(value) {
+				v.fail(path, "%q does not match %q", value, pattern)
+			}
+		}
+	default:
+		if n, ok := schemaNumber(value); ok {
+			if min, ok := schemaNumber(schema["minimum"]); ok && n < min {
+				v.fail(path, "%v is less than %v", n, min)
+			}
+			if max, ok := schemaNumber(schema["maximum"]); ok && n > max {
+				v.fail(path, "%v is greater than %v", n, max)
+			}
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(schema map[string]interface{}, value map[string]interface{}, path string) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, present := value[key]; !present {
+					v.fail(path, "missing required property %q", key)
+				}
+			}
+		}
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		childPath := path + "." + key
+		if sub, ok := properties[key].(map[string]interface{}); ok {
+			v.validate(sub, value[key], childPath)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(childPath, "unexpected property")
+			}
+		case map[string]interface{}:
+			v.validate(additional, value[key], childPath)
+		}
+	}
+}
+
+// matchesSchemaType reports whether value has the schema type, or one of the types if types is a list.
+func matchesSchemaType(types interface{}, value interface{}) bool {
+	var names []interface{}
+	switch t := types.(type) {
+	case string:
+		names = []interface{}{t}
+	case []interface{}:
+		names = t
+	}
+	actual := jsonTypeOf(value)
+	for _, name := range names {
+		switch {
+		case name == actual:
+			return true
+		case name == "number" && actual == "integer":
+			return true
+		}
+	}
+	return false
+}
+
+// jsonTypeOf returns the JSON Schema type name of a decoded value. Numbers without a fraction are
+// integers.
+func jsonTypeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	if n, ok := schemaNumber(value); ok {
+		if n == float64(int64(n)) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// schemaNumber converts numbers decoded with or without UseNumber to float64.
+func schemaNumber(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// jsonEqual compares two decoded JSON values, treating numbers by value.
+func jsonEqual(a, b interface{}) bool {
+	if x, ok := schemaNumber(a); ok {
+		y, ok := schemaNumber(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
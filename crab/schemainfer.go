@@ -0,0 +1,282 @@
+package crab
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Column types InferSchema tells apart, from the narrowest to the widest.
+const (
+	ColumnEmpty   = "empty"   // Every cell is empty
+	ColumnBoolean = "boolean" // true/false or yes/no
+	ColumnInteger = "integer" // Whole numbers, possibly with a unit or grouping, e.g. "$1,200"
+	ColumnNumber  = "number"  // Numbers as ParseNumber reads them, e.g. "4.1%"
+	ColumnDate    = "date"    // Dates or months in one of dateLayouts
+	ColumnString  = "string"
+)
+
+// maxSchemaExamples bounds the example values kept of each column.
+const maxSchemaExamples = 3
+
+// dateLayouts are the layouts date columns are recognized in, the first that reads every cell winning.
+var dateLayouts = []string{time.RFC3339, "2006-01-02", "2006-01", "01/02/2006", "1/2/2006", "Jan 2, 2006",
+	"January 2, 2006", "Jan 2006", "January 2006"}
+
+// booleanValues are the cells read as booleans.
+var booleanValues = map[string]bool{"true": true, "false": true, "yes": true, "no": true}
+
+// InferredColumn is the type InferSchema found for a column of a dataset.
+type InferredColumn struct {
+	Name     string   `json:"name"`
+	Field    string   `json:"field"` // The Go field name
+	Type     string   `json:"type"`
+	Nullable bool     `json:"nullable"`         // Some cells are empty
+	Unit     string   `json:"unit,omitempty"`   // The unit every number is written with, e.g. "$" or "%"
+	Layout   string   `json:"layout,omitempty"` // The time layout of a date column
+	Examples []string `json:"examples"`
+}
+
+// InferredSchema is the column types of a dataset, from which GoStruct and JSONSchema write a typed record
+// for it.
+type InferredSchema struct {
+	Dataset string           `json:"dataset"`
+	RunID   string           `json:"run_id,omitempty"`
+	Rows    int              `json:"rows"`
+	Columns []InferredColumn `json:"columns"`
+}
+
+// InferSchema inspects the rows of ds and infers the type of each of its columns: the narrowest type
+// every non-empty cell fits.
+func InferSchema(ds Dataset) InferredSchema {
+	schema := InferredSchema{Dataset: ds.Name, RunID: ds.RunID, Rows: len(ds.Rows), Columns: make([]InferredColumn, len(ds.Columns))}
+	fields := map[string]int{}
+	for j, name := range ds.Columns {
+		column := InferredColumn{Name: name, Field: goFieldName(name), Examples: []string{}}
+		if fields[column.Field]++; fields[column.Field] > 1 {
+			column.Field = fmt.Sprintf("%s%d", column.Field, fields[column.Field])
+		}
+		var values []string
+		seen := map[string]bool{}
+		for _, row := range ds.Rows {
+			value := ""
+			if j < len(row) {
+				value = strings.TrimSpace(row[j])
+			}
+			if value == "" {
+				column.Nullable = true
+				continue
+			}
+			values = append(values, value)
+			if !seen[value] && len(column.Examples) < maxSchemaExamples {
+				seen[value] = true
+				column.Examples = append(column.Examples, value)
+			}
+		}
+		column.Type, column.Unit, column.Layout = inferColumnType(values)
+		schema.Columns[j] = column
+	}
+	return schema
+}
+
+// inferColumnType returns the narrowest type all values fit, with the unit of numbers or the layout of
+// dates.
+func inferColumnType(values []string) (string, string, string) {
+	if len(values) == 0 {
+		return ColumnEmpty, "", ""
+	}
+	boolean := true
+	for _, value := range values {
+		boolean = boolean && booleanValues[strings.ToLower(value)]
+	}
+	if boolean {
+		return ColumnBoolean, "", ""
+	}
+
+	integer, numeric, unit := true, true, ""
+	for i, value := range values {
+		number, err := ParseNumber(value, NumberFormat{})
+		// Codes such as zip codes keep their leading zeros as text
+		leadingZero := len(value) > 1 && value[0] == '0' && value[1] >= '0' && value[1] <= '9'
+		if err != nil || leadingZero || (i > 0 && number.Unit != unit) {
+			numeric = false
+			break
+		}
+		unit = number.Unit
+		integer = integer && number.Value == math.Trunc(number.Value) && !strings.ContainsAny(strings.ReplaceAll(value, ",", ""), ".")
+	}
+	if numeric && integer {
+		return ColumnInteger, unit, ""
+	} else if numeric {
+		return ColumnNumber, unit, ""
+	}
+
+	for _, layout := range dateLayouts {
+		dates := true
+		for _, value := range values {
+			if _, err := time.Parse(layout, value); err != nil {
+				dates = false
+				break
+			}
+		}
+		if dates {
+			return ColumnDate, "", layout
+		}
+	}
+	return ColumnString, "", ""
+}
+
+// goInitialisms are the words Go names write in capitals.
+var goInitialisms = map[string]bool{"id": true, "url": true, "uri": true, "api": true, "cpi": true, "http": true,
+	"html": true, "json": true, "csv": true, "usd": true, "ip": true, "sku": true}
+
+// goFieldName turns a column name such as "average_gasoline_prices" or "Zip Code" into an exported Go
+// identifier, e.g. AverageGasolinePrices or ZipCode.
+func goFieldName(column string) string {
+	words := strings.FieldsFunc(column, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	var b strings.Builder
+	for _, word := range words {
+		lower := strings.ToLower(word)
+		if goInitialisms[lower] {
+			b.WriteString(strings.ToUpper(lower))
+			continue
+		}
+		runes := []rune(word)
+		b.WriteString(strings.ToUpper(string(runes[0])) + string(runes[1:]))
+	}
+	name := b.String()
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "Column" + name
+	}
+	return name
+}
+
+// describe returns a short description of the column's type, e.g. "integer in $, may be empty".
+func (c InferredColumn) describe() string {
+	description := c.Type
+	switch {
+	case c.Unit != "":
+		description += " in " + c.Unit
+	case c.Layout != "":
+		description += " as " + c.Layout
+	}
+	if c.Nullable {
+		description += ", may be empty"
+	}
+	return description
+}
+
+// GoStruct writes a Go type named typeName for the records of the schema's dataset, formatted. Its fields
+// are strings, as the scraped datasets are written and cleaned as text, each commented with the type of
+// its column and an example value.
+func (s InferredSchema) GoStruct(typeName string) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// %s is a record of the %s dataset, as inferred from %d rows", typeName, s.Dataset, s.Rows)
+	if s.RunID != "" {
+		fmt.Fprintf(&b, " of run %s", s.RunID)
+	}
+	fmt.Fprintf(&b, ".\ntype %s struct {\n", typeName)
+	for _, column := range s.Columns {
+		fmt.Fprintf(&b, "%s string `json:%q` // %s", column.Field, column.Name, column.describe())
+		if len(column.Examples) > 0 {
+			fmt.Fprintf(&b, ", e.g. %q", column.Examples[0])
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}\n")
+	return format.Source(b.Bytes())
+}
+
+// JSONSchema returns a JSON Schema of the schema's data file: an array of objects with a string property
+// per column, described by the type of its column. Columns never empty must not be, and date columns in
+// an ISO layout carry their format. The schema can be checked with ValidateJSONSchema.
+func (s InferredSchema) JSONSchema() map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []interface{}{}
+	for _, column := range s.Columns {
+		examples := make([]interface{}, len(column.Examples))
+		for i, example := range column.Examples {
+			examples[i] = example
+		}
+		property := map[string]interface{}{"type": "string", "description": column.describe(), "examples": examples}
+		if !column.Nullable && column.Type != ColumnEmpty {
+			property["minLength"] = 1
+		}
+		switch {
+		case column.Layout == "2006-01-02" && !column.Nullable:
+			property["format"] = "date"
+		case column.Layout == time.RFC3339 && !column.Nullable:
+			property["format"] = "date-time"
+		}
+		properties[column.Name] = property
+		required = append(required, column.Name)
+	}
+	return map[string]interface{}{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   s.Dataset,
+		"type":    "array",
+		"items": map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		},
+	}
+}
+
+// LoadOutputDataset returns the named dataset as of run runID (the latest run when empty): a scraped
+// dataset as LoadDatasetAsOf loads it, or else the <name>_data.json file of the newest run that wrote one,
+// e.g. the output of a listing scraper or a JSON or table target, with a column per key of its records.
+func LoadOutputDataset(dir, name, runID string) (Dataset, error) {
+	for _, source := range scrapedDatasetFiles {
+		if source.Name == name {
+			return LoadDatasetAsOf(dir, name, runID)
+		}
+	}
+	if runID != "" {
+		if _, err := RunStartTime(runID); err != nil {
+			return Dataset{}, err
+		}
+	}
+	runs, err := ListRuns(dir)
+	if err != nil {
+		return Dataset{}, err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runID != "" && runs[i] > runID {
+			continue
+		}
+		for _, file := range []string{name + "_data.json", name + "_data.ndjson"} {
+			path := filepath.Join(dir, runs[i], file)
+			if !outputFileExists(path) {
+				continue
+			}
+			reader, err := OpenOutputFile(path)
+			if err != nil {
+				return Dataset{}, err
+			}
+			ds, err := readJSONDataset(name, reader)
+			reader.Close()
+			if err != nil {
+				return Dataset{}, fmt.Errorf("loading %s: %w", path, err)
+			}
+			ds.RunID = runs[i]
+			return ds, nil
+		}
+	}
+	return Dataset{}, fmt.Errorf("no run in %s wrote the %s dataset", dir, name)
+}
+
+// GoTypeName returns the default name of the Go type of a dataset's records, e.g. AnnualRatesData for
+// annual_rates.
+func GoTypeName(dataset string) string {
+	name := goFieldName(dataset)
+	if strings.HasSuffix(name, "Data") {
+		return name
+	}
+	return name + "Data"
+}
@@ -1,23 +1,21 @@
 package crab
 
 import (
+	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/gocolly/colly"
-	"io/ioutil"
 	"log"
-	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
 	"time"
 )
 
-// urlQueue is a channel used for queuing URLs to be processed by the scraper.
-var urlQueue = make(chan string, 1000)
-
 // visited is a map used for keeping track of URLs that have already been visited by the scraper.
 var visited = make(map[string]bool)
 
@@ -39,6 +37,7 @@ var domainConfigurations = map[string]DomainConfig{
 		URLSelector:         "h3 a",
 		DescriptionSelector: "p.description", // Selector assumed, replace with the actual selector
 		PriceSelector:       "div p.price_color",
+		Pagination:          PaginationConfig{FollowRelNext: true, NextSelector: "li.next a"},
 	},
 	"job-market": {
 		Name:                "job-market",
@@ -130,12 +129,100 @@ func ReadCSV(filePath string) ([]PropertyData, error) {
 // scraped data and saves it to a JSON file.
 func Scrape(startingURL string, domainConfig DomainConfig, wg *sync.WaitGroup) {
 	defer wg.Done()
+	scrape(context.Background(), CurrentConfig, startingURL, domainConfig)
+}
+
+// ScrapeWithConfig scrapes the listing of the domain configuration named domain, e.g. "books", from
+// startingURL under the settings config returns, as CrawlWithConfig crawls, and returns the summary of the
+// run. Once ctx is done no more pages are requested, and the items already scraped are written out.
+func ScrapeWithConfig(ctx context.Context, config func() Config, domain, startingURL string) (RunSummary, error) {
+	domainConfig, exists := domainConfigurations[domain]
+	if !exists {
+		return RunSummary{}, fmt.Errorf("invalid domain name provided: %s", domain)
+	}
+	if !config().ScraperEnabled(domain) {
+		return RunSummary{}, fmt.Errorf("scraper %s is not enabled", domain)
+	}
+	return scrape(ctx, config, startingURL, domainConfig), nil
+}
+
+// scrape is Scrape under the settings config returns, such as those of a job's profile, stopping once ctx
+// is done. The settings of the run are read once at the start; the rate limit, user agent and snapshots
+// as the scrape goes.
+func scrape(ctx context.Context, config func() Config, startingURL string, domainConfig DomainConfig) RunSummary {
+	settings := config()
+	defer beginWatchdog(settings.Watchdog, settings.Output.Dir)() // Sample the process for leaks when the watchdog is enabled
+	seedRun(settings.Deterministic)
 	c := colly.NewCollector(
-		colly.UserAgent(GetRandomUserAgent()),
+		colly.UserAgent(requestUserAgent(settings.Fingerprint)),
 	)
-
-	// Container for scraped data
-	var allData []GenericData
+	applyFingerprint(c, config)
+	DefaultCircuitBreaker.Attach(c) // Stop on anti-bot challenge pages
+	DefaultThrottle.Attach(c)       // Back off domains that answer 429/503
+	attachRateLimit(c, config)      // Space out requests when a rate limit is configured
+	attachProxy(c, settings)        // Go through the configured proxies, past the URL guard
+	AttachPauses(c)                 // Hold requests to paused domains
+
+	summary := RunSummary{Kind: "scrape", Name: domainConfig.Name, StartedAt: time.Now()}
+	run, err := startRun(settings.Output, "scrape")
+	if err != nil {
+		warnf("Error starting run, writing to the working directory: %v", err)
+	}
+	summary.RunID = run.RunID()
+	attachSnapshots(c, config, run.RunID) // Keep the raw HTML when snapshots are enabled
+	events := beginEvents(run)
+
+	// Scraped items are streamed to the output file as they are found instead of being held in memory
+	filename := run.Path(outputFilename(settings.Output, fmt.Sprintf("%s_data.json", domainConfig.Name)))
+	stream, streamErr := CreateDatasetStream(filename, domainConfig.Name)
+	stats := newStatsBuilder(domainConfig.Name)
+
+	// Paginated scrapes resume from the checkpoint of an earlier scrape that did not finish
+	var checkpoint *scrapeCheckpointer
+	var resumed []GenericData
+	if domainConfig.Pagination.Enabled() {
+		checkpoint, resumed = startScrapeCheckpoint(settings, domainConfig.Name, startingURL)
+	}
+	for _, item := range resumed {
+		if streamErr != nil {
+			break
+		}
+		stats.addRecord(item)
+		streamErr = stream.Write(item)
+	}
+	sink := NewResultSink(0, func(item interface{}) error {
+		if streamErr != nil {
+			return streamErr
+		}
+		stats.addRecord(item)
+		if err := checkpoint.add(item); err != nil {
+			return err
+		}
+		if err := stream.Write(item); err != nil {
+			return err
+		}
+		if data, ok := item.(GenericData); ok {
+			events.Emit(CrawlEvent{Type: EventStored, URL: data.Metadata.Source, Records: 1})
+		}
+		return nil
+	})
+	tracer := beginTrace(settings.Trace)
+	tracer.Attach(c)        // Time each request when the trace is enabled
+	attachEvents(c, events) // Log each request to the run's events.jsonl
+	runSpan := startRunSpan("scrape", summary.RunID)
+	runSpan.SetAttribute("crab.domain", domainConfig.Name)
+	AttachTelemetry(c, runSpan)
+	c.OnRequest(func(r *colly.Request) {
+		if ctx.Err() != nil {
+			r.Abort()
+		}
+	})
+	c.OnResponse(func(r *colly.Response) {
+		summary.Pages++
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		summary.Errors++
+	})
 
 	// Define scraping logic based on the domain
 	switch domainConfig.Name {
@@ -182,11 +269,11 @@ func Scrape(startingURL string, domainConfig DomainConfig, wg *sync.WaitGroup) {
 				ModelsMostDepreciation:  modelsMost,
 				Metadata: Metadata{
 					Source:    e.Request.URL.String(),
-					Timestamp: time.Now().Format(time.RFC3339),
+					Timestamp: itemTimestamp(settings.Deterministic),
 				},
 			}
 
-			allData = append(allData, currentItem)
+			sink.Put(currentItem)
 		})
 	case "airfare", "books", "job-market", "nascar-predictem":
 		// General scraping logic for other domains
@@ -200,39 +287,118 @@ func Scrape(startingURL string, domainConfig DomainConfig, wg *sync.WaitGroup) {
 				Price:       e.ChildText(domainConfig.PriceSelector),
 				Metadata: Metadata{
 					Source:    e.Request.URL.String(),
-					Timestamp: time.Now().Format(time.RFC3339),
+					Timestamp: itemTimestamp(settings.Deterministic),
 				},
 			}
-			allData = append(allData, currentItem)
+			sink.Put(currentItem)
 		})
 	}
 
+	// Submit the search form, if any, and walk through the remaining pages of multi-page listings
+	AttachForm(c, domainConfig.Form)
+	attachPagination(c, domainConfig.Pagination, domainConfig.ItemSelector, checkpoint.pagesDone(), func(pages int, next string) {
+		sink.Sync() // The checkpoint must hold every item of the pages done
+		if err := checkpoint.pageDone(pages, next); err != nil {
+			warnf("Error saving checkpoint: %v", err)
+		}
+	})
+
 	// Visit the URL with retry logic
 	maxRetries := 6
+	var visitErr error
+	firstURL := checkpoint.resumeURL(startingURL)
 	for i := 0; i < maxRetries; i++ {
-		err := c.Visit(startingURL)
-		if err == nil {
+		visitErr = c.Visit(firstURL)
+		if visitErr == nil {
 			break
 		}
-		fmt.Printf("Error visiting %s: %s, retrying (%d/%d)\n", startingURL, err, i+1, maxRetries)
-		if i < maxRetries-1 {
-			time.Sleep(time.Second * 10)
+		warnf("Error visiting %s: %s, retrying (%d/%d)", firstURL, visitErr, i+1, maxRetries)
+		if i < maxRetries-1 && sleepContext(ctx, time.Second*10) != nil {
+			break
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		visitErr = err // The pages left were not requested
+	}
 
-	// Save data to JSON file
-	filename := fmt.Sprintf("%s_data.json", domainConfig.Name)
-	err := InsertData(ItemData{
-		Domain: domainConfig.Name,
-		Data:   allData,
-	}, filename)
+	// Finish writing the JSON file
+	endStore := tracer.Region("store", filename)
+	storeSpan := StartSpan(runSpan.Context(), "store")
+	storeSpan.SetAttribute("file.path", filename)
+	items, err := sink.Close()
+	items += len(resumed)
+	if err == nil && len(resumed) > 0 {
+		err = streamErr // The sink only sees it once it gets an item
+	}
+	if err == nil {
+		err = stream.Close()
+	} else if stream != nil {
+		stream.Abort()
+	}
+	endStore()
+	storeSpan.RecordError(err)
+	storeSpan.End()
 	if err != nil {
-		fmt.Printf("Error saving data to JSON file: %v\n", err)
+		errorf("Error saving data to JSON file: %v", err)
+	}
+	checkpoint.finish(err == nil && visitErr == nil && summary.Errors == 0)
+
+	summary.FinishedAt = time.Now()
+	summary.Items = items
+	summary.Outputs = []string{filename}
+	if err := events.Close(); err != nil {
+		errorf("Error writing the event log: %v", err)
+	} else if events != nil {
+		summary.Outputs = append(summary.Outputs, events.Path())
+	}
+	if err == nil {
+		datasetStats := stats.stats()
+		datasetStats.RunID = summary.RunID
+		summary.Datasets = []DatasetStats{datasetStats}
+		summary.Outputs = append(summary.Outputs, recordStats(datasetStats, filename)...)
 	}
+	if tracer != nil {
+		endTrace(tracer, run)
+		summary.Outputs = append(summary.Outputs, run.Path("trace.json"))
+	}
+	if parsedURL, parseErr := url.Parse(startingURL); parseErr == nil {
+		if blocked, ok := DefaultCircuitBreaker.Status(parsedURL.Host); ok {
+			summary.Blocked = []BlockedDomain{blocked}
+		}
+	}
+	switch {
+	case len(summary.Blocked) > 0 && items == 0:
+		summary.Event = EventBlocked
+		summary.Error = fmt.Sprintf("%s served a %s page", summary.Blocked[0].Domain, summary.Blocked[0].Reason)
+	case visitErr != nil:
+		summary.Event = EventFailed
+		summary.Error = visitErr.Error()
+	case err != nil:
+		summary.Event = EventFailed
+		summary.Error = err.Error()
+	case items == 0 && summary.Pages > 0:
+		summary.Event = EventSelectorDrift
+	default:
+		summary.Event = EventCompleted
+	}
+	runSpan.SetAttribute("crab.items", summary.Items)
+	endRunSpan(runSpan)
+	run.finishReported(&summary)
+	reportRun(settings, summary)
+	return summary
 }
 
 //end scrape ===========================================================================================================
 
+// scrapeTestURLs are the pages TestScrape starts from for each domain.
+var scrapeTestURLs = map[string][]string{
+	"airfare":          {"https://www.usinflationcalculator.com/inflation/airfare-inflation/"},
+	"books":            {"http://books.toscrape.com/catalogue/category/books/fiction_10/index.html"},
+	"job-market":       {"https://www.example.com/job-market"},
+	"nascar-predictem": {"https://www.predictem.com/nascar/xfinity-500-race-preview-picks/"},
+	"car-depreciation": {"https://www.thinkinsure.ca/insurance-help-centre/car-deprecation.html"},
+}
+
 // testScrape is a testing function for the scraper. It takes a domain name and triggers the Scrape
 // function using predefined test URLs for the domain. This function helps in validating the scraping logic
 // for different domains.
@@ -243,16 +409,7 @@ func TestScrape(domainName string) {
 		return
 	}
 
-	// Test URLs for the specified domain
-	testURLs := map[string][]string{
-		"airfare":          {"https://www.usinflationcalculator.com/inflation/airfare-inflation/"},
-		"books":            {"http://books.toscrape.com/catalogue/category/books/fiction_10/index.html"},
-		"job-market":       {"https://www.example.com/job-market"},
-		"nascar-predictem": {"https://www.predictem.com/nascar/xfinity-500-race-preview-picks/"},
-		"car-depreciation": {"https://www.thinkinsure.ca/insurance-help-centre/car-deprecation.html"},
-	}
-
-	startingURLs := testURLs[domainName]
+	startingURLs := scrapeTestURLs[domainName]
 	var wg sync.WaitGroup
 
 	// Launch a goroutine for each URL
@@ -272,18 +429,9 @@ func TestScrape(domainName string) {
 // and housing data. Each function fetches data from specific URLs and processes it according to predefined
 // scraping rules and selectors, then writes the scraped data to JSON files.
 func Airdatatest() {
-	scrapeurl := "https://www.usinflationcalculator.com/inflation/airfare-inflation/"
-	res, err := http.Get(scrapeurl)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		log.Fatalf("status code error: %d %s", res.StatusCode, res.Status)
-	}
-
-	doc, err := goquery.NewDocumentFromReader(res.Body)
+	scrapeurl := airfareURL
+	fetchedAt := time.Now()
+	doc, err := fetchScraperDocument(scraperClient, scrapeurl, tableRegions...)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -291,51 +439,30 @@ func Airdatatest() {
 	const switchYear = "2023" // Replace with the actual year
 	const switchMonth = "Dec" // Replace with the actual month
 
-	var months = []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
 	var isSecondTable = false
 	var file *os.File
 
+	run, err := StartRun("scrape")
+	if err != nil {
+		log.Println("Error starting run, writing to the working directory:", err)
+	}
+	outputs := []string{run.Path(airfareFilename("airfare_data_inflation.json")), run.Path(airfareFilename("airfare_data_price.json"))}
+	defer func() { run.Finish(outputs) }()
+
 	// Open the first file
-	file, err = os.OpenFile("airfare_data_inflation.json", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	file, err = os.OpenFile(outputs[0], os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		log.Fatalf("Failed to open first JSON file: %s", err)
 	}
 
-	doc.Find("table tbody tr").Each(func(rowIndex int, rowHtml *goquery.Selection) {
-		if rowIndex == 0 {
-			return
-		}
-
-		var airfareData AirfareData
-		airfareData.Domain = "airfare"
-		airfareData.URL = scrapeurl
-		airfareData.Data.Title = "Airfare Inflation Data"
-		airfareData.Data.Location = "United States"
-		airfareData.Data.Features = []string{"Month", "Inflation Rate"}
-		airfareData.Data.AdditionalInfo.Country = "USA"
-		airfareData.Data.Metadata.Source = scrapeurl
-		airfareData.Data.Metadata.Timestamp = time.Now().Format(time.RFC3339)
-		airfareData.Data.AdditionalInfo.MonthsData = make([]MonthData, 0)
-
-		rowHtml.Find("td").Each(func(cellIndex int, cellHtml *goquery.Selection) {
-			cellText := cellHtml.Text()
-			if cellIndex == 0 {
-				airfareData.Data.Year = cellText
-			} else if cellIndex >= 1 && cellIndex <= 12 {
-				monthData := MonthData{
-					Month: months[cellIndex-1], // Correct usage of months array
-					Rate:  cellText,
-				}
-				airfareData.Data.AdditionalInfo.MonthsData = append(airfareData.Data.AdditionalInfo.MonthsData, monthData)
-			}
-		})
-
+	rows := ExtractAirfareData(doc, scrapeurl)
+	for i, airfareData := range rows {
 		// Switching logic for files
 		if airfareData.Data.Year == switchYear && !isSecondTable {
 			for _, monthData := range airfareData.Data.AdditionalInfo.MonthsData {
 				if monthData.Month == switchMonth {
 					file.Close()
-					file, err = os.OpenFile("airfare_data_price.json", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+					file, err = os.OpenFile(outputs[1], os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 					if err != nil {
 						log.Fatalf("Failed to open second JSON file: %s", err)
 					}
@@ -345,6 +472,17 @@ func Airdatatest() {
 			}
 		}
 
+		if ndjsonOutput() {
+			jsonData, err := json.Marshal(airfareData)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if _, err := file.Write(append(jsonData, '\n')); err != nil {
+				log.Fatalf("Failed to write JSON data to file: %s", err)
+			}
+			continue
+		}
+
 		jsonData, err := json.MarshalIndent(airfareData, "", "  ")
 		if err != nil {
 			log.Fatal(err)
@@ -353,170 +491,225 @@ func Airdatatest() {
 		if _, err := file.Write(jsonData); err != nil {
 			log.Fatalf("Failed to write JSON data to file: %s", err)
 		}
-		if rowIndex < doc.Find("table tbody tr").Length()-1 {
+		if i < len(rows)-1 {
 			file.WriteString(",\n")
 		} else {
 			file.WriteString("\n")
 		}
-	})
+	}
 
 	file.Close()
+	outputs = append(outputs, recordLineage("airfare", outputs[0], PageSource{URL: scrapeurl, FetchedAt: fetchedAt}, run, nil)...)
 	log.Println("Airfare data written to respective files")
 }
 
-//end airfare scraper ==================================================================================================
-
-// begin inflation scraper ==============================================================================================
-func ScrapeInflationData() {
-	scrapeurl := "https://www.usinflationcalculator.com/inflation/current-inflation-rates/"
-	res, err := http.Get(scrapeurl)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		log.Fatalf("status code error: %d %s", res.StatusCode, res.Status)
-	}
-
-	doc, err := goquery.NewDocumentFromReader(res.Body)
-	if err != nil {
-		log.Fatal(err)
-	}
+// ExtractAirfareData reads the airfare tables: one record per year row, with the monthly rates in order.
+// The header row is skipped.
+func ExtractAirfareData(doc *goquery.Document, scrapeurl string) []AirfareData {
+	return extractAirfareData(doc, scrapeurl, CurrentConfig().Deterministic)
+}
 
-	var data []YearData
+// extractAirfareData is ExtractAirfareData stamping the records as config has it.
+func extractAirfareData(doc *goquery.Document, scrapeurl string, config DeterministicConfig) []AirfareData {
+	var months = []string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+	var rows []AirfareData
 	doc.Find("table tbody tr").Each(func(rowIndex int, rowHtml *goquery.Selection) {
-		if rowIndex == 0 { // Skip the header row
+		if rowIndex == 0 {
 			return
 		}
 
-		var yearData YearData
+		var airfareData AirfareData
+		airfareData.Domain = "airfare"
+		airfareData.URL = scrapeurl
+		airfareData.Data.Title = "Airfare Inflation Data"
+		airfareData.Data.Location = "United States"
+		airfareData.Data.Features = []string{"Month", "Inflation Rate"}
+		airfareData.Data.AdditionalInfo.Country = "USA"
+		airfareData.Data.Metadata.Source = scrapeurl
+		airfareData.Data.Metadata.Timestamp = itemTimestamp(config)
+		airfareData.Data.AdditionalInfo.MonthsData = make([]MonthData, 0)
+
 		rowHtml.Find("td").Each(func(cellIndex int, cellHtml *goquery.Selection) {
-			text := cellHtml.Text()
-			switch cellIndex {
-			case 0:
-				yearData.Year = cellHtml.Text()
-			case 1:
-				yearData.Jan = cellHtml.Text()
-			case 2:
-				yearData.Feb = cellHtml.Text()
-			case 3:
-				yearData.Mar = cellHtml.Text()
-			case 4:
-				yearData.Apr = cellHtml.Text()
-			case 5:
-				yearData.May = cellHtml.Text()
-			case 6:
-				yearData.Jun = cellHtml.Text()
-			case 7:
-				yearData.July = cellHtml.Text()
-			case 8:
-				yearData.Aug = cellHtml.Text()
-			case 9:
-				yearData.Sept = cellHtml.Text()
-			case 10:
-				yearData.Oct = cellHtml.Text()
-			case 11:
-				yearData.Nov = cellHtml.Text()
-			case 12:
-				yearData.Dec = cellHtml.Text()
-			case 13:
-				yearData.Avg = cellHtml.Text()
-				yearData.Avg = text
+			cellText := cellHtml.Text()
+			if cellIndex == 0 {
+				airfareData.Data.Year = cellText
+			} else if cellIndex >= 1 && cellIndex <= 12 {
+				monthData := MonthData{
+					Month: months[cellIndex-1], // Correct usage of months array
+					Rate:  cellText,
+				}
+				airfareData.Data.AdditionalInfo.MonthsData = append(airfareData.Data.AdditionalInfo.MonthsData, monthData)
 			}
 		})
-		data = append(data, yearData)
+		rows = append(rows, airfareData)
 	})
+	return rows
+}
 
-	jsonData, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
-		log.Fatal(err)
+// airfareFilename applies the NDJSON extension to the airfare outputs. They are appended to row by row,
+// so they are never gzipped.
+func airfareFilename(name string) string {
+	if ndjsonOutput() {
+		return strings.TrimSuffix(name, ".json") + ".ndjson"
 	}
+	return name
+}
 
-	err = ioutil.WriteFile("inflation_data.json", jsonData, 0644)
-	if err != nil {
-		log.Fatalf("Failed to write JSON data to file: %s", err)
-	}
+//end airfare scraper ==================================================================================================
 
-	fmt.Println("Inflation data written to inflation_data.json")
+// writeScrapedData writes the records of a single-page scraper into a scrape run of its own, so every
+// version of the dataset keeps its run ID, and records the lineage of each row next to them. First the
+// annotations are stripped and the numbers cleaned as configured, datasets with a merge rule are merged
+// into the previous run's version, and values their anomaly rule flags are quarantined rather than
+// written. A dataset failing one of its expectations of severity "fail" is not written at all. Rows whose
+// values changed since the previous run are listed as revisions. It returns the name of the file written.
+func writeScrapedData(dataset, name string, records interface{}, source PageSource) (string, error) {
+	return writeDatasetRun("scrape", dataset, name, records, source)
 }
 
-//end inflation scraper ================================================================================================
+// writeDatasetRun is writeScrapedData for a run of the given kind.
+func writeDatasetRun(kind, dataset, name string, records interface{}, source PageSource) (string, error) {
+	run, err := StartRun(kind)
+	if err != nil {
+		log.Println("Error starting run, writing to the working directory:", err)
+	}
+	records, annotations, err := annotateScrapedRecords(dataset, name, records, run)
+	if err != nil {
+		log.Printf("Error stripping the annotations of %s, writing it as scraped: %v", dataset, err)
+	}
+	records, err = cleanScrapedRecords(dataset, records)
+	if err != nil {
+		log.Printf("Error cleaning %s, writing it as scraped: %v", dataset, err)
+	}
+	merge, err := mergeScrapedRecords(dataset, name, records, run)
+	var outputs []string
+	if annotations != "" {
+		outputs = append(outputs, annotations)
+	}
+	if merge.ReportFile != "" {
+		outputs = append(outputs, merge.ReportFile)
+	}
+	if err != nil {
+		run.Finish(outputs)
+		return run.Path(OutputFilename(name)), err
+	}
+	records, quarantine, err := quarantineScrapedRecords(dataset, name, merge.Records, run)
+	if err != nil {
+		log.Printf("Error checking %s for anomalies, writing it unchecked: %v", dataset, err)
+	}
+	if quarantine != "" {
+		outputs = append(outputs, quarantine)
+	}
+	quality, err := checkScrapedQuality(dataset, name, records, run)
+	if quality != "" {
+		outputs = append(outputs, quality)
+	}
+	if errors.Is(err, ErrQualityFailed) {
+		run.Finish(outputs)
+		return run.Path(OutputFilename(name)), err
+	} else if err != nil {
+		log.Printf("Error checking the quality of %s, writing it unchecked: %v", dataset, err)
+	}
+	revisions, err := recordRevisions(dataset, name, records, run)
+	if err != nil {
+		log.Printf("Error comparing %s with its previous run for revisions: %v", dataset, err)
+	}
+	if revisions != "" {
+		outputs = append(outputs, revisions)
+	}
+	filename, err := WriteRecords(run.Path(name), records)
+	if err != nil {
+		run.Finish(outputs)
+		return filename, err
+	}
+	outputs = append(outputs, filename)
+	outputs = append(outputs, recordLineage(dataset, filename, source, run, merge.Inherited)...)
+	if ds, err := NewDataset(dataset, records); err == nil {
+		ds.RunID = run.RunID()
+		outputs = append(outputs, recordStats(SummarizeDataset(ds), filename)...)
+	}
+	return filename, run.Finish(outputs)
+}
 
-// begin gasoline scraper =================================================================================================
-func ScrapeGasInflationData() {
-	scrapeurl := "https://www.usinflationcalculator.com/gasoline-prices-adjusted-for-inflation/"
-	res, err := http.Get(scrapeurl)
+// begin inflation scraper ==============================================================================================
+func ScrapeInflationData() {
+	scrapeurl := inflationURL
+	fetchedAt := time.Now()
+	doc, err := fetchScraperDocument(scraperClient, scrapeurl, tableRegions...)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode != 200 {
-		log.Fatalf("status code error: %d %s", res.StatusCode, res.Status)
-	}
+	data := ExtractInflationData(doc)
 
-	doc, err := goquery.NewDocumentFromReader(res.Body)
+	filename, err := writeScrapedData("inflation", "inflation_data.json", data, PageSource{URL: scrapeurl, FetchedAt: fetchedAt})
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("Failed to write JSON data to file: %s", err)
 	}
 
-	var data []GasolineData
-	doc.Find("table tbody tr").Each(func(rowIndex int, rowHtml *goquery.Selection) {
-		if rowIndex == 0 { // Skip the header row
-			return
-		}
+	fmt.Println("Inflation data written to", filename)
+}
 
-		var gasData GasolineData
-		rowHtml.Find("td").Each(func(cellIndex int, cellHtml *goquery.Selection) {
-			text := cellHtml.Text()
-			switch cellIndex {
-			case 0:
-				gasData.Year = text
-			case 1:
-				gasData.AverageGasolinePrices = text
-			case 2:
-				gasData.AverageAnnualCPIForGas = text
-			case 3:
-				gasData.GasPricesAdjustedForInfl = text
-			}
-		})
-		data = append(data, gasData)
-	})
+// ExtractInflationData reads the monthly inflation rates table: one record per year row after the header
+// row, whose names place the months and average whatever their order or language (see MapTableHeaders).
+func ExtractInflationData(doc *goquery.Document) []YearData {
+	var data []YearData
+	extractTable(doc, "inflation", &data)
+	return data
+}
 
-	jsonData, err := json.MarshalIndent(data, "", "  ")
+//end inflation scraper ================================================================================================
+
+// begin gasoline scraper =================================================================================================
+func ScrapeGasInflationData() {
+	scrapeurl := gasolineURL
+	fetchedAt := time.Now()
+	doc, err := fetchScraperDocument(scraperClient, scrapeurl, tableRegions...)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = ioutil.WriteFile("gasoline_data.json", jsonData, 0644)
+	data := ExtractGasolineData(doc)
+
+	filename, err := writeScrapedData("gasoline", "gasoline_data.json", data, PageSource{URL: scrapeurl, FetchedAt: fetchedAt})
 	if err != nil {
 		log.Fatalf("Failed to write JSON data to file: %s", err)
 	}
 
-	fmt.Println("Gasoline data written to gasoline_data.json")
+	fmt.Println("Gasoline data written to", filename)
+}
+
+// ExtractGasolineData reads the gasoline prices table: one record per year row after the header row,
+// whose names place the columns whatever their order or language (see MapTableHeaders).
+func ExtractGasolineData(doc *goquery.Document) []GasolineData {
+	var data []GasolineData
+	extractTable(doc, "gasoline", &data)
+	return data
 }
 
 //end gasoline scraper =================================================================================================
 
 // begin housing scraper =================================================================================================
 func ScrapeHousingData() {
-	scrapeurl := "https://www.kaggle.com/datasets/ahmedshahriarsakib/usa-real-estate-dataset"
-	res, err := http.Get(scrapeurl)
+	scrapeurl := housingURL
+	fetchedAt := time.Now()
+	doc, err := fetchScraperDocument(scraperClient, scrapeurl)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode != 200 {
-		log.Fatalf("status code error: %d %s", res.StatusCode, res.Status)
-	}
+	properties := ExtractPropertyData(doc)
 
-	doc, err := goquery.NewDocumentFromReader(res.Body)
+	filename, err := writeScrapedData("housing", "property_data.json", properties, PageSource{URL: scrapeurl, FetchedAt: fetchedAt})
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("Failed to write JSON data to file: %s", err)
 	}
 
+	fmt.Println("Property data written to", filename)
+}
+
+// ExtractPropertyData reads the property listing cards.
+func ExtractPropertyData(doc *goquery.Document) []PropertyData {
 	var properties []PropertyData
 	doc.Find(".sc-fLdTid.sc-eZkIzG.iXbLwD.cefCfQ").Each(func(i int, s *goquery.Selection) {
 		var data PropertyData
@@ -547,17 +740,7 @@ func ScrapeHousingData() {
 		properties = append(properties, data)
 	})
 
-	jsonData, err := json.MarshalIndent(properties, "", "  ")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	err = ioutil.WriteFile("property_data.json", jsonData, 0644)
-	if err != nil {
-		log.Fatalf("Failed to write JSON data to file: %s", err)
-	}
-
-	fmt.Println("Property data written to property_data.json")
+	return properties
 }
 
 //end housing scraper ===================================================================================================
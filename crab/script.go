@@ -0,0 +1,731 @@
+package crab
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ScriptExtractor is an extractor written in the crawl config instead of Go, such as
+//
+//	"script_extractors": [{"name": "books", "pattern": "books.toscrape.com/**", "items": "article.product_pod",
+//	    "fields": [
+//	        {"name": "title", "expr": "attr(find('h3 a'), 'title')"},
+//	        {"name": "price", "expr": "number(text(find('.price_color')))"},
+//	        {"name": "link", "expr": "absurl(attr(find('h3 a'), 'href'))"},
+//	        {"name": "in_stock", "expr": "contains(lower(text(find('.availability'))), 'in stock')"}],
+//	    "filter": "price > 0 && in_stock"}]
+//
+// Each element matching Items is a record, or the whole page when Items is empty. Its fields are
+// expressions evaluated in order, so later ones can use earlier ones by name, and records the filter is
+// false for are dropped.
+//
+// Expressions have string ('...' or "..."), number, true, false and null literals; the operators || && ==
+// != < <= > >= + - * / % and !, with + joining strings; and the variables item (the record's element), doc
+// (the whole page) and url (the page's URL). Their functions are listed in scriptFunctions.
+type ScriptExtractor struct {
+	Name    string        `json:"name"`
+	Pattern string        `json:"pattern"` // The pages it extracts, as for RegisterExtractor
+	Items   string        `json:"items"`   // CSS selector of the page's records
+	Fields  []ScriptField `json:"fields"`
+	Filter  string        `json:"filter"` // Expression the records kept are true for
+}
+
+// ScriptField is one field of the records of a ScriptExtractor.
+type ScriptField struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"`
+}
+
+// RegisterScriptExtractors compiles the script extractors of the crawl config and registers them with
+// RegisterExtractor, failing on the first that does not compile.
+func RegisterScriptExtractors(scripts []ScriptExtractor) error {
+	for _, script := range scripts {
+		extractor, err := CompileScriptExtractor(script)
+		if err != nil {
+			return err
+		}
+		if err := RegisterExtractor(script.Name, script.Pattern, extractor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compiledScript is a ScriptExtractor ready to run.
+type compiledScript struct {
+	items  string
+	names  []string
+	fields []scriptExpr
+	filter scriptExpr
+}
+
+// CompileScriptExtractor parses the expressions of a script extractor.
+func CompileScriptExtractor(script ScriptExtractor) (Extractor, error) {
+	if script.Name == "" || len(script.Fields) == 0 {
+		return nil, fmt.Errorf("script extractor %q needs a name and fields", script.Name)
+	}
+	compiled := &compiledScript{items: script.Items}
+	known := map[string]bool{"item": true, "doc": true, "url": true}
+	for _, field := range script.Fields {
+		if field.Name == "" || known[field.Name] {
+			return nil, fmt.Errorf("script extractor %s: field %q is unnamed or named twice", script.Name, field.Name)
+		}
+		expr, err := parseScript(field.Expr, known)
+		if err != nil {
+			return nil, fmt.Errorf("script extractor %s: field %s: %w", script.Name, field.Name, err)
+		}
+		known[field.Name] = true
+		compiled.names = append(compiled.names, field.Name)
+		compiled.fields = append(compiled.fields, expr)
+	}
+	if script.Filter != "" {
+		filter, err := parseScript(script.Filter, known)
+		if err != nil {
+			return nil, fmt.Errorf("script extractor %s: filter: %w", script.Name, err)
+		}
+		compiled.filter = filter
+	}
+	return compiled, nil
+}
+
+// Extract evaluates the fields of each record of the page.
+func (s *compiledScript) Extract(page *ExtractorPage) ([]map[string]interface{}, error) {
+	doc, err := page.Document()
+	if err != nil {
+		return nil, err
+	}
+	items := doc.Selection
+	if s.items != "" {
+		items = doc.Find(s.items)
+	}
+	var records []map[string]interface{}
+	for i := range items.Nodes {
+		env := &scriptEnv{page: page, vars: map[string]interface{}{"item": items.Eq(i), "doc": doc.Selection, "url": page.URL.String()}}
+		record := make(map[string]interface{}, len(s.fields))
+		for j, field := range s.fields {
+			value, err := field.eval(env)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: field %s: %w", i, s.names[j], err)
+			}
+			env.vars[s.names[j]] = value
+			record[s.names[j]] = scriptOutput(value)
+		}
+		if s.filter != nil {
+			keep, err := s.filter.eval(env)
+			if err != nil {
+				return nil, fmt.Errorf("record %d: filter: %w", i, err)
+			}
+			if !scriptBool(keep) {
+				continue
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// scriptEnv is what an expression is evaluated against.
+type scriptEnv struct {
+	page *ExtractorPage
+	vars map[string]interface{}
+}
+
+// scriptExpr is a parsed expression. Values are nil, bool, float64, string, *goquery.Selection or
+// []interface{}.
+type scriptExpr interface {
+	eval(env *scriptEnv) (interface{}, error)
+}
+
+type (
+	scriptLiteral struct{ value interface{} }
+	scriptVar     struct{ name string }
+	scriptUnary   struct {
+		op      string
+		operand scriptExpr
+	}
+	scriptBinary struct {
+		op          string
+		left, right scriptExpr
+	}
+	scriptCall struct {
+		fn   scriptFunction
+		name string
+		args []scriptExpr
+	}
+)
+
+func (e scriptLiteral) eval(env *scriptEnv) (interface{}, error) { return e.value, nil }
+
+func (e scriptVar) eval(env *scriptEnv) (interface{}, error) { return env.vars[e.name], nil }
+
+func (e scriptUnary) eval(env *scriptEnv) (interface{}, error) {
+	value, err := e.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if e.op == "!" {
+		return !scriptBool(value), nil
+	}
+	number, err := scriptNumber(value)
+	return -number, err
+}
+
+func (e scriptBinary) eval(env *scriptEnv) (interface{}, error) {
+	left, err := e.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	// && and || only evaluate their right side when it decides the result
+	switch e.op {
+	case "&&":
+		if !scriptBool(left) {
+			return false, nil
+		}
+	case "||":
+		if scriptBool(left) {
+			return true, nil
+		}
+	}
+	right, err := e.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "&&", "||":
+		return scriptBool(right), nil
+	case "==", "!=", "<", "<=", ">", ">=":
+		return scriptCompare(e.op, left, right), nil
+	case "+":
+		if _, ok := left.(float64); !ok {
+			return scriptString(left) + scriptString(right), nil
+		}
+		if _, ok := right.(float64); !ok {
+			return scriptString(left) + scriptString(right), nil
+		}
+	}
+	a, err := scriptNumber(left)
+	if err != nil {
+		return nil, err
+	}
+	b, err := scriptNumber(right)
+	if err != nil {
+		return nil, err
+	}
+	switch e.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return a / b, nil
+	case "%":
+		if int64(b) == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return float64(int64(a) % int64(b)), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", e.op)
+}
+
+func (e scriptCall) eval(env *scriptEnv) (interface{}, error) {
+	if e.name == "if" {
+		// Only the branch taken is evaluated
+		cond, err := e.args[0].eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if scriptBool(cond) {
+			return e.args[1].eval(env)
+		}
+		return e.args[2].eval(env)
+	}
+	args := make([]interface{}, len(e.args))
+	for i, arg := range e.args {
+		value, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+	value, err := e.fn.call(env, args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", e.name, err)
+	}
+	return value, nil
+}
+
+// scriptFunction is a function expressions can call with between minArgs and maxArgs arguments.
+type scriptFunction struct {
+	minArgs, maxArgs int
+	call             func(env *scriptEnv, args []interface{}) (interface{}, error)
+}
+
+// scriptFunctions are the functions of extraction expressions. Functions taking a node take the
+// *goquery.Selection of find, item or doc; given a string instead they work on it as text.
+var scriptFunctions map[string]scriptFunction
+
+func init() {
+	str := func(fn func(string) interface{}) scriptFunction {
+		return scriptFunction{1, 1, func(env *scriptEnv, args []interface{}) (interface{}, error) {
+			return fn(scriptString(args[0])), nil
+		}}
+	}
+	scriptFunctions = map[string]scriptFunction{
+		// find(selector) finds elements within the record; find(node, selector) within node
+		"find": {1, 2, func(env *scriptEnv, args []interface{}) (interface{}, error) {
+			within, _ := env.vars["item"].(*goquery.Selection)
+			if len(args) == 2 {
+				node, ok := args[0].(*goquery.Selection)
+				if !ok {
+					return nil, fmt.Errorf("%s is not a node", scriptString(args[0]))
+				}
+				within, args = node, args[1:]
+			}
+			return within.Find(scriptString(args[0])), nil
+		}},
+		"text":  str(func(s string) interface{} { return s }),
+		"texts": {1, 1, func(env *scriptEnv, args []interface{}) (interface{}, error) { return scriptList(args[0]), nil }},
+		"attr": {2, 2, func(env *scriptEnv, args []interface{}) (interface{}, error) {
+			if node, ok := args[0].(*goquery.Selection); ok {
+				if value, exists := node.Attr(scriptString(args[1])); exists {
+					return value, nil
+				}
+			}
+			return nil, nil
+		}},
+		"count": {1, 1, func(env *scriptEnv, args []interface{}) (interface{}, error) {
+			switch v := args[0].(type) {
+			case *goquery.Selection:
+				return float64(v.Length()), nil
+			case []interface{}:
+				return float64(len(v)), nil
+			case nil:
+				return float64(0), nil
+			}
+			return float64(len([]rune(scriptString(args[0])))), nil
+		}},
+		"trim":   str(func(s string) interface{} { return strings.TrimSpace(s) }),
+		"lower":  str(func(s string) interface{} { return strings.ToLower(s) }),
+		"upper":  str(func(s string) interface{} { return strings.ToUpper(s) }),
+		"string": str(func(s string) interface{} { return s }),
+		// number parses the way the clean stage does ("$1,200" is 1200), null when there is no number
+		"number": str(func(s string) interface{} {
+			number, err := ParseNumber(s, NumberFormat{})
+			if err != nil {
+				return nil
+			}
+			return number.Value
+		}),
+		"replace": {3, 3, func(env *scriptEnv, args []interface{}) (interface{}, error) {
+			return strings.ReplaceAll(scriptString(args[0]), scriptString(args[1]), scriptString(args[2])), nil
+		}},
+		// match returns the first group of the regular expression's first match, or the whole match
+		"match": {2, 2, func(env *scriptEnv, args []interface{}) (interface{}, error) {
+			re, err := regexp.Compile(scriptString(args[1]))
+			if err != nil {
+				return nil, err
+			}
+			m := re.FindStringSubmatch(scriptString(args[0]))
+			switch {
+			case m == nil:
+				return nil, nil
+			case len(m) > 1:
+				return m[1], nil
+			}
+			return m[0], nil
+		}},
+		"contains": {2, 2, func(env *scriptEnv, args []interface{}) (interface{}, error) {
+			return strings.Contains(scriptString(args[0]), scriptString(args[1])), nil
+		}},
+		"startsWith": {2, 2, func(env *scriptEnv, args []interface{}) (interface{}, error) {
+			return strings.HasPrefix(scriptString(args[0]), scriptString(args[1])), nil
+		}},
+		"endsWith": {2, 2, func(env *scriptEnv, args []interface{}) (interface{}, error) {
+			return strings.HasSuffix(scriptString(args[0]), scriptString(args[1])), nil
+		}},
+		"split": {2, 2, func(env *scriptEnv, args []interface{}) (interface{}, error) {
+			var list []interface{}
+			for _, part := range strings.Split(scriptString(args[0]), scriptString(args[1])) {
+				if part = strings.TrimSpace(part); part != "" {
+					list = append(list, part)
+				}
+			}
+			return list, nil
+		}},
+		"join": {2, 2, func(env *scriptEnv, args []interface{}) (interface{}, error) {
+			var parts []string
+			for _, v := range scriptList(args[0]) {
+				parts = append(parts, scriptString(v))
+			}
+			return strings.Join(parts, scriptString(args[1])), nil
+		}},
+		// default returns its first argument unless it is null or empty, and the second otherwise
+		"default": {2, 2, func(env *scriptEnv, args []interface{}) (interface{}, error) {
+			if scriptString(args[0]) == "" {
+				return args[1], nil
+			}
+			return args[0], nil
+		}},
+		// if(cond, then, else) is evaluated lazily by scriptCall
+		"if": {3, 3, nil},
+		// absurl resolves a link against the page's URL
+		"absurl": {1, 1, func(env *scriptEnv, args []interface{}) (interface{}, error) {
+			if args[0] == nil {
+				return nil, nil
+			}
+			ref, err := url.Parse(strings.TrimSpace(scriptString(args[0])))
+			if err != nil {
+				return nil, err
+			}
+			return env.page.URL.ResolveReference(ref).String(), nil
+		}},
+	}
+}
+
+// scriptString converts a value to text: the trimmed text of a node, the elements of a list joined by
+// commas.
+func scriptString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case *goquery.Selection:
+		return strings.TrimSpace(v.Text())
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, e := range v {
+			parts[i] = scriptString(e)
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprint(value)
+}
+
+// scriptNumber converts a value to a number for arithmetic.
+func scriptNumber(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case bool:
+		if v {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	number, err := ParseNumber(scriptString(value), NumberFormat{})
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", scriptString(value))
+	}
+	return number.Value, nil
+}
+
+// scriptBool reports whether a value is true: not null, false, 0, empty or a node matching nothing.
+func scriptBool(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case *goquery.Selection:
+		return v.Length() > 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return true
+}
+
+// scriptList converts a value to a list: the texts of each node matched, or a list of the value itself.
+func scriptList(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	case *goquery.Selection:
+		list := make([]interface{}, 0, v.Length())
+		v.Each(func(_ int, s *goquery.Selection) { list = append(list, strings.TrimSpace(s.Text())) })
+		return list
+	}
+	return []interface{}{value}
+}
+
+// scriptCompare compares two values, as numbers when both are numbers and as text otherwise.
+func scriptCompare(op string, left, right interface{}) bool {
+	var cmp int
+	a, aNumber := left.(float64)
+	b, bNumber := right.(float64)
+	if aNumber && bNumber {
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	} else if left == nil || right == nil {
+		// null only equals null
+		if left != nil || right != nil {
+			cmp = 1
+		}
+		if op != "==" && op != "!=" {
+			return false
+		}
+	} else {
+		cmp = strings.Compare(scriptString(left), scriptString(right))
+	}
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+// scriptOutput converts a value to what a record holds: nodes become their text.
+func scriptOutput(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *goquery.Selection:
+		return scriptString(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = scriptOutput(e)
+		}
+		return out
+	}
+	return value
+}
+
+// scriptToken is a token of an expression.
+type scriptToken struct {
+	kind  byte // 'n'umber, 's'tring, 'i'dentifier, 'o'perator or punctuation ( ) , and 0 at the end
+	text  string
+	value interface{}
+	pos   int
+}
+
+// scriptOperators are the operators, longest first so "<=" is not read as "<".
+var scriptOperators = []string{"||", "&&", "==", "!=", "<=", ">=", "<", ">", "+", "-", "*", "/", "%", "!"}
+
+// scriptPrecedence is the binding strength of the binary operators.
+var scriptPrecedence = map[string]int{"||": 1, "&&": 2, "==": 3, "!=": 3, "<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 5, "-": 5, "*": 6, "/": 6, "%": 6}
+
+// lexScript splits an expression into tokens.
+func lexScript(src string) ([]scriptToken, error) {
+	var tokens []scriptToken
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, scriptToken{kind: c, text: string(c), pos: i})
+			i++
+		case c == '\'' || c == '"':
+			var text strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				text.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, scriptToken{kind: 's', text: src[i : j+1], value: text.String(), pos: i})
+			i = j + 1
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.') {
+				j++
+			}
+			number, err := strconv.ParseFloat(src[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at %d", src[i:j], i)
+			}
+			tokens = append(tokens, scriptToken{kind: 'n', text: src[i:j], value: number, pos: i})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			tokens = append(tokens, scriptToken{kind: 'i', text: src[i:j], pos: i})
+			i = j
+		default:
+			op := ""
+			for _, candidate := range scriptOperators {
+				if strings.HasPrefix(src[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, scriptToken{kind: 'o', text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, scriptToken{pos: len(src)}), nil
+}
+
+// scriptParser parses the tokens of an expression by precedence climbing.
+type scriptParser struct {
+	tokens []scriptToken
+	next   int
+	known  map[string]bool // Variables the expression may use
+}
+
+// parseScript parses an expression that may use the variables in known.
+func parseScript(src string, known map[string]bool) (scriptExpr, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, fmt.Errorf("empty expression")
+	}
+	tokens, err := lexScript(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &scriptParser{tokens: tokens, known: known}
+	expr, err := p.binary(1)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != 0 {
+		return nil, fmt.Errorf("unexpected %q at %d", tok.text, tok.pos)
+	}
+	return expr, nil
+}
+
+func (p *scriptParser) peek() scriptToken { return p.tokens[p.next] }
+
+func (p *scriptParser) take() scriptToken {
+	tok := p.tokens[p.next]
+	if tok.kind != 0 {
+		p.next++
+	}
+	return tok
+}
+
+// binary parses operands joined by operators binding at least as strongly as min.
+func (p *scriptParser) binary(min int) (scriptExpr, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		precedence, ok := scriptPrecedence[tok.text]
+		if tok.kind != 'o' || !ok || precedence < min {
+			return left, nil
+		}
+		p.take()
+		right, err := p.binary(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = scriptBinary{op: tok.text, left: left, right: right}
+	}
+}
+
+// unary parses an operand, with any ! or - before it.
+func (p *scriptParser) unary() (scriptExpr, error) {
+	if tok := p.peek(); tok.kind == 'o' && (tok.text == "!" || tok.text == "-") {
+		p.take()
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return scriptUnary{op: tok.text, operand: operand}, nil
+	}
+	return p.primary()
+}
+
+// primary parses a literal, variable, call or parenthesized expression.
+func (p *scriptParser) primary() (scriptExpr, error) {
+	tok := p.take()
+	switch tok.kind {
+	case 'n', 's':
+		return scriptLiteral{tok.value}, nil
+	case '(':
+		expr, err := p.binary(1)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.take(); closing.kind != ')' {
+			return nil, fmt.Errorf("expected ) at %d", closing.pos)
+		}
+		return expr, nil
+	case 'i':
+		switch tok.text {
+		case "true", "false":
+			return scriptLiteral{tok.text == "true"}, nil
+		case "null":
+			return scriptLiteral{nil}, nil
+		}
+		if p.peek().kind != '(' {
+			if !p.known[tok.text] {
+				return nil, fmt.Errorf("unknown variable %s at %d", tok.text, tok.pos)
+			}
+			return scriptVar{tok.text}, nil
+		}
+		return p.call(tok)
+	case 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", tok.text, tok.pos)
+}
+
+// call parses the arguments of a call to the function named by tok.
+func (p *scriptParser) call(tok scriptToken) (scriptExpr, error) {
+	fn, ok := scriptFunctions[tok.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s at %d", tok.text, tok.pos)
+	}
+	p.take() // (
+	var args []scriptExpr
+	for p.peek().kind != ')' {
+		if len(args) > 0 {
+			if comma := p.take(); comma.kind != ',' {
+				return nil, fmt.Errorf("expected , or ) at %d", comma.pos)
+			}
+		}
+		arg, err := p.binary(1)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.take() // )
+	if len(args) < fn.minArgs || len(args) > fn.maxArgs {
+		return nil, fmt.Errorf("%s takes %d to %d arguments, got %d", tok.text, fn.minArgs, fn.maxArgs, len(args))
+	}
+	return scriptCall{fn: fn, name: tok.text, args: args}, nil
+}
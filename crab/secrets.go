@@ -0,0 +1,102 @@
+package crab
+
+import (
+	"cmpscfa23team2/access"
+	"net/url"
+)
+
+// The secrets providers live in package access, which the dal shares; crab's configuration and callers
+// use them under these names.
+type (
+	SecretsProvider = access.SecretsProvider
+	EnvSecrets      = access.EnvSecrets
+	FileSecrets     = access.FileSecrets
+	VaultSecrets    = access.VaultSecrets
+	ChainSecrets    = access.ChainSecrets
+	SecretsConfig   = access.SecretsConfig
+)
+
+// ErrSecretNotFound is returned by a SecretsProvider that has no secret of the requested name.
+var ErrSecretNotFound = access.ErrSecretNotFound
+
+// LookupSecret reads the named secret with the providers of the current configuration.
+func LookupSecret(name string) (string, error) {
+	return access.LookupSecret(name)
+}
+
+// resolveSecrets replaces the credentials of c written as "secret:<name>" with the secrets they name:
+// those of the API, the proxy, SMTP and the GraphQL targets.
+func (c *Config) resolveSecrets() error {
+	provider := c.Secrets.Provider()
+	values := []*string{&c.API.JWTSecret, &c.Proxy.Username, &c.Proxy.Password, &c.Email.Password}
+	for i := range c.API.Keys {
+		values = append(values, &c.API.Keys[i].Key)
+	}
+	for i := range c.Proxy.URLs {
+		values = append(values, &c.Proxy.URLs[i])
+	}
+	for i := range c.GraphQLTargets {
+		values = append(values, &c.GraphQLTargets[i].Token)
+	}
+	for _, value := range values {
+		if err := access.Resolve(provider, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redacted stands in for the credentials of a redacted configuration.
+const redacted = "REDACTED"
+
+// Redacted returns a copy of c with its credentials masked, to show it: the API keys and JWT secret, the
+// SMTP password, the proxy credentials, also inside the proxy URLs, the Vault token, the GraphQL tokens
+// and the values of the headers sent to targets and telemetry backends, which often authorize them.
+// Settings that are not set stay empty.
+func (c Config) Redacted() Config {
+	mask := func(value *string) {
+		if *value != "" {
+			*value = redacted
+		}
+	}
+	maskHeaders := func(headers map[string]string) map[string]string {
+		if headers == nil {
+			return nil
+		}
+		masked := make(map[string]string, len(headers))
+		for name := range headers {
+			masked[name] = redacted
+		}
+		return masked
+	}
+
+	mask(&c.API.JWTSecret)
+	mask(&c.Email.Password)
+	mask(&c.Proxy.Username)
+	mask(&c.Proxy.Password)
+	mask(&c.Secrets.VaultToken)
+	c.API.Keys = append([]APIKey(nil), c.API.Keys...)
+	for i := range c.API.Keys {
+		mask(&c.API.Keys[i].Key)
+	}
+	c.Proxy.URLs = append([]string(nil), c.Proxy.URLs...)
+	for i, raw := range c.Proxy.URLs {
+		if u, err := url.Parse(raw); err != nil {
+			c.Proxy.URLs[i] = redacted
+		} else if u.User != nil {
+			u.User = url.UserPassword(redacted, redacted)
+			c.Proxy.URLs[i] = u.String()
+		}
+	}
+	c.GraphQLTargets = append([]GraphQLTarget(nil), c.GraphQLTargets...)
+	for i := range c.GraphQLTargets {
+		mask(&c.GraphQLTargets[i].Token)
+		c.GraphQLTargets[i].Headers = maskHeaders(c.GraphQLTargets[i].Headers)
+	}
+	c.JSONTargets = append([]JSONTarget(nil), c.JSONTargets...)
+	for i := range c.JSONTargets {
+		c.JSONTargets[i].Headers = maskHeaders(c.JSONTargets[i].Headers)
+	}
+	c.Telemetry.Headers = maskHeaders(c.Telemetry.Headers)
+	return c
+}
@@ -0,0 +1,269 @@
+package crab
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/html"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SecurityAuditConfig turns on the security header audit of crawls: the response headers of every
+// crawled page are checked for a content security policy, HSTS, framing and sniffing protection, and
+// HTTPS pages for subresources loaded over plain HTTP, and the run gets a per-domain security_audit.json.
+type SecurityAuditConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// The checks of the security audit.
+const (
+	SecurityMissingCSP          = "missing-csp"
+	SecurityMissingHSTS         = "missing-hsts"
+	SecurityWeakHSTS            = "weak-hsts"
+	SecurityMissingFrameOptions = "missing-x-frame-options"
+	SecurityMissingNoSniff      = "missing-x-content-type-options"
+	SecurityMixedContent        = "mixed-content"
+)
+
+// minHSTSMaxAge is the shortest HSTS max-age that is not weak: 180 days, as browsers' preload lists ask.
+const minHSTSMaxAge = 180 * 24 * 60 * 60
+
+// securityHeaders are the response headers the audit records.
+var securityHeaders = []string{
+	"Content-Security-Policy",
+	"Content-Security-Policy-Report-Only",
+	"Strict-Transport-Security",
+	"X-Frame-Options",
+	"X-Content-Type-Options",
+	"Referrer-Policy",
+	"Permissions-Policy",
+}
+
+// mixedContentAttrs are the attributes of the elements that load subresources, by element.
+var mixedContentAttrs = map[string]string{
+	"script": "src", "img": "src", "iframe": "src", "audio": "src", "video": "src", "source": "src",
+	"embed": "src", "track": "src", "object": "data", "link": "href",
+}
+
+// SecurityPage is what the security audit needs of a crawled page.
+type SecurityPage struct {
+	URL          string            `json:"url"`
+	Headers      map[string]string `json:"headers"`                 // The security headers of the response, by canonical name
+	MixedContent []string          `json:"mixed_content,omitempty"` // Subresources of an HTTPS page loaded over HTTP
+}
+
+// SecurityPageReport is the audit of one page.
+type SecurityPageReport struct {
+	SecurityPage
+	Issues []SEOIssue `json:"issues"`
+}
+
+// SecurityDomainReport sums up the audit of a domain's pages: the pages failing each check, and the pages
+// sending each security header.
+type SecurityDomainReport struct {
+	Domain  string         `json:"domain"`
+	Pages   int            `json:"pages"`
+	Issues  map[string]int `json:"issues"`
+	Headers map[string]int `json:"headers"`
+}
+
+// SecurityReport is the security header audit of a crawl, its domains and pages sorted by URL.
+type SecurityReport struct {
+	RunID   string                 `json:"run_id,omitempty"`
+	Domains []SecurityDomainReport `json:"domains"`
+	Pages   []SecurityPageReport   `json:"pages"`
+}
+
+// ScanSecurityPage records the security headers of the response for the page at rawURL and, for an HTTPS
+// page, the subresources its HTML loads over HTTP.
+func ScanSecurityPage(rawURL string, header http.Header, body []byte) SecurityPage {
+	page := SecurityPage{URL: rawURL, Headers: map[string]string{}}
+	for _, name := range securityHeaders {
+		if value := header.Get(name); value != "" {
+			page.Headers[name] = value
+		}
+	}
+	base, err := url.Parse(rawURL)
+	if err != nil || base.Scheme != "https" {
+		return page
+	}
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return page
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		name, hasAttr := z.TagName()
+		attr, loads := mixedContentAttrs[string(name)]
+		if !hasAttr || !loads {
+			continue
+		}
+		attrs := tokenAttrs(z)
+		if string(name) == "link" && !strings.Contains(strings.ToLower(attrs["rel"]), "stylesheet") &&
+			!strings.Contains(strings.ToLower(attrs["rel"]), "icon") {
+			continue // Only links the browser loads into the page
+		}
+		if u, err := base.Parse(strings.TrimSpace(attrs[attr])); err == nil && u.Scheme == "http" {
+			page.MixedContent = append(page.MixedContent, u.String())
+		}
+	}
+}
+
+// AuditSecurity checks the headers and mixed content of pages and sums them up by domain.
+func AuditSecurity(pages []SecurityPage) SecurityReport {
+	report := SecurityReport{Domains: []SecurityDomainReport{}, Pages: []SecurityPageReport{}}
+	sorted := append([]SecurityPage(nil), pages...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].URL < sorted[j].URL })
+	domains := map[string]*SecurityDomainReport{}
+	var names []string
+	for _, page := range sorted {
+		audit := SecurityPageReport{SecurityPage: page, Issues: []SEOIssue{}}
+		flag := func(check, format string, args ...interface{}) {
+			audit.Issues = append(audit.Issues, SEOIssue{Check: check, Message: fmt.Sprintf(format, args...)})
+		}
+		u, err := url.Parse(page.URL)
+		https := err == nil && u.Scheme == "https"
+		csp := page.Headers["Content-Security-Policy"]
+		if csp == "" {
+			if page.Headers["Content-Security-Policy-Report-Only"] != "" {
+				flag(SecurityMissingCSP, "the content security policy is only reported, not enforced")
+			} else {
+				flag(SecurityMissingCSP, "no Content-Security-Policy")
+			}
+		}
+		if https {
+			if hsts := page.Headers["Strict-Transport-Security"]; hsts == "" {
+				flag(SecurityMissingHSTS, "no Strict-Transport-Security")
+			} else if maxAge := hstsMaxAge(hsts); maxAge < minHSTSMaxAge {
+				flag(SecurityWeakHSTS, "HSTS max-age %d is under %d", maxAge, minHSTSMaxAge)
+			}
+		}
+		if page.Headers["X-Frame-Options"] == "" && !strings.Contains(strings.ToLower(csp), "frame-ancestors") {
+			flag(SecurityMissingFrameOptions, "no X-Frame-Options or frame-ancestors policy")
+		}
+		if !strings.EqualFold(strings.TrimSpace(page.Headers["X-Content-Type-Options"]), "nosniff") {
+			flag(SecurityMissingNoSniff, "no X-Content-Type-Options: nosniff")
+		}
+		if len(page.MixedContent) > 0 {
+			flag(SecurityMixedContent, "%d subresource(s) over HTTP, e.g. %s", len(page.MixedContent), page.MixedContent[0])
+		}
+		report.Pages = append(report.Pages, audit)
+
+		domain := page.URL
+		if err == nil && u.Hostname() != "" {
+			domain = u.Hostname()
+		}
+		summary := domains[domain]
+		if summary == nil {
+			summary = &SecurityDomainReport{Domain: domain, Issues: map[string]int{}, Headers: map[string]int{}}
+			domains[domain] = summary
+			names = append(names, domain)
+		}
+		summary.Pages++
+		for _, issue := range audit.Issues {
+			summary.Issues[issue.Check]++
+		}
+		for header := range page.Headers {
+			summary.Headers[header]++
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		report.Domains = append(report.Domains, *domains[name])
+	}
+	return report
+}
+
+// hstsMaxAge returns the max-age directive of a Strict-Transport-Security header, or 0.
+func hstsMaxAge(hsts string) int {
+	for _, directive := range strings.Split(hsts, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		if strings.EqualFold(name, "max-age") {
+			n, _ := strconv.Atoi(strings.Trim(strings.TrimSpace(value), `"`))
+			return n
+		}
+	}
+	return 0
+}
+
+// writeSecurityReport audits the pages of a crawl run and writes the report to its security_audit.json.
+func writeSecurityReport(run *Run, pages []SecurityPage) error {
+	report := AuditSecurity(pages)
+	report.RunID = run.RunID()
+	for _, domain := range report.Domains {
+		log.Printf("Security headers of %s: %v over %d page(s)", domain.Domain, domain.Issues, domain.Pages)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(run.Path("security_audit.json"), data)
+}
+
+// LoadSecurityReport reads the security audit of the newest crawl run in dir that started no later than
+// runID (any run when empty) and was audited.
+func LoadSecurityReport(dir, runID string) (SecurityReport, error) {
+	var report SecurityReport
+	if runID != "" {
+		if _, err := RunStartTime(runID); err != nil {
+			return report, err
+		}
+	}
+	runs, err := ListRuns(dir)
+	if err != nil {
+		return report, err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runID != "" && runs[i] > runID {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, runs[i], "security_audit.json"))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return report, err
+		}
+		if err := json.Unmarshal(data, &report); err != nil {
+			return report, fmt.Errorf("parsing the security audit of run %s: %w", runs[i], err)
+		}
+		return report, nil
+	}
+	return report, fmt.Errorf("no crawl run in %s was audited for security headers", dir)
+}
+
+// Summary renders the domains and the issues of their pages for a terminal.
+func (r SecurityReport) Summary() string {
+	var b strings.Builder
+	for _, domain := range r.Domains {
+		fmt.Fprintf(&b, "%s: %d page(s)\n", domain.Domain, domain.Pages)
+		var checks []string
+		for check := range domain.Issues {
+			checks = append(checks, check)
+		}
+		sort.Strings(checks)
+		for _, check := range checks {
+			fmt.Fprintf(&b, "  %-32s %d page(s)\n", check, domain.Issues[check])
+		}
+	}
+	for _, page := range r.Pages {
+		for _, issue := range page.Issues {
+			if issue.Check == SecurityMixedContent {
+				fmt.Fprintf(&b, "\nMixed content on %s:\n", page.URL)
+				for _, resource := range page.MixedContent {
+					fmt.Fprintf(&b, "  %s\n", resource)
+				}
+			}
+		}
+	}
+	return b.String()
+}
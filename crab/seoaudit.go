@@ -0,0 +1,383 @@
+package crab
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/html"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SEOAuditConfig turns on the SEO audit of crawls: every crawled HTML page is checked for a missing title
+// or description, a title shared with other pages, images without alt text, content duplicated on other
+// pages without a canonical link, and a slow response, and the run gets a scored seo_audit.json report.
+type SEOAuditConfig struct {
+	Enabled      bool   `json:"enabled"`
+	SlowResponse string `json:"slow_response"` // Responses slower than this are flagged; defaultSlowResponse when empty
+}
+
+const defaultSlowResponse = 2 * time.Second
+
+// The checks of the SEO audit, with the points each costs a page's score of 100.
+const (
+	SEOMissingTitle       = "missing-title"
+	SEOMissingDescription = "missing-description"
+	SEODuplicateTitle     = "duplicate-title"
+	SEOMissingAlt         = "missing-alt"
+	SEODuplicateContent   = "duplicate-content"
+	SEOSlowResponse       = "slow-response"
+)
+
+var seoPenalties = map[string]int{
+	SEOMissingTitle:       25,
+	SEOMissingDescription: 15,
+	SEODuplicateTitle:     10,
+	SEOMissingAlt:         5, // Per image, up to maxAltPenalty
+	SEODuplicateContent:   20,
+	SEOSlowResponse:       15,
+}
+
+const maxAltPenalty = 20
+
+// SEOPage is what the audit needs of a crawled page.
+type SEOPage struct {
+	URL              string        `json:"url"`
+	Title            string        `json:"title"`
+	Description      string        `json:"description"`
+	Canonical        string        `json:"canonical,omitempty"` // The absolute URL of its rel=canonical link
+	Images           int           `json:"images"`
+	ImagesWithoutAlt int           `json:"images_without_alt"`
+	ContentHash      string        `json:"content_hash"` // Of the page's text, to find duplicates; empty when it has none
+	ResponseTime     time.Duration `json:"-"`
+}
+
+// SEOIssue is a failed check of a page.
+type SEOIssue struct {
+	Check   string `json:"check"`
+	Message string `json:"message"`
+}
+
+// SEOPageReport is the audit of one page. A page scores 100 less the penalties of its issues, and no
+// less than 0.
+type SEOPageReport struct {
+	URL            string     `json:"url"`
+	Score          int        `json:"score"`
+	Title          string     `json:"title,omitempty"`
+	ResponseMillis int64      `json:"response_ms"`
+	Issues         []SEOIssue `json:"issues"`
+}
+
+// SEOSiteReport sums up the audit of a site's pages: their average score and the pages failing each check.
+type SEOSiteReport struct {
+	Host   string         `json:"host"`
+	Pages  int            `json:"pages"`
+	Score  int            `json:"score"`
+	Issues map[string]int `json:"issues"`
+}
+
+// SEOReport is the SEO audit of a crawl, its sites and pages sorted by URL.
+type SEOReport struct {
+	RunID string          `json:"run_id,omitempty"`
+	Sites []SEOSiteReport `json:"sites"`
+	Pages []SEOPageReport `json:"pages"`
+}
+
+// ScanSEOPage reads what the audit checks from the HTML of the page at rawURL. Only the tokenizer runs;
+// no document tree is built.
+func ScanSEOPage(rawURL string, body []byte) SEOPage {
+	page := SEOPage{URL: rawURL}
+	base, _ := url.Parse(rawURL)
+	text := sha256.New()
+	skip := 0 // Inside <script> or <style>, whose contents are not text
+	words := 0
+	inTitle := false
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			page.Title = strings.Join(strings.Fields(page.Title), " ")
+			if words > 0 {
+				page.ContentHash = hex.EncodeToString(text.Sum(nil))
+			}
+			return page
+		case html.TextToken:
+			if inTitle {
+				page.Title += string(z.Text())
+			} else if skip == 0 {
+				for _, word := range strings.Fields(string(z.Text())) {
+					text.Write([]byte(word + " "))
+					words++
+				}
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "script", "style":
+				if skip > 0 {
+					skip--
+				}
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = tt == html.StartTagToken && page.Title == ""
+			case "script", "style":
+				if tt == html.StartTagToken {
+					skip++
+				}
+			case "meta":
+				if attrs := tokenAttrs(z); strings.EqualFold(attrs["name"], "description") {
+					page.Description = strings.TrimSpace(attrs["content"])
+				}
+			case "link":
+				attrs := tokenAttrs(z)
+				if strings.EqualFold(strings.TrimSpace(attrs["rel"]), "canonical") && attrs["href"] != "" && base != nil {
+					if u, err := base.Parse(attrs["href"]); err == nil {
+						page.Canonical = u.String()
+					}
+				}
+			case "img":
+				page.Images++
+				if _, ok := tokenAttr(z, "alt"); !ok {
+					page.ImagesWithoutAlt++ // An empty alt is right for decorative images
+				}
+			}
+		}
+	}
+}
+
+// tokenAttrs returns the attributes of the current tag token by lower-case name.
+func tokenAttrs(z *html.Tokenizer) map[string]string {
+	attrs := map[string]string{}
+	for {
+		key, value, more := z.TagAttr()
+		if len(key) > 0 {
+			attrs[string(key)] = string(value)
+		}
+		if !more {
+			return attrs
+		}
+	}
+}
+
+// AuditSEO scores pages against each other and the checks of config.
+func AuditSEO(pages []SEOPage, config SEOAuditConfig) SEOReport {
+	slow := defaultSlowResponse
+	if config.SlowResponse != "" {
+		if d, err := time.ParseDuration(config.SlowResponse); err == nil {
+			slow = d
+		}
+	}
+	sorted := append([]SEOPage(nil), pages...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].URL < sorted[j].URL })
+
+	titles := map[string][]string{}
+	contents := map[string][]SEOPage{}
+	for _, page := range sorted {
+		if page.Title != "" {
+			titles[strings.ToLower(page.Title)] = append(titles[strings.ToLower(page.Title)], page.URL)
+		}
+		if page.ContentHash != "" {
+			contents[page.ContentHash] = append(contents[page.ContentHash], page)
+		}
+	}
+
+	report := SEOReport{Sites: []SEOSiteReport{}, Pages: []SEOPageReport{}}
+	sites := map[string]*SEOSiteReport{}
+	var hosts []string
+	for _, page := range sorted {
+		audit := SEOPageReport{URL: page.URL, Title: page.Title, ResponseMillis: page.ResponseTime.Milliseconds(), Issues: []SEOIssue{}}
+		penalty := 0
+		flag := func(check, format string, args ...interface{}) {
+			audit.Issues = append(audit.Issues, SEOIssue{Check: check, Message: fmt.Sprintf(format, args...)})
+			penalty += seoPenalties[check]
+		}
+		if page.Title == "" {
+			flag(SEOMissingTitle, "no <title>")
+		} else if others := titles[strings.ToLower(page.Title)]; len(others) > 1 {
+			flag(SEODuplicateTitle, "title %q is also on %s", page.Title, strings.Join(without(others, page.URL), ", "))
+		}
+		if page.Description == "" {
+			flag(SEOMissingDescription, "no meta description")
+		}
+		if page.ImagesWithoutAlt > 0 {
+			audit.Issues = append(audit.Issues, SEOIssue{Check: SEOMissingAlt,
+				Message: fmt.Sprintf("%d of %d image(s) have no alt text", page.ImagesWithoutAlt, page.Images)})
+			if altPenalty := page.ImagesWithoutAlt * seoPenalties[SEOMissingAlt]; altPenalty < maxAltPenalty {
+				penalty += altPenalty
+			} else {
+				penalty += maxAltPenalty
+			}
+		}
+		if canonical, ok := duplicateCanonical(page, contents[page.ContentHash]); !ok {
+			others := strings.Join(without(pageURLs(contents[page.ContentHash]), page.URL), ", ")
+			if canonical == "" {
+				flag(SEODuplicateContent, "same content as %s, and none has a canonical link", others)
+			} else {
+				flag(SEODuplicateContent, "same content as %s without a canonical link to %s", others, canonical)
+			}
+		}
+		if page.ResponseTime > slow {
+			flag(SEOSlowResponse, "responded in %s, over %s", page.ResponseTime.Round(time.Millisecond), slow)
+		}
+		audit.Score = 100 - penalty
+		if audit.Score < 0 {
+			audit.Score = 0
+		}
+		report.Pages = append(report.Pages, audit)
+
+		host := page.URL
+		if u, err := url.Parse(page.URL); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		site := sites[host]
+		if site == nil {
+			site = &SEOSiteReport{Host: host, Issues: map[string]int{}}
+			sites[host] = site
+			hosts = append(hosts, host)
+		}
+		site.Pages++
+		site.Score += audit.Score
+		for _, issue := range audit.Issues {
+			site.Issues[issue.Check]++
+		}
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		site := sites[host]
+		site.Score = (site.Score + site.Pages/2) / site.Pages
+		report.Sites = append(report.Sites, *site)
+	}
+	return report
+}
+
+// duplicateCanonical checks a page against the pages with the same content. Duplicates are fine when
+// they all name one canonical URL, the one most of them name, or are that URL. It returns that URL, or ""
+// when none names one, and whether page is fine.
+func duplicateCanonical(page SEOPage, duplicates []SEOPage) (string, bool) {
+	if len(duplicates) < 2 {
+		return "", true
+	}
+	votes := map[string]int{}
+	canonical := ""
+	for _, duplicate := range duplicates {
+		if duplicate.Canonical == "" {
+			continue
+		}
+		key := linkKey(duplicate.Canonical)
+		votes[key]++
+		if n := votes[key]; n > votes[canonical] || (n == votes[canonical] && key < canonical) {
+			canonical = key
+		}
+	}
+	if canonical == "" {
+		return "", false
+	}
+	return canonical, linkKey(page.Canonical) == canonical || linkKey(page.URL) == canonical
+}
+
+// pageURLs returns the URLs of pages.
+func pageURLs(pages []SEOPage) []string {
+	urls := make([]string, len(pages))
+	for i, page := range pages {
+		urls[i] = page.URL
+	}
+	return urls
+}
+
+// without returns list without s.
+func without(list []string, s string) []string {
+	var rest []string
+	for _, item := range list {
+		if item != s {
+			rest = append(rest, item)
+		}
+	}
+	return rest
+}
+
+// writeSEOReport audits the pages of a crawl run under config and writes the report to its seo_audit.json.
+func writeSEOReport(config SEOAuditConfig, run *Run, pages []SEOPage) error {
+	report := AuditSEO(pages, config)
+	report.RunID = run.RunID()
+	for _, site := range report.Sites {
+		log.Printf("SEO score of %s: %d over %d page(s)", site.Host, site.Score, site.Pages)
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(run.Path("seo_audit.json"), data)
+}
+
+// LoadSEOReport reads the SEO audit of the newest crawl run in dir that started no later than runID (any
+// run when empty) and was audited.
+func LoadSEOReport(dir, runID string) (SEOReport, error) {
+	var report SEOReport
+	if runID != "" {
+		if _, err := RunStartTime(runID); err != nil {
+			return report, err
+		}
+	}
+	runs, err := ListRuns(dir)
+	if err != nil {
+		return report, err
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runID != "" && runs[i] > runID {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, runs[i], "seo_audit.json"))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return report, err
+		}
+		if err := json.Unmarshal(data, &report); err != nil {
+			return report, fmt.Errorf("parsing the SEO audit of run %s: %w", runs[i], err)
+		}
+		return report, nil
+	}
+	return report, fmt.Errorf("no crawl run in %s was audited", dir)
+}
+
+// Summary renders the site scores and the pages with issues, worst first, for a terminal.
+func (r SEOReport) Summary() string {
+	var b strings.Builder
+	for _, site := range r.Sites {
+		fmt.Fprintf(&b, "%s: score %d over %d page(s)", site.Host, site.Score, site.Pages)
+		var checks []string
+		for check, n := range site.Issues {
+			checks = append(checks, fmt.Sprintf("%s %d", check, n))
+		}
+		sort.Strings(checks)
+		if len(checks) > 0 {
+			fmt.Fprintf(&b, " (%s)", strings.Join(checks, ", "))
+		}
+		b.WriteString("\n")
+	}
+	pages := append([]SEOPageReport(nil), r.Pages...)
+	sort.SliceStable(pages, func(i, j int) bool { return pages[i].Score < pages[j].Score })
+	for _, page := range pages {
+		if len(page.Issues) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%3d  %s\n", page.Score, page.URL)
+		for _, issue := range page.Issues {
+			fmt.Fprintf(&b, "     %s: %s\n", issue.Check, issue.Message)
+		}
+	}
+	return b.String()
+}
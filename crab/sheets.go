@@ -0,0 +1,334 @@
+package crab
+
+import (
+	"bytes"
+	"cmpscfa23team2/access"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sheetsAPIBase = "https://sheets.googleapis.com/v4/spreadsheets"
+	sheetsScope   = "https://www.googleapis.com/auth/spreadsheets"
+)
+
+// ServiceAccountKey holds the fields of a Google service account key file that are needed to obtain
+// an OAuth2 access token.
+type ServiceAccountKey struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// GoogleSheetsSink appends dataset rows to a Google Sheet, one tab per dataset. Rows that are already
+// present in the tab are skipped, so incremental runs only add what is new.
+type GoogleSheetsSink struct {
+	SpreadsheetID string
+	Key           ServiceAccountKey
+	Client        *http.Client
+	BaseURL       string // Sheets API base URL, overridable for testing
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+// NewGoogleSheetsSinkFromEnv builds a sink from the environment. GOOGLE_SHEETS_SPREADSHEET_ID selects the
+// target sheet, GOOGLE_SHEETS_API_URL optionally replaces the Sheets API base URL, and the service account
+// key is the secret google/service_account_json, read with the configured providers and else from
+// GOOGLE_SERVICE_ACCOUNT_JSON (the key itself), or the file named by GOOGLE_APPLICATION_CREDENTIALS.
+func NewGoogleSheetsSinkFromEnv() (*GoogleSheetsSink, error) {
+	spreadsheetID := os.Getenv("GOOGLE_SHEETS_SPREADSHEET_ID")
+	if spreadsheetID == "" {
+		return nil, fmt.Errorf("GOOGLE_SHEETS_SPREADSHEET_ID is not set")
+	}
+
+	secret, err := access.LookupCredential("google/service_account_json")
+	if err != nil {
+		return nil, err
+	}
+	keyJSON := []byte(secret)
+	if len(keyJSON) == 0 {
+		path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+		if path == "" {
+			return nil, fmt.Errorf("neither GOOGLE_SERVICE_ACCOUNT_JSON nor GOOGLE_APPLICATION_CREDENTIALS is set")
+		}
+		keyJSON, err = os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var key ServiceAccountKey
+	if err := json.Unmarshal(keyJSON, &key); err != nil {
+		return nil, fmt.Errorf("parsing service account key: %w", err)
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	baseURL := os.Getenv("GOOGLE_SHEETS_API_URL")
+	if baseURL == "" {
+		baseURL = sheetsAPIBase
+	}
+	return &GoogleSheetsSink{
+		SpreadsheetID: spreadsheetID,
+		Key:           key,
+		Client:        &http.Client{Timeout: 30 * time.Second},
+		BaseURL:       baseURL,
+	}, nil
+}
+
+// pushToSheets appends the scraped datasets of a run that just finished to Google Sheets when
+// GOOGLE_SHEETS_SPREADSHEET_ID is set. Failures are logged rather than failing the run, whose outputs are
+// already on disk.
+func (r *Run) pushToSheets() {
+	if os.Getenv("GOOGLE_SHEETS_SPREADSHEET_ID") == "" {
+		return
+	}
+	sink, err := NewGoogleSheetsSinkFromEnv()
+	if err != nil {
+		log.Printf("Error setting up Google Sheets for run %s: %v", r.ID, err)
+		return
+	}
+	datasets, err := LoadScrapedDatasets(r.Dir)
+	if err != nil {
+		log.Printf("Error loading the datasets of run %s: %v", r.ID, err)
+	}
+	if len(datasets) == 0 {
+		return
+	}
+	added, err := sink.PushDatasets(datasets)
+	if err != nil {
+		log.Printf("Error pushing run %s to Google Sheets: %v", r.ID, err)
+		return
+	}
+	log.Printf("Pushed %d new rows of run %s to Google Sheets", added, r.ID)
+}
+
+// PushDatasets appends every dataset to its own tab and returns the total number of rows added.
+func (s *GoogleSheetsSink) PushDatasets(datasets []Dataset) (int, error) {
+	total := 0
+	for _, ds := range datasets {
+		added, err := s.Push(ds)
+		if err != nil {
+			return total, fmt.Errorf("pushing %s to Google Sheets: %w", ds.Name, err)
+		}
+		total += added
+	}
+	return total, nil
+}
+
+// Push appends the rows of a dataset that are not yet in its tab. The tab is created, with a header row,
+// the first time a dataset is pushed. It returns the number of rows appended.
+func (s *GoogleSheetsSink) Push(ds Dataset) (int, error) {
+	existing, err := s.readValues(ds.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	var values [][]string
+	if existing == nil {
+		if err := s.addSheet(ds.Name); err != nil {
+			return 0, err
+		}
+		values = append(values, ds.Columns)
+	}
+
+	seen := make(map[string]bool, len(existing))
+	for _, row := range existing {
+		seen[strings.Join(row, "\x1f")] = true
+	}
+	for _, row := range ds.Rows {
+		key := strings.Join(row, "\x1f")
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		values = append(values, row)
+	}
+
+	added := len(values)
+	if existing == nil {
+		added-- // The header row is not a data row
+	}
+	if len(values) == 0 {
+		log.Printf("Google Sheets: %s already up to date", ds.Name)
+		return 0, nil
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/values/%s:append?valueInputOption=USER_ENTERED&insertDataOption=INSERT_ROWS",
+		s.baseURL(), s.SpreadsheetID, url.PathEscape(sheetRange(ds.Name)))
+	if err := s.call(http.MethodPost, endpoint, map[string]interface{}{"values": values}, nil); err != nil {
+		return 0, err
+	}
+
+	log.Printf("Google Sheets: appended %d rows to %s", added, ds.Name)
+	return added, nil
+}
+
+// readValues returns the current contents of a tab, or nil if the tab does not exist yet.
+func (s *GoogleSheetsSink) readValues(sheet string) ([][]string, error) {
+	endpoint := fmt.Sprintf("%s/%s/values/%s", s.baseURL(), s.SpreadsheetID, url.PathEscape(sheetRange(sheet)))
+	var result struct {
+		Values [][]string `json:"values"`
+	}
+	err := s.call(http.MethodGet, endpoint, nil, &result)
+	if apiErr, ok := err.(*sheetsAPIError); ok && apiErr.StatusCode == http.StatusBadRequest {
+		return nil, nil // Unknown range, the tab has not been created yet
+	}
+	if err != nil {
+		return nil, err
+	}
+	if result.Values == nil {
+		result.Values = [][]string{}
+	}
+	return result.Values, nil
+}
+
+// addSheet creates a new tab in the spreadsheet.
+func (s *GoogleSheetsSink) addSheet(sheet string) error {
+	endpoint := fmt.Sprintf("%s/%s:batchUpdate", s.baseURL(), s.SpreadsheetID)
+	body := map[string]interface{}{
+		"requests": []interface{}{
+			map[string]interface{}{"addSheet": map[string]interface{}{"properties": map[string]string{"title": sheet}}},
+		},
+	}
+	return s.call(http.MethodPost, endpoint, body, nil)
+}
+
+// sheetsAPIError is returned when the Sheets API answers with a non-2xx status.
+type sheetsAPIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *sheetsAPIError) Error() string {
+	return fmt.Sprintf("sheets API returned %d: %s", e.StatusCode, e.Body)
+}
+
+// call performs an authorized JSON request against the Sheets API.
+func (s *GoogleSheetsSink) call(method, endpoint string, body interface{}, out interface{}) error {
+	token, err := s.token()
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &sheetsAPIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	if out != nil {
+		return json.Unmarshal(respBody, out)
+	}
+	return nil
+}
+
+// token returns a cached access token, exchanging a signed service account assertion for a new one
+// when the cached token is missing or about to expire.
+func (s *GoogleSheetsSink) token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.accessToken != "" && time.Now().Add(time.Minute).Before(s.expiry) {
+		return s.accessToken, nil
+	}
+
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(s.Key.PrivateKey))
+	if err != nil {
+		return "", fmt.Errorf("parsing service account private key: %w", err)
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   s.Key.ClientEmail,
+		"scope": sheetsScope,
+		"aud":   s.Key.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := s.client().PostForm(s.Key.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("token exchange returned %d: %s", resp.StatusCode, body)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	s.accessToken = result.AccessToken
+	s.expiry = now.Add(time.Duration(result.ExpiresIn) * time.Second)
+	return s.accessToken, nil
+}
+
+func (s *GoogleSheetsSink) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
+
+func (s *GoogleSheetsSink) baseURL() string {
+	if s.BaseURL != "" {
+		return s.BaseURL
+	}
+	return sheetsAPIBase
+}
+
+// sheetRange returns the A1 range covering a whole tab.
+func sheetRange(sheet string) string {
+	return "'" + strings.ReplaceAll(sheet, "'", "''") + "'"
+}
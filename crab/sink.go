@@ -0,0 +1,98 @@
+package crab
+
+import (
+	"expvar"
+	"sync"
+)
+
+// resultBuffer bounds how many crawl or scrape results may wait for the writer. Producers block once it
+// is full, so a slow disk slows the crawl down instead of growing memory with the size of the crawl.
+const resultBuffer = 64
+
+// sinkMetrics counts results that had to wait for a full buffer.
+var sinkMetrics = expvar.NewMap("crab_sink")
+
+// ResultSink persists results on its own goroutine as they are produced. Put blocks while the buffer is
+// full; that backpressure keeps memory flat however many results a run yields.
+type ResultSink struct {
+	results chan interface{}
+	done    chan struct{}
+	write   func(v interface{}) error
+
+	mu    sync.Mutex
+	count int
+	err   error
+}
+
+// NewResultSink starts a sink calling write for each result, holding at most buffer results in memory
+// (resultBuffer when buffer is not positive). After the first write error the remaining results are
+// discarded and Close reports the error.
+func NewResultSink(buffer int, write func(v interface{}) error) *ResultSink {
+	if buffer <= 0 {
+		buffer = resultBuffer
+	}
+	s := &ResultSink{results: make(chan interface{}, buffer), done: make(chan struct{}), write: write}
+	go s.run()
+	return s
+}
+
+func (s *ResultSink) run() {
+	defer close(s.done)
+	for v := range s.results {
+		if synced, ok := v.(sinkSync); ok {
+			close(synced)
+			continue
+		}
+		s.mu.Lock()
+		failed := s.err != nil
+		s.mu.Unlock()
+		if failed {
+			continue // Keep draining so producers are never stuck
+		}
+		err := s.write(v)
+		s.mu.Lock()
+		if err != nil {
+			s.err = err
+		} else {
+			s.count++
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Put hands a result to the sink, waiting while the buffer is full.
+func (s *ResultSink) Put(v interface{}) {
+	select {
+	case s.results <- v:
+	default:
+		sinkMetrics.Add("waits", 1)
+		s.results <- v
+	}
+}
+
+// sinkSync is put in a sink by Sync, and closed once the results before it are written.
+type sinkSync chan struct{}
+
+// Sync waits until the results put so far have been written, or discarded after a write error.
+func (s *ResultSink) Sync() {
+	synced := make(sinkSync)
+	s.results <- synced
+	<-synced
+}
+
+// Count returns how many results were written so far.
+func (s *ResultSink) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Close waits for the buffered results to be written and returns the number written and the first
+// write error. Put must not be called after Close.
+func (s *ResultSink) Close() (int, error) {
+	close(s.results)
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count, s.err
+}
@@ -0,0 +1,129 @@
+package crab
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SiteMapDiff describes how site structure changed between two crawl runs.
+type SiteMapDiff struct {
+	Added   []string         `json:"added"`   // Pages only in the newer sitemap
+	Removed []string         `json:"removed"` // Pages only in the older sitemap
+	Changed []PageLinkChange `json:"changed"` // Pages in both whose outbound links differ
+}
+
+// PageLinkChange lists the outbound links gained and lost by one page.
+type PageLinkChange struct {
+	URL          string   `json:"url"`
+	AddedLinks   []string `json:"added_links"`
+	RemovedLinks []string `json:"removed_links"`
+}
+
+// LoadSiteMap reads a sitemap written by CreateSiteMap, or an NDJSON sitemap if the file name ends in
+// .ndjson. Gzipped sitemaps are decompressed.
+func LoadSiteMap(filename string) (map[string][]string, error) {
+	if strings.HasSuffix(strings.TrimSuffix(filename, ".gz"), ".ndjson") {
+		return loadNDJSONSiteMap(filename)
+	}
+	data, err := ReadOutputFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var siteMap map[string][]string
+	if err := json.Unmarshal(data, &siteMap); err != nil {
+		return nil, fmt.Errorf("parsing sitemap %s: %w", filename, err)
+	}
+	return siteMap, nil
+}
+
+// DiffSiteMaps compares an older and a newer sitemap. All lists are sorted so diffs of the same runs
+// are always identical.
+func DiffSiteMaps(previous, current map[string][]string) SiteMapDiff {
+	diff := SiteMapDiff{Added: []string{}, Removed: []string{}, Changed: []PageLinkChange{}}
+	for page := range current {
+		if _, ok := previous[page]; !ok {
+			diff.Added = append(diff.Added, page)
+		}
+	}
+	for page, oldLinks := range previous {
+		newLinks, ok := current[page]
+		if !ok {
+			diff.Removed = append(diff.Removed, page)
+			continue
+		}
+		added, removed := diffLinks(oldLinks, newLinks)
+		if len(added) > 0 || len(removed) > 0 {
+			diff.Changed = append(diff.Changed, PageLinkChange{URL: page, AddedLinks: added, RemovedLinks: removed})
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].URL < diff.Changed[j].URL })
+	return diff
+}
+
+// Empty reports whether the two sitemaps were identical.
+func (d SiteMapDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Summary renders the diff for people reading a terminal or a report.
+func (d SiteMapDiff) Summary() string {
+	if d.Empty() {
+		return "No changes in site structure.\n"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d new page(s), %d removed page(s), %d page(s) with changed links\n", len(d.Added), len(d.Removed), len(d.Changed))
+	if len(d.Added) > 0 {
+		b.WriteString("\nNew pages:\n")
+		for _, page := range d.Added {
+			fmt.Fprintf(&b, "  + %s\n", page)
+		}
+	}
+	if len(d.Removed) > 0 {
+		b.WriteString("\nRemoved pages:\n")
+		for _, page := range d.Removed {
+			fmt.Fprintf(&b, "  - %s\n", page)
+		}
+	}
+	if len(d.Changed) > 0 {
+		b.WriteString("\nChanged links:\n")
+		for _, change := range d.Changed {
+			fmt.Fprintf(&b, "  %s\n", change.URL)
+			for _, link := range change.AddedLinks {
+				fmt.Fprintf(&b, "    + %s\n", link)
+			}
+			for _, link := range change.RemovedLinks {
+				fmt.Fprintf(&b, "    - %s\n", link)
+			}
+		}
+	}
+	return b.String()
+}
+
+// diffLinks returns the links only in current and only in previous, ignoring order and duplicates.
+func diffLinks(previous, current []string) (added, removed []string) {
+	oldSet := make(map[string]bool, len(previous))
+	for _, link := range previous {
+		oldSet[link] = true
+	}
+	newSet := make(map[string]bool, len(current))
+	for _, link := range current {
+		newSet[link] = true
+		if !oldSet[link] {
+			added = append(added, link)
+			oldSet[link] = true // Only report duplicates once
+		}
+	}
+	for _, link := range previous {
+		if !newSet[link] {
+			removed = append(removed, link)
+			newSet[link] = true
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
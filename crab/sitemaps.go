@@ -0,0 +1,104 @@
+package crab
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// maxSitemapSeeds caps the pages a crawl takes from a domain's sitemaps.
+	maxSitemapSeeds = 10000
+	// maxSitemapFiles caps the sitemaps read per domain, counting the children of sitemap indexes.
+	maxSitemapFiles = 50
+)
+
+// sitemapClient fetches sitemaps for crawls. The sitemaps robots.txt lists may be anywhere, so it is
+// subject to the URL guard.
+var sitemapClient = &http.Client{Timeout: 60 * time.Second, Transport: guardedTransport}
+
+// RobotsSitemaps returns the sitemaps listed by Sitemap: directives in the robots.txt of rawURL's site.
+func RobotsSitemaps(rawURL string) ([]string, error) {
+	check, err := CheckRobots(rawURL, "")
+	if err != nil {
+		return nil, err
+	}
+	return check.Sitemaps, nil
+}
+
+// IngestSitemaps reads the page URLs listed in sitemaps, following sitemap indexes, up to limit URLs
+// (maxSitemapSeeds when limit is not positive). Sitemaps that cannot be fetched are logged and skipped.
+func IngestSitemaps(sitemaps []string, limit int) []string {
+	if limit <= 0 {
+		limit = maxSitemapSeeds
+	}
+	var pages []string
+	seen := map[string]bool{}
+	queue := append([]string{}, sitemaps...)
+	for read := 0; len(queue) > 0 && read < maxSitemapFiles && len(pages) < limit; read++ {
+		sitemapURL := queue[0]
+		queue = queue[1:]
+		if seen[sitemapURL] {
+			continue
+		}
+		seen[sitemapURL] = true
+		doc, err := fetchSitemap(sitemapClient, sitemapURL)
+		if err != nil {
+			log.Printf("Error reading sitemap %s: %v", sitemapURL, err)
+			continue
+		}
+		for _, child := range doc.Sitemaps {
+			queue = append(queue, strings.TrimSpace(child.Loc))
+		}
+		for _, u := range doc.URLs {
+			if len(pages) == limit {
+				break
+			}
+			pages = append(pages, strings.TrimSpace(u.Loc))
+		}
+	}
+	return pages
+}
+
+// AddSitemapSeeds adds the pages listed in the robots.txt sitemaps of every seed's domain to seeds,
+// skipping URLs already present and pages of other domains. limit caps the pages taken per domain.
+func AddSitemapSeeds(seeds []URLData, limit int) []URLData {
+	have := map[string]bool{}
+	var domains []*url.URL
+	for _, seed := range seeds {
+		have[seed.URL] = true
+		u, err := url.Parse(seed.URL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		known := false
+		for _, d := range domains {
+			known = known || d.Host == u.Host
+		}
+		if !known {
+			domains = append(domains, u)
+		}
+	}
+
+	for _, domain := range domains {
+		sitemaps, err := RobotsSitemaps(domain.String())
+		if err != nil {
+			log.Printf("Error reading robots.txt of %s: %v", domain.Host, err)
+			continue
+		}
+		added := 0
+		for _, page := range IngestSitemaps(sitemaps, limit) {
+			u, err := url.Parse(page)
+			if err != nil || u.Host != domain.Host || have[page] {
+				continue
+			}
+			have[page] = true
+			seeds = append(seeds, URLData{URL: page})
+			added++
+		}
+		log.Printf("Added %d pages from %d sitemap(s) of %s", added, len(sitemaps), domain.Host)
+	}
+	return seeds
+}
@@ -0,0 +1,187 @@
+package crab
+
+import (
+	"cmpscfa23team2/records"
+	"encoding/json"
+	"fmt"
+	"github.com/gocolly/colly"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// snapshotTimeLayout names snapshot files so they sort by fetch time.
+const snapshotTimeLayout = "20060102T150405.000Z"
+
+// SnapshotConfig controls storing the raw HTML of every crawled and scraped page, so data can be
+// re-extracted later without fetching the site again, and so odd results can be audited.
+type SnapshotConfig struct {
+	Enabled bool   `json:"enabled"`
+	Dir     string `json:"dir"` // Directory of the local content store, "snapshots" when empty
+}
+
+// Snapshot is the raw content of one page as it was fetched.
+type Snapshot = records.Snapshot
+
+// SnapshotStore keeps page snapshots. FileSnapshotStore is the local content store; the dal package
+// stores them in a database blob table.
+type SnapshotStore interface {
+	SaveSnapshot(snapshot Snapshot) error
+	ListSnapshots(rawURL string) ([]Snapshot, error) // Oldest first, without bodies
+	LoadSnapshot(rawURL string, fetchedAt time.Time) (Snapshot, error)
+}
+
+var (
+	snapshotMu    sync.RWMutex
+	snapshotStore SnapshotStore
+)
+
+// SetSnapshotStore replaces the store used when snapshots are enabled. Passing nil goes back to the
+// local content store under SnapshotConfig.Dir.
+func SetSnapshotStore(store SnapshotStore) {
+	snapshotMu.Lock()
+	defer snapshotMu.Unlock()
+	snapshotStore = store
+}
+
+// CurrentSnapshotStore returns the store snapshots are written to, or nil if snapshots are disabled.
+func CurrentSnapshotStore() SnapshotStore {
+	return snapshotStoreFor(CurrentConfig().Snapshots)
+}
+
+// snapshotStoreFor is CurrentSnapshotStore under config.
+func snapshotStoreFor(config SnapshotConfig) SnapshotStore {
+	if !config.Enabled {
+		return nil
+	}
+	snapshotMu.RLock()
+	defer snapshotMu.RUnlock()
+	if snapshotStore != nil {
+		return snapshotStore
+	}
+	dir := config.Dir
+	if dir == "" {
+		dir = "snapshots"
+	}
+	return FileSnapshotStore{Dir: dir}
+}
+
+// URLHash returns the key snapshots of a URL are stored under.
+func URLHash(rawURL string) string {
+	return records.URLHash(rawURL)
+}
+
+// AttachSnapshots stores every page the collector fetches when snapshots are enabled. Attach it after
+// the circuit breaker so challenge pages, whose bodies the breaker drops, are not stored.
+func AttachSnapshots(c *colly.Collector) {
+	attachSnapshots(c, CurrentConfig, CurrentRunID)
+}
+
+// attachSnapshots is AttachSnapshots with the snapshot settings of config, read at every response, tagging
+// the snapshots with the run ID runID returns.
+func attachSnapshots(c *colly.Collector, config func() Config, runID func() string) {
+	c.OnResponse(func(r *colly.Response) {
+		store := snapshotStoreFor(config().Snapshots)
+		if store == nil || len(r.Body) == 0 {
+			return
+		}
+		if contentType := r.Headers.Get("Content-Type"); contentType != "" && !strings.Contains(contentType, "html") {
+			return // Only pages are kept, not feeds, images or other resources
+		}
+		snapshot := Snapshot{
+			URL:         r.Request.URL.String(),
+			FetchedAt:   time.Now(),
+			StatusCode:  r.StatusCode,
+			ContentType: r.Headers.Get("Content-Type"),
+			Body:        r.Body,
+			TraceParent: r.Ctx.Get(traceParentKey),
+			RunID:       runID(),
+		}
+		if err := store.SaveSnapshot(snapshot); err != nil {
+			log.Printf("Error saving snapshot of %s: %v", snapshot.URL, err)
+		}
+	})
+}
+
+// FileSnapshotStore keeps snapshots on disk as Dir/<url hash>/<fetch time>.html.gz, each next to a JSON
+// file holding its metadata.
+type FileSnapshotStore struct {
+	Dir string
+}
+
+// SaveSnapshot compresses and stores a snapshot.
+func (s FileSnapshotStore) SaveSnapshot(snapshot Snapshot) error {
+	snapshot.URLHash = URLHash(snapshot.URL)
+	snapshot.FetchedAt = snapshot.FetchedAt.UTC()
+	dir := filepath.Join(s.Dir, snapshot.URLHash)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	base := filepath.Join(dir, snapshot.FetchedAt.Format(snapshotTimeLayout))
+	meta, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := WriteFileAtomic(base+".html.gz", snapshot.Body); err != nil {
+		return err
+	}
+	return WriteFileAtomic(base+".json", meta)
+}
+
+// ListSnapshots returns the metadata of every snapshot of rawURL, oldest first.
+func (s FileSnapshotStore) ListSnapshots(rawURL string) ([]Snapshot, error) {
+	matches, err := filepath.Glob(filepath.Join(s.Dir, URLHash(rawURL), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	snapshots := []Snapshot{}
+	for _, match := range matches {
+		data, err := os.ReadFile(match)
+		if err != nil {
+			return nil, err
+		}
+		var snapshot Snapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil, fmt.Errorf("parsing snapshot %s: %w", match, err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// LoadSnapshot returns the snapshot of rawURL fetched at fetchedAt, body included. A zero fetchedAt
+// loads the most recent snapshot.
+func (s FileSnapshotStore) LoadSnapshot(rawURL string, fetchedAt time.Time) (Snapshot, error) {
+	snapshots, err := s.ListSnapshots(rawURL)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if len(snapshots) == 0 {
+		return Snapshot{}, fmt.Errorf("no snapshots of %s", rawURL)
+	}
+	snapshot := snapshots[len(snapshots)-1]
+	if !fetchedAt.IsZero() {
+		name := fetchedAt.UTC().Format(snapshotTimeLayout)
+		found := false
+		for _, candidate := range snapshots {
+			if candidate.FetchedAt.Format(snapshotTimeLayout) == name {
+				snapshot, found = candidate, true
+				break
+			}
+		}
+		if !found {
+			return Snapshot{}, fmt.Errorf("no snapshot of %s at %s", rawURL, name)
+		}
+	}
+	body, err := ReadOutputFile(filepath.Join(s.Dir, snapshot.URLHash, snapshot.FetchedAt.Format(snapshotTimeLayout)+".html.gz"))
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snapshot.Body = body
+	return snapshot, nil
+}
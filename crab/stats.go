@@ -0,0 +1,198 @@
+package crab
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// statsSuffix replaces the extension of a dataset file to name the file holding its summary statistics.
+const statsSuffix = ".stats.json"
+
+// ColumnStats summarizes one column of a dataset. Min, Max and Mean are only set for numeric columns,
+// whose every non-empty cell is a number.
+type ColumnStats struct {
+	Column string   `json:"column"`
+	Nulls  int      `json:"nulls"` // Empty cells
+	Min    *float64 `json:"min,omitempty"`
+	Max    *float64 `json:"max,omitempty"`
+	Mean   *float64 `json:"mean,omitempty"`
+}
+
+// DatasetStats summarizes a dataset written by a run, so a scrape that suddenly returns fewer rows, more
+// empty cells or values out of their usual range stands out in the run report.
+type DatasetStats struct {
+	Dataset string        `json:"dataset"`
+	RunID   string        `json:"run_id,omitempty"`
+	Rows    int           `json:"rows"`
+	Columns []ColumnStats `json:"columns"`
+}
+
+// SummarizeDataset computes the statistics of each column of ds.
+func SummarizeDataset(ds Dataset) DatasetStats {
+	builder := newStatsBuilder(ds.Name)
+	for _, row := range ds.Rows {
+		values := make(map[string]string, len(ds.Columns))
+		for j, column := range ds.Columns {
+			if j < len(row) {
+				values[column] = row[j]
+			}
+		}
+		builder.addRow(ds.Columns, values)
+	}
+	stats := builder.stats()
+	stats.RunID = ds.RunID
+	return stats
+}
+
+// statsBuilder accumulates the statistics of a dataset row by row, so streamed scrapes can be summarized
+// without holding their items.
+type statsBuilder struct {
+	name    string
+	rows    int
+	columns []string
+	index   map[string]int
+	acc     []columnAccumulator
+}
+
+// columnAccumulator holds the running statistics of one column.
+type columnAccumulator struct {
+	values, numbers int
+	notNumeric      bool
+	min, max, sum   float64
+}
+
+func newStatsBuilder(name string) *statsBuilder {
+	return &statsBuilder{name: name, index: map[string]int{}}
+}
+
+// addRow adds a row holding values, by column. Columns are reported in the order they are first seen.
+func (b *statsBuilder) addRow(columns []string, values map[string]string) {
+	b.rows++
+	for _, column := range columns {
+		j, ok := b.index[column]
+		if !ok {
+			j = len(b.columns)
+			b.index[column] = j
+			b.columns = append(b.columns, column)
+			b.acc = append(b.acc, columnAccumulator{})
+		}
+		value := strings.TrimSpace(values[column])
+		if value == "" {
+			continue
+		}
+		acc := &b.acc[j]
+		acc.values++
+		if acc.notNumeric {
+			continue
+		}
+		number, err := ParseNumber(value, NumberFormat{})
+		if err != nil {
+			acc.notNumeric = true
+			continue
+		}
+		if acc.numbers == 0 || number.Value < acc.min {
+			acc.min = number.Value
+		}
+		if acc.numbers == 0 || number.Value > acc.max {
+			acc.max = number.Value
+		}
+		acc.sum += number.Value
+		acc.numbers++
+	}
+}
+
+// addRecord adds an item of a scrape, flattened to its top-level JSON fields. Nested objects and lists
+// count as values that are not numbers.
+func (b *statsBuilder) addRecord(item interface{}) {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return
+	}
+	columns := make([]string, 0, len(record))
+	values := make(map[string]string, len(record))
+	for field, value := range record {
+		columns = append(columns, field)
+		if value != nil {
+			values[field] = fmt.Sprint(value)
+		}
+	}
+	sort.Strings(columns)
+	b.addRow(columns, values)
+}
+
+// stats returns the statistics of the rows added so far. A column missing from a row counts as empty.
+func (b *statsBuilder) stats() DatasetStats {
+	stats := DatasetStats{Dataset: b.name, Rows: b.rows, Columns: make([]ColumnStats, len(b.columns))}
+	for j, column := range b.columns {
+		acc := b.acc[j]
+		col := ColumnStats{Column: column, Nulls: b.rows - acc.values}
+		if !acc.notNumeric && acc.numbers > 0 {
+			min, max, mean := acc.min, acc.max, acc.sum/float64(acc.numbers)
+			col.Min, col.Max, col.Mean = &min, &max, &mean
+		}
+		stats.Columns[j] = col
+	}
+	return stats
+}
+
+// String renders the statistics as one line per column, for logs and chat notifications.
+func (s DatasetStats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d rows", s.Dataset, s.Rows)
+	for _, col := range s.Columns {
+		fmt.Fprintf(&b, "\n  %s: %d empty", col.Column, col.Nulls)
+		if col.Mean != nil {
+			fmt.Fprintf(&b, ", min %g, max %g, mean %.4g", *col.Min, *col.Max, *col.Mean)
+		}
+	}
+	return b.String()
+}
+
+// statsFilename returns the statistics file of a dataset file, e.g. gasoline_data.stats.json for
+// gasoline_data.json.
+func statsFilename(dataFile string) string {
+	return strings.TrimSuffix(lineageFilename(dataFile), lineageSuffix) + statsSuffix
+}
+
+// writeDatasetStats stores the statistics of a dataset next to its data file and returns the file name.
+func writeDatasetStats(stats DatasetStats, dataFile string) (string, error) {
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	filename := statsFilename(dataFile)
+	return filename, WriteFileAtomic(filename, data)
+}
+
+// recordStats is writeDatasetStats for scrapes, which log statistics that cannot be written rather than
+// fail. It returns the files to add to the run's outputs.
+func recordStats(stats DatasetStats, dataFile string) []string {
+	log.Printf("Scraped %d rows of %s", stats.Rows, stats.Dataset)
+	filename, err := writeDatasetStats(stats, dataFile)
+	if err != nil {
+		log.Printf("Error writing the statistics of %s: %v", dataFile, err)
+		return nil
+	}
+	return []string{filename}
+}
+
+// LoadDatasetStats returns the statistics of the named dataset as of run runID (the latest run when
+// empty), resolved like LoadDatasetAsOf.
+func LoadDatasetStats(dir, name, runID string) (DatasetStats, error) {
+	runID, dataFile, err := findDatasetRun(dir, name, runID)
+	if err != nil {
+		return DatasetStats{}, err
+	}
+	var stats DatasetStats
+	if err := readJSONFile(statsFilename(dataFile), &stats); err != nil {
+		return DatasetStats{}, fmt.Errorf("no statistics for the %s dataset of run %s: %w", name, runID, err)
+	}
+	return stats, nil
+}
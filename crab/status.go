@@ -0,0 +1,62 @@
+package crab
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net"
+	"time"
+)
+
+// The statuses a crawl gives each URL. Every URL ends up with exactly one, so the URLs that failed are
+// counted by why they failed rather than lost.
+const (
+	StatusFetched      = "fetched"       // Fetched and parsed
+	StatusRobotsDenied = "robots-denied" // Not fetched, as robots.txt disallows it
+	StatusTimeout      = "timeout"       // The request timed out
+	StatusDNSError     = "dns-error"     // The host name did not resolve
+	StatusHTTP4xx      = "http-4xx"      // Answered with a 4xx status
+	StatusHTTP5xx      = "http-5xx"      // Answered with a 5xx status
+	StatusParseError   = "parse-error"   // Fetched, but the extractor or parser failed on it
+	StatusBlocked      = "blocked"       // Refused by the URL guard, as it leads to an internal address
+	StatusTrap         = "trap"          // Not fetched, as a trap heuristic caught it
+	StatusFetchError   = "fetch-error"   // The request failed otherwise, e.g. the connection was refused
+	StatusNotCrawled   = "not-crawled"   // Never fetched, as the crawl was stopped first
+)
+
+// urlStatusMetrics counts the URLs crawled by status.
+var urlStatusMetrics = expvar.NewMap("crab_url_status")
+
+// fetchStatus classifies the outcome of a request answered with statusCode, 0 when there was no answer,
+// and failed with err.
+func fetchStatus(statusCode int, err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var blockedErr *BlockedAddressError
+	switch {
+	case statusCode >= 500:
+		return StatusHTTP5xx
+	case statusCode >= 400:
+		return StatusHTTP4xx
+	case statusCode > 0:
+		return StatusFetched
+	case err == nil:
+		return StatusFetched
+	case errors.As(err, &blockedErr):
+		return StatusBlocked
+	case errors.As(err, &dnsErr):
+		return StatusDNSError
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return StatusTimeout
+	}
+	return StatusFetchError
+}
+
+// fetchTimeout returns the time config gives a page to fetch, or zero to keep colly's default.
+func fetchTimeout(config PipelineConfig) time.Duration {
+	timeout, err := time.ParseDuration(config.FetchTimeout)
+	if err != nil || timeout < 0 {
+		return 0
+	}
+	return timeout
+}
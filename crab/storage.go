@@ -0,0 +1,304 @@
+package crab
+
+import (
+	"bytes"
+	"cmpscfa23team2/access"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runOutputPatterns are the files uploaded after a run: the sitemap, the scraped datasets with their
+// lineage, statistics, merge conflicts and quarantined values, any WARC archives, the crawl report and the
+// run manifest.
+var runOutputPatterns = []string{
+	"siteMap.json",
+	"*_data.json",
+	"*_data_*.json",
+	"*_data.ndjson",
+	"*_data_*.ndjson",
+	"*" + lineageSuffix,
+	"*" + conflictsSuffix,
+	"*" + quarantineSuffix,
+	"*" + statsSuffix,
+	"*" + qualitySuffix,
+	"siteMap.ndjson",
+	"*.warc",
+	"*.warc.gz",
+	"crawl_report.json",
+	"manifest.json",
+}
+
+// ObjectStoreSink uploads run outputs to an S3 bucket, or to a GCS bucket through its S3 compatible XML
+// API using HMAC keys. Requests are signed with AWS Signature Version 4.
+type ObjectStoreSink struct {
+	Endpoint  string // e.g. https://s3.us-east-1.amazonaws.com or https://storage.googleapis.com
+	Region    string // "auto" works for GCS
+	Bucket    string
+	Prefix    string // Optional key prefix placed before the date partition
+	AccessKey string
+	SecretKey string
+	SSE       string // Optional server-side encryption: "AES256" or "aws:kms"
+	KMSKeyID  string // KMS key used when SSE is "aws:kms"
+	Gzip      bool   // Compress uncompressed outputs on upload, adding .gz to their keys
+	Client    *http.Client
+}
+
+// NewObjectStoreSinkFromEnv builds a sink from CRAB_STORAGE_ENDPOINT, CRAB_STORAGE_REGION,
+// CRAB_STORAGE_BUCKET, CRAB_STORAGE_PREFIX, CRAB_STORAGE_SSE, CRAB_STORAGE_KMS_KEY_ID and CRAB_STORAGE_GZIP
+// ("true" to compress uploads). The credentials are the secrets aws/access_key_id and
+// aws/secret_access_key, read with the configured providers and else from the usual AWS_ACCESS_KEY_ID /
+// AWS_SECRET_ACCESS_KEY.
+func NewObjectStoreSinkFromEnv() (*ObjectStoreSink, error) {
+	accessKey, err := access.LookupCredential("aws/access_key_id")
+	if err != nil {
+		return nil, err
+	}
+	secretKey, err := access.LookupCredential("aws/secret_access_key")
+	if err != nil {
+		return nil, err
+	}
+	sink := &ObjectStoreSink{
+		Endpoint:  os.Getenv("CRAB_STORAGE_ENDPOINT"),
+		Region:    os.Getenv("CRAB_STORAGE_REGION"),
+		Bucket:    os.Getenv("CRAB_STORAGE_BUCKET"),
+		Prefix:    os.Getenv("CRAB_STORAGE_PREFIX"),
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		SSE:       os.Getenv("CRAB_STORAGE_SSE"),
+		KMSKeyID:  os.Getenv("CRAB_STORAGE_KMS_KEY_ID"),
+		Gzip:      os.Getenv("CRAB_STORAGE_GZIP") == "true",
+		Client:    &http.Client{Timeout: 5 * time.Minute},
+	}
+	if sink.Bucket == "" {
+		return nil, fmt.Errorf("CRAB_STORAGE_BUCKET is not set")
+	}
+	if sink.AccessKey == "" || sink.SecretKey == "" {
+		return nil, fmt.Errorf("the aws/access_key_id and aws/secret_access_key secrets or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	if sink.Region == "" {
+		sink.Region = "us-east-1"
+	}
+	if sink.Endpoint == "" {
+		sink.Endpoint = "https://s3." + sink.Region + ".amazonaws.com"
+	}
+	return sink, nil
+}
+
+// uploadOutputs uploads the outputs of a run that just finished, manifest included, when CRAB_STORAGE_BUCKET
+// is set. Failures are logged rather than failing the run, whose outputs are already on disk.
+func (r *Run) uploadOutputs() {
+	if os.Getenv("CRAB_STORAGE_BUCKET") == "" {
+		return
+	}
+	sink, err := NewObjectStoreSinkFromEnv()
+	if err != nil {
+		log.Printf("Error setting up object storage for run %s: %v", r.ID, err)
+		return
+	}
+	if _, err := sink.UploadRunOutputs(r.Dir, r.StartedAt); err != nil {
+		log.Printf("Error uploading the outputs of run %s: %v", r.ID, err)
+	}
+}
+
+// RunOutputFiles lists the output files of a run found in dir.
+func RunOutputFiles(dir string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, pattern := range runOutputPatterns {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		if !isGzipName(pattern) {
+			compressed, _ := filepath.Glob(filepath.Join(dir, pattern+".gz"))
+			matches = append(matches, compressed...)
+		}
+		for _, match := range matches {
+			if !seen[match] {
+				seen[match] = true
+				files = append(files, match)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// UploadRunOutputs uploads every output file in dir under a date partitioned key of the form
+// prefix/YYYY/MM/DD/<run time>/<file name>. It returns the keys that were written.
+func (s *ObjectStoreSink) UploadRunOutputs(dir string, runTime time.Time) ([]string, error) {
+	files, err := RunOutputFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, file := range files {
+		name := filepath.Base(file)
+		if s.Gzip && !isGzipName(name) {
+			name += ".gz"
+		}
+		key := s.ObjectKey(runTime, name)
+		if err := s.UploadFile(file, key); err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+	}
+	log.Printf("Uploaded %d run outputs to bucket %s", len(keys), s.Bucket)
+	return keys, nil
+}
+
+// ObjectKey builds the date partitioned key used for a run output.
+func (s *ObjectStoreSink) ObjectKey(runTime time.Time, name string) string {
+	runTime = runTime.UTC()
+	return path.Join(s.Prefix, runTime.Format("2006/01/02"), runTime.Format("20060102T150405Z"), name)
+}
+
+// UploadFile uploads a single local file to the given key. An uncompressed file uploaded to a key ending
+// in .gz is gzipped first.
+func (s *ObjectStoreSink) UploadFile(filename, key string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	if isGzipName(key) && !isGzipName(filename) {
+		if data, err = gzipBytes(data); err != nil {
+			return err
+		}
+	}
+	return s.PutObject(key, data, contentTypeFor(key))
+}
+
+// PutObject uploads data to the given key with a signed PUT request.
+func (s *ObjectStoreSink) PutObject(key string, data []byte, contentType string) error {
+	objectURL, err := url.Parse(strings.TrimRight(s.Endpoint, "/") + "/" + s.Bucket + "/" + encodeKey(key))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, objectURL.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.SSE != "" {
+		req.Header.Set("x-amz-server-side-encryption", s.SSE)
+		if s.SSE == "aws:kms" && s.KMSKeyID != "" {
+			req.Header.Set("x-amz-server-side-encryption-aws-kms-key-id", s.KMSKeyID)
+		}
+	}
+	s.sign(req, data, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("uploading %s returned %d: %s", key, resp.StatusCode, body)
+	}
+	return nil
+}
+
+// sign adds AWS Signature Version 4 headers to the request.
+func (s *ObjectStoreSink) sign(req *http.Request, payload []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	signingKey = hmacSHA256(signingKey, s.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+// encodeKey URI encodes each segment of an object key, leaving the slashes in place.
+func encodeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// contentTypeFor guesses the content type of an output file from its extension.
+func contentTypeFor(filename string) string {
+	switch {
+	case strings.HasSuffix(filename, ".json"):
+		return "application/json"
+	case strings.HasSuffix(filename, ".gz"):
+		return "application/gzip"
+	case strings.HasSuffix(filename, ".warc"):
+		return "application/warc"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,177 @@
+package crab
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Stream formats supported by StreamWriter.
+const (
+	StreamJSONLines  = "jsonl"  // One JSON value per line
+	StreamJSONArray  = "array"  // A single JSON array, written element by element
+	StreamJSONObject = "object" // A single JSON object, written key by key
+)
+
+// StreamWriter encodes results one at a time so large result sets never have to be held in memory.
+// Each value is flushed to the underlying writer as it is written.
+type StreamWriter struct {
+	w      *bufio.Writer
+	format string
+	count  int
+	file   *AtomicFile  // Set when the stream was opened with CreateStream
+	gz     *gzip.Writer // Set when the stream is compressed
+	tail   string       // Written after the closing bracket, to end an enclosing object
+	closed bool
+}
+
+// NewStreamWriter starts a stream of the given format on w.
+func NewStreamWriter(w io.Writer, format string) (*StreamWriter, error) {
+	return newStreamWriter(w, format, "", "")
+}
+
+// newStreamWriter starts a stream enclosed in head and tail.
+func newStreamWriter(w io.Writer, format, head, tail string) (*StreamWriter, error) {
+	s := &StreamWriter{w: bufio.NewWriter(w), format: format, tail: tail}
+	s.w.WriteString(head)
+	switch format {
+	case StreamJSONLines:
+	case StreamJSONArray:
+		s.w.WriteString("[")
+	case StreamJSONObject:
+		s.w.WriteString("{")
+	default:
+		return nil, fmt.Errorf("unknown stream format: %s", format)
+	}
+	return s, nil
+}
+
+// CreateStream opens filename for streaming. The file is written atomically: it only appears under its
+// final name when Close succeeds. A file name ending in .gz is gzip compressed.
+func CreateStream(filename, format string) (*StreamWriter, error) {
+	return createStream(filename, format, "", "")
+}
+
+// CreateDatasetStream opens a scraped dataset for streaming. NDJSON file names get one item per line;
+// other names get the {"domain": ..., "data": [...]} layout of ItemData, written item by item.
+func CreateDatasetStream(filename, domain string) (*StreamWriter, error) {
+	if strings.HasSuffix(strings.TrimSuffix(filename, ".gz"), ".ndjson") {
+		return CreateStream(filename, StreamJSONLines)
+	}
+	domainData, err := json.Marshal(domain)
+	if err != nil {
+		return nil, err
+	}
+	return createStream(filename, StreamJSONArray, `{"domain":`+string(domainData)+`,"data":`, "}")
+}
+
+// createStream opens filename for a stream enclosed in head and tail.
+func createStream(filename, format, head, tail string) (*StreamWriter, error) {
+	file, err := CreateAtomic(filename)
+	if err != nil {
+		return nil, err
+	}
+	var w io.Writer = file
+	var gz *gzip.Writer
+	if isGzipName(filename) {
+		gz = gzip.NewWriter(file)
+		w = gz
+	}
+	s, err := newStreamWriter(w, format, head, tail)
+	if err != nil {
+		file.Abort()
+		return nil, err
+	}
+	s.file = file
+	s.gz = gz
+	return s, nil
+}
+
+// Write appends a value to a JSON Lines or array stream.
+func (s *StreamWriter) Write(v interface{}) error {
+	if s.format == StreamJSONObject {
+		return fmt.Errorf("object streams need a key, use WriteEntry")
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if s.format == StreamJSONArray && s.count > 0 {
+		s.w.WriteString(",")
+	}
+	s.w.Write(data)
+	if s.format == StreamJSONLines {
+		s.w.WriteString("\n")
+	}
+	s.count++
+	return s.w.Flush()
+}
+
+// WriteEntry appends a key and value to an object stream. If a key is written twice, JSON decoders keep
+// the last value.
+func (s *StreamWriter) WriteEntry(key string, v interface{}) error {
+	if s.format != StreamJSONObject {
+		return fmt.Errorf("WriteEntry needs an object stream, this stream is %s", s.format)
+	}
+	keyData, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if s.count > 0 {
+		s.w.WriteString(",")
+	}
+	s.w.Write(keyData)
+	s.w.WriteString(":")
+	s.w.Write(data)
+	s.count++
+	return s.w.Flush()
+}
+
+// Count returns the number of values written so far.
+func (s *StreamWriter) Count() int {
+	return s.count
+}
+
+// Close terminates the array or object and, for streams opened with CreateStream, publishes the file.
+func (s *StreamWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	switch s.format {
+	case StreamJSONArray:
+		s.w.WriteString("]")
+	case StreamJSONObject:
+		s.w.WriteString("}")
+	}
+	s.w.WriteString(s.tail)
+	if err := s.w.Flush(); err != nil {
+		s.Abort()
+		return err
+	}
+	if s.gz != nil {
+		if err := s.gz.Close(); err != nil {
+			s.Abort()
+			return err
+		}
+	}
+	if s.file != nil {
+		return s.file.Commit()
+	}
+	return nil
+}
+
+// Abort discards a stream opened with CreateStream without publishing it.
+func (s *StreamWriter) Abort() {
+	s.closed = true
+	if s.file != nil {
+		s.file.Abort()
+	}
+}
@@ -98,6 +98,8 @@ type DomainConfig struct {
 	DepreciationRatesSelector       string
 	ModelsLeastDepreciationSelector string
 	ModelsMostDepreciationSelector  string
+	Pagination                      PaginationConfig // How to reach the next page of a listing, if it has several
+	Form                            FormConfig       // Form to submit first, for scrapes of search results
 }
 
 // Metadata represents metadata for scraped data.
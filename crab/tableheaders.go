@@ -0,0 +1,159 @@
+package crab
+
+import (
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/text/unicode/norm"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// yearHeaders are the names of the year column of the table datasets.
+var yearHeaders = []string{"year", "yr", "jahr", "annee", "ano", "anno", "jaar"}
+
+// tableHeaders are the header names the table scrapers know the columns of their datasets by, by dataset
+// and column: English, German, French, Spanish, Italian, Portuguese and Dutch names and abbreviations, as
+// headerKey normalizes them. The table_headers settings add more.
+var tableHeaders = map[string]map[string][]string{
+	"inflation": {
+		"year": yearHeaders,
+		"jan":  {"jan", "january", "januar", "janvier", "janv", "ene", "enero", "gen", "gennaio", "janeiro", "januari"},
+		"feb":  {"feb", "february", "februar", "fevrier", "fev", "fevr", "febrero", "febbraio", "fevereiro", "februari"},
+		"mar":  {"mar", "march", "marz", "mrz", "mars", "marzo", "marco", "maart", "mrt"},
+		"apr":  {"apr", "april", "avril", "avr", "abr", "abril", "aprile"},
+		"may":  {"may", "mai", "mayo", "mag", "maggio", "maio", "mei"},
+		"jun":  {"jun", "june", "juni", "juin", "junio", "giu", "giugno", "junho"},
+		"july": {"jul", "july", "juli", "juil", "juillet", "julio", "lug", "luglio", "julho"},
+		"aug":  {"aug", "august", "aout", "ago", "agosto", "augustus"},
+		"sept": {"sep", "sept", "september", "septembre", "septiembre", "set", "settembre", "setembro"},
+		"oct":  {"oct", "october", "okt", "oktober", "octobre", "octubre", "ott", "ottobre", "out", "outubro"},
+		"nov":  {"nov", "november", "novembre", "noviembre", "novembro"},
+		"dec":  {"dec", "december", "dez", "dezember", "decembre", "dic", "diciembre", "dicembre", "dezembro"},
+		"avg": {"avg", "ave", "average", "annual", "annual average", "annual avg", "mean", "durchschnitt",
+			"jahresdurchschnitt", "moyenne", "moy", "moyenne annuelle", "promedio", "prom", "media", "media annua",
+			"media anual", "gemiddelde", "gem"},
+	},
+	"gasoline": {
+		"year": yearHeaders,
+		"average_gasoline_prices": {"average gasoline prices", "average gasoline price", "average gas prices",
+			"average gas price", "gasoline price", "gas price", "benzinpreis", "prix moyen de l essence",
+			"precio medio de la gasolina", "prezzo medio della benzina", "preco medio da gasolina"},
+		"average_annual_cpi_for_gas": {"average annual cpi for gas", "annual cpi for gas", "cpi for gas", "cpi",
+			"vpi", "ipc", "ipca"},
+		"gas_prices_adjusted_for_inflation": {"gas prices adjusted for inflation", "gas price adjusted for inflation",
+			"gasoline prices adjusted for inflation", "inflation adjusted price", "adjusted price", "real price",
+			"inflationsbereinigt", "prix corrige de l inflation", "precio ajustado por inflacion",
+			"prezzo corretto per l inflazione", "preco ajustado pela inflacao"},
+	},
+}
+
+// headerKey normalizes a header for matching: lower case, without accents, with every run of punctuation
+// and spaces made one space, so "Févr." and "fevr" match.
+func headerKey(header string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range norm.NFD.String(strings.ToLower(header)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// An accent, dropped
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		default:
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// tableHeaderColumns returns the columns of dataset by the keys of their header names, built in and
+// configured.
+func tableHeaderColumns(dataset string) map[string]string {
+	columns := map[string]string{}
+	add := func(names map[string][]string) {
+		for column, headers := range names {
+			for _, header := range headers {
+				columns[headerKey(header)] = column
+			}
+		}
+	}
+	add(tableHeaders[dataset])
+	add(CurrentConfig().TableHeaders[dataset]) // Configured names win
+	return columns
+}
+
+// MapTableHeaders returns the column of dataset under each of headers, "" for those it does not know. It
+// reports whether the headers are those of the dataset's table: more than half of them known, no column
+// twice. The headers of a column repeated are left unknown after the first.
+func MapTableHeaders(dataset string, headers []string) ([]string, bool) {
+	known := tableHeaderColumns(dataset)
+	columns := make([]string, len(headers))
+	seen := map[string]bool{}
+	matched := 0
+	for i, header := range headers {
+		column := known[headerKey(header)]
+		if column == "" || seen[column] {
+			continue
+		}
+		columns[i], seen[column] = column, true
+		matched++
+	}
+	return columns, matched*2 > len(headers)
+}
+
+// extractTable reads the rows of the table of doc into records, a pointer to a slice of structs, with the
+// cells of each row set to the fields of the dataset columns their header names, as the json tags of the
+// fields name them. Tables with headers in another language or another order map all the same, and on a
+// page of several tables the first whose headers are recognized is read. When none is, the cells of the
+// first table are read in the order of the fields, as the table of the site has them.
+func extractTable(doc *goquery.Document, dataset string, records interface{}) {
+	slice := reflect.ValueOf(records).Elem()
+	recordType := slice.Type().Elem()
+	fields := map[string]int{}
+	var positional []string
+	for i := 0; i < recordType.NumField(); i++ {
+		name, _, _ := strings.Cut(recordType.Field(i).Tag.Get("json"), ",")
+		fields[name] = i
+		positional = append(positional, name)
+	}
+
+	var columns, firstHeaders []string
+	var body, firstBody *goquery.Selection
+	doc.Find("table").EachWithBreak(func(_ int, table *goquery.Selection) bool {
+		headers, rows := tableHeaderRows(table)
+		if len(headers) == 0 {
+			return true
+		}
+		if mapped, ok := MapTableHeaders(dataset, headers); ok {
+			columns, body = mapped, rows
+			return false
+		}
+		if firstBody == nil {
+			firstHeaders, firstBody = headers, rows
+		}
+		return true
+	})
+	if body == nil {
+		if firstBody == nil {
+			return
+		}
+		warnf("The headers %q of the %s table are not known, reading its columns in order", firstHeaders, dataset)
+		columns, body = positional, firstBody
+	}
+
+	body.Each(func(_ int, row *goquery.Selection) {
+		record := reflect.New(recordType).Elem()
+		row.Find("th, td").Each(func(i int, cell *goquery.Selection) {
+			if i >= len(columns) {
+				return
+			}
+			if field, ok := fields[columns[i]]; ok {
+				record.Field(field).SetString(cell.Text())
+			}
+		})
+		slice.Set(reflect.Append(slice, record))
+	})
+}
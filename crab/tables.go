@@ -0,0 +1,231 @@
+package crab
+
+import (
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// tableTargetRegions is the region list of table targets: the tables and the headings naming them.
+var tableTargetRegions = []string{"table", "h1", "h2", "h3", "h4", "h5", "h6"}
+
+// TableTarget is a page holding several tables, e.g. annual and monthly figures, each scraped into a
+// dataset of its own in one run.
+type TableTarget struct {
+	Name   string       `json:"name"`
+	URL    string       `json:"url"`
+	Tables []NamedTable `json:"tables"`
+}
+
+// NamedTable picks one table of a TableTarget's page: the Index-th table (from 0) matching Selector
+// whose caption or heading contains Title. Its rows become records keyed by the names of its header
+// cells, lower case with underscores, e.g. "annual_average", and are written to Output.
+type NamedTable struct {
+	Name     string `json:"name"`
+	Selector string `json:"selector"` // CSS selector of the tables to pick from, "table" when empty
+	Title    string `json:"title"`    // Text the table's caption or the heading before it contains, any when empty
+	Index    int    `json:"index"`
+	Output   string `json:"output"` // Data file name, <name>_data.json when empty
+}
+
+// outputFile returns the name of the data file of the table.
+func (t NamedTable) outputFile() string {
+	if t.Output != "" {
+		return t.Output
+	}
+	return t.Name + "_data.json"
+}
+
+// outputFiles returns the data files the target writes, in the order of its tables.
+func (target TableTarget) outputFiles() []string {
+	files := make([]string, len(target.Tables))
+	for i, table := range target.Tables {
+		files[i] = table.outputFile()
+	}
+	return files
+}
+
+// tableTitle returns the caption of table, or else the text of the nearest heading before it.
+func tableTitle(table *goquery.Selection) string {
+	if caption := strings.TrimSpace(table.ChildrenFiltered("caption").First().Text()); caption != "" {
+		return caption
+	}
+	const headings = "h1, h2, h3, h4, h5, h6"
+	for node := table; node.Length() > 0 && !node.Is("body"); node = node.Parent() {
+		for prev := node.Prev(); prev.Length() > 0; prev = prev.Prev() {
+			if prev.Is(headings) {
+				return strings.TrimSpace(prev.Text())
+			}
+			if heading := prev.Find(headings).Last(); heading.Length() > 0 {
+				return strings.TrimSpace(heading.Text())
+			}
+		}
+	}
+	return ""
+}
+
+// FindTable returns the table of doc that named picks, or an error naming it when there is none.
+func FindTable(doc *goquery.Document, named NamedTable) (*goquery.Selection, error) {
+	selector := named.Selector
+	if selector == "" {
+		selector = "table"
+	}
+	title := headerKey(named.Title)
+	var matches []*goquery.Selection
+	doc.Find(selector).Each(func(_ int, table *goquery.Selection) {
+		if title == "" || strings.Contains(headerKey(tableTitle(table)), title) {
+			matches = append(matches, table)
+		}
+	})
+	if named.Index < 0 || named.Index >= len(matches) {
+		return nil, fmt.Errorf("table %s: %d tables match %q titled %q, none at index %d", named.Name, len(matches), selector, named.Title, named.Index)
+	}
+	return matches[named.Index], nil
+}
+
+// tableHeaderRows splits the rows of table into its header cells and body rows: the first row of its
+// thead, or else its first row.
+func tableHeaderRows(table *goquery.Selection) ([]string, *goquery.Selection) {
+	header := table.Find("thead tr").First()
+	body := table.Find("tbody tr")
+	if header.Length() == 0 {
+		header, body = body.First(), body.Slice(1, goquery.ToEnd)
+	}
+	var headers []string
+	header.Find("th, td").Each(func(_ int, cell *goquery.Selection) {
+		headers = append(headers, strings.TrimSpace(cell.Text()))
+	})
+	return headers, body
+}
+
+// tableColumnNames names the columns of a table after its header cells, lower case with underscores.
+// Columns without a header are named column_<n> from 1, and repeated names get a _<n> suffix.
+func tableColumnNames(headers []string) []string {
+	columns := make([]string, len(headers))
+	seen := map[string]int{}
+	for i, header := range headers {
+		column := strings.ReplaceAll(headerKey(header), " ", "_")
+		if column == "" {
+			column = fmt.Sprintf("column_%d", i+1)
+		}
+		if seen[column]++; seen[column] > 1 {
+			column = fmt.Sprintf("%s_%d", column, seen[column])
+		}
+		columns[i] = column
+	}
+	return columns
+}
+
+// ExtractTableRecords reads the body rows of table into records keyed by the names of its columns (see
+// NamedTable). Cells past the header are dropped and missing ones are empty.
+func ExtractTableRecords(table *goquery.Selection) []map[string]interface{} {
+	headers, body := tableHeaderRows(table)
+	columns := tableColumnNames(headers)
+	records := []map[string]interface{}{}
+	body.Each(func(_ int, row *goquery.Selection) {
+		record := make(map[string]interface{}, len(columns))
+		for _, column := range columns {
+			record[column] = ""
+		}
+		row.Find("th, td").Each(func(i int, cell *goquery.Selection) {
+			if i < len(columns) {
+				record[columns[i]] = strings.Join(strings.Fields(cell.Text()), " ")
+			}
+		})
+		records = append(records, record)
+	})
+	return records
+}
+
+// ScrapeTableTarget fetches the page of target once and extracts each of its tables, by table name. The
+// tables found are returned even when others are missing, with an error naming those.
+func ScrapeTableTarget(target TableTarget, client *http.Client) (map[string][]map[string]interface{}, error) {
+	if len(target.Tables) == 0 {
+		return nil, fmt.Errorf("table target %s has no tables", target.Name)
+	}
+	seen := map[string]bool{}
+	for _, table := range target.Tables {
+		if table.Name == "" {
+			return nil, fmt.Errorf("table target %s has a table without a name", target.Name)
+		}
+		if seen[table.outputFile()] {
+			return nil, fmt.Errorf("table target %s writes %s twice", target.Name, table.outputFile())
+		}
+		seen[table.outputFile()] = true
+	}
+	if client == nil {
+		client = scraperClient
+	}
+	doc, err := fetchScraperDocument(client, target.URL, tableTargetRegions...)
+	if err != nil {
+		return nil, err
+	}
+	tables := map[string][]map[string]interface{}{}
+	var missing []string
+	for _, named := range target.Tables {
+		table, err := FindTable(doc, named)
+		if err != nil {
+			log.Printf("Table target %s: %v", target.Name, err)
+			missing = append(missing, named.Name)
+			continue
+		}
+		tables[named.Name] = ExtractTableRecords(table)
+	}
+	if len(missing) > 0 {
+		return tables, fmt.Errorf("table target %s: no table %s on %s", target.Name, strings.Join(missing, ", "), target.URL)
+	}
+	return tables, nil
+}
+
+// RunTableTarget scrapes a table target into one run, writing each table to its own data file, and
+// notifies webhooks.
+func RunTableTarget(target TableTarget) error {
+	summary := RunSummary{Kind: "scrape", Name: target.Name, StartedAt: time.Now()}
+	run, err := StartRun("scrape")
+	if err != nil {
+		log.Printf("Error starting run, writing to the working directory: %v", err)
+	}
+	summary.RunID = run.RunID()
+
+	tables, err := ScrapeTableTarget(target, nil)
+	for _, named := range target.Tables {
+		records, ok := tables[named.Name]
+		if !ok {
+			continue
+		}
+		outputs, stats, writeErr := writeTargetRecords(named.Name, run.Path(named.outputFile()), records, summary.RunID)
+		summary.Outputs = append(summary.Outputs, outputs...)
+		if writeErr != nil {
+			log.Printf("Error saving data to JSON file: %v", writeErr)
+			if err == nil {
+				err = writeErr
+			}
+			continue
+		}
+		summary.Items += len(records)
+		summary.Datasets = append(summary.Datasets, stats)
+	}
+
+	summary.FinishedAt = time.Now()
+	summary.Event = EventCompleted
+	if err != nil {
+		summary.Event = EventFailed
+		summary.Error = err.Error()
+	}
+	run.finishReported(&summary)
+	reportRun(CurrentConfig(), summary)
+	return err
+}
+
+// findTableTarget returns the configured table target with the given name.
+func findTableTarget(name string) (TableTarget, bool) {
+	for _, target := range CurrentConfig().TableTargets {
+		if target.Name == name {
+			return target, true
+		}
+	}
+	return TableTarget{}, false
+}
@@ -0,0 +1,107 @@
+package crab
+
+import (
+	"cmpscfa23team2/telemetry"
+	"github.com/gocolly/colly"
+	"log"
+)
+
+// TelemetryConfig exports OpenTelemetry spans of crawls, scrapes and database operations; see
+// telemetry.Config.
+type TelemetryConfig = telemetry.Config
+
+// Spans are those of the telemetry package, which the dal traces its writes with too.
+type (
+	SpanContext = telemetry.SpanContext
+	Span        = telemetry.Span
+)
+
+// ParseTraceParent reads a W3C traceparent value. Invalid values give the zero context.
+func ParseTraceParent(value string) SpanContext {
+	return telemetry.ParseTraceParent(value)
+}
+
+// StartSpan starts a span as a child of parent, or as the root of a new trace when parent is the zero
+// context. It returns nil when telemetry is off.
+func StartSpan(parent SpanContext, name string) *Span {
+	return telemetry.StartSpan(parent, name)
+}
+
+// FlushTelemetry sends the spans ended so far to the configured collector.
+func FlushTelemetry() error {
+	return telemetry.Flush()
+}
+
+// startRunSpan starts the root span of a crawl or scrape run. Pages crawled during the run become its
+// children.
+func startRunSpan(name, runID string) *Span {
+	span := StartSpan(SpanContext{}, name)
+	span.SetAttribute("crab.run_id", runID)
+	return span
+}
+
+// endRunSpan ends a run's root span and exports the run's spans.
+func endRunSpan(span *Span) {
+	if span == nil {
+		return
+	}
+	span.End()
+	if err := FlushTelemetry(); err != nil {
+		log.Printf("Error exporting spans: %v", err)
+	}
+}
+
+// traceParentKey is the colly context key holding the traceparent of the span a request belongs to,
+// for layers that write data about the page, such as the snapshot store.
+const traceParentKey = "traceparent"
+
+// AttachTelemetry records a "fetch" span for each request of the collector and an "extract" span for the
+// processing of each response, both children of parent.
+func AttachTelemetry(c *colly.Collector, parent *Span) {
+	if parent == nil {
+		return
+	}
+	attachTelemetry(c, func() *Span { return parent })
+}
+
+// attachTelemetry is AttachTelemetry for collectors that fetch under a different parent span from one
+// request to the next. Requests made while parent returns nil export no spans.
+func attachTelemetry(c *colly.Collector, parent func() *Span) {
+	c.OnRequest(func(r *colly.Request) {
+		parent := parent()
+		if parent == nil {
+			return
+		}
+		fetch := telemetry.StartClientSpan(parent.Context(), "fetch")
+		fetch.SetAttribute("http.method", r.Method)
+		fetch.SetAttribute("http.url", r.URL.String())
+		r.Ctx.Put("otel_fetch", fetch)
+		r.Ctx.Put(traceParentKey, parent.Context().TraceParent())
+	})
+	c.OnResponse(func(r *colly.Response) {
+		if fetch, ok := r.Ctx.GetAny("otel_fetch").(*Span); ok {
+			fetch.SetAttribute("http.status_code", r.StatusCode)
+			fetch.SetAttribute("http.response_content_length", len(r.Body))
+			fetch.End()
+		}
+		parent := parent()
+		if parent == nil {
+			return
+		}
+		extract := StartSpan(parent.Context(), "extract")
+		extract.SetAttribute("http.url", r.Request.URL.String())
+		r.Ctx.Put("otel_extract", extract)
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		if fetch, ok := r.Ctx.GetAny("otel_fetch").(*Span); ok {
+			fetch.SetAttribute("http.status_code", r.StatusCode)
+			fetch.RecordError(err)
+			fetch.End()
+		}
+	})
+	c.OnScraped(func(r *colly.Response) {
+		if extract, ok := r.Ctx.GetAny("otel_extract").(*Span); ok {
+			extract.End()
+		}
+	})
+}
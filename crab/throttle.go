@@ -0,0 +1,178 @@
+package crab
+
+import (
+	"expvar"
+	"github.com/gocolly/colly"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCooldown is used when a 429/503 response carries no usable Retry-After header.
+	defaultCooldown = 30 * time.Second
+	// minThrottleInterval is the spacing applied after the first throttled response.
+	minThrottleInterval = time.Second
+	// maxThrottleInterval caps how far a domain's request rate can be reduced.
+	maxThrottleInterval = 5 * time.Minute
+)
+
+// throttleMetrics publishes the throttle state of every domain under /debug/vars as "crab_throttle".
+// Each domain has "<host>.interval_ms" (current spacing between requests), "<host>.throttled" (429/503
+// responses seen) and "<host>.cooldown_until" (unix time the current cooldown ends).
+var throttleMetrics = expvar.NewMap("crab_throttle")
+
+// Throttle adapts the request rate of each domain to the 429 and 503 responses it returns. A throttled
+// domain is paused until its Retry-After time and then spaced out by an interval that doubles on every
+// further rejection and halves on every successful response until it is back to full speed.
+type Throttle struct {
+	mu      sync.Mutex
+	domains map[string]*domainThrottle
+}
+
+type domainThrottle struct {
+	interval      time.Duration
+	cooldownUntil time.Time
+	nextRequest   time.Time
+}
+
+// DefaultThrottle is shared by all crawlers and scrapers so a rejection seen by one applies to all.
+var DefaultThrottle = NewThrottle()
+
+// NewThrottle creates a throttle with no domains limited.
+func NewThrottle() *Throttle {
+	return &Throttle{domains: make(map[string]*domainThrottle)}
+}
+
+// Delay reserves the next request slot for host and returns how long the caller must wait for it.
+func (t *Throttle) Delay(host string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d, ok := t.domains[host]
+	if !ok {
+		return 0
+	}
+
+	now := time.Now()
+	start := now
+	if d.cooldownUntil.After(start) {
+		start = d.cooldownUntil
+	}
+	if d.nextRequest.After(start) {
+		start = d.nextRequest
+	}
+	d.nextRequest = start.Add(d.interval)
+	return start.Sub(now)
+}
+
+// Wait blocks until host may be requested again.
+func (t *Throttle) Wait(host string) {
+	if delay := t.Delay(host); delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// Observe records a response from host. A 429 or 503 starts a cooldown and slows the domain down; any
+// other response after the cooldown has passed speeds it back up.
+func (t *Throttle) Observe(host string, statusCode int, header http.Header) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d, ok := t.domains[host]
+
+	if statusCode != http.StatusTooManyRequests && statusCode != http.StatusServiceUnavailable {
+		if !ok || time.Now().Before(d.cooldownUntil) {
+			return
+		}
+		d.interval /= 2
+		if d.interval < minThrottleInterval {
+			delete(t.domains, host)
+			log.Printf("Throttle lifted for %s", host)
+			throttleMetrics.Set(host+".interval_ms", new(expvar.Int))
+			return
+		}
+		setThrottleInterval(host, d.interval)
+		return
+	}
+
+	if !ok {
+		d = &domainThrottle{}
+		t.domains[host] = d
+	}
+	cooldown, ok := ParseRetryAfter(header.Get("Retry-After"), time.Now())
+	if !ok {
+		cooldown = defaultCooldown
+	}
+	d.cooldownUntil = time.Now().Add(cooldown)
+	d.interval *= 2
+	if d.interval < minThrottleInterval {
+		d.interval = minThrottleInterval
+	}
+	if d.interval > maxThrottleInterval {
+		d.interval = maxThrottleInterval
+	}
+	log.Printf("%s returned %d, pausing for %s then spacing requests %s apart", host, statusCode, cooldown, d.interval)
+
+	throttleMetrics.Add(host+".throttled", 1)
+	setThrottleInterval(host, d.interval)
+	cooldownUntil := new(expvar.Int)
+	cooldownUntil.Set(d.cooldownUntil.Unix())
+	throttleMetrics.Set(host+".cooldown_until", cooldownUntil)
+}
+
+// Interval returns the current spacing between requests to host; zero means it is not throttled.
+func (t *Throttle) Interval(host string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if d, ok := t.domains[host]; ok {
+		return d.interval
+	}
+	return 0
+}
+
+// Attach hooks the throttle into a collector so every request waits for its domain and every
+// response adjusts it.
+func (t *Throttle) Attach(c *colly.Collector) {
+	c.OnRequest(func(r *colly.Request) {
+		t.Wait(r.URL.Host)
+	})
+	observe := func(r *colly.Response) {
+		var header http.Header
+		if r.Headers != nil {
+			header = *r.Headers
+		}
+		t.Observe(r.Request.URL.Host, r.StatusCode, header)
+	}
+	c.OnResponse(observe)
+	c.OnError(func(r *colly.Response, err error) {
+		if r != nil && r.Request != nil {
+			observe(r)
+		}
+	})
+}
+
+// ParseRetryAfter converts a Retry-After header value (delay in seconds or an HTTP date) into a
+// duration relative to now. ok is false when the value is missing or invalid.
+func ParseRetryAfter(value string, now time.Time) (delay time.Duration, ok bool) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if date.Before(now) {
+			return 0, true
+		}
+		return date.Sub(now), true
+	}
+	return 0, false
+}
+
+// setThrottleInterval publishes the interval of host in milliseconds.
+func setThrottleInterval(host string, interval time.Duration) {
+	v := new(expvar.Int)
+	v.Set(interval.Milliseconds())
+	throttleMetrics.Set(host+".interval_ms", v)
+}
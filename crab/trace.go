@@ -0,0 +1,269 @@
+package crab
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"github.com/gocolly/colly"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// TraceConfig turns on the crawl trace: a per-request timeline of DNS lookup, connect, TLS handshake,
+// time to first byte, download, parse and store, written to trace.json in the run directory in the Chrome
+// trace event format. Open it in chrome://tracing or https://ui.perfetto.dev to see where a slow crawl
+// spends its time.
+type TraceConfig struct {
+	Enabled bool `json:"enabled"`
+}
+
+// TraceEvent is one complete ("X") event of the Chrome trace event format. Times are in microseconds
+// since the trace started; each request gets its own thread lane.
+type TraceEvent struct {
+	Name      string                 `json:"name"`
+	Category  string                 `json:"cat"`
+	Phase     string                 `json:"ph"`
+	Timestamp int64                  `json:"ts"`
+	Duration  int64                  `json:"dur"`
+	PID       int                    `json:"pid"`
+	TID       int                    `json:"tid"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// Tracer collects the timeline of one run. A nil *Tracer records nothing, so callers need not check
+// whether tracing is on.
+type Tracer struct {
+	start time.Time
+
+	mu     sync.Mutex
+	events []TraceEvent
+	lanes  map[string]int // Lane of the latest request for each URL, to place its parse span
+	next   int
+}
+
+// NewTracer returns a tracer whose timeline starts now.
+func NewTracer() *Tracer {
+	return &Tracer{start: time.Now(), lanes: map[string]int{}, next: 1}
+}
+
+// Span records an event that ran from start to end on the given lane. Lane 0 is the run itself.
+func (t *Tracer) Span(name, category string, lane int, start, end time.Time, args map[string]interface{}) {
+	if t == nil || start.IsZero() || end.Before(start) {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, TraceEvent{
+		Name:      name,
+		Category:  category,
+		Phase:     "X",
+		Timestamp: start.Sub(t.start).Microseconds(),
+		Duration:  end.Sub(start).Microseconds(),
+		PID:       1,
+		TID:       lane,
+		Args:      args,
+	})
+}
+
+// Region starts a span on the run's lane and returns the function that ends it, e.g.
+// defer tracer.Region("store", "siteMap.json")().
+func (t *Tracer) Region(name, detail string) func() {
+	start := time.Now()
+	return func() {
+		t.Span(name, "run", 0, start, time.Now(), map[string]interface{}{"detail": detail})
+	}
+}
+
+// Events returns the events recorded so far.
+func (t *Tracer) Events() []TraceEvent {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]TraceEvent(nil), t.events...)
+}
+
+// WriteFile writes the timeline as a Chrome trace file.
+func (t *Tracer) WriteFile(filename string) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"traceEvents":     t.Events(),
+		"displayTimeUnit": "ms",
+	})
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(filename, data)
+}
+
+// newLane assigns a lane to a request of rawURL.
+func (t *Tracer) newLane(rawURL string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lane := t.next
+	t.next++
+	t.lanes[rawURL] = lane
+	return lane
+}
+
+// lane returns the lane of the latest request of rawURL.
+func (t *Tracer) lane(rawURL string) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lane, ok := t.lanes[rawURL]
+	return lane, ok
+}
+
+// Transport wraps next so every request it sends is traced. next is the crawl transport, which goes
+// through the configured proxies, when nil.
+func (t *Tracer) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = crawlTransport()
+	}
+	if t == nil {
+		return next
+	}
+	return &tracingTransport{tracer: t, next: next}
+}
+
+// Attach traces the collector's requests and the parsing of each response.
+func (t *Tracer) Attach(c *colly.Collector) {
+	if t == nil {
+		return
+	}
+	c.WithTransport(t.Transport(nil))
+	var mu sync.Mutex
+	parsing := map[*colly.Request]time.Time{}
+	c.OnResponse(func(r *colly.Response) {
+		mu.Lock()
+		parsing[r.Request] = time.Now()
+		mu.Unlock()
+	})
+	c.OnScraped(func(r *colly.Response) {
+		mu.Lock()
+		start := parsing[r.Request]
+		delete(parsing, r.Request)
+		mu.Unlock()
+		t.traceParse(r.Request.URL.String(), start)
+	})
+}
+
+// traceParse records the parsing of the response for rawURL, from start until now.
+func (t *Tracer) traceParse(rawURL string, start time.Time) {
+	if lane, ok := t.lane(rawURL); ok {
+		t.Span("parse", "request", lane, start, time.Now(), nil)
+	}
+}
+
+// tracingTransport records the phases of each request with httptrace.
+type tracingTransport struct {
+	tracer *Tracer
+	next   http.RoundTripper
+}
+
+// requestTimes are the moments httptrace reports for one request.
+type requestTimes struct {
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wroteRequest, firstByte   time.Time
+	reused                    bool
+}
+
+func (rt *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	lane := rt.tracer.newLane(req.URL.String())
+	var mu sync.Mutex // httptrace may call back from other goroutines
+	times := &requestTimes{}
+	set := func(field *time.Time) {
+		mu.Lock()
+		*field = time.Now()
+		mu.Unlock()
+	}
+	trace := &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { set(&times.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { set(&times.dnsDone) },
+		ConnectStart:      func(string, string) { set(&times.connectStart) },
+		ConnectDone:       func(string, string, error) { set(&times.connectDone) },
+		TLSHandshakeStart: func() { set(&times.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { set(&times.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			mu.Lock()
+			times.reused = info.Reused
+			mu.Unlock()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { set(&times.wroteRequest) },
+		GotFirstResponseByte: func() { set(&times.firstByte) },
+	}
+
+	start := time.Now()
+	resp, err := rt.next.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	mu.Lock()
+	t := *times
+	mu.Unlock()
+	tracer := rt.tracer
+	tracer.Span("dns", "request", lane, t.dnsStart, t.dnsDone, nil)
+	tracer.Span("connect", "request", lane, t.connectStart, t.connectDone, nil)
+	tracer.Span("tls", "request", lane, t.tlsStart, t.tlsDone, nil)
+	tracer.Span("ttfb", "request", lane, t.wroteRequest, t.firstByte, nil)
+
+	args := map[string]interface{}{"url": req.URL.String(), "method": req.Method, "reused_connection": t.reused}
+	if err != nil {
+		args["error"] = err.Error()
+		tracer.Span("request", "request", lane, start, time.Now(), args)
+		return nil, err
+	}
+	args["status"] = resp.StatusCode
+	downloadStart := t.firstByte
+	if downloadStart.IsZero() {
+		downloadStart = time.Now()
+	}
+	resp.Body = &tracedBody{ReadCloser: resp.Body, done: func(n int64) {
+		end := time.Now()
+		args["bytes"] = n
+		tracer.Span("download", "request", lane, downloadStart, end, nil)
+		tracer.Span("request", "request", lane, start, end, args)
+	}}
+	return resp, nil
+}
+
+// tracedBody reports how many bytes were read once the body is closed.
+type tracedBody struct {
+	io.ReadCloser
+	n    int64
+	once sync.Once
+	done func(n int64)
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.done(b.n) })
+	return err
+}
+
+// beginTrace returns the tracer of a run when config enables the trace, or nil. The crawl hands it to its
+// fetches and parses rather than through the process, so crawls running at once keep their own timelines.
+func beginTrace(config TraceConfig) *Tracer {
+	if !config.Enabled {
+		return nil
+	}
+	return NewTracer()
+}
+
+// endTrace writes the run's trace.json.
+func endTrace(tracer *Tracer, run *Run) {
+	if tracer == nil {
+		return
+	}
+	if err := tracer.WriteFile(run.Path("trace.json")); err != nil {
+		log.Printf("Error writing trace: %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package crab
+
+import (
+	"expvar"
+	"hash/fnv"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The heuristics that tell a crawler trap, as reported in RunSummary.Traps.
+const (
+	TrapURLLength        = "url-length"        // The URL is longer than MaxURLLength
+	TrapRepeatedSegments = "repeated-segments" // A path segment repeats more than MaxSegmentRepeats times
+	TrapCalendar         = "calendar"          // The URL is a date too far out, as calendars link forever
+	TrapDirectoryCap     = "directory-cap"     // The directory already gave MaxPagesPerDirectory URLs
+)
+
+// TrapConfig keeps crawls out of crawler traps: URLs that grow without end, paths that repeat themselves
+// as relative links are resolved against them, calendars that link to the next month forever, and
+// directories that generate pages without limit. URLs caught by a heuristic are neither crawled nor
+// passed on as links, and are counted by domain in the crawl report. Zero limits take the defaults, except
+// that without a FirstCalendarYear a crawl lets dates go back to the first year of the series it backfills.
+type TrapConfig struct {
+	Enabled              bool `json:"enabled"`
+	MaxURLLength         int  `json:"max_url_length"`          // defaultMaxURLLength when zero
+	MaxSegmentRepeats    int  `json:"max_segment_repeats"`     // defaultMaxSegmentRepeats when zero
+	CalendarYears        int  `json:"calendar_years"`          // Years ahead a date may be; defaultCalendarYears when zero
+	FirstCalendarYear    int  `json:"first_calendar_year"`     // Earliest year a date may be; defaultFirstCalendarYear when zero
+	MaxPagesPerDirectory int  `json:"max_pages_per_directory"` // defaultMaxPagesPerDirectory when zero
+}
+
+const (
+	defaultMaxURLLength         = 2048
+	defaultMaxSegmentRepeats    = 3
+	defaultCalendarYears        = 2
+	defaultMaxPagesPerDirectory = 1000
+	// defaultFirstCalendarYear is the earliest year a date in a URL may be; calendars also link backwards forever.
+	defaultFirstCalendarYear = 1990
+)
+
+// trapMetrics counts the URLs caught by each heuristic.
+var trapMetrics = expvar.NewMap("crab_traps")
+
+// calendarDate matches the dates of calendar URLs, e.g. "2031-04" or "2031/04/17".
+var calendarDate = regexp.MustCompile(`(?:^|[^0-9])((?:19|2[0-9])[0-9]{2})[-/](?:0?[1-9]|1[0-2])(?:$|[^0-9])`)
+
+// calendarParams are the query parameters calendars keep a year in.
+var calendarParams = map[string]bool{"year": true, "y": true, "yr": true}
+
+// TrapDetector applies the trap heuristics to the URLs of one crawl. Its methods are safe for concurrent
+// use, and a nil TrapDetector lets every URL through.
+type TrapDetector struct {
+	config TrapConfig
+	now    time.Time
+
+	mu          sync.Mutex
+	checked     map[uint64]string         // Heuristic that caught each URL checked by URL hash, "" for none
+	directories map[string]int            // URLs let through by directory
+	detections  map[string]map[string]int // URLs caught by domain and heuristic
+}
+
+// NewTrapDetector returns a detector with config's limits, taking the defaults for the zero ones.
+func NewTrapDetector(config TrapConfig) *TrapDetector {
+	if config.MaxURLLength <= 0 {
+		config.MaxURLLength = defaultMaxURLLength
+	}
+	if config.MaxSegmentRepeats <= 0 {
+		config.MaxSegmentRepeats = defaultMaxSegmentRepeats
+	}
+	if config.CalendarYears <= 0 {
+		config.CalendarYears = defaultCalendarYears
+	}
+	if config.MaxPagesPerDirectory <= 0 {
+		config.MaxPagesPerDirectory = defaultMaxPagesPerDirectory
+	}
+	if config.FirstCalendarYear <= 0 {
+		config.FirstCalendarYear = defaultFirstCalendarYear
+	}
+	return &TrapDetector{
+		config:      config,
+		now:         time.Now(),
+		checked:     map[uint64]string{},
+		directories: map[string]int{},
+		detections:  map[string]map[string]int{},
+	}
+}
+
+// Check returns the heuristic that catches rawURL as a trap, or "" when it may be crawled. A URL let
+// through counts towards its directory's cap once, however often it is checked.
+func (d *TrapDetector) Check(rawURL string) string {
+	if d == nil {
+		return ""
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	h := fnv.New64a()
+	h.Write([]byte(rawURL))
+	key := h.Sum64()
+	if trap, ok := d.checked[key]; ok {
+		return trap
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	trap := d.trap(rawURL, u)
+	if trap == "" {
+		urlPath := u.EscapedPath()
+		directory := strings.ToLower(u.Host) + urlPath[:strings.LastIndex(urlPath, "/")+1]
+		if d.directories[directory] >= d.config.MaxPagesPerDirectory {
+			trap = TrapDirectoryCap
+		} else {
+			d.directories[directory]++
+		}
+	}
+	d.checked[key] = trap
+	if trap != "" {
+		domain := strings.ToLower(u.Hostname())
+		if d.detections[domain] == nil {
+			d.detections[domain] = map[string]int{}
+		}
+		d.detections[domain][trap]++
+		trapMetrics.Add(trap, 1)
+	}
+	return trap
+}
+
+// trap applies the heuristics that look at the URL alone.
+func (d *TrapDetector) trap(rawURL string, u *url.URL) string {
+	if len(rawURL) > d.config.MaxURLLength {
+		return TrapURLLength
+	}
+	repeats := map[string]int{}
+	for _, segment := range strings.Split(u.EscapedPath(), "/") {
+		if segment == "" {
+			continue
+		}
+		if repeats[segment]++; repeats[segment] > d.config.MaxSegmentRepeats {
+			return TrapRepeatedSegments
+		}
+	}
+	if d.outsideCalendar(u) {
+		return TrapCalendar
+	}
+	return ""
+}
+
+// outsideCalendar reports whether u has a date in its path or query before FirstCalendarYear or more than
+// CalendarYears after the current year.
+func (d *TrapDetector) outsideCalendar(u *url.URL) bool {
+	var years []int
+	for _, match := range calendarDate.FindAllStringSubmatch(u.EscapedPath()+"?"+u.RawQuery, -1) {
+		year, _ := strconv.Atoi(match[1])
+		years = append(years, year)
+	}
+	for name, values := range u.Query() {
+		if !calendarParams[strings.ToLower(name)] {
+			continue
+		}
+		for _, value := range values {
+			if year, err := strconv.Atoi(value); err == nil {
+				years = append(years, year)
+			}
+		}
+	}
+	for _, year := range years {
+		if year < d.config.FirstCalendarYear || year > d.now.Year()+d.config.CalendarYears {
+			return true
+		}
+	}
+	return false
+}
+
+// Detections returns the URLs caught so far by domain and heuristic, or nil when there were none.
+func (d *TrapDetector) Detections() map[string]map[string]int {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.detections) == 0 {
+		return nil
+	}
+	detections := make(map[string]map[string]int, len(d.detections))
+	for domain, traps := range d.detections {
+		detections[domain] = make(map[string]int, len(traps))
+		for trap, count := range traps {
+			detections[domain][trap] = count
+		}
+	}
+	return detections
+}
+
+// beginTraps returns the trap detector of a crawl when settings enable trap detection, or nil. The crawl
+// hands it to its frontier and parses, so the counts of crawls running at once stay apart. Without a
+// FirstCalendarYear, dates go back to the earliest year the crawl backfills when that is before
+// defaultFirstCalendarYear, so the archive pages of a backfill are not taken for a calendar.
+func beginTraps(settings Config) *TrapDetector {
+	config := settings.Traps
+	if !config.Enabled {
+		return nil
+	}
+	if config.FirstCalendarYear <= 0 {
+		config.FirstCalendarYear = defaultFirstCalendarYear
+		for _, backfill := range settings.Backfill {
+			from := backfill.From
+			if from <= 0 {
+				from = defaultBackfillFrom
+			}
+			if from < config.FirstCalendarYear {
+				config.FirstCalendarYear = from
+			}
+		}
+	}
+	return NewTrapDetector(config)
+}
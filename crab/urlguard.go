@@ -0,0 +1,266 @@
+package crab
+
+import (
+	"context"
+	"fmt"
+	"github.com/gocolly/colly"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// URLGuardConfig protects the machine the crawler runs on, and its network, from crawl targets that come
+// from users, such as the URLs of API jobs. With the guard enabled, only http and https URLs are crawled,
+// and no request may reach a loopback, private, link-local or other internal address, including cloud
+// metadata endpoints such as 169.254.169.254. The addresses are checked when connecting, so neither a
+// redirect nor a host name that resolves to an internal address gets around the guard. Through a proxy,
+// only the proxy's address is checked when connecting; CheckTargetURLs still vets the URLs given.
+//
+// Allow lets intentional internal crawling through: each entry is an IP address, a CIDR range such as
+// "10.1.0.0/16", or a host name glob such as "*.intranet.example.com".
+type URLGuardConfig struct {
+	Enabled bool     `json:"enabled"`
+	Allow   []string `json:"allow"`
+}
+
+// BlockedAddressError is the error of a request the URL guard refused.
+type BlockedAddressError struct {
+	Target string // The URL, host or address refused
+	Reason string
+}
+
+func (e *BlockedAddressError) Error() string {
+	return fmt.Sprintf("blocked %s: %s", e.Target, e.Reason)
+}
+
+// metadataHosts are the host names of cloud metadata endpoints, blocked before they are resolved.
+var metadataHosts = map[string]bool{
+	"metadata":                 true,
+	"metadata.google.internal": true,
+	"metadata.azure.internal":  true,
+	"instance-data":            true,
+}
+
+// internalNetworks are the ranges a guarded request may not reach, besides the loopback, private,
+// link-local, multicast and unspecified addresses the net package recognizes.
+var internalNetworks = parseCIDRs(
+	"0.0.0.0/8",     // "This" network
+	"100.64.0.0/10", // Carrier-grade NAT, which also holds Alibaba Cloud's metadata endpoint
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // Benchmarking
+	"240.0.0.0/4",   // Reserved, and broadcast
+	"64:ff9b::/96",  // IPv4/IPv6 translation, which can reach any IPv4 address
+	"2001:db8::/32", // Documentation
+)
+
+// parseCIDRs parses CIDR ranges known to be valid.
+func parseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, networks[i], _ = net.ParseCIDR(cidr)
+	}
+	return networks
+}
+
+// internalAddress returns why ip is internal, or "" when it is a public address.
+func internalAddress(ip net.IP) string {
+	switch {
+	case ip.IsLoopback():
+		return "loopback address"
+	case ip.IsPrivate():
+		return "private address"
+	case ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		return "link-local address"
+	case ip.IsMulticast(), ip.IsInterfaceLocalMulticast():
+		return "multicast address"
+	case ip.IsUnspecified():
+		return "unspecified address"
+	}
+	for _, network := range internalNetworks {
+		if network.Contains(ip) {
+			return "reserved address " + network.String()
+		}
+	}
+	return ""
+}
+
+// allowsHost reports whether the allowlist lets host through.
+func (c URLGuardConfig) allowsHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range c.Allow {
+		if ok, _ := path.Match(strings.ToLower(allowed), host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsIP reports whether the allowlist lets ip through.
+func (c URLGuardConfig) allowsIP(ip net.IP) bool {
+	for _, allowed := range c.Allow {
+		if _, network, err := net.ParseCIDR(allowed); err == nil && network.Contains(ip) {
+			return true
+		}
+		if allowedIP := net.ParseIP(allowed); allowedIP != nil && allowedIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIP returns an error when the guard refuses connections to ip.
+func (c URLGuardConfig) checkIP(ip net.IP) error {
+	if reason := internalAddress(ip); reason != "" && !c.allowsIP(ip) {
+		return &BlockedAddressError{Target: ip.String(), Reason: reason}
+	}
+	return nil
+}
+
+// CheckURL returns an error when the guard refuses rawURL: when it is not an http or https URL, names a
+// metadata endpoint, or its host resolves to an internal address. It checks the URL whether or not the
+// guard is enabled, so a URL can be vetted before it is queued.
+func (c URLGuardConfig) CheckURL(ctx context.Context, rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if scheme := strings.ToLower(target.Scheme); scheme != "http" && scheme != "https" {
+		return &BlockedAddressError{Target: rawURL, Reason: fmt.Sprintf("scheme %q is not http or https", target.Scheme)}
+	}
+	host := target.Hostname()
+	if host == "" {
+		return fmt.Errorf("invalid URL, no host found: %s", rawURL)
+	}
+	if c.allowsHost(host) {
+		return nil
+	}
+	if metadataHosts[strings.ToLower(strings.TrimSuffix(host, "."))] {
+		return &BlockedAddressError{Target: rawURL, Reason: "cloud metadata endpoint"}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return c.checkIP(ip)
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if err := c.checkIP(addr.IP); err != nil {
+			return &BlockedAddressError{Target: rawURL, Reason: fmt.Sprintf("%s resolves to %v", host, err)}
+		}
+	}
+	return nil
+}
+
+// CheckTargetURLs vets URLs from users before they are crawled: with the URL guard enabled it returns the
+// error of the first one the guard refuses, else nil.
+func CheckTargetURLs(rawURLs []string) error {
+	return checkTargetURLs(CurrentConfig().URLGuard, rawURLs)
+}
+
+// checkTargetURLs is CheckTargetURLs with the guard of config, such as that of a job's profile.
+func checkTargetURLs(config URLGuardConfig, rawURLs []string) error {
+	if !config.Enabled {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, rawURL := range rawURLs {
+		if err := config.CheckURL(ctx, rawURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// guardedTransport is http.DefaultTransport with connections checked by the URL guard of the current
+// configuration when it is enabled, for the requests made outside a crawl.
+var guardedTransport = newGuardedTransport(func() URLGuardConfig { return CurrentConfig().URLGuard })
+
+// newGuardedTransport returns http.DefaultTransport with connections checked by the URL guard config
+// returns when it is enabled. The check is made on the address being dialled, after resolution and on
+// every redirect.
+func newGuardedTransport(guard func() URLGuardConfig) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		config := guard()
+		if !config.Enabled {
+			return dialer.DialContext(ctx, network, address)
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if config.allowsHost(host) {
+			return dialer.DialContext(ctx, network, address)
+		}
+		if metadataHosts[strings.ToLower(strings.TrimSuffix(host, "."))] {
+			return nil, &BlockedAddressError{Target: host, Reason: "cloud metadata endpoint"}
+		}
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		// Dial the address that was checked rather than resolving the name again
+		var lastErr error
+		for _, addr := range addrs {
+			if lastErr = config.checkIP(addr.IP); lastErr != nil {
+				continue
+			}
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(addr.IP.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		return nil, lastErr
+	}
+	return transport
+}
+
+// guardTransports keeps one transport per URL guard that crawls run under, so their collectors share its
+// connections.
+var guardTransports struct {
+	sync.Mutex
+	transports map[string]*http.Transport
+}
+
+// key identifies the guard among those of guardTransports; every disabled guard is the same.
+func (c URLGuardConfig) key() string {
+	if !c.Enabled {
+		return ""
+	}
+	return "on\n" + strings.Join(c.Allow, "\n")
+}
+
+// guardTransport returns the transport checking connections with guard.
+func guardTransport(guard URLGuardConfig) *http.Transport {
+	key := guard.key()
+	guardTransports.Lock()
+	defer guardTransports.Unlock()
+	if transport := guardTransports.transports[key]; transport != nil {
+		return transport
+	}
+	if guardTransports.transports == nil {
+		guardTransports.transports = map[string]*http.Transport{}
+	}
+	transport := newGuardedTransport(func() URLGuardConfig { return guard })
+	guardTransports.transports[key] = transport
+	return transport
+}
+
+// AttachURLGuard checks the collector's connections with the URL guard when it is enabled. Attach it
+// before the tracer, which wraps whatever transport is in place.
+func AttachURLGuard(c *colly.Collector) {
+	if config := CurrentConfig(); config.URLGuard.Enabled {
+		c.WithTransport(proxyTransport(config.Proxy, config.URLGuard))
+	}
+}
@@ -1,10 +1,5 @@
 package crab
 
-import (
-	"math/rand"
-	"time"
-)
-
 // GetRandomUserAgent randomly selects and returns a user agent string from a predefined list. This function
 // is used to set the user agent in HTTP requests made by the crawler or scraper, helping to mimic real browser
 // behavior and avoid detection by web servers.
@@ -42,7 +37,6 @@ func GetRandomUserAgent() string {
 		"Opera/9.80 (Windows NT 6.1; WOW64) Presto/2.12.388 Version/12.17",
 		"Mozilla/5.0 (Windows NT 6.3; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/90.0.4430.93 Safari/537.36",
 	}
-	rand.Seed(int64(uint64(time.Now().UnixNano())))
-	index := rand.Intn(len(userAgents))
+	index := randIntn(len(userAgents))
 	return userAgents[index]
 }
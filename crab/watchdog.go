@@ -0,0 +1,242 @@
+package crab
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"time"
+)
+
+// WatchdogConfig turns on the sampling of goroutines, heap and open files during runs, to catch leaks
+// in long crawls. Growth in every one of Window samples in a row logs a warning; a sample over a Max
+// limit logs one too and, with Profiles, writes goroutine and heap profiles for go tool pprof.
+type WatchdogConfig struct {
+	Enabled       bool   `json:"enabled"`
+	Interval      string `json:"interval"`       // Time between samples, e.g. "30s"; 10s when empty
+	Window        int    `json:"window"`         // Samples of growth in a row that log a warning; 6 when zero
+	MaxGoroutines int    `json:"max_goroutines"` // No limit when zero
+	MaxHeapMB     int    `json:"max_heap_mb"`    // No limit when zero
+	MaxOpenFiles  int    `json:"max_open_files"` // No limit when zero
+	Profiles      bool   `json:"profiles"`       // Write profiles when a limit is exceeded
+	ProfileDir    string `json:"profile_dir"`    // "profiles" in the output directory when empty
+}
+
+const (
+	defaultWatchdogInterval = 10 * time.Second
+	defaultWatchdogWindow   = 6
+)
+
+// watchdogMetrics publishes the last sample of the watchdog and counts its warnings and profiles.
+var watchdogMetrics = expvar.NewMap("crab_watchdog")
+
+// WatchdogSample is the resource use of the process at one time. OpenFiles is -1 where the count of
+// open file descriptors is not available.
+type WatchdogSample struct {
+	Time       time.Time `json:"time"`
+	Goroutines int       `json:"goroutines"`
+	HeapBytes  uint64    `json:"heap_bytes"`
+	OpenFiles  int       `json:"open_files"`
+}
+
+// TakeWatchdogSample measures the resource use of the process now.
+func TakeWatchdogSample() WatchdogSample {
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+	sample := WatchdogSample{Time: time.Now(), Goroutines: runtime.NumGoroutine(), HeapBytes: memory.HeapAlloc, OpenFiles: -1}
+	if fds, err := os.ReadDir("/proc/self/fd"); err == nil {
+		sample.OpenFiles = len(fds)
+	}
+	return sample
+}
+
+// watchdogResource is one of the resources the watchdog follows.
+type watchdogResource struct {
+	name  string
+	value func(WatchdogSample) float64
+	limit float64 // 0 for none
+	unit  string
+}
+
+// Watchdog follows the resource use of the process over samples and warns of what keeps growing or
+// crosses its limit.
+type Watchdog struct {
+	config    WatchdogConfig
+	resources []watchdogResource
+
+	mu       sync.Mutex
+	previous *WatchdogSample
+	growth   map[string]int  // Samples of growth in a row by resource
+	over     map[string]bool // Resources over their limit, warned of until they fall back under it
+}
+
+// NewWatchdog returns a watchdog with the limits of config.
+func NewWatchdog(config WatchdogConfig) *Watchdog {
+	if config.Window <= 0 {
+		config.Window = defaultWatchdogWindow
+	}
+	return &Watchdog{
+		config: config,
+		resources: []watchdogResource{
+			{"goroutines", func(s WatchdogSample) float64 { return float64(s.Goroutines) }, float64(config.MaxGoroutines), ""},
+			{"heap", func(s WatchdogSample) float64 { return float64(s.HeapBytes) / (1 << 20) }, float64(config.MaxHeapMB), " MB"},
+			{"open files", func(s WatchdogSample) float64 { return float64(s.OpenFiles) }, float64(config.MaxOpenFiles), ""},
+		},
+		growth: map[string]int{},
+		over:   map[string]bool{},
+	}
+}
+
+// Observe checks a sample against the ones before it and the limits, logs a warning for each resource
+// that grew over the whole window or went over its limit, and returns the warnings. Profiles are written
+// once per crossing of a limit.
+func (w *Watchdog) Observe(sample WatchdogSample) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	watchdogMetrics.Add("samples", 1)
+	setWatchdogMetric("goroutines", int64(sample.Goroutines))
+	setWatchdogMetric("heap_bytes", int64(sample.HeapBytes))
+	setWatchdogMetric("open_files", int64(sample.OpenFiles))
+
+	var warnings []string
+	crossed := false
+	for _, resource := range w.resources {
+		value := resource.value(sample)
+		if value < 0 {
+			continue // Not available here
+		}
+		if w.previous != nil && value > resource.value(*w.previous) {
+			w.growth[resource.name]++
+		} else {
+			w.growth[resource.name] = 0
+		}
+		// A warning every window of growth rather than every sample
+		if n := w.growth[resource.name]; n > 0 && n%w.config.Window == 0 {
+			warnings = append(warnings, fmt.Sprintf("%s grew in each of the last %d samples, to %.0f%s", resource.name, n, value, resource.unit))
+		}
+		if resource.limit <= 0 {
+			continue
+		}
+		if value <= resource.limit {
+			w.over[resource.name] = false
+		} else if !w.over[resource.name] {
+			w.over[resource.name] = true
+			crossed = true
+			warnings = append(warnings, fmt.Sprintf("%s at %.0f%s, over the limit of %.0f%s", resource.name, value, resource.unit, resource.limit, resource.unit))
+		}
+	}
+	w.previous = &sample
+	for _, warning := range warnings {
+		warnf("Watchdog: %s", warning)
+		watchdogMetrics.Add("warnings", 1)
+	}
+	if crossed && w.config.Profiles {
+		if paths, err := writeWatchdogProfiles(w.profileDir(), sample.Time); err != nil {
+			warnf("Watchdog: error writing profiles: %v", err)
+		} else {
+			warnf("Watchdog: wrote profiles %v", paths)
+		}
+	}
+	return warnings
+}
+
+// Run samples the process every interval until ctx is done.
+func (w *Watchdog) Run(ctx context.Context) {
+	interval, err := time.ParseDuration(w.config.Interval)
+	if err != nil || interval <= 0 {
+		interval = defaultWatchdogInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Observe(TakeWatchdogSample())
+		}
+	}
+}
+
+// profileDir returns the directory profiles are written to.
+func (w *Watchdog) profileDir() string {
+	if w.config.ProfileDir != "" {
+		return w.config.ProfileDir
+	}
+	return filepath.Join(CurrentConfig().Output.Dir, "profiles")
+}
+
+// writeWatchdogProfiles writes the goroutine and heap profiles of the process to dir and returns their
+// paths.
+func writeWatchdogProfiles(dir string, at time.Time) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, name := range []string{"goroutine", "heap"} {
+		path := filepath.Join(dir, fmt.Sprintf("%s-%s.pprof", name, at.UTC().Format("20060102T150405.000Z")))
+		f, err := os.Create(path)
+		if err != nil {
+			return paths, err
+		}
+		err = pprof.Lookup(name).WriteTo(f, 0)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+		watchdogMetrics.Add("profiles", 1)
+	}
+	return paths, nil
+}
+
+// setWatchdogMetric publishes a value of the last sample.
+func setWatchdogMetric(name string, value int64) {
+	v := new(expvar.Int)
+	v.Set(value)
+	watchdogMetrics.Set(name, v)
+}
+
+// activeWatchdog is the watchdog of the runs in progress; runs that overlap share it, as they share the
+// process it samples.
+var activeWatchdog struct {
+	sync.Mutex
+	runs int
+	stop context.CancelFunc
+}
+
+// beginWatchdog starts sampling the process for a run when config enables the watchdog, unless another
+// run already did. Profiles go to the "profiles" directory under outputDir, the run's output directory,
+// unless config names one. It returns the function that ends the run's use of it.
+func beginWatchdog(config WatchdogConfig, outputDir string) func() {
+	if !config.Enabled {
+		return func() {}
+	}
+	if config.ProfileDir == "" {
+		config.ProfileDir = filepath.Join(outputDir, "profiles")
+	}
+	activeWatchdog.Lock()
+	defer activeWatchdog.Unlock()
+	if activeWatchdog.runs == 0 {
+		ctx, stop := context.WithCancel(context.Background())
+		activeWatchdog.stop = stop
+		go NewWatchdog(config).Run(ctx)
+	}
+	activeWatchdog.runs++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			activeWatchdog.Lock()
+			defer activeWatchdog.Unlock()
+			if activeWatchdog.runs--; activeWatchdog.runs == 0 {
+				activeWatchdog.stop()
+			}
+		})
+	}
+}
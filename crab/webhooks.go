@@ -0,0 +1,153 @@
+package crab
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Webhook events fired by crawls and scrapes.
+const (
+	EventCompleted     = "completed"
+	EventFailed        = "failed"
+	EventSelectorDrift = "selector_drift"
+	EventBlocked       = "blocked"
+	EventSchemaDrift   = "schema_drift"
+	EventAlert         = "alert"
+)
+
+// WebhookConfig describes one webhook endpoint. Format is "slack" for Slack-compatible incoming webhooks
+// or "json" (the default) for a generic JSON POST of the RunSummary. Events limits which events are sent;
+// an empty list sends all of them.
+type WebhookConfig struct {
+	URL    string   `json:"url"`
+	Format string   `json:"format"`
+	Events []string `json:"events"`
+}
+
+// RunSummary describes the outcome of a crawl or scrape. It is the payload sent to webhooks.
+type RunSummary struct {
+	Event        string                    `json:"event"`
+	RunID        string                    `json:"run_id,omitempty"`
+	Kind         string                    `json:"kind"` // "crawl" or "scrape"
+	Name         string                    `json:"name"` // Domain or job name
+	StartedAt    time.Time                 `json:"started_at"`
+	FinishedAt   time.Time                 `json:"finished_at"`
+	Pages        int                       `json:"pages"`
+	Items        int                       `json:"items"`
+	Errors       int                       `json:"errors"`
+	Statuses     map[string]int            `json:"statuses,omitempty"` // URLs crawled by status, e.g. "fetched" or "http-4xx"
+	Outputs      []string                  `json:"outputs"`
+	Error        string                    `json:"error,omitempty"`
+	Blocked      []BlockedDomain           `json:"blocked,omitempty"`      // Domains that served anti-bot pages during the run
+	Traps        map[string]map[string]int `json:"traps,omitempty"`        // URLs skipped as crawler traps by domain and heuristic
+	Datasets     []DatasetStats            `json:"datasets,omitempty"`     // Summary statistics of the datasets written
+	Seeds        []string                  `json:"seeds,omitempty"`        // The URLs a crawl started from
+	Certificates []HostCertificate         `json:"certificates,omitempty"` // TLS certificates of the crawled hosts, when inspected
+	Latency      []DomainLatency           `json:"latency,omitempty"`      // Response time percentiles of the crawled domains
+	Alerts       []Alert                   `json:"alerts,omitempty"`       // The alert rules the run fired, on alert events
+}
+
+// webhookClient is shared by all webhook deliveries so a slow endpoint cannot hang a run.
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// NotifyWebhooks sends the summary to every configured webhook subscribed to its event. Delivery failures
+// are logged and returned but never stop the run that triggered them.
+func NotifyWebhooks(summary RunSummary) error {
+	return notifyWebhooks(CurrentConfig().Webhooks, summary)
+}
+
+// notifyWebhooks is NotifyWebhooks with the given webhooks.
+func notifyWebhooks(webhooks []WebhookConfig, summary RunSummary) error {
+	var failed []string
+	for _, hook := range webhooks {
+		if !hook.wants(summary.Event) {
+			continue
+		}
+		if err := hook.Send(summary); err != nil {
+			log.Printf("Error sending %s webhook to %s: %v", summary.Event, hook.URL, err)
+			failed = append(failed, hook.URL)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("webhook delivery failed for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Send posts the summary to this webhook in its configured format.
+func (h WebhookConfig) Send(summary RunSummary) error {
+	var payload interface{} = summary
+	if h.Format == "slack" {
+		payload = map[string]string{"text": summary.SlackText()}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := webhookClient.Post(h.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SlackText renders the summary as a short Slack message.
+func (s RunSummary) SlackText() string {
+	var b strings.Builder
+	switch s.Event {
+	case EventFailed:
+		fmt.Fprintf(&b, ":x: %s %s failed", s.Kind, s.Name)
+	case EventSelectorDrift:
+		fmt.Fprintf(&b, ":warning: %s %s matched no items, selectors may have drifted", s.Kind, s.Name)
+	case EventBlocked:
+		fmt.Fprintf(&b, ":no_entry: %s %s was blocked by anti-bot protection", s.Kind, s.Name)
+	case EventSchemaDrift:
+		fmt.Fprintf(&b, ":warning: %s %s got responses that no longer match the schema, the API may have changed", s.Kind, s.Name)
+	case EventAlert:
+		fmt.Fprintf(&b, ":rotating_light: %s %s fired %d alert(s)", s.Kind, s.Name, len(s.Alerts))
+	default:
+		fmt.Fprintf(&b, ":white_check_mark: %s %s completed", s.Kind, s.Name)
+	}
+	fmt.Fprintf(&b, " in %s\nPages: %d, items: %d, errors: %d", s.FinishedAt.Sub(s.StartedAt).Round(time.Second), s.Pages, s.Items, s.Errors)
+	if s.Error != "" {
+		fmt.Fprintf(&b, "\nError: %s", s.Error)
+	}
+	for _, alert := range s.Alerts {
+		fmt.Fprintf(&b, "\nAlert %s: %s", alert.Rule, alert.Message)
+	}
+	for _, blocked := range s.Blocked {
+		fmt.Fprintf(&b, "\nBlocked: %s (%s)", blocked.Domain, blocked.Reason)
+	}
+	for _, stats := range s.Datasets {
+		fmt.Fprintf(&b, "\nDataset %s", stats)
+	}
+	for _, output := range s.Outputs {
+		fmt.Fprintf(&b, "\n• %s", output)
+	}
+	return b.String()
+}
+
+// wants reports whether the webhook is subscribed to the event.
+func (h WebhookConfig) wants(event string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
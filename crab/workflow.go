@@ -0,0 +1,430 @@
+package crab
+
+import (
+	"cmpscfa23team2/records"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WorkflowConfig declares a scrape-to-predict workflow, such as
+//
+//	"workflows": {"housing-forecast": {"dataset": "housing", "stages": [
+//	    {"type": "scrape"},
+//	    {"type": "clean", "params": {"numbers": "price,house_size,acre_lot", "required": "price"}},
+//	    {"type": "features", "params": {"columns": "bedrooms,bathrooms,acre_lot,house_size", "keep": "city,state,price"}},
+//	    {"type": "predict", "on_error": "retry", "retries": 3},
+//	    {"type": "store", "timeout": "5m"},
+//	    {"type": "report", "name": "summary", "needs": ["features"], "params": {"file": "housing-forecast.json"}}]}}
+//
+// Its stages form a graph by what each needs, so stages that need none of each other run in parallel:
+// above, the summary report is written while the predictions are made and stored.
+type WorkflowConfig struct {
+	Dataset string          `json:"dataset"` // Scraped dataset the workflow starts from, e.g. "housing"
+	Stages  []WorkflowStage `json:"stages"`
+}
+
+// WorkflowStage is one step of a workflow. It starts once the stages it needs have finished, on the
+// dataset the first of them left, and runs alongside any other stage that is ready. What a failed stage
+// does depends on OnError: "fail", the default, stops the workflow; "skip" carries on with the dataset as
+// it was before the stage; "retry" runs it again, up to Retries more times (2 by default), before
+// stopping the workflow. Each attempt may take up to Timeout.
+type WorkflowStage struct {
+	Type    string            `json:"type"`  // scrape, import, clean, features, report, or a registered type such as predict
+	Name    string            `json:"name"`  // Unique name other stages need it by, the type by default
+	Needs   []string          `json:"needs"` // Stages to wait for: the stage listed before it when omitted, none when []
+	Params  map[string]string `json:"params"`
+	OnError string            `json:"on_error"`
+	Retries int               `json:"retries"`
+	Timeout string            `json:"timeout"` // Of each attempt, e.g. "10m"; none when empty
+}
+
+// name returns the name of the stage in its results.
+func (s WorkflowStage) name() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Type
+}
+
+// defaultStageRetries is how many more times a failing stage with on_error "retry" runs by default.
+const defaultStageRetries = 2
+
+// workflowRetryDelay is how long a failed stage waits before its first retry; the wait doubles each time.
+var workflowRetryDelay = time.Second
+
+// WorkflowRun is the state a workflow hands from stage to stage, and what it did.
+type WorkflowRun struct {
+	RunID    string            `json:"run_id"` // To resume the run with if it fails
+	Workflow string            `json:"workflow"`
+	Dataset  Dataset           `json:"-"`
+	Features []string          `json:"features,omitempty"` // Columns the features stage made numeric, for the predict stage
+	Values   map[string]string `json:"values,omitempty"`   // What stages tell later ones and the report, e.g. "data_file"
+	Stages   []StageResult     `json:"stages"`             // Of the stages finished so far, in the order of the workflow
+
+	// Data holds what stages hand later ones that is not a string, such as the predictions the store
+	// stage saves, as JSON so the run can be persisted and resumed
+	Data map[string]json.RawMessage `json:"-"`
+}
+
+// SetData stores v, as JSON, for later stages to read with GetData.
+func (run *WorkflowRun) SetData(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if run.Data == nil {
+		run.Data = map[string]json.RawMessage{}
+	}
+	run.Data[key] = data
+	return nil
+}
+
+// GetData reads what an earlier stage stored with SetData into v, reporting whether there was any.
+func (run *WorkflowRun) GetData(key string, v interface{}) (bool, error) {
+	data, ok := run.Data[key]
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, v)
+}
+
+// StageResult is how one stage of a workflow run went.
+type StageResult = records.StageResult
+
+// WorkflowStageFunc runs one stage on run with the stage's params, changing run.Dataset as it goes.
+type WorkflowStageFunc func(ctx context.Context, run *WorkflowRun, params map[string]string) error
+
+var (
+	workflowStagesMu sync.RWMutex
+	workflowStages   = map[string]WorkflowStageFunc{
+		"scrape":   scrapeStage,
+		"import":   importStage,
+		"clean":    cleanStage,
+		"features": featuresStage,
+		"report":   reportStage,
+	}
+)
+
+// RegisterWorkflowStage adds a stage type workflows can use, or replaces one. Stages that need the
+// database, such as predict and store, are registered by the programs that have one.
+func RegisterWorkflowStage(stageType string, fn WorkflowStageFunc) {
+	workflowStagesMu.Lock()
+	defer workflowStagesMu.Unlock()
+	workflowStages[stageType] = fn
+}
+
+// workflowStage returns the function of a stage type.
+func workflowStage(stageType string) (WorkflowStageFunc, bool) {
+	workflowStagesMu.RLock()
+	defer workflowStagesMu.RUnlock()
+	fn, ok := workflowStages[stageType]
+	return fn, ok
+}
+
+// Workflows returns the names of the configured workflows, sorted.
+func Workflows() []string {
+	names := make([]string, 0, len(CurrentConfig().Workflows))
+	for name := range CurrentConfig().Workflows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadDatasetFile loads a data file written for the named scraped dataset.
+func loadDatasetFile(name, filename string) (Dataset, error) {
+	for _, source := range scrapedDatasetFiles {
+		if source.Name == name {
+			return source.Load(name, filename)
+		}
+	}
+	return Dataset{}, fmt.Errorf("unknown dataset %q", name)
+}
+
+// scrapeStage scrapes the workflow's dataset, or the "scraper" param, and writes it like any scrape.
+func scrapeStage(ctx context.Context, run *WorkflowRun, params map[string]string) error {
+	name := run.Dataset.Name
+	if params["scraper"] != "" {
+		name = params["scraper"]
+	}
+	scraper, ok := fixtureScrapers[name]
+	if !ok {
+		return fmt.Errorf("no scraper for dataset %q", name)
+	}
+	fetchedAt := time.Now()
+	doc, err := fetchScraperDocument(scraperClient, scraper.URL, scraper.Regions...)
+	if err != nil {
+		return err
+	}
+	var dataFile string
+	for _, source := range scrapedDatasetFiles {
+		if source.Name == name {
+			dataFile = source.DataFile
+		}
+	}
+	filename, err := writeScrapedData(name, dataFile, scraper.Extract(doc), PageSource{URL: scraper.URL, FetchedAt: fetchedAt})
+	if err != nil {
+		return err
+	}
+	return run.load(name, filename)
+}
+
+// importStage imports the "file" param into the workflow's dataset, like crab import, with the optional
+// "format", "sheet" and "columns" (from=to,...) params.
+func importStage(ctx context.Context, run *WorkflowRun, params map[string]string) error {
+	if params["file"] == "" {
+		return fmt.Errorf("no file to import")
+	}
+	options := ImportOptions{Format: params["format"], Sheet: params["sheet"], Columns: map[string]string{}}
+	for _, rename := range splitList(params["columns"]) {
+		from, to, ok := strings.Cut(rename, "=")
+		if !ok {
+			return fmt.Errorf("invalid column rename %q, expected from=to", rename)
+		}
+		options.Columns[strings.TrimSpace(from)] = strings.TrimSpace(to)
+	}
+	filename, err := ImportDataset(run.Dataset.Name, params["file"], options)
+	if err != nil {
+		return err
+	}
+	return run.load(run.Dataset.Name, filename)
+}
+
+// load makes the data file just written the run's dataset.
+func (run *WorkflowRun) load(name, filename string) error {
+	ds, err := loadDatasetFile(name, filename)
+	if err != nil {
+		return err
+	}
+	if runID := filepath.Base(filepath.Dir(filename)); runIDPattern.MatchString(runID) {
+		ds.RunID = runID
+	}
+	run.Dataset = ds
+	run.Values["data_file"] = filename
+	return nil
+}
+
+// splitList splits a comma-separated param, dropping blanks.
+func splitList(param string) []string {
+	var items []string
+	for _, item := range strings.Split(param, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// requireDataset fails stages that need data when no stage has produced any yet.
+func (run *WorkflowRun) requireDataset() error {
+	if len(run.Dataset.Columns) == 0 {
+		return fmt.Errorf("no dataset yet, a scrape or import stage must come first")
+	}
+	return nil
+}
+
+// columnIndexes returns the positions of columns in the run's dataset.
+func (run *WorkflowRun) columnIndexes(columns []string) ([]int, error) {
+	positions := map[string]int{}
+	for j, column := range run.Dataset.Columns {
+		positions[column] = j
+	}
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		j, ok := positions[column]
+		if !ok {
+			return nil, fmt.Errorf("dataset %s has no column %q", run.Dataset.Name, column)
+		}
+		indexes[i] = j
+	}
+	return indexes, nil
+}
+
+// cleanStage writes the numbers of the dataset's configured number columns, and of the "numbers" param,
+// as plain numbers, then drops rows missing a "required" column and repeated rows.
+func cleanStage(ctx context.Context, run *WorkflowRun, params map[string]string) error {
+	if err := run.requireDataset(); err != nil {
+		return err
+	}
+	formats := map[string]NumberFormat{}
+	for column, format := range CurrentConfig().Numbers[run.Dataset.Name] {
+		formats[column] = format
+	}
+	for _, column := range splitList(params["numbers"]) {
+		if _, ok := formats[column]; !ok {
+			formats[column] = NumberFormat{}
+		}
+	}
+	clean, errs := CleanDataset(run.Dataset, formats)
+	if len(errs) > 0 {
+		log.Printf("Workflow %s left %d values as scraped, e.g. %v", run.Workflow, len(errs), errs[0])
+	}
+	required, err := run.columnIndexes(splitList(params["required"]))
+	if err != nil {
+		return err
+	}
+
+	seen := map[string]bool{}
+	rows := clean.Rows[:0]
+	for _, row := range clean.Rows {
+		missing := false
+		for _, j := range required {
+			missing = missing || strings.TrimSpace(row[j]) == ""
+		}
+		key := strings.Join(row, "\x00")
+		if missing || seen[key] {
+			continue
+		}
+		seen[key] = true
+		rows = append(rows, row)
+	}
+	clean.Rows = rows
+	run.Dataset = clean
+	return nil
+}
+
+// featuresStage keeps the numeric feature "columns" of the dataset, and the "keep" columns carried along
+// for the report, dropping rows whose features are not all numbers. The predict stage predicts from the
+// features.
+func featuresStage(ctx context.Context, run *WorkflowRun, params map[string]string) error {
+	if err := run.requireDataset(); err != nil {
+		return err
+	}
+	features := splitList(params["columns"])
+	if len(features) == 0 {
+		return fmt.Errorf("no feature columns")
+	}
+	keep := splitList(params["keep"])
+	indexes, err := run.columnIndexes(append(append([]string(nil), keep...), features...))
+	if err != nil {
+		return err
+	}
+
+	ds := Dataset{Name: run.Dataset.Name, RunID: run.Dataset.RunID, Columns: append(keep, features...)}
+	dropped := 0
+	for _, row := range run.Dataset.Rows {
+		cells := make([]string, len(indexes))
+		numeric := true
+		for i, j := range indexes {
+			cells[i] = row[j]
+			if i >= len(keep) {
+				number, err := ParseNumber(row[j], NumberFormat{})
+				if err != nil {
+					numeric = false
+					break
+				}
+				cells[i] = strconv.FormatFloat(number.Value, 'f', -1, 64)
+			}
+		}
+		if !numeric {
+			dropped++
+			continue
+		}
+		ds.Rows = append(ds.Rows, cells)
+	}
+	if len(ds.Rows) == 0 && len(run.Dataset.Rows) > 0 {
+		return fmt.Errorf("no row has numeric %s", strings.Join(features, ", "))
+	}
+	if dropped > 0 {
+		log.Printf("Workflow %s dropped %d rows without numeric features", run.Workflow, dropped)
+	}
+	run.Dataset, run.Features = ds, features
+	run.Values["dropped_rows"] = strconv.Itoa(dropped)
+	return nil
+}
+
+// FeatureInputs returns the features of each row of the run's dataset as a JSON object, the input the
+// predict stage gives a predictor.
+func (run *WorkflowRun) FeatureInputs() ([]string, error) {
+	indexes, err := run.columnIndexes(run.Features)
+	if err != nil {
+		return nil, err
+	}
+	inputs := make([]string, len(run.Dataset.Rows))
+	for r, row := range run.Dataset.Rows {
+		features := make(map[string]json.Number, len(indexes))
+		for i, j := range indexes {
+			features[run.Features[i]] = json.Number(row[j])
+		}
+		data, err := json.Marshal(features)
+		if err != nil {
+			return nil, err
+		}
+		inputs[r] = string(data)
+	}
+	return inputs, nil
+}
+
+// AddColumn appends a column to the run's dataset, one value per row.
+func (run *WorkflowRun) AddColumn(column string, values []string) error {
+	if len(values) != len(run.Dataset.Rows) {
+		return fmt.Errorf("%d values for %d rows", len(values), len(run.Dataset.Rows))
+	}
+	run.Dataset.Columns = append(append([]string(nil), run.Dataset.Columns...), column)
+	rows := make([][]string, len(run.Dataset.Rows))
+	for r, row := range run.Dataset.Rows {
+		rows[r] = append(append([]string(nil), row...), values[r])
+	}
+	run.Dataset.Rows = rows
+	return nil
+}
+
+// workflowReport is the file the report stage writes.
+type workflowReport struct {
+	WorkflowRun
+	Finished time.Time    `json:"finished"`
+	Summary  DatasetStats `json:"summary"`
+	Columns  []string     `json:"columns"`
+	Rows     [][]string   `json:"rows,omitempty"`
+}
+
+// reportStage writes the run so far, the summary statistics of its dataset and, unless "rows" is
+// "false", the rows themselves to the "file" param, <workflow>-report.json in the output directory by
+// default. A "csv" param also writes the rows as CSV.
+func reportStage(ctx context.Context, run *WorkflowRun, params map[string]string) error {
+	if err := run.requireDataset(); err != nil {
+		return err
+	}
+	filename := params["file"]
+	if filename == "" {
+		filename = filepath.Join(CurrentConfig().Output.Dir, run.Workflow+"-report.json")
+	}
+	report := workflowReport{WorkflowRun: *run, Finished: time.Now().UTC(), Summary: SummarizeDataset(run.Dataset),
+		Columns: run.Dataset.Columns}
+	if withRows, err := strconv.ParseBool(params["rows"]); err != nil || withRows {
+		report.Rows = run.Dataset.Rows
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return err
+	}
+	run.Values["report_file"] = filename
+
+	if params["csv"] != "" {
+		file, err := os.Create(params["csv"])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err := run.Dataset.WriteCSV(file); err != nil {
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+		run.Values["report_csv"] = params["csv"]
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeAxe is a scan command printing axe-core results for the URL it is given: a missing alt text on
+// every page, and a critical contrast problem on the pages under /bad. Pages under /broken fail.
+var fakeAxe = []string{"sh", "-c", `case "$1" in
+	*/broken*) echo "page crashed" >&2; exit 1;;
+	*/bad*) extra=',{"id":"color-contrast","impact":"critical","help":"Contrast","nodes":[{},{}]}';;
+	esac
+	printf '[{"url":"%s","violations":[{"id":"image-alt","impact":"serious","help":"Images need alt text","helpUrl":"https://dequeuniversity.com/rules/axe/image-alt","nodes":[{}]}%s]}]' "$1" "$extra"`, "axe"}
+
+func TestParseAxeResults(t *testing.T) {
+	pages, err := crab.ParseAxeResults([]byte(`{"url": "https://a.example/", "violations": [
+		{"id": "region", "impact": "moderate", "nodes": [{}]},
+		{"id": "label", "impact": "critical", "nodes": [{}, {}, {}]}], "passes": [{"id": "title"}]}`))
+	if err != nil || len(pages) != 1 || len(pages[0].Violations) != 2 {
+		t.Fatalf("ParseAxeResults() = %+v, %v", pages, err)
+	}
+	if v := pages[0].Violations[0]; v.Rule != "label" || v.Elements != 3 {
+		t.Errorf("first violation = %+v, want the critical one", v)
+	}
+	if _, err := crab.ParseAxeResults([]byte("Error: Chrome not found")); err == nil {
+		t.Errorf("ParseAxeResults() of an error message succeeded")
+	}
+}
+
+func TestScanA11y(t *testing.T) {
+	report := crab.ScanA11y(context.Background(), []string{
+		"https://b.example/bad/1", "https://a.example/", "https://b.example/ok", "https://b.example/broken",
+	}, crab.A11yConfig{Command: fakeAxe})
+	if len(report.Pages) != 4 || report.Pages[0].URL != "https://a.example/" || len(report.Pages[0].Violations) != 1 {
+		t.Fatalf("pages = %+v", report.Pages)
+	}
+	if bad := report.Pages[1]; len(bad.Violations) != 2 || bad.Violations[0].Rule != "color-contrast" || bad.Violations[0].Elements != 2 {
+		t.Errorf("scan of /bad/1 = %+v", bad)
+	}
+	if broken := report.Pages[2]; !strings.Contains(broken.Error, "page crashed") {
+		t.Errorf("scan of /broken = %+v, want the command's error", broken)
+	}
+	if len(report.Sites) != 2 {
+		t.Fatalf("sites = %+v", report.Sites)
+	}
+	if site := report.Sites[1]; site.Host != "b.example" || site.Pages != 3 || site.Failed != 1 || site.Violations != 3 ||
+		site.ByImpact["critical"] != 1 || site.ByRule["image-alt"] != 2 {
+		t.Errorf("site b.example = %+v", site)
+	}
+}
+
+func TestCrawlA11yScan(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/data.json" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<title>Page</title><img src="x.png">`)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}, A11y: crab.A11yConfig{Enabled: true, Command: fakeAxe}})
+	defer crab.SetConfig(crab.Config{})
+
+	summary := crab.Crawl(context.Background(), []crab.URLData{{URL: server.URL + "/bad"}, {URL: server.URL + "/data.json"}}, 2)
+	data, err := os.ReadFile(filepath.Join(dir, summary.RunID, "a11y_report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report crab.A11yReport
+	json.Unmarshal(data, &report)
+	if report.RunID != summary.RunID || len(report.Pages) != 1 || len(report.Sites) != 1 || report.Sites[0].Violations != 2 {
+		t.Errorf("a11y_report.json = %s, want the one HTML page scanned", data)
+	}
+}
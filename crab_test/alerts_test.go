@@ -0,0 +1,89 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEvaluateAlerts(t *testing.T) {
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}, Alerts: []crab.AlertRule{
+		{Kind: crab.AlertRowDrop, Threshold: 20},
+		{Name: "flaky", Kind: crab.AlertUnhealthy, Threshold: 2, Jobs: []string{"gasoline"}},
+		{Kind: crab.AlertErrorRate, Threshold: 10, Jobs: []string{"elsewhere"}},
+	}})
+	defer crab.SetConfig(crab.Config{})
+
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	run := func(n, rows int, event string) []crab.Alert {
+		summary := crab.RunSummary{RunID: fmt.Sprintf("run-%d", n), Kind: "scrape", Name: "gasoline", Event: event,
+			StartedAt: start.Add(time.Duration(n) * time.Hour), Pages: 1, Errors: 1,
+			Datasets: []crab.DatasetStats{{Dataset: "gasoline", Rows: rows}}}
+		crab.FileMetricsStore{Path: filepath.Join(crab.CurrentConfig().Output.Dir, "run_metrics.jsonl")}.SaveRunMetrics(crab.RunMetrics(summary))
+		return crab.EvaluateAlerts(summary)
+	}
+
+	if alerts := run(0, 100, crab.EventCompleted); len(alerts) != 0 {
+		t.Errorf("first run fired %+v, want nothing to compare with", alerts)
+	}
+	if alerts := run(1, 90, crab.EventFailed); len(alerts) != 0 {
+		t.Errorf("a 10%% drop and one failure fired %+v", alerts)
+	}
+	alerts := run(2, 60, crab.EventFailed)
+	if len(alerts) != 2 || alerts[0].Kind != crab.AlertRowDrop || alerts[0].Label != "gasoline" || alerts[0].Value < 33 ||
+		alerts[1].Rule != "flaky" || alerts[1].Value != 2 {
+		t.Fatalf("a 33%% drop and a second failure fired %+v", alerts)
+	}
+	if alerts := run(3, 60, crab.EventFailed); len(alerts) != 0 {
+		t.Errorf("a third failure fired %+v, want one alert per streak", alerts)
+	}
+}
+
+func TestCrawlAlerts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			http.Error(w, "broken", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<title>Page</title>`)
+	}))
+	defer server.Close()
+	var mu sync.Mutex
+	var received []crab.RunSummary
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var summary crab.RunSummary
+		json.NewDecoder(r.Body).Decode(&summary)
+		mu.Lock()
+		received = append(received, summary)
+		mu.Unlock()
+	}))
+	defer hook.Close()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()},
+		Webhooks: []crab.WebhookConfig{{URL: hook.URL, Events: []string{crab.EventAlert}}},
+		Alerts:   []crab.AlertRule{{Kind: crab.AlertErrorRate, Threshold: 25}}})
+	defer crab.SetConfig(crab.Config{})
+
+	summary := crab.Crawl(context.Background(), []crab.URLData{{URL: server.URL + "/a"}, {URL: server.URL + "/broken"}}, 1)
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 || received[0].Event != crab.EventAlert || len(received[0].Alerts) != 1 ||
+		received[0].Alerts[0].Value != 50 || received[0].RunID != summary.RunID {
+		t.Fatalf("webhook received %+v, want the error rate alert only", received)
+	}
+
+	history, err := crab.LoadAlerts("", time.Time{})
+	if err != nil || len(history) != 1 || history[0].Kind != crab.AlertErrorRate || history[0].RunID != summary.RunID {
+		t.Errorf("LoadAlerts() = %+v, %v, want the alert recorded", history, err)
+	}
+	if history, _ := crab.LoadAlerts("elsewhere", time.Time{}); len(history) != 0 {
+		t.Errorf("LoadAlerts(elsewhere) = %+v, want none", history)
+	}
+}
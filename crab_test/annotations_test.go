@@ -0,0 +1,115 @@
+package crab_test
+
+import (
+	"bytes"
+	"cmpscfa23team2/crab"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestStripAnnotations(t *testing.T) {
+	patterns := []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\s*\(\s*(p|r|e)\s*\)$`),
+		regexp.MustCompile(`\s*\[\s*[\p{L}\p{N}]{1,4}\s*\]$`),
+		regexp.MustCompile(`\s*[¹²³]+$`),
+		regexp.MustCompile(`\s*[*†]+$`),
+	}
+	tests := []struct {
+		value, clean string
+		markers      []string
+	}{
+		{"4.1 (p)", "4.1", []string{"(p)"}},
+		{"3.2*", "3.2", []string{"*"}},
+		{"5.0[1]", "5.0", []string{"[1]"}},
+		{"6.4¹", "6.4", []string{"¹"}},
+		{"7.7 [a] (R)*", "7.7", []string{"[a]", "(R)", "*"}},
+		{" 8.1  ", "8.1", nil},
+		{"(12.5)", "(12.5)", nil},
+		{"", "", nil},
+	}
+	for _, tt := range tests {
+		clean, markers := crab.StripAnnotations(tt.value, patterns)
+		if clean != tt.clean || !reflect.DeepEqual(markers, tt.markers) {
+			t.Errorf("StripAnnotations(%q) = %q, %q, want %q, %q", tt.value, clean, markers, tt.clean, tt.markers)
+		}
+	}
+}
+
+func TestAnnotateDataset(t *testing.T) {
+	ds := crab.Dataset{Name: "inflation", Columns: []string{"year", "jan", "avg"}, Rows: [][]string{
+		{"2023 (p)", "6.4¹", "4.1 (p)"},
+		{"2022", "7.5", "8.0 r"},
+	}}
+	clean, annotations, err := crab.AnnotateDataset(ds, crab.AnnotationRule{Columns: []string{"jan", "avg"}, Patterns: []string{`\br`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRows := [][]string{{"2023 (p)", "6.4", "4.1"}, {"2022", "7.5", "8.0"}}
+	if !reflect.DeepEqual(clean.Rows, wantRows) || ds.Rows[0][1] != "6.4¹" {
+		t.Errorf("AnnotateDataset() rows = %q, want %q and the original left alone", clean.Rows, wantRows)
+	}
+	want := []crab.Annotation{
+		{Row: 0, Period: "2023 (p)", Column: "jan", Value: "6.4¹", Clean: "6.4", Markers: []string{"¹"}},
+		{Row: 0, Period: "2023 (p)", Column: "avg", Value: "4.1 (p)", Clean: "4.1", Markers: []string{"(p)"}},
+		{Row: 1, Period: "2022", Column: "avg", Value: "8.0 r", Clean: "8.0", Markers: []string{"r"}},
+	}
+	if !reflect.DeepEqual(annotations, want) {
+		t.Errorf("AnnotateDataset() annotations = %+v, want %+v", annotations, want)
+	}
+
+	annotated := crab.WithAnnotationColumns(clean, annotations)
+	if want := []string{"year", "jan", "jan_annotation", "avg", "avg_annotation"}; !reflect.DeepEqual(annotated.Columns, want) {
+		t.Errorf("WithAnnotationColumns() columns = %q, want %q", annotated.Columns, want)
+	}
+	if want := []string{"2022", "7.5", "", "8.0", "r"}; !reflect.DeepEqual(annotated.Rows[1], want) {
+		t.Errorf("WithAnnotationColumns() row = %q, want %q", annotated.Rows[1], want)
+	}
+
+	if _, _, err := crab.AnnotateDataset(ds, crab.AnnotationRule{Patterns: []string{"("}}); err == nil {
+		t.Error("AnnotateDataset() with an invalid pattern succeeded")
+	}
+}
+
+func TestScrapeStripsAnnotations(t *testing.T) {
+	// A copy of the inflation page with May 2022 preliminary and June 2022 footnoted
+	fixtures := t.TempDir()
+	pages, _ := filepath.Glob(filepath.Join(fixturesDir, "inflation", "*"))
+	for _, page := range pages {
+		body, err := os.ReadFile(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = bytes.Replace(body, []byte("<td>8.6</td><td>9.1</td>"), []byte("<td>8.6 (p)</td><td>9.1[1]</td>"), 1)
+		if err := os.WriteFile(filepath.Join(fixtures, filepath.Base(page)), body, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{
+		Output:      crab.OutputConfig{Dir: dir},
+		Annotations: map[string]crab.AnnotationRule{"inflation": {}},
+	})
+	defer crab.SetConfig(crab.Config{})
+	defer crab.UseFixtures(fixtures, false)()
+	crab.ScrapeInflationData()
+
+	report, err := crab.LoadAnnotations(dir, "inflation", "")
+	if err != nil || len(report.Annotations) != 2 {
+		t.Fatalf("LoadAnnotations() = %+v, %v, want two cells", report, err)
+	}
+	if a := report.Annotations[0]; a.Period != "2022" || a.Column != "may" || a.Clean != "8.6" || a.Markers[0] != "(p)" {
+		t.Errorf("annotation %+v, want May 2022", a)
+	}
+	ds, err := crab.LoadDatasetAsOf(dir, "inflation", report.RunID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := ds.Rows[report.Annotations[1].Row]
+	if row[5] != "8.6" || row[6] != "9.1" {
+		t.Errorf("published row = %q, want the annotations stripped", row)
+	}
+}
@@ -0,0 +1,81 @@
+package crab_test
+
+import (
+	"bytes"
+	"cmpscfa23team2/crab"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectAnomalies(t *testing.T) {
+	gasoline := crab.Dataset{Name: "gasoline", Columns: []string{"year", "price"}, Rows: [][]string{
+		{"1983", "1.24"}, {"1982", "1.30"}, {"1981", "13.8"}, {"1980", "1.22"}, {"1979", "0.88"}, {"1984", ""},
+	}}
+	anomalies, err := crab.DetectAnomalies(gasoline, crab.AnomalyRule{Columns: []string{"price"}, OrderBy: "year", MaxChange: 0.5})
+	if err != nil {
+		t.Fatalf("DetectAnomalies() error = %v", err)
+	}
+	// 1981 jumps from 1.22; 1982 only returns to the level before it
+	if len(anomalies) != 1 || anomalies[0].Row != 2 || anomalies[0].Period != "1981" || anomalies[0].Previous != "1.22" {
+		t.Fatalf("DetectAnomalies() = %+v, want the 1981 price", anomalies)
+	}
+
+	anomalies, err = crab.DetectAnomalies(gasoline, crab.AnomalyRule{Columns: []string{"price"}, MaxZScore: 5})
+	if err != nil || len(anomalies) != 1 || anomalies[0].Value != "13.8" || anomalies[0].ZScore < 5 {
+		t.Errorf("DetectAnomalies() by z-score = %+v, %v, want the 1981 price", anomalies, err)
+	}
+	if _, err := crab.DetectAnomalies(gasoline, crab.AnomalyRule{Columns: []string{"cpi"}}); err == nil {
+		t.Error("DetectAnomalies() with an unknown column succeeded")
+	}
+
+	clean := crab.QuarantineAnomalies(gasoline, anomalies)
+	if clean.Rows[2][1] != "" || gasoline.Rows[2][1] != "13.8" || clean.Rows[1][1] != "1.30" {
+		t.Errorf("QuarantineAnomalies() rows = %v, original %v", clean.Rows, gasoline.Rows)
+	}
+}
+
+func TestScrapeQuarantinesAnomalies(t *testing.T) {
+	// A copy of the inflation page with May 2022 misread as 86 rather than 8.6
+	fixtures := t.TempDir()
+	pages, _ := filepath.Glob(filepath.Join(fixturesDir, "inflation", "*"))
+	for _, page := range pages {
+		body, err := os.ReadFile(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = bytes.Replace(body, []byte("<td>8.6</td>"), []byte("<td>86</td>"), 1)
+		if err := os.WriteFile(filepath.Join(fixtures, filepath.Base(page)), body, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir := t.TempDir()
+	months := []string{"jan", "feb", "mar", "apr", "may", "jun", "july", "aug", "sept", "oct", "nov", "dec"}
+	crab.SetConfig(crab.Config{
+		Output:    crab.OutputConfig{Dir: dir},
+		Anomalies: map[string]crab.AnomalyRule{"inflation": {Columns: months, OrderBy: "year", Across: true, MaxChange: 1}},
+	})
+	defer crab.SetConfig(crab.Config{})
+	defer crab.UseFixtures(fixtures, false)()
+	crab.ScrapeInflationData()
+
+	report, err := crab.LoadQuarantine(dir, "inflation", "")
+	if err != nil || len(report.Anomalies) != 1 {
+		t.Fatalf("LoadQuarantine() = %+v, %v, want one value", report, err)
+	}
+	anomaly := report.Anomalies[0]
+	if anomaly.Period != "2022" || anomaly.Column != "may" || anomaly.Value != "86" || anomaly.Previous != "8.3" {
+		t.Errorf("quarantined %+v, want May 2022", anomaly)
+	}
+	ds, err := crab.LoadDatasetAsOf(dir, "inflation", report.RunID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.Rows[anomaly.Row][5] != "" || ds.Rows[anomaly.Row][4] != "8.3" {
+		t.Errorf("published row = %v, want May blank", ds.Rows[anomaly.Row])
+	}
+	if _, err := crab.VerifyRunManifest(filepath.Join(dir, report.RunID)); err != nil {
+		t.Errorf("VerifyRunManifest() error = %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"github.com/gocolly/colly"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDetectAntiBot(t *testing.T) {
+	bigPage := "<html><body>" + strings.Repeat("<p>content</p>", 3000) + `<div class="g-recaptcha"></div></body></html>`
+	tests := []struct {
+		name       string
+		status     int
+		header     http.Header
+		body       string
+		wantReason string
+	}{
+		{"normal page", 200, nil, "<html><title>Books</title></html>", ""},
+		{"cloudflare header", 403, http.Header{"Cf-Mitigated": {"challenge"}}, "", "Cloudflare challenge"},
+		{"cloudflare interstitial", 503, nil, "<html><head><title>Just a moment...</title></head></html>", "Cloudflare challenge"},
+		{"datadome", 403, nil, `<script src="https://ct.captcha-delivery.com/c.js"></script>`, "DataDome CAPTCHA"},
+		{"small captcha page", 200, nil, `<form><div class="h-captcha"></div></form>`, "hCaptcha"},
+		{"captcha on large page", 200, nil, bigPage, ""},
+		{"captcha on error page", 429, nil, bigPage, "reCAPTCHA"},
+	}
+	for _, tt := range tests {
+		reason, blocked := crab.DetectAntiBot(tt.status, tt.header, []byte(tt.body))
+		if reason != tt.wantReason || blocked != (tt.wantReason != "") {
+			t.Errorf("%s: DetectAntiBot() = %q, %v, want %q", tt.name, reason, blocked, tt.wantReason)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var hits int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/ok" {
+			w.Write([]byte("<html><h1>Real content</h1></html>"))
+			return
+		}
+		w.Write([]byte("<html><head><title>Just a moment...</title></head><h1>Checking your browser</h1></html>"))
+	}))
+	defer server.Close()
+
+	breaker := crab.NewCircuitBreaker()
+	c := colly.NewCollector(colly.AllowURLRevisit())
+	breaker.Attach(c)
+	var headings []string
+	c.OnHTML("h1", func(e *colly.HTMLElement) {
+		headings = append(headings, e.Text)
+	})
+
+	c.Visit(server.URL + "/challenge")
+	c.Visit(server.URL + "/ok")
+	if hits != 1 {
+		t.Errorf("server got %d requests, want 1 before the breaker opened", hits)
+	}
+	if len(headings) != 0 {
+		t.Errorf("challenge page content was extracted: %v", headings)
+	}
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	blocked, ok := breaker.Status(host)
+	if !ok || blocked.Reason != "Cloudflare challenge" || blocked.Count != 1 || blocked.URL != server.URL+"/challenge" {
+		t.Errorf("Status(%s) = %+v, %v", host, blocked, ok)
+	}
+	if got := breaker.BlockedSince(blocked.DetectedAt); len(got) != 1 {
+		t.Errorf("BlockedSince() returned %d domains, want 1", len(got))
+	}
+
+	breaker.RecordSuccess(host)
+	if !breaker.Allow(host) {
+		t.Errorf("Allow() after RecordSuccess = false, want true")
+	}
+}
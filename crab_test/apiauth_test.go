@@ -0,0 +1,107 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"github.com/golang-jwt/jwt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAPIAuthRoles(t *testing.T) {
+	crab.SetConfig(crab.Config{API: crab.APIConfig{
+		Keys: []crab.APIKey{
+			{Name: "dashboard", Key: "view-key", Role: "viewer"},
+			{Name: "scheduler", Key: "op-key", Role: "operator"},
+		},
+		JWTSecret: "secret",
+	}})
+	defer crab.SetConfig(crab.Config{})
+
+	var audit []crab.AuditEntry
+	auth := &crab.APIAuth{
+		RoleLookup: func(subject string) (crab.Role, error) {
+			if subject == "user-1" {
+				return crab.RoleAdmin, nil
+			}
+			return crab.RoleNone, nil
+		},
+		Audit: func(entry crab.AuditEntry) { audit = append(audit, entry) },
+	}
+	handler := auth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleOperator), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	sign := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "Bearer " + token
+	}
+
+	tests := []struct {
+		name, method, header, value string
+		want                        int
+	}{
+		{"no credentials", "GET", "", "", http.StatusUnauthorized},
+		{"wrong key", "GET", "X-API-Key", "nope", http.StatusUnauthorized},
+		{"viewer reads", "GET", "X-API-Key", "view-key", http.StatusAccepted},
+		{"viewer writes", "POST", "X-API-Key", "view-key", http.StatusForbidden},
+		{"operator writes", "POST", "Authorization", "Bearer op-key", http.StatusAccepted},
+		{"jwt with role", "POST", "Authorization", sign(jwt.MapClaims{"sub": "ci", "role": "operator"}), http.StatusAccepted},
+		{"jwt viewer writes", "POST", "Authorization", sign(jwt.MapClaims{"sub": "ci", "role": "viewer"}), http.StatusForbidden},
+		{"jwt role from lookup", "POST", "Authorization", sign(jwt.MapClaims{"uid": "user-1"}), http.StatusAccepted},
+		{"expired jwt", "GET", "Authorization", sign(jwt.MapClaims{"sub": "ci", "role": "admin", "exp": time.Now().Add(-time.Hour).Unix()}), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api/jobs", nil)
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+
+	// Every POST is audited, allowed or not; GETs are not.
+	if len(audit) != 5 {
+		t.Fatalf("audited %d calls, want 5: %+v", len(audit), audit)
+	}
+	if audit[0].Status != http.StatusForbidden || audit[0].Principal.Name != "dashboard" || audit[0].Principal.Role != crab.RoleViewer {
+		t.Errorf("first audit entry = %+v", audit[0])
+	}
+	if audit[4].Principal.Name != "user-1" || audit[4].Principal.Role != crab.RoleAdmin || audit[4].Status != http.StatusAccepted {
+		t.Errorf("lookup audit entry = %+v", audit[4])
+	}
+}
+
+func TestAPIAuthOpenWithoutConfig(t *testing.T) {
+	auth := &crab.APIAuth{}
+	handler := auth.Require(crab.ByMethod(crab.RoleViewer, crab.RoleOperator), func(w http.ResponseWriter, r *http.Request) {})
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/api/jobs", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("status %d reading without any API config, want the API open to viewers", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/api/jobs", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status %d writing without any API config, want 403", w.Code)
+	}
+
+	// Anonymous callers never reach the admin routes
+	admin := auth.Require(crab.ByMethod(crab.RoleAdmin, crab.RoleAdmin), func(w http.ResponseWriter, r *http.Request) {})
+	for _, method := range []string{"GET", "PUT"} {
+		w = httptest.NewRecorder()
+		admin(w, httptest.NewRequest(method, "/api/config", nil))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s /api/config status %d without any API config, want 403", method, w.Code)
+		}
+	}
+	if _, err := crab.ParseRole("root"); err == nil {
+		t.Error("ParseRole(root) succeeded")
+	}
+}
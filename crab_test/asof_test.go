@@ -0,0 +1,90 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadDatasetAsOf(t *testing.T) {
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+	scrape := func(name string, scraper func()) {
+		defer crab.UseFixtures(filepath.Join(fixturesDir, name), false)()
+		scraper()
+		time.Sleep(5 * time.Millisecond) // Keep the run IDs in order
+	}
+	scrape("inflation", crab.ScrapeInflationData)
+	scrape("gasoline", crab.ScrapeGasInflationData)
+	scrape("inflation", crab.ScrapeInflationData)
+	runs, err := crab.ListRuns(dir)
+	if err != nil || len(runs) != 3 {
+		t.Fatalf("ListRuns() = %v, %v, want 3 runs", runs, err)
+	}
+
+	latest, err := crab.LoadDatasetAsOf(dir, "inflation", "")
+	if err != nil || latest.RunID != runs[2] || len(latest.Rows) != 3 {
+		t.Errorf("latest inflation = run %s with %d rows, %v, want run %s", latest.RunID, len(latest.Rows), err, runs[2])
+	}
+	// The gasoline run did not touch the inflation data, so the first run's version still stands
+	if ds, err := crab.LoadDatasetAsOf(dir, "inflation", runs[1]); err != nil || ds.RunID != runs[0] {
+		t.Errorf("inflation as of %s = run %s, %v, want run %s", runs[1], ds.RunID, err, runs[0])
+	}
+	if ds, err := crab.LoadDatasetAsOf(dir, "gasoline", runs[2]); err != nil || ds.RunID != runs[1] {
+		t.Errorf("gasoline as of %s = run %s, %v, want run %s", runs[2], ds.RunID, err, runs[1])
+	}
+	if _, err := crab.LoadDatasetAsOf(dir, "gasoline", runs[0]); err == nil {
+		t.Error("gasoline as of a run before any gasoline scrape succeeded")
+	}
+	if _, err := crab.LoadDatasetAsOf(dir, "inflation", "yesterday"); err == nil {
+		t.Error("LoadDatasetAsOf() with an invalid run ID succeeded")
+	}
+	datasets, err := crab.LoadScrapedDatasets(filepath.Join(dir, runs[1]))
+	if err != nil || len(datasets) != 1 || datasets[0].RunID != runs[1] {
+		t.Errorf("LoadScrapedDatasets() of run %s = %+v, %v", runs[1], datasets, err)
+	}
+}
+
+func TestSnapshotAsOf(t *testing.T) {
+	body := "first"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body>" + body + "</body></html>"))
+	}))
+	defer server.Close()
+	snapshots := crab.FileSnapshotStore{Dir: t.TempDir()}
+	crab.SetConfig(crab.Config{
+		Output:    crab.OutputConfig{Dir: t.TempDir()},
+		Snapshots: crab.SnapshotConfig{Enabled: true, Dir: snapshots.Dir},
+	})
+	defer crab.SetConfig(crab.Config{})
+
+	var runIDs []string
+	for _, b := range []string{"first", "second"} {
+		body = b
+		run, err := crab.StartRun("crawl")
+		if err != nil {
+			t.Fatal(err)
+		}
+		crab.FetchPage(crab.URLData{URL: server.URL})
+		run.Finish(nil)
+		runIDs = append(runIDs, run.ID)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	list, err := snapshots.ListSnapshots(server.URL)
+	if err != nil || len(list) != 2 || list[0].RunID != runIDs[0] || list[1].RunID != runIDs[1] {
+		t.Fatalf("ListSnapshots() = %+v, %v, want one snapshot tagged with each run", list, err)
+	}
+	snapshot, err := crab.SnapshotAsOf(snapshots, server.URL, runIDs[0])
+	if err != nil || string(snapshot.Body) != "<html><body>first</body></html>" {
+		t.Errorf("SnapshotAsOf(first run) = %q, %v", snapshot.Body, err)
+	}
+	if crab.CurrentRunID() != "" {
+		t.Errorf("CurrentRunID() = %q after the runs finished", crab.CurrentRunID())
+	}
+}
@@ -0,0 +1,33 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicFile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "books_data.json")
+	if err := crab.WriteFileAtomic(filename, []byte(`{"domain":"books"}`)); err != nil {
+		t.Fatalf("WriteFileAtomic() error = %v", err)
+	}
+
+	// An aborted write must leave the previous contents and no temporary files behind.
+	f, err := crab.CreateAtomic(filename)
+	if err != nil {
+		t.Fatalf("CreateAtomic() error = %v", err)
+	}
+	f.Write([]byte(`{"domain":`))
+	f.Abort()
+
+	data, _ := os.ReadFile(filename)
+	if string(data) != `{"domain":"books"}` {
+		t.Errorf("file contents after abort = %q", data)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only the committed file", len(entries))
+	}
+}
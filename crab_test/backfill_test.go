@@ -0,0 +1,86 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// inflationTable renders an inflation table page with a row per year, each rate in every month.
+func inflationTable(rates map[int]string, years ...int) string {
+	var page strings.Builder
+	page.WriteString("<table><tbody><tr><td>Year</td><td>Jan</td></tr>")
+	for _, year := range years {
+		fmt.Fprintf(&page, "<tr><td>%d</td>%s<td>%s</td></tr>", year, strings.Repeat("<td>"+rates[year]+"</td>", 12), rates[year])
+	}
+	page.WriteString("</tbody></table>")
+	return page.String()
+}
+
+func TestBackfill(t *testing.T) {
+	rates := map[int]string{2023: "4.1", 2022: "8.0", 2021: "4.7", 2020: "1.2", 2018: "2.4"}
+	archived := map[int]string{2021: "4.6", 2020: "1.2", 2018: "2.4"}
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/current":
+			fmt.Fprint(w, inflationTable(rates, 2023, 2022, 2021, 2020))
+		case "/archive":
+			fmt.Fprint(w, inflationTable(archived, 2021, 2020, 2018))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer site.Close()
+
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}, Backfill: map[string]crab.BackfillConfig{
+		"inflation": {Pages: []string{site.URL + "/current", site.URL + "/archive"}, From: 2018},
+	}})
+	defer crab.SetConfig(crab.Config{})
+	report, err := crab.Backfill("inflation")
+	if err != nil {
+		t.Fatalf("Backfill() failed: %v", err)
+	}
+	if report.From != 2018 || report.To != 2023 || report.Years != 5 || len(report.Pages) != 2 {
+		t.Errorf("Backfill() = %+v", report)
+	}
+	if !reflect.DeepEqual(report.Gaps, []int{2019}) || report.Continuous() {
+		t.Errorf("gaps = %v, want 2019", report.Gaps)
+	}
+	if len(report.Overlaps) != 2 || report.Overlaps[0].Year != 2020 || len(report.Overlaps[0].Changes) != 0 {
+		t.Fatalf("overlaps = %+v, want 2020 and 2021", report.Overlaps)
+	}
+	if changes := report.Overlaps[1].Changes; len(changes) == 0 || changes[0].Column != "jan" || changes[0].Previous != "4.7" || changes[0].Current != "4.6" {
+		t.Errorf("2021 changes = %+v, want the rates of the current page kept", changes)
+	}
+
+	var series []crab.YearData
+	data, err := os.ReadFile(report.File)
+	if err == nil {
+		err = json.Unmarshal(data, &series)
+	}
+	if err != nil || len(series) != 5 || series[0].Year != "2018" || series[4].Year != "2023" || series[3].Jan != "8.0" || series[2].Jan != "4.7" {
+		t.Errorf("backfilled series = %+v, %v", series, err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(report.File), "inflation_data.backfill.json")); err != nil {
+		t.Errorf("no backfill report: %v", err)
+	}
+
+	// A page that cannot be fetched writes nothing
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}, Backfill: map[string]crab.BackfillConfig{
+		"inflation": {Pages: []string{site.URL + "/current", site.URL + "/missing"}},
+	}})
+	if _, err := crab.Backfill("inflation"); err == nil {
+		t.Error("Backfill() with a missing page succeeded")
+	}
+	if _, err := crab.Backfill("housing"); err == nil {
+		t.Error("Backfill() of a dataset without year tables succeeded")
+	}
+}
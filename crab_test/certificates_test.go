@@ -0,0 +1,106 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCertificateInspector(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+	cert := server.Certificate()
+
+	for _, tc := range []struct {
+		days     int
+		expiring bool
+	}{{0, false}, {100 * 366, true}} {
+		inspector := crab.NewCertificateInspector(crab.CertificateConfig{Enabled: true, ExpiryDays: tc.days})
+		client := &http.Client{Transport: inspector.Transport(server.Client().Transport)}
+		for n := 0; n < 2; n++ {
+			resp, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		}
+		certs := inspector.Certificates()
+		if len(certs) != 1 || certs[0].Host != strings.TrimPrefix(server.URL, "https://") || certs[0].Error != "" {
+			t.Fatalf("Certificates() = %+v, want the server's once", certs)
+		}
+		got := certs[0]
+		if !got.NotAfter.Equal(cert.NotAfter) || got.Issuer != cert.Issuer.String() || got.DaysLeft <= 0 ||
+			!strings.Contains(strings.Join(got.SANs, ","), "127.0.0.1") {
+			t.Errorf("certificate = %+v", got)
+		}
+		if got.Expiring != tc.expiring {
+			t.Errorf("expiring within %d days = %v, want %v", tc.days, got.Expiring, tc.expiring)
+		}
+	}
+}
+
+func TestCrawlCertificates(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<title>Untrusted</title>`)
+	}))
+	defer server.Close()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}, Certificates: crab.CertificateConfig{Enabled: true}})
+	defer crab.SetConfig(crab.Config{})
+
+	// The test server's certificate is not trusted, so the page fails, but its certificate is reported
+	summary := crab.Crawl(context.Background(), []crab.URLData{{URL: server.URL + "/a"}}, 1)
+	if summary.Errors != 1 || len(summary.Certificates) != 1 {
+		t.Fatalf("summary = %+v, want the failed page's certificate", summary)
+	}
+	if cert := summary.Certificates[0]; !strings.Contains(cert.Error, "certificate") || !cert.NotAfter.Equal(server.Certificate().NotAfter) {
+		t.Errorf("certificate = %+v, want the verification error", cert)
+	}
+}
+
+func TestConcurrentCrawlsKeepTheirCertificates(t *testing.T) {
+	newServer := func() *httptest.Server {
+		return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<title>Untrusted</title>`)
+		}))
+	}
+	inspected, other := newServer(), newServer()
+	defer inspected.Close()
+	defer other.Close()
+	crawl := func(server *httptest.Server, certificates crab.CertificateConfig) crab.RunSummary {
+		config := crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}, Certificates: certificates}
+		var urls []crab.URLData
+		for i := 0; i < 4; i++ {
+			urls = append(urls, crab.URLData{URL: fmt.Sprintf("%s/%d", server.URL, i)})
+		}
+		return crab.CrawlWithConfig(context.Background(), func() crab.Config { return config }, urls, 1)
+	}
+
+	var wg sync.WaitGroup
+	var withInspection, withoutInspection crab.RunSummary
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		withInspection = crawl(inspected, crab.CertificateConfig{Enabled: true})
+	}()
+	go func() {
+		defer wg.Done()
+		withoutInspection = crawl(other, crab.CertificateConfig{})
+	}()
+	wg.Wait()
+
+	if certs := withInspection.Certificates; len(certs) != 1 || certs[0].Host != strings.TrimPrefix(inspected.URL, "https://") {
+		t.Errorf("crawl with inspection reported %+v, want only its own host", certs)
+	}
+	if certs := withoutInspection.Certificates; len(certs) != 0 {
+		t.Errorf("crawl without inspection reported %+v", certs)
+	}
+}
@@ -0,0 +1,107 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadGasolineSeries(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gasoline_data.json")
+	data := `[
+  {"year": "1979", "average_gasoline_prices": "0.882"},
+  {"year": "1978", "average_gasoline_prices": "$0.652 "},
+  {"year": "Year", "average_gasoline_prices": "n/a"}
+]`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	points, err := crab.LoadGasolineSeries(path)
+	if err != nil {
+		t.Fatalf("LoadGasolineSeries() error = %v", err)
+	}
+	if len(points) != 2 {
+		t.Fatalf("LoadGasolineSeries() got %d points, want 2", len(points))
+	}
+	if points[0].X != 1978 || points[0].Y != 0.652 {
+		t.Errorf("LoadGasolineSeries() first point = %v, want {1978 0.652}", points[0])
+	}
+}
+
+func TestLoadAirfareSeries(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "airfare_data_inflation.json")
+	data := `{"domain": "airfare", "data": {"year": "2001", "additional_info": {"months_data": [{"month": "Jan", "rate": "1.5"}]}}},
+{"domain": "airfare", "data": {"year": "2000", "additional_info": {"months_data": [{"month": "Jan", "rate": "2.5"}, {"month": "Feb", "rate": ""}]}}}
+`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	points, err := crab.LoadAirfareSeries(path)
+	if err != nil {
+		t.Fatalf("LoadAirfareSeries() error = %v", err)
+	}
+	if len(points) != 2 {
+		t.Fatalf("LoadAirfareSeries() got %d points, want 2", len(points))
+	}
+	if points[0].X != 2000 || points[0].Y != 2.5 {
+		t.Errorf("LoadAirfareSeries() first point = %v, want {2000 2.5}", points[0])
+	}
+}
+
+func TestGenerateTrendCharts(t *testing.T) {
+	dataDir := t.TempDir()
+	outDir := filepath.Join(t.TempDir(), "charts")
+	data := `[{"year": "1978", "average_gasoline_prices": "0.652"}, {"year": "1979", "average_gasoline_prices": "0.882"}]`
+	if err := os.WriteFile(filepath.Join(dataDir, "gasoline_data.json"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	written, err := crab.GenerateTrendCharts(dataDir, outDir, "png", "svg")
+	if err != nil {
+		t.Fatalf("GenerateTrendCharts() error = %v", err)
+	}
+	if len(written) != 2 {
+		t.Fatalf("GenerateTrendCharts() wrote %v, want gasoline png and svg only", written)
+	}
+	for _, path := range written {
+		if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+			t.Errorf("chart %s missing or empty", path)
+		}
+	}
+}
+
+func TestRunFinishRendersCharts(t *testing.T) {
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}, Charts: crab.ChartConfig{Enabled: true, Formats: []string{"svg"}}})
+	defer crab.SetConfig(crab.Config{})
+
+	run, err := crab.StartRun("scrape")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := `[{"year": "1978", "average_gasoline_prices": "0.652"}, {"year": "1979", "average_gasoline_prices": "0.882"}]`
+	dataset := run.Path("gasoline_data.json")
+	if err := os.WriteFile(dataset, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run.Finish([]string{dataset}); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Stat(run.Path("gasoline_trend.svg")); err != nil || info.Size() == 0 {
+		t.Fatalf("chart of the run missing or empty: %v", err)
+	}
+	manifest, err := os.ReadFile(run.Path("manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(manifest), "gasoline_trend.svg") {
+		t.Errorf("manifest does not list the chart: %s", manifest)
+	}
+}
@@ -0,0 +1,110 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// scrapeBooks scrapes a paged listing as the books domain and returns the items of its dataset.
+func scrapeBooks(t *testing.T, outputDir, startURL string) []crab.GenericData {
+	before, _ := filepath.Glob(filepath.Join(outputDir, "2*", "books_data.json"))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	crab.Scrape(startURL, crab.DomainConfig{
+		Name:          "books",
+		ItemSelector:  "div.item",
+		TitleSelector: "span",
+		Pagination:    crab.PaginationConfig{PageParam: "page"},
+	}, &wg)
+	after, _ := filepath.Glob(filepath.Join(outputDir, "2*", "books_data.json"))
+	if len(after) != len(before)+1 {
+		t.Fatalf("the scrape wrote %d datasets, want 1", len(after)-len(before))
+	}
+	sort.Strings(after)
+	data, err := os.ReadFile(after[len(after)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dataset struct {
+		Data []crab.GenericData `json:"data"`
+	}
+	if err := json.Unmarshal(data, &dataset); err != nil {
+		t.Fatal(err)
+	}
+	return dataset.Data
+}
+
+func TestScrapeResumesFromCheckpoint(t *testing.T) {
+	// Four pages of two items, the third of which fails the first time
+	var mu sync.Mutex
+	requests := map[int]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		mu.Lock()
+		requests[page]++
+		failed := page == 3 && requests[page] == 1
+		mu.Unlock()
+		if failed {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		if page > 4 {
+			fmt.Fprint(w, "<html><body></body></html>")
+			return
+		}
+		fmt.Fprint(w, "<html><body>")
+		for i := 1; i <= 2; i++ {
+			fmt.Fprintf(w, `<div class="item"><span>%d-%d</span></div>`, page, i)
+		}
+		fmt.Fprint(w, "</body></html>")
+	}))
+	defer server.Close()
+	outputDir := t.TempDir()
+	crab.SetConfig(crab.Config{
+		Output:      crab.OutputConfig{Dir: outputDir},
+		Checkpoints: crab.CheckpointConfig{Enabled: true},
+	})
+	defer crab.SetConfig(crab.Config{})
+	startURL := server.URL + "/list?page=1"
+
+	if items := scrapeBooks(t, outputDir, startURL); len(items) != 4 {
+		t.Errorf("the failed scrape got %d items, want 4", len(items))
+	}
+	checkpoint, ok, err := crab.LoadScrapeCheckpoint("books")
+	if err != nil || !ok {
+		t.Fatalf("LoadScrapeCheckpoint() = %v, %v", ok, err)
+	}
+	if checkpoint.Pages != 2 || checkpoint.Items != 4 || checkpoint.NextURL != server.URL+"/list?page=3" {
+		t.Errorf("checkpoint = %+v, want 2 pages and 4 items before page 3", checkpoint)
+	}
+
+	items := scrapeBooks(t, outputDir, startURL)
+	var titles []string
+	for _, item := range items {
+		titles = append(titles, item.Title)
+	}
+	want := []string{"1-1", "1-2", "2-1", "2-2", "3-1", "3-2", "4-1", "4-2"}
+	if fmt.Sprint(titles) != fmt.Sprint(want) {
+		t.Errorf("the resumed scrape got %v, want %v", titles, want)
+	}
+	mu.Lock()
+	if requests[1] != 1 || requests[2] != 1 {
+		t.Errorf("pages requested %v, want pages 1 and 2 scraped once", requests)
+	}
+	mu.Unlock()
+	if _, ok, _ := crab.LoadScrapeCheckpoint("books"); ok {
+		t.Error("the checkpoint was kept after the scrape completed")
+	}
+}
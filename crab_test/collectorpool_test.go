@@ -0,0 +1,48 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// collectorCount returns the count of the crab_collectors metric.
+func collectorCount(name string) int64 {
+	if v, ok := expvar.Get("crab_collectors").(*expvar.Map).Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
+
+func TestFetchPageReusesCollectors(t *testing.T) {
+	var withCookie int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("session"); err == nil {
+			atomic.AddInt32(&withCookie, 1)
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: r.URL.Path})
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<title>%s</title>`, r.URL.Path)
+	}))
+	defer server.Close()
+	crab.SetConfig(crab.Config{})
+
+	created, reused := collectorCount("created"), collectorCount("reused")
+	for n := 0; n < 20; n++ {
+		url := fmt.Sprintf("%s/%d", server.URL, n)
+		page := crab.FetchPage(crab.URLData{URL: url})
+		if page.StatusCode != http.StatusOK || string(page.Body) != fmt.Sprintf("<title>/%d</title>", n) {
+			t.Fatalf("FetchPage(%s) = %d %q, want its own page", url, page.StatusCode, page.Body)
+		}
+	}
+	if got := collectorCount("reused") - reused; got == 0 {
+		t.Errorf("no collector was reused over 20 fetches, %d created", collectorCount("created")-created)
+	}
+	if n := atomic.LoadInt32(&withCookie); n != 0 {
+		t.Errorf("%d fetches sent the cookie of an earlier fetch, want none", n)
+	}
+}
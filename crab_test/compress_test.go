@@ -0,0 +1,80 @@
+package crab_test
+
+import (
+	"bytes"
+	"cmpscfa23team2/crab"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGzipOutputs(t *testing.T) {
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Gzip: true}})
+	defer crab.SetConfig(crab.Config{})
+
+	records := []crab.GasolineData{{Year: "2020", AverageGasolinePrices: "$2.17"}}
+	filename, err := crab.WriteRecords(filepath.Join(dir, "gasoline_data.json"), records)
+	if err != nil || filepath.Base(filename) != "gasoline_data.json.gz" {
+		t.Fatalf("WriteRecords() = %q, %v, want gasoline_data.json.gz", filename, err)
+	}
+	raw, _ := os.ReadFile(filename)
+	if len(raw) < 2 || raw[0] != 0x1f || raw[1] != 0x8b {
+		t.Fatalf("%s is not gzipped", filename)
+	}
+
+	// Readers find the compressed file under the uncompressed name.
+	datasets, err := crab.LoadScrapedDatasets(dir)
+	if err != nil {
+		t.Fatalf("LoadScrapedDatasets() error = %v", err)
+	}
+	if len(datasets) != 1 || datasets[0].Rows[0][0] != "2020" {
+		t.Errorf("LoadScrapedDatasets() = %+v", datasets)
+	}
+
+	siteMapFile := filepath.Join(dir, crab.OutputFilename("siteMap.json"))
+	s, _ := crab.CreateStream(siteMapFile, crab.StreamJSONObject)
+	s.WriteEntry("http://a.com/", []string{"http://a.com/1"})
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	siteMap, err := crab.LoadSiteMap(siteMapFile)
+	if err != nil || !reflect.DeepEqual(siteMap, map[string][]string{"http://a.com/": {"http://a.com/1"}}) {
+		t.Errorf("LoadSiteMap(%s) = %v, %v", siteMapFile, siteMap, err)
+	}
+}
+
+func TestObjectStoreSinkGzip(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "siteMap.json"), []byte(`{"http://a.com/":[]}`), 0644)
+
+	var path, contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	sink := &crab.ObjectStoreSink{Endpoint: server.URL, Region: "auto", Bucket: "b", AccessKey: "a", SecretKey: "s", Gzip: true}
+	keys, err := sink.UploadRunOutputs(dir, time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC))
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("UploadRunOutputs() = %v, %v", keys, err)
+	}
+	if path != "/b/2024/03/05/20240305T000000Z/siteMap.json.gz" || contentType != "application/gzip" {
+		t.Errorf("uploaded %s as %s", path, contentType)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("upload is not gzipped: %v", err)
+	}
+	if data, _ := io.ReadAll(gz); string(data) != `{"http://a.com/":[]}` {
+		t.Errorf("decompressed upload = %q", data)
+	}
+}
@@ -0,0 +1,90 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyControllerAIMD(t *testing.T) {
+	controller := crab.NewConcurrencyController()
+	config := crab.ConcurrencyConfig{Adaptive: true, Initial: 2, Max: 4, TargetLatencyMS: 100}
+	round := func(latency time.Duration, failed bool) {
+		limit := controller.Limit("example.com")
+		if limit == 0 {
+			limit = config.Initial
+		}
+		releases := make([]func(time.Duration, bool), limit)
+		for i := range releases {
+			releases[i] = controller.Acquire("example.com", config)
+		}
+		for _, release := range releases {
+			release(latency, failed)
+		}
+	}
+
+	round(10*time.Millisecond, false)
+	round(10*time.Millisecond, false)
+	if limit := controller.Limit("example.com"); limit != 4 {
+		t.Errorf("Limit() after two healthy rounds = %d, want 4", limit)
+	}
+	round(10*time.Millisecond, false)
+	if limit := controller.Limit("example.com"); limit != 4 {
+		t.Errorf("Limit() = %d, want it capped at 4", limit)
+	}
+	release := controller.Acquire("example.com", config)
+	release(10*time.Millisecond, true)
+	if limit := controller.Limit("example.com"); limit != 2 {
+		t.Errorf("Limit() after an error = %d, want it halved to 2", limit)
+	}
+	release = controller.Acquire("example.com", config)
+	release(time.Second, false)
+	if limit := controller.Limit("example.com"); limit != 1 {
+		t.Errorf("Limit() after a slow response = %d, want it halved to 1", limit)
+	}
+	release = controller.Acquire("example.com", config)
+	release(time.Second, false)
+	if limit := controller.Limit("example.com"); limit != 1 {
+		t.Errorf("Limit() = %d, want it kept at the minimum of 1", limit)
+	}
+
+	// With the limit reached, the next request waits for a slot
+	release = controller.Acquire("example.com", config)
+	acquired := make(chan struct{})
+	go func() {
+		controller.Acquire("example.com", config)(time.Millisecond, false)
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("Acquire() did not wait for the only slot")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release(time.Millisecond, false)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Acquire() still waits after the slot was released")
+	}
+}
+
+func TestFetchPageAdaptsConcurrency(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 2, Status: map[string]int{"/page/1": 500}})
+	defer site.Close()
+	crab.SetConfig(crab.Config{Concurrency: crab.ConcurrencyConfig{Adaptive: true, Initial: 4}})
+	defer crab.SetConfig(crab.Config{})
+	siteURL, _ := url.Parse(site.URL)
+	host := siteURL.Host
+
+	crab.FetchPage(crab.URLData{URL: site.PageURL(1)})
+	if limit := crab.DefaultConcurrency.Limit(host); limit != 2 {
+		t.Errorf("Limit() after a server error = %d, want 2", limit)
+	}
+	crab.FetchPage(crab.URLData{URL: site.PageURL(0)})
+	crab.FetchPage(crab.URLData{URL: site.PageURL(0)})
+	if limit := crab.DefaultConcurrency.Limit(host); limit != 3 {
+		t.Errorf("Limit() after a healthy round = %d, want 3", limit)
+	}
+}
@@ -32,6 +32,7 @@ func TestCreateSiteMap(t *testing.T) {
 	defer os.Remove(tmpfile.Name()) // clean up
 
 	err = crab.CreateSiteMap(urls)
+	defer os.Remove("siteMap.json") // CreateSiteMap writes to the working directory
 	if err != nil {
 		t.Errorf("createSiteMap() error = %v", err)
 	}
@@ -0,0 +1,65 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConvertDataset(t *testing.T) {
+	ds := crab.Dataset{Name: "gasoline", Columns: []string{"year", "price"}, Rows: [][]string{{"2022", "$3.95"}, {"2021", ""}}}
+	rate := crab.ExchangeRate{From: "USD", To: "EUR", Rate: 0.5, Date: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}
+	converted := crab.ConvertDataset(ds, []string{"price"}, rate)
+	wantColumns := []string{"year", "price", "currency", "exchange_rate", "rate_date"}
+	want := [][]string{{"2022", "1.98", "EUR", "0.5", "2024-01-02"}, {"2021", "", "EUR", "0.5", "2024-01-02"}}
+	if !reflect.DeepEqual(converted.Columns, wantColumns) || !reflect.DeepEqual(converted.Rows, want) {
+		t.Errorf("ConvertDataset() = %v %v, want %v %v", converted.Columns, converted.Rows, wantColumns, want)
+	}
+	if len(ds.Columns) != 2 || ds.Rows[0][1] != "$3.95" {
+		t.Errorf("ConvertDataset() changed its input: %v %v", ds.Columns, ds.Rows)
+	}
+}
+
+func TestRateSources(t *testing.T) {
+	static := crab.StaticRates{Rates: map[string]float64{"EUR": 0.8}}
+	if rate, err := static.Rate("usd", "eur"); err != nil || rate.Rate != 0.8 || rate.To != "EUR" {
+		t.Errorf("StaticRates.Rate(USD, EUR) = %+v, %v", rate, err)
+	}
+	if rate, err := static.Rate("EUR", "USD"); err != nil || rate.Rate != 1.25 {
+		t.Errorf("StaticRates.Rate(EUR, USD) = %+v, %v", rate, err)
+	}
+	if _, err := static.Rate("USD", "JPY"); err == nil {
+		t.Error("StaticRates.Rate() of an unknown currency succeeded")
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Query().Get("from") != "USD" || r.URL.Query().Get("to") != "GBP" {
+			http.Error(w, "unexpected query "+r.URL.RawQuery, http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"amount": 1, "base": "USD", "date": "2024-03-01", "rates": {"GBP": 0.79}}`))
+	}))
+	defer server.Close()
+	crab.SetConfig(crab.Config{Currency: crab.CurrencyConfig{RatesURL: server.URL + "/latest"}})
+	defer crab.SetConfig(crab.Config{})
+
+	ds := crab.Dataset{Name: "housing", Columns: []string{"city", "price"}, Rows: [][]string{{"Adjuntas", "105000"}}}
+	for i := 0; i < 2; i++ {
+		converted, err := crab.ConvertScrapedDataset(ds, "gbp")
+		want := []string{"Adjuntas", "82950", "GBP", "0.79", "2024-03-01"}
+		if err != nil || !reflect.DeepEqual(converted.Rows[0], want) {
+			t.Errorf("ConvertScrapedDataset() = %v, %v, want %v", converted.Rows, err, want)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("rate service got %d requests, want 1 with the rate cached", requests)
+	}
+	if _, err := crab.ConvertScrapedDataset(crab.Dataset{Name: "inflation"}, "EUR"); err == nil {
+		t.Error("ConvertScrapedDataset() of a dataset without prices succeeded")
+	}
+}
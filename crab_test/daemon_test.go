@@ -0,0 +1,132 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyEnv(t *testing.T) {
+	config := crab.Config{Output: crab.OutputConfig{Dir: "from-file", Retain: 3}}
+	err := crab.ApplyEnv(&config, []string{
+		"CRAB_OUTPUT_DIR=/data",
+		"CRAB_PIPELINE_FETCH_TIMEOUT=5s",
+		"CRAB_RESPECT_ROBOTS=true",
+		"CRAB_SEEDS=https://a.example/, https://b.example/",
+		"CRAB_CONCURRENCY_MAX_ERROR_RATE=0.25",
+		"CRAB_DAEMON_WORKERS=4",
+		"PATH=/usr/bin",
+	})
+	if err != nil {
+		t.Fatalf("ApplyEnv() failed: %v", err)
+	}
+	if config.Output.Dir != "/data" || config.Output.Retain != 3 {
+		t.Errorf("output = %+v, want the dir from the environment and retain from the file", config.Output)
+	}
+	if config.Pipeline.FetchTimeout != "5s" || !config.RespectRobots || config.Daemon.Workers != 4 || config.Concurrency.MaxErrorRate != 0.25 {
+		t.Errorf("ApplyEnv() = %+v", config)
+	}
+	if want := []string{"https://a.example/", "https://b.example/"}; !reflect.DeepEqual(config.Seeds, want) {
+		t.Errorf("seeds = %v, want %v", config.Seeds, want)
+	}
+	if err := crab.ApplyEnv(&config, []string{"CRAB_DAEMON_WORKERS=many"}); err == nil || !strings.Contains(err.Error(), "CRAB_DAEMON_WORKERS") {
+		t.Errorf("ApplyEnv() of a bad number = %v", err)
+	}
+}
+
+func TestDaemonEndpoints(t *testing.T) {
+	queue := crab.NewJobQueue(crab.NewMemoryJobStore())
+	server := httptest.NewServer(crab.NewDaemon(crab.DaemonConfig{}, queue).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var health struct {
+		Status string `json:"status"`
+	}
+	json.NewDecoder(resp.Body).Decode(&health)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || health.Status != "ok" {
+		t.Errorf("/healthz = %d %q, want 200 ok", resp.StatusCode, health.Status)
+	}
+
+	crab.NewTrapDetector(crab.TrapConfig{Enabled: true, MaxURLLength: 10}).Check("https://example.com/long")
+	resp, err = http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, want := range []string{"# TYPE crab_traps gauge\n", `crab_traps{key="url-length"} `} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("/metrics has no %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(string(body), "memstats") {
+		t.Error("/metrics has the memstats")
+	}
+
+	// Without API keys the daemon is read-only
+	resp, err = http.Post(server.URL+"/jobs", "application/json", strings.NewReader(`{"type": "unknown"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("POST /jobs without API keys = %d, want 403", resp.StatusCode)
+	}
+
+	crab.SetConfig(crab.Config{API: crab.APIConfig{Keys: []crab.APIKey{{Name: "ci", Key: "ci-key", Role: "operator"}}}})
+	defer crab.SetConfig(crab.Config{})
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/jobs", strings.NewReader(`{"type": "unknown"}`))
+	req.Header.Set("X-API-Key", "ci-key")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /jobs of an unknown type = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestDaemonDrainsJobsOnShutdown(t *testing.T) {
+	queue := crab.NewJobQueue(crab.NewMemoryJobStore())
+	started := make(chan struct{})
+	queue.Register("slow", func(ctx context.Context, job crab.Job) error {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	})
+	job, err := queue.Enqueue("slow", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- crab.NewDaemon(crab.DaemonConfig{Addr: "127.0.0.1:0", ShutdownTimeout: "5s"}, queue).Run(ctx)
+	}()
+	<-started
+	stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run() = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return after the job finished")
+	}
+	if job, _ = queue.Get(job.ID); job.State != crab.JobSucceeded {
+		t.Errorf("the running job ended %s, want it to finish", job.State)
+	}
+}
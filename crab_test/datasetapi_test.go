@@ -0,0 +1,81 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDatasetAPI(t *testing.T) {
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+	defer crab.UseFixtures(filepath.Join(fixturesDir, "inflation"), false)()
+	crab.ScrapeInflationData()
+	server := httptest.NewServer(crab.NewDaemon(crab.DaemonConfig{}, crab.NewJobQueue(crab.NewMemoryJobStore())).Handler())
+	defer server.Close()
+
+	get := func(path, accept string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := get("/api/datasets", "")
+	var datasets []crab.DatasetInfo
+	json.NewDecoder(resp.Body).Decode(&datasets)
+	resp.Body.Close()
+	if len(datasets) != 1 || datasets[0].Name != "inflation" || datasets[0].Rows == 0 || datasets[0].RunID == "" {
+		t.Fatalf("GET /api/datasets = %+v", datasets)
+	}
+
+	resp = get("/api/datasets/inflation?from=2022&to=2023&columns=year,avg", "")
+	var ds crab.Dataset
+	json.NewDecoder(resp.Body).Decode(&ds)
+	resp.Body.Close()
+	if resp.Header.Get("X-Total-Count") != "2" || len(ds.Rows) != 2 || strings.Join(ds.Columns, ",") != "year,avg" {
+		t.Errorf("from 2022 to 2023 = %s rows, %v %v", resp.Header.Get("X-Total-Count"), ds.Columns, ds.Rows)
+	}
+	for _, row := range ds.Rows {
+		if year, _ := strconv.Atoi(strings.TrimSpace(row[0])); year < 2022 || year > 2023 {
+			t.Errorf("row %v is outside 2022 to 2023", row)
+		}
+	}
+
+	resp = get("/api/datasets/inflation?from=2021&limit=2", "text/csv")
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	resp.Body.Close()
+	if err != nil || resp.Header.Get("Content-Type") != "text/csv" || len(records) != 3 || records[0][0] != "year" {
+		t.Errorf("CSV page = %s %v, %v", resp.Header.Get("Content-Type"), records, err)
+	}
+	if link := resp.Header.Get("Link"); !strings.Contains(link, "offset=2") || !strings.Contains(link, `rel="next"`) {
+		t.Errorf("Link = %q, want the next page", link)
+	}
+
+	for path, want := range map[string]int{
+		"/api/datasets/inflation?format=xml": http.StatusNotAcceptable,
+		"/api/datasets/inflation?from=later": http.StatusBadRequest,
+		"/api/datasets/inflation?columns=x":  http.StatusBadRequest,
+		"/api/datasets/gasoline":             http.StatusNotFound,
+	} {
+		if resp := get(path, ""); resp.StatusCode != want {
+			t.Errorf("GET %s = %d, want %d", path, resp.StatusCode, want)
+		}
+	}
+	if resp := get("/api/datasets/inflation", "application/xml"); resp.StatusCode != http.StatusNotAcceptable {
+		t.Errorf("GET accepting XML = %d, want 406", resp.StatusCode)
+	}
+}
@@ -0,0 +1,45 @@
+package crab_test
+
+import (
+	"bytes"
+	"cmpscfa23team2/crab"
+	"reflect"
+	"testing"
+)
+
+func TestNewDataset(t *testing.T) {
+	ds, err := crab.NewDataset("gasoline", []crab.GasolineData{{Year: "1978", AverageGasolinePrices: " 0.652 "}})
+	if err != nil {
+		t.Fatalf("NewDataset() error = %v", err)
+	}
+	wantColumns := []string{"year", "average_gasoline_prices", "average_annual_cpi_for_gas", "gas_prices_adjusted_for_inflation"}
+	if !reflect.DeepEqual(ds.Columns, wantColumns) {
+		t.Errorf("NewDataset() columns = %v, want %v", ds.Columns, wantColumns)
+	}
+	if !reflect.DeepEqual(ds.Rows, [][]string{{"1978", "0.652", "", ""}}) {
+		t.Errorf("NewDataset() rows = %v", ds.Rows)
+	}
+
+	if _, err := crab.NewDataset("bad", "not a slice"); err == nil {
+		t.Errorf("NewDataset() with a string should fail")
+	}
+}
+
+func TestDiffDatasets(t *testing.T) {
+	previous := crab.Dataset{Name: "gasoline", Columns: []string{"year", "price"}, Rows: [][]string{{"1978", "0.65"}, {"1979", "0.88"}}}
+	current := crab.Dataset{Name: "gasoline", Columns: []string{"year", "price"}, Rows: [][]string{{"1979", "0.88"}, {"1980", "1.22"}}}
+
+	diff := crab.DiffDatasets(previous, current)
+	want := [][]string{{"added", "1980", "1.22"}, {"removed", "1978", "0.65"}}
+	if !reflect.DeepEqual(diff.Rows, want) {
+		t.Errorf("DiffDatasets() rows = %v, want %v", diff.Rows, want)
+	}
+
+	var buf bytes.Buffer
+	if err := diff.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	if got := buf.String(); got != "change,year,price\nadded,1980,1.22\nremoved,1978,0.65\n" {
+		t.Errorf("WriteCSV() = %q", got)
+	}
+}
@@ -0,0 +1,112 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/crab/client"
+	"cmpscfa23team2/internal/testsite"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugEndpoints(t *testing.T) {
+	crab.SetConfig(crab.Config{API: crab.APIConfig{Keys: []crab.APIKey{
+		{Name: "dashboard", Key: "view-key", Role: "viewer"},
+		{Name: "oncall", Key: "admin-key", Role: "admin"},
+	}}})
+	defer crab.SetConfig(crab.Config{})
+	server := httptest.NewServer(crab.NewDaemon(crab.DaemonConfig{}, crab.NewJobQueue(crab.NewMemoryJobStore())).Handler())
+	defer server.Close()
+	ctx := context.Background()
+	admin := &client.Client{BaseURL: server.URL, APIKey: "admin-key"}
+	viewer := &client.Client{BaseURL: server.URL, APIKey: "view-key"}
+
+	var apiErr *client.Error
+	if _, err := viewer.GetDebugState(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Errorf("GetDebugState() as a viewer = %v, want 403", err)
+	}
+	if _, err := viewer.GetProfile(ctx, "heap", client.GetProfileParams{}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Errorf("GetProfile() as a viewer = %v, want 403", err)
+	}
+
+	state, err := admin.GetDebugState(ctx)
+	if err != nil || state.Goroutines == 0 {
+		t.Fatalf("GetDebugState() = %+v, %v", state, err)
+	}
+	found := false
+	for _, cache := range state.Caches {
+		found = found || cache.Name == "fetch_collectors"
+	}
+	if !found {
+		t.Errorf("caches = %+v, want the pool of fetch collectors", state.Caches)
+	}
+
+	if index, err := admin.GetProfile(ctx, "", client.GetProfileParams{}); err != nil || !strings.Contains(string(index), "goroutine") {
+		t.Errorf("GetProfile() index = %q, %v", index, err)
+	}
+	if profile, err := admin.GetProfile(ctx, "goroutine", client.GetProfileParams{Debug: 1}); err != nil || !strings.HasPrefix(string(profile), "goroutine profile:") {
+		t.Errorf("GetProfile(goroutine) = %.40q, %v", profile, err)
+	}
+	if profile, err := admin.GetProfile(ctx, "heap", client.GetProfileParams{Gc: 1}); err != nil || len(profile) == 0 {
+		t.Errorf("GetProfile(heap) = %d bytes, %v", len(profile), err)
+	}
+	if _, err := admin.GetProfile(ctx, "missing", client.GetProfileParams{}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("GetProfile() of an unknown profile = %v, want 404", err)
+	}
+	if _, err := admin.GetProfile(ctx, "profile", client.GetProfileParams{Seconds: 1000}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("GetProfile() for too long = %v, want 400", err)
+	}
+}
+
+func TestDebugEndpointsNeedAPIAuth(t *testing.T) {
+	crab.SetConfig(crab.Config{})
+	server := httptest.NewServer(crab.NewDaemon(crab.DaemonConfig{}, crab.NewJobQueue(crab.NewMemoryJobStore())).Handler())
+	defer server.Close()
+	ctx := context.Background()
+	anonymous := client.New(server.URL)
+
+	var apiErr *client.Error
+	if _, err := anonymous.GetDebugState(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Errorf("GetDebugState() without API auth = %v, want 403", err)
+	}
+	for _, profile := range []string{"", "heap", "goroutine", "profile", "trace"} {
+		if _, err := anonymous.GetProfile(ctx, profile, client.GetProfileParams{Seconds: 1}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+			t.Errorf("GetProfile(%q) without API auth = %v, want 403", profile, err)
+		}
+	}
+}
+
+func TestDebugStateOfCrawl(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 3, Slow: map[string]time.Duration{"/page/0": 500 * time.Millisecond}})
+	defer site.Close()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}, Pipeline: crab.PipelineConfig{FetchWorkers: 1, ParseWorkers: 1}})
+	defer crab.SetConfig(crab.Config{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		crab.Crawl(context.Background(), []crab.URLData{{URL: site.PageURL(0)}, {URL: site.PageURL(1)}, {URL: site.PageURL(2)}}, 1)
+	}()
+	var crawl crab.CrawlDebugState
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if state := crab.CurrentDebugState(); len(state.Crawls) == 1 && state.Crawls[0].Workers[0].State == "busy" {
+			crawl = state.Crawls[0]
+			break
+		}
+	}
+	<-done
+	if len(crawl.Workers) != 2 || crawl.Workers[0].Stage != "fetch" || crawl.Workers[0].URL != site.PageURL(0) || crawl.Workers[1].Stage != "parse" {
+		t.Fatalf("workers = %+v, want the fetcher busy with the slow page and a parser", crawl.Workers)
+	}
+	// The page after the slow one may have left the frontier to wait for the fetcher
+	if crawl.Frontier < 1 || crawl.Domains["127.0.0.1"] != crawl.Frontier {
+		t.Errorf("frontier = %d %v, want the pages after the slow one", crawl.Frontier, crawl.Domains)
+	}
+	if state := crab.CurrentDebugState(); len(state.Crawls) != 0 {
+		t.Errorf("crawls after the crawl = %+v, want none", state.Crawls)
+	}
+}
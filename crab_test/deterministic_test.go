@@ -0,0 +1,108 @@
+package crab_test
+
+import (
+	"bytes"
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeterministicCrawl(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 6, Links: testsite.Complete(6)})
+	defer site.Close()
+
+	crawl := func(order ...int) ([]byte, []string) {
+		site.Reset()
+		dir := t.TempDir()
+		crab.SetConfig(crab.Config{
+			Output:        crab.OutputConfig{Dir: dir},
+			Fingerprint:   crab.FingerprintConfig{RandomizeHeaders: true},
+			Deterministic: crab.DeterministicConfig{Enabled: true, Seed: 42},
+		})
+		urls := make([]crab.URLData, len(order))
+		for i, page := range order {
+			urls[i] = crab.URLData{URL: site.PageURL(page)}
+		}
+		crab.ThreadedCrawl(urls, 10)
+
+		runs, err := crab.ListRuns(dir)
+		if err != nil || len(runs) != 1 {
+			t.Fatalf("ListRuns() = %v, %v", runs, err)
+		}
+		siteMap, err := os.ReadFile(filepath.Join(dir, runs[0], "siteMap.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fingerprints []string
+		for _, r := range site.Requests() {
+			fingerprints = append(fingerprints, r.Path+" "+r.UserAgent+" "+r.Header.Get("Accept-Language")+" "+r.Header.Get("DNT"))
+		}
+		return siteMap, fingerprints
+	}
+	defer crab.SetConfig(crab.Config{})
+
+	firstMap, firstRequests := crawl(3, 0, 5, 1)
+	secondMap, secondRequests := crawl(1, 5, 0, 3)
+	if !bytes.Equal(firstMap, secondMap) {
+		t.Errorf("sitemaps differ:\n%s\n%s", firstMap, secondMap)
+	}
+	if !reflect.DeepEqual(firstRequests, secondRequests) {
+		t.Errorf("requests differ:\n%v\n%v", firstRequests, secondRequests)
+	}
+	if len(firstRequests) != 4 || !strings.HasPrefix(firstRequests[0], "/page/0 ") {
+		t.Errorf("requests = %v, want the four seeds in sorted order", firstRequests)
+	}
+}
+
+func TestDeterministicCrawlDelays(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 5})
+	defer site.Close()
+
+	// gaps crawls the pages under a random rate limit and returns the time between its requests.
+	gaps := func(seed int64) []time.Duration {
+		site.Reset()
+		crab.SetConfig(crab.Config{
+			Output:        crab.OutputConfig{Dir: t.TempDir()},
+			RateLimit:     crab.RateLimitConfig{RandomDelayMS: 250},
+			Deterministic: crab.DeterministicConfig{Enabled: true, Seed: seed},
+		})
+		var urls []crab.URLData
+		for page := 0; page < 5; page++ {
+			urls = append(urls, crab.URLData{URL: site.PageURL(page)})
+		}
+		crab.ThreadedCrawl(urls, 10)
+		requests := site.Requests()
+		var gaps []time.Duration
+		for i := 1; i < len(requests); i++ {
+			gaps = append(gaps, requests[i].Time.Sub(requests[i-1].Time))
+		}
+		return gaps
+	}
+	defer crab.SetConfig(crab.Config{})
+
+	first, second := gaps(7), gaps(7)
+	if len(first) != 4 || len(second) != 4 {
+		t.Fatalf("gaps = %v and %v, want the four between five requests", first, second)
+	}
+	const slack = 60 * time.Millisecond // For the scheduling of the requests
+	shortest, longest := first[0], first[0]
+	for i := range first {
+		if diff := first[i] - second[i]; diff > slack || diff < -slack {
+			t.Errorf("delay %d = %v, then %v with the same seed", i, first[i], second[i])
+		}
+		if first[i] < shortest {
+			shortest = first[i]
+		}
+		if first[i] > longest {
+			longest = first[i]
+		}
+	}
+	if longest-shortest < slack {
+		t.Errorf("delays = %v, want them drawn at random", first)
+	}
+}
@@ -0,0 +1,118 @@
+package crab_test
+
+import (
+	"bufio"
+	"cmpscfa23team2/crab"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSMTP accepts mail on a local port and keeps the DATA of every message it is sent.
+type fakeSMTP struct {
+	net.Listener
+	mu       sync.Mutex
+	messages []string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeSMTP{Listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	fmt.Fprint(conn, "220 localhost\r\n")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch command := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(command, "DATA"):
+			fmt.Fprint(conn, "354 go ahead\r\n")
+			var message strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				message.WriteString(line)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, message.String())
+			s.mu.Unlock()
+			fmt.Fprint(conn, "250 queued\r\n")
+		case strings.HasPrefix(command, "QUIT"):
+			fmt.Fprint(conn, "221 bye\r\n")
+			return
+		default:
+			fmt.Fprint(conn, "250 ok\r\n")
+		}
+	}
+}
+
+// Messages returns the messages received so far.
+func (s *fakeSMTP) Messages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+func TestFinishedRunsEmailTheirReport(t *testing.T) {
+	rows := `<tr><td>1978</td><td>0.652</td></tr>`
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<h2>Gas prices</h2><table><tr><th>Year</th><th>Average Gasoline Prices</th></tr>%s</table>`, rows)
+	}))
+	defer site.Close()
+	mail := newFakeSMTP(t)
+	host, port, _ := net.SplitHostPort(mail.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+	crab.SetConfig(crab.Config{
+		Output:       crab.OutputConfig{Dir: t.TempDir()},
+		Email:        crab.EmailConfig{Host: host, Port: portNumber, From: "crab@example.com", Recipients: map[string][]string{"pump": {"ops@example.com"}}},
+		TableTargets: []crab.TableTarget{{Name: "pump", URL: site.URL, Tables: []crab.NamedTable{{Name: "gasoline"}}}},
+	})
+	defer crab.SetConfig(crab.Config{})
+
+	if err := crab.RunScraper("pump"); err != nil {
+		t.Fatal(err)
+	}
+	rows += `<tr><td>1979</td><td>0.882</td></tr>`
+	if err := crab.RunScraper("pump"); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := mail.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("sent %d report emails, want one per run", len(messages))
+	}
+	for _, attachment := range []string{`filename="gasoline.csv"`, `filename="gasoline_diff.csv"`} {
+		if !strings.Contains(messages[1], attachment) {
+			t.Errorf("second report does not attach %s:\n%s", attachment, messages[1])
+		}
+	}
+}
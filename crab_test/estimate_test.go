@@ -0,0 +1,80 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEstimateCrawl(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /private\nCrawl-delay: 20\nSitemap: %s/sitemap_index.xml\n", server.URL)
+		case "/sitemap_index.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/sitemap1.xml</loc></sitemap></sitemapindex>`, server.URL)
+		case "/sitemap1.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%[1]s/a</loc></url><url><loc>%[1]s/private/b</loc></url><url><loc>%[1]s/c</loc></url></urlset>`, server.URL)
+		case "/private/b":
+			t.Error("EstimateCrawl() sampled a page disallowed by robots.txt")
+		default:
+			fmt.Fprint(w, strings.Repeat("x", 1000))
+		}
+	}))
+	defer server.Close()
+
+	estimate, err := crab.EstimateCrawl(server.URL+"/", crab.EstimateOptions{SampleSize: 5, Delay: time.Second})
+	if err != nil {
+		t.Fatalf("EstimateCrawl() error = %v", err)
+	}
+	if !estimate.RobotsFound || estimate.CrawlDelay != 20*time.Second || estimate.Disallowed {
+		t.Errorf("robots.txt = found %v, delay %v, disallowed %v", estimate.RobotsFound, estimate.CrawlDelay, estimate.Disallowed)
+	}
+	if estimate.SitemapURLs != 3 || estimate.ProjectedPages != 3 {
+		t.Errorf("SitemapURLs = %d, ProjectedPages = %d, want 3", estimate.SitemapURLs, estimate.ProjectedPages)
+	}
+	if estimate.SampledPages != 3 || estimate.AvgPageBytes != 1000 {
+		t.Errorf("SampledPages = %d, AvgPageBytes = %d, want 3 pages of 1000 bytes", estimate.SampledPages, estimate.AvgPageBytes)
+	}
+	if estimate.ProjectedBytes != 3000 {
+		t.Errorf("ProjectedBytes = %d, want 3000", estimate.ProjectedBytes)
+	}
+	// The robots.txt crawl delay is longer than the requested delay, so it sets the pace.
+	if estimate.ProjectedDuration < 60*time.Second || estimate.ProjectedDuration > 61*time.Second {
+		t.Errorf("ProjectedDuration = %v, want about 60s", estimate.ProjectedDuration)
+	}
+	if summary := estimate.Summary(); !strings.Contains(summary, "projected pages: 3") {
+		t.Errorf("Summary() = %q", summary)
+	}
+}
+
+func TestEstimateCrawlWithoutSitemap(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<html><a href="/1">1</a><a href="/2">2</a></html>`)
+	}))
+	defer server.Close()
+
+	estimate, err := crab.EstimateCrawl(server.URL, crab.EstimateOptions{})
+	if err != nil {
+		t.Fatalf("EstimateCrawl() error = %v", err)
+	}
+	if estimate.RobotsFound || estimate.SitemapURLs != 0 || estimate.ProjectedPages != 3 {
+		t.Errorf("EstimateCrawl() = %+v, want the start page and its two links", estimate)
+	}
+	if len(estimate.Notes) != 2 {
+		t.Errorf("Notes = %q, want notes about robots.txt and the sitemap", estimate.Notes)
+	}
+
+	if _, err := crab.EstimateCrawl("not a url", crab.EstimateOptions{}); err == nil {
+		t.Error("EstimateCrawl() accepted an invalid URL")
+	}
+}
@@ -0,0 +1,66 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCrawlEventLog(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 3})
+	defer site.Close()
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+
+	urls := []crab.URLData{{URL: site.PageURL(0)}, {URL: site.PageURL(1)}, {URL: site.PageURL(2)}}
+	summary := crab.Crawl(context.Background(), urls, 2)
+	if summary.Error != "" {
+		t.Fatalf("Crawl() error = %s", summary.Error)
+	}
+	events, err := crab.LoadEvents(dir, "")
+	if err != nil {
+		t.Fatalf("LoadEvents() error = %v", err)
+	}
+
+	types := map[string][]string{}
+	for _, event := range events {
+		if event.RunID != summary.RunID || event.ID != crab.EventID(event.URL) || event.Time.IsZero() {
+			t.Errorf("event %+v, want run %s and the ID of its URL", event, summary.RunID)
+		}
+		types[event.URL] = append(types[event.URL], event.Type)
+	}
+	want := []string{crab.EventURLEnqueued, crab.EventFetchStarted, crab.EventFetchCompleted, crab.EventExtractCompleted, crab.EventStored}
+	for _, u := range urls {
+		if got := types[u.URL]; !reflect.DeepEqual(got, want) {
+			t.Errorf("events of %s = %v, want %v", u.URL, got, want)
+		}
+	}
+}
+
+func TestReadEventsSkipsCutLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	log, err := crab.OpenEventLog(path, "run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Emit(crab.CrawlEvent{Type: crab.EventURLEnqueued, URL: "https://example.com/"})
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"type":"fetch_sta`) // A crash mid-write
+	f.Close()
+
+	events, err := crab.ReadEvents(path)
+	if err != nil || len(events) != 1 || events[0].RunID != "run" || events[0].ID != crab.EventID("https://example.com/") {
+		t.Errorf("ReadEvents() = %+v, %v, want the one complete event", events, err)
+	}
+}
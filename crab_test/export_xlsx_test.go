@@ -0,0 +1,61 @@
+package crab_test
+
+import (
+	"archive/zip"
+	"cmpscfa23team2/crab"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportXLSX(t *testing.T) {
+	gas, err := crab.NewDataset("gasoline", []crab.GasolineData{
+		{Year: "1978", AverageGasolinePrices: "0.652", GasPricesAdjustedForInfl: "$4.37"},
+	})
+	if err != nil {
+		t.Fatalf("NewDataset() error = %v", err)
+	}
+	inflation, err := crab.NewDataset("inflation", []crab.YearData{{Year: "2023", Jan: "6.4"}})
+	if err != nil {
+		t.Fatalf("NewDataset() error = %v", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "run.xlsx")
+	if err := crab.ExportXLSX([]crab.Dataset{gas, inflation}, filename); err != nil {
+		t.Fatalf("ExportXLSX() error = %v", err)
+	}
+
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		t.Fatalf("workbook is not a valid zip: %v", err)
+	}
+	defer zr.Close()
+
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(content)
+	}
+
+	workbook := parts["xl/workbook.xml"]
+	if !strings.Contains(workbook, `name="gasoline"`) || !strings.Contains(workbook, `name="inflation"`) {
+		t.Errorf("workbook.xml missing sheet names: %s", workbook)
+	}
+
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	if !strings.Contains(sheet, `state="frozen"`) {
+		t.Errorf("sheet1 header row is not frozen")
+	}
+	if !strings.Contains(sheet, `<c r="B2"><v>0.652</v></c>`) {
+		t.Errorf("sheet1 price cell is not numeric: %s", sheet)
+	}
+	if !strings.Contains(sheet, `$4.37`) {
+		t.Errorf("sheet1 missing text cell: %s", sheet)
+	}
+}
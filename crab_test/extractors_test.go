@@ -0,0 +1,81 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestExtractorFor(t *testing.T) {
+	noop := crab.ExtractorFunc(func(page *crab.ExtractorPage) ([]map[string]interface{}, error) { return nil, nil })
+	for name, pattern := range map[string]string{
+		"shop":     "shop.example.com",
+		"products": "shop.example.com/products/**",
+		"product":  "shop.example.com/products/*/reviews",
+		"any":      "*.example.com",
+	} {
+		if err := crab.RegisterExtractor(name, pattern, noop); err != nil {
+			t.Fatalf("RegisterExtractor(%s) error = %v", pattern, err)
+		}
+		defer crab.UnregisterExtractor(name)
+	}
+
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://shop.example.com/", "shop"},
+		{"https://SHOP.example.com/cart", "shop"},
+		{"https://shop.example.com/products", "products"},
+		{"https://shop.example.com/products/42/specs", "products"},
+		{"https://shop.example.com/products/42/reviews", "product"},
+		{"https://blog.example.com/post/1", "any"},
+		{"https://example.org/", ""},
+	}
+	for _, test := range tests {
+		name, _, ok := crab.ExtractorFor(test.url)
+		if name != test.want || ok != (test.want != "") {
+			t.Errorf("ExtractorFor(%s) = %q, %v, want %q", test.url, name, ok, test.want)
+		}
+	}
+
+	if err := crab.RegisterExtractor("bad", "/no-host", noop); err == nil {
+		t.Errorf("RegisterExtractor() of a pattern without a host succeeded")
+	}
+	if err := crab.RegisterExtractor("bad", "example.com/a/**/b", noop); err == nil {
+		t.Errorf("RegisterExtractor() of ** within a path succeeded")
+	}
+}
+
+func TestParsePageRunsExtractor(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 2})
+	defer site.Close()
+	siteURL, _ := url.Parse(site.URL)
+
+	crab.RegisterExtractor("links", siteURL.Hostname()+"/page/0", crab.ExtractorFunc(func(page *crab.ExtractorPage) ([]map[string]interface{}, error) {
+		doc, err := page.Document()
+		if err != nil {
+			return nil, err
+		}
+		return []map[string]interface{}{{"links": doc.Find("a").Length()}}, nil
+	}))
+	defer crab.UnregisterExtractor("links")
+	crab.RegisterExtractor("broken", siteURL.Hostname()+"/page/1", crab.ExtractorFunc(func(page *crab.ExtractorPage) ([]map[string]interface{}, error) {
+		return nil, errors.New("unexpected layout")
+	}))
+	defer crab.UnregisterExtractor("broken")
+
+	result := crab.ParsePage(crab.FetchPage(crab.URLData{URL: site.PageURL(0)}))
+	if len(result.Records) != 1 || result.Records[0].Extractor != "links" || result.Records[0].URL != site.PageURL(0) ||
+		result.Records[0].Fields["links"] != 1 {
+		t.Errorf("ParsePage() records = %+v", result.Records)
+	}
+	if len(result.Links) != 1 {
+		t.Errorf("ParsePage() links = %v, want the link to page 1", result.Links)
+	}
+	if result := crab.ParsePage(crab.FetchPage(crab.URLData{URL: site.PageURL(1)})); len(result.Records) != 0 || result.Error == "" {
+		t.Errorf("ParsePage() of a failing extractor = %+v", result)
+	}
+}
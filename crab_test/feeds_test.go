@@ -0,0 +1,126 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testRSS = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>News</title>
+<item><title>First</title><link>https://example.com/news/1</link><guid>news-1</guid><pubDate>Tue, 02 Jan 2024 15:04:05 +0000</pubDate></item>
+<item><title>Second</title><link>/news/2</link></item>
+</channel></rss>`
+
+const testAtom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>Blog</title>
+<entry><title>Post</title><id>urn:post:1</id><updated>2024-01-02T15:04:05Z</updated>
+<link rel="self" href="https://example.com/feed/post-1"/><link rel="alternate" href="https://example.com/post-1"/></entry>
+</feed>`
+
+const testRDF = `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel><title>Old</title></channel>
+<item><title>Item</title><link>https://example.com/item</link><dc:date>2024-01-02T15:04:05Z</dc:date></item>
+</rdf:RDF>`
+
+func TestParseFeed(t *testing.T) {
+	entries, err := crab.ParseFeed([]byte(testRSS), "https://example.com/feed.xml")
+	if err != nil {
+		t.Fatalf("ParseFeed(RSS) error = %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != "news-1" || entries[0].Published.Year() != 2024 {
+		t.Fatalf("ParseFeed(RSS) = %+v", entries)
+	}
+	if entries[1].Link != "https://example.com/news/2" || entries[1].ID != entries[1].Link {
+		t.Errorf("relative RSS link = %+v, want resolved link used as ID", entries[1])
+	}
+
+	entries, err = crab.ParseFeed([]byte(testAtom), "https://example.com/atom.xml")
+	if err != nil || len(entries) != 1 || entries[0].Link != "https://example.com/post-1" || entries[0].ID != "urn:post:1" {
+		t.Errorf("ParseFeed(Atom) = %+v, %v", entries, err)
+	}
+
+	entries, err = crab.ParseFeed([]byte(testRDF), "https://example.com/rdf.xml")
+	if err != nil || len(entries) != 1 || entries[0].Link != "https://example.com/item" || entries[0].Published.IsZero() {
+		t.Errorf("ParseFeed(RSS 1.0) = %+v, %v", entries, err)
+	}
+
+	if _, err := crab.ParseFeed([]byte("<html></html>"), "https://example.com/"); err == nil {
+		t.Error("ParseFeed() accepted an HTML page")
+	}
+}
+
+func TestFeedSource(t *testing.T) {
+	var mu sync.Mutex
+	feed := testRSS
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprint(w, feed)
+	}))
+	defer server.Close()
+
+	stateFile := filepath.Join(t.TempDir(), "feed_state.json")
+	feeds := []crab.FeedConfig{{URL: server.URL + "/feed.xml"}}
+	source := crab.NewFeedSource(feeds, stateFile)
+	urls, err := source.Discover(context.Background())
+	if err != nil || len(urls) != 2 {
+		t.Fatalf("first Discover() = %v, %v, want both entries", urls, err)
+	}
+
+	mu.Lock()
+	feed = testAtom
+	mu.Unlock()
+	if urls, _ := source.Discover(context.Background()); len(urls) != 0 {
+		t.Errorf("Discover() before the interval elapsed = %v, want nothing", urls)
+	}
+
+	// New sources with the same state file remember what the first one saw.
+	mu.Lock()
+	feed = testRSS
+	mu.Unlock()
+	if urls, _ := crab.NewFeedSource(feeds, stateFile).Discover(context.Background()); len(urls) != 0 {
+		t.Errorf("Discover() of seen entries after restart = %v, want nothing", urls)
+	}
+	mu.Lock()
+	feed = testAtom
+	mu.Unlock()
+	urls, err = crab.NewFeedSource(feeds, stateFile).Discover(context.Background())
+	if err != nil || len(urls) != 1 || urls[0].URL != "https://example.com/post-1" {
+		t.Errorf("Discover() after restart = %v, %v, want only the new Atom entry", urls, err)
+	}
+}
+
+func TestWatchSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	got := make(chan []crab.URLData, 1)
+	done := make(chan struct{})
+	go func() {
+		crab.WatchSource(ctx, crab.StaticSource{{URL: "https://example.com/"}}, time.Hour, func(urls []crab.URLData) {
+			got <- urls
+		})
+		close(done)
+	}()
+
+	select {
+	case urls := <-got:
+		if len(urls) != 1 || urls[0].URL != "https://example.com/" {
+			t.Errorf("WatchSource() enqueued %v", urls)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchSource() did not poll immediately")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchSource() did not stop when its context was cancelled")
+	}
+}
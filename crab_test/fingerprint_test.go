@@ -0,0 +1,103 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"github.com/gocolly/colly"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFingerprintRequestHeaders(t *testing.T) {
+	if headers := (crab.FingerprintConfig{}).RequestHeaders(); len(headers) != 0 {
+		t.Errorf("RequestHeaders() with randomization off = %v, want none", headers)
+	}
+
+	honest := crab.FingerprintConfig{HonestMode: true, RandomizeHeaders: true, Accept: []string{"spoofed"}}
+	for i := 0; i < 10; i++ {
+		headers := honest.RequestHeaders()
+		if len(headers) != 1 || headers["Accept"] == "spoofed" {
+			t.Fatalf("RequestHeaders() in honest mode = %v, want only a fixed Accept", headers)
+		}
+	}
+
+	config := crab.FingerprintConfig{RandomizeHeaders: true, Accept: []string{"a", "b"}, AcceptLanguage: []string{"de"}}
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		headers := config.RequestHeaders()
+		seen[headers["Accept"]] = true
+		if headers["Accept-Language"] != "de" {
+			t.Errorf("Accept-Language = %q, want de", headers["Accept-Language"])
+		}
+	}
+	if !seen["a"] || !seen["b"] || len(seen) != 2 {
+		t.Errorf("Accept values seen = %v, want a and b", seen)
+	}
+}
+
+func TestApplyFingerprintHonestMode(t *testing.T) {
+	var userAgent, accept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent, accept = r.UserAgent(), r.Header.Get("Accept")
+	}))
+	defer server.Close()
+
+	crab.SetConfig(crab.Config{Fingerprint: crab.FingerprintConfig{HonestMode: true, RandomizeHeaders: true}})
+	defer crab.SetConfig(crab.Config{})
+
+	c := colly.NewCollector(colly.UserAgent("Mozilla/5.0 spoofed"))
+	crab.ApplyFingerprint(c)
+	if err := c.Visit(server.URL); err != nil {
+		t.Fatalf("Visit() error = %v", err)
+	}
+	if userAgent != crab.HonestUserAgent {
+		t.Errorf("User-Agent = %q, want %q", userAgent, crab.HonestUserAgent)
+	}
+	if accept != "text/html,application/xhtml+xml,*/*" {
+		t.Errorf("Accept = %q", accept)
+	}
+	if got := crab.RequestUserAgent(); got != crab.HonestUserAgent {
+		t.Errorf("RequestUserAgent() = %q, want honest agent", got)
+	}
+}
+
+func TestIdentityUserAgent(t *testing.T) {
+	if got := (crab.FingerprintConfig{}).IdentityUserAgent(); got != crab.HonestUserAgent {
+		t.Errorf("IdentityUserAgent() = %q, want %q", got, crab.HonestUserAgent)
+	}
+	config := crab.FingerprintConfig{HonestMode: true, AgentName: "AcmeBot", InfoURL: "https://example.com/bot", Contact: "admin@example.com"}
+	if got := config.IdentityUserAgent(); got != "AcmeBot/1.0 (+https://example.com/bot; admin@example.com)" {
+		t.Errorf("IdentityUserAgent() = %q", got)
+	}
+	if headers := config.RequestHeaders(); headers["From"] != "admin@example.com" {
+		t.Errorf("RequestHeaders() = %v, want a From header", headers)
+	}
+}
+
+func TestRobotsUseAgentName(t *testing.T) {
+	var userAgent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent = r.UserAgent()
+		w.Write([]byte("User-agent: AcmeBot\nDisallow: /private\n\nUser-agent: *\nDisallow: /admin\n"))
+	}))
+	defer server.Close()
+
+	if !crab.IsURLAllowedByRobotsTXT(server.URL + "/private/page?id=1") {
+		t.Error("/private is disallowed for the default agent, want allowed")
+	}
+	if crab.IsURLAllowedByRobotsTXT(server.URL + "/admin") {
+		t.Error("/admin is allowed for the default agent, want disallowed")
+	}
+
+	crab.SetConfig(crab.Config{Fingerprint: crab.FingerprintConfig{AgentName: "AcmeBot", Contact: "admin@example.com"}})
+	defer crab.SetConfig(crab.Config{})
+	if crab.IsURLAllowedByRobotsTXT(server.URL + "/private/page?id=1") {
+		t.Error("/private is allowed for AcmeBot, want disallowed")
+	}
+	if !crab.IsURLAllowedByRobotsTXT(server.URL + "/admin") {
+		t.Error("/admin is disallowed for AcmeBot, want allowed")
+	}
+	if userAgent != "AcmeBot/1.0 (+https://github.com/hseitaj/JustAFork; admin@example.com)" {
+		t.Errorf("robots.txt was fetched as %q", userAgent)
+	}
+}
@@ -0,0 +1,126 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// fixturesDir holds the recorded scraper pages; refresh them with "crab fixtures".
+const fixturesDir = "testdata/fixtures"
+
+func TestExtractInflationFixture(t *testing.T) {
+	records, err := crab.ExtractFixture(fixturesDir, "inflation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := records.([]crab.YearData)
+	if len(data) != 3 {
+		t.Fatalf("extracted %d years, want 3", len(data))
+	}
+	want := crab.YearData{Year: "2023", Jan: "6.4", Feb: "6.0", Mar: "5.0", Apr: "4.9", May: "4.0", Jun: "3.0",
+		July: "3.2", Aug: "3.7", Sept: "3.7", Oct: "3.2", Nov: "3.1", Dec: "3.4", Avg: "4.1"}
+	if data[0] != want {
+		t.Errorf("first year = %+v, want %+v", data[0], want)
+	}
+}
+
+func TestExtractGasolineFixture(t *testing.T) {
+	records, err := crab.ExtractFixture(fixturesDir, "gasoline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := records.([]crab.GasolineData)
+	want := crab.GasolineData{Year: "2021", AverageGasolinePrices: "$3.01", AverageAnnualCPIForGas: "289.5", GasPricesAdjustedForInfl: "$3.96"}
+	if len(data) != 3 || data[1] != want {
+		t.Errorf("extracted %+v, want 3 years with %+v second", data, want)
+	}
+}
+
+func TestExtractAirfareFixture(t *testing.T) {
+	records, err := crab.ExtractFixture(fixturesDir, "airfare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := records.([]crab.AirfareData)
+	if len(data) != 2 {
+		t.Fatalf("extracted %d years, want 2", len(data))
+	}
+	months := data[1].Data.AdditionalInfo.MonthsData
+	if data[1].Data.Year != "2022" || len(months) != 12 || months[0] != (crab.MonthData{Month: "Jan", Rate: "1.1"}) || months[11] != (crab.MonthData{Month: "Dec", Rate: "28.5"}) {
+		t.Errorf("second year = %s %+v", data[1].Data.Year, months)
+	}
+}
+
+func TestExtractHousingFixture(t *testing.T) {
+	records, err := crab.ExtractFixture(fixturesDir, "housing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := records.([]crab.PropertyData)
+	want := crab.PropertyData{Status: "for_sale", Bedrooms: "4", Bathrooms: "2", AcreLot: "0.08", City: "Adjuntas",
+		State: "Puerto Rico", ZipCode: "601", HouseSize: "1527", Price: "80000"}
+	if len(data) != 2 || data[1] != want {
+		t.Errorf("extracted %+v, want 2 listings with %+v second", data, want)
+	}
+}
+
+func TestExtractFixtureErrors(t *testing.T) {
+	if _, err := crab.ExtractFixture(fixturesDir, "weather"); err == nil {
+		t.Error("ExtractFixture() of an unknown scraper succeeded")
+	}
+	if _, err := crab.ExtractFixture(t.TempDir(), "inflation"); err == nil {
+		t.Error("ExtractFixture() without a recorded page succeeded")
+	}
+}
+
+func TestFixtureTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s3cret"})
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><script>var key = "s3cret";</script><!-- build 1234 --></head>`+
+			`<body><form><input type="hidden" name="csrf" value="t0ken"></form><table><tr><td>2023</td></tr></table></body></html>`)
+	}))
+	dir := t.TempDir()
+	pageURL := server.URL + "/rates/?year=2023"
+
+	record := &http.Client{Transport: &crab.FixtureTransport{Dir: dir, Record: true}}
+	resp, err := record.Get(pageURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if len(resp.Cookies()) != 0 {
+		t.Errorf("recorded response kept cookies %v", resp.Cookies())
+	}
+	server.Close()
+
+	saved, err := os.ReadFile(crab.FixturePath(dir, pageURL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"s3cret", "t0ken", "build 1234"} {
+		if strings.Contains(string(saved), secret) {
+			t.Errorf("fixture still contains %q:\n%s", secret, saved)
+		}
+	}
+
+	replay := &http.Client{Transport: &crab.FixtureTransport{Dir: dir}}
+	resp, err = replay.Get(pageURL)
+	if err != nil {
+		t.Fatalf("replaying after the server closed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), "<td>2023</td>") {
+		t.Errorf("replayed body = %s", body)
+	}
+	if _, err := replay.Get(server.URL + "/other"); err == nil {
+		t.Error("replaying an unrecorded page succeeded")
+	}
+}
@@ -0,0 +1,90 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const searchPage = `<html><body>
+<form id="search" action="/results" method="get">
+  <input type="hidden" name="token" value="abc123">
+  <input type="text" name="q" value="">
+  <select name="sort"><option value="relevance">Relevance</option><option value="date" selected>Date</option></select>
+  <input type="checkbox" name="exact" value="1">
+  <input type="checkbox" name="images" checked>
+  <input type="text" name="skipped" value="x" disabled>
+  <textarea name="notes">none</textarea>
+  <button type="submit" name="go" value="Search">Search</button>
+</form>
+<form id="login" method="post"><input name="user" value=""></form>
+</body></html>`
+
+func TestBuildFormSubmission(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(searchPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageURL, _ := url.Parse("https://example.com/search/index.html")
+
+	config := crab.FormConfig{Selector: "form#search", Fields: map[string]string{"q": "housing prices"}, Submit: "button[name=go]"}
+	submission, err := crab.BuildFormSubmission(doc.Find(config.Selector), pageURL, config)
+	if err != nil {
+		t.Fatalf("BuildFormSubmission() error = %v", err)
+	}
+	want := url.Values{"token": {"abc123"}, "q": {"housing prices"}, "sort": {"date"}, "images": {"on"}, "notes": {"none"}, "go": {"Search"}}
+	if submission.Method != http.MethodGet || submission.Values.Encode() != want.Encode() {
+		t.Errorf("BuildFormSubmission() = %s %v, want GET %v", submission.Method, submission.Values, want)
+	}
+	if submission.URL != "https://example.com/results?"+want.Encode() {
+		t.Errorf("URL = %q", submission.URL)
+	}
+
+	login := crab.FormConfig{Selector: "form#login", Fields: map[string]string{"user": "crab"}}
+	submission, err = crab.BuildFormSubmission(doc.Find(login.Selector), pageURL, login)
+	if err != nil || submission.Method != http.MethodPost || submission.URL != pageURL.String() || submission.Values.Get("user") != "crab" {
+		t.Errorf("BuildFormSubmission(login) = %+v, %v, want a POST back to the page", submission, err)
+	}
+
+	if _, err := crab.BuildFormSubmission(doc.Find("form#missing"), pageURL, crab.FormConfig{Selector: "form#missing"}); err == nil {
+		t.Error("BuildFormSubmission() of a missing form succeeded")
+	}
+}
+
+func TestAttachForm(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<form class="search" method="post" action="/results"><input type="hidden" name="csrf" value="t0k"><input name="q"></form>`)
+		case "/results":
+			if r.Method != http.MethodPost || r.PostForm.Get("csrf") != "t0k" {
+				http.Error(w, "bad form", http.StatusForbidden)
+				return
+			}
+			// Result pages repeat the search form.
+			fmt.Fprintf(w, `<form class="search" method="post" action="/results"><input name="q"></form>`)
+			fmt.Fprintf(w, `<div class="result">%s 1</div><div class="result">%s 2</div>`, r.PostForm.Get("q"), r.PostForm.Get("q"))
+		}
+	}))
+	defer server.Close()
+
+	var results []string
+	c := colly.NewCollector()
+	c.OnHTML("div.result", func(e *colly.HTMLElement) {
+		results = append(results, e.Text)
+	})
+	crab.AttachForm(c, crab.FormConfig{Selector: "form.search", Fields: map[string]string{"q": "housing"}})
+	c.Visit(server.URL + "/")
+
+	if strings.Join(results, ",") != "housing 1,housing 2" {
+		t.Errorf("scraped results = %v, want the two results once", results)
+	}
+}
@@ -0,0 +1,112 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"context"
+	"expvar"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestFrontierSpillsToDisk(t *testing.T) {
+	dir := t.TempDir()
+	frontier := crab.NewFrontier(crab.FrontierConfig{MemoryURLs: 10, Dir: dir})
+	defer frontier.Close()
+	push := func(from, to int) {
+		for i := from; i < to; i++ {
+			if added, err := frontier.Push(crab.URLData{URL: fmt.Sprintf("https://example.com/%d", i)}); !added || err != nil {
+				t.Fatalf("Push(%d) = %v, %v", i, added, err)
+			}
+		}
+	}
+	push(0, 95)
+	if added, _ := frontier.Push(crab.URLData{URL: "https://example.com/3"}); added || frontier.Len() != 95 {
+		t.Errorf("Push() of a repeated URL = %v, Len() = %d, want false, 95", added, frontier.Len())
+	}
+	if spills, _ := os.ReadDir(dir); len(spills) != 1 {
+		t.Fatalf("spill directories = %d, want 1", len(spills))
+	}
+
+	// Pushing while popping keeps the order
+	next := 0
+	pop := func(n int) {
+		for i := 0; i < n; i++ {
+			urlData, ok := frontier.Pop()
+			if want := fmt.Sprintf("https://example.com/%d", next); !ok || urlData.URL != want {
+				t.Fatalf("Pop() = %q, %v, want %q", urlData.URL, ok, want)
+			}
+			next++
+		}
+	}
+	pop(50)
+	push(95, 120)
+	pop(70)
+	if _, ok := frontier.Pop(); ok || frontier.Len() != 0 {
+		t.Errorf("Pop() of an empty frontier succeeded, Len() = %d", frontier.Len())
+	}
+
+	frontier.Close()
+	if spills, _ := os.ReadDir(dir); len(spills) != 0 {
+		t.Errorf("Close() left %d spill directories", len(spills))
+	}
+}
+
+func TestCrawlSpillsFrontier(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 6})
+	defer site.Close()
+	spillDir := t.TempDir()
+	crab.SetConfig(crab.Config{
+		Output:   crab.OutputConfig{Dir: t.TempDir()},
+		Frontier: crab.FrontierConfig{MemoryURLs: 2, Dir: spillDir},
+	})
+	defer crab.SetConfig(crab.Config{})
+
+	var urls []crab.URLData
+	for i := 0; i < 6; i++ {
+		urls = append(urls, crab.URLData{URL: site.PageURL(i)}, crab.URLData{URL: site.PageURL(i)})
+	}
+	if summary := crab.Crawl(context.Background(), urls, 2); summary.Pages != 6 || summary.Errors != 0 {
+		t.Errorf("Crawl() = %d pages, %d errors, want 6 pages", summary.Pages, summary.Errors)
+	}
+	if spills, _ := os.ReadDir(spillDir); len(spills) != 0 {
+		t.Errorf("Crawl() left %d spill directories", len(spills))
+	}
+}
+
+func TestCrawlFollowsLinksPastSpill(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 40, Links: testsite.Tree(40, 3)})
+	defer site.Close()
+	spillDir := t.TempDir()
+	crab.SetConfig(crab.Config{
+		Output:   crab.OutputConfig{Dir: t.TempDir()},
+		Frontier: crab.FrontierConfig{MemoryURLs: 4, Dir: spillDir, Follow: true},
+	})
+	defer crab.SetConfig(crab.Config{})
+	spilled := func() int64 {
+		if v, ok := expvar.Get("crab_pipeline").(*expvar.Map).Get("frontier_spilled").(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	before := spilled()
+
+	summary := crab.Crawl(context.Background(), []crab.URLData{{URL: site.PageURL(0)}}, 2)
+	if summary.Pages != 40 || summary.Errors != 0 {
+		t.Errorf("Crawl() = %d pages, %d errors, want every page of the site", summary.Pages, summary.Errors)
+	}
+	if spilled() == before {
+		t.Errorf("Crawl() never spilled its frontier past %d URLs", 4)
+	}
+	fetched := map[string]bool{}
+	for _, request := range site.Requests() {
+		if fetched[request.Path] {
+			t.Errorf("Crawl() fetched %s twice", request.Path)
+		}
+		fetched[request.Path] = true
+	}
+	if spills, _ := os.ReadDir(spillDir); len(spills) != 0 {
+		t.Errorf("Crawl() left %d spill directories", len(spills))
+	}
+}
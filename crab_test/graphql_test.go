@@ -0,0 +1,66 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestScrapeGraphQLTarget(t *testing.T) {
+	products := []string{"apple", "banana", "cherry"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"errors": [{"message": "not authenticated"}]}`)
+			return
+		}
+		var request struct {
+			Query     string                 `json:"query"`
+			Variables map[string]interface{} `json:"variables"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Variables["category"] != "fruit" {
+			t.Errorf("unexpected request %+v, %v", request, err)
+		}
+		start := 0
+		if after, ok := request.Variables["after"].(string); ok {
+			fmt.Sscanf(after, "cursor-%d", &start)
+			start++
+		}
+		fmt.Fprintf(w, `{"data": {"products": {"edges": [{"node": {"name": %q}}], "pageInfo": {"endCursor": "cursor-%d", "hasNextPage": %v}}}}`,
+			products[start], start, start < len(products)-1)
+	}))
+	defer server.Close()
+
+	t.Setenv("CRAB_TEST_GRAPHQL_TOKEN", "s3cret")
+	target := crab.GraphQLTarget{
+		Name:           "products",
+		URL:            server.URL,
+		Query:          "query($category: String, $after: String) { products(category: $category, after: $after) { edges { node { name } } pageInfo { endCursor hasNextPage } } }",
+		Variables:      map[string]interface{}{"category": "fruit"},
+		TokenEnv:       "CRAB_TEST_GRAPHQL_TOKEN",
+		ItemsPath:      "$.data.products.edges[*].node",
+		Fields:         []crab.JSONField{{Name: "name", Path: "$.name"}},
+		CursorVariable: "after",
+		CursorPath:     "$.data.products.pageInfo.endCursor",
+		HasNextPath:    "$.data.products.pageInfo.hasNextPage",
+	}
+	records, err := crab.ScrapeGraphQLTarget(target, server.Client())
+	if err != nil {
+		t.Fatalf("ScrapeGraphQLTarget() error = %v", err)
+	}
+	if len(records) != 3 || records[0]["name"] != "apple" || records[2]["name"] != "cherry" {
+		t.Errorf("ScrapeGraphQLTarget() = %v, want all three products", records)
+	}
+
+	t.Setenv("CRAB_TEST_GRAPHQL_TOKEN", "wrong")
+	if _, err := crab.ScrapeGraphQLTarget(target, server.Client()); err == nil {
+		t.Error("ScrapeGraphQLTarget() ignored GraphQL errors")
+	}
+	target.TokenEnv = "CRAB_TEST_GRAPHQL_UNSET"
+	if _, err := crab.ScrapeGraphQLTarget(target, server.Client()); err == nil {
+		t.Error("ScrapeGraphQLTarget() ran without its token")
+	}
+}
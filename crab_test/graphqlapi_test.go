@@ -0,0 +1,180 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakePredictions serves predictions to the GraphQL API from memory.
+type fakePredictions []crab.PredictionRecord
+
+func (f fakePredictions) Prediction(id string) (crab.PredictionRecord, error) {
+	for _, p := range f {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return crab.PredictionRecord{}, errors.New("no prediction " + id)
+}
+
+func (f fakePredictions) Predictions(since time.Time) ([]crab.PredictionRecord, error) {
+	return f, nil
+}
+
+func TestGraphQLAPI(t *testing.T) {
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+	before := time.Now().Add(-time.Hour)
+	defer crab.UseFixtures(filepath.Join(fixturesDir, "inflation"), false)()
+	crab.ScrapeInflationData()
+	crab.SetPredictionSource(fakePredictions{
+		{ID: "p1", State: crab.JobSucceeded, Inputs: []string{"2023"}, Results: []string{"3.1"}, CreatedAt: time.Now().Add(time.Minute)},
+		{ID: "p0", State: crab.JobFailed, Error: "no backend", CreatedAt: before},
+	})
+	defer crab.SetPredictionSource(nil)
+
+	response := crab.ExecuteGraphQL(`
+		query Inflation($from: Int = 2000, $cols: [String!]) {
+			inflation: dataset(name: "inflation") {
+				name
+				recent: rows(from: $from, columns: $cols)
+				records(from: 2023, columns: ["year", "jan"])
+				run { ...runFields }
+			}
+			runs { id kind }
+		}
+		fragment runFields on Run { id kind files }`,
+		map[string]interface{}{"from": 2022.0, "cols": []interface{}{"year", "avg"}}, "")
+	if len(response.Errors) > 0 {
+		t.Fatalf("ExecuteGraphQL() errors = %+v", response.Errors)
+	}
+	data, _ := json.Marshal(response.Data)
+	var result struct {
+		Inflation struct {
+			Name    string
+			Recent  [][]string
+			Records []map[string]string
+			Run     struct {
+				ID    string
+				Kind  string
+				Files []string
+			}
+		}
+		Runs []struct{ ID string }
+	}
+	json.Unmarshal(data, &result)
+	if !strings.HasPrefix(string(data), `{"inflation":{"name":"inflation","recent":`) {
+		t.Errorf("fields are not in the order selected: %s", data)
+	}
+	if len(result.Inflation.Recent) != 2 || len(result.Inflation.Recent[0]) != 2 {
+		t.Errorf("rows from 2022 = %v", result.Inflation.Recent)
+	}
+	if len(result.Inflation.Records) != 1 || result.Inflation.Records[0]["year"] != "2023" || result.Inflation.Records[0]["jan"] == "" {
+		t.Errorf("records = %v", result.Inflation.Records)
+	}
+	if result.Inflation.Run.Kind != "scrape" || len(result.Runs) != 1 || result.Runs[0].ID != result.Inflation.Run.ID || len(result.Inflation.Run.Files) == 0 {
+		t.Errorf("run = %+v, runs = %+v", result.Inflation.Run, result.Runs)
+	}
+
+	// A prediction is joined with the version of the dataset it was made with
+	response = crab.ExecuteGraphQL(`{ predictions { id state uses: dataset(name: "inflation") { runId total } } }`, nil, "")
+	data, _ = json.Marshal(response.Data)
+	var predictions struct {
+		Predictions []struct {
+			ID   string
+			Uses *struct {
+				RunID string
+				Total int
+			}
+		}
+	}
+	json.Unmarshal(data, &predictions)
+	if len(response.Errors) > 0 || len(predictions.Predictions) != 2 || predictions.Predictions[0].ID != "p1" {
+		t.Fatalf("predictions = %s, %+v", data, response.Errors)
+	}
+	if uses := predictions.Predictions[0].Uses; uses == nil || uses.RunID != result.Inflation.Run.ID || uses.Total == 0 {
+		t.Errorf("dataset of the prediction = %+v", uses)
+	}
+	if predictions.Predictions[1].Uses != nil {
+		t.Errorf("the prediction made before any scrape used %+v", predictions.Predictions[1].Uses)
+	}
+
+	// A failing field is null with an error at its path, and the rest of the data is returned
+	response = crab.ExecuteGraphQL(`{ datasets { name price } prediction(id: "p9") { id } }`, nil, "")
+	if len(response.Errors) != 2 || response.Errors[0].Message != "Dataset has no field price" ||
+		len(response.Errors[0].Path) != 3 || response.Errors[1].Path[0] != "prediction" {
+		t.Errorf("errors = %+v", response.Errors)
+	}
+	for _, query := range []string{`mutation { run }`, `{ datasets { name }`, `{ dataset(name: "inflation", limit: 2) { name } }`, `{ datasets }`} {
+		if response := crab.ExecuteGraphQL(query, nil, ""); len(response.Errors) == 0 {
+			t.Errorf("ExecuteGraphQL(%q) succeeded", query)
+		}
+	}
+
+	server := httptest.NewServer(crab.NewDaemon(crab.DaemonConfig{}, crab.NewJobQueue(crab.NewMemoryJobStore())).Handler())
+	defer server.Close()
+	resp, err := http.Post(server.URL+"/graphql", "application/json", strings.NewReader(`{"query": "{ datasets { name total } }"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var served crab.GraphQLResponse
+	json.NewDecoder(resp.Body).Decode(&served)
+	if resp.StatusCode != http.StatusOK || served.Data == nil || len(served.Errors) > 0 {
+		t.Errorf("POST /graphql = %d %+v", resp.StatusCode, served)
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}})
+	defer crab.SetConfig(crab.Config{})
+
+	// Each fragment selects the next three times over, for 3^8 fields from a short document
+	var fragments strings.Builder
+	for i := 0; i < 8; i++ {
+		fmt.Fprintf(&fragments, "fragment F%d on X { a: x { ...F%d } b: x { ...F%d } c: x { ...F%d } }\n", i, i+1, i+1, i+1)
+	}
+	fragments.WriteString("fragment F8 on X { x }")
+	deep := "{ datasets " + strings.Repeat("{ x ", 10) + strings.Repeat("}", 10) + " }"
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"{ datasets { ...F0 } }\n" + fragments.String(), "more than 1000 fields"},
+		{deep, "deeper than 10 levels"},
+		{`{ dataset(name: ` + strings.Repeat("[", 40) + strings.Repeat("]", 40) + `) { name } }`, "nested deeper than 32 levels"},
+	}
+	for _, test := range tests {
+		response := crab.ExecuteGraphQL(test.query, nil, "")
+		if response.Data != nil || len(response.Errors) != 1 || !strings.Contains(response.Errors[0].Message, test.want) {
+			t.Errorf("ExecuteGraphQL(%.40q...) = %+v, want the error %q", test.query, response, test.want)
+		}
+	}
+
+	// A fragment spread twice into a set is expanded once
+	response := crab.ExecuteGraphQL(`{ runs { ...R ...R } } fragment R on Run { id }`, nil, "")
+	if len(response.Errors) > 0 {
+		t.Errorf("ExecuteGraphQL() of a fragment spread twice errors = %+v", response.Errors)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(crab.GraphQLHandler))
+	defer server.Close()
+	body := `{"query": "{ datasets { name } }", "variables": {"pad": "` + strings.Repeat("x", 1<<20) + `"}}`
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST of a body over 1MB = %d, want 413", resp.StatusCode)
+	}
+}
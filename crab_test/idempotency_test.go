@@ -0,0 +1,138 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/crab/client"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateJobIdempotencyKey(t *testing.T) {
+	crab.SetIdempotencyStore(nil)
+	crab.SetConfig(crab.Config{API: crab.APIConfig{Keys: []crab.APIKey{{Name: "ci", Key: "ci-key", Role: "operator"}}}})
+	defer crab.SetConfig(crab.Config{})
+	queue := crab.NewJobQueue(crab.NewMemoryJobStore())
+	queue.Register("noop", func(ctx context.Context, job crab.Job) error { return nil })
+	server := httptest.NewServer(crab.NewDaemon(crab.DaemonConfig{}, queue).Handler())
+	defer server.Close()
+	c := &client.Client{BaseURL: server.URL, APIKey: "ci-key"}
+	ctx := client.WithIdempotencyKey(context.Background(), "retry-1")
+	request := crab.JobRequest{Type: "noop", Params: map[string]string{"n": "1"}}
+
+	first, err := c.CreateJob(ctx, request)
+	if err != nil {
+		t.Fatalf("CreateJob() error = %v", err)
+	}
+	retry, err := c.CreateJob(ctx, request)
+	if err != nil || retry.ID != first.ID {
+		t.Errorf("CreateJob() retried = %+v, %v, want job %s again", retry, err, first.ID)
+	}
+	if jobs, _ := queue.List(); len(jobs) != 1 {
+		t.Errorf("jobs = %d, want 1", len(jobs))
+	}
+
+	var apiErr *client.Error
+	request.Params["n"] = "2"
+	if _, err := c.CreateJob(ctx, request); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("CreateJob() with the key of another request = %v, want 422", err)
+	}
+	if other, err := c.CreateJob(client.WithIdempotencyKey(context.Background(), "retry-2"), request); err != nil || other.ID == first.ID {
+		t.Errorf("CreateJob() with another key = %+v, %v, want a new job", other, err)
+	}
+	if _, err := c.CreateJob(context.Background(), request); err != nil {
+		t.Errorf("CreateJob() without a key = %v", err)
+	}
+	if jobs, _ := queue.List(); len(jobs) != 3 {
+		t.Errorf("jobs = %d, want 3", len(jobs))
+	}
+
+	// A failed request leaves its key free for the retry
+	failing := client.WithIdempotencyKey(context.Background(), "retry-3")
+	if _, err := c.CreateJob(failing, crab.JobRequest{Type: "unknown"}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("CreateJob() of an unknown type = %v, want 400", err)
+	}
+	if _, err := c.CreateJob(failing, crab.JobRequest{Type: "noop"}); err != nil {
+		t.Errorf("CreateJob() after a failure = %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/jobs", strings.NewReader(`{ "type": "noop" }`))
+	req.Header.Set(crab.IdempotencyHeader, "retry-3")
+	req.Header.Set("X-API-Key", "ci-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted || resp.Header.Get(crab.IdempotentReplayedHeader) != "true" {
+		t.Errorf("retry = %d with %s %q, want a replayed 202", resp.StatusCode, crab.IdempotentReplayedHeader, resp.Header.Get(crab.IdempotentReplayedHeader))
+	}
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	store := crab.NewMemoryIdempotencyStore()
+	now := time.Now()
+	record := crab.IdempotencyRecord{Scope: "POST /jobs", Key: "k", RequestHash: "h", CreatedAt: now.Add(-2 * time.Hour)}
+	if _, claimed, err := store.ClaimIdempotencyKey(record, now.Add(-time.Hour*3)); !claimed || err != nil {
+		t.Fatalf("ClaimIdempotencyKey() = %v, %v, want claimed", claimed, err)
+	}
+	record.ResourceID, record.Status = "job-1", http.StatusAccepted
+	if err := store.CompleteIdempotencyKey(record); err != nil {
+		t.Fatal(err)
+	}
+	again := crab.IdempotencyRecord{Scope: "POST /jobs", Key: "k", RequestHash: "h", CreatedAt: now}
+	if stored, claimed, _ := store.ClaimIdempotencyKey(again, now.Add(-3*time.Hour)); claimed || stored.ResourceID != "job-1" {
+		t.Errorf("ClaimIdempotencyKey() again = %+v, %v, want the first claim", stored, claimed)
+	}
+	if _, claimed, _ := store.ClaimIdempotencyKey(again, now.Add(-time.Hour)); !claimed {
+		t.Errorf("ClaimIdempotencyKey() once expired = not claimed, want claimed")
+	}
+	other := crab.IdempotencyRecord{Scope: "POST /api/predict", Key: "k", CreatedAt: now}
+	if _, claimed, _ := store.ClaimIdempotencyKey(other, now.Add(-time.Hour)); !claimed {
+		t.Errorf("ClaimIdempotencyKey() in another scope = not claimed, want claimed")
+	}
+}
+
+func TestIdempotencyKeysArePerCaller(t *testing.T) {
+	crab.SetIdempotencyStore(nil)
+	crab.SetConfig(crab.Config{API: crab.APIConfig{Keys: []crab.APIKey{
+		{Name: "ci", Key: "ci-key", Role: "operator"},
+		{Name: "ops", Key: "ops-key", Role: "operator"},
+	}}})
+	defer crab.SetConfig(crab.Config{})
+	queue := crab.NewJobQueue(crab.NewMemoryJobStore())
+	queue.Register("noop", func(ctx context.Context, job crab.Job) error { return nil })
+	server := httptest.NewServer(crab.NewDaemon(crab.DaemonConfig{}, queue).Handler())
+	defer server.Close()
+	post := func(apiKey, body string) *http.Response {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/jobs", strings.NewReader(body))
+		req.Header.Set("X-API-Key", apiKey)
+		req.Header.Set(crab.IdempotencyHeader, "nightly")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := post("ci-key", `{"type": "noop"}`); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("first caller = %d, want 202", resp.StatusCode)
+	}
+	if resp := post("ops-key", `{"type": "noop", "params": {"n": "2"}}`); resp.StatusCode != http.StatusAccepted ||
+		resp.Header.Get(crab.IdempotentReplayedHeader) != "" {
+		t.Errorf("second caller with the same key = %d, replayed %q, want its own job", resp.StatusCode, resp.Header.Get(crab.IdempotentReplayedHeader))
+	}
+	if jobs, _ := queue.List(); len(jobs) != 2 {
+		t.Errorf("jobs = %d, want one per caller", len(jobs))
+	}
+
+	large := `{"type": "noop", "params": {"padding": "` + strings.Repeat("x", 1<<20) + `"}}`
+	if resp := post("ci-key", large); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("body over 1MB = %d, want 413", resp.StatusCode)
+	}
+}
@@ -0,0 +1,73 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadDatasetFile(t *testing.T) {
+	dir := t.TempDir()
+	want := crab.Dataset{Name: "gasoline", Columns: []string{"price", "year"}, Rows: [][]string{{"3.95", "2022"}, {"", "2021"}}}
+
+	csvFile := filepath.Join(dir, "prices.csv")
+	os.WriteFile(csvFile, []byte("\ufeffprice, year\n3.95,2022\n,2021\n,\n"), 0644)
+	jsonFile := filepath.Join(dir, "prices.json")
+	os.WriteFile(jsonFile, []byte(`[{"year": 2022, "price": 3.95}, {"year": 2021, "price": null}]`), 0644)
+	ndjsonFile := filepath.Join(dir, "prices.ndjson")
+	os.WriteFile(ndjsonFile, []byte("{\"year\": \"2022\", \"price\": \"3.95\"}\n{\"year\": \"2021\"}\n"), 0644)
+	xlsxFile := filepath.Join(dir, "prices.xlsx")
+	other := crab.Dataset{Name: "other", Columns: []string{"a"}, Rows: [][]string{{"b"}}}
+	if err := crab.ExportXLSX([]crab.Dataset{other, want}, xlsxFile); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, filename := range []string{csvFile, jsonFile, ndjsonFile, xlsxFile} {
+		got, err := crab.ReadDatasetFile("gasoline", filename, crab.ImportOptions{})
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("ReadDatasetFile(%s) = %+v, %v, want %+v", filepath.Base(filename), got, err, want)
+		}
+	}
+	if _, err := crab.ReadDatasetFile("gasoline", xlsxFile, crab.ImportOptions{Sheet: "missing"}); err == nil {
+		t.Errorf("ReadDatasetFile() of a missing sheet succeeded")
+	}
+}
+
+func TestConformDataset(t *testing.T) {
+	ds := crab.Dataset{Name: "housing", Columns: []string{"Bed", "City", "Zip Code", "brokered_by"},
+		Rows: [][]string{{"3", "Boston", "02108", "x"}}}
+	got, dropped, err := crab.ConformDataset(ds, []string{"bedrooms", "city", "zip_code", "price"}, map[string]string{"bed": "bedrooms"})
+	if err != nil || !reflect.DeepEqual(got.Rows, [][]string{{"3", "Boston", "02108", ""}}) || !reflect.DeepEqual(dropped, []string{"brokered_by"}) {
+		t.Errorf("ConformDataset() = %v, %v, %v", got.Rows, dropped, err)
+	}
+	if _, _, err := crab.ConformDataset(ds, []string{"year"}, nil); err == nil {
+		t.Errorf("ConformDataset() with no matching column succeeded")
+	}
+}
+
+func TestImportDataset(t *testing.T) {
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+	filename := filepath.Join(t.TempDir(), "kaggle.csv")
+	os.WriteFile(filename, []byte("Year,Average Gasoline Prices,Source\n1990,$1.16,EIA\n1991,$1.14,EIA\n"), 0644)
+
+	if _, err := crab.ImportDataset("gasoline", filename, crab.ImportOptions{}); err != nil {
+		t.Fatalf("ImportDataset() error = %v", err)
+	}
+	ds, err := crab.LoadDatasetAsOf(dir, "gasoline", "")
+	if err != nil || len(ds.Rows) != 2 || ds.Rows[0][0] != "1990" || ds.Rows[0][1] != "$1.16" {
+		t.Fatalf("LoadDatasetAsOf() = %+v, %v", ds, err)
+	}
+	lineage, err := crab.DatasetLineage(dir, "gasoline", "")
+	if err != nil || len(lineage) != 2 || !strings.HasPrefix(lineage[0].SourceURL, "file://") || lineage[0].Extractor != "import" {
+		t.Errorf("DatasetLineage() = %+v, %v", lineage, err)
+	}
+
+	if _, err := crab.ImportDataset("airfare", filename, crab.ImportOptions{}); err == nil {
+		t.Errorf("ImportDataset() into the airfare dataset succeeded")
+	}
+}
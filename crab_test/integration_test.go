@@ -0,0 +1,120 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"encoding/json"
+	"fmt"
+	"github.com/gocolly/colly"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestThreadedCrawlSite(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 7, Links: testsite.Tree(7, 2)})
+	defer site.Close()
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+
+	crab.ThreadedCrawl([]crab.URLData{{URL: site.PageURL(0)}, {URL: site.PageURL(1)}, {URL: site.PageURL(2)}}, 10)
+
+	runs, err := crab.ListRuns(dir)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("ListRuns() = %v, %v, want one run", runs, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, runs[0], "siteMap.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var siteMap map[string][]string
+	if err := json.Unmarshal(data, &siteMap); err != nil {
+		t.Fatalf("decoding sitemap: %v\n%s", err, data)
+	}
+	want := map[string][]string{
+		site.PageURL(0): {site.PageURL(1), site.PageURL(2)},
+		site.PageURL(1): {site.PageURL(3), site.PageURL(4)},
+		site.PageURL(2): {site.PageURL(5), site.PageURL(6)},
+	}
+	if !reflect.DeepEqual(siteMap, want) {
+		t.Errorf("sitemap = %v, want %v", siteMap, want)
+	}
+	for i := 0; i < 3; i++ {
+		if n := site.Count(fmt.Sprintf("/page/%d", i)); n != 1 {
+			t.Errorf("page %d fetched %d times, want once", i, n)
+		}
+	}
+}
+
+func TestRateLimitAgainstSite(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 4})
+	defer site.Close()
+
+	const delay = 100 * time.Millisecond
+	c := colly.NewCollector()
+	c.Limit(&colly.LimitRule{DomainGlob: "*", Delay: delay})
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		e.Request.Visit(e.Attr("href"))
+	})
+	c.Visit(site.PageURL(0))
+
+	requests := site.Requests()
+	if len(requests) != 4 {
+		t.Fatalf("site received %d requests, want 4", len(requests))
+	}
+	for i := 1; i < len(requests); i++ {
+		if gap := requests[i].Time.Sub(requests[i-1].Time); gap < delay-10*time.Millisecond {
+			t.Errorf("request %d came %v after the previous one, want at least %v", i, gap, delay)
+		}
+	}
+}
+
+func TestThrottleRetryAfterAgainstSite(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 1, Flaky: map[string]int{"/page/0": 1}, RetryAfter: "1"})
+	defer site.Close()
+
+	var statuses []int
+	c := colly.NewCollector(colly.AllowURLRevisit())
+	crab.NewThrottle().Attach(c)
+	c.OnResponse(func(r *colly.Response) { statuses = append(statuses, r.StatusCode) })
+	c.OnError(func(r *colly.Response, err error) { statuses = append(statuses, r.StatusCode) })
+	c.Visit(site.PageURL(0))
+	c.Visit(site.PageURL(0))
+
+	if !reflect.DeepEqual(statuses, []int{http.StatusServiceUnavailable, http.StatusOK}) {
+		t.Errorf("statuses = %v, want 503 then 200", statuses)
+	}
+	requests := site.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("site received %d requests, want 2", len(requests))
+	}
+	if gap := requests[1].Time.Sub(requests[0].Time); gap < 900*time.Millisecond {
+		t.Errorf("retry came %v after the 503, want the 1s Retry-After honoured", gap)
+	}
+}
+
+func TestSlowAndErrorEndpoints(t *testing.T) {
+	site := testsite.New(testsite.Config{
+		Pages:  2,
+		Slow:   map[string]time.Duration{"/page/0": 500 * time.Millisecond},
+		Status: map[string]int{"/page/1": http.StatusInternalServerError},
+	})
+	defer site.Close()
+
+	client := &http.Client{Timeout: 100 * time.Millisecond}
+	if _, err := client.Get(site.PageURL(0)); err == nil {
+		t.Error("fetching the slow page did not time out")
+	}
+	resp, err := client.Get(site.PageURL(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", resp.StatusCode)
+	}
+}
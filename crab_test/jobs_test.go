@@ -0,0 +1,154 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitForState polls the queue until the job reaches want or the deadline passes.
+func waitForState(t *testing.T, q *crab.JobQueue, id string, want crab.JobState) crab.Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", id, err)
+		}
+		if job.State == want {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s state = %s, want %s", id, job.State, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestJobQueue(t *testing.T) {
+	q := crab.NewJobQueue(crab.NewMemoryJobStore())
+	release := make(chan struct{})
+	q.Register("test", func(ctx context.Context, job crab.Job) error {
+		switch job.Params["mode"] {
+		case "fail":
+			return errors.New("boom")
+		case "block":
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	if _, err := q.Enqueue("unknown", nil); err == nil {
+		t.Errorf("Enqueue(unknown) error = nil, want error")
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	q.Start(ctx, 1)
+
+	ok, _ := q.Enqueue("test", map[string]string{"mode": "ok"})
+	job := waitForState(t, q, ok.ID, crab.JobSucceeded)
+	if job.StartedAt.IsZero() || job.FinishedAt.IsZero() {
+		t.Errorf("succeeded job timestamps not set: %+v", job)
+	}
+
+	failed, _ := q.Enqueue("test", map[string]string{"mode": "fail"})
+	if job := waitForState(t, q, failed.ID, crab.JobFailed); job.Error != "boom" {
+		t.Errorf("failed job Error = %q, want boom", job.Error)
+	}
+
+	// The single worker is busy with the blocking job, so the second one stays queued.
+	running, _ := q.Enqueue("test", map[string]string{"mode": "block"})
+	waitForState(t, q, running.ID, crab.JobRunning)
+	queued, _ := q.Enqueue("test", map[string]string{"mode": "ok"})
+	if err := q.Cancel(queued.ID); err != nil {
+		t.Fatalf("Cancel(queued) error = %v", err)
+	}
+	waitForState(t, q, queued.ID, crab.JobCancelled)
+
+	if err := q.Cancel(running.ID); err != nil {
+		t.Fatalf("Cancel(running) error = %v", err)
+	}
+	waitForState(t, q, running.ID, crab.JobCancelled)
+	close(release)
+
+	if err := q.Cancel(ok.ID); err == nil {
+		t.Errorf("Cancel(finished) error = nil, want error")
+	}
+
+	jobs, _ := q.List()
+	if len(jobs) != 4 {
+		t.Errorf("List() returned %d jobs, want 4", len(jobs))
+	}
+}
+
+func TestStartRequeuesStoredJobs(t *testing.T) {
+	store := crab.NewMemoryJobStore()
+	drained := crab.NewJobQueue(store)
+	drained.Register("test", func(ctx context.Context, job crab.Job) error { return nil })
+	ctx, cancel := context.WithCancel(context.Background())
+	drained.Start(ctx, 1)
+	if err := drained.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	left, err := drained.Enqueue("test", nil) // Taken by no worker once drained
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	drained.Wait()
+
+	// A restarted queue over the same store runs the job the drain left queued
+	q := crab.NewJobQueue(store)
+	q.Register("test", func(ctx context.Context, job crab.Job) error { return nil })
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	q.Start(ctx, 1)
+	waitForState(t, q, left.ID, crab.JobSucceeded)
+}
+
+func TestCancelCrawlJobStopsFetching(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 500})
+	defer site.Close()
+	crab.SetConfig(crab.Config{
+		Output:    crab.OutputConfig{Dir: t.TempDir()},
+		RateLimit: crab.RateLimitConfig{DelayMS: 10},
+		Frontier:  crab.FrontierConfig{Follow: true},
+	})
+	defer crab.SetConfig(crab.Config{})
+
+	q := crab.NewJobQueue(crab.NewMemoryJobStore())
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	q.Start(ctx, 1)
+	job, err := q.Enqueue("crawl", map[string]string{"urls": site.PageURL(0), "workers": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(2 * time.Second); len(site.Requests()) < 5; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("the crawl job made %d requests, want it under way", len(site.Requests()))
+		}
+	}
+	if err := q.Cancel(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, q, job.ID, crab.JobCancelled)
+
+	// The crawl has returned by the time the job is cancelled, so no more pages are fetched
+	fetched := len(site.Requests())
+	time.Sleep(200 * time.Millisecond)
+	if more := len(site.Requests()) - fetched; more > 0 {
+		t.Errorf("the cancelled crawl job went on to fetch %d more pages", more)
+	}
+	if fetched >= 500 {
+		t.Errorf("the crawl job fetched all %d pages before it was cancelled", fetched)
+	}
+}
@@ -0,0 +1,93 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// newJSONServer serves five products, two per page, paged by cursor, offset or page number.
+func newJSONServer() *httptest.Server {
+	products := []string{"apple", "banana", "cherry", "date", "elderberry"}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		query := r.URL.Query()
+		start := 0
+		switch r.URL.Path {
+		case "/cursor":
+			start, _ = strconv.Atoi(query.Get("after"))
+		case "/offset":
+			start, _ = strconv.Atoi(query.Get("offset"))
+		case "/page":
+			page, _ := strconv.Atoi(query.Get("page"))
+			start = (page - 1) * 2
+		}
+		end := start + 2
+		if end > len(products) {
+			end = len(products)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"results": [`)
+		for i := start; i < end; i++ {
+			if i > start {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `{"id": %d, "attributes": {"name": %q, "price": %d.5}}`, 10000000000+i, products[i], i)
+		}
+		next := ""
+		if end < len(products) {
+			next = strconv.Itoa(end)
+		}
+		fmt.Fprintf(w, `], "paging": {"next": %q}}`, next)
+	}))
+}
+
+func TestScrapeJSONTarget(t *testing.T) {
+	server := newJSONServer()
+	defer server.Close()
+
+	fields := []crab.JSONField{{Name: "id", Path: "$.id"}, {Name: "name", Path: "$.attributes.name"}, {Name: "missing", Path: "$.nope"}}
+	tests := []struct {
+		name       string
+		path       string
+		pagination crab.JSONPagination
+		want       int
+	}{
+		{"single page", "/page?page=1", crab.JSONPagination{}, 2},
+		{"cursor", "/cursor", crab.JSONPagination{Type: crab.JSONPageCursor, Param: "after", CursorPath: "$.paging.next"}, 5},
+		{"offset", "/offset", crab.JSONPagination{Type: crab.JSONPageOffset, Param: "offset", LimitParam: "limit", Limit: 2}, 5},
+		{"page", "/page", crab.JSONPagination{Type: crab.JSONPageNumber, Param: "page"}, 5},
+		{"max pages", "/page", crab.JSONPagination{Type: crab.JSONPageNumber, Param: "page", MaxPages: 2}, 4},
+	}
+	for _, tt := range tests {
+		target := crab.JSONTarget{Name: "products", URL: server.URL + tt.path, Headers: map[string]string{"X-Api-Key": "secret"},
+			ItemsPath: "$.results[*]", Fields: fields, Pagination: tt.pagination}
+		records, err := crab.ScrapeJSONTarget(target, server.Client())
+		if err != nil {
+			t.Errorf("%s: ScrapeJSONTarget() error = %v", tt.name, err)
+			continue
+		}
+		if len(records) != tt.want {
+			t.Errorf("%s: got %d records, want %d", tt.name, len(records), tt.want)
+			continue
+		}
+		if fmt.Sprint(records[0]["id"]) != "10000000000" || records[0]["name"] != "apple" || records[0]["missing"] != nil {
+			t.Errorf("%s: first record = %v", tt.name, records[0])
+		}
+	}
+
+	target := crab.JSONTarget{Name: "products", URL: server.URL + "/page", ItemsPath: "$.results[*]", Fields: fields}
+	if _, err := crab.ScrapeJSONTarget(target, server.Client()); err == nil {
+		t.Error("ScrapeJSONTarget() without the API key succeeded")
+	}
+	target.Fields = []crab.JSONField{{Name: "bad", Path: "attributes.name"}}
+	if _, err := crab.ScrapeJSONTarget(target, server.Client()); err == nil {
+		t.Error("ScrapeJSONTarget() accepted an invalid field path")
+	}
+}
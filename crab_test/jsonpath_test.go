@@ -0,0 +1,53 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+func TestEvalJSONPath(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{
+		"data": {"items": [
+			{"name": "a", "price": 1, "tags": ["x", "y"]},
+			{"name": "b", "price": 2, "tags": []},
+			{"name": "c", "price": 3, "meta": {"name": "nested"}}
+		]},
+		"next": "abc",
+		"odd key": true
+	}`), &doc)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"$", "[map[data:map[items:[map[name:a price:1 tags:[x y]] map[name:b price:2 tags:[]] map[meta:map[name:nested] name:c price:3]]] next:abc odd key:true]]"},
+		{"$.next", "[abc]"},
+		{"$['odd key']", "[true]"},
+		{"$.data.items[*].name", "[a b c]"},
+		{"$.data.items[0].tags[*]", "[x y]"},
+		{"$.data.items[-1].price", "[3]"},
+		{"$.data.items[5].name", "[]"},
+		{"$..name", "[a b c nested]"},
+		{"$.data.items[*].missing", "[]"},
+		{"$.data.*[1].name", "[b]"},
+	}
+	for _, tt := range tests {
+		got, err := crab.EvalJSONPath(doc, tt.path)
+		if err != nil {
+			t.Errorf("EvalJSONPath(%q) error = %v", tt.path, err)
+			continue
+		}
+		if s := fmt.Sprint(got); s != tt.want {
+			t.Errorf("EvalJSONPath(%q) = %s, want %s", tt.path, s, tt.want)
+		}
+	}
+
+	for _, path := range []string{"data.items", "$.data[", "$.data[?(@.price > 1)]", "$.."} {
+		if _, err := crab.EvalJSONPath(doc, path); err == nil {
+			t.Errorf("EvalJSONPath(%q) succeeded, want an error", path)
+		}
+	}
+}
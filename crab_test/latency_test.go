@@ -0,0 +1,73 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyRecorder(t *testing.T) {
+	recorder := crab.NewLatencyRecorder()
+	for n := 1; n <= 100; n++ {
+		recorder.Add(fmt.Sprintf("https://Example.com/%d", n), time.Duration(n)*time.Millisecond, time.Duration(2*n)*time.Millisecond)
+	}
+	recorder.Add("http://other.org/", time.Second, time.Second)
+
+	domains := recorder.Domains()
+	if len(domains) != 2 || domains[0].Domain != "example.com" || domains[1].Domain != "other.org" {
+		t.Fatalf("Domains() = %+v, want example.com and other.org", domains)
+	}
+	want := crab.DomainLatency{Domain: "example.com", Requests: 100,
+		TTFB:  crab.LatencyPercentiles{P50: 50, P95: 95, P99: 99},
+		Fetch: crab.LatencyPercentiles{P50: 100, P95: 190, P99: 198}}
+	if domains[0] != want {
+		t.Errorf("example.com = %+v, want %+v", domains[0], want)
+	}
+	if got := domains[1].TTFB; got != (crab.LatencyPercentiles{P50: 1000, P95: 1000, P99: 1000}) {
+		t.Errorf("other.org TTFB = %+v, want 1000 ms throughout", got)
+	}
+}
+
+func TestCrawlLatency(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<title>Slow</title>`)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+
+	summary := crab.Crawl(context.Background(), []crab.URLData{{URL: server.URL + "/a"}, {URL: server.URL + "/b"}}, 1)
+	if len(summary.Latency) != 1 || summary.Latency[0].Requests != 2 {
+		t.Fatalf("latency = %+v, want the server's two requests", summary.Latency)
+	}
+	if latency := summary.Latency[0]; latency.TTFB.P50 < 20 || latency.Fetch.P99 < latency.TTFB.P50 {
+		t.Errorf("latency = %+v, want at least the server's 20 ms", latency)
+	}
+
+	// The history comes from the crawl reports when no store is set
+	domain := strings.Split(strings.TrimPrefix(server.URL, "http://"), ":")[0]
+	samples, err := crab.LatencyHistory(dir, domain, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 || samples[0].RunID != summary.RunID || samples[0].DomainLatency != summary.Latency[0] {
+		t.Errorf("LatencyHistory() = %+v, want the run's latency", samples)
+	}
+	if samples, err := crab.LatencyHistory(dir, "", summary.StartedAt.Add(time.Hour), time.Time{}); err != nil || len(samples) != 0 {
+		t.Errorf("LatencyHistory(from an hour later) = %+v, %v, want none", samples, err)
+	}
+
+	recorder := httptest.NewRecorder()
+	crab.LatencyHandler(recorder, httptest.NewRequest(http.MethodGet, "/api/latency?from=yesterday", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("from=yesterday: status %d, want 400", recorder.Code)
+	}
+}
@@ -0,0 +1,51 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTraceValue(t *testing.T) {
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+	defer crab.UseFixtures(filepath.Join(fixturesDir, "gasoline"), false)()
+
+	before := time.Now().UTC()
+	crab.ScrapeGasInflationData()
+	runs, err := crab.ListRuns(dir)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("ListRuns() = %v, %v", runs, err)
+	}
+
+	lineage, err := crab.DatasetLineage(dir, "gasoline", "")
+	if err != nil || len(lineage) != 3 {
+		t.Fatalf("DatasetLineage() = %d rows, %v, want 3", len(lineage), err)
+	}
+	matches, err := crab.TraceValue(dir, "gasoline", runs[0], "average_gasoline_prices", "$3.01")
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("TraceValue($3.01) = %+v, %v, want one row", matches, err)
+	}
+	row := matches[0]
+	if row.Row != 1 || row.Values["year"] != "2021" || row.RunID != runs[0] || row.Selector != "table tbody tr" || row.ExtractorVersion == "" {
+		t.Errorf("lineage of $3.01 = %+v", row)
+	}
+	if !strings.Contains(row.SourceURL, "gasoline") || row.FetchedAt.Before(before.Truncate(time.Second)) {
+		t.Errorf("lineage source = %s fetched %s", row.SourceURL, row.FetchedAt)
+	}
+	if matches, _ := crab.TraceValue(dir, "gasoline", "", "year", "$3.01"); len(matches) != 0 {
+		t.Errorf("TraceValue() matched a value outside its column: %+v", matches)
+	}
+
+	// The lineage belongs to the run like the data does
+	if problems, err := crab.VerifyRunManifest(filepath.Join(dir, runs[0])); err != nil || len(problems) != 0 {
+		t.Errorf("VerifyRunManifest() = %v, %v", problems, err)
+	}
+	files, _ := crab.RunOutputFiles(filepath.Join(dir, runs[0]))
+	if len(files) != 4 {
+		t.Errorf("RunOutputFiles() = %v, want the data, its lineage and statistics and the manifest", files)
+	}
+}
@@ -0,0 +1,95 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/crab/client"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// linkSiteMap is a small site: the home page leads to a section and a product two clicks down, a
+// retired page is still crawled but nothing links to it, and the product links outside the crawl.
+var linkSiteMap = map[string][]string{
+	"https://shop.example/":             {"https://shop.example/section/", "https://shop.example/#top"},
+	"https://shop.example/section":      {"https://shop.example/section/item", "https://shop.example/"},
+	"https://shop.example/section/item": {"https://other.example/", "https://shop.example/section/item"},
+	"https://shop.example/retired":      {"https://shop.example/section"},
+}
+
+func TestLinkGraph(t *testing.T) {
+	g := crab.NewLinkGraph(linkSiteMap, []string{"https://shop.example/"})
+	if got, want := g.Inlinks("https://shop.example/section/"), []string{"https://shop.example/", "https://shop.example/retired"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Inlinks(section) = %v, want %v", got, want)
+	}
+	if got, want := g.Orphans(), []string{"https://shop.example/retired"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Orphans() = %v, want %v", got, want)
+	}
+	if got, want := g.DeeperThan(1), []string{"https://other.example/", "https://shop.example/section/item"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DeeperThan(1) = %v, want %v", got, want)
+	}
+	if page := g.Page("https://other.example/"); page.Depth != 3 || page.Crawled || page.Inlinks != 1 {
+		t.Errorf("Page(other) = %+v", page)
+	}
+	if page := g.Page("https://shop.example/section/item"); page.Depth != 2 || !page.Crawled || page.Outlinks != 1 || page.Inlinks != 1 {
+		t.Errorf("Page(item) = %+v, a link to itself counts neither way", page)
+	}
+
+	result, err := g.Query(crab.LinkQuery{Kind: "deeper", Depth: 0, Prefix: "https://shop.example/", Limit: 1, Offset: 1})
+	if err != nil || result.Total != 2 || len(result.Pages) != 1 || result.Pages[0].URL != "https://shop.example/section" {
+		t.Errorf("Query(deeper than 0 on shop, second page) = %+v, %v", result, err)
+	}
+	for _, q := range []crab.LinkQuery{{Kind: "inlinks"}, {Kind: "depth"}, {Kind: "deeper", Depth: -1}} {
+		if _, err := g.Query(q); err == nil {
+			t.Errorf("Query(%+v) succeeded", q)
+		}
+	}
+	if _, err := crab.NewLinkGraph(linkSiteMap, nil).Query(crab.LinkQuery{Kind: "deeper", Depth: 1}); err == nil {
+		t.Errorf("a deeper query without seeds succeeded")
+	}
+}
+
+func TestLinkGraphOfRun(t *testing.T) {
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+	write := func(runID, name string, v interface{}) {
+		t.Helper()
+		data, _ := json.Marshal(v)
+		if err := os.MkdirAll(filepath.Join(dir, runID), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, runID, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	older := crab.NewRunID(time.Now().Add(-time.Hour))
+	write(older, "siteMap.json", map[string][]string{"https://shop.example/": nil})
+	crawl := crab.NewRunID(time.Now())
+	write(crawl, "siteMap.json", linkSiteMap)
+	write(crawl, "crawl_report.json", crab.RunSummary{Kind: "crawl", Seeds: []string{"https://shop.example/"}})
+	write(crab.NewRunID(time.Now().Add(time.Minute)), "inflation_data.json", []string{})
+
+	g, err := crab.LoadLinkGraph(dir, "")
+	if err != nil || g.RunID != crawl || len(g.Seeds) != 1 {
+		t.Fatalf("LoadLinkGraph() = %+v, %v, want the graph of the newest crawl", g, err)
+	}
+	if g, err := crab.LoadLinkGraph(dir, older); err != nil || g.RunID != older || len(g.Orphans()) != 1 {
+		t.Errorf("LoadLinkGraph(older) = %+v, %v, want its one page an orphan as it recorded no seeds", g, err)
+	}
+
+	server := httptest.NewServer(crab.NewDaemon(crab.DaemonConfig{}, crab.NewJobQueue(crab.NewMemoryJobStore())).Handler())
+	defer server.Close()
+	result, err := client.New(server.URL).QueryLinks(context.Background(), client.QueryLinksParams{Query: "orphans"})
+	if err != nil || result.RunID != crawl || result.Total != 1 || result.Pages[0].URL != "https://shop.example/retired" {
+		t.Errorf("QueryLinks(orphans) = %+v, %v", result, err)
+	}
+	if _, err := client.New(server.URL).QueryLinks(context.Background(), client.QueryLinksParams{Query: "deeper", Depth: 1, Run: older}); err == nil {
+		t.Errorf("a deeper query of a crawl without seeds succeeded")
+	}
+}
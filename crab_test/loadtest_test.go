@@ -0,0 +1,75 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"context"
+	"testing"
+)
+
+func TestRunLoadTest(t *testing.T) {
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}})
+	defer crab.SetConfig(crab.Config{})
+
+	result, err := crab.RunLoadTest(context.Background(), crab.LoadTestOptions{Pages: 50, Fanout: 3, Workers: 4, ParseWorkers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Pages != 50 || result.Errors != 0 {
+		t.Fatalf("crawled %d pages with %d errors, want the 50 pages of the site", result.Pages, result.Errors)
+	}
+	if result.FetchWorkers != 4 || result.ParseWorkers != 2 {
+		t.Errorf("workers = %d fetch, %d parse, want 4 and 2", result.FetchWorkers, result.ParseWorkers)
+	}
+	if result.PagesPerSec <= 0 || result.AllocsPerPage <= 0 || result.GoroutinesPeak < result.GoroutinesBefore {
+		t.Errorf("result = %+v, want its throughput, allocations and goroutines measured", result)
+	}
+	if result.CollectorsCreated > 4 {
+		t.Errorf("%d collectors created for 4 fetch workers, want them reused", result.CollectorsCreated)
+	}
+	if got := crab.CurrentConfig().Pipeline.ParseWorkers; got != 0 {
+		t.Errorf("parse workers left at %d after the load test, want the configuration restored", got)
+	}
+}
+
+// BenchmarkCrawl crawls b.N pages of the synthetic site through the whole pipeline.
+func BenchmarkCrawl(b *testing.B) {
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: b.TempDir()}})
+	defer crab.SetConfig(crab.Config{})
+	b.ResetTimer()
+	result, err := crab.RunLoadTest(context.Background(), crab.LoadTestOptions{Pages: b.N})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(result.PagesPerSec, "pages/sec")
+	b.ReportMetric(result.AllocsPerPage, "allocs/page")
+	b.ReportMetric(float64(result.GoroutinesPeak), "goroutines")
+}
+
+func BenchmarkFetchPage(b *testing.B) {
+	site := testsite.New(testsite.Config{Pages: 1, Paragraphs: 20})
+	defer site.Close()
+	crab.SetConfig(crab.Config{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if page := crab.FetchPage(crab.URLData{URL: site.PageURL(0)}); page.Error != "" {
+			b.Fatal(page.Error)
+		}
+	}
+}
+
+func BenchmarkParsePage(b *testing.B) {
+	site := testsite.New(testsite.Config{Pages: 20, Links: testsite.Complete(20), Paragraphs: 20})
+	defer site.Close()
+	crab.SetConfig(crab.Config{})
+	page := crab.FetchPage(crab.URLData{URL: site.PageURL(0)})
+	if page.Error != "" {
+		b.Fatal(page.Error)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		crab.ParsePage(page)
+	}
+}
@@ -0,0 +1,98 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"compress/gzip"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogLevels(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 1, Status: map[string]int{"/page/1": 404}})
+	defer site.Close()
+	var buf strings.Builder
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer crab.SetLogLevel(crab.LevelInfo)
+
+	tests := []struct {
+		level    string
+		crawled  bool // The debug message of a page fetched
+		notFound bool // The warning of a page not found
+	}{
+		{"debug", true, true},
+		{"info", false, true},
+		{"warning", false, true},
+		{"error", false, false},
+	}
+	for _, test := range tests {
+		if _, err := crab.SetupLogging(crab.LogConfig{Level: test.level}); err != nil {
+			t.Fatalf("SetupLogging(%s) failed: %v", test.level, err)
+		}
+		buf.Reset()
+		crab.FetchPage(crab.URLData{URL: site.PageURL(0)})
+		crab.FetchPage(crab.URLData{URL: site.PageURL(1)})
+		logged := buf.String()
+		if crawled := strings.Contains(logged, "DEBUG Crawled URL"); crawled != test.crawled {
+			t.Errorf("level %s: logged the page fetched = %v, want %v", test.level, crawled, test.crawled)
+		}
+		if warned := strings.Contains(logged, "WARN Error occurred while crawling"); warned != test.notFound {
+			t.Errorf("level %s: logged the 404 = %v, want %v", test.level, warned, test.notFound)
+		}
+	}
+	if _, err := crab.SetupLogging(crab.LogConfig{Level: "verbose"}); err == nil {
+		t.Error("SetupLogging() accepted an unknown level")
+	}
+}
+
+func TestLogFileRotation(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "logs", "crab.log")
+	f, err := crab.OpenLogFile(crab.LogConfig{File: name, MaxSizeMB: 1, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.Repeat("x", 1023) + "\n"
+	for i := 0; i < 4*1024; i++ {
+		if _, err := io.WriteString(f, line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Rotate()
+	io.WriteString(f, "last\n")
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Four full files were rotated, of which the last two are kept
+	backups := f.Backups()
+	if len(backups) != 2 {
+		t.Fatalf("Backups() = %v, want 2 files", backups)
+	}
+	for _, backup := range backups {
+		if !strings.HasSuffix(backup, ".log.gz") {
+			t.Errorf("backup %s is not compressed", backup)
+			continue
+		}
+		file, err := os.Open(backup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			t.Fatalf("reading %s: %v", backup, err)
+		}
+		data, _ := io.ReadAll(gz)
+		file.Close()
+		if len(data) != 1<<20 {
+			t.Errorf("%s holds %d bytes, want 1MB", backup, len(data))
+		}
+	}
+	if data, _ := os.ReadFile(name); string(data) != "last\n" {
+		t.Errorf("the current log holds %q, want the last line", data)
+	}
+}
@@ -0,0 +1,119 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeDatasets(t *testing.T) {
+	previous := crab.Dataset{Name: "gasoline", Columns: []string{"year", "price"}, RunID: "run1",
+		Rows: [][]string{{"1978", "0.65"}, {"1979", "0.88"}}}
+	current := crab.Dataset{Name: "gasoline", Columns: []string{"year", "price"},
+		Rows: [][]string{{"1979", "0.86"}, {"1980", "1.22"}, {"1980", "1.25"}}}
+
+	tests := []struct {
+		strategy crab.MergeStrategy
+		want     [][]string
+		kept     string
+	}{
+		{crab.MergeKeepLatest, [][]string{{"1978", "0.65"}, {"1979", "0.86"}, {"1980", "1.25"}}, "current"},
+		{crab.MergeKeepFirst, [][]string{{"1978", "0.65"}, {"1979", "0.88"}, {"1980", "1.22"}}, "previous"},
+	}
+	for _, tt := range tests {
+		merged, report, err := crab.MergeDatasets(previous, current, crab.MergeRule{Strategy: tt.strategy, Key: []string{"Year"}})
+		if err != nil {
+			t.Fatalf("MergeDatasets(%s) error = %v", tt.strategy, err)
+		}
+		if !reflect.DeepEqual(merged.Rows, tt.want) {
+			t.Errorf("MergeDatasets(%s) rows = %v, want %v", tt.strategy, merged.Rows, tt.want)
+		}
+		if report.PreviousRun != "run1" || report.Added != 1 || report.Carried != 1 || len(report.Conflicts) != 2 {
+			t.Errorf("MergeDatasets(%s) report = %+v", tt.strategy, report)
+		}
+		want := crab.RowConflict{Key: map[string]string{"Year": "1979"}, Changes: []crab.ColumnChange{{Column: "price", Previous: "0.88", Current: "0.86"}}, Kept: tt.kept}
+		if len(report.Conflicts) > 0 && !reflect.DeepEqual(report.Conflicts[0], want) {
+			t.Errorf("MergeDatasets(%s) conflict = %+v, want %+v", tt.strategy, report.Conflicts[0], want)
+		}
+	}
+
+	_, report, err := crab.MergeDatasets(previous, current, crab.MergeRule{Strategy: crab.MergeErrorOnConflict, Key: []string{"year"}})
+	if !errors.Is(err, crab.ErrMergeConflict) || len(report.Conflicts) != 2 {
+		t.Errorf("MergeDatasets(error-on-conflict) = %d conflicts, %v, want ErrMergeConflict", len(report.Conflicts), err)
+	}
+	unchanged := crab.Dataset{Name: "gasoline", Columns: previous.Columns, Rows: [][]string{{"1979", "0.88"}}}
+	if _, report, err := crab.MergeDatasets(previous, unchanged, crab.MergeRule{Strategy: crab.MergeErrorOnConflict, Key: []string{"year"}}); err != nil || report.Unchanged != 1 {
+		t.Errorf("MergeDatasets() of an unchanged row = %+v, %v", report, err)
+	}
+	if _, _, err := crab.MergeDatasets(previous, current, crab.MergeRule{Strategy: "newest", Key: []string{"year"}}); err == nil {
+		t.Error("MergeDatasets() with an unknown strategy succeeded")
+	}
+	if _, _, err := crab.MergeDatasets(previous, current, crab.MergeRule{Strategy: crab.MergeKeepFirst, Key: []string{"month"}}); err == nil {
+		t.Error("MergeDatasets() with an unknown key column succeeded")
+	}
+}
+
+func TestScrapeMergesIntoPreviousRun(t *testing.T) {
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+	scrape := func() {
+		defer crab.UseFixtures(filepath.Join(fixturesDir, "inflation"), false)()
+		crab.ScrapeInflationData()
+		time.Sleep(5 * time.Millisecond) // Keep the run IDs in order
+	}
+	scrape()
+	runs, err := crab.ListRuns(dir)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("ListRuns() = %v, %v, want 1 run", runs, err)
+	}
+
+	// Pretend the first run saw an older year and another January figure
+	first := filepath.Join(dir, runs[0], "inflation_data.json")
+	var data []crab.YearData
+	raw, err := os.ReadFile(first)
+	if err == nil {
+		err = json.Unmarshal(raw, &data)
+	}
+	if err != nil || len(data) == 0 {
+		t.Fatalf("reading %s: %v", first, err)
+	}
+	year, jan := data[0].Year, data[0].Jan
+	data[0].Jan = "9.9"
+	data = append(data, crab.YearData{Year: "1900", Jan: "0.1"})
+	if _, err := crab.WriteRecords(first, data); err != nil {
+		t.Fatal(err)
+	}
+
+	crab.SetConfig(crab.Config{
+		Output: crab.OutputConfig{Dir: dir},
+		Merge:  map[string]crab.MergeRule{"inflation": {Strategy: crab.MergeKeepLatest, Key: []string{"year"}}},
+	})
+	scrape()
+	runs, _ = crab.ListRuns(dir)
+	merged, err := crab.LoadDatasetAsOf(dir, "inflation", "")
+	if err != nil || merged.RunID != runs[1] || len(merged.Rows) != len(data) {
+		t.Fatalf("merged inflation = run %s with %d rows, %v, want run %s with %d rows", merged.RunID, len(merged.Rows), err, runs[1], len(data))
+	}
+	if merged.Rows[0][1] != jan || merged.Rows[len(data)-1][0] != "1900" {
+		t.Errorf("merged rows = %v, want the scraped January and the 1900 row carried over", merged.Rows)
+	}
+
+	var report crab.MergeReport
+	raw, err = os.ReadFile(filepath.Join(dir, runs[1], "inflation_data.conflicts.json"))
+	if err == nil {
+		err = json.Unmarshal(raw, &report)
+	}
+	want := []crab.RowConflict{{Key: map[string]string{"year": year}, Changes: []crab.ColumnChange{{Column: "jan", Previous: "9.9", Current: jan}}, Kept: "current"}}
+	if err != nil || report.PreviousRun != runs[0] || report.Carried != 1 || !reflect.DeepEqual(report.Conflicts, want) {
+		t.Errorf("conflict report = %+v, %v, want conflicts %+v", report, err, want)
+	}
+	if _, err := crab.VerifyRunManifest(filepath.Join(dir, runs[1])); err != nil {
+		t.Errorf("VerifyRunManifest() error = %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteRecords(t *testing.T) {
+	dir := t.TempDir()
+	records := []crab.GasolineData{{Year: "2020", AverageGasolinePrices: "$2.17"}, {Year: "2021", AverageGasolinePrices: "$3.01"}}
+
+	filename, err := crab.WriteRecords(filepath.Join(dir, "gasoline_data.json"), records)
+	if err != nil || filepath.Base(filename) != "gasoline_data.json" {
+		t.Fatalf("WriteRecords() in JSON mode = %q, %v", filename, err)
+	}
+
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Format: crab.OutputFormatNDJSON}})
+	defer crab.SetConfig(crab.Config{})
+
+	filename, err = crab.WriteRecords(filepath.Join(dir, "gasoline_data.json"), records)
+	if err != nil || filepath.Base(filename) != "gasoline_data.ndjson" {
+		t.Fatalf("WriteRecords() in NDJSON mode = %q, %v", filename, err)
+	}
+	data, _ := os.ReadFile(filename)
+	want := `{"year":"2020","average_gasoline_prices":"$2.17","average_annual_cpi_for_gas":"","gas_prices_adjusted_for_inflation":""}` + "\n" +
+		`{"year":"2021","average_gasoline_prices":"$3.01","average_annual_cpi_for_gas":"","gas_prices_adjusted_for_inflation":""}` + "\n"
+	if string(data) != want {
+		t.Errorf("NDJSON output = %q, want %q", data, want)
+	}
+
+	if _, err := crab.WriteRecords(filepath.Join(dir, "x.json"), records[0]); err == nil {
+		t.Errorf("WriteRecords() of a single record in NDJSON mode error = nil, want error")
+	}
+}
+
+func TestLoadNDJSONSiteMap(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "siteMap.ndjson")
+	os.WriteFile(filename, []byte(`{"url":"http://a.com/","links":["http://a.com/1"]}`+"\n\n"+`{"url":"http://b.com/","links":[]}`+"\n"), 0644)
+
+	siteMap, err := crab.LoadSiteMap(filename)
+	if err != nil {
+		t.Fatalf("LoadSiteMap() error = %v", err)
+	}
+	want := map[string][]string{"http://a.com/": {"http://a.com/1"}, "http://b.com/": {}}
+	if !reflect.DeepEqual(siteMap, want) {
+		t.Errorf("LoadSiteMap() = %v, want %v", siteMap, want)
+	}
+}
@@ -0,0 +1,75 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseNumber(t *testing.T) {
+	european := crab.NumberFormat{Decimal: ","}
+	tests := []struct {
+		in     string
+		format crab.NumberFormat
+		want   crab.Number
+	}{
+		{"$1,234.50", crab.NumberFormat{}, crab.Number{Value: 1234.5, Unit: "$"}},
+		{" 3.95 ", crab.NumberFormat{}, crab.Number{Value: 3.95}},
+		{"(12.5)", crab.NumberFormat{}, crab.Number{Value: -12.5}},
+		{"-$4", crab.NumberFormat{}, crab.Number{Value: -4, Unit: "$"}},
+		{"$-4", crab.NumberFormat{}, crab.Number{Value: -4, Unit: "$"}},
+		{"5.2%", crab.NumberFormat{}, crab.Number{Value: 5.2, Unit: "%"}},
+		{"1.234,5 €", european, crab.Number{Value: 1234.5, Unit: "€"}},
+		{"1 234,5", european, crab.Number{Value: 1234.5}},
+		{"1'234.5", crab.NumberFormat{}, crab.Number{Value: 1234.5}},
+		{"1,920 sq ft", crab.NumberFormat{}, crab.Number{Value: 1920, Unit: "sq ft"}},
+		{"0.5 acres", crab.NumberFormat{Unit: "sq ft"}, crab.Number{Value: 21780, Unit: "sq ft"}},
+		{"0.12", crab.NumberFormat{Unit: "acres"}, crab.Number{Value: 0.12, Unit: "acres"}},
+		{"2 acre", crab.NumberFormat{Unit: "acres"}, crab.Number{Value: 2, Unit: "acres"}},
+	}
+	for _, tt := range tests {
+		got, err := crab.ParseNumber(tt.in, tt.format)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseNumber(%q, %+v) = %+v, %v, want %+v", tt.in, tt.format, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "n/a", "$", "12 apples"} {
+		if got, err := crab.ParseNumber(in, crab.NumberFormat{}); err == nil {
+			t.Errorf("ParseNumber(%q) = %+v, want an error", in, got)
+		}
+	}
+	if got, err := crab.ParseNumber("5%", crab.NumberFormat{Unit: "$"}); err == nil {
+		t.Errorf("ParseNumber() of a percentage as dollars = %+v, want an error", got)
+	}
+}
+
+func TestCleanDataset(t *testing.T) {
+	ds := crab.Dataset{Name: "gasoline", Columns: []string{"year", "price", "note"},
+		Rows: [][]string{{"2022", "$3.95", "$1"}, {"2021", "", ""}, {"2020", "n/a", ""}}}
+	clean, errs := crab.CleanDataset(ds, map[string]crab.NumberFormat{"price": {}})
+	want := [][]string{{"2022", "3.95", "$1"}, {"2021", "", ""}, {"2020", "n/a", ""}}
+	if !reflect.DeepEqual(clean.Rows, want) || len(errs) != 1 {
+		t.Errorf("CleanDataset() = %v, %v, want %v and one error", clean.Rows, errs, want)
+	}
+	if ds.Rows[0][1] != "$3.95" {
+		t.Errorf("CleanDataset() changed its input: %v", ds.Rows)
+	}
+
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{
+		Output:  crab.OutputConfig{Dir: dir},
+		Numbers: map[string]map[string]crab.NumberFormat{"gasoline": {"average_gasoline_prices": {Unit: "$"}}},
+	})
+	defer crab.SetConfig(crab.Config{})
+	defer crab.UseFixtures(filepath.Join(fixturesDir, "gasoline"), false)()
+	crab.ScrapeGasInflationData()
+	scraped, err := crab.LoadDatasetAsOf(dir, "gasoline", "")
+	if err != nil || len(scraped.Rows) == 0 {
+		t.Fatalf("LoadDatasetAsOf() = %+v, %v", scraped, err)
+	}
+	if price, adjusted := scraped.Rows[0][1], scraped.Rows[0][3]; price != "3.95" || adjusted != "$3.95" {
+		t.Errorf("scraped prices = %q and %q, want only the configured column cleaned", price, adjusted)
+	}
+}
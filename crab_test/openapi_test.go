@@ -0,0 +1,109 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/crab/client"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPISpec(t *testing.T) {
+	routes := crab.NewDaemon(crab.DaemonConfig{}, nil).Routes()
+	spec := crab.OpenAPISpec(routes)
+	for _, route := range routes {
+		if spec.Paths[route.Path][strings.ToLower(route.Method)] == nil {
+			t.Errorf("the spec has no %s %s", route.Method, route.Path)
+		}
+	}
+	create := spec.Paths["/jobs"]["post"]
+	if create == nil || create.RequestBody == nil || create.RequestBody.Content["application/json"].Schema.Ref != "#/components/schemas/JobRequest" ||
+		create.Responses["202"] == nil || create.Responses["403"] == nil || create.RequiredRole != "operator" {
+		t.Errorf("POST /jobs = %+v", create)
+	}
+	if get := spec.Paths["/jobs/{id}"]["get"]; get == nil || len(get.Parameters) != 1 || get.Parameters[0].In != "path" {
+		t.Errorf("GET /jobs/{id} = %+v", get)
+	}
+	job := spec.Components.Schemas["Job"]
+	if job == nil || job.Properties["created_at"] == nil || job.Properties["created_at"].Format != "date-time" {
+		t.Fatalf("Job schema = %+v", job)
+	}
+	for _, name := range job.Required {
+		if name == "finished_at" {
+			t.Errorf("the omitempty field finished_at of Job is required")
+		}
+	}
+	if health := spec.Paths["/healthz"]["get"]; health == nil || health.Security != nil {
+		t.Errorf("GET /healthz = %+v, want it open", health)
+	}
+
+	// The committed client is the one the routes generate
+	generated, err := crab.GenerateClient(routes, "client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if committed, err := os.ReadFile("../crab/client/operations.go"); err != nil || string(committed) != string(generated) {
+		t.Errorf("crab/client/operations.go is out of date, run go generate in crab/client (%v)", err)
+	}
+}
+
+func TestGeneratedClient(t *testing.T) {
+	crab.SetConfig(crab.Config{API: crab.APIConfig{Keys: []crab.APIKey{
+		{Name: "dashboard", Key: "view-key", Role: "viewer"},
+		{Name: "scheduler", Key: "op-key", Role: "operator"},
+	}}})
+	defer crab.SetConfig(crab.Config{})
+	queue := crab.NewJobQueue(crab.NewMemoryJobStore())
+	queue.Register("noop", func(ctx context.Context, job crab.Job) error { return nil })
+	server := httptest.NewServer(crab.NewDaemon(crab.DaemonConfig{}, queue).Handler())
+	defer server.Close()
+	ctx := context.Background()
+
+	operator := client.New(server.URL)
+	operator.APIKey = "op-key"
+	job, err := operator.CreateJob(ctx, crab.JobRequest{Type: "noop", Params: map[string]string{"n": "1"}})
+	if err != nil || job.ID == "" || job.State != crab.JobQueued {
+		t.Fatalf("CreateJob() = %+v, %v", job, err)
+	}
+	viewer := &client.Client{BaseURL: server.URL + "/", APIKey: "view-key"}
+	if got, err := viewer.GetJob(ctx, job.ID); err != nil || got.Params["n"] != "1" {
+		t.Errorf("GetJob() = %+v, %v", got, err)
+	}
+	if jobs, err := viewer.ListJobs(ctx); err != nil || len(jobs) != 1 {
+		t.Errorf("ListJobs() = %+v, %v", jobs, err)
+	}
+
+	var apiErr *client.Error
+	if _, err := viewer.CreateJob(ctx, crab.JobRequest{Type: "noop"}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusForbidden {
+		t.Errorf("CreateJob() as a viewer = %v, want 403", err)
+	}
+	if _, err := viewer.GetJob(ctx, "missing"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("GetJob() of a missing job = %v, want 404", err)
+	}
+	if _, err := client.New(server.URL).ListJobs(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("ListJobs() without a key = %v, want 401", err)
+	}
+
+	anonymous := client.New(server.URL)
+	if health, err := anonymous.Health(ctx); err != nil || health.Status != "ok" {
+		t.Errorf("Health() = %+v, %v", health, err)
+	}
+	if spec, err := anonymous.OpenAPI(ctx); err != nil || spec.Paths["/api/datasets/{name}"] == nil {
+		t.Errorf("OpenAPI() = %v", err)
+	}
+	if metrics, err := anonymous.Metrics(ctx); err != nil || len(metrics) == 0 {
+		t.Errorf("Metrics() = %d bytes, %v", len(metrics), err)
+	}
+	resp, err := http.Post(server.URL+"/healthz", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET" {
+		t.Errorf("POST /healthz = %d, Allow %q, want 405", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+}
@@ -0,0 +1,112 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNextPageURL(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/list/index.html?sort=price")
+	tests := []struct {
+		name   string
+		html   string
+		config crab.PaginationConfig
+		want   string
+	}{
+		{"disabled", `<link rel="next" href="page2.html">`, crab.PaginationConfig{}, ""},
+		{"link rel", `<head><link rel="next" href="page2.html"></head>`, crab.PaginationConfig{FollowRelNext: true}, "https://example.com/list/page2.html"},
+		{"anchor rel", `<a rel="nofollow next" href="/list/2">Next</a>`, crab.PaginationConfig{FollowRelNext: true}, "https://example.com/list/2"},
+		{"selector", `<ul><li class="next"><a href="page-2.html">next</a></li></ul>`, crab.PaginationConfig{NextSelector: "li.next a"}, "https://example.com/list/page-2.html"},
+		{"javascript link", `<li class="next"><a href="javascript:void(0)">next</a></li>`, crab.PaginationConfig{NextSelector: "li.next a"}, ""},
+		{"page param", `<div class="item"></div>`, crab.PaginationConfig{PageParam: "page"}, "https://example.com/list/index.html?page=2&sort=price"},
+		{"page param past the end", `<p>No results</p>`, crab.PaginationConfig{PageParam: "page"}, ""},
+		{"rel wins", `<a rel="next" href="a.html"></a><li class="next"><a href="b.html"></a></li>`, crab.PaginationConfig{FollowRelNext: true, NextSelector: "li.next a"}, "https://example.com/list/a.html"},
+	}
+	for _, tt := range tests {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := crab.NextPageURL(doc.Selection, pageURL, tt.config, "div.item"); got != tt.want {
+			t.Errorf("%s: NextPageURL() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// newPagedServer serves three pages of two items each at /list?page=N, with rel=next links between them.
+func newPagedServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		if page > 3 {
+			fmt.Fprint(w, "<html><body><p>No more items</p></body></html>")
+			return
+		}
+		fmt.Fprint(w, "<html><head>")
+		if page < 3 {
+			fmt.Fprintf(w, `<link rel="next" href="/list?page=%d">`, page+1)
+		}
+		fmt.Fprint(w, "</head><body>")
+		for i := 1; i <= 2; i++ {
+			fmt.Fprintf(w, `<div class="item">%d-%d</div>`, page, i)
+		}
+		fmt.Fprint(w, "</body></html>")
+	}))
+}
+
+func TestAttachPagination(t *testing.T) {
+	server := newPagedServer()
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		config crab.PaginationConfig
+		want   int
+	}{
+		{"rel next", crab.PaginationConfig{FollowRelNext: true}, 6},
+		{"page param", crab.PaginationConfig{PageParam: "page"}, 6},
+		{"max pages", crab.PaginationConfig{PageParam: "page", MaxPages: 2}, 4},
+		{"disabled", crab.PaginationConfig{}, 2},
+	}
+	for _, tt := range tests {
+		var items []string
+		c := colly.NewCollector()
+		c.OnHTML("div.item", func(e *colly.HTMLElement) {
+			items = append(items, e.Text)
+		})
+		crab.AttachPagination(c, tt.config, "div.item")
+		c.Visit(server.URL + "/list")
+		if len(items) != tt.want {
+			t.Errorf("%s: scraped %v, want %d items", tt.name, items, tt.want)
+		}
+	}
+}
+
+func TestWalkPages(t *testing.T) {
+	server := newPagedServer()
+	defer server.Close()
+
+	var items []string
+	err := crab.WalkPages(server.Client(), server.URL+"/list", crab.PaginationConfig{PageParam: "page"}, "div.item", func(doc *goquery.Document) error {
+		doc.Find("div.item").Each(func(_ int, s *goquery.Selection) {
+			items = append(items, s.Text())
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkPages() error = %v", err)
+	}
+	if strings.Join(items, ",") != "1-1,1-2,2-1,2-2,3-1,3-2" {
+		t.Errorf("WalkPages() visited items %v", items)
+	}
+}
@@ -0,0 +1,126 @@
+package crab_test
+
+import (
+	"bytes"
+	"cmpscfa23team2/crab"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+const linksPage = `<html><head><base href="https://docs.example.com/guide/"></head><body>
+<a href="intro.html#setup">Intro</a>
+<a href="#top">Top</a>
+<a href="/about">About</a>
+<a href="//cdn.example.com/file.pdf">File</a>
+<a>No href</a>
+<p><a href="https://other.example.org/x?q=1">Other</a></p>
+</body></html>`
+
+func TestExtractLinksMatchesColly(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(linksPage))
+	}))
+	defer server.Close()
+
+	var want []string
+	c := colly.NewCollector()
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		if link := e.Request.AbsoluteURL(e.Attr("href")); link != "" {
+			want = append(want, link)
+		}
+	})
+	if err := c.Visit(server.URL + "/page"); err != nil {
+		t.Fatal(err)
+	}
+
+	pageURL, _ := url.Parse(server.URL + "/page")
+	got := crab.ExtractLinks([]byte(linksPage), pageURL)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractLinks() = %q, colly found %q", got, want)
+	}
+}
+
+func TestExtractLinksWithoutBase(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/a/b.html")
+	got := crab.ExtractLinks([]byte(`<a href="c.html">C</a><a href="../d">D</a>`), pageURL)
+	want := []string{"https://example.com/a/c.html", "https://example.com/d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractLinks() = %q, want %q", got, want)
+	}
+}
+
+const regionsPage = `<html><head><title>Rates</title><script>var x = "<table>";</script></head><body>
+<div class="nav"><p>Menu</p><a href="/home">Home</a></div>
+<table id="outer"><tr><td>2023</td><td><table id="inner"><tr><td>1.5</td></tr></table></td></tr></table>
+<p>Footer</p>
+<table id="second"><tbody><tr><td>2024</td></tr></tbody></table>
+</body></html>`
+
+func TestParseRegions(t *testing.T) {
+	full, err := crab.ParseDocument([]byte(regionsPage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := crab.ParseRegions([]byte(regionsPage), "table")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := doc.Find("body > table").Length(); n != 2 {
+		t.Errorf("found %d top-level tables, want 2", n)
+	}
+	if doc.Find("p, a, title, script").Length() != 0 {
+		html, _ := doc.Html()
+		t.Errorf("regions kept elements outside the tables: %s", html)
+	}
+	rows := func(doc *goquery.Document) []string {
+		var cells []string
+		doc.Find("table tbody tr td").Each(func(_ int, s *goquery.Selection) { cells = append(cells, s.Text()) })
+		return cells
+	}
+	if got, want := rows(doc), rows(full); !reflect.DeepEqual(got, want) {
+		t.Errorf("table cells = %q, the full page has %q", got, want)
+	}
+
+	links, err := crab.ParseRegions([]byte(regionsPage), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if href, _ := links.Find("a[href]").Attr("href"); href != "/home" || links.Find("table").Length() != 0 {
+		t.Errorf("link regions = %q, want only the /home link", href)
+	}
+}
+
+func TestParseDocumentReusesBody(t *testing.T) {
+	body := []byte(`<p class="x">kept</p>`)
+	doc, err := crab.ParseDocument(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(body, bytes.Repeat([]byte("z"), len(body)))
+	if got := doc.Find("p.x").Text(); got != "kept" {
+		t.Errorf("document changed with its body: %q", got)
+	}
+}
+
+func BenchmarkExtractLinks(b *testing.B) {
+	page := bytes.Repeat([]byte(`<div><p>text</p><a href="/next">next</a></div>`), 2000)
+	pageURL, _ := url.Parse("https://example.com/")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		crab.ExtractLinks(page, pageURL)
+	}
+}
+
+func BenchmarkParseDocument(b *testing.B) {
+	page := bytes.Repeat([]byte(`<div><p>text</p><a href="/next">next</a></div>`), 2000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		crab.ParseDocument(page)
+	}
+}
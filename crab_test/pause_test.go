@@ -0,0 +1,205 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPauseList(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "paused.json")
+	pauses := crab.NewPauseList(file)
+	if err := pauses.PauseDomain("Example.com:8080"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pauses.PauseJob("job-1"); err != nil {
+		t.Fatal(err)
+	}
+	for host, want := range map[string]bool{"example.com": true, "www.example.com": true, "notexample.com": false} {
+		if got := pauses.DomainPaused(host); got != want {
+			t.Errorf("DomainPaused(%s) = %v, want %v", host, got, want)
+		}
+	}
+
+	// Another process, or a restart, sees the same pauses
+	restarted := crab.NewPauseList(file)
+	if list := restarted.List(); len(list.Domains) != 1 || list.Domains[0] != "example.com" || len(list.Jobs) != 1 {
+		t.Errorf("List() after restart = %+v", list)
+	}
+	if err := restarted.ResumeDomain("example.com"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond) // Let the first list look at the file again
+	if pauses.DomainPaused("example.com") || !pauses.JobPaused("job-1") {
+		t.Errorf("pauses after resuming elsewhere = %+v", pauses.List())
+	}
+}
+
+func TestPauseListSeesWritesWithinOneTick(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "paused.json")
+	pauses := crab.NewPauseList(file)
+	if err := pauses.PauseJob("job-1"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process resumes the job within the same tick of the file's modification time
+	if err := crab.NewPauseList(file).ResumeJob("job-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	if pauses.JobPaused("job-1") {
+		t.Error("JobPaused() after resuming elsewhere within one tick = true")
+	}
+}
+
+func TestPausedDomainWaits(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body>ok</body></html>"))
+	}))
+	defer server.Close()
+	host, _ := url.Parse(server.URL)
+
+	defer func(saved *crab.PauseList) { crab.DefaultPauses = saved }(crab.DefaultPauses)
+	crab.DefaultPauses = crab.NewPauseList(filepath.Join(t.TempDir(), "paused.json"))
+	if err := crab.DefaultPauses.PauseDomain(host.Hostname()); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan crab.FetchedPage, 1)
+	go func() { done <- crab.FetchPage(crab.URLData{URL: server.URL}) }()
+	select {
+	case <-done:
+		t.Fatal("FetchPage() fetched from a paused domain")
+	case <-time.After(300 * time.Millisecond):
+	}
+	if err := crab.DefaultPauses.ResumeDomain(host.Hostname()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case page := <-done:
+		if page.StatusCode != http.StatusOK {
+			t.Errorf("FetchPage() status = %d after resuming", page.StatusCode)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("FetchPage() still waiting after the domain was resumed")
+	}
+}
+
+func TestPausedJobWaits(t *testing.T) {
+	defer func(saved *crab.PauseList) { crab.DefaultPauses = saved }(crab.DefaultPauses)
+	crab.DefaultPauses = crab.NewPauseList(filepath.Join(t.TempDir(), "paused.json"))
+
+	ran := make(chan string, 2)
+	q := crab.NewJobQueue(crab.NewMemoryJobStore())
+	q.Register("test", func(ctx context.Context, job crab.Job) error {
+		ran <- job.Params["name"]
+		return nil
+	})
+	paused, _ := q.Enqueue("test", map[string]string{"name": "paused"})
+	if err := q.Pause(paused.ID); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	q.Enqueue("test", map[string]string{"name": "other"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.Start(ctx, 1)
+
+	if name := <-ran; name != "other" {
+		t.Fatalf("ran %s first, want the unpaused job", name)
+	}
+	select {
+	case <-ran:
+		t.Fatal("the paused job ran")
+	case <-time.After(1500 * time.Millisecond):
+	}
+	if err := q.Resume(paused.ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the resumed job did not run")
+	}
+	if err := q.Pause(paused.ID); err == nil {
+		t.Error("Pause() of a finished job succeeded")
+	}
+}
+
+func TestResumedJobRunsAfterRestart(t *testing.T) {
+	defer func(saved *crab.PauseList) { crab.DefaultPauses = saved }(crab.DefaultPauses)
+	crab.DefaultPauses = crab.NewPauseList(filepath.Join(t.TempDir(), "paused.json"))
+
+	// The job is paused before the process stops, and resumed once it has restarted
+	store := crab.NewMemoryJobStore()
+	stopped := crab.NewJobQueue(store)
+	stopped.Register("test", func(ctx context.Context, job crab.Job) error { return nil })
+	paused, _ := stopped.Enqueue("test", nil)
+	if err := stopped.Pause(paused.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	ran := make(chan struct{}, 2)
+	q := crab.NewJobQueue(store)
+	q.Register("test", func(ctx context.Context, job crab.Job) error {
+		ran <- struct{}{}
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.Start(ctx, 1)
+	time.Sleep(100 * time.Millisecond) // The worker finds the job paused and schedules a recheck
+	if err := q.Resume(paused.ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ran: // Put back in line by Resume, before the recheck
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("the resumed job did not run")
+	}
+}
+
+func TestStoppedQueueLeavesPausedJobsQueued(t *testing.T) {
+	defer func(saved *crab.PauseList) { crab.DefaultPauses = saved }(crab.DefaultPauses)
+	crab.DefaultPauses = crab.NewPauseList(filepath.Join(t.TempDir(), "paused.json"))
+
+	store := crab.NewMemoryJobStore()
+	q := crab.NewJobQueue(store)
+	q.Register("test", func(ctx context.Context, job crab.Job) error { return nil })
+	paused, _ := q.Enqueue("test", nil)
+	if err := q.Pause(paused.ID); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	q.Start(ctx, 1)
+	time.Sleep(100 * time.Millisecond) // The worker finds the job paused and schedules a recheck
+	cancel()
+	q.Wait()
+	time.Sleep(1500 * time.Millisecond) // Past the recheck
+
+	// Every slot of the stopped queue is still free for new jobs
+	queued := 0
+	for ; queued < 2000; queued++ {
+		if _, err := q.Enqueue("test", nil); err != nil {
+			break
+		}
+	}
+	if queued != 1000 {
+		t.Errorf("queued %d jobs after stopping, want 1000: the paused job was put back in line", queued)
+	}
+	if job, err := store.GetJob(paused.ID); err != nil || job.State != crab.JobQueued {
+		t.Errorf("paused job = %+v, %v, want it still queued in the store", job, err)
+	}
+}
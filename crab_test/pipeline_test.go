@@ -0,0 +1,122 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFetchThenParsePage(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 3, Links: testsite.Tree(3, 2)})
+	defer site.Close()
+
+	page := crab.FetchPage(crab.URLData{URL: site.PageURL(0)})
+	if page.StatusCode != 200 || len(page.Body) == 0 || len(page.Links) != 0 {
+		t.Fatalf("FetchPage() = status %d, %d bytes, links %v", page.StatusCode, len(page.Body), page.Links)
+	}
+	result := crab.ParsePage(page)
+	if len(result.Links) != 2 || result.Links[0] != site.PageURL(1) || result.Links[1] != site.PageURL(2) ||
+		result.URL != site.PageURL(0) || result.StatusCode != 200 || result.Error != "" {
+		t.Errorf("ParsePage() = %+v", result)
+	}
+
+	failed := crab.FetchPage(crab.URLData{URL: site.URL + "/missing"})
+	if failed.Body != nil || failed.Error == "" {
+		t.Errorf("a failed fetch gave %d bytes, error %q", len(failed.Body), failed.Error)
+	}
+	if result := crab.ParsePage(failed); len(result.Links) != 0 || result.StatusCode != 404 || result.Error == "" {
+		t.Errorf("ParsePage() of a failed fetch = %+v", result)
+	}
+}
+
+func TestCrawlReportsEveryURLOnce(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 2})
+	defer site.Close()
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+
+	urls := []crab.URLData{{URL: site.PageURL(0)}, {URL: site.URL + "/missing"}, {URL: site.PageURL(0)}, {URL: "http://[::1"}}
+	summary := crab.Crawl(context.Background(), urls, 2)
+	if summary.Pages != 3 || summary.Errors != 2 || summary.Items != 1 {
+		t.Errorf("Crawl() summary = %d pages, %d errors, %d links, want 3 pages, 2 errors, 1 link",
+			summary.Pages, summary.Errors, summary.Items)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, summary.RunID, "siteMap.json"))
+	var siteMap map[string][]string
+	if err != nil || json.Unmarshal(data, &siteMap) != nil || len(siteMap) != 3 {
+		t.Errorf("sitemap = %s, %v, want each URL once", data, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	summary = crab.Crawl(ctx, urls, 2)
+	if summary.Pages != 0 || summary.Errors != 3 || summary.Event != crab.EventFailed {
+		t.Errorf("Crawl() of a stopped crawl = %+v, want the 3 URLs reported as errors", summary)
+	}
+
+	ch := make(chan crab.CrawlResult, 2)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	crab.CrawlURL(crab.URLData{URL: site.URL + "/missing"}, ch, &wg)
+	wg.Wait()
+	close(ch)
+	var results []crab.CrawlResult
+	for result := range ch {
+		results = append(results, result)
+	}
+	if len(results) != 1 || results[0].StatusCode != 404 || results[0].Error == "" {
+		t.Errorf("CrawlURL() sent %+v, want one failed result", results)
+	}
+}
+
+func TestPipelineCrawlsEverySeed(t *testing.T) {
+	const pages = 8
+	slow := map[string]time.Duration{}
+	for i := 0; i < pages; i++ {
+		slow[fmt.Sprintf("/page/%d", i)] = 100 * time.Millisecond
+	}
+	site := testsite.New(testsite.Config{Pages: pages, Slow: slow})
+	defer site.Close()
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{
+		Output:   crab.OutputConfig{Dir: dir},
+		Pipeline: crab.PipelineConfig{FetchWorkers: 4, ParseWorkers: 1, Queue: 2},
+	})
+	defer crab.SetConfig(crab.Config{})
+
+	urls := make([]crab.URLData, pages)
+	for i := range urls {
+		urls[i] = crab.URLData{URL: site.PageURL(i)}
+	}
+	start := time.Now()
+	crab.ThreadedCrawl(urls, 1) // The pipeline's fetch workers take precedence
+	elapsed := time.Since(start)
+
+	runs, err := crab.ListRuns(dir)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("ListRuns() = %v, %v", runs, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, runs[0], "siteMap.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var siteMap map[string][]string
+	if err := json.Unmarshal(data, &siteMap); err != nil {
+		t.Fatalf("decoding sitemap: %v\n%s", err, data)
+	}
+	if len(siteMap) != pages {
+		t.Errorf("sitemap has %d pages, want %d", len(siteMap), pages)
+	}
+	// Four fetchers share eight slow pages: two rounds, not eight.
+	if elapsed > pages*100*time.Millisecond {
+		t.Errorf("crawl took %v, the pages were not fetched concurrently", elapsed)
+	}
+}
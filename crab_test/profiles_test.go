@@ -0,0 +1,178 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithProfile(t *testing.T) {
+	config := crab.Config{
+		Output:      crab.OutputConfig{Dir: "shared"},
+		Fingerprint: crab.FingerprintConfig{RandomizeHeaders: true},
+		Profiles: map[string]crab.Profile{
+			"polite-external": {
+				RateLimit:   &crab.RateLimitConfig{DelayMS: 2000},
+				Fingerprint: &crab.FingerprintConfig{HonestMode: true, Contact: "crawl@example.com"},
+			},
+			"aggressive-internal": {Output: &crab.OutputConfig{Dir: "internal"}},
+		},
+	}
+	polite, err := config.WithProfile("polite-external")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if polite.RateLimit.DelayMS != 2000 || !polite.Fingerprint.HonestMode || polite.Output.Dir != "shared" {
+		t.Errorf("WithProfile(polite-external) = %+v", polite)
+	}
+	if internal, _ := config.WithProfile("aggressive-internal"); internal.Output.Dir != "internal" || !internal.Fingerprint.RandomizeHeaders {
+		t.Errorf("WithProfile(aggressive-internal) = %+v", internal)
+	}
+	if _, err := config.WithProfile("missing"); err == nil {
+		t.Error("WithProfile(missing) succeeded")
+	}
+}
+
+func TestJobsRunUnderTheirProfile(t *testing.T) {
+	crab.SetConfig(crab.Config{
+		Output: crab.OutputConfig{Dir: "base"},
+		Profiles: map[string]crab.Profile{
+			"a": {Output: &crab.OutputConfig{Dir: "a"}},
+			"b": {Output: &crab.OutputConfig{Dir: "b"}},
+		},
+	})
+	defer crab.SetConfig(crab.Config{})
+
+	var mu sync.Mutex
+	seen := map[string]string{}
+	// The first jobs of a and b only finish once both are running, so a profile never waits for another
+	started := make(chan struct{}, 2)
+	q := crab.NewJobQueue(crab.NewMemoryJobStore())
+	q.Register("test", func(ctx context.Context, job crab.Job) error {
+		if job.Params["name"] == "a1" || job.Params["name"] == "b1" {
+			started <- struct{}{}
+			for len(started) < 2 {
+				time.Sleep(time.Millisecond)
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		seen[job.Params["name"]] = crab.JobConfig(job).Output.Dir
+		if dir := crab.CurrentConfig().Output.Dir; dir != "base" {
+			t.Errorf("job %s changed the process config to output dir %q", job.Params["name"], dir)
+		}
+		return nil
+	})
+	if _, err := q.Enqueue("test", map[string]string{"profile": "missing"}); err == nil {
+		t.Error("Enqueue() with an unknown profile succeeded")
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	q.Start(ctx, 4)
+	var jobs []crab.Job
+	for _, params := range []map[string]string{
+		{"name": "a1", "profile": "a"}, {"name": "b1", "profile": "b"},
+		{"name": "a2", "profile": "a"}, {"name": "none"}, {"name": "b2", "profile": "b"},
+	} {
+		job, err := q.Enqueue("test", params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, job)
+	}
+	for _, job := range jobs {
+		waitForState(t, q, job.ID, crab.JobSucceeded)
+	}
+
+	want := map[string]string{"a1": "a", "a2": "a", "b1": "b", "b2": "b", "none": "base"}
+	mu.Lock()
+	defer mu.Unlock()
+	for name, dir := range want {
+		if seen[name] != dir {
+			t.Errorf("job %s ran with output dir %q, want %q", name, seen[name], dir)
+		}
+	}
+}
+
+func TestCrawlJobsRunUnderTheirProfile(t *testing.T) {
+	var mu sync.Mutex
+	agents := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents[r.URL.Path] = r.UserAgent()
+		mu.Unlock()
+	}))
+	defer server.Close()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}, Profiles: map[string]crab.Profile{
+		"polite": {Fingerprint: &crab.FingerprintConfig{HonestMode: true, Contact: "crawl@example.com"}},
+	}})
+	defer crab.SetConfig(crab.Config{})
+
+	q := crab.NewJobQueue(crab.NewMemoryJobStore())
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	q.Start(ctx, 2)
+	polite, err := q.Enqueue("crawl", map[string]string{"urls": server.URL + "/polite", "profile": "polite"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := q.Enqueue("crawl", map[string]string{"urls": server.URL + "/plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, q, polite.ID, crab.JobSucceeded)
+	waitForState(t, q, plain.ID, crab.JobSucceeded)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !strings.Contains(agents["/polite"], "crawl@example.com") {
+		t.Errorf("crawl with the polite profile sent user agent %q, want the honest identity", agents["/polite"])
+	}
+	if strings.Contains(agents["/plain"], "crawl@example.com") {
+		t.Errorf("crawl without a profile sent the polite profile's user agent %q", agents["/plain"])
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+	}))
+	defer server.Close()
+	crab.SetConfig(crab.Config{RateLimit: crab.RateLimitConfig{DelayMS: 50}})
+	defer crab.SetConfig(crab.Config{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			crab.FetchPage(crab.URLData{URL: server.URL})
+		}()
+	}
+	wg.Wait()
+	if len(times) != 3 {
+		t.Fatalf("server received %d requests, want 3", len(times))
+	}
+	first, last := times[0], times[0]
+	for _, at := range times {
+		if at.Before(first) {
+			first = at
+		}
+		if at.After(last) {
+			last = at
+		}
+	}
+	if gap := last.Sub(first); gap < 90*time.Millisecond {
+		t.Errorf("three requests took %v, want them 50ms apart", gap)
+	}
+}
@@ -0,0 +1,82 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"path/filepath"
+	"testing"
+)
+
+// qualityStore records the results saved by a scrape.
+type qualityStore struct {
+	results []crab.ExpectationResult
+}
+
+func (s *qualityStore) SaveQualityResults(results []crab.ExpectationResult) error {
+	s.results = append(s.results, results...)
+	return nil
+}
+
+func TestCheckExpectations(t *testing.T) {
+	min, max := 1935.0, 2035.0
+	ds := crab.Dataset{Name: "gasoline", Columns: []string{"year", "price", "grade"},
+		Rows: [][]string{{"2022", "$3.95", "A"}, {"2021", "0", "B"}, {"2021", ""}, {"1900", "$1.10", "Z"}}}
+	results := crab.CheckExpectations(ds, []crab.Expectation{
+		{Column: "year", Kind: crab.ExpectBetween, Min: &min, Max: &max},
+		{Column: "price", Kind: crab.ExpectPositive, Severity: crab.SeverityWarn},
+		{Column: "year", Kind: crab.ExpectUnique},
+		{Column: "price", Kind: crab.ExpectNotNull},
+		{Column: "grade", Kind: crab.ExpectInSet, Values: []string{"A", "B"}},
+		{Column: "grade", Kind: crab.ExpectMatches, Pattern: "^[A-Z]$"},
+		{Column: "missing", Kind: crab.ExpectNotNull},
+	})
+	want := []struct {
+		expectation string
+		success     bool
+		checked     int
+		failed      int
+	}{
+		{"year between 1935 and 2035", false, 4, 1},
+		{"price positive", false, 3, 1},
+		{"year unique", false, 4, 1},
+		{"price not null", false, 4, 1},
+		{"grade in [A B]", false, 3, 1},
+		{`grade matches "^[A-Z]$"`, true, 3, 0},
+		{"missing not null", false, 0, 0},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("CheckExpectations() returned %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		got := results[i]
+		if got.Expectation != w.expectation || got.Success != w.success || got.Checked != w.checked || got.Failed != w.failed {
+			t.Errorf("result %d = %+v, want %+v", i, got, w)
+		}
+	}
+	if results[0].Unexpected[0] != "1900" || results[0].Severity != crab.SeverityFail || results[1].Severity != crab.SeverityWarn {
+		t.Errorf("year result = %+v, price result = %+v", results[0], results[1])
+	}
+}
+
+func TestScrapeQuality(t *testing.T) {
+	store := &qualityStore{}
+	crab.SetQualityStore(store)
+	defer crab.SetQualityStore(nil)
+	defer crab.UseFixtures(filepath.Join(fixturesDir, "gasoline"), false)()
+
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}, Quality: map[string][]crab.Expectation{
+		"gasoline": {{Column: "year", Kind: crab.ExpectUnique}, {Column: "year", Kind: crab.ExpectMatches, Pattern: "^19", Severity: crab.SeverityWarn}},
+	}})
+	defer crab.SetConfig(crab.Config{})
+	crab.ScrapeGasInflationData()
+	results, err := crab.LoadQualityResults(dir, "gasoline", "")
+	if err != nil || len(results) != 2 || !results[0].Success || results[1].Success || results[1].RunID == "" {
+		t.Fatalf("LoadQualityResults() = %+v, %v", results, err)
+	}
+	if len(store.results) != 2 {
+		t.Errorf("quality store got %d results, want 2", len(store.results))
+	}
+	if _, err := crab.LoadDatasetAsOf(dir, "gasoline", ""); err != nil {
+		t.Errorf("LoadDatasetAsOf() error = %v, want the dataset written despite the warning", err)
+	}
+}
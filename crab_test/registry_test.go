@@ -0,0 +1,62 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScraperRegistry(t *testing.T) {
+	crab.SetConfig(crab.Config{JSONTargets: []crab.JSONTarget{{Name: "products", URL: "https://api.example.com/products",
+		Fields: []crab.JSONField{{Name: "name", Path: "$.name"}}}}})
+	defer crab.SetConfig(crab.Config{})
+
+	byName := map[string]crab.ScraperInfo{}
+	for _, info := range crab.Scrapers() {
+		byName[info.Name] = info
+	}
+	inflation, ok := byName["inflation"]
+	if !ok || !inflation.Enabled || inflation.Kind != "table" || inflation.SourceURL == "" || inflation.Schedule == "" {
+		t.Errorf("inflation = %+v", inflation)
+	}
+	if len(inflation.Schema) == 0 || inflation.Schema[0].Name != "year" || inflation.Schema[0].Type != "string" {
+		t.Errorf("inflation schema = %+v", inflation.Schema)
+	}
+	if books := byName["books"]; books.Kind != "listing" || !books.Enabled {
+		t.Errorf("books = %+v", books)
+	}
+	if byName["job-market"].Enabled || byName["housing"].Enabled {
+		t.Error("a scraper with nothing to scrape is enabled by default")
+	}
+	if products := byName["products"]; products.Kind != "json" || len(products.Schema) != 1 {
+		t.Errorf("products = %+v", products)
+	}
+
+	// A scrapers list in the config enables just the scrapers it names
+	crab.SetConfig(crab.Config{Scrapers: []string{"gasoline", "job-market"}})
+	if info, _ := crab.LookupScraper("job-market"); !info.Enabled {
+		t.Error("job-market is disabled though the config lists it")
+	}
+	if info, _ := crab.LookupScraper("inflation"); info.Enabled {
+		t.Error("inflation is enabled though the config does not list it")
+	}
+	if err := crab.RunScraper("inflation"); err == nil || !strings.Contains(err.Error(), "not enabled") {
+		t.Errorf("RunScraper() of a disabled scraper = %v", err)
+	}
+	if err := crab.RunScraper("weather"); err == nil {
+		t.Error("RunScraper() of an unknown scraper succeeded")
+	}
+
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Scrapers: []string{"gasoline"}, Output: crab.OutputConfig{Dir: dir}})
+	defer crab.UseFixtures(filepath.Join(fixturesDir, "gasoline"), false)()
+	if err := crab.RunScraper("gasoline"); err != nil {
+		t.Fatalf("RunScraper() failed: %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "2*", "gasoline_data.json")); len(files) != 1 {
+		entries, _ := os.ReadDir(dir)
+		t.Errorf("RunScraper() wrote %v, entries %v", files, entries)
+	}
+}
@@ -0,0 +1,121 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRender is a render command printing the page it is given as an infinite scroll would leave it:
+// one item link for every scroll it was allowed. Pages under /broken fail.
+var fakeRender = []string{"sh", "-c", `case "$1" in */broken*) echo "browser crashed" >&2; exit 1;; esac
+	printf '<html><body data-idle="%s">' "$CRAB_RENDER_SCROLL_IDLE_MS"
+	i=0
+	while [ $i -lt "$CRAB_RENDER_MAX_SCROLLS" ]; do i=$((i+1)); printf '<a class="item" href="/item/%d">Item</a>' $i; done
+	printf '</body></html>'`, "render"}
+
+// listingServer serves a listing whose HTML, before it is scrolled, holds a single item.
+func listingServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><a class="item" href="/item/1">Item</a></body></html>`)
+	}))
+}
+
+func TestRenderPage(t *testing.T) {
+	html, err := crab.RenderPage(context.Background(), crab.RenderConfig{Command: fakeRender, MaxScrolls: 3, ScrollIdle: "500ms"},
+		"https://example.com/search")
+	if err != nil {
+		t.Fatalf("RenderPage() error = %v", err)
+	}
+	if got := strings.Count(string(html), `class="item"`); got != 3 || !strings.Contains(string(html), `data-idle="500"`) {
+		t.Errorf("RenderPage() = %s, want 3 items scrolled in with a 500ms idle time", html)
+	}
+	if html, _ := crab.RenderPage(context.Background(), crab.RenderConfig{Command: fakeRender}, "https://example.com/"); strings.Count(string(html), `class="item"`) != 10 {
+		t.Errorf("RenderPage() with the default scrolls = %s", html)
+	}
+	if _, err := crab.RenderPage(context.Background(), crab.RenderConfig{Command: fakeRender}, "https://example.com/broken"); err == nil ||
+		!strings.Contains(err.Error(), "browser crashed") {
+		t.Errorf("RenderPage() of a failing page error = %v, want the command's error", err)
+	}
+	if _, err := crab.RenderPage(context.Background(), crab.RenderConfig{Command: []string{"true"}}, "https://example.com/"); err == nil {
+		t.Errorf("RenderPage() of a command printing nothing succeeded")
+	}
+	if _, err := crab.RenderPage(context.Background(), crab.RenderConfig{}, "https://example.com/"); err == nil {
+		t.Errorf("RenderPage() without a command succeeded")
+	}
+}
+
+func TestCrawlRendersPages(t *testing.T) {
+	server := listingServer()
+	defer server.Close()
+	render := crab.RenderConfig{Enabled: true, Command: fakeRender, MaxScrolls: 4}
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}, Render: render})
+	defer crab.SetConfig(crab.Config{})
+
+	if summary := crab.Crawl(context.Background(), []crab.URLData{{URL: server.URL + "/search"}}, 1); summary.Items != 4 {
+		t.Errorf("Crawl() found %d links, want the 4 of the scrolled page", summary.Items)
+	}
+
+	// Only the pages of the configured domains are rendered, and a failed rendering keeps the fetched page
+	render.Domains = []string{"www.kaggle.com"}
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}, Render: render})
+	if summary := crab.Crawl(context.Background(), []crab.URLData{{URL: server.URL + "/search"}}, 1); summary.Items != 1 {
+		t.Errorf("Crawl() of a domain not rendered found %d links, want 1", summary.Items)
+	}
+	render.Domains = nil
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}, Render: render})
+	if summary := crab.Crawl(context.Background(), []crab.URLData{{URL: server.URL + "/broken"}}, 1); summary.Items != 1 || summary.Errors != 0 {
+		t.Errorf("Crawl() of a page failing to render = %d links, %d errors, want the fetched page", summary.Items, summary.Errors)
+	}
+}
+
+func TestCrawlRendersAsTheCrawl(t *testing.T) {
+	server := listingServer()
+	defer server.Close()
+	agentFile := filepath.Join(t.TempDir(), "agent")
+	t.Setenv("RENDER_AGENT_FILE", agentFile)
+	// Records the user agent it was asked to render as, and hangs on pages under /slow
+	render := crab.RenderConfig{Enabled: true, Command: []string{"sh", "-c", `printf %s "$CRAB_RENDER_USER_AGENT" > "$RENDER_AGENT_FILE"
+		case "$1" in */slow*) sleep 30;; esac
+		printf '<html><body><a class="item" href="/item/1">Item</a></body></html>'`, "render"}}
+	settings := crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}, Render: render,
+		Fingerprint: crab.FingerprintConfig{HonestMode: true, Contact: "ops@example.com"}}
+
+	crab.CrawlWithConfig(context.Background(), func() crab.Config { return settings }, []crab.URLData{{URL: server.URL + "/search"}}, 1)
+	if agent, err := os.ReadFile(agentFile); err != nil || string(agent) != settings.Fingerprint.IdentityUserAgent() {
+		t.Errorf("page rendered as %q, %v, want the crawl's identity %q", agent, err, settings.Fingerprint.IdentityUserAgent())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	crab.CrawlWithConfig(ctx, func() crab.Config { return settings }, []crab.URLData{{URL: server.URL + "/slow"}}, 1)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("cancelled crawl returned after %s, want the rendering stopped with it", elapsed)
+	}
+}
+
+func TestWalkPagesRendersPages(t *testing.T) {
+	server := listingServer()
+	defer server.Close()
+	crab.SetConfig(crab.Config{Render: crab.RenderConfig{Enabled: true, Command: fakeRender, MaxScrolls: 5}})
+	defer crab.SetConfig(crab.Config{})
+
+	items := 0
+	err := crab.WalkPages(http.DefaultClient, server.URL+"/search", crab.PaginationConfig{}, "a.item", func(doc *goquery.Document) error {
+		items += doc.Find("a.item").Length()
+		return nil
+	})
+	if err != nil || items != 5 {
+		t.Errorf("WalkPages() = %d items, %v, want the 5 of the scrolled page", items, err)
+	}
+}
@@ -0,0 +1,92 @@
+package crab_test
+
+import (
+	"bytes"
+	"cmpscfa23team2/crab"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunReports(t *testing.T) {
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}, Reports: []crab.ReportTemplate{
+		{Name: "summary", Template: "# Run {{.RunID}} ({{.Kind}})\n{{range .Datasets}}{{.Dataset}}: {{.Rows}} rows\n{{end}}" +
+			"{{range .Diffs}}{{.Dataset}}: +{{.Added}} -{{.Removed}} since {{or .PreviousRun \"nothing\"}}\n{{end}}"},
+		{Name: "pages", Format: crab.ReportHTML, Kinds: []string{"crawl"}, Template: "<p>{{.RunID}}</p>"},
+		{Name: "broken", Template: "{{.Missing"},
+	}})
+	defer crab.SetConfig(crab.Config{})
+	defer crab.UseFixtures(filepath.Join(fixturesDir, "inflation"), false)()
+	crab.ScrapeInflationData()
+	crab.ScrapeInflationData()
+
+	runs, err := crab.ListRuns(dir)
+	if err != nil || len(runs) != 2 {
+		t.Fatalf("ListRuns() = %v, %v, want two runs", runs, err)
+	}
+	for i, runID := range runs {
+		runDir := filepath.Join(dir, runID)
+		data, err := os.ReadFile(filepath.Join(runDir, "report-summary.md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		report := string(data)
+		previous := "nothing"
+		if i > 0 {
+			previous = runs[0]
+		}
+		if !strings.HasPrefix(report, "# Run "+runID+" (scrape)\ninflation: ") || !strings.Contains(report, "-0 since "+previous+"\n") {
+			t.Errorf("report of run %d =\n%s", i, report)
+		}
+		if i == 0 && strings.Contains(report, "inflation: +0 ") {
+			t.Errorf("first run reports no added rows:\n%s", report)
+		}
+		if i == 1 && !strings.Contains(report, "inflation: +0 -0") {
+			t.Errorf("unchanged run reports changes:\n%s", report)
+		}
+		if problems, err := crab.VerifyRunManifest(runDir); err != nil || len(problems) > 0 {
+			t.Errorf("VerifyRunManifest() = %v, %v", problems, err)
+		}
+		manifest, _ := os.ReadFile(filepath.Join(runDir, "manifest.json"))
+		if !strings.Contains(string(manifest), `"report-summary.md"`) {
+			t.Errorf("manifest does not list the report: %s", manifest)
+		}
+		for _, file := range []string{"report-pages.html", "report-broken.md"} {
+			if _, err := os.Stat(filepath.Join(runDir, file)); err == nil {
+				t.Errorf("run %d wrote %s", i, file)
+			}
+		}
+	}
+
+	report, err := crab.BuildRunReport(dir, runs[1], nil, nil)
+	if err != nil || report.Kind != "scrape" || len(report.Datasets) != 1 || len(report.Diffs) != 1 || report.Diffs[0].PreviousRun != runs[0] {
+		t.Errorf("BuildRunReport() = %+v, %v", report, err)
+	}
+}
+
+func TestRenderReport(t *testing.T) {
+	report := crab.RunReport{RunID: "<run>", Outputs: []string{"a.json", "b.json"}}
+	var b bytes.Buffer
+	if err := (crab.ReportTemplate{Format: crab.ReportHTML, Template: "<h1>{{.RunID}}</h1>"}).Render(&b, report); err != nil || b.String() != "<h1>&lt;run&gt;</h1>" {
+		t.Errorf("html Render() = %q, %v", b.String(), err)
+	}
+	b.Reset()
+	if err := (crab.ReportTemplate{Template: "{{.RunID}}: {{join .Outputs \", \"}}"}).Render(&b, report); err != nil || b.String() != "<run>: a.json, b.json" {
+		t.Errorf("markdown Render() = %q, %v", b.String(), err)
+	}
+
+	file := filepath.Join(t.TempDir(), "runs.html")
+	os.WriteFile(file, []byte("<b>{{.RunID}}</b>"), 0644)
+	b.Reset()
+	if err := (crab.ReportTemplate{File: file}).Render(&b, report); err != nil || b.String() != "<b>&lt;run&gt;</b>" {
+		t.Errorf("Render() of an .html file = %q, %v", b.String(), err)
+	}
+	if err := (crab.ReportTemplate{Template: "{{.RunID"}).Render(&b, report); err == nil {
+		t.Error("Render() of an invalid template succeeded")
+	}
+	if err := (crab.ReportTemplate{Format: "pdf", Template: "x"}).Render(&b, report); err == nil {
+		t.Error("Render() in an unknown format succeeded")
+	}
+}
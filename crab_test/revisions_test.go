@@ -0,0 +1,100 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDetectRevisions(t *testing.T) {
+	columns := []string{"year", "average_gasoline_prices"}
+	previous := crab.Dataset{Name: "gasoline", RunID: "run-1", Columns: columns, Rows: [][]string{{"1978", "0.63"}, {"1979", "0.88"}, {"1980", "1.22"}}}
+	current := crab.Dataset{Name: "gasoline", Columns: columns, Rows: [][]string{{"1979", "0.86"}, {"1980", "1.22 "}, {"1981", "1.35"}}}
+
+	revisions, err := crab.DetectRevisions(previous, current, []string{"year"})
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("DetectRevisions() = %+v, %v, want one revision", revisions, err)
+	}
+	want := crab.Revision{
+		Key:          map[string]string{"year": "1979"},
+		PreviousRun:  "run-1",
+		PreviousHash: crab.RowHash(columns, []string{"1979", "0.88"}),
+		Hash:         crab.RowHash(columns, []string{"1979", "0.86"}),
+		Changes:      []crab.ColumnChange{{Column: "average_gasoline_prices", Previous: "0.88", Current: "0.86"}},
+		Previous:     map[string]string{"year": "1979", "average_gasoline_prices": "0.88"},
+		Current:      map[string]string{"year": "1979", "average_gasoline_prices": "0.86"},
+	}
+	if !reflect.DeepEqual(revisions[0], want) {
+		t.Errorf("DetectRevisions() = %+v, want %+v", revisions[0], want)
+	}
+	if want.PreviousHash == want.Hash {
+		t.Error("RowHash() of a revised row did not change")
+	}
+	if _, err := crab.DetectRevisions(previous, current, []string{"month"}); err == nil {
+		t.Error("DetectRevisions() with an unknown key column succeeded")
+	}
+}
+
+func TestScrapeRecordsRevisions(t *testing.T) {
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+	scrape := func() {
+		defer crab.UseFixtures(filepath.Join(fixturesDir, "inflation"), false)()
+		crab.ScrapeInflationData()
+		time.Sleep(5 * time.Millisecond) // Keep the run IDs in order
+	}
+	scrape()
+	runs, err := crab.ListRuns(dir)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("ListRuns() = %v, %v, want 1 run", runs, err)
+	}
+	if report, err := crab.LoadRevisions(dir, "inflation", ""); err != nil || len(report.Revisions) != 0 {
+		t.Errorf("LoadRevisions() of the first run = %+v, %v, want none", report, err)
+	}
+	lineage, err := crab.DatasetLineage(dir, "inflation", "")
+	if err != nil || len(lineage) == 0 || lineage[0].Hash == "" {
+		t.Fatalf("DatasetLineage() = %v, want rows with their hashes", err)
+	}
+
+	// Pretend the first run saw another March figure, which the source has since revised
+	first := filepath.Join(dir, runs[0], "inflation_data.json")
+	var data []crab.YearData
+	raw, err := os.ReadFile(first)
+	if err == nil {
+		err = json.Unmarshal(raw, &data)
+	}
+	if err != nil || len(data) == 0 {
+		t.Fatalf("reading %s: %v", first, err)
+	}
+	year, mar := data[0].Year, data[0].Mar
+	data[0].Mar = "9.9"
+	if _, err := crab.WriteRecords(first, data); err != nil {
+		t.Fatal(err)
+	}
+
+	scrape()
+	runs, _ = crab.ListRuns(dir)
+	report, err := crab.LoadRevisions(dir, "inflation", "")
+	if err != nil || report.RunID != runs[1] || report.PreviousRun != runs[0] || len(report.Revisions) != 1 {
+		t.Fatalf("LoadRevisions() = %+v, %v, want one revision by run %s", report, err, runs[1])
+	}
+	revision := report.Revisions[0]
+	want := []crab.ColumnChange{{Column: "mar", Previous: "9.9", Current: mar}}
+	if revision.Key["year"] != year || revision.RunID != runs[1] || !reflect.DeepEqual(revision.Changes, want) {
+		t.Errorf("revision = %+v, want %s March %v", revision, year, want)
+	}
+	if lineage, err := crab.DatasetLineage(dir, "inflation", ""); err != nil || lineage[0].Hash != revision.Hash {
+		t.Errorf("lineage hash of the revised row = %v, want %s", err, revision.Hash)
+	}
+
+	scrape()
+	history, err := crab.RevisionHistory(dir, "inflation")
+	if err != nil || len(history) != 1 || history[0].RunID != runs[1] {
+		t.Errorf("RevisionHistory() = %+v, %v, want the revision of run %s alone", history, err, runs[1])
+	}
+}
@@ -0,0 +1,154 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const robotsFile = `# Example robots.txt
+User-agent: *
+Disallow: /private
+Allow: /private/open
+Disallow: /*.pdf$
+
+User-agent: GoEngine
+User-agent: OtherBot
+Crawl-delay: 2
+Disallow: /search
+
+Sitemap: https://example.com/sitemap.xml
+`
+
+func TestCheckRobots(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(robotsFile))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path, agent string
+		allowed     bool
+		group, rule string
+	}{
+		{"/search?q=go", "", false, "goengine", "Disallow: /search"},
+		{"/private/page", "", true, "goengine", ""},
+		{"/private/page", "AcmeBot", false, "*", "Disallow: /private"},
+		{"/private/open/page", "AcmeBot", true, "*", "Allow: /private/open"},
+		{"/docs/report.pdf", "AcmeBot", false, "*", "Disallow: /*.pdf$"},
+		{"/docs/report.pdf?x=1", "AcmeBot", true, "*", ""},
+	}
+	for _, tt := range tests {
+		check, err := crab.CheckRobots(server.URL+tt.path, tt.agent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if check.Allowed != tt.allowed || check.Group != tt.group || check.Rule != tt.rule {
+			t.Errorf("CheckRobots(%s, %q) = allowed %v, group %q, rule %q, want %v, %q, %q",
+				tt.path, tt.agent, check.Allowed, check.Group, check.Rule, tt.allowed, tt.group, tt.rule)
+		}
+	}
+
+	check, _ := crab.CheckRobots(server.URL+"/", "")
+	if check.CrawlDelay != 2*time.Second || len(check.Sitemaps) != 1 || check.Agent != "GoEngine" {
+		t.Errorf("CheckRobots() = %+v, want a 2s crawl delay and one sitemap", check)
+	}
+
+	status = http.StatusNotFound
+	if check, _ := crab.CheckRobots(server.URL+"/private", "AcmeBot"); !check.Allowed {
+		t.Errorf("CheckRobots() without robots.txt = %+v, want allowed", check)
+	}
+	// Checked last, as the 503 throttles the site like any other of its responses
+	status = http.StatusServiceUnavailable
+	if check, _ := crab.CheckRobots(server.URL+"/", ""); check.Allowed || check.Reason == "" {
+		t.Errorf("CheckRobots() with robots.txt failing = %+v, want disallowed", check)
+	}
+	if _, err := crab.CheckRobots("/no/host", ""); err == nil {
+		t.Error("CheckRobots() of a URL without a host succeeded")
+	}
+}
+
+func TestCheckRobotsFollowsTheSite(t *testing.T) {
+	status, endless := http.StatusOK, false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/robots.txt" && !endless:
+			http.Redirect(w, r, "/moved/robots.txt", http.StatusMovedPermanently)
+		case r.URL.Path == "/moved/robots.txt":
+			w.WriteHeader(status)
+			w.Write([]byte(robotsFile))
+		default:
+			// Every other path redirects to the next one, so there is no end to follow
+			http.Redirect(w, r, r.URL.Path+"x", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	check, err := crab.CheckRobots(server.URL+"/private/page", "AcmeBot")
+	if err != nil || check.Allowed || check.RobotsURL != server.URL+"/robots.txt" || check.FetchedURL != server.URL+"/moved/robots.txt" {
+		t.Errorf("CheckRobots() through a redirect = %+v, %v, want the moved robots.txt to disallow", check, err)
+	}
+	for _, status = range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		if check, _ := crab.CheckRobots(server.URL+"/", ""); check.Allowed {
+			t.Errorf("CheckRobots() with robots.txt answering %d = %+v, want disallowed", status, check)
+		}
+	}
+	status = http.StatusGone
+	if check, _ := crab.CheckRobots(server.URL+"/private", "AcmeBot"); !check.Allowed {
+		t.Errorf("CheckRobots() with robots.txt gone = %+v, want allowed", check)
+	}
+	endless = true
+	if check, err := crab.CheckRobots(server.URL+"/private", "AcmeBot"); err != nil || !check.Allowed {
+		t.Errorf("CheckRobots() with robots.txt redirecting endlessly = %+v, %v, want allowed", check, err)
+	}
+
+	// robots.txt is read from the scheme and port of the URL, and over https without a scheme
+	for rawURL, want := range map[string]string{
+		"https://127.0.0.1:1/page": "https://127.0.0.1:1/robots.txt",
+		"http://127.0.0.1:1/page":  "http://127.0.0.1:1/robots.txt",
+		"//127.0.0.1:1/page":       "https://127.0.0.1:1/robots.txt",
+	} {
+		if check, err := crab.CheckRobots(rawURL, ""); err == nil || check.RobotsURL != want {
+			t.Errorf("CheckRobots(%s) robots.txt = %s, want %s, failing", rawURL, check.RobotsURL, want)
+		}
+	}
+	if _, err := crab.CheckRobots("ftp://example.com/file", ""); err == nil {
+		t.Error("CheckRobots() of an ftp URL succeeded")
+	}
+}
+
+func TestCrawlReadsRobotsOncePerSite(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 10, Links: func(i int) []int { return nil }, Robots: "User-agent: *\nDisallow: /page/3\n"})
+	defer site.Close()
+	settings := crab.Config{
+		Output:        crab.OutputConfig{Dir: t.TempDir()},
+		RespectRobots: true,
+		RateLimit:     crab.RateLimitConfig{DelayMS: 50},
+		Fingerprint:   crab.FingerprintConfig{HonestMode: true, Contact: "ops@example.com"},
+	}
+	var seeds []crab.URLData
+	for i := 0; i < 10; i++ {
+		seeds = append(seeds, crab.URLData{URL: site.PageURL(i)})
+	}
+	summary := crab.CrawlWithConfig(context.Background(), func() crab.Config { return settings }, seeds, 4)
+	if summary.Statuses[crab.StatusRobotsDenied] != 1 {
+		t.Errorf("Crawl() statuses = %v, want /page/3 denied by robots.txt", summary.Statuses)
+	}
+
+	requests := site.Requests()
+	if n := site.Count("/robots.txt"); n != 1 {
+		t.Fatalf("robots.txt was requested %d times, want once for the crawl", n)
+	}
+	if requests[0].Path != "/robots.txt" || requests[0].UserAgent != settings.Fingerprint.IdentityUserAgent() {
+		t.Errorf("first request = %s as %q, want robots.txt as %q", requests[0].Path, requests[0].UserAgent, settings.Fingerprint.IdentityUserAgent())
+	}
+	if gap := requests[1].Time.Sub(requests[0].Time); gap < 40*time.Millisecond {
+		t.Errorf("first page requested %s after robots.txt, want the rate limit's 50ms", gap)
+	}
+}
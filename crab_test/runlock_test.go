@@ -0,0 +1,137 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileRunLocker(t *testing.T) {
+	dir := t.TempDir()
+	locker := crab.FileRunLocker{Dir: dir, StaleAfter: time.Minute}
+	release, err := locker.TryLock("scrape-books")
+	if err != nil {
+		t.Fatalf("TryLock() failed: %v", err)
+	}
+	if _, err := locker.TryLock("scrape-books"); !errors.Is(err, crab.ErrRunLocked) {
+		t.Errorf("TryLock() of a held lock = %v, want ErrRunLocked", err)
+	}
+	otherRelease, err := locker.TryLock("scrape-airfare")
+	if err != nil {
+		t.Errorf("TryLock() of another name failed: %v", err)
+	} else {
+		otherRelease()
+	}
+	if err := release(); err != nil {
+		t.Errorf("release() failed: %v", err)
+	}
+	release, err = locker.TryLock("scrape-books")
+	if err != nil {
+		t.Fatalf("TryLock() after release failed: %v", err)
+	}
+	release()
+
+	// The lock file of a run that died goes stale and is taken over
+	stale := filepath.Join(dir, "crawl-seeds.lock")
+	os.WriteFile(stale, []byte(`{"pid": 1}`), 0644)
+	old := time.Now().Add(-2 * time.Minute)
+	os.Chtimes(stale, old, old)
+	release, err = locker.TryLock("crawl-seeds")
+	if err != nil {
+		t.Fatalf("TryLock() of a stale lock failed: %v", err)
+	}
+	release()
+}
+
+func TestJobQueueSkipsOverlappingRuns(t *testing.T) {
+	crab.SetConfig(crab.Config{RunLock: crab.RunLockConfig{Enabled: true, Dir: t.TempDir()}})
+	defer crab.SetConfig(crab.Config{})
+	queue := crab.NewJobQueue(crab.NewMemoryJobStore())
+	started := make(chan struct{}, 2)
+	finish := make(chan struct{})
+	queue.Register("slow", func(ctx context.Context, job crab.Job) error {
+		started <- struct{}{}
+		<-finish
+		return nil
+	})
+	ctx, stop := context.WithCancel(context.Background())
+	queue.Start(ctx, 3)
+
+	first, _ := queue.Enqueue("slow", map[string]string{"domain": "books"})
+	<-started
+	overlapping, _ := queue.Enqueue("slow", map[string]string{"domain": "books"})
+	other, _ := queue.Enqueue("slow", map[string]string{"domain": "airfare"})
+	<-started
+	if job := waitForState(t, queue, overlapping.ID, crab.JobSkipped); job.Error == "" {
+		t.Error("the skipped job has no error")
+	}
+	close(finish)
+	waitForState(t, queue, first.ID, crab.JobSucceeded)
+	waitForState(t, queue, other.ID, crab.JobSucceeded)
+	stop()
+	queue.Wait()
+
+	// Once the first run is over, the same job runs again
+	finish = make(chan struct{})
+	close(finish)
+	ctx, stop = context.WithCancel(context.Background())
+	defer stop()
+	queue.Start(ctx, 1)
+	again, _ := queue.Enqueue("slow", map[string]string{"domain": "books"})
+	<-started
+	waitForState(t, queue, again.ID, crab.JobSucceeded)
+}
+
+func TestCancelledScrapeHoldsItsRunLock(t *testing.T) {
+	crab.SetConfig(crab.Config{RunLock: crab.RunLockConfig{Enabled: true, Dir: t.TempDir()}})
+	defer crab.SetConfig(crab.Config{})
+	started, finish := make(chan struct{}, 2), make(chan struct{})
+	crab.RegisterScraper(crab.ScraperInfo{Name: "lock-test", Enabled: true}, struct{}{}, func() error {
+		started <- struct{}{}
+		<-finish
+		return nil
+	})
+	queue := crab.NewJobQueue(crab.NewMemoryJobStore())
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	queue.Start(ctx, 2)
+
+	first, _ := queue.Enqueue("scrape", map[string]string{"domain": "lock-test"})
+	<-started
+	if err := queue.Cancel(first.ID); err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, queue, first.ID, crab.JobCancelled)
+
+	// The cancelled scrape is still writing, so the same job is skipped until it returns
+	again, _ := queue.Enqueue("scrape", map[string]string{"domain": "lock-test"})
+	waitForState(t, queue, again.ID, crab.JobSkipped)
+	close(finish)
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(20 * time.Millisecond) {
+		job, _ := queue.Enqueue("scrape", map[string]string{"domain": "lock-test"})
+		if job = waitForFinished(t, queue, job.ID); job.State == crab.JobSucceeded {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the job after the cancelled scrape returned is %s, want it run", job.State)
+		}
+	}
+}
+
+// waitForFinished polls the queue until the job has finished.
+func waitForFinished(t *testing.T, q *crab.JobQueue, id string) crab.Job {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		job, err := q.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Finished() || time.Now().After(deadline) {
+			return job
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package crab_test
+
+import (
+	"bytes"
+	"cmpscfa23team2/crab"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunMetrics(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	summary := crab.RunSummary{RunID: "run", Kind: "crawl", Name: "example.com", StartedAt: start,
+		FinishedAt: start.Add(90 * time.Second), Pages: 12, Errors: 2,
+		Latency:  []crab.DomainLatency{{Domain: "example.com", Requests: 12, Fetch: crab.LatencyPercentiles{P95: 250}}},
+		Datasets: []crab.DatasetStats{{Dataset: "prices", Rows: 40}}}
+	values := map[string]float64{}
+	for _, metric := range crab.RunMetrics(summary) {
+		if metric.RunID != "run" || metric.Kind != "crawl" || !metric.Time.Equal(start) {
+			t.Errorf("metric = %+v, want it tagged with the run", metric)
+		}
+		values[metric.Metric+" "+metric.Label] = metric.Value
+	}
+	for key, want := range map[string]float64{"pages ": 12, "errors ": 2, "duration_seconds ": 90,
+		"fetch_p95_ms example.com": 250, "dataset_rows prices": 40} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestCrawlRunMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<title>Page</title>`)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+
+	// Without a metrics store the runs append their metrics to a file in the output directory
+	for n := 0; n < 2; n++ {
+		crab.Crawl(context.Background(), []crab.URLData{{URL: server.URL + "/a"}}, 1)
+	}
+	pages, err := crab.FileMetricsStore{Path: filepath.Join(dir, "run_metrics.jsonl")}.LoadRunMetrics(crab.MetricQuery{Metric: crab.MetricPages})
+	if err != nil || len(pages) != 2 || pages[0].Value != 1 || !pages[0].Time.Before(pages[1].Time) {
+		t.Fatalf("pages = %+v, %v, want one page in each of two runs", pages, err)
+	}
+
+	recorder := httptest.NewRecorder()
+	crab.RunMetricsHandler(recorder, httptest.NewRequest(http.MethodGet, "/api/metrics/runs?kind=crawl&metric=errors", nil))
+	if recorder.Code != http.StatusOK || bytes.Count(recorder.Body.Bytes(), []byte(`"metric":"errors"`)) != 2 {
+		t.Errorf("errors: status %d, body %s", recorder.Code, recorder.Body)
+	}
+
+	recorder = httptest.NewRecorder()
+	crab.RunMetricsChartHandler(recorder, httptest.NewRequest(http.MethodGet, "/api/metrics/chart?metric=pages", nil))
+	if recorder.Code != http.StatusOK || !bytes.HasPrefix(recorder.Body.Bytes(), []byte("\x89PNG")) {
+		t.Errorf("chart: status %d, content type %q", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	recorder = httptest.NewRecorder()
+	crab.RunMetricsChartHandler(recorder, httptest.NewRequest(http.MethodGet, "/api/metrics/chart", nil))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("chart without a metric: status %d, want 400", recorder.Code)
+	}
+}
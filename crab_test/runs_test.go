@@ -0,0 +1,74 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunLayout(t *testing.T) {
+	if run, err := crab.StartRun("crawl"); run != nil || err != nil {
+		t.Fatalf("StartRun() without an output dir = %v, %v, want nil", run, err)
+	}
+	var legacy *crab.Run
+	if got := legacy.Path("siteMap.json"); got != "siteMap.json" {
+		t.Errorf("nil Run Path() = %q, want siteMap.json", got)
+	}
+
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir, Retain: 2}})
+	defer crab.SetConfig(crab.Config{})
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		run, err := crab.StartRun("scrape")
+		if err != nil {
+			t.Fatalf("StartRun() error = %v", err)
+		}
+		path := run.Path("books_data.json")
+		if path != filepath.Join(dir, run.ID, "books_data.json") {
+			t.Errorf("Path() = %q", path)
+		}
+		os.WriteFile(path, []byte("{}"), 0644)
+		if err := run.Finish([]string{path}); err != nil {
+			t.Fatalf("Finish() error = %v", err)
+		}
+		ids = append(ids, run.ID)
+		time.Sleep(2 * time.Millisecond) // Run IDs have millisecond resolution
+	}
+
+	runs, _ := crab.ListRuns(dir)
+	if len(runs) != 2 || runs[0] != ids[1] || runs[1] != ids[2] {
+		t.Errorf("ListRuns() after retention = %v, want %v", runs, ids[1:])
+	}
+
+	var manifest crab.RunManifest
+	data, err := os.ReadFile(filepath.Join(dir, "latest.json"))
+	if err != nil {
+		t.Fatalf("reading latest.json: %v", err)
+	}
+	json.Unmarshal(data, &manifest)
+	if manifest.RunID != ids[2] || manifest.Kind != "scrape" || len(manifest.Files) != 1 {
+		t.Fatalf("latest.json = %+v", manifest)
+	}
+	// sha256 of "{}"
+	want := crab.ManifestFile{Path: "books_data.json", Size: 2, SHA256: "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"}
+	if manifest.Files[0] != want {
+		t.Errorf("manifest file = %+v, want %+v", manifest.Files[0], want)
+	}
+
+	runDir := filepath.Join(dir, ids[2])
+	if problems, err := crab.VerifyRunManifest(runDir); err != nil || len(problems) != 0 {
+		t.Errorf("VerifyRunManifest() = %v, %v, want no problems", problems, err)
+	}
+	os.WriteFile(filepath.Join(runDir, "books_data.json"), []byte("[]"), 0644)
+	if problems, _ := crab.VerifyRunManifest(runDir); len(problems) != 1 {
+		t.Errorf("VerifyRunManifest() after modifying a file = %v, want one problem", problems)
+	}
+	if target, err := os.Readlink(filepath.Join(dir, "latest")); err == nil && target != ids[2] {
+		t.Errorf("latest symlink points to %q, want %q", target, ids[2])
+	}
+}
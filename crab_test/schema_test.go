@@ -0,0 +1,110 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const productSchema = `{
+	"type": "object",
+	"required": ["results"],
+	"properties": {
+		"results": {
+			"type": "array",
+			"minItems": 1,
+			"items": {
+				"type": "object",
+				"required": ["id", "name", "price"],
+				"additionalProperties": false,
+				"properties": {
+					"id": {"type": "integer", "minimum": 1},
+					"name": {"type": "string", "minLength": 1, "pattern": "^[a-z]+$"},
+					"price": {"type": ["number", "null"], "maximum": 100},
+					"status": {"enum": ["active", "retired"]}
+				}
+			}
+		}
+	}
+}`
+
+func TestValidateJSONSchema(t *testing.T) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(productSchema), &schema); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		doc  string
+		want []string
+	}{
+		{`{"results": [{"id": 1, "name": "apple", "price": 1.5, "status": "active"}, {"id": 2, "name": "pear", "price": null}]}`, nil},
+		{`[]`, []string{"$: expected object, got array"}},
+		{`{"results": []}`, []string{"$.results: has 0 items, want at least 1"}},
+		{`{"items": []}`, []string{`$: missing required property "results"`}},
+		{`{"results": [{"id": "1", "name": "apple", "price": 1}]}`, []string{"$.results[0].id: expected integer, got string"}},
+		{`{"results": [{"id": 0, "name": "Apple", "price": 101, "status": "gone", "sku": "x"}]}`, []string{
+			"$.results[0].id: 0 is less than 1",
+			`$.results[0].name: "Apple" does not match "^[a-z]+$"`,
+			"$.results[0].price: 101 is greater than 100",
+			"$.results[0].sku: unexpected property",
+			"$.results[0].status: gone is not one of [active retired]",
+		}},
+	}
+	for _, tt := range tests {
+		decoder := json.NewDecoder(strings.NewReader(tt.doc))
+		decoder.UseNumber()
+		var doc interface{}
+		if err := decoder.Decode(&doc); err != nil {
+			t.Fatal(err)
+		}
+		got := crab.ValidateJSONSchema(schema, doc)
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("ValidateJSONSchema(%s) = %q, want %q", tt.doc, got, tt.want)
+		}
+	}
+}
+
+func TestJSONTargetSchemaDrift(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The API renamed "name" to "title".
+		fmt.Fprint(w, `{"results": [{"id": 1, "title": "apple", "price": 2}]}`)
+	}))
+	defer api.Close()
+	var events []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var summary crab.RunSummary
+		json.NewDecoder(r.Body).Decode(&summary)
+		events = append(events, summary.Event)
+	}))
+	defer hook.Close()
+
+	var schema map[string]interface{}
+	json.Unmarshal([]byte(productSchema), &schema)
+	target := crab.JSONTarget{Name: "products", URL: api.URL, ItemsPath: "$.results[*]",
+		Fields: []crab.JSONField{{Name: "name", Path: "$.name"}}, Schema: schema}
+
+	_, err := crab.ScrapeJSONTarget(target, api.Client())
+	var schemaErr *crab.SchemaError
+	if !errors.As(err, &schemaErr) || len(schemaErr.Violations) != 2 {
+		t.Fatalf("ScrapeJSONTarget() error = %v, want a SchemaError with two violations", err)
+	}
+
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Webhooks: []crab.WebhookConfig{{URL: hook.URL}}, Output: crab.OutputConfig{Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+	if err := crab.RunJSONTarget(target); !errors.As(err, &schemaErr) {
+		t.Errorf("RunJSONTarget() error = %v, want a SchemaError", err)
+	}
+	if len(events) != 1 || events[0] != crab.EventSchemaDrift {
+		t.Errorf("webhook events = %v, want [%s]", events, crab.EventSchemaDrift)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*", "products_data*")); len(files) != 0 {
+		t.Errorf("RunJSONTarget() wrote %v from a drifted API", files)
+	}
+}
@@ -0,0 +1,102 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInferSchema(t *testing.T) {
+	ds := crab.Dataset{Name: "listings", Columns: []string{"year", "Price (USD)", "rate", "available", "listed_on", "city", "notes", "rate", "zip"},
+		Rows: [][]string{
+			{"2022", "$1,200", "4.1%", "yes", "2022-03-01", "Boston", "", "1", "02134"},
+			{"2023", "$950", "3.5%", "No", "2023-01-15", "New York", "", "2.5", "10001"},
+			{"2024", "", "(0.2%)", "true", "2024-07-30", "10", "", "x", "60601"},
+		}}
+	schema := crab.InferSchema(ds)
+	want := []crab.InferredColumn{
+		{Name: "year", Field: "Year", Type: crab.ColumnInteger},
+		{Name: "Price (USD)", Field: "PriceUSD", Type: crab.ColumnInteger, Nullable: true, Unit: "$"},
+		{Name: "rate", Field: "Rate", Type: crab.ColumnNumber, Unit: "%"},
+		{Name: "available", Field: "Available", Type: crab.ColumnBoolean},
+		{Name: "listed_on", Field: "ListedOn", Type: crab.ColumnDate, Layout: "2006-01-02"},
+		{Name: "city", Field: "City", Type: crab.ColumnString},
+		{Name: "notes", Field: "Notes", Type: crab.ColumnEmpty, Nullable: true},
+		{Name: "rate", Field: "Rate2", Type: crab.ColumnString},
+		{Name: "zip", Field: "Zip", Type: crab.ColumnString},
+	}
+	if schema.Rows != 3 || len(schema.Columns) != len(want) {
+		t.Fatalf("InferSchema() = %+v", schema)
+	}
+	for i, column := range schema.Columns {
+		w := want[i]
+		if column.Name != w.Name || column.Field != w.Field || column.Type != w.Type || column.Nullable != w.Nullable ||
+			column.Unit != w.Unit || column.Layout != w.Layout {
+			t.Errorf("column %d = %+v, want %+v", i, column, w)
+		}
+	}
+	if examples := schema.Columns[1].Examples; len(examples) != 2 || examples[0] != "$1,200" {
+		t.Errorf("examples = %q", examples)
+	}
+
+	source, err := schema.GoStruct("ListingsData")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "listings.go", "package crab\n\n"+string(source), 0); err != nil {
+		t.Errorf("GoStruct() does not parse: %v\n%s", err, source)
+	}
+	if !strings.Contains(string(source), "PriceUSD ") || !strings.Contains(string(source), "`json:\"Price (USD)\"` // integer in $, may be empty") {
+		t.Errorf("GoStruct() =\n%s", source)
+	}
+
+	var records []interface{}
+	for _, row := range ds.Rows {
+		record := map[string]interface{}{}
+		for j, column := range ds.Columns {
+			record[column] = row[j]
+		}
+		records = append(records, record)
+	}
+	jsonSchema := schema.JSONSchema()
+	if violations := crab.ValidateJSONSchema(jsonSchema, records); len(violations) > 0 {
+		t.Errorf("JSONSchema() rejects the rows it was inferred from: %v", violations)
+	}
+	records[0].(map[string]interface{})["city"] = ""
+	if violations := crab.ValidateJSONSchema(jsonSchema, records); len(violations) != 1 {
+		t.Errorf("JSONSchema() violations of an empty city = %v, want one", violations)
+	}
+}
+
+func TestLoadOutputDataset(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(multiTablePage))
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}, TableTargets: []crab.TableTarget{{Name: "rates", URL: server.URL,
+		Tables: []crab.NamedTable{{Name: "annual_rates", Title: "Annual"}}}}})
+	defer crab.SetConfig(crab.Config{})
+	if err := crab.RunScraper("rates"); err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err := crab.LoadOutputDataset(dir, "annual_rates", "")
+	if err != nil || ds.RunID == "" || len(ds.Rows) != 2 {
+		t.Fatalf("LoadOutputDataset() = %+v, %v", ds, err)
+	}
+	schema := crab.InferSchema(ds)
+	if schema.Columns[0].Name != "annual_average" || schema.Columns[0].Type != crab.ColumnNumber || schema.Columns[1].Type != crab.ColumnInteger {
+		t.Errorf("InferSchema() = %+v", schema.Columns)
+	}
+	if name := crab.GoTypeName("annual_rates"); name != "AnnualRatesData" {
+		t.Errorf("GoTypeName() = %s", name)
+	}
+	if _, err := crab.LoadOutputDataset(dir, "weekly_rates", ""); err == nil {
+		t.Error("LoadOutputDataset() of a dataset no run wrote succeeded")
+	}
+}
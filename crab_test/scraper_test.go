@@ -37,6 +37,8 @@ func TestScrape(t *testing.T) {
 	// Alternatively, you can set up a local HTTP server that serves test HTML pages.
 
 	domainConfig := crab.DomainConfig{ /* ... */ } // Note the use of crab.
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}})
+	defer crab.SetConfig(crab.Config{})
 
 	var wg sync.WaitGroup
 
@@ -0,0 +1,108 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const scriptTestPage = `<html><body>
+<article class="product"><h3><a href="/books/1" title="Dune">Dune...</a></h3>
+  <p class="price">£51.77</p><p class="stock"> In stock </p><span class="tag">scifi</span><span class="tag">classic</span></article>
+<article class="product"><h3><a href="books/2" title="Emma">Emma</a></h3>
+  <p class="price">£12.00</p><p class="stock">Out of stock</p></article>
+<article class="product"><h3><a title="Free sample">Free sample</a></h3>
+  <p class="price">free</p><p class="stock">In stock</p></article>
+</body></html>`
+
+func TestScriptExtractor(t *testing.T) {
+	extractor, err := crab.CompileScriptExtractor(crab.ScriptExtractor{Name: "books", Items: "article.product",
+		Fields: []crab.ScriptField{
+			{Name: "title", Expr: `attr(find("h3 a"), 'title')`},
+			{Name: "price", Expr: "number(text(find('.price')))"},
+			{Name: "double_price", Expr: "if(price == null, null, price * 2)"},
+			{Name: "link", Expr: "absurl(attr(find('h3 a'), 'href'))"},
+			{Name: "in_stock", Expr: "lower(text(find('.stock'))) == 'in stock'"},
+			{Name: "tags", Expr: "join(texts(find('.tag')), '|')"},
+			{Name: "label", Expr: "upper(title) + ' (' + default(tags, 'untagged') + ')'"},
+		},
+		Filter: "price > 0 || !in_stock",
+	})
+	if err != nil {
+		t.Fatalf("CompileScriptExtractor() error = %v", err)
+	}
+	pageURL, _ := url.Parse("https://books.example.com/catalogue/")
+	records, err := extractor.Extract(&crab.ExtractorPage{URL: pageURL, Body: []byte(scriptTestPage)})
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	want := []map[string]interface{}{
+		{"title": "Dune", "price": 51.77, "double_price": 103.54, "link": "https://books.example.com/books/1",
+			"in_stock": true, "tags": "scifi|classic", "label": "DUNE (scifi|classic)"},
+		{"title": "Emma", "price": 12.0, "double_price": 24.0, "link": "https://books.example.com/catalogue/books/2",
+			"in_stock": false, "tags": "", "label": "EMMA (untagged)"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("Extract() = %v, want %v", records, want)
+	}
+}
+
+func TestScriptExtractorErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"", "empty expression"},
+		{"nope(1)", "unknown function nope"},
+		{"later + 1", "unknown variable later"},
+		{"trim('a', 'b')", "trim takes 1 to 1 arguments"},
+		{"(1 + 2", "expected )"},
+		{"'open", "unterminated string"},
+		{"1 2", `unexpected "2"`},
+		{"1 # 2", "unexpected"},
+	}
+	for _, test := range tests {
+		_, err := crab.CompileScriptExtractor(crab.ScriptExtractor{Name: "bad",
+			Fields: []crab.ScriptField{{Name: "value", Expr: test.expr}, {Name: "later", Expr: "1"}}})
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("CompileScriptExtractor(%q) error = %v, want %q", test.expr, err, test.want)
+		}
+	}
+
+	extractor, err := crab.CompileScriptExtractor(crab.ScriptExtractor{Name: "bad",
+		Fields: []crab.ScriptField{{Name: "value", Expr: "text(find('p')) * 2"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageURL, _ := url.Parse("https://example.com/")
+	if _, err := extractor.Extract(&crab.ExtractorPage{URL: pageURL, Body: []byte("<p>none</p>")}); err == nil ||
+		!strings.Contains(err.Error(), `"none" is not a number`) {
+		t.Errorf("Extract() of arithmetic on text error = %v", err)
+	}
+}
+
+// FuzzScriptExtractor compiles arbitrary expressions and runs those that compile on a page: either may
+// fail, but neither may panic or hang.
+func FuzzScriptExtractor(f *testing.F) {
+	for _, seed := range []string{
+		`attr(find("h3 a"), 'title')`, "number(text(find('.price')))", "if(title == null, null, count(title) * 2)",
+		"absurl(attr(find('h3 a'), 'href'))", "lower(text(find('.stock'))) == 'in stock'",
+		"join(texts(find('.tag')), '|')", "upper(title) + ' (' + default(title, 'untagged') + ')'",
+		"match(text(find(item, '.price')), '([0-9.]+)') % 3", "!(1 <= -2.5) || split(url, '/') != ''",
+		"replace(trim(doc), 'a', \"\\\"\")", "(1 + 2", "'open", "1 # 2", "",
+	} {
+		f.Add(seed)
+	}
+	pageURL, _ := url.Parse("https://books.example.com/catalogue/")
+	f.Fuzz(func(t *testing.T, expr string) {
+		extractor, err := crab.CompileScriptExtractor(crab.ScriptExtractor{Name: "fuzz", Items: "article.product",
+			Fields: []crab.ScriptField{{Name: "title", Expr: "text(find('h3 a'))"}, {Name: "value", Expr: expr}},
+			Filter: expr})
+		if err != nil {
+			return
+		}
+		extractor.Extract(&crab.ExtractorPage{URL: pageURL, Body: []byte(scriptTestPage)})
+	})
+}
@@ -0,0 +1,124 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLoadConfigResolvesSecrets(t *testing.T) {
+	t.Setenv("CRAB_API_DASHBOARD", "env-key")
+	t.Setenv("CRAB_PROXY_PASSWORD", "hunter2")
+	file := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("CRAB_SMTP_RELAY", "smtp-pass")
+	t.Setenv("CRAB_GRAPHQL_SHOP", "shop-token")
+	config := `{"api": {"keys": [{"name": "dashboard", "key": "secret:api/dashboard", "role": "viewer"}]},
+		"proxy": {"urls": ["http://proxy.example.com:3128"], "username": "crab", "password": "secret:proxy/password"},
+		"email": {"password": "secret:smtp/relay"}, "graphql_targets": [{"name": "shop", "token": "secret:graphql/shop"}]}`
+	if err := os.WriteFile(file, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := crab.LoadConfig(file)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if loaded.API.Keys[0].Key != "env-key" || loaded.Proxy.Password != "hunter2" || loaded.Proxy.Username != "crab" {
+		t.Errorf("LoadConfig() = %+v, %+v", loaded.API, loaded.Proxy)
+	}
+	if loaded.Email.Password != "smtp-pass" || loaded.GraphQLTargets[0].Token != "shop-token" {
+		t.Errorf("LoadConfig() = %+v, %+v", loaded.Email, loaded.GraphQLTargets)
+	}
+
+	if err := os.WriteFile(file, []byte(`{"api": {"jwt_secret": "secret:api/missing"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := crab.LoadConfig(file); !errors.Is(err, crab.ErrSecretNotFound) {
+		t.Errorf("LoadConfig() with a missing secret error = %v, want ErrSecretNotFound", err)
+	}
+}
+
+func TestProxyConfig(t *testing.T) {
+	var auth string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Proxy-Authorization")
+		w.Write([]byte("<html><body>via proxy</body></html>"))
+	}))
+	defer proxy.Close()
+
+	crab.SetConfig(crab.Config{Proxy: crab.ProxyConfig{URLs: []string{proxy.URL}, Username: "crab", Password: "hunter2"}})
+	defer crab.SetConfig(crab.Config{})
+	page := crab.FetchPage(crab.URLData{URL: "http://unreachable.example/"})
+	if page.StatusCode != http.StatusOK || string(page.Body) != "<html><body>via proxy</body></html>" {
+		t.Fatalf("FetchPage() = %d %q, want the proxy's answer", page.StatusCode, page.Body)
+	}
+	if auth != "Basic Y3JhYjpodW50ZXIy" {
+		t.Errorf("Proxy-Authorization = %q", auth)
+	}
+}
+
+func TestProxyRotation(t *testing.T) {
+	var first, second int32
+	proxy := func(count *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(count, 1)
+			w.Write([]byte("<html></html>"))
+		}))
+	}
+	firstProxy, secondProxy := proxy(&first), proxy(&second)
+	defer firstProxy.Close()
+	defer secondProxy.Close()
+
+	crab.SetConfig(crab.Config{Proxy: crab.ProxyConfig{URLs: []string{firstProxy.URL, secondProxy.URL}}})
+	defer crab.SetConfig(crab.Config{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if page := crab.FetchPage(crab.URLData{URL: fmt.Sprintf("http://unreachable.example/%d", i)}); page.StatusCode != http.StatusOK {
+				t.Errorf("FetchPage() = %d %s", page.StatusCode, page.Error)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if first != 4 || second != 4 {
+		t.Errorf("proxies served %d and %d requests, want 4 each", first, second)
+	}
+}
+
+func TestProxyRotationAcrossConfigs(t *testing.T) {
+	var first, second, other int32
+	proxy := func(count *int32) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(count, 1)
+			w.Write([]byte("<html></html>"))
+		}))
+	}
+	firstProxy, secondProxy, otherProxy := proxy(&first), proxy(&second), proxy(&other)
+	defer firstProxy.Close()
+	defer secondProxy.Close()
+	defer otherProxy.Close()
+	defer crab.SetConfig(crab.Config{})
+
+	// Switching to another configuration and back keeps the rotation, and the connections, of the first
+	rotating := crab.Config{Proxy: crab.ProxyConfig{URLs: []string{firstProxy.URL, secondProxy.URL}}}
+	single := crab.Config{Proxy: crab.ProxyConfig{URLs: []string{otherProxy.URL}}}
+	for i := 0; i < 4; i++ {
+		for _, config := range []crab.Config{rotating, single} {
+			crab.SetConfig(config)
+			if page := crab.FetchPage(crab.URLData{URL: fmt.Sprintf("http://unreachable.example/%d", i)}); page.StatusCode != http.StatusOK {
+				t.Errorf("FetchPage() = %d %s", page.StatusCode, page.Error)
+			}
+		}
+	}
+	if first != 2 || second != 2 || other != 4 {
+		t.Errorf("proxies served %d, %d and %d requests, want 2, 2 and 4", first, second, other)
+	}
+}
@@ -0,0 +1,99 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestScanSecurityPage(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Security-Policy", "default-src 'self'")
+	header.Set("Server", "nginx")
+	page := crab.ScanSecurityPage("https://shop.example/a/", header, []byte(`<html><head>
+		<link rel="stylesheet" href="http://cdn.example/site.css"><link rel="alternate" href="http://shop.example/feed">
+		<script src="//cdn.example/app.js"></script><script src="http://cdn.example/old.js"></script>
+		</head><body><a href="http://elsewhere.example/">Not loaded</a><img src="img/a.png"><img src="http://img.example/b.png">
+		</body></html>`))
+	if len(page.Headers) != 1 || page.Headers["Content-Security-Policy"] != "default-src 'self'" {
+		t.Errorf("headers = %v, want only the security ones", page.Headers)
+	}
+	want := "http://cdn.example/site.css,http://cdn.example/old.js,http://img.example/b.png"
+	if got := strings.Join(page.MixedContent, ","); got != want {
+		t.Errorf("mixed content = %s, want %s", got, want)
+	}
+	if plain := crab.ScanSecurityPage("http://shop.example/", header, []byte(`<img src="http://img.example/b.png">`)); len(plain.MixedContent) != 0 {
+		t.Errorf("an HTTP page has mixed content %v", plain.MixedContent)
+	}
+}
+
+func TestAuditSecurity(t *testing.T) {
+	report := crab.AuditSecurity([]crab.SecurityPage{
+		{URL: "https://shop.example/", Headers: map[string]string{
+			"Content-Security-Policy": "default-src 'self'; frame-ancestors 'none'", "X-Content-Type-Options": "nosniff",
+			"Strict-Transport-Security": "max-age=31536000; includeSubDomains"}},
+		{URL: "https://shop.example/b", Headers: map[string]string{
+			"Content-Security-Policy-Report-Only": "default-src 'self'", "X-Frame-Options": "DENY",
+			"Strict-Transport-Security": "max-age=3600"}, MixedContent: []string{"http://cdn.example/app.js"}},
+		{URL: "http://blog.example/", Headers: map[string]string{}},
+	})
+	checks := map[string]string{}
+	for _, page := range report.Pages {
+		var names []string
+		for _, issue := range page.Issues {
+			names = append(names, issue.Check)
+		}
+		checks[page.URL] = strings.Join(names, ",")
+	}
+	for url, want := range map[string]string{
+		"https://shop.example/":  "",
+		"https://shop.example/b": "missing-csp,weak-hsts,missing-x-content-type-options,mixed-content",
+		"http://blog.example/":   "missing-csp,missing-x-frame-options,missing-x-content-type-options",
+	} {
+		if checks[url] != want {
+			t.Errorf("issues of %s = %q, want %q", url, checks[url], want)
+		}
+	}
+	if len(report.Domains) != 2 || report.Domains[0].Domain != "blog.example" {
+		t.Fatalf("domains = %+v", report.Domains)
+	}
+	if shop := report.Domains[1]; shop.Pages != 2 || shop.Issues[crab.SecurityMixedContent] != 1 ||
+		shop.Headers["Strict-Transport-Security"] != 2 || shop.Headers["X-Frame-Options"] != 1 {
+		t.Errorf("domain shop.example = %+v", shop)
+	}
+	if summary := report.Summary(); !strings.Contains(summary, "Mixed content on https://shop.example/b:\n  http://cdn.example/app.js") {
+		t.Errorf("Summary() = %s", summary)
+	}
+}
+
+func TestCrawlSecurityAudit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/safe" {
+			w.Header().Set("Content-Security-Policy", "frame-ancestors 'self'")
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+		}
+		fmt.Fprintf(w, `<title>Page %s</title>`, r.URL.Path)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}, SecurityAudit: crab.SecurityAuditConfig{Enabled: true}})
+	defer crab.SetConfig(crab.Config{})
+
+	summary := crab.Crawl(context.Background(), []crab.URLData{{URL: server.URL + "/safe"}, {URL: server.URL + "/bare"}}, 2)
+	report, err := crab.LoadSecurityReport(dir, "")
+	if err != nil {
+		t.Fatalf("LoadSecurityReport() failed: %v", err)
+	}
+	if report.RunID != summary.RunID || len(report.Pages) != 2 || len(report.Domains) != 1 || report.Domains[0].Pages != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	if bare, safe := report.Pages[0], report.Pages[1]; len(bare.Issues) != 3 || len(safe.Issues) != 0 ||
+		safe.Headers["X-Content-Type-Options"] != "nosniff" {
+		t.Errorf("pages = %+v", report.Pages)
+	}
+}
@@ -0,0 +1,108 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanSEOPage(t *testing.T) {
+	page := crab.ScanSEOPage("https://shop.example/a/", []byte(`<html><head>
+		<title>  Blue
+		  widgets </title>
+		<meta name="Description" content=" Widgets in blue. ">
+		<link rel="canonical" href="/widgets">
+		<script>var title = "<title>not this</title>";</script>
+		</head><body><h1>Blue widgets</h1>
+		<img src="a.png" alt="A blue widget"><img src="b.png"><img src="spacer.gif" alt="">
+		</body></html>`))
+	if page.Title != "Blue widgets" || page.Description != "Widgets in blue." || page.Canonical != "https://shop.example/widgets" {
+		t.Errorf("ScanSEOPage() = %+v", page)
+	}
+	if page.Images != 3 || page.ImagesWithoutAlt != 1 {
+		t.Errorf("images = %d, %d without alt, want 3 and 1", page.Images, page.ImagesWithoutAlt)
+	}
+	same := crab.ScanSEOPage("https://shop.example/b", []byte(`<title>Other</title><h1>Blue
+		widgets</h1><script>track()</script>`))
+	if same.ContentHash != page.ContentHash {
+		t.Errorf("pages with the same text hash differently")
+	}
+	if empty := crab.ScanSEOPage("https://shop.example/c", []byte(`<img src="x.png">`)); empty.ContentHash != "" {
+		t.Errorf("a page without text has a content hash")
+	}
+}
+
+func TestAuditSEO(t *testing.T) {
+	report := crab.AuditSEO([]crab.SEOPage{
+		{URL: "https://shop.example/", Title: "Shop", Description: "All of it", ContentHash: "home"},
+		{URL: "https://shop.example/a", Title: "Widget", Description: "A", ContentHash: "widget", Canonical: "https://shop.example/a"},
+		{URL: "https://shop.example/a?ref=mail", Title: "widget", Description: "A", ContentHash: "widget", Canonical: "https://shop.example/a"},
+		{URL: "https://shop.example/b", ContentHash: "b", Images: 6, ImagesWithoutAlt: 5, ResponseTime: 3 * time.Second},
+		{URL: "https://blog.example/1", Title: "Post", Description: "One", ContentHash: "post"},
+		{URL: "https://blog.example/1?print", Title: "Post print", Description: "One", ContentHash: "post"},
+	}, crab.SEOAuditConfig{})
+
+	checks := map[string]string{}
+	scores := map[string]int{}
+	for _, page := range report.Pages {
+		var names []string
+		for _, issue := range page.Issues {
+			names = append(names, issue.Check)
+		}
+		checks[page.URL] = strings.Join(names, ",")
+		scores[page.URL] = page.Score
+	}
+	for url, want := range map[string]string{
+		"https://shop.example/":           "",
+		"https://shop.example/a":          "duplicate-title",
+		"https://shop.example/a?ref=mail": "duplicate-title",
+		"https://shop.example/b":          "missing-title,missing-description,missing-alt,slow-response",
+		"https://blog.example/1":          "duplicate-content",
+		"https://blog.example/1?print":    "duplicate-content",
+	} {
+		if checks[url] != want {
+			t.Errorf("issues of %s = %q, want %q", url, checks[url], want)
+		}
+	}
+	if scores["https://shop.example/"] != 100 || scores["https://shop.example/a"] != 90 || scores["https://shop.example/b"] != 25 {
+		t.Errorf("scores = %v", scores)
+	}
+	if len(report.Sites) != 2 || report.Sites[0].Host != "blog.example" || report.Sites[0].Score != 80 ||
+		report.Sites[1].Pages != 4 || report.Sites[1].Issues["duplicate-title"] != 2 {
+		t.Errorf("sites = %+v", report.Sites)
+	}
+	if summary := report.Summary(); !strings.Contains(summary, "shop.example: score 76 over 4 page(s)") {
+		t.Errorf("Summary() = %s", summary)
+	}
+}
+
+func TestCrawlSEOAudit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/slow" {
+			time.Sleep(150 * time.Millisecond)
+		}
+		fmt.Fprintf(w, `<title>Page %s</title><meta name="description" content="d"><p>%s</p>`, r.URL.Path, r.URL.Path)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}, SEOAudit: crab.SEOAuditConfig{Enabled: true, SlowResponse: "100ms"}})
+	defer crab.SetConfig(crab.Config{})
+
+	summary := crab.Crawl(context.Background(), []crab.URLData{{URL: server.URL + "/fast"}, {URL: server.URL + "/slow"}}, 2)
+	report, err := crab.LoadSEOReport(dir, "")
+	if err != nil {
+		t.Fatalf("LoadSEOReport() failed: %v", err)
+	}
+	if report.RunID != summary.RunID || len(report.Pages) != 2 || len(report.Pages[0].Issues) != 0 {
+		t.Fatalf("report = %+v", report)
+	}
+	if issues := report.Pages[1].Issues; len(issues) != 1 || issues[0].Check != crab.SEOSlowResponse || report.Pages[1].ResponseMillis < 150 {
+		t.Errorf("audit of the slow page = %+v", report.Pages[1])
+	}
+}
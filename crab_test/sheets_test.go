@@ -0,0 +1,140 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSheets serves the token endpoint and the parts of the Sheets API the sink uses, keeping every tab
+// in tabs.
+func fakeSheets(t *testing.T) (server *httptest.Server, keyPEM []byte, tabs map[string][][]string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	var mu sync.Mutex
+	tabs = make(map[string][][]string)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "test-token", "expires_in": 3600})
+	})
+	mux.HandleFunc("/sheets/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasSuffix(r.URL.Path, ":batchUpdate"):
+			var body struct {
+				Requests []struct {
+					AddSheet struct {
+						Properties struct {
+							Title string `json:"title"`
+						} `json:"properties"`
+					} `json:"addSheet"`
+				} `json:"requests"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			for _, req := range body.Requests {
+				tabs[req.AddSheet.Properties.Title] = [][]string{}
+			}
+		case strings.HasSuffix(r.URL.Path, ":append"):
+			var body struct {
+				Values [][]string `json:"values"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			tab := sheetsTab(r.URL.Path, ":append")
+			tabs[tab] = append(tabs[tab], body.Values...)
+		case r.Method == http.MethodGet:
+			values, ok := tabs[sheetsTab(r.URL.Path, "")]
+			if !ok {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"values": values})
+		}
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, keyPEM, tabs
+}
+
+// sheetsTab returns the tab named by the range at the end of a values request path.
+func sheetsTab(path, suffix string) string {
+	sheetRange := strings.TrimSuffix(path[strings.LastIndex(path, "/")+1:], suffix)
+	if i := strings.LastIndex(sheetRange, "!"); i >= 0 {
+		sheetRange = sheetRange[:i]
+	}
+	return strings.Trim(sheetRange, "'")
+}
+
+func TestGoogleSheetsSinkPush(t *testing.T) {
+	server, keyPEM, tabs := fakeSheets(t)
+
+	sink := &crab.GoogleSheetsSink{
+		SpreadsheetID: "sheet-id",
+		Key:           crab.ServiceAccountKey{ClientEmail: "bot@example.com", PrivateKey: string(keyPEM), TokenURI: server.URL + "/token"},
+		BaseURL:       server.URL + "/sheets",
+	}
+
+	ds := crab.Dataset{Name: "gasoline", Columns: []string{"year", "price"}, Rows: [][]string{{"1978", "0.652"}}}
+	added, err := sink.Push(ds)
+	if err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if sheet := tabs["gasoline"]; added != 1 || len(sheet) != 2 {
+		t.Fatalf("first Push() added %d rows, sheet = %v; want header plus 1 row", added, sheet)
+	}
+
+	ds.Rows = append(ds.Rows, []string{"1979", "0.882"})
+	added, err = sink.Push(ds)
+	if err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if sheet := tabs["gasoline"]; added != 1 || len(sheet) != 3 {
+		t.Errorf("incremental Push() added %d rows, sheet = %v; want only the new row", added, sheet)
+	}
+}
+
+func TestRunFinishPushesToSheets(t *testing.T) {
+	server, keyPEM, tabs := fakeSheets(t)
+	keyJSON, err := json.Marshal(crab.ServiceAccountKey{ClientEmail: "bot@example.com", PrivateKey: string(keyPEM), TokenURI: server.URL + "/token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_SHEETS_SPREADSHEET_ID", "sheet-id")
+	t.Setenv("GOOGLE_SHEETS_API_URL", server.URL+"/sheets")
+	t.Setenv("GOOGLE_SERVICE_ACCOUNT_JSON", string(keyJSON))
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}})
+	defer crab.SetConfig(crab.Config{})
+
+	run, err := crab.StartRun("scrape")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataset := run.Path("gasoline_data.json")
+	if err := os.WriteFile(dataset, []byte(`[{"year": "1978", "average_gasoline_prices": "0.652"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run.Finish([]string{dataset}); err != nil {
+		t.Fatal(err)
+	}
+
+	if sheet := tabs["gasoline"]; len(sheet) != 2 {
+		t.Errorf("gasoline tab = %v, want the header and the run's row", sheet)
+	}
+}
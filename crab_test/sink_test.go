@@ -0,0 +1,92 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResultSinkBackpressure(t *testing.T) {
+	const buffer = 4
+	var mu sync.Mutex
+	put, written, maxPending := 0, 0, 0
+	sink := crab.NewResultSink(buffer, func(v interface{}) error {
+		time.Sleep(100 * time.Microsecond) // A writer slower than the producer
+		mu.Lock()
+		written++
+		mu.Unlock()
+		return nil
+	})
+	for i := 0; i < 500; i++ {
+		sink.Put(i)
+		mu.Lock()
+		put++
+		if pending := put - written; pending > maxPending {
+			maxPending = pending
+		}
+		mu.Unlock()
+	}
+	count, err := sink.Close()
+	if count != 500 || err != nil {
+		t.Errorf("Close() = %d, %v, want 500, nil", count, err)
+	}
+	// The buffer plus the result being written and the one being handed over.
+	if maxPending > buffer+2 {
+		t.Errorf("up to %d results were waiting for the writer, want at most %d", maxPending, buffer+2)
+	}
+}
+
+func TestResultSinkError(t *testing.T) {
+	failure := errors.New("disk full")
+	sink := crab.NewResultSink(1, func(v interface{}) error {
+		if v.(int) == 3 {
+			return failure
+		}
+		return nil
+	})
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 100; i++ {
+			sink.Put(i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Put() blocked after a write error")
+	}
+	if count, err := sink.Close(); count != 3 || err != failure {
+		t.Errorf("Close() = %d, %v, want 3, %v", count, err, failure)
+	}
+}
+
+func TestCreateDatasetStream(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "books_data.json")
+	stream, err := crab.CreateDatasetStream(filename, "books")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Write(crab.GenericData{Title: "A Light in the Attic", Price: "£51.77"})
+	stream.Write(crab.GenericData{Title: "Tipping the Velvet", Price: "£53.74"})
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dataset crab.ItemData
+	if err := json.Unmarshal(data, &dataset); err != nil {
+		t.Fatalf("decoding %s: %v", data, err)
+	}
+	if dataset.Domain != "books" || len(dataset.Data) != 2 || dataset.Data[1].Title != "Tipping the Velvet" {
+		t.Errorf("dataset = %+v", dataset)
+	}
+}
@@ -0,0 +1,48 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffSiteMaps(t *testing.T) {
+	previous := map[string][]string{
+		"http://a.com/":      {"http://a.com/1", "http://a.com/2"},
+		"http://a.com/old":   {},
+		"http://a.com/same":  {"http://a.com/x", "http://a.com/y"},
+		"http://a.com/dupes": {"http://a.com/z", "http://a.com/z"},
+	}
+	current := map[string][]string{
+		"http://a.com/":      {"http://a.com/2", "http://a.com/3", "http://a.com/3"},
+		"http://a.com/new":   {"http://a.com/"},
+		"http://a.com/same":  {"http://a.com/y", "http://a.com/x"},
+		"http://a.com/dupes": {"http://a.com/z"},
+	}
+
+	diff := crab.DiffSiteMaps(previous, current)
+	want := crab.SiteMapDiff{
+		Added:   []string{"http://a.com/new"},
+		Removed: []string{"http://a.com/old"},
+		Changed: []crab.PageLinkChange{{
+			URL:          "http://a.com/",
+			AddedLinks:   []string{"http://a.com/3"},
+			RemovedLinks: []string{"http://a.com/1"},
+		}},
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Errorf("DiffSiteMaps() = %+v, want %+v", diff, want)
+	}
+
+	summary := diff.Summary()
+	for _, line := range []string{"1 new page(s), 1 removed page(s), 1 page(s) with changed links", "  + http://a.com/new", "    - http://a.com/1"} {
+		if !strings.Contains(summary, line) {
+			t.Errorf("Summary() missing %q:\n%s", line, summary)
+		}
+	}
+
+	if same := crab.DiffSiteMaps(previous, previous); !same.Empty() {
+		t.Errorf("DiffSiteMaps() of identical sitemaps = %+v, want empty", same)
+	}
+}
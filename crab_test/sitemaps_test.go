@@ -0,0 +1,47 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAddSitemapSeeds(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /admin\n\nSitemap: %s/sitemap_index.xml\n", server.URL)
+		case "/sitemap_index.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/pages.xml</loc></sitemap></sitemapindex>`, server.URL)
+		case "/pages.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%[1]s/</loc></url><url><loc>%[1]s/a</loc></url>
+<url><loc>https://elsewhere.example/b</loc></url><url><loc> %[1]s/c </loc></url></urlset>`, server.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	sitemaps, err := crab.RobotsSitemaps(server.URL + "/")
+	if err != nil || len(sitemaps) != 1 || sitemaps[0] != server.URL+"/sitemap_index.xml" {
+		t.Fatalf("RobotsSitemaps() = %v, %v", sitemaps, err)
+	}
+
+	seeds := crab.AddSitemapSeeds([]crab.URLData{{URL: server.URL + "/"}}, 0)
+	var got []string
+	for _, seed := range seeds {
+		got = append(got, seed.URL)
+	}
+	want := []string{server.URL + "/", server.URL + "/a", server.URL + "/c"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AddSitemapSeeds() = %v, want %v", got, want)
+	}
+
+	if pages := crab.IngestSitemaps(sitemaps, 2); len(pages) != 2 {
+		t.Errorf("IngestSitemaps() with a limit of 2 = %v", pages)
+	}
+}
@@ -0,0 +1,88 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"fmt"
+	"github.com/gocolly/colly"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFileSnapshotStore(t *testing.T) {
+	store := crab.FileSnapshotStore{Dir: t.TempDir()}
+	url := "https://example.com/books?page=2"
+	first := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, body := range []string{"<html>first</html>", "<html>second</html>"} {
+		snapshot := crab.Snapshot{URL: url, FetchedAt: first.Add(time.Duration(i) * time.Hour), StatusCode: 200,
+			ContentType: "text/html", Body: []byte(body)}
+		if err := store.SaveSnapshot(snapshot); err != nil {
+			t.Fatalf("SaveSnapshot() error = %v", err)
+		}
+	}
+
+	snapshots, err := store.ListSnapshots(url)
+	if err != nil {
+		t.Fatalf("ListSnapshots() error = %v", err)
+	}
+	if len(snapshots) != 2 || !snapshots[0].FetchedAt.Equal(first) || snapshots[0].URLHash != crab.URLHash(url) {
+		t.Fatalf("ListSnapshots() = %+v, want two snapshots oldest first", snapshots)
+	}
+
+	latest, err := store.LoadSnapshot(url, time.Time{})
+	if err != nil || string(latest.Body) != "<html>second</html>" {
+		t.Errorf("LoadSnapshot(latest) = %q, %v, want the second page", latest.Body, err)
+	}
+	older, err := store.LoadSnapshot(url, first)
+	if err != nil || string(older.Body) != "<html>first</html>" {
+		t.Errorf("LoadSnapshot(first) = %q, %v, want the first page", older.Body, err)
+	}
+	doc, err := older.Document()
+	if err != nil || doc.Text() != "first" {
+		t.Errorf("Document().Text() = %v, want first", err)
+	}
+
+	if _, err := store.LoadSnapshot("https://example.com/missing", time.Time{}); err == nil {
+		t.Error("LoadSnapshot() of an unknown URL succeeded")
+	}
+	if _, err := store.LoadSnapshot(url, first.Add(time.Minute)); err == nil {
+		t.Error("LoadSnapshot() at an unknown time succeeded")
+	}
+}
+
+func TestAttachSnapshots(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/data.json" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"ok": true}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html><body>page</body></html>")
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Snapshots: crab.SnapshotConfig{Enabled: true, Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+
+	c := colly.NewCollector()
+	crab.AttachSnapshots(c)
+	c.Visit(server.URL + "/page")
+	c.Visit(server.URL + "/data.json")
+
+	store := crab.FileSnapshotStore{Dir: dir}
+	snapshot, err := store.LoadSnapshot(server.URL+"/page", time.Time{})
+	if err != nil || string(snapshot.Body) != "<html><body>page</body></html>" || snapshot.StatusCode != 200 {
+		t.Errorf("LoadSnapshot(page) = %+v, %v, want the stored page", snapshot, err)
+	}
+	if snapshots, _ := store.ListSnapshots(server.URL + "/data.json"); len(snapshots) != 0 {
+		t.Errorf("ListSnapshots(data.json) = %+v, want non-HTML responses skipped", snapshots)
+	}
+
+	crab.SetConfig(crab.Config{})
+	if crab.CurrentSnapshotStore() != nil {
+		t.Error("CurrentSnapshotStore() returned a store with snapshots disabled")
+	}
+}
@@ -0,0 +1,84 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSummarizeDataset(t *testing.T) {
+	ds := crab.Dataset{Name: "gasoline", Columns: []string{"year", "price", "note"},
+		Rows: [][]string{{"2022", "$3.95", "high"}, {"2021", "$3.01", ""}, {"2020", "", ""}}}
+	stats := crab.SummarizeDataset(ds)
+	if stats.Rows != 3 || len(stats.Columns) != 3 {
+		t.Fatalf("SummarizeDataset() = %+v", stats)
+	}
+	price := stats.Columns[1]
+	if price.Nulls != 1 || price.Min == nil || *price.Min != 3.01 || *price.Max != 3.95 || *price.Mean != 3.48 {
+		t.Errorf("price stats = %+v", price)
+	}
+	if note := stats.Columns[2]; note.Nulls != 2 || note.Mean != nil {
+		t.Errorf("note stats = %+v, want 2 empty and no range", note)
+	}
+	if text := stats.String(); !strings.Contains(text, "gasoline: 3 rows") || !strings.Contains(text, "price: 1 empty, min 3.01, max 3.95") {
+		t.Errorf("String() = %q", text)
+	}
+
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}})
+	defer crab.SetConfig(crab.Config{})
+	defer crab.UseFixtures(filepath.Join(fixturesDir, "gasoline"), false)()
+	crab.ScrapeGasInflationData()
+	scraped, err := crab.LoadDatasetStats(dir, "gasoline", "")
+	if err != nil || scraped.Rows == 0 || scraped.RunID == "" || scraped.Columns[0].Column != "year" || scraped.Columns[0].Min == nil {
+		t.Errorf("LoadDatasetStats() = %+v, %v", scraped, err)
+	}
+}
+
+func TestRunSummaryDatasetStats(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"results": [{"name": "apple", "price": 2}, {"name": "pear", "price": 4}, {"name": "fig"}]}`)
+	}))
+	defer api.Close()
+	var summaries []crab.RunSummary
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var summary crab.RunSummary
+		json.NewDecoder(r.Body).Decode(&summary)
+		summaries = append(summaries, summary)
+	}))
+	defer hook.Close()
+	crab.SetConfig(crab.Config{Webhooks: []crab.WebhookConfig{{URL: hook.URL}}, Output: crab.OutputConfig{Dir: t.TempDir()}})
+	defer crab.SetConfig(crab.Config{})
+
+	target := crab.JSONTarget{Name: "products", URL: api.URL, ItemsPath: "$.results[*]",
+		Fields: []crab.JSONField{{Name: "name", Path: "$.name"}, {Name: "price", Path: "$.price"}}}
+	if err := crab.RunJSONTarget(target); err != nil {
+		t.Fatalf("RunJSONTarget() error = %v", err)
+	}
+	if len(summaries) != 1 || len(summaries[0].Datasets) != 1 {
+		t.Fatalf("webhook summaries = %+v, want one with dataset stats", summaries)
+	}
+	stats := summaries[0].Datasets[0]
+	if stats.Dataset != "products" || stats.Rows != 3 || len(stats.Columns) != 2 {
+		t.Fatalf("dataset stats = %+v", stats)
+	}
+	if price := stats.Columns[1]; price.Column != "price" || price.Nulls != 1 || price.Mean == nil || *price.Mean != 3 {
+		t.Errorf("price stats = %+v", price)
+	}
+
+	summary := summaries[0]
+	summary.StartedAt, summary.FinishedAt = time.Now(), time.Now()
+	message, err := crab.BuildRunReportEmail("crab@example.com", []string{"team@example.com"}, summary, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(message), "Dataset products: 3 rows") || !strings.Contains(string(message), "<td>price</td><td>1</td><td>2</td><td>4</td><td>3</td>") {
+		t.Errorf("report email lacks the dataset stats:\n%s", message)
+	}
+}
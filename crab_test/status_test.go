@@ -0,0 +1,107 @@
+package crab_test
+
+import (
+	"bufio"
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCrawlRecordsURLStatus(t *testing.T) {
+	site := testsite.New(testsite.Config{
+		Pages:  6,
+		Links:  func(i int) []int { return nil },
+		Robots: "User-agent: *\nDisallow: /page/3\n",
+		Status: map[string]int{"/page/1": 404, "/page/2": 500},
+		Slow:   map[string]time.Duration{"/page/4": time.Second},
+	})
+	defer site.Close()
+	siteURL, _ := url.Parse(site.URL)
+	crab.RegisterExtractor("broken", siteURL.Hostname()+"/page/5", crab.ExtractorFunc(func(page *crab.ExtractorPage) ([]map[string]interface{}, error) {
+		return nil, errors.New("unexpected layout")
+	}))
+	defer crab.UnregisterExtractor("broken")
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{
+		Output:        crab.OutputConfig{Dir: dir},
+		Pipeline:      crab.PipelineConfig{FetchTimeout: "200ms"},
+		RespectRobots: true,
+	})
+	defer crab.SetConfig(crab.Config{})
+
+	urls := []crab.URLData{{URL: "http://crab-test.invalid/"}}
+	for i := 0; i < 6; i++ {
+		urls = append(urls, crab.URLData{URL: site.PageURL(i)})
+	}
+	fetchedBefore := urlStatusMetric(crab.StatusFetched)
+	summary := crab.Crawl(context.Background(), urls, 4)
+	want := map[string]int{
+		crab.StatusFetched:      1,
+		crab.StatusHTTP4xx:      1,
+		crab.StatusHTTP5xx:      1,
+		crab.StatusRobotsDenied: 1,
+		crab.StatusTimeout:      1,
+		crab.StatusDNSError:     1,
+		crab.StatusParseError:   1,
+	}
+	if !reflect.DeepEqual(summary.Statuses, want) || summary.Errors != 6 {
+		t.Errorf("Crawl() statuses = %v with %d errors, want %v with 6", summary.Statuses, summary.Errors, want)
+	}
+	if fetched := urlStatusMetric(crab.StatusFetched) - fetchedBefore; fetched != 1 {
+		t.Errorf("crab_url_status fetched grew by %d, want 1", fetched)
+	}
+
+	file, err := os.Open(filepath.Join(dir, summary.RunID, "url_status.jsonl"))
+	if err != nil {
+		t.Fatalf("url_status.jsonl: %v", err)
+	}
+	defer file.Close()
+	statuses := map[string]string{}
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		var result crab.CrawlResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("url_status.jsonl line %s: %v", scanner.Text(), err)
+		}
+		statuses[result.URL] = result.Status
+	}
+	for url, status := range map[string]string{
+		site.PageURL(0): crab.StatusFetched,
+		site.PageURL(1): crab.StatusHTTP4xx,
+		site.PageURL(3): crab.StatusRobotsDenied,
+		site.PageURL(4): crab.StatusTimeout,
+		site.PageURL(5): crab.StatusParseError,
+	} {
+		if statuses[url] != status {
+			t.Errorf("url_status.jsonl status of %s = %q, want %q", url, statuses[url], status)
+		}
+	}
+	if len(statuses) != len(urls) {
+		t.Errorf("url_status.jsonl has %d URLs, want %d", len(statuses), len(urls))
+	}
+	if site.Count("/page/3") != 0 {
+		t.Errorf("a page disallowed by robots.txt was fetched")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if summary := crab.Crawl(ctx, urls[:2], 1); summary.Statuses[crab.StatusNotCrawled] != 2 {
+		t.Errorf("Crawl() of a stopped crawl statuses = %v, want 2 not crawled", summary.Statuses)
+	}
+}
+
+// urlStatusMetric returns the crab_url_status count of status.
+func urlStatusMetric(status string) int64 {
+	if v, ok := expvar.Get("crab_url_status").(*expvar.Map).Get(status).(*expvar.Int); ok {
+		return v.Value()
+	}
+	return 0
+}
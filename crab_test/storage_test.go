@@ -0,0 +1,99 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestObjectStoreSinkUploadRunOutputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"siteMap.json", "gasoline_data.json", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	uploaded := make(map[string]*http.Request)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		uploaded[r.URL.Path] = r
+	}))
+	defer server.Close()
+
+	sink := &crab.ObjectStoreSink{
+		Endpoint:  server.URL,
+		Region:    "us-east-1",
+		Bucket:    "crab-outputs",
+		Prefix:    "runs",
+		AccessKey: "AKIDEXAMPLE",
+		SecretKey: "secret",
+		SSE:       "AES256",
+	}
+
+	runTime := time.Date(2024, 3, 5, 10, 30, 0, 0, time.UTC)
+	keys, err := sink.UploadRunOutputs(dir, runTime)
+	if err != nil {
+		t.Fatalf("UploadRunOutputs() error = %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("UploadRunOutputs() uploaded %v, want sitemap and dataset only", keys)
+	}
+
+	req, ok := uploaded["/crab-outputs/runs/2024/03/05/20240305T103000Z/siteMap.json"]
+	if !ok {
+		t.Fatalf("sitemap not uploaded under date partitioned key, got %v", keys)
+	}
+	if req.Header.Get("x-amz-server-side-encryption") != "AES256" {
+		t.Errorf("missing server-side encryption header")
+	}
+	if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+		t.Errorf("request not signed: %q", req.Header.Get("Authorization"))
+	}
+}
+
+func TestRunFinishUploadsOutputs(t *testing.T) {
+	var mu sync.Mutex
+	var uploaded []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		uploaded = append(uploaded, r.URL.Path)
+		mu.Unlock()
+	}))
+	defer server.Close()
+	t.Setenv("CRAB_STORAGE_ENDPOINT", server.URL)
+	t.Setenv("CRAB_STORAGE_BUCKET", "crab-outputs")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}})
+	defer crab.SetConfig(crab.Config{})
+
+	run, err := crab.StartRun("scrape")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataset := run.Path("gasoline_data.json")
+	if err := os.WriteFile(dataset, []byte("[]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := run.Finish([]string{dataset}); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(uploaded)
+	if len(uploaded) != 2 || !strings.HasSuffix(uploaded[0], "/gasoline_data.json") || !strings.HasSuffix(uploaded[1], "/manifest.json") {
+		t.Errorf("uploaded %v, want the run's dataset and manifest", uploaded)
+	}
+}
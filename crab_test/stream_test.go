@@ -0,0 +1,72 @@
+package crab_test
+
+import (
+	"bytes"
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStreamWriter(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{crab.StreamJSONLines, "{\"n\":1}\n{\"n\":2}\n"},
+		{crab.StreamJSONArray, `[{"n":1},{"n":2}]`},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		s, err := crab.NewStreamWriter(&buf, tt.format)
+		if err != nil {
+			t.Fatalf("NewStreamWriter(%s) error = %v", tt.format, err)
+		}
+		s.Write(map[string]int{"n": 1})
+		if tt.format == crab.StreamJSONArray && buf.String() != `[{"n":1}` {
+			t.Errorf("array stream not flushed after first value: %q", buf.String())
+		}
+		s.Write(map[string]int{"n": 2})
+		if err := s.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s stream = %q, want %q", tt.format, buf.String(), tt.want)
+		}
+	}
+
+	if _, err := crab.NewStreamWriter(&bytes.Buffer{}, "xml"); err == nil {
+		t.Errorf("NewStreamWriter(xml) error = nil, want error")
+	}
+}
+
+func TestCreateStreamSiteMap(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "siteMap.json")
+	s, err := crab.CreateStream(filename, crab.StreamJSONObject)
+	if err != nil {
+		t.Fatalf("CreateStream() error = %v", err)
+	}
+	if err := s.Write("no key"); err == nil {
+		t.Errorf("Write() on object stream error = nil, want error")
+	}
+	s.WriteEntry("http://a.com/", []string{})
+	s.WriteEntry("http://b.com/", []string{"http://b.com/1"})
+	s.WriteEntry("http://a.com/", []string{"http://a.com/1"})
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	siteMap, err := crab.LoadSiteMap(filename)
+	if err != nil {
+		t.Fatalf("LoadSiteMap() error = %v", err)
+	}
+	want := map[string][]string{"http://a.com/": {"http://a.com/1"}, "http://b.com/": {"http://b.com/1"}}
+	if !reflect.DeepEqual(siteMap, want) {
+		t.Errorf("sitemap = %v, want %v", siteMap, want)
+	}
+	if data, _ := os.ReadFile(filename); !json.Valid(data) {
+		t.Errorf("sitemap is not valid JSON: %s", data)
+	}
+}
@@ -0,0 +1,67 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"github.com/PuerkitoBio/goquery"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func tableDocument(t *testing.T, html string) *goquery.Document {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestExtractInflationDataTranslatedHeaders(t *testing.T) {
+	// German headers, the average first and a thead
+	doc := tableDocument(t, `<table><thead><tr><th>Durchschnitt</th><th>Jahr</th><th>Januar</th><th>Feb.</th><th>März</th>
+		<th>April</th><th>Mai</th><th>Juni</th><th>Juli</th><th>Aug.</th><th>Sept.</th><th>Okt.</th><th>Nov.</th><th>Dez.</th></tr></thead>
+		<tbody><tr><td>4,1</td><td>2023</td><td>6,4</td><td>6,0</td><td>5,0</td><td>4,9</td><td>4,0</td><td>3,0</td><td>3,2</td>
+		<td>3,7</td><td>3,7</td><td>3,2</td><td>3,1</td><td>3,4</td></tr></tbody></table>`)
+	want := []crab.YearData{{Year: "2023", Jan: "6,4", Feb: "6,0", Mar: "5,0", Apr: "4,9", May: "4,0", Jun: "3,0",
+		July: "3,2", Aug: "3,7", Sept: "3,7", Oct: "3,2", Nov: "3,1", Dec: "3,4", Avg: "4,1"}}
+	if got := crab.ExtractInflationData(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractInflationData() = %+v, want %+v", got, want)
+	}
+}
+
+func TestExtractGasolineDataReorderedHeaders(t *testing.T) {
+	doc := tableDocument(t, `<table><tbody><tr><td>Precio ajustado por inflación</td><td>Año</td><td>IPC</td></tr>
+		<tr><td>$3.96</td><td>2021</td><td>289.5</td></tr></tbody></table>`)
+	want := []crab.GasolineData{{Year: "2021", AverageAnnualCPIForGas: "289.5", GasPricesAdjustedForInfl: "$3.96"}}
+	if got := crab.ExtractGasolineData(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractGasolineData() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMapTableHeaders(t *testing.T) {
+	columns, ok := crab.MapTableHeaders("inflation", []string{"Année", "janv.", "FÉVR", "Moyenne", "Notes"})
+	if want := []string{"year", "jan", "feb", "avg", ""}; !ok || !reflect.DeepEqual(columns, want) {
+		t.Errorf("MapTableHeaders() = %q, %v, want %q", columns, ok, want)
+	}
+	if _, ok := crab.MapTableHeaders("inflation", []string{"Rok", "Styczeń", "Luty"}); ok {
+		t.Error("MapTableHeaders() of Polish headers recognized them")
+	}
+	if _, ok := crab.MapTableHeaders("inflation", []string{"Year", "Year", "Year"}); ok {
+		t.Error("MapTableHeaders() of one column repeated recognized them")
+	}
+
+	crab.SetConfig(crab.Config{TableHeaders: map[string]map[string][]string{"inflation": {"year": {"Rok"}, "jan": {"Styczeń"}}}})
+	defer crab.SetConfig(crab.Config{})
+	if columns, ok := crab.MapTableHeaders("inflation", []string{"Rok", "Styczeń", "Luty"}); !ok || columns[1] != "jan" {
+		t.Errorf("MapTableHeaders() with configured names = %q, %v", columns, ok)
+	}
+}
+
+func TestExtractInflationDataUnknownHeaders(t *testing.T) {
+	// Headers it cannot read leave the columns in the order of the site's table
+	doc := tableDocument(t, `<table><tbody><tr><td>Rok</td><td>Sty</td></tr><tr><td>2023</td><td>6.4</td></tr></tbody></table>`)
+	if got := crab.ExtractInflationData(doc); len(got) != 1 || got[0].Year != "2023" || got[0].Jan != "6.4" {
+		t.Errorf("ExtractInflationData() = %+v", got)
+	}
+}
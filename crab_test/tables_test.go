@@ -0,0 +1,99 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const multiTablePage = `<html><body>
+	<h2>Annual averages</h2>
+	<div><table><tr><th>Year</th><th>Annual Average</th></tr><tr><td>2022</td><td>8.0</td></tr><tr><td>2023</td><td>4.1</td></tr></table></div>
+	<table><caption>Monthly rates, 2023</caption>
+		<thead><tr><th>Month</th><th>Rate</th><th>Rate</th><th></th></tr></thead>
+		<tbody><tr><td>Jan</td><td>6.4</td><td>6.3</td><td>p</td></tr><tr><td>Feb</td><td> 6.0 </td></tr></tbody></table>
+	</body></html>`
+
+func TestFindTable(t *testing.T) {
+	doc := tableDocument(t, multiTablePage)
+	annual, err := crab.FindTable(doc, crab.NamedTable{Name: "annual", Title: "annual"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{{"year": "2022", "annual_average": "8.0"}, {"year": "2023", "annual_average": "4.1"}}
+	if got := crab.ExtractTableRecords(annual); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractTableRecords(annual) = %v, want %v", got, want)
+	}
+
+	monthly, err := crab.FindTable(doc, crab.NamedTable{Name: "monthly", Title: "Monthly Rates"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []map[string]interface{}{
+		{"month": "Jan", "rate": "6.4", "rate_2": "6.3", "column_4": "p"},
+		{"month": "Feb", "rate": "6.0", "rate_2": "", "column_4": ""},
+	}
+	if got := crab.ExtractTableRecords(monthly); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractTableRecords(monthly) = %v, want %v", got, want)
+	}
+	if second, err := crab.FindTable(doc, crab.NamedTable{Name: "second", Index: 1}); err != nil || second.Find("caption").Length() != 1 {
+		t.Errorf("FindTable() at index 1 = %v, want the monthly table", err)
+	}
+	if _, err := crab.FindTable(doc, crab.NamedTable{Name: "weekly", Title: "weekly"}); err == nil {
+		t.Error("FindTable() of a missing table succeeded")
+	}
+}
+
+func TestRunTableTarget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(multiTablePage))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}, TableTargets: []crab.TableTarget{{Name: "rates", URL: server.URL,
+		Tables: []crab.NamedTable{{Name: "annual_rates", Title: "Annual"}, {Name: "monthly", Title: "Monthly", Output: "monthly_rates.json"}}}}})
+	defer crab.SetConfig(crab.Config{})
+
+	info, ok := crab.LookupScraper("rates")
+	if !ok || info.Kind != "tables" || info.Output != "annual_rates_data.json,monthly_rates.json" {
+		t.Errorf("LookupScraper() = %+v, %v", info, ok)
+	}
+	if err := crab.RunScraper("rates"); err != nil {
+		t.Fatalf("RunScraper() failed: %v", err)
+	}
+	runs, err := crab.ListRuns(dir)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("ListRuns() = %v, %v, want one run", runs, err)
+	}
+	for file, rows := range map[string]int{"annual_rates_data.json": 2, "monthly_rates.json": 2} {
+		var records []map[string]interface{}
+		raw, err := os.ReadFile(filepath.Join(dir, runs[0], file))
+		if err == nil {
+			err = json.Unmarshal(raw, &records)
+		}
+		if err != nil || len(records) != rows {
+			t.Errorf("%s = %v, %v, want %d records", file, records, err, rows)
+		}
+	}
+
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}, TableTargets: []crab.TableTarget{{Name: "rates", URL: server.URL,
+		Tables: []crab.NamedTable{{Name: "annual", Title: "Annual"}, {Name: "weekly", Title: "Weekly"}}}}})
+	if err := crab.RunScraper("rates"); err == nil {
+		t.Error("RunScraper() with a missing table succeeded")
+	}
+}
+
+func TestExtractInflationDataPicksKnownTable(t *testing.T) {
+	doc := tableDocument(t, `<table><tr><th>Country</th><th>Rate</th></tr><tr><td>Canada</td><td>3.9</td></tr></table>
+		<table><tr><th>Year</th><th>Jan</th><th>Feb</th><th>Avg</th></tr><tr><td>2023</td><td>6.4</td><td>6.0</td><td>4.1</td></tr></table>`)
+	want := []crab.YearData{{Year: "2023", Jan: "6.4", Feb: "6.0", Avg: "4.1"}}
+	if got := crab.ExtractInflationData(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("ExtractInflationData() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,128 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSnapshotStore keeps snapshots in memory.
+type recordingSnapshotStore struct {
+	mu        sync.Mutex
+	snapshots []crab.Snapshot
+}
+
+func (s *recordingSnapshotStore) SaveSnapshot(snapshot crab.Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snapshots = append(s.snapshots, snapshot)
+	return nil
+}
+
+func (s *recordingSnapshotStore) ListSnapshots(string) ([]crab.Snapshot, error) { return nil, nil }
+
+func (s *recordingSnapshotStore) LoadSnapshot(string, time.Time) (crab.Snapshot, error) {
+	return crab.Snapshot{}, nil
+}
+
+type exportedSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Attributes   []struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	} `json:"attributes"`
+}
+
+func TestCrawlTelemetry(t *testing.T) {
+	var mu sync.Mutex
+	var spans []exportedSpan
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []exportedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("export request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Errorf("decoding export: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rs := range batch.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+	site := testsite.New(testsite.Config{Pages: 2})
+	defer site.Close()
+
+	store := &recordingSnapshotStore{}
+	crab.SetSnapshotStore(store)
+	defer crab.SetSnapshotStore(nil)
+	crab.SetConfig(crab.Config{
+		Output:    crab.OutputConfig{Dir: t.TempDir()},
+		Snapshots: crab.SnapshotConfig{Enabled: true},
+		Telemetry: crab.TelemetryConfig{Endpoint: collector.URL + "/v1/traces"},
+	})
+	defer crab.SetConfig(crab.Config{})
+
+	crab.ThreadedCrawl([]crab.URLData{{URL: site.PageURL(0)}}, 10)
+
+	mu.Lock()
+	defer mu.Unlock()
+	byName := map[string]exportedSpan{}
+	for _, span := range spans {
+		byName[span.Name] = span
+	}
+	root, page, fetch, extract := byName["crawl"], byName["crawl.page"], byName["fetch"], byName["extract"]
+	if root.SpanID == "" || page.SpanID == "" || fetch.SpanID == "" || extract.SpanID == "" {
+		t.Fatalf("exported spans = %+v, want crawl, crawl.page, fetch and extract", spans)
+	}
+	for _, span := range spans {
+		if span.TraceID != root.TraceID {
+			t.Errorf("span %s is in trace %s, want the run's trace %s", span.Name, span.TraceID, root.TraceID)
+		}
+	}
+	if root.ParentSpanID != "" || page.ParentSpanID != root.SpanID || fetch.ParentSpanID != page.SpanID || extract.ParentSpanID != page.SpanID {
+		t.Errorf("span tree is wrong: %+v", spans)
+	}
+
+	if len(store.snapshots) != 1 {
+		t.Fatalf("stored %d snapshots, want 1", len(store.snapshots))
+	}
+	if got := crab.ParseTraceParent(store.snapshots[0].TraceParent); got.SpanID != page.SpanID || got.TraceID != root.TraceID {
+		t.Errorf("snapshot traceparent = %q, want the page span %s", store.snapshots[0].TraceParent, page.SpanID)
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	sc := crab.ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if sc.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID != "00f067aa0ba902b7" {
+		t.Errorf("ParseTraceParent() = %+v", sc)
+	}
+	if sc.TraceParent() != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("TraceParent() = %q", sc.TraceParent())
+	}
+	for _, bad := range []string{"", "00-xyz-00f067aa0ba902b7-01", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"} {
+		if sc := crab.ParseTraceParent(bad); sc.IsValid() {
+			t.Errorf("ParseTraceParent(%q) = %+v, want the zero context", bad, sc)
+		}
+	}
+	if span := crab.StartSpan(crab.SpanContext{}, "off"); span != nil {
+		t.Error("StartSpan() without an endpoint returned a span")
+	}
+}
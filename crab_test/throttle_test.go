@@ -0,0 +1,68 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"0", 0, true},
+		{"-5", 0, false},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := crab.ParseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ParseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	th := crab.NewThrottle()
+	if d := th.Delay("example.com"); d != 0 {
+		t.Errorf("Delay() before any response = %v, want 0", d)
+	}
+
+	header := http.Header{"Retry-After": {"2"}}
+	th.Observe("example.com", http.StatusTooManyRequests, header)
+	if d := th.Delay("example.com"); d < time.Second || d > 2*time.Second {
+		t.Errorf("Delay() during cooldown = %v, want about 2s", d)
+	}
+	if d := th.Delay("other.com"); d != 0 {
+		t.Errorf("Delay() for unrelated domain = %v, want 0", d)
+	}
+
+	th.Observe("example.com", http.StatusServiceUnavailable, nil)
+	if got := th.Interval("example.com"); got != 2*time.Second {
+		t.Errorf("Interval() after second rejection = %v, want 2s", got)
+	}
+
+	// Successes during the cooldown must not speed the domain back up.
+	th.Observe("example.com", http.StatusOK, nil)
+	if got := th.Interval("example.com"); got != 2*time.Second {
+		t.Errorf("Interval() after success in cooldown = %v, want 2s", got)
+	}
+
+	th.Observe("fast.com", http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}})
+	th.Observe("fast.com", http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}})
+	for _, want := range []time.Duration{time.Second, 0} {
+		time.Sleep(time.Millisecond)
+		th.Observe("fast.com", http.StatusOK, nil)
+		if got := th.Interval("fast.com"); got != want {
+			t.Errorf("Interval() while ramping up = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCrawlTrace(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 3})
+	defer site.Close()
+	dir := t.TempDir()
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}, Trace: crab.TraceConfig{Enabled: true}})
+	defer crab.SetConfig(crab.Config{})
+
+	crab.ThreadedCrawl([]crab.URLData{{URL: site.PageURL(0)}, {URL: site.PageURL(1)}}, 10)
+
+	runs, err := crab.ListRuns(dir)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("ListRuns() = %v, %v", runs, err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, runs[0], "trace.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace struct {
+		TraceEvents []crab.TraceEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(data, &trace); err != nil {
+		t.Fatalf("decoding trace: %v", err)
+	}
+
+	counts := map[string]int{}
+	urls := map[string]bool{}
+	for _, event := range trace.TraceEvents {
+		if event.Phase != "X" || event.Duration < 0 || event.Timestamp < 0 {
+			t.Errorf("malformed event %+v", event)
+		}
+		counts[event.Name]++
+		if event.Name == "request" {
+			urls[event.Args["url"].(string)] = true
+			if event.Args["status"] != float64(200) {
+				t.Errorf("request event args = %v, want status 200", event.Args)
+			}
+		}
+	}
+	for _, name := range []string{"request", "connect", "ttfb", "download", "parse", "store"} {
+		if counts[name] < 2 {
+			t.Errorf("trace has %d %q events, want one per page (events: %v)", counts[name], name, counts)
+		}
+	}
+	if !urls[site.PageURL(0)] || !urls[site.PageURL(1)] {
+		t.Errorf("traced URLs = %v", urls)
+	}
+}
+
+func TestConcurrentCrawlTraces(t *testing.T) {
+	sites := []*testsite.Site{testsite.New(testsite.Config{Pages: 6}), testsite.New(testsite.Config{Pages: 6})}
+	dirs := []string{t.TempDir(), t.TempDir()}
+	var wg sync.WaitGroup
+	for i := range sites {
+		defer sites[i].Close()
+		config := crab.Config{Output: crab.OutputConfig{Dir: dirs[i]}, Trace: crab.TraceConfig{Enabled: true}}
+		var urls []crab.URLData
+		for page := 0; page < 6; page++ {
+			urls = append(urls, crab.URLData{URL: sites[i].PageURL(page)})
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			crab.CrawlWithConfig(context.Background(), func() crab.Config { return config }, urls, 2)
+		}()
+	}
+	wg.Wait()
+
+	for i, dir := range dirs {
+		runs, err := crab.ListRuns(dir)
+		if err != nil || len(runs) != 1 {
+			t.Fatalf("ListRuns() = %v, %v", runs, err)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, runs[0], "trace.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var trace struct {
+			TraceEvents []crab.TraceEvent `json:"traceEvents"`
+		}
+		if err := json.Unmarshal(data, &trace); err != nil {
+			t.Fatalf("decoding trace: %v", err)
+		}
+		urls := map[string]bool{}
+		for _, event := range trace.TraceEvents {
+			if event.Name == "request" {
+				url := event.Args["url"].(string)
+				if !strings.HasPrefix(url, sites[i].URL) {
+					t.Errorf("trace of crawl %d has a request of the other crawl: %s", i, url)
+				}
+				urls[url] = true
+			}
+		}
+		if len(urls) != 6 {
+			t.Errorf("trace of crawl %d has %d URLs, want 6: %v", i, len(urls), urls)
+		}
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *crab.Tracer
+	tracer.Region("store", "x")()
+	if events := tracer.Events(); events != nil {
+		t.Errorf("nil tracer recorded %v", events)
+	}
+}
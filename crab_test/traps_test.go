@@ -0,0 +1,149 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"context"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTrapDetector(t *testing.T) {
+	traps := crab.NewTrapDetector(crab.TrapConfig{Enabled: true, MaxURLLength: 100, MaxPagesPerDirectory: 3})
+	future := time.Now().Year() + 5
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com/", ""},
+		{"https://example.com/a/b/a/b/a/b/page", ""},
+		{"https://example.com/a/b/a/b/a/b/a/b/page", crab.TrapRepeatedSegments},
+		{"https://example.com/search?q=" + strings.Repeat("x", 100), crab.TrapURLLength},
+		{fmt.Sprintf("https://example.com/blog/%d/03/", time.Now().Year()-3), ""},
+		{fmt.Sprintf("https://example.com/events/%d/01/", future), crab.TrapCalendar},
+		{fmt.Sprintf("https://example.com/calendar?month=%d-02", future), crab.TrapCalendar},
+		{fmt.Sprintf("https://example.com/calendar?year=%d", future), crab.TrapCalendar},
+		{"https://example.com/calendar?date=1950-07-01", crab.TrapCalendar},
+		{"https://example.com/products/1234-567", ""},
+		{"https://example.com/list?page=1", ""},
+		{"https://example.com/list?page=2", ""},
+		{"https://example.com/list?page=2", ""},
+		{"https://example.com/list?page=3", crab.TrapDirectoryCap},
+		{"https://other.example.com/list?page=3", ""},
+	}
+	for _, test := range tests {
+		if trap := traps.Check(test.url); trap != test.want {
+			t.Errorf("Check(%s) = %q, want %q", test.url, trap, test.want)
+		}
+	}
+	want := map[string]map[string]int{"example.com": {
+		crab.TrapRepeatedSegments: 1,
+		crab.TrapURLLength:        1,
+		crab.TrapCalendar:         4,
+		crab.TrapDirectoryCap:     1,
+	}}
+	if detections := traps.Detections(); !reflect.DeepEqual(detections, want) {
+		t.Errorf("Detections() = %v, want %v", detections, want)
+	}
+	if trap := (*crab.TrapDetector)(nil).Check("https://example.com/a/a/a/a/a"); trap != "" {
+		t.Errorf("Check() of a nil detector = %q", trap)
+	}
+
+	older := crab.NewTrapDetector(crab.TrapConfig{Enabled: true, FirstCalendarYear: 1913})
+	if trap := older.Check("https://example.com/calendar?date=1950-07-01"); trap != "" {
+		t.Errorf("Check() of 1950 from 1913 on = %q, want none", trap)
+	}
+	if trap := older.Check("https://example.com/calendar?year=1912"); trap != crab.TrapCalendar {
+		t.Errorf("Check() of 1912 from 1913 on = %q, want %q", trap, crab.TrapCalendar)
+	}
+}
+
+func TestCrawlSkipsTraps(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 5})
+	defer site.Close()
+	crab.SetConfig(crab.Config{
+		Output: crab.OutputConfig{Dir: t.TempDir()},
+		Traps:  crab.TrapConfig{Enabled: true, MaxPagesPerDirectory: 3},
+	})
+	defer crab.SetConfig(crab.Config{})
+
+	urls := []crab.URLData{{URL: site.URL + "/x/x/x/x/x"}}
+	for i := 0; i < 5; i++ {
+		urls = append(urls, crab.URLData{URL: site.PageURL(i)})
+	}
+	summary := crab.Crawl(context.Background(), urls, 2)
+	siteURL, _ := url.Parse(site.URL)
+	want := map[string]map[string]int{siteURL.Hostname(): {crab.TrapRepeatedSegments: 1, crab.TrapDirectoryCap: 2}}
+	if !reflect.DeepEqual(summary.Traps, want) {
+		t.Errorf("Crawl() traps = %v, want %v", summary.Traps, want)
+	}
+	if summary.Pages != 3 || summary.Statuses[crab.StatusTrap] != 3 {
+		t.Errorf("Crawl() = %d pages, statuses %v, want 3 pages and 3 traps", summary.Pages, summary.Statuses)
+	}
+	if requests := len(site.Requests()); requests != 3 {
+		t.Errorf("the site got %d requests, want 3", requests)
+	}
+}
+
+func TestCrawlLetsBackfilledYearsThrough(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 1})
+	defer site.Close()
+	crab.SetConfig(crab.Config{
+		Output:   crab.OutputConfig{Dir: t.TempDir()},
+		Traps:    crab.TrapConfig{Enabled: true},
+		Backfill: map[string]crab.BackfillConfig{"cpi": {}},
+	})
+	defer crab.SetConfig(crab.Config{})
+
+	urls := []crab.URLData{{URL: site.URL + "/cpi/1913/01/"}, {URL: site.URL + "/cpi/1912/01/"}}
+	summary := crab.Crawl(context.Background(), urls, 1)
+	siteURL, _ := url.Parse(site.URL)
+	if want := map[string]map[string]int{siteURL.Hostname(): {crab.TrapCalendar: 1}}; !reflect.DeepEqual(summary.Traps, want) {
+		t.Errorf("Crawl() traps = %v, want only the year before the backfill caught", summary.Traps)
+	}
+}
+
+func TestConcurrentCrawlsKeepTheirTraps(t *testing.T) {
+	// Slow pages keep the two crawls running at the same time
+	slow := map[string]time.Duration{"/page/0": 50 * time.Millisecond, "/page/1": 50 * time.Millisecond}
+	trapped, plain := testsite.New(testsite.Config{Pages: 5, Slow: slow}), testsite.New(testsite.Config{Pages: 5, Slow: slow})
+	defer trapped.Close()
+	defer plain.Close()
+	crawl := func(site *testsite.Site, traps crab.TrapConfig) crab.RunSummary {
+		config := crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}, Traps: traps}
+		var urls []crab.URLData
+		for i := 0; i < 5; i++ {
+			urls = append(urls, crab.URLData{URL: site.PageURL(i)})
+		}
+		return crab.CrawlWithConfig(context.Background(), func() crab.Config { return config }, urls, 2)
+	}
+
+	var wg sync.WaitGroup
+	var withTraps, withoutTraps crab.RunSummary
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		withTraps = crawl(trapped, crab.TrapConfig{Enabled: true, MaxPagesPerDirectory: 3})
+	}()
+	go func() {
+		defer wg.Done()
+		withoutTraps = crawl(plain, crab.TrapConfig{})
+	}()
+	wg.Wait()
+
+	if withTraps.Pages != 3 || withTraps.Statuses[crab.StatusTrap] != 2 {
+		t.Errorf("crawl with traps = %d pages, statuses %v, want 3 pages and 2 traps", withTraps.Pages, withTraps.Statuses)
+	}
+	siteURL, _ := url.Parse(trapped.URL)
+	if want := map[string]map[string]int{siteURL.Hostname(): {crab.TrapDirectoryCap: 2}}; !reflect.DeepEqual(withTraps.Traps, want) {
+		t.Errorf("crawl with traps reported %v, want %v", withTraps.Traps, want)
+	}
+	if withoutTraps.Pages != 5 || withoutTraps.Traps != nil {
+		t.Errorf("crawl without traps = %d pages, traps %v, want 5 pages and none", withoutTraps.Pages, withoutTraps.Traps)
+	}
+}
@@ -0,0 +1,108 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/internal/testsite"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestURLGuardCheckURL(t *testing.T) {
+	guard := crab.URLGuardConfig{Enabled: true, Allow: []string{"10.1.0.0/16", "*.intranet.example.com", "fd00::1"}}
+	tests := []struct {
+		url     string
+		blocked bool
+	}{
+		{"http://93.184.216.34/", false},
+		{"https://[2606:4700::1111]/", false},
+		{"file:///etc/passwd", true},
+		{"gopher://93.184.216.34/", true},
+		{"http://127.0.0.1:8080/admin", true},
+		{"http://[::1]/", true},
+		{"http://10.0.0.1/", true},
+		{"http://192.168.1.1/", true},
+		{"http://169.254.169.254/latest/meta-data/", true},
+		{"http://100.100.100.200/latest/meta-data/", true},
+		{"http://[fd00:ec2::254]/", true},
+		{"http://metadata.google.internal/computeMetadata/v1/", true},
+		{"http://0.0.0.0/", true},
+		{"http://10.1.2.3/", false},
+		{"http://[fd00::1]/", false},
+		{"http://wiki.intranet.example.com/", false},
+	}
+	for _, test := range tests {
+		err := guard.CheckURL(context.Background(), test.url)
+		if (err != nil) != test.blocked {
+			t.Errorf("CheckURL(%s) = %v, want blocked %v", test.url, err, test.blocked)
+		}
+	}
+}
+
+func TestURLGuardBlocksCrawl(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 1})
+	defer site.Close()
+	// A page that redirects to a cloud metadata endpoint
+	redirect := httptest.NewServer(http.RedirectHandler("http://metadata.google.internal/computeMetadata/v1/", http.StatusFound))
+	defer redirect.Close()
+
+	crab.SetConfig(crab.Config{URLGuard: crab.URLGuardConfig{Enabled: true}})
+	defer crab.SetConfig(crab.Config{})
+	if result := crab.ParsePage(crab.FetchPage(crab.URLData{URL: site.PageURL(0)})); result.Status != crab.StatusBlocked {
+		t.Errorf("ParsePage() of an internal page = %+v, want blocked", result)
+	}
+	if err := crab.CheckTargetURLs([]string{"http://93.184.216.34/", site.PageURL(0)}); err == nil {
+		t.Errorf("CheckTargetURLs() of an internal page succeeded")
+	}
+	queue := crab.NewJobQueue(crab.NewMemoryJobStore())
+	queue.Register("crawl", func(ctx context.Context, job crab.Job) error { return nil })
+	if _, err := queue.Enqueue("crawl", map[string]string{"urls": "http://93.184.216.34/, " + site.PageURL(0)}); err == nil {
+		t.Errorf("Enqueue() of a crawl of an internal page succeeded")
+	}
+
+	if site.Count("/page/0") != 0 {
+		t.Fatalf("the internal page was fetched before it was allowed")
+	}
+
+	// Allowing the loopback addresses lets the site through, but where its redirects lead is still checked
+	crab.SetConfig(crab.Config{URLGuard: crab.URLGuardConfig{Enabled: true, Allow: []string{"127.0.0.0/8", "::1"}}})
+	if result := crab.ParsePage(crab.FetchPage(crab.URLData{URL: site.PageURL(0)})); result.Status != crab.StatusFetched {
+		t.Errorf("ParsePage() of an allowed internal page = %+v, want fetched", result)
+	}
+	if result := crab.ParsePage(crab.FetchPage(crab.URLData{URL: redirect.URL})); result.Status != crab.StatusBlocked {
+		t.Errorf("ParsePage() of a redirect to a metadata endpoint = %+v, want blocked", result)
+	}
+
+	crab.SetConfig(crab.Config{URLGuard: crab.URLGuardConfig{}})
+	if result := crab.ParsePage(crab.FetchPage(crab.URLData{URL: site.PageURL(0)})); result.Status != crab.StatusFetched {
+		t.Errorf("ParsePage() without the guard = %+v, want fetched", result)
+	}
+}
+
+func TestURLGuardOfTheCrawl(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 1})
+	defer site.Close()
+	seeds := []crab.URLData{{URL: site.PageURL(0)}}
+
+	// A crawl without a guard of its own fetches the internal page the process would refuse
+	crab.SetConfig(crab.Config{URLGuard: crab.URLGuardConfig{Enabled: true}})
+	defer crab.SetConfig(crab.Config{})
+	open := crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}}
+	summary := crab.CrawlWithConfig(context.Background(), func() crab.Config { return open }, seeds, 1)
+	if summary.Statuses[crab.StatusFetched] != 1 {
+		t.Errorf("unguarded crawl statuses = %v, want the page fetched", summary.Statuses)
+	}
+
+	// And a guarded crawl refuses it while the process lets it through
+	crab.SetConfig(crab.Config{})
+	guarded := open
+	guarded.URLGuard.Enabled = true
+	summary = crab.CrawlWithConfig(context.Background(), func() crab.Config { return guarded }, seeds, 1)
+	if summary.Statuses[crab.StatusBlocked] != 1 {
+		t.Errorf("guarded crawl statuses = %v, want the page blocked", summary.Statuses)
+	}
+	if site.Count("/page/0") != 1 {
+		t.Errorf("the page was fetched %d times, want once, by the unguarded crawl", site.Count("/page/0"))
+	}
+}
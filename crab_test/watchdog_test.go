@@ -0,0 +1,62 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchdogGrowth(t *testing.T) {
+	watchdog := crab.NewWatchdog(crab.WatchdogConfig{Window: 3})
+	start := time.Now()
+	var warnings []string
+	for n := 0; n < 7; n++ {
+		sample := crab.WatchdogSample{Time: start.Add(time.Duration(n) * time.Second), Goroutines: 10 + n, HeapBytes: 1 << 20, OpenFiles: -1}
+		warnings = append(warnings, watchdog.Observe(sample)...)
+	}
+	// Six samples of growth after the first, a warning every three
+	if len(warnings) != 2 || !strings.HasPrefix(warnings[0], "goroutines grew in each of the last 3 samples") {
+		t.Fatalf("warnings = %q, want two for the goroutines", warnings)
+	}
+
+	// A sample that does not grow ends the streak
+	watchdog.Observe(crab.WatchdogSample{Goroutines: 16, HeapBytes: 1 << 20, OpenFiles: -1})
+	if got := watchdog.Observe(crab.WatchdogSample{Goroutines: 17, HeapBytes: 1 << 20, OpenFiles: -1}); len(got) != 0 {
+		t.Errorf("warnings after the streak ended = %q, want none", got)
+	}
+}
+
+func TestWatchdogLimitProfiles(t *testing.T) {
+	dir := t.TempDir()
+	watchdog := crab.NewWatchdog(crab.WatchdogConfig{MaxGoroutines: 100, MaxHeapMB: 1 << 20, Profiles: true, ProfileDir: dir})
+	if got := watchdog.Observe(crab.WatchdogSample{Goroutines: 50, OpenFiles: -1}); len(got) != 0 {
+		t.Fatalf("warnings under the limits = %q, want none", got)
+	}
+	got := watchdog.Observe(crab.WatchdogSample{Goroutines: 150, OpenFiles: -1})
+	if len(got) != 1 || got[0] != "goroutines at 150, over the limit of 100" {
+		t.Fatalf("warnings = %q, want the goroutine limit", got)
+	}
+	for _, name := range []string{"goroutine", "heap"} {
+		if profiles, _ := filepath.Glob(filepath.Join(dir, name+"-*.pprof")); len(profiles) != 1 {
+			t.Errorf("%s profiles = %v, want one", name, profiles)
+		}
+	}
+
+	// Staying over the limit warns once, crossing it again warns again
+	if got := watchdog.Observe(crab.WatchdogSample{Goroutines: 140, OpenFiles: -1}); len(got) != 0 {
+		t.Errorf("warnings still over the limit = %q, want none", got)
+	}
+	watchdog.Observe(crab.WatchdogSample{Goroutines: 60, OpenFiles: -1})
+	if got := watchdog.Observe(crab.WatchdogSample{Goroutines: 120, OpenFiles: -1}); len(got) != 1 {
+		t.Errorf("warnings crossing the limit again = %q, want one", got)
+	}
+}
+
+func TestTakeWatchdogSample(t *testing.T) {
+	sample := crab.TakeWatchdogSample()
+	if sample.Goroutines <= 0 || sample.HeapBytes == 0 || sample.OpenFiles == 0 {
+		t.Errorf("sample = %+v, want the goroutines, heap and open files of the test", sample)
+	}
+}
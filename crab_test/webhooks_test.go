@@ -0,0 +1,59 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNotifyWebhooks(t *testing.T) {
+	var slackBodies, jsonBodies []map[string]interface{}
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		slackBodies = append(slackBodies, body)
+	}))
+	defer slack.Close()
+	generic := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		jsonBodies = append(jsonBodies, body)
+	}))
+	defer generic.Close()
+
+	crab.SetConfig(crab.Config{Webhooks: []crab.WebhookConfig{
+		{URL: slack.URL, Format: "slack", Events: []string{crab.EventFailed}},
+		{URL: generic.URL},
+	}})
+	defer crab.SetConfig(crab.Config{})
+
+	start := time.Now()
+	summary := crab.RunSummary{Event: crab.EventCompleted, Kind: "scrape", Name: "books", StartedAt: start, FinishedAt: start, Items: 20}
+	if err := crab.NotifyWebhooks(summary); err != nil {
+		t.Fatalf("NotifyWebhooks() error = %v", err)
+	}
+
+	summary.Event = crab.EventFailed
+	summary.Error = "status 503"
+	if err := crab.NotifyWebhooks(summary); err != nil {
+		t.Fatalf("NotifyWebhooks() error = %v", err)
+	}
+
+	if len(jsonBodies) != 2 {
+		t.Errorf("generic webhook got %d calls, want 2", len(jsonBodies))
+	} else if jsonBodies[0]["name"] != "books" || jsonBodies[0]["items"] != float64(20) {
+		t.Errorf("generic webhook payload = %v", jsonBodies[0])
+	}
+
+	if len(slackBodies) != 1 {
+		t.Fatalf("slack webhook got %d calls, want only the failure", len(slackBodies))
+	}
+	text, _ := slackBodies[0]["text"].(string)
+	if !strings.Contains(text, "books failed") || !strings.Contains(text, "status 503") {
+		t.Errorf("slack text = %q", text)
+	}
+}
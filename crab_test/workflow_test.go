@@ -0,0 +1,210 @@
+package crab_test
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunWorkflow(t *testing.T) {
+	dir := t.TempDir()
+	listings := filepath.Join(dir, "listings.csv")
+	os.WriteFile(listings, []byte("status,bedrooms,bathrooms,house_size,city,price\n"+
+		"for_sale,3,2,\"1,200 sq ft\",Boston,\"$500,000\"\n"+
+		"for_sale,3,2,\"1,200 sq ft\",Boston,\"$500,000\"\n"+
+		"for_sale,4,3,2000,Salem,\n"+
+		"for_sale,studio,1,400,Lynn,$150000\n"), 0644)
+
+	failures := 1
+	crab.RegisterWorkflowStage("test-predict", func(ctx context.Context, run *crab.WorkflowRun, params map[string]string) error {
+		if failures > 0 {
+			failures--
+			run.Dataset.Rows = nil // Undone when the attempt fails
+			return errors.New("backend unavailable")
+		}
+		inputs, err := run.FeatureInputs()
+		if err != nil {
+			return err
+		}
+		return run.AddColumn("prediction", inputs)
+	})
+	crab.RegisterWorkflowStage("test-fail", func(ctx context.Context, run *crab.WorkflowRun, params map[string]string) error {
+		return errors.New("always fails")
+	})
+	report := filepath.Join(dir, "report.json")
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}, Workflows: map[string]crab.WorkflowConfig{
+		"housing-forecast": {Dataset: "housing", Stages: []crab.WorkflowStage{
+			{Type: "import", Params: map[string]string{"file": listings}},
+			{Type: "clean", Params: map[string]string{"numbers": "house_size,price", "required": "price"}},
+			{Type: "features", Params: map[string]string{"columns": "bedrooms,house_size", "keep": "city,price"}},
+			{Type: "test-predict", Name: "predict", OnError: "retry", Retries: 1},
+			{Type: "test-fail", Name: "optional", OnError: "skip"},
+			{Type: "report", Params: map[string]string{"file": report}},
+		}},
+		"broken": {Dataset: "housing", Stages: []crab.WorkflowStage{{Type: "features"}, {Type: "missing"}}},
+	}})
+	defer crab.SetConfig(crab.Config{})
+
+	run, err := crab.RunWorkflow(context.Background(), "housing-forecast")
+	if err != nil {
+		t.Fatalf("RunWorkflow() error = %v", err)
+	}
+	var statuses []string
+	for _, stage := range run.Stages {
+		statuses = append(statuses, stage.Name+":"+stage.Status)
+	}
+	want := []string{"import:succeeded", "clean:succeeded", "features:succeeded", "predict:succeeded", "optional:skipped", "report:succeeded"}
+	if !reflect.DeepEqual(statuses, want) || run.Stages[3].Attempts != 2 {
+		t.Errorf("stages = %v, predict attempts %d, want %v after 2 attempts", statuses, run.Stages[3].Attempts, want)
+	}
+	wantRows := [][]string{{"Boston", "500000", "3", "1200", `{"bedrooms":3,"house_size":1200}`}}
+	if !reflect.DeepEqual(run.Dataset.Rows, wantRows) {
+		t.Errorf("rows = %v, want %v", run.Dataset.Rows, wantRows)
+	}
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written struct {
+		Workflow string
+		Stages   []crab.StageResult
+		Rows     [][]string
+	}
+	if err := json.Unmarshal(data, &written); err != nil || written.Workflow != "housing-forecast" ||
+		len(written.Stages) != 5 || !reflect.DeepEqual(written.Rows, wantRows) {
+		t.Errorf("report = %s, %v", data, err)
+	}
+
+	if _, err := crab.RunWorkflow(context.Background(), "broken"); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("RunWorkflow() with an unknown stage type error = %v", err)
+	}
+	if _, err := crab.RunWorkflow(context.Background(), "unknown"); err == nil {
+		t.Errorf("RunWorkflow() of an unknown workflow succeeded")
+	}
+}
+
+// memoryWorkflowStore keeps workflow run records in memory, as JSON like a database would.
+type memoryWorkflowStore map[string][]byte
+
+func (s memoryWorkflowStore) SaveWorkflowRun(record crab.WorkflowRecord) error {
+	data, err := json.Marshal(record)
+	s[record.RunID] = data
+	return err
+}
+
+func (s memoryWorkflowStore) LoadWorkflowRun(runID string) (crab.WorkflowRecord, error) {
+	var record crab.WorkflowRecord
+	data, ok := s[runID]
+	if !ok {
+		return record, errors.New("no such run")
+	}
+	err := json.Unmarshal(data, &record)
+	return record, err
+}
+
+func TestWorkflowDAG(t *testing.T) {
+	dir := t.TempDir()
+	listings := filepath.Join(dir, "listings.csv")
+	os.WriteFile(listings, []byte("city,price\nBoston,500000\nSalem,300000\n"), 0644)
+
+	// The two branches only finish once both have started, so they must run in parallel
+	started := make(chan string, 2)
+	branch := func(ctx context.Context, run *crab.WorkflowRun, params map[string]string) error {
+		started <- params["value"]
+		for len(started) < 2 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Millisecond):
+			}
+		}
+		run.Values[params["value"]] = "done"
+		return run.SetData(params["value"], len(run.Dataset.Rows))
+	}
+	crab.RegisterWorkflowStage("test-branch", branch)
+	var hang atomic.Bool
+	hang.Store(true)
+	crab.RegisterWorkflowStage("test-join", func(ctx context.Context, run *crab.WorkflowRun, params map[string]string) error {
+		if hang.Load() {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		var left, right int
+		if ok, err := run.GetData("left", &left); !ok || err != nil {
+			return errors.New("no data from the left branch")
+		}
+		if ok, err := run.GetData("right", &right); !ok || err != nil {
+			return errors.New("no data from the right branch")
+		}
+		run.Values["total"] = strings.Repeat("x", left+right)
+		return nil
+	})
+	crab.RegisterWorkflowStage("test-count", func(ctx context.Context, run *crab.WorkflowRun, params map[string]string) error {
+		run.Values["count"] += "x"
+		return nil
+	})
+	crab.SetConfig(crab.Config{Output: crab.OutputConfig{Dir: dir}, Workflows: map[string]crab.WorkflowConfig{
+		"fan-out": {Dataset: "housing", Stages: []crab.WorkflowStage{
+			{Type: "import", Params: map[string]string{"file": listings}},
+			{Type: "test-count", Name: "count"},
+			{Type: "test-branch", Name: "left", Needs: []string{"count"}, Params: map[string]string{"value": "left"}},
+			{Type: "test-branch", Name: "right", Needs: []string{"count"}, Params: map[string]string{"value": "right"}, Timeout: "5s"},
+			{Type: "test-join", Name: "join", Needs: []string{"left", "right"}, Timeout: "50ms"},
+		}},
+		"cycle": {Dataset: "housing", Stages: []crab.WorkflowStage{
+			{Type: "test-count", Name: "a", Needs: []string{"b"}},
+			{Type: "test-count", Name: "b"},
+		}},
+	}})
+	defer crab.SetConfig(crab.Config{})
+	store := memoryWorkflowStore{}
+	crab.SetWorkflowStore(store)
+	defer crab.SetWorkflowStore(nil)
+
+	run, err := crab.RunWorkflow(context.Background(), "fan-out")
+	if err == nil || !strings.Contains(err.Error(), "join") || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("RunWorkflow() error = %v, want the join stage timed out", err)
+	}
+	record, loadErr := store.LoadWorkflowRun(run.RunID)
+	if loadErr != nil || record.Status != crab.WorkflowFailed || len(record.Outputs) != 4 {
+		t.Fatalf("saved run = %+v, %v, want failed with 4 stage outputs", record, loadErr)
+	}
+
+	hang.Store(false)
+	resumed, err := crab.ResumeWorkflow(context.Background(), run.RunID)
+	if err != nil {
+		t.Fatalf("ResumeWorkflow() error = %v", err)
+	}
+	var statuses []string
+	for _, stage := range resumed.Stages {
+		statuses = append(statuses, stage.Name+":"+stage.Status)
+	}
+	want := []string{"import:succeeded", "count:succeeded", "left:succeeded", "right:succeeded", "join:succeeded"}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("resumed stages = %v, want %v", statuses, want)
+	}
+	// The count stage ran once, and the join saw both branches
+	if resumed.RunID != run.RunID || resumed.Values["count"] != "x" || resumed.Values["total"] != "xxxx" ||
+		resumed.Values["left"] != "done" || resumed.Values["right"] != "done" || len(resumed.Dataset.Rows) != 2 {
+		t.Errorf("resumed run = %+v", resumed)
+	}
+	if record, _ := store.LoadWorkflowRun(run.RunID); record.Status != crab.WorkflowSucceeded {
+		t.Errorf("saved status = %s, want succeeded", record.Status)
+	}
+	if _, err := crab.ResumeWorkflow(context.Background(), run.RunID); err == nil {
+		t.Errorf("ResumeWorkflow() of a run that succeeded did not fail")
+	}
+
+	if _, err := crab.RunWorkflow(context.Background(), "cycle"); err == nil || !strings.Contains(err.Error(), "need each other") {
+		t.Errorf("RunWorkflow() of a cycle error = %v", err)
+	}
+}
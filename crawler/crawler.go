@@ -0,0 +1,143 @@
+// Package crawler embeds the crab crawl engine in other Go programs:
+//
+//	summary, err := crawler.New(crawler.Options{Workers: 4}).Run(ctx, []string{"https://books.toscrape.com/"})
+//
+// A run writes the sitemap, crawl report and extracted records of the crawl to a run directory under the
+// configured output directory, exactly like "crab crawl", and returns its summary. Custom extraction is
+// added with crab.RegisterExtractor, or for one Crawler with the script extractors and plugins of its
+// config.
+//
+// The options of a Crawler are its own: a run never changes the crab configuration of the process, which
+// the daemon and job queues go on using, and keeps its trace, trap detection, robots.txt files and spans
+// to itself, so runs of Crawlers in a process go on at once. What a site is owed, such as its rate limit
+// and backoff, is shared by every crawl of the process. A deterministic run reseeds the random source
+// crab's crawls share, so it waits for the other runs of Crawlers to finish, and they wait for it.
+//
+// The other stages of a crawl have packages of their own: scrape runs crab's listing scrapers, store
+// reads the runs and datasets they write, and analyze computes statistics, diffs and reports over them.
+package crawler
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// defaultWorkers is how many pages a crawl fetches at once when Options.Workers is zero.
+const defaultWorkers = 10
+
+// Options configure a Crawler. The zero value crawls with the current crab config, following its reloads,
+// and 10 workers.
+type Options struct {
+	Config        *crab.Config // Settings of the crawl, e.g. from crab.LoadConfig; the current crab config when nil
+	Profile       string       // Configuration profile of Config to crawl with
+	Workers       int          // Pages fetched at once; 10 when zero
+	ParseWorkers  int          // Pages parsed at once; the config's, or one per CPU, when zero
+	Deterministic bool         // Reproduce the same outputs for the same seeds
+	Seed          int64        // Random seed of a deterministic crawl
+	Trace         bool         // Write a per-request timeline to trace.json
+	SEOAudit      bool         // Audit the pages for SEO issues into seo_audit.json
+	SecurityAudit bool         // Audit the security headers of the pages into security_audit.json
+	A11y          bool         // Scan the pages with axe-core into a11y_report.json
+	Certificates  bool         // Record the TLS certificates of the hosts in the crawl report
+	Follow        bool         // Also crawl the links found on the pages, on the seeds' hosts
+	Sitemaps      bool         // Also crawl the pages of the robots.txt sitemaps of the seeds' domains
+	SitemapLimit  int          // Sitemap pages crawled per domain; crab's default when zero
+	Plugins       []string     // Go plugins registering extractors for this Crawler, besides the config's
+}
+
+// Crawler crawls seed URLs with fixed options.
+type Crawler struct {
+	options Options
+}
+
+// New creates a Crawler.
+func New(options Options) *Crawler {
+	return &Crawler{options: options}
+}
+
+// runMu lets runs go on at once, except deterministic ones, which hold it alone while they reseed and
+// draw from crab's shared random source.
+var runMu sync.RWMutex
+
+// Run crawls seeds and returns the summary of the run. It fails without crawling when the options or
+// seeds are invalid, and with the summary of what was crawled when ctx is done first or the outputs could
+// not be written.
+func (c *Crawler) Run(ctx context.Context, seeds []string) (crab.RunSummary, error) {
+	urls := make([]crab.URLData, 0, len(seeds))
+	for _, seed := range seeds {
+		if seed = strings.TrimSpace(seed); seed != "" {
+			urls = append(urls, crab.URLData{URL: seed})
+		}
+	}
+	if len(urls) == 0 {
+		return crab.RunSummary{}, fmt.Errorf("no seeds to crawl")
+	}
+	config := crab.CurrentConfig
+	if c.options.Config != nil {
+		fixed := *c.options.Config
+		config = func() crab.Config { return fixed }
+	}
+	if _, err := config().WithProfile(c.options.Profile); err != nil {
+		return crab.RunSummary{}, err
+	}
+	settings := func() crab.Config { return c.settings(config()) }
+
+	if settings().Deterministic.Enabled {
+		runMu.Lock()
+		defer runMu.Unlock()
+	} else {
+		runMu.RLock()
+		defer runMu.RUnlock()
+	}
+	if c.options.Sitemaps {
+		urls = crab.AddSitemapSeeds(urls, c.options.SitemapLimit)
+	}
+	workers := c.options.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	summary := crab.CrawlWithConfig(ctx, settings, urls, workers)
+	if summary.Error != "" {
+		return summary, fmt.Errorf("%s", summary.Error)
+	}
+	return summary, nil
+}
+
+// settings returns config with the profile and options of the Crawler applied. A profile that went
+// missing from a reloaded config leaves config as it is.
+func (c *Crawler) settings(config crab.Config) crab.Config {
+	if profiled, err := config.WithProfile(c.options.Profile); err == nil {
+		config = profiled
+	}
+	if c.options.Deterministic {
+		config.Deterministic = crab.DeterministicConfig{Enabled: true, Seed: c.options.Seed}
+	}
+	if c.options.Trace {
+		config.Trace.Enabled = true
+	}
+	if c.options.SEOAudit {
+		config.SEOAudit.Enabled = true
+	}
+	if c.options.SecurityAudit {
+		config.SecurityAudit.Enabled = true
+	}
+	if c.options.A11y {
+		config.A11y.Enabled = true
+	}
+	if c.options.Certificates {
+		config.Certificates.Enabled = true
+	}
+	if c.options.Follow {
+		config.Frontier.Follow = true
+	}
+	if c.options.ParseWorkers > 0 {
+		config.Pipeline.ParseWorkers = c.options.ParseWorkers
+	}
+	if len(c.options.Plugins) > 0 {
+		config.ExtractorPlugins = append(append([]string(nil), config.ExtractorPlugins...), c.options.Plugins...)
+	}
+	return config
+}
@@ -0,0 +1,155 @@
+package crawler_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/crawler"
+	"cmpscfa23team2/internal/testsite"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 3, Links: testsite.Tree(3, 2)})
+	defer site.Close()
+	config := crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}}
+
+	summary, err := crawler.New(crawler.Options{Config: &config, Workers: 2}).Run(context.Background(),
+		[]string{site.PageURL(0), site.PageURL(1), " "})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if summary.Event != crab.EventCompleted || summary.Pages != 2 || summary.Items != 2 || summary.RunID == "" {
+		t.Errorf("Run() summary = %+v, want 2 pages with 2 links", summary)
+	}
+	data, err := os.ReadFile(filepath.Join(config.Output.Dir, summary.RunID, "siteMap.json"))
+	var siteMap map[string][]string
+	if err != nil || json.Unmarshal(data, &siteMap) != nil || len(siteMap[site.PageURL(0)]) != 2 {
+		t.Errorf("sitemap = %s, %v", data, err)
+	}
+	if crab.CurrentConfig().Output.Dir == config.Output.Dir {
+		t.Errorf("Run() left its config in place")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	summary, err = crawler.New(crawler.Options{Config: &config}).Run(ctx, []string{site.PageURL(0)})
+	if err == nil || summary.Pages != 0 || summary.Event != crab.EventFailed {
+		t.Errorf("Run() with a cancelled context = %+v, %v", summary, err)
+	}
+	if _, err := crawler.New(crawler.Options{}).Run(context.Background(), nil); err == nil {
+		t.Errorf("Run() without seeds succeeded")
+	}
+	if _, err := crawler.New(crawler.Options{Config: &config}).Run(context.Background(), []string{" ", ""}); err == nil {
+		t.Errorf("Run() with blank seeds succeeded")
+	}
+	if _, err := crawler.New(crawler.Options{Config: &config, Profile: "missing"}).Run(context.Background(), []string{site.URL}); err == nil {
+		t.Errorf("Run() with an unknown profile succeeded")
+	}
+}
+
+func TestRunKeepsItsConfig(t *testing.T) {
+	site := testsite.New(testsite.Config{Pages: 2, Links: testsite.Tree(2, 1)})
+	defer site.Close()
+	config := crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}, ScriptExtractors: []crab.ScriptExtractor{
+		{Name: "titles", Pattern: "127.0.0.1", Fields: []crab.ScriptField{{Name: "title", Expr: "text(find('title'))"}}},
+	}}
+
+	// The process's config stays in place while the crawler runs, for the daemon and job queues
+	var mu sync.Mutex
+	var seen []string
+	probe := crab.ExtractorFunc(func(page *crab.ExtractorPage) ([]map[string]interface{}, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, crab.CurrentConfig().Output.Dir)
+		return nil, nil
+	})
+	if err := crab.RegisterExtractor("config-probe", "127.0.0.1/page/1", probe); err != nil {
+		t.Fatal(err)
+	}
+	defer crab.UnregisterExtractor("config-probe")
+
+	summary, err := crawler.New(crawler.Options{Config: &config, Workers: 1}).Run(context.Background(),
+		[]string{site.PageURL(0), site.PageURL(1)})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(config.Output.Dir, summary.RunID, "extracted.jsonl"))
+	if err != nil || strings.Count(string(data), `"extractor":"titles"`) != 1 {
+		t.Errorf("extracted.jsonl = %s, %v, want the record of the script extractor", data, err)
+	}
+	if len(seen) == 0 {
+		t.Errorf("the registered extractor did not run")
+	}
+	for _, dir := range seen {
+		if dir == config.Output.Dir {
+			t.Errorf("Run() installed its config while crawling")
+		}
+	}
+	if _, ok := crab.Extractors()["titles"]; ok {
+		t.Errorf("Run() left its script extractor registered")
+	}
+
+	config.ScriptExtractors[0].Fields[0].Expr = "text("
+	if _, err := crawler.New(crawler.Options{Config: &config}).Run(context.Background(), []string{site.URL}); err == nil {
+		t.Errorf("Run() with a script extractor that does not compile succeeded")
+	}
+}
+
+func TestRunsGoOnAtOnce(t *testing.T) {
+	// Each page waits for the other crawl to ask for its page, which only happens when both crawl at once
+	var together sync.WaitGroup
+	together.Add(2)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		together.Done()
+		select {
+		case <-waitGroupDone(&together):
+		case <-time.After(5 * time.Second):
+			http.Error(w, "the other crawl never came", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "<html><body>ok</body></html>")
+	}))
+	defer site.Close()
+
+	var runs sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		i := i
+		config := crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}}
+		runs.Add(1)
+		go func() {
+			defer runs.Done()
+			summary, err := crawler.New(crawler.Options{Config: &config, Workers: 1}).Run(context.Background(),
+				[]string{fmt.Sprintf("%s/%d", site.URL, i)})
+			if err == nil && summary.Errors > 0 {
+				err = fmt.Errorf("%d pages failed", summary.Errors)
+			}
+			errs[i] = err
+		}()
+	}
+	runs.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("run %d: %v", i, err)
+		}
+	}
+}
+
+// waitGroupDone returns a channel closed once wg is done.
+func waitGroupDone(wg *sync.WaitGroup) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
@@ -0,0 +1,262 @@
+package dal
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// predictionTables maps the algorithms of InsertPrediction to the tables their predictions are kept in.
+var predictionTables = map[string]string{
+	"KNN":              "knn_predictions",
+	"LinearRegression": "linear_regression_predictions",
+	"NaiveBayes":       "naive_bayes_predictions",
+}
+
+// predictionAlgorithms lists the algorithms in the order their tables are archived.
+var predictionAlgorithms = []string{"KNN", "LinearRegression", "NaiveBayes"}
+
+// predictionTable returns the table the predictions of algorithm are kept in.
+func predictionTable(algorithm string) (string, error) {
+	table, ok := predictionTables[algorithm]
+	if !ok {
+		return "", fmt.Errorf("Unrecognized algorithm: %v", algorithm)
+	}
+	return table, nil
+}
+
+// Function to soft-delete a prediction
+//
+// DeletePrediction marks a prediction as deleted, so it is no longer fetched but stays in its table until
+// it is archived. Deleting a prediction that does not exist, or was deleted already, is an error.
+func DeletePrediction(algorithm, predictionID string) error {
+	return setPredictionDeleted(algorithm, predictionID, true)
+}
+
+// Function to undo a soft-delete
+//
+// RestorePrediction clears the deleted mark of a prediction that has not been archived yet.
+func RestorePrediction(algorithm, predictionID string) error {
+	return setPredictionDeleted(algorithm, predictionID, false)
+}
+
+// setPredictionDeleted sets or clears the deleted_at column of a prediction.
+func setPredictionDeleted(algorithm, predictionID string, deleted bool) error {
+	table, err := predictionTable(algorithm)
+	if err != nil {
+		return err
+	}
+	query := "UPDATE " + table + " SET deleted_at = NOW() WHERE prediction_id = ? AND deleted_at IS NULL"
+	if !deleted {
+		query = "UPDATE " + table + " SET deleted_at = NULL WHERE prediction_id = ? AND deleted_at IS NOT NULL"
+	}
+	result, err := execDB(query, predictionID)
+	if err != nil {
+		InsertLog("400", "Error updating prediction "+predictionID+": "+err.Error(), "setPredictionDeleted()")
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		if deleted {
+			return fmt.Errorf("no %s prediction %s to delete", algorithm, predictionID)
+		}
+		return fmt.Errorf("no deleted %s prediction %s to restore", algorithm, predictionID)
+	}
+	return nil
+}
+
+// ArchiveOptions says which predictions ArchivePredictions moves out of the prediction tables, and where to.
+type ArchiveOptions struct {
+	Before      time.Time // Predictions made, or deleted, before this are archived
+	DeletedOnly bool      // Archive only soft-deleted predictions, however old they are otherwise
+	File        string    // Append them to this gzipped NDJSON file instead of the predictions_archive table
+}
+
+// ArchivedPrediction is a prediction as written to an archive file.
+type ArchivedPrediction struct {
+	Algorithm       string `json:"algorithm"`
+	PredictionID    string `json:"prediction_id"`
+	QueryIdentifier string `json:"query_identifier"`
+	InputData       string `json:"input_data"`
+	PredictionInfo  string `json:"prediction_info"`
+	PredictionTime  string `json:"prediction_time"`
+	DeletedAt       string `json:"deleted_at,omitempty"`
+	ArchivedAt      string `json:"archived_at"`
+}
+
+// Function to archive old predictions
+//
+// ArchivePredictions moves the predictions selected by options out of the prediction tables, keeping them
+// small while preserving their history, and returns how many were moved. Each table is moved in a
+// transaction, so a prediction is never both kept and archived, or lost.
+func ArchivePredictions(options ArchiveOptions) (int, error) {
+	if options.Before.IsZero() {
+		return 0, fmt.Errorf("archive predictions: no cutoff time")
+	}
+	var archive *predictionArchiveFile
+	if options.File != "" {
+		var err error
+		if archive, err = openPredictionArchive(options.File); err != nil {
+			return 0, err
+		}
+		defer archive.Close()
+	}
+
+	archived := 0
+	for _, algorithm := range predictionAlgorithms {
+		n, err := archivePredictionTable(algorithm, options, archive)
+		archived += n
+		if err != nil {
+			InsertLog("400", fmt.Sprintf("Error archiving %s predictions: %s", algorithm, err), "ArchivePredictions()")
+			return archived, err
+		}
+	}
+	if archive != nil {
+		if err := archive.Close(); err != nil {
+			return archived, err
+		}
+	}
+	return archived, nil
+}
+
+// archivePredictionTable moves the selected predictions of one algorithm, in one transaction.
+func archivePredictionTable(algorithm string, options ArchiveOptions, archive *predictionArchiveFile) (int, error) {
+	table, err := predictionTable(algorithm)
+	if err != nil {
+		return 0, err
+	}
+	where := "deleted_at IS NOT NULL AND deleted_at < ?"
+	args := []interface{}{options.Before}
+	if !options.DeletedOnly {
+		where = "(" + where + ") OR prediction_time < ?"
+		args = append(args, options.Before)
+	}
+
+	var tx *sql.Tx
+	if err := withRetry("BEGIN", func() (err error) {
+		tx, err = DB.Begin()
+		return err
+	}); err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if archive == nil {
+		query := "INSERT INTO predictions_archive (prediction_id, algorithm, query_identifier, input_data, prediction_info, " +
+			"prediction_time, deleted_at, archived_at) SELECT prediction_id, ?, query_identifier, input_data, prediction_info, " +
+			"prediction_time, deleted_at, NOW() FROM " + table + " WHERE " + where
+		if _, err := txExec(tx, query, append([]interface{}{algorithm}, args...)...); err != nil {
+			return 0, err
+		}
+	} else if err := archive.writeTable(tx, algorithm, table, where, args); err != nil {
+		return 0, err
+	}
+
+	result, err := txExec(tx, "DELETE FROM "+table+" WHERE "+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if archive != nil {
+		// The rows must be on disk before their deletion is committed
+		if err := archive.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	start := time.Now()
+	err = tx.Commit()
+	observeQuery("COMMIT", start, err)
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// txExec runs a statement in a transaction, timed for the query metrics. It is not retried, as the
+// transaction does not survive the errors worth retrying.
+func txExec(tx *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := tx.Exec(query, args...)
+	observeQuery(query, start, err)
+	return result, err
+}
+
+// predictionArchiveFile is a gzipped NDJSON file predictions are appended to. Each run adds a gzip member,
+// which readers of the file see as one stream.
+type predictionArchiveFile struct {
+	file    *os.File
+	gzip    *gzip.Writer
+	encoder *json.Encoder
+	closed  bool
+}
+
+// openPredictionArchive opens filename for appending archived predictions.
+func openPredictionArchive(filename string) (*predictionArchiveFile, error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	return &predictionArchiveFile{file: file, gzip: gz, encoder: json.NewEncoder(gz)}, nil
+}
+
+// write appends one prediction to the file.
+func (a *predictionArchiveFile) write(p ArchivedPrediction) error {
+	return a.encoder.Encode(p)
+}
+
+// writeTable writes the predictions of table selected by where to the file.
+func (a *predictionArchiveFile) writeTable(tx *sql.Tx, algorithm, table, where string, args []interface{}) error {
+	query := "SELECT prediction_id, query_identifier, input_data, prediction_info, prediction_time, deleted_at FROM " +
+		table + " WHERE " + where + " FOR UPDATE"
+	start := time.Now()
+	rows, err := tx.Query(query, args...)
+	observeQuery(query, start, err)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	archivedAt := time.Now().UTC().Format(time.RFC3339)
+	for rows.Next() {
+		var queryIdentifier, inputData, predictionInfo, predictionTime, deletedAt sql.NullString
+		p := ArchivedPrediction{Algorithm: algorithm, ArchivedAt: archivedAt}
+		if err := rows.Scan(&p.PredictionID, &queryIdentifier, &inputData, &predictionInfo, &predictionTime, &deletedAt); err != nil {
+			return err
+		}
+		p.QueryIdentifier, p.InputData, p.PredictionInfo = queryIdentifier.String, inputData.String, predictionInfo.String
+		p.PredictionTime, p.DeletedAt = predictionTime.String, deletedAt.String
+		if err := a.write(p); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Flush writes the buffered predictions through to disk.
+func (a *predictionArchiveFile) Flush() error {
+	if err := a.gzip.Flush(); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+// Close ends the gzip member and closes the file. Closing it again does nothing.
+func (a *predictionArchiveFile) Close() error {
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+	err := a.gzip.Close()
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -1,15 +1,32 @@
 package dal
 
 import (
+	"cmpscfa23team2/access"
+	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt"
 	"golang.org/x/crypto/bcrypt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 )
 
-const SECRET_KEY = "SECRETKEY123!"
+// SECRET_KEY signs the JWTs of logged-in users. It is the "jwt/secret" secret (e.g. $CRAB_JWT_SECRET) when
+// one is set, else the development key.
+var SECRET_KEY = jwtSecret()
+
+func jwtSecret() string {
+	secret, err := access.LookupSecret("jwt/secret")
+	if errors.Is(err, access.ErrSecretNotFound) {
+		log.Println("No jwt/secret secret set; signing tokens with the development key")
+		return "SECRETKEY123!"
+	}
+	if err != nil {
+		log.Fatalf("Error reading the JWT secret: %s", err)
+	}
+	return secret
+}
 
 // Add the bcrypt hashing utility functions
 //
@@ -43,7 +60,7 @@ func ComparePassword(hashedPassword []byte, password string) error {
 func AuthenticateUser(username string, password string) (string, error) {
 	var userID, hashedPasswordStr string
 
-	err := DB.QueryRow("CALL authenticate_user(?)", username).Scan(&userID, &hashedPasswordStr)
+	err := queryRowDB("CALL authenticate_user(?)", username).Scan(&userID, &hashedPasswordStr)
 	if err != nil {
 		InsertLog("400", "Error in DB Query during authentication", "AuthenticateUser()")
 		return "", err
@@ -181,7 +198,7 @@ func ExtractToken(r *http.Request) (string, error) {
 // (DB) to execute a SQL stored procedure to log out a user with the specified userID,
 // returning any potential errors encountered during the database operation.
 func LogoutUser(userID string) error {
-	_, err := DB.Exec("CALL logout_user(?)", userID)
+	_, err := execDB("CALL logout_user(?)", userID)
 	if err != nil {
 		InsertLog("400", "Failed to logout user", "LogoutUser()")
 		return err
@@ -200,7 +217,7 @@ func RegisterUser(username string, login string, role string, password string, a
 	}
 
 	var userID string
-	err = DB.QueryRow("CALL user_registration(?, ?, ?, ?, ?)", username, login, role, hashedPassword, active).Scan(&userID)
+	err = queryRowDB("CALL user_registration(?, ?, ?, ?, ?)", username, login, role, hashedPassword, active).Scan(&userID)
 	if err != nil {
 		InsertLog("400", "Failed to register user", "RegisterUser()")
 		return "", err
@@ -220,7 +237,7 @@ func ChangePassword(userID string, newPassword string) error {
 	}
 
 	// Update the user's password in the database.
-	_, err = DB.Exec("CALL change_user_password(?, ?)", userID, hashedPassword)
+	_, err = execDB("CALL change_user_password(?, ?)", userID, hashedPassword)
 	if err != nil {
 		InsertLog("400", "Error updating password in the database during password change", "ChangePassword()")
 		return err
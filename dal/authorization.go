@@ -1,6 +1,7 @@
 package dal
 
 import (
+	"cmpscfa23team2/access"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
 	"log"
@@ -20,7 +21,7 @@ type Permission struct {
 // This function retrieves a user's role from a database using the provided userID and logs the result, handling any potential errors.
 func GetUserRole(userID string) (string, error) {
 	var userRole string
-	err := DB.QueryRow("Call get_user_role(?)", userID).Scan(&userRole)
+	err := queryRowDB("Call get_user_role(?)", userID).Scan(&userRole)
 	if err != nil {
 		log.Printf("Error in GetUserRole: %v", err)
 		InsertLog("400", "Error in GetUserRole: "+err.Error(), "GetUserRole()")
@@ -36,7 +37,7 @@ func GetUserRole(userID string) (string, error) {
 // It defines a function "IsUserActive" that checks the activity status of a user in a database and returns a boolean indicating whether the user is active or not, along with an error if any.
 func IsUserActive(userID string) (bool, error) {
 	var isActive bool
-	err := DB.QueryRow("CALL is_user_active(?)", userID).Scan(&isActive)
+	err := queryRowDB("CALL is_user_active(?)", userID).Scan(&isActive)
 	if err != nil {
 		InsertLog("400", "Error in IsUserActive: "+err.Error(), "IsUserActive()")
 		log.Printf("Error in IsUserActive: %v", err)
@@ -67,7 +68,7 @@ func AuthorizeUser(userID string, requiredRole string) (bool, error) {
 // and returns them as a slice of Permission objects while handling potential errors.
 func GetPermissionsForRole(userRole string) ([]Permission, error) {
 	// Execute a stored procedure to fetch permissions for the user role.
-	rows, err := DB.Query("CALL get_permissions_for_role(?)", userRole)
+	rows, err := queryDB("CALL get_permissions_for_role(?)", userRole)
 	if err != nil {
 		InsertLog("400", "Error in GetPermissionsForRole: "+err.Error(), "GetPermissionsForRole()")
 		log.Printf("Error in GetPermissionsForRole: %v", err)
@@ -102,7 +103,7 @@ func GetPermissionsForRole(userRole string) ([]Permission, error) {
 func CheckPermission(userRole, action, resource string) (bool, error) {
 	// Execute a stored procedure to check if the role has the permission.
 	var hasPermission bool
-	err := DB.QueryRow("CALL check_permission(?, ?, ?)", userRole, action, resource).Scan(&hasPermission)
+	err := queryRowDB("CALL check_permission(?, ?, ?)", userRole, action, resource).Scan(&hasPermission)
 	if err != nil {
 		InsertLog("400", "Error in CheckPermission: "+err.Error(), "CheckPermission()")
 		log.Printf("Error in CheckPermission: %v", err)
@@ -117,7 +118,7 @@ func CheckPermission(userRole, action, resource string) (bool, error) {
 //
 // It defines a function UpdateUserRole that updates a user's role in a database using a stored procedure and logs the outcome, handling potential errors.
 func UpdateUserRole(userID, newRole string) error {
-	_, err := DB.Exec("CALL update_user_role(?, ?)", userID, newRole)
+	_, err := execDB("CALL update_user_role(?, ?)", userID, newRole)
 	if err != nil {
 		InsertLog("400", "Error in UpdateUserRole: "+err.Error(), "UpdateUserRole()")
 		log.Printf("Error in UpdateUserRole: %v", err)
@@ -132,7 +133,7 @@ func UpdateUserRole(userID, newRole string) error {
 //
 // It deactivates a user in a database by calling a stored procedure with the provided userID and logs the outcome, handling any errors that may occur.
 func DeactivateUser(userID string) error {
-	_, err := DB.Exec("CALL deactivate_user(?)", userID)
+	_, err := execDB("CALL deactivate_user(?)", userID)
 	if err != nil {
 		InsertLog("400", "Error in DeactivateUser: "+err.Error(), "DeactivateUser()")
 		log.Printf("Error in DeactivateUser: %v", err)
@@ -145,7 +146,7 @@ func DeactivateUser(userID string) error {
 
 // AddPermission allows for adding a new permission to a user role.
 func AddPermission(userRole, action, resource string) error {
-	_, err := DB.Exec("CALL add_permission(?, ?, ?)", userRole, action, resource)
+	_, err := execDB("CALL add_permission(?, ?, ?)", userRole, action, resource)
 	if err != nil {
 		InsertLog("400", "Error in AddPermission: "+err.Error(), "AddPermission()")
 		log.Printf("Error in AddPermission: %v", err)
@@ -188,3 +189,54 @@ func NewPermission(action, resource string) Permission {
 }
 
 // ...
+
+// apiRoles maps the users_roles_lookup codes to the roles of the REST API.
+var apiRoles = map[string]access.Role{"ADM": access.RoleAdmin, "DEV": access.RoleOperator, "USR": access.RoleViewer}
+
+// APIRole returns the REST API role of a user, for tokens that carry no role claim.
+//
+// Inactive users and users with an unknown role code get no role.
+func APIRole(userID string) (access.Role, error) {
+	return apiRole(userID, IsUserActive, GetUserRole)
+}
+
+// apiRole maps a user to an API role with the user lookups of a DataStore.
+func apiRole(userID string, isUserActive func(string) (bool, error), getUserRole func(string) (string, error)) (access.Role, error) {
+	active, err := isUserActive(userID)
+	if err != nil {
+		return access.RoleNone, err
+	}
+	if !active {
+		return access.RoleNone, fmt.Errorf("user %s is not active", userID)
+	}
+	userRole, err := getUserRole(userID)
+	if err != nil {
+		return access.RoleNone, err
+	}
+	role, ok := apiRoles[userRole]
+	if !ok {
+		return access.RoleNone, fmt.Errorf("user %s has unknown role %q", userID, userRole)
+	}
+	return role, nil
+}
+
+// AuditAPICall records a mutating REST API call in the log table.
+//
+// Calls that were rejected or failed are logged with the WAR status code.
+func AuditAPICall(entry access.AuditEntry) {
+	InsertLog(auditLogEntry(entry))
+}
+
+// auditLogEntry returns the status code, message and area of the log entry of an API call.
+func auditLogEntry(entry access.AuditEntry) (statusCode, message, goEngineArea string) {
+	statusCode = "200"
+	if entry.Status >= 400 {
+		statusCode = "WAR"
+	}
+	message = fmt.Sprintf("%s %s by %s (%s, %s) from %s: %d", entry.Method, entry.Path, entry.Principal.Name,
+		entry.Principal.Role, entry.Principal.Method, entry.RemoteAddr, entry.Status)
+	if len(message) > 250 {
+		message = message[:250]
+	}
+	return statusCode, message, "API audit"
+}
@@ -0,0 +1,271 @@
+package dal
+
+import (
+	"bufio"
+	"cmpscfa23team2/records"
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// defaultBulkBatchSize is the number of rows per multi-row INSERT when the loader sets none.
+const defaultBulkBatchSize = 1000
+
+// maxPlaceholders is the most parameters MySQL accepts in one prepared statement.
+const maxPlaceholders = 65535
+
+// RowReader yields the rows to bulk load, one slice of cells per row, and io.EOF after the last one.
+// A *csv.Reader is a RowReader.
+type RowReader interface {
+	Read() ([]string, error)
+}
+
+// BulkLoader loads large datasets, such as millions of property rows, into a table far faster than one
+// INSERT per row. Empty cells are loaded as NULL.
+type BulkLoader struct {
+	Table       string
+	Columns     []string
+	BatchSize   int              // Rows per multi-row INSERT, and between progress reports; defaultBulkBatchSize when 0
+	LocalInfile bool             // Stream the rows with LOAD DATA LOCAL INFILE; the server must allow local_infile
+	DisableKeys bool             // Hold off index updates and unique and foreign key checks until the load is done
+	Progress    func(loaded int) // Called with the number of rows loaded so far after every batch
+}
+
+// bulkReaders numbers the readers registered for LOAD DATA LOCAL INFILE, so concurrent loads do not clash.
+var bulkReaders int64
+
+// Function to bulk load rows into a table
+//
+// Load reads every row of rows into the table and returns how many were loaded. All statements run on
+// one connection, so the session settings of DisableKeys apply to the load.
+func (l BulkLoader) Load(rows RowReader) (loaded int, err error) {
+	table, err := quoteIdentifier(l.Table)
+	if err != nil {
+		return 0, err
+	}
+	if len(l.Columns) == 0 {
+		return 0, fmt.Errorf("bulk load into %s: no columns", l.Table)
+	}
+	columns := make([]string, len(l.Columns))
+	for i, column := range l.Columns {
+		if columns[i], err = quoteIdentifier(column); err != nil {
+			return 0, err
+		}
+	}
+
+	ctx := context.Background()
+	var conn *sql.Conn
+	err = withRetry("CONNECT", func() (err error) {
+		conn, err = DB.Conn(ctx)
+		return err
+	})
+	if err != nil {
+		InsertLog("400", "Error opening a connection for bulk load: "+err.Error(), "BulkLoader.Load()")
+		return 0, err
+	}
+	defer conn.Close()
+
+	if l.DisableKeys {
+		if _, err := conn.ExecContext(ctx, "SET unique_checks = 0, foreign_key_checks = 0"); err != nil {
+			return 0, err
+		}
+		if _, err := conn.ExecContext(ctx, "ALTER TABLE "+table+" DISABLE KEYS"); err != nil {
+			return 0, err
+		}
+		defer func() {
+			_, enableErr := conn.ExecContext(ctx, "ALTER TABLE "+table+" ENABLE KEYS")
+			if _, checksErr := conn.ExecContext(ctx, "SET unique_checks = 1, foreign_key_checks = 1"); enableErr == nil {
+				enableErr = checksErr
+			}
+			if err == nil {
+				err = enableErr
+			}
+		}()
+	}
+
+	if l.LocalInfile {
+		loaded, err = l.loadInfile(ctx, conn, table, columns, rows)
+	} else {
+		loaded, err = l.loadInserts(ctx, conn, table, columns, rows)
+	}
+	if err != nil {
+		InsertLog("400", fmt.Sprintf("Error bulk loading %s after %d rows: %s", l.Table, loaded, err), "BulkLoader.Load()")
+	}
+	return loaded, err
+}
+
+// batchSize returns the rows per INSERT, capped so a batch stays within the placeholder limit.
+func (l BulkLoader) batchSize() int {
+	size := l.BatchSize
+	if size <= 0 {
+		size = defaultBulkBatchSize
+	}
+	if size*len(l.Columns) > maxPlaceholders {
+		size = maxPlaceholders / len(l.Columns)
+	}
+	return size
+}
+
+// readBulkRow reads the next row and checks it has a cell per column.
+func (l BulkLoader) readBulkRow(rows RowReader, n int) ([]string, error) {
+	row, err := rows.Read()
+	if err != nil {
+		return nil, err
+	}
+	if len(row) != len(l.Columns) {
+		return nil, fmt.Errorf("row %d has %d values, want %d", n+1, len(row), len(l.Columns))
+	}
+	return row, nil
+}
+
+// loadInserts loads the rows with multi-row INSERT statements of batchSize rows.
+func (l BulkLoader) loadInserts(ctx context.Context, conn *sql.Conn, table string, columns []string, rows RowReader) (int, error) {
+	size := l.batchSize()
+	placeholders := "(?" + strings.Repeat(", ?", len(columns)-1) + ")"
+	prefix := "INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES "
+	loaded := 0
+	args := make([]interface{}, 0, size*len(columns))
+	flush := func() error {
+		if len(args) == 0 {
+			return nil
+		}
+		batch := len(args) / len(columns)
+		query := prefix + placeholders + strings.Repeat(", "+placeholders, batch-1)
+		start := time.Now()
+		_, err := conn.ExecContext(ctx, query, args...)
+		observeQuery(query, start, err)
+		if err != nil {
+			return err
+		}
+		loaded += batch
+		args = args[:0]
+		if l.Progress != nil {
+			l.Progress(loaded)
+		}
+		return nil
+	}
+
+	for {
+		row, err := l.readBulkRow(rows, loaded+len(args)/len(columns))
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return loaded, err
+		}
+		for _, cell := range row {
+			args = append(args, nullString(cell))
+		}
+		if len(args) == size*len(columns) {
+			if err := flush(); err != nil {
+				return loaded, err
+			}
+		}
+	}
+	return loaded, flush()
+}
+
+// loadInfile streams the rows to the server with LOAD DATA LOCAL INFILE, in its default tab-separated
+// format.
+func (l BulkLoader) loadInfile(ctx context.Context, conn *sql.Conn, table string, columns []string, rows RowReader) (int, error) {
+	size := l.batchSize()
+	reader, writer := io.Pipe()
+	name := fmt.Sprintf("bulk-%d", atomic.AddInt64(&bulkReaders, 1))
+	mysql.RegisterReaderHandler(name, func() io.Reader { return reader })
+	defer mysql.DeregisterReaderHandler(name)
+
+	type result struct {
+		rows int
+		err  error
+	}
+	written := make(chan result, 1)
+	go func() {
+		out := bufio.NewWriter(writer)
+		n := 0
+		var err error
+		for {
+			var row []string
+			if row, err = l.readBulkRow(rows, n); err != nil {
+				break
+			}
+			for i, cell := range row {
+				if i > 0 {
+					out.WriteByte('\t')
+				}
+				out.WriteString(infileEscape(cell))
+			}
+			if err = out.WriteByte('\n'); err != nil {
+				break
+			}
+			if n++; n%size == 0 && l.Progress != nil {
+				l.Progress(n)
+			}
+		}
+		if err == io.EOF {
+			err = out.Flush()
+		}
+		writer.CloseWithError(err)
+		written <- result{n, err}
+	}()
+
+	query := "LOAD DATA LOCAL INFILE 'Reader::" + name + "' INTO TABLE " + table + " (" + strings.Join(columns, ", ") + ")"
+	start := time.Now()
+	_, err := conn.ExecContext(ctx, query)
+	observeQuery("LOAD DATA LOCAL INFILE INTO TABLE "+table, start, err)
+	reader.CloseWithError(io.ErrClosedPipe) // Unblocks the writer if the server stopped reading early
+	sent := <-written
+	if err != nil {
+		return 0, err
+	}
+	if sent.err != nil {
+		return sent.rows, sent.err // The server loaded the rows read before the error
+	}
+	if l.Progress != nil && sent.rows%size != 0 {
+		l.Progress(sent.rows)
+	}
+	return sent.rows, nil
+}
+
+// infileEscape writes a cell in the LOAD DATA default format: empty cells are NULL, and backslashes, tabs
+// and line breaks are escaped.
+func infileEscape(cell string) string {
+	if cell == "" {
+		return `\N`
+	}
+	return infileEscaper.Replace(cell)
+}
+
+// infileEscaper escapes the characters LOAD DATA treats specially.
+var infileEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`, "\x00", `\0`)
+
+// quoteIdentifier quotes a table or column name for use in a statement.
+func quoteIdentifier(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, "`\x00") {
+		return "", fmt.Errorf("invalid table or column name %q", name)
+	}
+	return "`" + name + "`", nil
+}
+
+// datasetRows reads the rows of a dataset.
+type datasetRows struct {
+	rows [][]string
+}
+
+func (d *datasetRows) Read() ([]string, error) {
+	if len(d.rows) == 0 {
+		return nil, io.EOF
+	}
+	row := d.rows[0]
+	d.rows = d.rows[1:]
+	return row, nil
+}
+
+// BulkLoadDataset loads a crab dataset into table, whose columns are named like the dataset's.
+func BulkLoadDataset(table string, ds records.Dataset, loader BulkLoader) (int, error) {
+	loader.Table, loader.Columns = table, ds.Columns
+	return loader.Load(&datasetRows{ds.Rows})
+}
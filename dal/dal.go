@@ -1,8 +1,10 @@
 package dal
 
 import (
+	"cmpscfa23team2/access"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	_ "github.com/go-sql-driver/mysql"
 	"io/ioutil"
@@ -40,37 +42,30 @@ func readJSONConfig(filename string) (JSON_Data_Connect, error) {
 	return config, nil
 }
 
-// It initializes a database connection using configuration data from a JSON file and logs any errors encountered during the process.
+// It initializes a database connection from the "db/dsn" secret (e.g. $CRAB_DB_DSN, a file under
+// $CRAB_SECRETS_DIR or Vault) or, when that is not set, from the JSON config file, and logs any errors
+// encountered during the process. An unreachable database is retried with backoff; if it stays down the
+// circuit breaker is opened, and the connection pool reconnects once a later call finds it back.
 func InitDB() error {
-	cwd, err := os.Getwd()
-	if err != nil {
-		log.Printf("Error getting current working directory: %s", err)
-		return err
-	}
-
-	// if you are running this from goFrontEnd
-	// Construct the path to the config file
-	path := filepath.Join(cwd, "/../../mysql/config.json")
-
-	// if you testing dal:
-	//path := filepath.Join(cwd, "/../mysql/config.json")
-
-	config, err := readJSONConfig(path)
+	dsn, err := databaseDSN()
 	if err != nil {
 		log.Printf("Error initializing DB from config: %s", err)
+		tripBreaker(err)
 		return err
 	}
 
-	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s", config.Username, config.Password, config.Hostname, config.Database)
 	DB, err = sql.Open("mysql", dsn)
 	if err != nil {
-		log.Printf("Error opening database with DSN '%s': %s", dsn, err)
+		log.Printf("Error opening database: %s", err)
+		tripBreaker(err)
 		return err
 	}
 
-	err = DB.Ping()
+	resetBreaker()
+	err = withRetry("PING", DB.Ping)
 	if err != nil {
 		log.Printf("Error pinging database: %s", err)
+		tripBreaker(err)
 		return err
 	}
 
@@ -78,6 +73,46 @@ func InitDB() error {
 	return nil
 }
 
+// UseDB points the dal at an already opened database, such as a throwaway test database, and returns the
+// one it used before. The circuit breaker is closed, as it judged the old database.
+func UseDB(db *sql.DB) *sql.DB {
+	previous := DB
+	DB = db
+	resetBreaker()
+	return previous
+}
+
+// databaseDSN returns the DSN of the database: the "db/dsn" secret, else the one built from mysql/config.json.
+func databaseDSN() (string, error) {
+	dsn, err := access.LookupSecret("db/dsn")
+	if err == nil {
+		log.Println("Using the database DSN from the db/dsn secret.")
+		return dsn, nil
+	}
+	if !errors.Is(err, access.ErrSecretNotFound) {
+		return "", err
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		log.Printf("Error getting current working directory: %s", err)
+		return "", err
+	}
+
+	// if you are running this from goFrontEnd
+	// Construct the path to the config file
+	path := filepath.Join(cwd, "/../../mysql/config.json")
+
+	// if you testing dal:
+	//path := filepath.Join(cwd, "/../mysql/config.json")
+
+	config, err := readJSONConfig(path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s:%s@tcp(%s)/%s", config.Username, config.Password, config.Hostname, config.Database), nil
+}
+
 // defines a function to close a database connection
 // and logs any errors or a success message if the connection is closed successfully.
 func CloseDb() {
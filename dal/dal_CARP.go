@@ -23,7 +23,7 @@ type User struct {
 // it creates a user in a database, logs the user ID if successful, and returns the user's ID or an error.
 func CreateUser(userName, userLogin, userRole string, userPassword string, activeOrNot bool) (string, error) {
 	var userID string
-	err := DB.QueryRow("CALL create_user(?, ?, ?, ?, ?)", userName, userLogin, userRole, userPassword, activeOrNot).Scan(&userID)
+	err := queryRowDB("CALL create_user(?, ?, ?, ?, ?)", userName, userLogin, userRole, userPassword, activeOrNot).Scan(&userID)
 	if err != nil {
 		InsertLog("400", "Error creating user: "+err.Error(), "CreateUser()")
 		return "", err
@@ -38,7 +38,7 @@ func CreateUser(userName, userLogin, userRole string, userPassword string, activ
 //
 // It defines a function "UpdateUser" that calls a stored procedure to update a user's information in a database, logs the user's ID, and returns any encountered error.
 func UpdateUser(userID, userName, userLogin, userRole, userPassword string) error {
-	_, err := DB.Exec("CALL update_user(?, ?, ?, ?, ?)", userID, userName, userLogin, userRole, userPassword)
+	_, err := execDB("CALL update_user(?, ?, ?, ?, ?)", userID, userName, userLogin, userRole, userPassword)
 	InsertLog("200", "User updated: "+userID, "UpdateUser()")
 	log.Printf("User: %s", userID)
 	return err
@@ -48,7 +48,7 @@ func UpdateUser(userID, userName, userLogin, userRole, userPassword string) erro
 //
 // It defines a function that deletes a user with the given userID from a database using a stored procedure and logs the operation, returning any potential errors.
 func DeleteUser(userID string) error {
-	_, err := DB.Exec("CALL delete_user(?)", userID)
+	_, err := execDB("CALL delete_user(?)", userID)
 	InsertLog("200", "User deleted: "+userID, "DeleteUser()")
 	log.Printf("User: %s", userID)
 	return err
@@ -58,7 +58,7 @@ func DeleteUser(userID string) error {
 // and returns the user's information or an error.
 func GetUserByLogin(userLogin string) (*User, error) {
 	var u User
-	row := DB.QueryRow("CALL get_user_by_login(?)", userLogin)
+	row := queryRowDB("CALL get_user_by_login(?)", userLogin)
 	if err := row.Scan(&u.UserID, &u.UserName, &u.UserLogin, &u.UserRole, &u.UserPassword, &u.ActiveOrNot, &u.UserDateAdded); err != nil {
 		InsertLog("400", "Error getting user by login: "+err.Error(), "GetUserByLogin()")
 		return nil, err
@@ -75,7 +75,7 @@ func GetUserByLogin(userLogin string) (*User, error) {
 // and returns a pointer to a User struct along with an error.
 func GetUserByID(userID string) (*User, error) {
 	var u User
-	row := DB.QueryRow("CALL get_user_by_ID(?)", userID)
+	row := queryRowDB("CALL get_user_by_ID(?)", userID)
 	if err := row.Scan(&u.UserID, &u.UserName, &u.UserLogin, &u.UserRole, &u.UserPassword, &u.ActiveOrNot, &u.UserDateAdded); err != nil {
 		InsertLog("400", "Error getting user by ID: "+err.Error(), "GetUserByID()")
 		return nil, err
@@ -91,7 +91,7 @@ func GetUserByID(userID string) (*User, error) {
 // This code defines a function that queries a database to retrieve a list of users by their role and logs various steps in the process,
 // returning the list of users and any encountered errors.
 func GetUsersByRole(role string) ([]*User, error) {
-	rows, err := DB.Query("CALL get_users_by_role(?)", role)
+	rows, err := queryDB("CALL get_users_by_role(?)", role)
 	if err != nil {
 		InsertLog("400", "Error getting users by role: "+err.Error(), "GetUsersByRole()")
 		return nil, err
@@ -128,7 +128,7 @@ func GetUsersByRole(role string) ([]*User, error) {
 // This code defines a function, GetAllUsers, that retrieves user data from a database, processes it,
 // and returns a  user objects while handling potential errors and resource cleanup.
 func GetAllUsers() ([]*User, error) {
-	rows, err := DB.Query("CALL get_users()")
+	rows, err := queryDB("CALL get_users()")
 	if err != nil {
 		InsertLog("400", "Error getting all users: "+err.Error(), "GetAllUsers()")
 		return nil, err
@@ -159,7 +159,7 @@ func GetAllUsers() ([]*User, error) {
 // This function retrieves a user's ID by calling a stored procedure in a database and logs the result, handling any errors that may occur.
 func FetchUserIDByName(userName string) (string, error) {
 	var userID string
-	err := DB.QueryRow("CALL fetch_user_id(?)", userName).Scan(&userID)
+	err := queryRowDB("CALL fetch_user_id(?)", userName).Scan(&userID)
 	if err != nil {
 		InsertLog("400", "Error fetching user ID by name: "+err.Error(), "FetchUserIDByName()")
 		return "", err
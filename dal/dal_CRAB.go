@@ -1,10 +1,20 @@
 package dal
 
 import (
+	"bytes"
+	"cmpscfa23team2/records"
+	"cmpscfa23team2/telemetry"
+	"compress/gzip"
+	"context"
+	"database/sql"
 	"encoding/json"
-	_ "errors"
+	"errors"
+	"fmt"
 	_ "github.com/go-sql-driver/mysql"
+	"io"
 	"log"
+	"strconv"
+	"time"
 )
 
 // Function to create a new web crawler
@@ -12,7 +22,7 @@ import (
 // It creates a web crawler with a specified source URL and logs the crawler's ID if successful.
 func CreateWebCrawler(sourceURL string) (string, error) {
 	var crawlerID string
-	err := DB.QueryRow("CALL create_webcrawler(?)", sourceURL).Scan(&crawlerID)
+	err := queryRowDB("CALL create_webcrawler(?)", sourceURL).Scan(&crawlerID)
 	if err != nil {
 		InsertLog("400", "Error creating web crawler: "+err.Error(), "CreateWebCrawler()")
 		return "", err
@@ -28,7 +38,7 @@ func CreateWebCrawler(sourceURL string) (string, error) {
 // defines a function called "CreateScraperEngine" that creates a scraper engine in a database, and it returns the engine's ID or an error.
 func CreateScraperEngine(engineName, engineDescription string) (string, error) {
 	var engineID string
-	err := DB.QueryRow("CALL create_scraper_engine(?, ?)", engineName, engineDescription).Scan(&engineID)
+	err := queryRowDB("CALL create_scraper_engine(?, ?)", engineName, engineDescription).Scan(&engineID)
 	if err != nil {
 		InsertLog("400", "Error creating scraper engine: "+err.Error(), "CreateScraperEngine()")
 		return "", err
@@ -39,6 +49,100 @@ func CreateScraperEngine(engineName, engineDescription string) (string, error) {
 	return engineID, nil
 }
 
+// ErrVersionConflict is returned when an engine changed since the version an update or delete was based on.
+var ErrVersionConflict = errors.New("engine was modified concurrently")
+
+// ScraperEngine is a scraper engine as stored in the database. Version is bumped by every update.
+type ScraperEngine struct {
+	EngineID    string `json:"engine_id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Version     int    `json:"version"`
+	CreatedTime string `json:"created_time"`
+	UpdatedTime string `json:"updated_time"`
+}
+
+// Function to get a scraper engine
+//
+// GetScraperEngine loads a single engine and returns sql.ErrNoRows if it does not exist.
+func GetScraperEngine(engineID string) (ScraperEngine, error) {
+	engine, err := scanScraperEngine(queryRowDB("CALL get_scraper_engine(?)", engineID))
+	if err != nil && err != sql.ErrNoRows {
+		InsertLog("400", "Error getting scraper engine: "+err.Error(), "GetScraperEngine()")
+	}
+	return engine, err
+}
+
+// Function to list the scraper engines
+//
+// ListScraperEngines returns every engine, by name.
+func ListScraperEngines() ([]ScraperEngine, error) {
+	rows, err := queryDB("CALL list_scraper_engines()")
+	if err != nil {
+		InsertLog("400", "Error listing scraper engines: "+err.Error(), "ListScraperEngines()")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var engines []ScraperEngine
+	for rows.Next() {
+		engine, err := scanScraperEngine(rows)
+		if err != nil {
+			InsertLog("400", "Error scanning scraper engine: "+err.Error(), "ListScraperEngines()")
+			return nil, err
+		}
+		engines = append(engines, engine)
+	}
+	return engines, rows.Err()
+}
+
+// Function to update a scraper engine
+//
+// UpdateScraperEngine saves the name and description of engine if it is still at engine.Version, and
+// returns the engine with its new version. It returns ErrVersionConflict if someone else updated or
+// deleted the engine since it was read, so the caller can reload it and decide again.
+func UpdateScraperEngine(engine ScraperEngine) (ScraperEngine, error) {
+	var updated int
+	err := queryRowDB("CALL update_scraper_engine(?, ?, ?, ?)", engine.EngineID, engine.Name, engine.Description,
+		engine.Version).Scan(&updated)
+	if err != nil {
+		InsertLog("400", "Error updating scraper engine: "+err.Error(), "UpdateScraperEngine()")
+		return engine, err
+	}
+	if updated == 0 {
+		InsertLog("409", "Scraper engine "+engine.EngineID+" changed since version "+strconv.Itoa(engine.Version), "UpdateScraperEngine()")
+		return engine, ErrVersionConflict
+	}
+	InsertLog("200", "Scraper engine updated: "+engine.EngineID, "UpdateScraperEngine()")
+	return GetScraperEngine(engine.EngineID)
+}
+
+// Function to delete a scraper engine
+//
+// DeleteScraperEngine deletes an engine if it is still at version, and returns ErrVersionConflict if it
+// changed or no longer exists.
+func DeleteScraperEngine(engineID string, version int) error {
+	var deleted int
+	if err := queryRowDB("CALL delete_scraper_engine(?, ?)", engineID, version).Scan(&deleted); err != nil {
+		InsertLog("400", "Error deleting scraper engine: "+err.Error(), "DeleteScraperEngine()")
+		return err
+	}
+	if deleted == 0 {
+		return ErrVersionConflict
+	}
+	InsertLog("200", "Scraper engine deleted: "+engineID, "DeleteScraperEngine()")
+	return nil
+}
+
+// scanScraperEngine reads one row produced by the get_scraper_engine or list_scraper_engines procedures.
+func scanScraperEngine(row interface{ Scan(...interface{}) error }) (ScraperEngine, error) {
+	var engine ScraperEngine
+	var description sql.NullString
+	err := row.Scan(&engine.EngineID, &engine.Name, &description, &engine.Version, &engine.CreatedTime, &engine.UpdatedTime)
+	engine.Description = description.String
+	return engine, err
+}
+
 // Function to insert a new URL
 //
 // Function "InsertURL," inserts a URL into a database along with associated tags and logs the operation, returning the generated ID or an error.
@@ -53,7 +157,7 @@ func InsertURL(url, domain string, tags map[string]interface{}) (string, error)
 		log.Printf("URL inserted with tags: %v", tags)
 	}
 
-	err = DB.QueryRow("CALL insert_url(?, ?, ?)", url, string(jsonTags), domain).Scan(&id)
+	err = queryRowDB("CALL insert_url(?, ?, ?)", url, string(jsonTags), domain).Scan(&id)
 	if err != nil {
 		InsertLog("400", "Error inserting URL: "+err.Error(), "InsertURL()")
 		return "", err
@@ -77,7 +181,7 @@ func UpdateURL(id, url, domain string, tags map[string]interface{}) error {
 		log.Printf("URL updated with tags: %v", tags)
 	}
 
-	_, err = DB.Exec("CALL update_url(?, ?, ?, ?)", id, url, string(jsonTags), domain)
+	_, err = execDB("CALL update_url(?, ?, ?, ?)", id, url, string(jsonTags), domain)
 	if err != nil {
 		InsertLog("400", "Error updating URL: "+err.Error(), "UpdateURL()")
 	}
@@ -89,7 +193,7 @@ func UpdateURL(id, url, domain string, tags map[string]interface{}) error {
 // It defines a function that retrieves tags and a domain from a database using a specified ID, logs the results, and returns them in a map and a string along with potential errors.
 func GetURLTagsAndDomain(id string) (map[string]interface{}, string, error) {
 	var tagsStr, domain string
-	err := DB.QueryRow("CALL get_url_tags_and_domain(?)", id).Scan(&tagsStr, &domain)
+	err := queryRowDB("CALL get_url_tags_and_domain(?)", id).Scan(&tagsStr, &domain)
 	if err != nil {
 		InsertLog("400", "Error getting URL tags and domain: "+err.Error(), "GetURLTagsAndDomain()")
 		return nil, "", err
@@ -114,7 +218,7 @@ func GetURLTagsAndDomain(id string) (map[string]interface{}, string, error) {
 //
 // Defines a function that queries a database to retrieve URLs associated with a given domain, processes the results, and returns the URLs in a slice while handling potential errors and logging.
 func GetURLsFromDomain(domain string) ([]string, error) {
-	rows, err := DB.Query("CALL get_urls_from_domain(?)", domain)
+	rows, err := queryDB("CALL get_urls_from_domain(?)", domain)
 	if err != nil {
 		InsertLog("400", "Error getting URLs from domain: "+err.Error(), "GetURLsFromDomain()")
 		return nil, err
@@ -137,3 +241,507 @@ func GetURLsFromDomain(domain string) ([]string, error) {
 	}
 	return urls, rows.Err()
 }
+
+// JobStore persists crab jobs in the jobs table so the REST API and schedulers share one job history.
+type JobStore struct{}
+
+// jobTimeLayout is the DATETIME format used for job timestamps.
+const jobTimeLayout = "2006-01-02 15:04:05"
+
+// Function to insert or update a job
+//
+// SaveJob stores the job's current state, creating the row the first time the job is seen.
+func (JobStore) SaveJob(job records.Job) (err error) {
+	span := telemetry.StartSpan(telemetry.SpanContext{}, "dal.SaveJob")
+	span.SetAttribute("db.system", "mysql")
+	span.SetAttribute("db.statement", "CALL save_job")
+	span.SetAttribute("crab.job_id", job.ID)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	params, err := json.Marshal(job.Params)
+	if err != nil {
+		InsertLog("400", "Error marshalling job params: "+err.Error(), "SaveJob()")
+		return err
+	}
+
+	_, err = execDB("CALL save_job(?, ?, ?, ?, ?, ?, ?, ?)", job.ID, job.Type, string(params), string(job.State),
+		job.CreatedAt.UTC().Format(jobTimeLayout), nullJobTime(job.StartedAt), nullJobTime(job.FinishedAt), job.Error)
+	if err != nil {
+		InsertLog("400", "Error saving job: "+err.Error(), "SaveJob()")
+		return err
+	}
+	log.Printf("Job %s saved as %s", job.ID, job.State)
+	return nil
+}
+
+// Function to fetch a job by ID
+//
+// GetJob loads a single job and returns an error if it does not exist.
+func (JobStore) GetJob(id string) (records.Job, error) {
+	job, err := scanJob(queryRowDB("CALL get_job(?)", id))
+	if err != nil {
+		InsertLog("400", "Error getting job: "+err.Error(), "GetJob()")
+		return records.Job{}, err
+	}
+	return job, nil
+}
+
+// Function to list all jobs
+//
+// ListJobs returns the job history, newest first.
+func (JobStore) ListJobs() ([]records.Job, error) {
+	rows, err := queryDB("CALL list_jobs()")
+	if err != nil {
+		InsertLog("400", "Error listing jobs: "+err.Error(), "ListJobs()")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []records.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			InsertLog("400", "Error scanning job: "+err.Error(), "ListJobs()")
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// scanJob reads one row produced by the get_job or list_jobs procedures.
+func scanJob(row interface{ Scan(...interface{}) error }) (records.Job, error) {
+	var job records.Job
+	var state, params, created string
+	var started, finished, errorMessage sql.NullString
+	if err := row.Scan(&job.ID, &job.Type, &params, &state, &created, &started, &finished, &errorMessage); err != nil {
+		return job, err
+	}
+	if err := json.Unmarshal([]byte(params), &job.Params); err != nil {
+		return job, err
+	}
+	job.State = records.JobState(state)
+	job.Error = errorMessage.String
+	job.CreatedAt, _ = time.Parse(jobTimeLayout, created)
+	if started.Valid {
+		job.StartedAt, _ = time.Parse(jobTimeLayout, started.String)
+	}
+	if finished.Valid {
+		job.FinishedAt, _ = time.Parse(jobTimeLayout, finished.String)
+	}
+	return job, nil
+}
+
+// nullJobTime stores zero timestamps as NULL.
+func nullJobTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(jobTimeLayout)
+}
+
+// AdvisoryLocker locks job runs with MySQL advisory locks, so runs of the same job on different machines
+// sharing the database do not overlap. A lock is held by a connection of its own, and MySQL releases it
+// if the connection drops with the process that held it.
+type AdvisoryLocker struct{}
+
+// advisoryLockPrefix keeps run locks apart from other users of GET_LOCK, whose names are server-wide.
+const advisoryLockPrefix = "crab-run:"
+
+// Function to take a run lock
+//
+// TryLock takes the advisory lock of name without waiting.
+func (AdvisoryLocker) TryLock(name string) (func() error, error) {
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Names are limited to 64 characters
+	lockName := advisoryLockPrefix + name
+	if len(lockName) > 64 {
+		lockName = lockName[:64]
+	}
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", lockName).Scan(&acquired); err != nil {
+		conn.Close()
+		InsertLog("400", "Error taking run lock: "+err.Error(), "TryLock()")
+		return nil, err
+	}
+	if acquired.Int64 != 1 {
+		conn.Close()
+		return nil, fmt.Errorf("%s: %w", name, records.ErrRunLocked)
+	}
+	return func() error {
+		defer conn.Close()
+		_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", lockName)
+		return err
+	}, nil
+}
+
+// SnapshotStore keeps gzipped page snapshots in the page_snapshots table, as an alternative to crab's
+// local content store.
+type SnapshotStore struct{}
+
+// snapshotTimeLayout is the DATETIME(3) format used for snapshot fetch times.
+const snapshotTimeLayout = "2006-01-02 15:04:05.000"
+
+// Function to store a page snapshot
+//
+// SaveSnapshot compresses the page body and stores it under the URL hash and fetch time.
+func (SnapshotStore) SaveSnapshot(snapshot records.Snapshot) (err error) {
+	span := telemetry.StartSpan(telemetry.ParseTraceParent(snapshot.TraceParent), "dal.SaveSnapshot")
+	span.SetAttribute("db.system", "mysql")
+	span.SetAttribute("db.statement", "CALL save_page_snapshot")
+	span.SetAttribute("url.full", snapshot.URL)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	gz.Write(snapshot.Body)
+	if err := gz.Close(); err != nil {
+		InsertLog("400", "Error compressing snapshot: "+err.Error(), "SaveSnapshot()")
+		return err
+	}
+
+	_, err = execDB("CALL save_page_snapshot(?, ?, ?, ?, ?, ?, ?)", records.URLHash(snapshot.URL),
+		snapshot.FetchedAt.UTC().Format(snapshotTimeLayout), snapshot.URL, snapshot.StatusCode, snapshot.ContentType, body.Bytes(),
+		nullString(snapshot.RunID))
+	if err != nil {
+		InsertLog("400", "Error saving snapshot: "+err.Error(), "SaveSnapshot()")
+		return err
+	}
+	return nil
+}
+
+// Function to list the snapshots of a URL
+//
+// ListSnapshots returns the metadata of every snapshot of rawURL, oldest first.
+func (SnapshotStore) ListSnapshots(rawURL string) ([]records.Snapshot, error) {
+	rows, err := queryDB("CALL list_page_snapshots(?)", records.URLHash(rawURL))
+	if err != nil {
+		InsertLog("400", "Error listing snapshots: "+err.Error(), "ListSnapshots()")
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []records.Snapshot{}
+	for rows.Next() {
+		var snapshot records.Snapshot
+		var fetched string
+		var contentType, runID sql.NullString
+		if err := rows.Scan(&snapshot.URL, &snapshot.URLHash, &fetched, &snapshot.StatusCode, &contentType, &runID); err != nil {
+			InsertLog("400", "Error scanning snapshot: "+err.Error(), "ListSnapshots()")
+			return nil, err
+		}
+		snapshot.FetchedAt, _ = time.Parse(snapshotTimeLayout, fetched)
+		snapshot.ContentType = contentType.String
+		snapshot.RunID = runID.String
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+// Function to load a page snapshot
+//
+// LoadSnapshot returns the snapshot of rawURL fetched at fetchedAt, or the latest one if fetchedAt is zero.
+func (SnapshotStore) LoadSnapshot(rawURL string, fetchedAt time.Time) (records.Snapshot, error) {
+	var snapshot records.Snapshot
+	var fetched string
+	var contentType, runID sql.NullString
+	var body []byte
+	err := queryRowDB("CALL get_page_snapshot(?, ?)", records.URLHash(rawURL), nullSnapshotTime(fetchedAt)).
+		Scan(&snapshot.URL, &snapshot.URLHash, &fetched, &snapshot.StatusCode, &contentType, &runID, &body)
+	if err != nil {
+		InsertLog("400", "Error getting snapshot: "+err.Error(), "LoadSnapshot()")
+		return snapshot, err
+	}
+	snapshot.FetchedAt, _ = time.Parse(snapshotTimeLayout, fetched)
+	snapshot.ContentType = contentType.String
+	snapshot.RunID = runID.String
+
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		InsertLog("400", "Error decompressing snapshot: "+err.Error(), "LoadSnapshot()")
+		return snapshot, err
+	}
+	defer gz.Close()
+	if snapshot.Body, err = io.ReadAll(gz); err != nil {
+		InsertLog("400", "Error decompressing snapshot: "+err.Error(), "LoadSnapshot()")
+		return snapshot, err
+	}
+	return snapshot, nil
+}
+
+// nullSnapshotTime passes a zero fetch time as NULL so the latest snapshot is returned.
+func nullSnapshotTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(snapshotTimeLayout)
+}
+
+// nullString passes an empty string as NULL.
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// QualityStore keeps the results of crab's data quality checks in the data_quality table, so failing
+// expectations can be tracked across runs.
+type QualityStore struct{}
+
+// Function to store data quality results
+
+// SaveQualityResults stores one row per expectation checked.
+func (QualityStore) SaveQualityResults(results []records.ExpectationResult) error {
+	for _, result := range results {
+		unexpected, err := json.Marshal(result.Unexpected)
+		if err != nil {
+			return err
+		}
+		_, err = execDB("CALL save_data_quality_result(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", result.Dataset,
+			nullString(result.RunID), result.Expectation, result.Column, result.Severity, result.Success,
+			result.Checked, result.Failed, string(unexpected), result.CheckedAt.UTC().Format(snapshotTimeLayout))
+		if err != nil {
+			InsertLog("400", "Error saving data quality result: "+err.Error(), "SaveQualityResults()")
+			return err
+		}
+	}
+	return nil
+}
+
+// WorkflowStore keeps the state of crab pipeline runs in the workflow_runs table, so a failed run can be
+// resumed from the stages that did not succeed.
+type WorkflowStore struct{}
+
+// Function to insert or update a pipeline run
+//
+// SaveWorkflowRun stores the run's record as JSON, creating the row the first time the run is seen.
+func (WorkflowStore) SaveWorkflowRun(record records.WorkflowRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		InsertLog("400", "Error marshalling workflow run: "+err.Error(), "SaveWorkflowRun()")
+		return err
+	}
+	_, err = execDB("CALL save_workflow_run(?, ?, ?, ?, ?, ?)", record.RunID, record.Workflow, record.Status,
+		string(data), record.StartedAt.UTC().Format(snapshotTimeLayout), record.UpdatedAt.UTC().Format(snapshotTimeLayout))
+	if err != nil {
+		InsertLog("400", "Error saving workflow run: "+err.Error(), "SaveWorkflowRun()")
+		return err
+	}
+	return nil
+}
+
+// Function to fetch a pipeline run by ID
+//
+// LoadWorkflowRun returns sql.ErrNoRows when there is no run with the ID.
+func (WorkflowStore) LoadWorkflowRun(runID string) (records.WorkflowRecord, error) {
+	var record records.WorkflowRecord
+	var data string
+	if err := queryRowDB("CALL get_workflow_run(?)", runID).Scan(&data); err != nil {
+		if err != sql.ErrNoRows {
+			InsertLog("400", "Error fetching workflow run: "+err.Error(), "LoadWorkflowRun()")
+		}
+		return record, err
+	}
+	if err := json.Unmarshal([]byte(data), &record); err != nil {
+		InsertLog("400", "Error unmarshalling workflow run: "+err.Error(), "LoadWorkflowRun()")
+		return record, err
+	}
+	return record, nil
+}
+
+// LatencyStore keeps the response time percentiles of crawled domains in the crawl_latency table, so the
+// performance of monitored sites can be followed across runs.
+type LatencyStore struct{}
+
+// Function to store the latencies of a crawl run
+//
+// SaveLatency stores one row per domain, replacing those of an earlier save of the run.
+func (LatencyStore) SaveLatency(runID string, startedAt time.Time, domains []records.DomainLatency) error {
+	for _, latency := range domains {
+		_, err := execDB("CALL save_crawl_latency(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", runID, latency.Domain,
+			startedAt.UTC().Format(snapshotTimeLayout), latency.Requests, latency.TTFB.P50, latency.TTFB.P95,
+			latency.TTFB.P99, latency.Fetch.P50, latency.Fetch.P95, latency.Fetch.P99)
+		if err != nil {
+			InsertLog("400", "Error saving crawl latency: "+err.Error(), "SaveLatency()")
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to fetch the latencies of crawl runs
+//
+// LoadLatency returns the latencies of domain (every domain when empty) of the runs started between from
+// and to (unbounded when zero), oldest first.
+func (LatencyStore) LoadLatency(domain string, from, to time.Time) ([]records.LatencySample, error) {
+	rows, err := queryDB("CALL get_crawl_latency(?, ?, ?)", nullString(domain), nullSnapshotTime(from), nullSnapshotTime(to))
+	if err != nil {
+		InsertLog("400", "Error getting crawl latency: "+err.Error(), "LoadLatency()")
+		return nil, err
+	}
+	defer rows.Close()
+
+	samples := []records.LatencySample{}
+	for rows.Next() {
+		var sample records.LatencySample
+		var started string
+		if err := rows.Scan(&sample.RunID, &sample.Domain, &started, &sample.Requests, &sample.TTFB.P50,
+			&sample.TTFB.P95, &sample.TTFB.P99, &sample.Fetch.P50, &sample.Fetch.P95, &sample.Fetch.P99); err != nil {
+			InsertLog("400", "Error scanning crawl latency: "+err.Error(), "LoadLatency()")
+			return nil, err
+		}
+		sample.Time, _ = time.Parse(snapshotTimeLayout, started)
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
+
+// MetricsStore keeps the metrics of crab's runs in the run_metrics table, so the dashboard can chart their
+// trends across weeks of scheduled runs.
+type MetricsStore struct{}
+
+// Function to store the metrics of a run
+//
+// SaveRunMetrics stores one row per metric, replacing those of an earlier save of the run.
+func (MetricsStore) SaveRunMetrics(metrics []records.RunMetric) error {
+	for _, metric := range metrics {
+		_, err := execDB("CALL save_run_metric(?, ?, ?, ?, ?, ?, ?)", metric.RunID, metric.Kind, metric.Name,
+			metric.Time.UTC().Format(snapshotTimeLayout), metric.Metric, metric.Label, metric.Value)
+		if err != nil {
+			InsertLog("400", "Error saving run metric: "+err.Error(), "SaveRunMetrics()")
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to fetch the metrics of runs
+//
+// LoadRunMetrics returns the metrics q selects, oldest run first.
+func (MetricsStore) LoadRunMetrics(q records.MetricQuery) ([]records.RunMetric, error) {
+	rows, err := queryDB("CALL get_run_metrics(?, ?, ?, ?, ?, ?)", nullString(q.Kind), nullString(q.Name),
+		nullString(q.Metric), nullString(q.Label), nullSnapshotTime(q.From), nullSnapshotTime(q.To))
+	if err != nil {
+		InsertLog("400", "Error getting run metrics: "+err.Error(), "LoadRunMetrics()")
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := []records.RunMetric{}
+	for rows.Next() {
+		var metric records.RunMetric
+		var started string
+		if err := rows.Scan(&metric.RunID, &metric.Kind, &metric.Name, &started, &metric.Metric, &metric.Label, &metric.Value); err != nil {
+			InsertLog("400", "Error scanning run metric: "+err.Error(), "LoadRunMetrics()")
+			return nil, err
+		}
+		metric.Time, _ = time.Parse(snapshotTimeLayout, started)
+		metrics = append(metrics, metric)
+	}
+	return metrics, rows.Err()
+}
+
+// AlertStore keeps the alerts fired by crab's alert rules in the alert_history table.
+type AlertStore struct{}
+
+// Function to record fired alerts
+//
+// SaveAlerts stores one row per alert.
+func (AlertStore) SaveAlerts(alerts []records.Alert) error {
+	for _, alert := range alerts {
+		_, err := execDB("CALL save_alert(?, ?, ?, ?, ?, ?, ?, ?, ?)", alert.Rule, alert.Kind, nullString(alert.RunID),
+			alert.Job, alert.Label, alert.Value, alert.Threshold, alert.Message, alert.FiredAt.UTC().Format(snapshotTimeLayout))
+		if err != nil {
+			InsertLog("400", "Error saving alert: "+err.Error(), "SaveAlerts()")
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to fetch the alert history
+//
+// LoadAlerts returns the alerts of job (every job when empty) fired since the given time (ever when zero),
+// oldest first.
+func (AlertStore) LoadAlerts(job string, since time.Time) ([]records.Alert, error) {
+	rows, err := queryDB("CALL get_alerts(?, ?)", nullString(job), nullSnapshotTime(since))
+	if err != nil {
+		InsertLog("400", "Error getting alerts: "+err.Error(), "LoadAlerts()")
+		return nil, err
+	}
+	defer rows.Close()
+
+	alerts := []records.Alert{}
+	for rows.Next() {
+		var alert records.Alert
+		var runID sql.NullString
+		var fired string
+		if err := rows.Scan(&alert.Rule, &alert.Kind, &runID, &alert.Job, &alert.Label, &alert.Value, &alert.Threshold,
+			&alert.Message, &fired); err != nil {
+			InsertLog("400", "Error scanning alert: "+err.Error(), "LoadAlerts()")
+			return nil, err
+		}
+		alert.RunID = runID.String
+		alert.FiredAt, _ = time.Parse(snapshotTimeLayout, fired)
+		alerts = append(alerts, alert)
+	}
+	return alerts, rows.Err()
+}
+
+// IdempotencyStore keeps the idempotency keys of API requests in the idempotency_keys table, so a retry is
+// recognized whichever server it reaches.
+type IdempotencyStore struct{}
+
+// Function to claim the idempotency key of a request
+//
+// ClaimIdempotencyKey stores record unless its key is stored for its scope since expiredBefore, in which
+// case it returns the stored record and false.
+func (IdempotencyStore) ClaimIdempotencyKey(record records.IdempotencyRecord, expiredBefore time.Time) (records.IdempotencyRecord, bool, error) {
+	stored := records.IdempotencyRecord{Scope: record.Scope, Key: record.Key}
+	var resourceID sql.NullString
+	var created string
+	var claimed int
+	err := queryRowDB("CALL claim_idempotency_key(?, ?, ?, ?, ?)", record.Scope, record.Key, record.RequestHash,
+		record.CreatedAt.UTC().Format(snapshotTimeLayout), expiredBefore.UTC().Format(snapshotTimeLayout)).
+		Scan(&stored.RequestHash, &resourceID, &stored.Status, &created, &claimed)
+	if err != nil {
+		InsertLog("400", "Error claiming idempotency key: "+err.Error(), "ClaimIdempotencyKey()")
+		return stored, false, err
+	}
+	stored.ResourceID = resourceID.String
+	stored.CreatedAt, _ = time.Parse(snapshotTimeLayout, created)
+	return stored, claimed > 0, nil
+}
+
+// Function to record the response to a claimed idempotency key
+//
+// CompleteIdempotencyKey stores the resource the request created and the status it was answered with.
+func (IdempotencyStore) CompleteIdempotencyKey(record records.IdempotencyRecord) error {
+	_, err := execDB("CALL complete_idempotency_key(?, ?, ?, ?)", record.Scope, record.Key, record.ResourceID, record.Status)
+	if err != nil {
+		InsertLog("400", "Error completing idempotency key: "+err.Error(), "CompleteIdempotencyKey()")
+	}
+	return err
+}
+
+// Function to forget the idempotency key of a failed request
+//
+// ReleaseIdempotencyKey deletes the key, so a retry of the request goes through.
+func (IdempotencyStore) ReleaseIdempotencyKey(scope, key string) error {
+	_, err := execDB("CALL release_idempotency_key(?, ?)", scope, key)
+	if err != nil {
+		InsertLog("400", "Error releasing idempotency key: "+err.Error(), "ReleaseIdempotencyKey()")
+	}
+	return err
+}
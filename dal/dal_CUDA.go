@@ -13,6 +13,7 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 )
 
 // Prediction struct models the data structure of a prediction in the database
@@ -80,7 +81,7 @@ func InsertPrediction(algorithm, queryIdentifier, fileName, predictionInfo, skil
 		return fmt.Errorf("Unrecognized algorithm: %v", algorithm)
 	}
 
-	_, err := DB.Exec(query, newUUID, queryIdentifier, skills, predictionInfo)
+	_, err := execDB(query, newUUID, queryIdentifier, skills, predictionInfo)
 	if err != nil {
 		return fmt.Errorf("Error storing prediction for %v: %v", algorithm, err)
 	}
@@ -89,16 +90,19 @@ func InsertPrediction(algorithm, queryIdentifier, fileName, predictionInfo, skil
 	return nil
 }
 
+// PredictionDelay is how long the simulated ML model takes for one prediction.
+var PredictionDelay = 2 * time.Second
+
 // Simulated ML model prediction function
 //
-// It definesa function that simulates an ML model prediction with a 2-second delay
+// It definesa function that simulates an ML model prediction with a PredictionDelay delay
 // and logs a success message before returning a prediction result as a formatted string.
-//func PerformMLPrediction(inputData string) string {
-//	// Simulate some delay for ML model prediction
-//	time.Sleep(2 * time.Second)
-//	log.Println("Successfully performed ML prediction.")
-//	return fmt.Sprintf("Prediction result for %s", inputData)
-//}
+func PerformMLPrediction(inputData string) string {
+	// Simulate some delay for ML model prediction
+	time.Sleep(PredictionDelay)
+	log.Println("Successfully performed ML prediction.")
+	return fmt.Sprintf("Prediction result for %s", inputData)
+}
 
 // Convert prediction result to JSON
 //
@@ -252,63 +256,53 @@ func constructImagePath(queryIdentifier, domain string) string {
 
 // FetchPredictionData fetches prediction data based on the domain and query identifier
 func FetchPredictionData(queryIdentifier, domain string) (PredictionData, error) {
+	return fetchPredictionData(queryIdentifier, domain, lookupPrediction)
+}
+
+// predictionLookup returns the input data and prediction info of the prediction of queryIdentifier in a
+// prediction table, skipping soft-deleted ones, or sql.ErrNoRows.
+type predictionLookup func(table, queryIdentifier string) (inputData, predictionInfo string, err error)
+
+// lookupPrediction is the predictionLookup of the database.
+func lookupPrediction(table, queryIdentifier string) (string, string, error) {
+	var inputData, predictionInfo sql.NullString
+	err := queryRowDB("SELECT input_data, prediction_info FROM "+table+" WHERE query_identifier = ? AND deleted_at IS NULL",
+		queryIdentifier).Scan(&inputData, &predictionInfo)
+	return inputData.String, predictionInfo.String, err
+}
+
+// fetchPredictionData finds the prediction of a domain with lookup, so every DataStore shares which
+// algorithms each domain falls back on.
+func fetchPredictionData(queryIdentifier, domain string, lookup predictionLookup) (PredictionData, error) {
 	var data PredictionData
-	var queryStr string
 	var err error
 
 	switch domain {
 	case "Gas Prices":
 		// First try fetching from linear regression predictions
-		queryStr = "SELECT prediction_info FROM linear_regression_predictions WHERE query_identifier = ?"
-		err = DB.QueryRow(queryStr, queryIdentifier).Scan(&data.PredictionInfo)
-
+		_, data.PredictionInfo, err = lookup("linear_regression_predictions", queryIdentifier)
+		if err == sql.ErrNoRows {
+			// If not found, try fetching from KNN predictions
+			_, data.PredictionInfo, err = lookup("knn_predictions", queryIdentifier)
+		}
 		if err != nil {
-			if err == sql.ErrNoRows {
-				// If not found, try fetching from KNN predictions
-				queryStr = "SELECT prediction_info FROM knn_predictions WHERE query_identifier = ?"
-				err = DB.QueryRow(queryStr, queryIdentifier).Scan(&data.PredictionInfo)
-
-				if err != nil {
-					return handleDBError(err, queryIdentifier)
-				}
-
-				// Set the image path for KNN
-				data.ImagePath = fmt.Sprintf("/static/Assets/MachineLearning/LinearRegression/%s_scatter_plot.png", queryIdentifier)
-			} else {
-				return handleDBError(err, queryIdentifier)
-			}
-		} else {
-			// Set the image path for linear regression
-			data.ImagePath = fmt.Sprintf("/static/Assets/MachineLearning/LinearRegression/%s_scatter_plot.png", queryIdentifier)
+			return handleDBError(err, queryIdentifier)
 		}
+		data.ImagePath = fmt.Sprintf("/static/Assets/MachineLearning/LinearRegression/%s_scatter_plot.png", queryIdentifier)
 
 	case "Airfare Prices":
-		queryStr = "SELECT prediction_info FROM knn_predictions WHERE query_identifier = ?"
-		err = DB.QueryRow(queryStr, queryIdentifier).Scan(&data.PredictionInfo)
+		_, data.PredictionInfo, err = lookup("knn_predictions", queryIdentifier)
+		if err == sql.ErrNoRows {
+			// If not found, try fetching from linear regression predictions
+			_, data.PredictionInfo, err = lookup("linear_regression_predictions", queryIdentifier)
+		}
 		if err != nil {
-			if err == sql.ErrNoRows {
-				// If not found, try fetching from KNN predictions
-				queryStr = "SELECT prediction_info FROM linear_regression_predictions WHERE query_identifier = ?"
-				err = DB.QueryRow(queryStr, queryIdentifier).Scan(&data.PredictionInfo)
-
-				if err != nil {
-					return handleDBError(err, queryIdentifier)
-				}
-
-				// Set the image path for KNN
-				data.ImagePath = fmt.Sprintf("/static/Assets/MachineLearning/LinearRegression/%s_scatter_plot.png", queryIdentifier)
-			} else {
-				return handleDBError(err, queryIdentifier)
-			}
-		} else {
-			// Set the image path for linear regression
-			data.ImagePath = fmt.Sprintf("/static/Assets/MachineLearning/LinearRegression/%s_scatter_plot.png", queryIdentifier)
+			return handleDBError(err, queryIdentifier)
 		}
+		data.ImagePath = fmt.Sprintf("/static/Assets/MachineLearning/LinearRegression/%s_scatter_plot.png", queryIdentifier)
 
 	case "Job Market":
-		var predictionPath, jobTitle string
-		queryStr = "SELECT input_data, prediction_info FROM naive_bayes_predictions WHERE query_identifier = ?"
-		err = DB.QueryRow(queryStr, queryIdentifier).Scan(&jobTitle, &predictionPath)
+		jobTitle, predictionPath, err := lookup("naive_bayes_predictions", queryIdentifier)
 		if err != nil {
 			return handleDBError(err, queryIdentifier)
 		}
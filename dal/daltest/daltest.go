@@ -0,0 +1,262 @@
+// Package daltest sets up throwaway databases for integration tests of the dal.
+//
+// A test database gets its own schema, created from mysql/scripts.sql with every table and stored
+// procedure, and optionally rows loaded from YAML fixture files. It runs on the MySQL server of
+// $CRAB_TEST_DB_DSN, or on a MySQL container started with Docker when that is not set. SQLite is not
+// offered: every dal function calls a stored procedure, which SQLite has no equivalent for.
+//
+//	func TestMain(m *testing.M) {
+//		db, err := daltest.Start(daltest.Options{Fixtures: []string{"testdata/fixtures.yaml"}})
+//		...
+//		code := m.Run()
+//		db.Close()
+//		os.Exit(code)
+//	}
+package daltest
+
+import (
+	"cmpscfa23team2/dal"
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// defaultImage is the MySQL image started when no server is given.
+const defaultImage = "mysql:8.0"
+
+// startupTimeout is how long a MySQL container may take to accept connections.
+const startupTimeout = 2 * time.Minute
+
+// ErrNoServer is returned by Start when there is neither $CRAB_TEST_DB_DSN nor Docker to run MySQL in.
+var ErrNoServer = errors.New("no MySQL server for tests: set $CRAB_TEST_DB_DSN or install Docker")
+
+// Options configures a test database. Zero fields take their defaults.
+type Options struct {
+	DSN      string   // Server to create the database on, e.g. "root:pw@tcp(127.0.0.1:3306)/"; $CRAB_TEST_DB_DSN by default
+	Image    string   // MySQL image started with Docker when there is no DSN; $CRAB_TEST_MYSQL_IMAGE or mysql:8.0 by default
+	Schema   string   // Script creating the schema; mysql/scripts.sql of the repository by default
+	Fixtures []string // YAML fixture files loaded after the schema, in order
+	Keep     bool     // Leave the database and container behind on Close, to inspect them after a failure
+}
+
+// Database is a throwaway database the dal is pointed at until it is closed.
+type Database struct {
+	*sql.DB
+	Name      string // Name of the database on the server
+	DSN       string // DSN of the database
+	server    *sql.DB
+	container string
+	previous  *sql.DB
+	keep      bool
+}
+
+// New starts a test database for t and closes it when t and its subtests are done. The test is skipped
+// when there is no server to run it on, and fails if the database cannot be set up.
+func New(t testing.TB, options Options) *Database {
+	t.Helper()
+	db, err := Start(options)
+	if errors.Is(err, ErrNoServer) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatalf("Error starting the test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("Error dropping the test database: %v", err)
+		}
+	})
+	return db
+}
+
+// Start creates a test database with the schema and fixtures of options, and points the dal at it. It
+// returns ErrNoServer when there is nowhere to create it.
+func Start(options Options) (db *Database, err error) {
+	if options.DSN == "" {
+		options.DSN = os.Getenv("CRAB_TEST_DB_DSN")
+	}
+	if options.Image == "" {
+		options.Image = os.Getenv("CRAB_TEST_MYSQL_IMAGE")
+	}
+	if options.Image == "" {
+		options.Image = defaultImage
+	}
+	if options.Schema == "" {
+		if options.Schema, err = findSchema(); err != nil {
+			return nil, err
+		}
+	}
+	schema, err := os.ReadFile(options.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	db = &Database{keep: options.Keep}
+	defer func() {
+		if err != nil {
+			db.keep = false
+			db.teardown()
+		}
+	}()
+	if options.DSN == "" {
+		if options.DSN, err = db.startContainer(options.Image); err != nil {
+			return nil, err
+		}
+	}
+	config, err := mysql.ParseDSN(options.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid test DSN: %w", err)
+	}
+	config.DBName = ""
+	if db.server, err = openServer(config.FormatDSN(), db.container != ""); err != nil {
+		return nil, err
+	}
+
+	db.Name = "goengine_test_" + randomSuffix()
+	if err := applySchema(db.server, db.Name, string(schema)); err != nil {
+		return nil, fmt.Errorf("applying %s: %w", filepath.Base(options.Schema), err)
+	}
+	config.DBName = db.Name
+	db.DSN = config.FormatDSN()
+	if db.DB, err = sql.Open("mysql", db.DSN); err != nil {
+		return nil, err
+	}
+	if err := LoadFixtures(db.DB, options.Fixtures...); err != nil {
+		return nil, err
+	}
+	db.previous = dal.UseDB(db.DB)
+	return db, nil
+}
+
+// Close drops the database, stops the container it ran in, if any, and points the dal back at the
+// database it used before.
+func (db *Database) Close() error {
+	if db.DB != nil && dal.DB == db.DB {
+		dal.UseDB(db.previous)
+	}
+	return db.teardown()
+}
+
+// teardown releases everything Start set up, unless the database is to be kept.
+func (db *Database) teardown() error {
+	var err error
+	if db.DB != nil {
+		err = db.DB.Close()
+	}
+	if db.keep {
+		if db.server != nil {
+			db.server.Close()
+		}
+		return err
+	}
+	if db.server != nil {
+		if db.Name != "" {
+			if _, dropErr := db.server.Exec("DROP DATABASE IF EXISTS `" + db.Name + "`"); err == nil {
+				err = dropErr
+			}
+		}
+		db.server.Close()
+	}
+	if db.container != "" {
+		if out, rmErr := exec.Command("docker", "rm", "-f", db.container).CombinedOutput(); rmErr != nil && err == nil {
+			err = fmt.Errorf("removing container %s: %v: %s", db.container, rmErr, out)
+		}
+	}
+	return err
+}
+
+// startContainer starts a MySQL container on a free local port and returns the DSN of its server.
+func (db *Database) startContainer(image string) (string, error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return "", ErrNoServer
+	}
+	password := randomSuffix()
+	out, err := exec.Command("docker", "run", "-d", "--rm", "-e", "MYSQL_ROOT_PASSWORD="+password,
+		"-p", "127.0.0.1::3306", image).Output()
+	if err != nil {
+		return "", fmt.Errorf("starting %s: %w", image, commandError(err))
+	}
+	db.container = strings.TrimSpace(string(out))
+	out, err = exec.Command("docker", "port", db.container, "3306/tcp").Output()
+	if err != nil {
+		return "", fmt.Errorf("finding the port of %s: %w", image, commandError(err))
+	}
+	address := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	return "root:" + password + "@tcp(" + address + ")/", nil
+}
+
+// openServer connects to the server, waiting for a container that was just started to accept connections.
+func openServer(dsn string, starting bool) (*sql.DB, error) {
+	server, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, err
+	}
+	wait := time.Duration(0)
+	if starting {
+		wait = startupTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), wait+5*time.Second)
+	defer cancel()
+	for {
+		if err = server.PingContext(ctx); err == nil || !starting {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			server.Close()
+			return nil, fmt.Errorf("MySQL did not start within %s: %w", startupTimeout, err)
+		case <-time.After(time.Second):
+		}
+	}
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	return server, nil
+}
+
+// findSchema looks for mysql/scripts.sql in the working directory and the directories above it, so tests
+// of any package find it.
+func findSchema() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, "mysql", "scripts.sql")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("mysql/scripts.sql not found above the working directory")
+		}
+		dir = parent
+	}
+}
+
+// randomSuffix returns a random name suffix, so parallel test runs get databases of their own.
+func randomSuffix() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// commandError adds the standard error of a failed command to its error.
+func commandError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+package daltest
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Fixture is the rows a fixture file holds for one table.
+type Fixture struct {
+	Table string
+	Rows  []map[string]interface{}
+}
+
+// ReadFixtures reads a YAML fixture file: a mapping from table names to lists of rows, each a mapping from
+// column names to values, such as
+//
+//	scraper_engines:
+//	  - engine_id: fixture-engine
+//	    engine_name: Fixture engine
+//	knn_predictions:
+//	  - prediction_id: fixture-knn
+//	    query_identifier: Top skills
+//
+// Tables are returned in the order of the file, so rows can refer to rows of tables listed before them.
+func ReadFixtures(filename string) ([]Fixture, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+	tables := document.Content[0]
+	if tables.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s: want a mapping from tables to rows", filename)
+	}
+	fixtures := make([]Fixture, 0, len(tables.Content)/2)
+	for i := 0; i+1 < len(tables.Content); i += 2 {
+		fixture := Fixture{Table: tables.Content[i].Value}
+		if err := tables.Content[i+1].Decode(&fixture.Rows); err != nil {
+			return nil, fmt.Errorf("%s: table %s: %w", filename, fixture.Table, err)
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, nil
+}
+
+// LoadFixtures inserts the rows of the fixture files into db, in one transaction, with foreign key checks
+// off so the files need not be ordered by dependency.
+func LoadFixtures(db *sql.DB, filenames ...string) error {
+	if len(filenames) == 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("SET foreign_key_checks = 0"); err != nil {
+		return err
+	}
+	for _, filename := range filenames {
+		fixtures, err := ReadFixtures(filename)
+		if err != nil {
+			return err
+		}
+		for _, fixture := range fixtures {
+			for n, row := range fixture.Rows {
+				if err := insertFixtureRow(tx, fixture.Table, row); err != nil {
+					return fmt.Errorf("%s: row %d of %s: %w", filename, n+1, fixture.Table, err)
+				}
+			}
+		}
+	}
+	if _, err := tx.Exec("SET foreign_key_checks = 1"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertFixtureRow inserts one row, its columns in name order.
+func insertFixtureRow(tx *sql.Tx, table string, row map[string]interface{}) error {
+	if len(row) == 0 {
+		return fmt.Errorf("no columns")
+	}
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	quoted := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		quoted[i] = "`" + strings.ReplaceAll(column, "`", "``") + "`"
+		value, err := fixtureValue(row[column])
+		if err != nil {
+			return fmt.Errorf("column %s: %w", column, err)
+		}
+		args[i] = value
+	}
+	query := "INSERT INTO `" + strings.ReplaceAll(table, "`", "``") + "` (" + strings.Join(quoted, ", ") +
+		") VALUES (?" + strings.Repeat(", ?", len(columns)-1) + ")"
+	_, err := tx.Exec(query, args...)
+	return err
+}
+
+// fixtureValue converts a YAML value to a column value: mappings and lists become JSON, for JSON columns,
+// and times the DATETIME format.
+func fixtureValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		return string(data), err
+	case time.Time:
+		return v.UTC().Format("2006-01-02 15:04:05"), nil
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,128 @@
+package daltest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// scriptDatabase matches the database the schema script creates and switches to.
+var scriptDatabase = regexp.MustCompile(`(?i)^(DROP DATABASE IF EXISTS|CREATE DATABASE IF NOT EXISTS|CREATE DATABASE|USE)\s+goengine\s*$`)
+
+// SplitStatements splits a SQL script into its statements the way the mysql client does: statements end
+// at the current delimiter, which DELIMITER lines change so procedure bodies can hold semicolons.
+// Comments are dropped, delimiters inside quotes are left alone, and a stray semicolon ending a procedure
+// body is removed.
+func SplitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	delimiter := ";"
+	flush := func() {
+		if statement := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(current.String()), ";")); statement != "" {
+			statements = append(statements, statement)
+		}
+		current.Reset()
+	}
+
+	atLineStart := true
+	for i := 0; i < len(script); {
+		if atLineStart {
+			line := script[i:]
+			if end := strings.IndexByte(line, '\n'); end >= 0 {
+				line = line[:end]
+			}
+			if fields := strings.Fields(line); len(fields) == 2 && strings.EqualFold(fields[0], "DELIMITER") {
+				flush() // Like the mysql client, a DELIMITER line ends an unterminated statement
+				delimiter = fields[1]
+				i += len(line)
+				continue
+			}
+		}
+		atLineStart = false
+
+		c := script[i]
+		switch {
+		case strings.HasPrefix(script[i:], delimiter):
+			flush()
+			i += len(delimiter)
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			end := quoteEnd(script, i)
+			current.WriteString(script[i:end])
+			i = end
+			continue
+		case strings.HasPrefix(script[i:], "-- ") || strings.HasPrefix(script[i:], "--\n") || c == '#':
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			i += end
+			continue
+		case strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 4
+			}
+			current.WriteByte(' ')
+			continue
+		case c == '\n':
+			atLineStart = true
+		}
+		current.WriteByte(c)
+		i++
+	}
+	flush()
+	return statements
+}
+
+// quoteEnd returns the index just past the quoted string, or identifier, starting at start.
+func quoteEnd(script string, start int) int {
+	quote := script[start]
+	for i := start + 1; i < len(script); i++ {
+		switch script[i] {
+		case '\\':
+			if quote != '`' {
+				i++
+			}
+		case quote:
+			if i+1 < len(script) && script[i+1] == quote {
+				i++ // A doubled quote stands for itself
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(script)
+}
+
+// applySchema runs the schema script on one connection, so its USE statements hold for what follows,
+// with the goengine database it creates renamed to name.
+func applySchema(server *sql.DB, name, script string) error {
+	ctx := context.Background()
+	conn, err := server.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for _, statement := range SplitStatements(script) {
+		if match := scriptDatabase.FindStringSubmatch(statement); match != nil {
+			statement = match[1] + " `" + name + "`"
+		}
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("%w in: %s", err, firstLine(statement))
+		}
+	}
+	return nil
+}
+
+// firstLine returns the first line of a statement, to say which one failed.
+func firstLine(statement string) string {
+	if i := strings.IndexByte(statement, '\n'); i >= 0 {
+		return statement[:i] + " ..."
+	}
+	return statement
+}
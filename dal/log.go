@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -31,29 +32,37 @@ type LogStatusCodes struct {
 //
 // It  inserts a log entry into a database using a SQL stored procedure, handling any errors that may occur during the execution.
 func InsertLog(statusCode, message, goEngineArea string) {
-	_, err := DB.Exec("CALL insert_log(?, ?, ?)", statusCode, message, goEngineArea)
+	_, err := execDB("CALL insert_log(?, ?, ?)", statusCode, message, goEngineArea)
 	if err != nil {
-		log.Println("Error inserting log:", err)
+		log.Printf("Error inserting log %s %s: %s: %v", statusCode, goEngineArea, message, err)
 	}
 }
 
-// This function creates & adds the log entries to a TextFile if the database is down
-func init() {
-	// Initialize the database first
-	if err := InitDB(); err != nil {
-		InsertLog("400", "Failed to initialize database", "init()")
-		log.Fatal(err)
-	}
+// setup remembers the outcome of Setup, which only runs once.
+var setup struct {
+	once sync.Once
+	err  error
+}
 
-	file, err := os.OpenFile("Logging.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
-		InsertLog("400", "Failed to open file", "init()")
-		log.Fatal(err)
-	} else {
-		InsertLog("200", "INIT Open File Success", "init()")
-	}
+// Setup connects to the database and sends the log to Logging.txt in the working directory, for the
+// programs backed by the database, such as the web server. A database that is down does not fail it:
+// calls fail fast while it is down, and Health reports the outage. Only the first call does anything.
+func Setup() error {
+	setup.once.Do(func() {
+		if err := InitDB(); err != nil {
+			log.Printf("Database unavailable, starting without it: %v", err)
+		}
 
-	log.SetOutput(file)
+		file, err := os.OpenFile("Logging.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+		if err != nil {
+			InsertLog("400", "Failed to open file", "Setup()")
+			setup.err = err
+			return
+		}
+		InsertLog("200", "INIT Open File Success", "Setup()")
+		log.SetOutput(file)
+	})
+	return setup.err
 }
 
 // WriteLog writes a log entry to the database
@@ -63,7 +72,7 @@ func init() {
 func WriteLog(logID string, status_code string, message string, goEngineArea string, dateTime time.Time) error {
 	// Validate the statusCode by checking if it exists in the `log_status_codes` table
 	var existingStatusCode string
-	err := DB.QueryRow("SELECT status_code FROM log_status_codes WHERE status_code = ?", status_code).Scan(&existingStatusCode)
+	err := queryRowDB("SELECT status_code FROM log_status_codes WHERE status_code = ?", status_code).Scan(&existingStatusCode)
 	if err != nil {
 		InsertLog("400", "Failed to query row", "WriteLog()")
 		if err == sql.ErrNoRows {
@@ -76,7 +85,7 @@ func WriteLog(logID string, status_code string, message string, goEngineArea str
 		return err
 	}
 	// Prepare the SQL statement for inserting into the log table
-	stmt, err := DB.Prepare("INSERT INTO log(log_ID, status_code, message, go_engine_area, date_time) VALUES (? ,? ,? ,? ,?)")
+	stmt, err := prepareDB("INSERT INTO log(log_ID, status_code, message, go_engine_area, date_time) VALUES (? ,? ,? ,? ,?)")
 	if err != nil {
 		InsertLog("400", "Failed to prepare SQL statement", "WriteLog()")
 		return err
@@ -103,7 +112,7 @@ func WriteLog(logID string, status_code string, message string, goEngineArea str
 // This Go code defines a function, "GetLog," that prepares and queries a database for logs, logging both successful and failed operations,
 // and returns a log objects along with potential errors.
 func GetLog() ([]Log, error) {
-	stmt, err := DB.Prepare("CALL select_all_logs()")
+	stmt, err := prepareDB("CALL select_all_logs()")
 	if err != nil {
 		InsertLog("400", "Failed to prepare SQL statement", "GetLog()")
 		return nil, err
@@ -150,7 +159,7 @@ func GetLog() ([]Log, error) {
 // It defines  defines a function that executes a SQL stored procedure "insert_or_update_status_code" with provided parameters "statusCode"
 // and "statusMessage" using the "DB" database connection and returns any potential errors.
 func InsertOrUpdateStatusCode(statusCode, statusMessage string) error {
-	_, err := DB.Exec("CALL insert_or_update_status_code(?, ?)", statusCode, statusMessage)
+	_, err := execDB("CALL insert_or_update_status_code(?, ?)", statusCode, statusMessage)
 	return err
 }
 
@@ -158,7 +167,7 @@ func InsertOrUpdateStatusCode(statusCode, statusMessage string) error {
 //
 // The code defines a function GetSuccess that retrieves log entries with a "Success" status code from a database, logs various status messages.
 func GetSuccess() ([]Log, error) {
-	stmt, err := DB.Prepare("CALL select_all_logs_by_status_code(?)")
+	stmt, err := prepareDB("CALL select_all_logs_by_status_code(?)")
 	if err != nil {
 		InsertLog("400", "Failed to prepare SQL statement", "GetSuccess()")
 		return nil, err
@@ -204,7 +213,7 @@ func GetSuccess() ([]Log, error) {
 
 // This code prepares and executes a SQL statement to store log information in a database, logging the status of the SQL operations during the process
 func StoreLog(status_code string, message string, goEngineArea string) error {
-	stmt, err := DB.Prepare("CALL insert_log(?,?,?)")
+	stmt, err := prepareDB("CALL insert_log(?,?,?)")
 	if err != nil {
 		InsertLog("400", "Failed to prepare SQL statement", "StoreLog()")
 		return err
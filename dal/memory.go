@@ -0,0 +1,796 @@
+package dal
+
+import (
+	"cmpscfa23team2/access"
+	"cmpscfa23team2/records"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a DataStore that keeps everything in process, for unit tests of code that would otherwise
+// need a MySQL instance. Lookups of missing rows fail with sql.ErrNoRows, like the database's.
+type MemoryStore struct {
+	*records.MemoryJobStore
+	*records.MemoryIdempotencyStore
+
+	mu          sync.RWMutex
+	users       map[string]User
+	permissions map[string][]Permission // By user role
+	crawlers    map[string]string
+	engines     map[string]ScraperEngine
+	urls        map[string]memoryURL
+	predictions []memoryPrediction
+	archive     []ArchivedPrediction
+	requests    map[string]PredictionRequest
+	outcomes    []PredictionOutcome
+	snapshots   map[string][]records.Snapshot // By URL hash, oldest first
+	quality     []records.ExpectationResult
+	latency     []records.LatencySample // Oldest run first
+	metrics     []records.RunMetric     // Oldest run first
+	alerts      []records.Alert         // Oldest first
+	workflows   map[string][]byte       // Workflow run records as JSON, by run ID
+	logs        []Log
+	statusCodes map[string]string
+}
+
+// memoryURL is a row of the urls table.
+type memoryURL struct {
+	url, domain string
+	tags        map[string]interface{}
+}
+
+// memoryPrediction is a row of one of the prediction tables.
+type memoryPrediction struct {
+	table string
+	ArchivedPrediction
+	madeAt, deletedAt time.Time
+}
+
+// NewMemoryStore creates an empty in-process DataStore with the log status codes the schema populates.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		MemoryJobStore:         records.NewMemoryJobStore(),
+		MemoryIdempotencyStore: records.NewMemoryIdempotencyStore(),
+		users:                  map[string]User{},
+		permissions:            map[string][]Permission{},
+		crawlers:               map[string]string{},
+		engines:                map[string]ScraperEngine{},
+		urls:                   map[string]memoryURL{},
+		requests:               map[string]PredictionRequest{},
+		snapshots:              map[string][]records.Snapshot{},
+		workflows:              map[string][]byte{},
+		statusCodes: map[string]string{
+			"200": "Normal operational mode",
+			"WAR": "Warring issue application still functional",
+			"400": "Severe error application not functional",
+		},
+	}
+}
+
+// memoryTime formats a time the way the database returns DATETIME columns.
+func memoryTime(t time.Time) string {
+	return t.UTC().Format(jobTimeLayout)
+}
+
+// Users and authentication
+
+func (s *MemoryStore) CreateUser(userName, userLogin, userRole string, userPassword string, activeOrNot bool) (string, error) {
+	return s.addUser(userName, userLogin, userRole, []byte(userPassword), activeOrNot)
+}
+
+func (s *MemoryStore) RegisterUser(username string, login string, role string, password string, active bool) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return s.addUser(username, login, role, hashedPassword, active)
+}
+
+// addUser stores a new user, whose login must be unique as in the users table.
+func (s *MemoryStore) addUser(userName, userLogin, userRole string, password []byte, active bool) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.UserLogin == userLogin {
+			return "", fmt.Errorf("duplicate user login %q", userLogin)
+		}
+	}
+	id := uuid.New().String()
+	s.users[id] = User{UserID: id, UserName: userName, UserLogin: userLogin, UserRole: userRole, UserPassword: password,
+		ActiveOrNot: active, UserDateAdded: memoryTime(time.Now())}
+	return id, nil
+}
+
+func (s *MemoryStore) UpdateUser(userID, userName, userLogin, userRole, userPassword string) error {
+	return s.updateUser(userID, func(u *User) {
+		u.UserName, u.UserLogin, u.UserRole, u.UserPassword = userName, userLogin, userRole, []byte(userPassword)
+	})
+}
+
+// updateUser changes a stored user. Like an UPDATE, a missing user is not an error.
+func (s *MemoryStore) updateUser(userID string, update func(u *User)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[userID]; ok {
+		update(&u)
+		s.users[userID] = u
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteUser(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.users, userID)
+	return nil
+}
+
+func (s *MemoryStore) GetUserByLogin(userLogin string) (*User, error) {
+	users := s.findUsers(func(u User) bool { return u.UserLogin == userLogin })
+	if len(users) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return users[0], nil
+}
+
+func (s *MemoryStore) GetUserByID(userID string) (*User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	u, ok := s.users[userID]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return &u, nil
+}
+
+func (s *MemoryStore) GetUsersByRole(role string) ([]*User, error) {
+	return s.findUsers(func(u User) bool { return u.UserRole == role }), nil
+}
+
+func (s *MemoryStore) GetAllUsers() ([]*User, error) {
+	return s.findUsers(func(User) bool { return true }), nil
+}
+
+// findUsers returns copies of the users that match, in the order they were added.
+func (s *MemoryStore) findUsers(match func(u User) bool) []*User {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var users []*User
+	for _, u := range s.users {
+		if match(u) {
+			u := u
+			users = append(users, &u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].UserDateAdded != users[j].UserDateAdded {
+			return users[i].UserDateAdded < users[j].UserDateAdded
+		}
+		return users[i].UserID < users[j].UserID
+	})
+	return users
+}
+
+func (s *MemoryStore) FetchUserIDByName(userName string) (string, error) {
+	users := s.findUsers(func(u User) bool { return u.UserName == userName })
+	if len(users) == 0 {
+		return "", sql.ErrNoRows
+	}
+	return users[0].UserID, nil
+}
+
+func (s *MemoryStore) AuthenticateUser(username string, password string) (string, error) {
+	u, err := s.GetUserByLogin(username)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("user not found")
+	}
+	if err := bcrypt.CompareHashAndPassword(u.UserPassword, []byte(password)); err != nil {
+		return "", err
+	}
+	return GenerateToken(u.UserID)
+}
+
+func (s *MemoryStore) ChangePassword(userID string, newPassword string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return s.updateUser(userID, func(u *User) { u.UserPassword = hashedPassword })
+}
+
+// LogoutUser does nothing: the MemoryStore keeps no sessions.
+func (s *MemoryStore) LogoutUser(userID string) error { return nil }
+
+// Authorization
+
+func (s *MemoryStore) GetUserRole(userID string) (string, error) {
+	u, err := s.GetUserByID(userID)
+	if err != nil {
+		return "", err
+	}
+	return u.UserRole, nil
+}
+
+func (s *MemoryStore) IsUserActive(userID string) (bool, error) {
+	u, err := s.GetUserByID(userID)
+	if err != nil {
+		return false, err
+	}
+	return u.ActiveOrNot, nil
+}
+
+func (s *MemoryStore) AuthorizeUser(userID string, requiredRole string) (bool, error) {
+	userRole, err := s.GetUserRole(userID)
+	return err == nil && userRole == requiredRole, err
+}
+
+func (s *MemoryStore) UpdateUserRole(userID, newRole string) error {
+	return s.updateUser(userID, func(u *User) { u.UserRole = newRole })
+}
+
+func (s *MemoryStore) DeactivateUser(userID string) error {
+	return s.updateUser(userID, func(u *User) { u.ActiveOrNot = false })
+}
+
+func (s *MemoryStore) GetPermissionsForRole(userRole string) ([]Permission, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Permission(nil), s.permissions[userRole]...), nil
+}
+
+func (s *MemoryStore) CheckPermission(userRole, action, resource string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.permissions[userRole] {
+		if p.Action == action && p.Resource == resource {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) AddPermission(userRole, action, resource string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.permissions[userRole] = append(s.permissions[userRole], NewPermission(action, resource))
+	return nil
+}
+
+func (s *MemoryStore) HasPermission(userID, action, resource string) (bool, error) {
+	userRole, err := s.GetUserRole(userID)
+	if err != nil {
+		return false, err
+	}
+	return s.CheckPermission(userRole, action, resource)
+}
+
+func (s *MemoryStore) APIRole(userID string) (access.Role, error) {
+	return apiRole(userID, s.IsUserActive, s.GetUserRole)
+}
+
+func (s *MemoryStore) AuditAPICall(entry access.AuditEntry) {
+	s.InsertLog(auditLogEntry(entry))
+}
+
+// Crawlers, scraper engines and URLs
+
+func (s *MemoryStore) CreateWebCrawler(sourceURL string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := uuid.New().String()
+	s.crawlers[id] = sourceURL
+	return id, nil
+}
+
+func (s *MemoryStore) CreateScraperEngine(engineName, engineDescription string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := uuid.New().String()
+	now := memoryTime(time.Now())
+	s.engines[id] = ScraperEngine{EngineID: id, Name: engineName, Description: engineDescription, Version: 1,
+		CreatedTime: now, UpdatedTime: now}
+	return id, nil
+}
+
+func (s *MemoryStore) GetScraperEngine(engineID string) (ScraperEngine, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	engine, ok := s.engines[engineID]
+	if !ok {
+		return ScraperEngine{}, sql.ErrNoRows
+	}
+	return engine, nil
+}
+
+func (s *MemoryStore) ListScraperEngines() ([]ScraperEngine, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var engines []ScraperEngine
+	for _, engine := range s.engines {
+		engines = append(engines, engine)
+	}
+	sort.Slice(engines, func(i, j int) bool { return engines[i].Name < engines[j].Name })
+	return engines, nil
+}
+
+func (s *MemoryStore) UpdateScraperEngine(engine ScraperEngine) (ScraperEngine, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.engines[engine.EngineID]
+	if !ok || stored.Version != engine.Version {
+		return engine, ErrVersionConflict
+	}
+	stored.Name, stored.Description = engine.Name, engine.Description
+	stored.Version++
+	stored.UpdatedTime = memoryTime(time.Now())
+	s.engines[engine.EngineID] = stored
+	return stored, nil
+}
+
+func (s *MemoryStore) DeleteScraperEngine(engineID string, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored, ok := s.engines[engineID]; !ok || stored.Version != version {
+		return ErrVersionConflict
+	}
+	delete(s.engines, engineID)
+	return nil
+}
+
+func (s *MemoryStore) InsertURL(url, domain string, tags map[string]interface{}) (string, error) {
+	stored, err := copyTags(tags)
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := uuid.New().String()
+	s.urls[id] = memoryURL{url: url, domain: domain, tags: stored}
+	return id, nil
+}
+
+func (s *MemoryStore) UpdateURL(id, url, domain string, tags map[string]interface{}) error {
+	stored, err := copyTags(tags)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.urls[id]; ok {
+		s.urls[id] = memoryURL{url: url, domain: domain, tags: stored}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetURLTagsAndDomain(id string) (map[string]interface{}, string, error) {
+	s.mu.RLock()
+	u, ok := s.urls[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, "", sql.ErrNoRows
+	}
+	tags, err := copyTags(u.tags)
+	return tags, u.domain, err
+}
+
+func (s *MemoryStore) GetURLsFromDomain(domain string) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var urls []string
+	for _, u := range s.urls {
+		if u.domain == domain {
+			urls = append(urls, u.url)
+		}
+	}
+	sort.Strings(urls)
+	return urls, nil
+}
+
+// copyTags round-trips tags through JSON, as the tags column does, so stored tags are not shared with
+// the caller and read back with the same types.
+func copyTags(tags map[string]interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(tags)
+	if err != nil {
+		return nil, err
+	}
+	var copied map[string]interface{}
+	err = json.Unmarshal(data, &copied)
+	return copied, err
+}
+
+// Predictions
+
+func (s *MemoryStore) InsertPrediction(algorithm, queryIdentifier, fileName, predictionInfo, skills string) error {
+	table, err := predictionTable(algorithm)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.predictions = append(s.predictions, memoryPrediction{table: table, madeAt: now, ArchivedPrediction: ArchivedPrediction{
+		Algorithm: algorithm, PredictionID: uuid.New().String(), QueryIdentifier: queryIdentifier, InputData: skills,
+		PredictionInfo: predictionInfo, PredictionTime: memoryTime(now)}})
+	return nil
+}
+
+func (s *MemoryStore) FetchPredictionData(queryIdentifier, domain string) (PredictionData, error) {
+	return fetchPredictionData(queryIdentifier, domain, func(table, queryIdentifier string) (string, string, error) {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		for _, p := range s.predictions {
+			if p.table == table && p.QueryIdentifier == queryIdentifier && p.deletedAt.IsZero() {
+				return p.InputData, p.PredictionInfo, nil
+			}
+		}
+		return "", "", sql.ErrNoRows
+	})
+}
+
+func (s *MemoryStore) DeletePrediction(algorithm, predictionID string) error {
+	if err := s.setPredictionDeleted(predictionID, time.Now()); err != nil {
+		return fmt.Errorf("no %s prediction %s to delete", algorithm, predictionID)
+	}
+	return nil
+}
+
+func (s *MemoryStore) RestorePrediction(algorithm, predictionID string) error {
+	if err := s.setPredictionDeleted(predictionID, time.Time{}); err != nil {
+		return fmt.Errorf("no deleted %s prediction %s to restore", algorithm, predictionID)
+	}
+	return nil
+}
+
+// setPredictionDeleted sets the deletion time of a prediction, zero to restore it. It fails if the
+// prediction is missing or already in that state.
+func (s *MemoryStore) setPredictionDeleted(predictionID string, deletedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range s.predictions {
+		if p.PredictionID == predictionID && p.deletedAt.IsZero() != deletedAt.IsZero() {
+			s.predictions[i].deletedAt = deletedAt
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (s *MemoryStore) ArchivePredictions(options ArchiveOptions) (int, error) {
+	if options.Before.IsZero() {
+		return 0, fmt.Errorf("archive predictions: no cutoff time")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var archived []ArchivedPrediction
+	kept := s.predictions[:0]
+	now := memoryTime(time.Now())
+	for _, p := range s.predictions {
+		deleted := !p.deletedAt.IsZero() && p.deletedAt.Before(options.Before)
+		if !deleted && (options.DeletedOnly || !p.madeAt.Before(options.Before)) {
+			kept = append(kept, p)
+			continue
+		}
+		a := p.ArchivedPrediction
+		if !p.deletedAt.IsZero() {
+			a.DeletedAt = memoryTime(p.deletedAt)
+		}
+		a.ArchivedAt = now
+		archived = append(archived, a)
+	}
+
+	if options.File != "" {
+		archive, err := openPredictionArchive(options.File)
+		if err != nil {
+			return 0, err
+		}
+		for _, a := range archived {
+			if err := archive.write(a); err != nil {
+				archive.Close()
+				return 0, err
+			}
+		}
+		if err := archive.Close(); err != nil {
+			return 0, err
+		}
+	} else {
+		s.archive = append(s.archive, archived...)
+	}
+	s.predictions = kept
+	return len(archived), nil
+}
+
+// ArchivedPredictions returns the predictions ArchivePredictions moved to the archive table.
+func (s *MemoryStore) ArchivedPredictions() []ArchivedPrediction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]ArchivedPrediction(nil), s.archive...)
+}
+
+func (s *MemoryStore) SavePredictionRequest(request PredictionRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request.Inputs = append([]string(nil), request.Inputs...)
+	request.Results = append([]string(nil), request.Results...)
+	request.Backends = append([]string(nil), request.Backends...)
+	s.requests[request.RequestID] = request
+	return nil
+}
+
+func (s *MemoryStore) GetPredictionRequest(requestID string) (PredictionRequest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	request, ok := s.requests[requestID]
+	if !ok {
+		return PredictionRequest{}, sql.ErrNoRows
+	}
+	request.Inputs = append([]string(nil), request.Inputs...)
+	request.Results = append([]string(nil), request.Results...)
+	request.Backends = append([]string(nil), request.Backends...)
+	return request, nil
+}
+
+func (s *MemoryStore) SavePredictionOutcomes(outcomes []PredictionOutcome) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range outcomes {
+		replaced := false
+		for i := range s.outcomes {
+			if s.outcomes[i].RequestID == o.RequestID && s.outcomes[i].Index == o.Index {
+				s.outcomes[i], replaced = o, true
+			}
+		}
+		if !replaced {
+			s.outcomes = append(s.outcomes, o)
+		}
+	}
+	sort.SliceStable(s.outcomes, func(i, j int) bool { return s.outcomes[i].ServedAt.Before(s.outcomes[j].ServedAt) })
+	return nil
+}
+
+func (s *MemoryStore) ListPredictionOutcomes(since time.Time) ([]PredictionOutcome, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var outcomes []PredictionOutcome
+	for _, o := range s.outcomes {
+		if !o.ServedAt.Before(since) {
+			outcomes = append(outcomes, o)
+		}
+	}
+	return outcomes, nil
+}
+
+// Snapshots and data quality results
+
+func (s *MemoryStore) SaveSnapshot(snapshot records.Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hash := records.URLHash(snapshot.URL)
+	snapshot.URLHash = hash
+	snapshot.Body = append([]byte(nil), snapshot.Body...)
+	snapshots := append(s.snapshots[hash], snapshot)
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].FetchedAt.Before(snapshots[j].FetchedAt) })
+	s.snapshots[hash] = snapshots
+	return nil
+}
+
+func (s *MemoryStore) ListSnapshots(rawURL string) ([]records.Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshots := []records.Snapshot{}
+	for _, snapshot := range s.snapshots[records.URLHash(rawURL)] {
+		snapshot.Body = nil
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+func (s *MemoryStore) LoadSnapshot(rawURL string, fetchedAt time.Time) (records.Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshots := s.snapshots[records.URLHash(rawURL)]
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		if fetchedAt.IsZero() || snapshots[i].FetchedAt.Equal(fetchedAt) {
+			snapshot := snapshots[i]
+			snapshot.Body = append([]byte(nil), snapshot.Body...)
+			return snapshot, nil
+		}
+	}
+	return records.Snapshot{}, sql.ErrNoRows
+}
+
+func (s *MemoryStore) SaveQualityResults(results []records.ExpectationResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quality = append(s.quality, results...)
+	return nil
+}
+
+// QualityResults returns every data quality result saved so far.
+func (s *MemoryStore) QualityResults() []records.ExpectationResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]records.ExpectationResult(nil), s.quality...)
+}
+
+// Crawl latency
+
+func (s *MemoryStore) SaveLatency(runID string, startedAt time.Time, domains []records.DomainLatency) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.latency[:0]
+	for _, sample := range s.latency {
+		if sample.RunID != runID {
+			kept = append(kept, sample)
+		}
+	}
+	s.latency = kept
+	for _, latency := range domains {
+		s.latency = append(s.latency, records.LatencySample{RunID: runID, Time: startedAt, DomainLatency: latency})
+	}
+	sort.SliceStable(s.latency, func(i, j int) bool { return s.latency[i].Time.Before(s.latency[j].Time) })
+	return nil
+}
+
+func (s *MemoryStore) LoadLatency(domain string, from, to time.Time) ([]records.LatencySample, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	samples := []records.LatencySample{}
+	for _, sample := range s.latency {
+		if (domain == "" || sample.Domain == domain) && (from.IsZero() || !sample.Time.Before(from)) &&
+			(to.IsZero() || !sample.Time.After(to)) {
+			samples = append(samples, sample)
+		}
+	}
+	return samples, nil
+}
+
+// Run metrics
+
+func (s *MemoryStore) SaveRunMetrics(metrics []records.RunMetric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, metric := range metrics {
+		replaced := false
+		for i, saved := range s.metrics {
+			if saved.RunID == metric.RunID && saved.Metric == metric.Metric && saved.Label == metric.Label {
+				s.metrics[i], replaced = metric, true
+				break
+			}
+		}
+		if !replaced {
+			s.metrics = append(s.metrics, metric)
+		}
+	}
+	sort.SliceStable(s.metrics, func(i, j int) bool { return s.metrics[i].Time.Before(s.metrics[j].Time) })
+	return nil
+}
+
+func (s *MemoryStore) LoadRunMetrics(q records.MetricQuery) ([]records.RunMetric, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	metrics := []records.RunMetric{}
+	for _, metric := range s.metrics {
+		if q.Matches(metric) {
+			metrics = append(metrics, metric)
+		}
+	}
+	return metrics, nil
+}
+
+// Alerts
+
+func (s *MemoryStore) SaveAlerts(alerts []records.Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = append(s.alerts, alerts...)
+	sort.SliceStable(s.alerts, func(i, j int) bool { return s.alerts[i].FiredAt.Before(s.alerts[j].FiredAt) })
+	return nil
+}
+
+func (s *MemoryStore) LoadAlerts(job string, since time.Time) ([]records.Alert, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	alerts := []records.Alert{}
+	for _, alert := range s.alerts {
+		if (job == "" || alert.Job == job) && (since.IsZero() || !alert.FiredAt.Before(since)) {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
+
+// Workflow runs
+
+func (s *MemoryStore) SaveWorkflowRun(record records.WorkflowRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workflows[record.RunID] = data
+	return nil
+}
+
+func (s *MemoryStore) LoadWorkflowRun(runID string) (records.WorkflowRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var record records.WorkflowRecord
+	data, ok := s.workflows[runID]
+	if !ok {
+		return record, sql.ErrNoRows
+	}
+	err := json.Unmarshal(data, &record)
+	return record, err
+}
+
+// Logs
+
+func (s *MemoryStore) InsertLog(statusCode, message, goEngineArea string) {
+	s.StoreLog(statusCode, message, goEngineArea)
+}
+
+func (s *MemoryStore) StoreLog(statusCode string, message string, goEngineArea string) error {
+	return s.WriteLog(uuid.New().String(), statusCode, message, goEngineArea, time.Now())
+}
+
+func (s *MemoryStore) WriteLog(logID string, statusCode string, message string, goEngineArea string, dateTime time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.statusCodes[statusCode]; !ok {
+		return fmt.Errorf("Invalid statusCode: %s", statusCode)
+	}
+	s.logs = append(s.logs, Log{LogID: logID, status_code: statusCode, Message: message, GoEngineArea: goEngineArea,
+		DateTime: []uint8(memoryTime(dateTime))})
+	return nil
+}
+
+func (s *MemoryStore) InsertOrUpdateStatusCode(statusCode, statusMessage string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statusCodes[statusCode] = statusMessage
+	return nil
+}
+
+func (s *MemoryStore) GetLog() ([]Log, error) {
+	return s.findLogs(func(Log) bool { return true }), nil
+}
+
+func (s *MemoryStore) GetSuccess() ([]Log, error) {
+	return s.findLogs(func(l Log) bool { return l.status_code == "200" }), nil
+}
+
+// findLogs returns the log entries that match, oldest first.
+func (s *MemoryStore) findLogs(match func(l Log) bool) []Log {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var logs []Log
+	for _, l := range s.logs {
+		if match(l) {
+			logs = append(logs, l)
+		}
+	}
+	return logs
+}
+
+// Messages returns the messages of the log entries of an area, oldest first, for tests to check what was
+// logged.
+func (s *MemoryStore) Messages(goEngineArea string) []string {
+	var messages []string
+	for _, l := range s.findLogs(func(l Log) bool { return l.GoEngineArea == goEngineArea }) {
+		messages = append(messages, l.Message)
+	}
+	return messages
+}
+
+// The stores must keep implementing the whole interface.
+var (
+	_ DataStore = MySQLStore{}
+	_ DataStore = (*MemoryStore)(nil)
+)
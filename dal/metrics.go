@@ -0,0 +1,123 @@
+package dal
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSlowQueryThreshold is how long a statement may take before it is logged as slow.
+const defaultSlowQueryThreshold = 500 * time.Millisecond
+
+// maxStatementKey caps the length of the statements metrics are kept by.
+const maxStatementKey = 120
+
+// QueryStats are the durations of one statement, e.g. "CALL get_job", over every call since startup.
+// Retries count as calls of their own, and a query's duration ends when its first row is ready.
+type QueryStats struct {
+	Statement string        `json:"statement"`
+	Calls     int64         `json:"calls"`
+	Errors    int64         `json:"errors"`
+	Slow      int64         `json:"slow"` // Calls that took longer than the slow query threshold
+	Total     time.Duration `json:"total_ns"`
+	Max       time.Duration `json:"max_ns"`
+}
+
+// Mean returns the average duration of a call.
+func (s QueryStats) Mean() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Calls)
+}
+
+var queryMetrics = struct {
+	sync.Mutex
+	threshold time.Duration
+	stats     map[string]*QueryStats
+}{threshold: slowQueryThresholdFromEnv(), stats: map[string]*QueryStats{}}
+
+// slowQueryThresholdFromEnv returns the threshold in milliseconds of $CRAB_DB_SLOW_QUERY_MS, or the
+// default.
+func slowQueryThresholdFromEnv() time.Duration {
+	if ms, err := strconv.Atoi(os.Getenv("CRAB_DB_SLOW_QUERY_MS")); err == nil && ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return defaultSlowQueryThreshold
+}
+
+// SetSlowQueryThreshold sets how long a statement may take before it is logged as slow.
+func SetSlowQueryThreshold(threshold time.Duration) {
+	queryMetrics.Lock()
+	defer queryMetrics.Unlock()
+	queryMetrics.threshold = threshold
+}
+
+// QueryMetrics returns the statistics of every statement run so far, the one with the most time spent
+// first.
+func QueryMetrics() []QueryStats {
+	queryMetrics.Lock()
+	defer queryMetrics.Unlock()
+	stats := make([]QueryStats, 0, len(queryMetrics.stats))
+	for _, s := range queryMetrics.stats {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Total != stats[j].Total {
+			return stats[i].Total > stats[j].Total
+		}
+		return stats[i].Statement < stats[j].Statement
+	})
+	return stats
+}
+
+// observeQuery records a call of query that started at start and ended with err, and logs it if it was
+// slow. Only the statement is logged, never its arguments, which may hold passwords.
+func observeQuery(query string, start time.Time, err error) {
+	elapsed := time.Since(start)
+	key := statementKey(query)
+	queryMetrics.Lock()
+	s, ok := queryMetrics.stats[key]
+	if !ok {
+		s = &QueryStats{Statement: key}
+		queryMetrics.stats[key] = s
+	}
+	s.Calls++
+	s.Total += elapsed
+	if elapsed > s.Max {
+		s.Max = elapsed
+	}
+	if err != nil {
+		s.Errors++
+	}
+	slow := queryMetrics.threshold > 0 && elapsed > queryMetrics.threshold
+	if slow {
+		s.Slow++
+	}
+	queryMetrics.Unlock()
+	if slow {
+		log.Printf("Slow query (%s): %s", elapsed.Round(time.Millisecond), key)
+	}
+}
+
+// statementKey reduces a query to the statement its metrics are kept by: the procedure of a CALL, or the
+// query up to the values of an INSERT, with its whitespace collapsed.
+func statementKey(query string) string {
+	key := strings.Join(strings.Fields(query), " ")
+	if strings.HasPrefix(strings.ToUpper(key), "CALL ") {
+		if i := strings.Index(key, "("); i > 0 {
+			key = key[:i]
+		}
+		key = "CALL " + strings.TrimSpace(key[len("CALL "):])
+	} else if i := strings.Index(strings.ToUpper(key), " VALUES"); i > 0 {
+		key = key[:i]
+	}
+	if len(key) > maxStatementKey {
+		key = key[:maxStatementKey]
+	}
+	return key
+}
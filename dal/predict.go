@@ -0,0 +1,160 @@
+package dal
+
+import (
+	"cmpscfa23team2/records"
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"time"
+)
+
+// PredictionRequest is a batch of inputs submitted for prediction through the REST API, with their
+// results once predicted. Batches too large to predict while the client waits run as jobs, and clients
+// poll the request by ID until it is finished.
+type PredictionRequest struct {
+	RequestID  string           `json:"id"`
+	JobID      string           `json:"job_id,omitempty"` // Job predicting the batch, empty when predicted synchronously
+	State      records.JobState `json:"state"`
+	Inputs     []string         `json:"inputs"`
+	Results    []string         `json:"results,omitempty"`  // One per input, in the same order
+	Backends   []string         `json:"backends,omitempty"` // Predictor backend that served each result
+	Error      string           `json:"error,omitempty"`
+	CreatedAt  time.Time        `json:"created_at"`
+	FinishedAt time.Time        `json:"finished_at,omitempty"`
+}
+
+// NewPredictionRequest creates a queued request for the inputs, with a new ID.
+func NewPredictionRequest(inputs []string) PredictionRequest {
+	return PredictionRequest{
+		RequestID: uuid.New().String(),
+		State:     records.JobQueued,
+		Inputs:    inputs,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Function to insert or update a prediction request
+//
+// SavePredictionRequest stores the request's current state and results, creating the row the first time
+// the request is seen.
+func SavePredictionRequest(request PredictionRequest) error {
+	inputs, err := json.Marshal(request.Inputs)
+	if err != nil {
+		InsertLog("400", "Error marshalling prediction inputs: "+err.Error(), "SavePredictionRequest()")
+		return err
+	}
+	results, err := nullJSON(request.Results)
+	if err != nil {
+		InsertLog("400", "Error marshalling prediction results: "+err.Error(), "SavePredictionRequest()")
+		return err
+	}
+	backends, err := nullJSON(request.Backends)
+	if err != nil {
+		InsertLog("400", "Error marshalling prediction backends: "+err.Error(), "SavePredictionRequest()")
+		return err
+	}
+	var jobID interface{}
+	if request.JobID != "" {
+		jobID = request.JobID
+	}
+
+	_, err = execDB("CALL save_prediction_request(?, ?, ?, ?, ?, ?, ?, ?, ?)", request.RequestID, jobID,
+		string(request.State), string(inputs), results, backends, request.Error,
+		request.CreatedAt.UTC().Format(jobTimeLayout), nullJobTime(request.FinishedAt))
+	if err != nil {
+		InsertLog("400", "Error saving prediction request: "+err.Error(), "SavePredictionRequest()")
+		return err
+	}
+	return nil
+}
+
+// Function to fetch a prediction request by ID
+//
+// GetPredictionRequest loads a prediction request, failing with sql.ErrNoRows if it does not exist.
+func GetPredictionRequest(requestID string) (PredictionRequest, error) {
+	var request PredictionRequest
+	var jobID, results, backends, errorMessage, finished sql.NullString
+	var state, inputs, created string
+	err := queryRowDB("CALL get_prediction_request(?)", requestID).Scan(&request.RequestID, &jobID, &state, &inputs,
+		&results, &backends, &errorMessage, &created, &finished)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			InsertLog("400", "Error getting prediction request: "+err.Error(), "GetPredictionRequest()")
+		}
+		return PredictionRequest{}, err
+	}
+	if err := json.Unmarshal([]byte(inputs), &request.Inputs); err != nil {
+		return PredictionRequest{}, err
+	}
+	for _, column := range []struct {
+		value sql.NullString
+		into  *[]string
+	}{{results, &request.Results}, {backends, &request.Backends}} {
+		if column.value.Valid {
+			if err := json.Unmarshal([]byte(column.value.String), column.into); err != nil {
+				return PredictionRequest{}, err
+			}
+		}
+	}
+	request.JobID, request.State, request.Error = jobID.String, records.JobState(state), errorMessage.String
+	request.CreatedAt, _ = time.Parse(jobTimeLayout, created)
+	if finished.Valid {
+		request.FinishedAt, _ = time.Parse(jobTimeLayout, finished.String)
+	}
+	return request, nil
+}
+
+// nullJSON marshals values for a JSON column, storing nil as NULL.
+func nullJSON(values []string) (interface{}, error) {
+	if values == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(values)
+	return string(data), err
+}
+
+// outcomeTimeLayout is the DATETIME(3) format used for the times predictions were served.
+const outcomeTimeLayout = "2006-01-02 15:04:05.000"
+
+// Function to record served predictions
+//
+// SavePredictionOutcomes records which backend served each prediction of a request, with its output and
+// latency, for ComparePredictors.
+func SavePredictionOutcomes(outcomes []PredictionOutcome) error {
+	for _, o := range outcomes {
+		_, err := execDB("CALL save_prediction_outcome(?, ?, ?, ?, ?, ?, ?)", o.RequestID, o.Index, o.Backend, o.Output,
+			int64(o.Latency), o.Error, o.ServedAt.UTC().Format(outcomeTimeLayout))
+		if err != nil {
+			InsertLog("400", "Error saving prediction outcome: "+err.Error(), "SavePredictionOutcomes()")
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to list served predictions
+//
+// ListPredictionOutcomes returns the predictions served since a time, oldest first.
+func ListPredictionOutcomes(since time.Time) ([]PredictionOutcome, error) {
+	rows, err := queryDB("CALL list_prediction_outcomes(?)", since.UTC().Format(outcomeTimeLayout))
+	if err != nil {
+		InsertLog("400", "Error listing prediction outcomes: "+err.Error(), "ListPredictionOutcomes()")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var outcomes []PredictionOutcome
+	for rows.Next() {
+		var o PredictionOutcome
+		var output, errorMessage sql.NullString
+		var served string
+		if err := rows.Scan(&o.RequestID, &o.Index, &o.Backend, &output, &o.Latency, &errorMessage, &served); err != nil {
+			InsertLog("400", "Error scanning prediction outcome: "+err.Error(), "ListPredictionOutcomes()")
+			return nil, err
+		}
+		o.Output, o.Error = output.String, errorMessage.String
+		o.ServedAt, _ = time.Parse(outcomeTimeLayout, served)
+		outcomes = append(outcomes, o)
+	}
+	return outcomes, rows.Err()
+}
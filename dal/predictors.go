@@ -0,0 +1,243 @@
+package dal
+
+import (
+	"cmpscfa23team2/records"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxReportedOutputs is how many of a backend's most frequent outputs ComparePredictors reports.
+const maxReportedOutputs = 10
+
+// Predictor is a backend that predicts one input, such as an ML model or a service hosting one.
+type Predictor interface {
+	Predict(input string) (string, error)
+}
+
+// PredictorFunc adapts a function to a Predictor.
+type PredictorFunc func(input string) (string, error)
+
+// Predict calls f.
+func (f PredictorFunc) Predict(input string) (string, error) { return f(input) }
+
+// SimulatedPredictor is the simulated ML model of PerformMLPrediction.
+var SimulatedPredictor Predictor = PredictorFunc(func(input string) (string, error) {
+	return PerformMLPrediction(input), nil
+})
+
+// DefaultPredictors routes the predictions of the REST API. It starts out sending everything to the
+// SimulatedPredictor; register other backends on it to A/B test them.
+var DefaultPredictors = NewPredictorRouter()
+
+func init() {
+	DefaultPredictors.Register("simulated", SimulatedPredictor, 1)
+}
+
+// PredictorRouter spreads predictions over registered backends in proportion to their traffic weights,
+// recording which backend served each one and how long it took.
+type PredictorRouter struct {
+	mu       sync.Mutex
+	backends []weightedPredictor
+	random   *rand.Rand
+}
+
+// weightedPredictor is a backend registered on a PredictorRouter.
+type weightedPredictor struct {
+	name      string
+	predictor Predictor
+	weight    int
+}
+
+// NewPredictorRouter creates a router with no backends.
+func NewPredictorRouter() *PredictorRouter {
+	return &PredictorRouter{random: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// Register adds a backend that gets weight out of the sum of all weights of the traffic, or changes the
+// backend and weight of the one registered under name. A weight of 0 stops sending it traffic.
+func (r *PredictorRouter) Register(name string, predictor Predictor, weight int) error {
+	if name == "" || predictor == nil || weight < 0 {
+		return fmt.Errorf("predictor %q needs a backend and a weight of at least 0", name)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.backends {
+		if r.backends[i].name == name {
+			r.backends[i] = weightedPredictor{name, predictor, weight}
+			return nil
+		}
+	}
+	r.backends = append(r.backends, weightedPredictor{name, predictor, weight})
+	return nil
+}
+
+// Weights returns the traffic weight of each registered backend.
+func (r *PredictorRouter) Weights() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	weights := make(map[string]int, len(r.backends))
+	for _, b := range r.backends {
+		weights[b.name] = b.weight
+	}
+	return weights
+}
+
+// pick chooses a backend at random in proportion to the weights.
+func (r *PredictorRouter) pick() (weightedPredictor, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	total := 0
+	for _, b := range r.backends {
+		total += b.weight
+	}
+	if total == 0 {
+		return weightedPredictor{}, false
+	}
+	n := r.random.Intn(total)
+	for _, b := range r.backends {
+		if n < b.weight {
+			return b, true
+		}
+		n -= b.weight
+	}
+	return weightedPredictor{}, false
+}
+
+// PredictionOutcome is one prediction as served by a backend.
+type PredictionOutcome struct {
+	RequestID string        `json:"request_id"`
+	Index     int           `json:"index"` // Of the input in its request
+	Backend   string        `json:"backend"`
+	Output    string        `json:"output"`
+	Latency   time.Duration `json:"latency_ns"`
+	Error     string        `json:"error,omitempty"`
+	ServedAt  time.Time     `json:"served_at"`
+}
+
+// Predict predicts input with a backend picked by weight.
+func (r *PredictorRouter) Predict(input string) PredictionOutcome {
+	backend, ok := r.pick()
+	if !ok {
+		return PredictionOutcome{Error: "no predictor backend has traffic", ServedAt: time.Now()}
+	}
+	start := time.Now()
+	output, err := backend.predictor.Predict(input)
+	outcome := PredictionOutcome{Backend: backend.name, Output: output, Latency: time.Since(start), ServedAt: start}
+	if err != nil {
+		outcome.Error = err.Error()
+	}
+	return outcome
+}
+
+// PredictRequest predicts each input of request with a backend picked by weight, recording the results
+// and the backend of each, or why they stopped, and the final state in it. It returns every prediction
+// served, for SavePredictionOutcomes.
+func (r *PredictorRouter) PredictRequest(ctx context.Context, request *PredictionRequest) []PredictionOutcome {
+	results := make([]string, 0, len(request.Inputs))
+	backends := make([]string, 0, len(request.Inputs))
+	var outcomes []PredictionOutcome
+	defer func() {
+		request.Results, request.Backends, request.FinishedAt = results, backends, time.Now()
+	}()
+	for i, input := range request.Inputs {
+		if err := ctx.Err(); err != nil {
+			request.State, request.Error = records.JobCancelled, err.Error()
+			return outcomes
+		}
+		outcome := r.Predict(input)
+		outcome.RequestID, outcome.Index = request.RequestID, i
+		if outcome.Backend != "" {
+			outcomes = append(outcomes, outcome)
+		}
+		if outcome.Error != "" {
+			request.State, request.Error = records.JobFailed, fmt.Sprintf("input %d: %s", i, outcome.Error)
+			return outcomes
+		}
+		results = append(results, outcome.Output)
+		backends = append(backends, outcome.Backend)
+	}
+	request.State = records.JobSucceeded
+	return outcomes
+}
+
+// PredictorReport compares the outputs and latencies of one backend with the others'.
+type PredictorReport struct {
+	Backend         string        `json:"backend"`
+	Predictions     int           `json:"predictions"`
+	Errors          int           `json:"errors"`
+	MeanLatency     time.Duration `json:"mean_latency_ns"`
+	P50Latency      time.Duration `json:"p50_latency_ns"`
+	P95Latency      time.Duration `json:"p95_latency_ns"`
+	MaxLatency      time.Duration `json:"max_latency_ns"`
+	DistinctOutputs int           `json:"distinct_outputs"`
+	TopOutputs      []OutputShare `json:"top_outputs"` // Most frequent first
+}
+
+// OutputShare is how often a backend gave one output.
+type OutputShare struct {
+	Output string  `json:"output"`
+	Count  int     `json:"count"`
+	Share  float64 `json:"share"` // Of the backend's successful predictions
+}
+
+// ComparePredictors summarizes the output distribution and latencies of each backend in outcomes, by
+// backend name. Failed predictions count towards latencies but not outputs.
+func ComparePredictors(outcomes []PredictionOutcome) []PredictorReport {
+	byBackend := map[string][]PredictionOutcome{}
+	for _, o := range outcomes {
+		byBackend[o.Backend] = append(byBackend[o.Backend], o)
+	}
+	reports := make([]PredictorReport, 0, len(byBackend))
+	for backend, served := range byBackend {
+		report := PredictorReport{Backend: backend, Predictions: len(served)}
+		latencies := make([]time.Duration, len(served))
+		outputs := map[string]int{}
+		var total time.Duration
+		for i, o := range served {
+			latencies[i] = o.Latency
+			total += o.Latency
+			if o.Error != "" {
+				report.Errors++
+			} else {
+				outputs[o.Output]++
+			}
+		}
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		report.MeanLatency = total / time.Duration(len(served))
+		report.P50Latency = latencyPercentile(latencies, 0.50)
+		report.P95Latency = latencyPercentile(latencies, 0.95)
+		report.MaxLatency = latencies[len(latencies)-1]
+
+		report.DistinctOutputs = len(outputs)
+		succeeded := len(served) - report.Errors
+		for output, count := range outputs {
+			report.TopOutputs = append(report.TopOutputs, OutputShare{output, count, float64(count) / float64(succeeded)})
+		}
+		sort.Slice(report.TopOutputs, func(i, j int) bool {
+			if report.TopOutputs[i].Count != report.TopOutputs[j].Count {
+				return report.TopOutputs[i].Count > report.TopOutputs[j].Count
+			}
+			return report.TopOutputs[i].Output < report.TopOutputs[j].Output
+		})
+		if len(report.TopOutputs) > maxReportedOutputs {
+			report.TopOutputs = report.TopOutputs[:maxReportedOutputs]
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Backend < reports[j].Backend })
+	return reports
+}
+
+// latencyPercentile returns the nearest-rank percentile q of sorted latencies.
+func latencyPercentile(sorted []time.Duration, q float64) time.Duration {
+	rank := int(math.Ceil(q * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
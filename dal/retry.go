@@ -0,0 +1,261 @@
+package dal
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrDatabaseUnavailable is returned without touching the database while the circuit breaker is open.
+var ErrDatabaseUnavailable = errors.New("database unavailable")
+
+// RetryPolicy says how database calls that fail with transient errors (deadlocks, lock wait timeouts,
+// lost connections) are retried, and when the database is taken for down.
+type RetryPolicy struct {
+	Attempts         int           // Tries per call, the first included
+	Backoff          time.Duration // Wait before the first retry, doubled for every retry after it
+	MaxBackoff       time.Duration
+	BreakerThreshold int           // Consecutive failed calls that open the circuit breaker
+	BreakerCooldown  time.Duration // How long the breaker stays open before a call is let through to probe
+}
+
+// defaultRetryPolicy is used unless SetRetryPolicy replaces it.
+var defaultRetryPolicy = RetryPolicy{
+	Attempts:         4,
+	Backoff:          200 * time.Millisecond,
+	MaxBackoff:       5 * time.Second,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+}
+
+// DBHealth is the state of the database as seen by the circuit breaker.
+type DBHealth struct {
+	Status    string    `json:"status"`   // "up", or "down" while the breaker is open
+	Failures  int       `json:"failures"` // Consecutive failed calls
+	LastError string    `json:"last_error,omitempty"`
+	DownSince time.Time `json:"down_since,omitempty"`
+	RetryAt   time.Time `json:"retry_at,omitempty"` // When the next call is let through to probe the database
+}
+
+// circuitBreaker sits in front of the database. It opens after BreakerThreshold consecutive calls failed
+// with transient errors, so callers fail fast while the database is down, and lets one call through after
+// every cooldown to find out whether it is back.
+type circuitBreaker struct {
+	sync.Mutex
+	policy    RetryPolicy
+	failures  int
+	lastError error
+	openedAt  time.Time
+	retryAt   time.Time
+}
+
+// breaker is set up before the init functions run, as the database is opened by one of them.
+var breaker = &circuitBreaker{policy: retryPolicyFromEnv()}
+
+// retryPolicyFromEnv returns the default policy with the attempts of $CRAB_DB_RETRY_ATTEMPTS, if set. It
+// is read from the environment as the database is opened before SetRetryPolicy can be called.
+func retryPolicyFromEnv() RetryPolicy {
+	policy := defaultRetryPolicy
+	if attempts, err := strconv.Atoi(os.Getenv("CRAB_DB_RETRY_ATTEMPTS")); err == nil && attempts > 0 {
+		policy.Attempts = attempts
+	}
+	return policy
+}
+
+// SetRetryPolicy replaces how database calls are retried. Zero fields keep their defaults.
+func SetRetryPolicy(policy RetryPolicy) {
+	if policy.Attempts <= 0 {
+		policy.Attempts = defaultRetryPolicy.Attempts
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = defaultRetryPolicy.Backoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = defaultRetryPolicy.MaxBackoff
+	}
+	if policy.BreakerThreshold <= 0 {
+		policy.BreakerThreshold = defaultRetryPolicy.BreakerThreshold
+	}
+	if policy.BreakerCooldown <= 0 {
+		policy.BreakerCooldown = defaultRetryPolicy.BreakerCooldown
+	}
+	breaker.Lock()
+	defer breaker.Unlock()
+	breaker.policy = policy
+}
+
+// Health reports whether the database is reachable, for health checks.
+func Health() DBHealth {
+	breaker.Lock()
+	defer breaker.Unlock()
+	health := DBHealth{Status: "up", Failures: breaker.failures}
+	if breaker.lastError != nil {
+		health.LastError = breaker.lastError.Error()
+	}
+	if !breaker.openedAt.IsZero() || DB == nil {
+		health.Status, health.DownSince, health.RetryAt = "down", breaker.openedAt, breaker.retryAt
+	}
+	return health
+}
+
+// allowCall reports whether a call may go to the database. While the breaker is open only one call per
+// cooldown is let through.
+func allowCall() bool {
+	breaker.Lock()
+	defer breaker.Unlock()
+	if breaker.openedAt.IsZero() {
+		return true
+	}
+	now := time.Now()
+	if now.Before(breaker.retryAt) {
+		return false
+	}
+	breaker.retryAt = now.Add(breaker.policy.BreakerCooldown) // Half-open: this call is the probe
+	return true
+}
+
+// recordCall updates the breaker with the outcome of a call. Only transient errors count as failures:
+// a missing row or a rejected statement means the database is up.
+func recordCall(err error) {
+	breaker.Lock()
+	defer breaker.Unlock()
+	if err == nil || !isTransient(err) {
+		if !breaker.openedAt.IsZero() {
+			log.Printf("Database is back after being down since %s", breaker.openedAt.Format(time.RFC3339))
+		}
+		breaker.failures, breaker.lastError, breaker.openedAt, breaker.retryAt = 0, nil, time.Time{}, time.Time{}
+		return
+	}
+	breaker.failures++
+	breaker.lastError = err
+	if breaker.openedAt.IsZero() && breaker.failures >= breaker.policy.BreakerThreshold {
+		breaker.openedAt = time.Now()
+		breaker.retryAt = breaker.openedAt.Add(breaker.policy.BreakerCooldown)
+		log.Printf("Database is down after %d failed calls, last: %v; failing calls until %s", breaker.failures, err,
+			breaker.retryAt.Format(time.RFC3339))
+	}
+}
+
+// resetBreaker closes the breaker, so an explicit reconnect is not refused while it is open.
+func resetBreaker() {
+	breaker.Lock()
+	defer breaker.Unlock()
+	breaker.failures, breaker.lastError, breaker.openedAt, breaker.retryAt = 0, nil, time.Time{}, time.Time{}
+}
+
+// tripBreaker opens the breaker at once, when the database could not be reached at startup.
+func tripBreaker(err error) {
+	breaker.Lock()
+	defer breaker.Unlock()
+	breaker.lastError = err
+	if breaker.openedAt.IsZero() {
+		breaker.openedAt = time.Now()
+		breaker.retryAt = breaker.openedAt.Add(breaker.policy.BreakerCooldown)
+	}
+}
+
+// isTransient reports whether err may go away when the call is repeated.
+func isTransient(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		case 1205, 1213: // Lock wait timeout, deadlock
+			return true
+		case 1040, 1053, 2006, 2013: // Too many connections, server shutdown, server gone, connection lost
+			return true
+		}
+		return false
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &netErr)
+}
+
+// withRetry runs call, which runs query, repeating it with exponential backoff while it fails with
+// transient errors, and fails fast with ErrDatabaseUnavailable while the breaker is open. Every attempt
+// is timed for the query metrics.
+func withRetry(query string, call func() error) error {
+	breaker.Lock()
+	policy := breaker.policy
+	breaker.Unlock()
+
+	backoff := policy.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if DB == nil || !allowCall() {
+			if err == nil {
+				return ErrDatabaseUnavailable
+			}
+			return fmt.Errorf("%w: %v", ErrDatabaseUnavailable, err)
+		}
+		start := time.Now()
+		err = call()
+		observeQuery(query, start, err)
+		recordCall(err)
+		if err == nil || !isTransient(err) || attempt >= policy.Attempts {
+			return err
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// execDB is DB.Exec with retries.
+func execDB(query string, args ...interface{}) (sql.Result, error) {
+	var result sql.Result
+	err := withRetry(query, func() (err error) {
+		result, err = DB.Exec(query, args...)
+		return err
+	})
+	return result, err
+}
+
+// queryDB is DB.Query with retries.
+func queryDB(query string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := withRetry(query, func() (err error) {
+		rows, err = DB.Query(query, args...)
+		return err
+	})
+	return rows, err
+}
+
+// prepareDB is DB.Prepare with retries.
+func prepareDB(query string) (*sql.Stmt, error) {
+	var stmt *sql.Stmt
+	err := withRetry(query, func() (err error) {
+		stmt, err = DB.Prepare(query)
+		return err
+	})
+	return stmt, err
+}
+
+// retryRow is DB.QueryRow with retries, which run when the row is scanned.
+type retryRow struct {
+	query string
+	args  []interface{}
+}
+
+// queryRowDB is DB.QueryRow with retries.
+func queryRowDB(query string, args ...interface{}) retryRow {
+	return retryRow{query, args}
+}
+
+// Scan runs the query and copies the columns of its first row into dest, like sql.Row.Scan.
+func (r retryRow) Scan(dest ...interface{}) error {
+	return withRetry(r.query, func() error {
+		return DB.QueryRow(r.query, r.args...).Scan(dest...)
+	})
+}
@@ -0,0 +1,273 @@
+package dal
+
+import (
+	"cmpscfa23team2/access"
+	"cmpscfa23team2/records"
+	"time"
+)
+
+// DataStore is every operation of the dal that reads or writes stored data. Code that takes a DataStore
+// instead of calling the package functions can be unit-tested against a MemoryStore, without a MySQL
+// instance, and run on another store. MySQLStore is the one backed by the database. Both are every store
+// crab writes to (crab.JobStore, crab.SnapshotStore and the others), whose methods are listed first.
+type DataStore interface {
+	// Jobs
+	SaveJob(job records.Job) error
+	GetJob(id string) (records.Job, error)
+	ListJobs() ([]records.Job, error)
+
+	// Page snapshots
+	SaveSnapshot(snapshot records.Snapshot) error
+	ListSnapshots(rawURL string) ([]records.Snapshot, error)
+	LoadSnapshot(rawURL string, fetchedAt time.Time) (records.Snapshot, error)
+
+	// Runs: data quality, latencies, metrics, alerts and workflows
+	SaveQualityResults(results []records.ExpectationResult) error
+	SaveLatency(runID string, startedAt time.Time, domains []records.DomainLatency) error
+	LoadLatency(domain string, from, to time.Time) ([]records.LatencySample, error)
+	SaveRunMetrics(metrics []records.RunMetric) error
+	LoadRunMetrics(q records.MetricQuery) ([]records.RunMetric, error)
+	SaveAlerts(alerts []records.Alert) error
+	LoadAlerts(job string, since time.Time) ([]records.Alert, error)
+	SaveWorkflowRun(record records.WorkflowRecord) error
+	LoadWorkflowRun(runID string) (records.WorkflowRecord, error)
+
+	// Idempotency keys of API requests
+	ClaimIdempotencyKey(record records.IdempotencyRecord, expiredBefore time.Time) (records.IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(record records.IdempotencyRecord) error
+	ReleaseIdempotencyKey(scope, key string) error
+
+	// Users and authentication
+	CreateUser(userName, userLogin, userRole string, userPassword string, activeOrNot bool) (string, error)
+	RegisterUser(username string, login string, role string, password string, active bool) (string, error)
+	UpdateUser(userID, userName, userLogin, userRole, userPassword string) error
+	DeleteUser(userID string) error
+	GetUserByLogin(userLogin string) (*User, error)
+	GetUserByID(userID string) (*User, error)
+	GetUsersByRole(role string) ([]*User, error)
+	GetAllUsers() ([]*User, error)
+	FetchUserIDByName(userName string) (string, error)
+	AuthenticateUser(username string, password string) (string, error)
+	ChangePassword(userID string, newPassword string) error
+	LogoutUser(userID string) error
+
+	// Authorization
+	GetUserRole(userID string) (string, error)
+	IsUserActive(userID string) (bool, error)
+	AuthorizeUser(userID string, requiredRole string) (bool, error)
+	UpdateUserRole(userID, newRole string) error
+	DeactivateUser(userID string) error
+	GetPermissionsForRole(userRole string) ([]Permission, error)
+	CheckPermission(userRole, action, resource string) (bool, error)
+	AddPermission(userRole, action, resource string) error
+	HasPermission(userID, action, resource string) (bool, error)
+	APIRole(userID string) (access.Role, error)
+	AuditAPICall(entry access.AuditEntry)
+
+	// Crawlers, scraper engines and URLs
+	CreateWebCrawler(sourceURL string) (string, error)
+	CreateScraperEngine(engineName, engineDescription string) (string, error)
+	GetScraperEngine(engineID string) (ScraperEngine, error)
+	ListScraperEngines() ([]ScraperEngine, error)
+	UpdateScraperEngine(engine ScraperEngine) (ScraperEngine, error)
+	DeleteScraperEngine(engineID string, version int) error
+	InsertURL(url, domain string, tags map[string]interface{}) (string, error)
+	UpdateURL(id, url, domain string, tags map[string]interface{}) error
+	GetURLTagsAndDomain(id string) (map[string]interface{}, string, error)
+	GetURLsFromDomain(domain string) ([]string, error)
+
+	// Predictions
+	InsertPrediction(algorithm, queryIdentifier, fileName, predictionInfo, skills string) error
+	FetchPredictionData(queryIdentifier, domain string) (PredictionData, error)
+	DeletePrediction(algorithm, predictionID string) error
+	RestorePrediction(algorithm, predictionID string) error
+	ArchivePredictions(options ArchiveOptions) (int, error)
+	SavePredictionRequest(request PredictionRequest) error
+	GetPredictionRequest(requestID string) (PredictionRequest, error)
+	SavePredictionOutcomes(outcomes []PredictionOutcome) error
+	ListPredictionOutcomes(since time.Time) ([]PredictionOutcome, error)
+
+	// Logs
+	InsertLog(statusCode, message, goEngineArea string)
+	StoreLog(statusCode string, message string, goEngineArea string) error
+	WriteLog(logID string, statusCode string, message string, goEngineArea string, dateTime time.Time) error
+	InsertOrUpdateStatusCode(statusCode, statusMessage string) error
+	GetLog() ([]Log, error)
+	GetSuccess() ([]Log, error)
+}
+
+// MySQLStore is the DataStore of the MySQL database the package functions use.
+type MySQLStore struct {
+	JobStore
+	SnapshotStore
+	QualityStore
+	LatencyStore
+	MetricsStore
+	AlertStore
+	WorkflowStore
+	IdempotencyStore
+}
+
+func (MySQLStore) CreateUser(userName, userLogin, userRole string, userPassword string, activeOrNot bool) (string, error) {
+	return CreateUser(userName, userLogin, userRole, userPassword, activeOrNot)
+}
+
+func (MySQLStore) RegisterUser(username string, login string, role string, password string, active bool) (string, error) {
+	return RegisterUser(username, login, role, password, active)
+}
+
+func (MySQLStore) UpdateUser(userID, userName, userLogin, userRole, userPassword string) error {
+	return UpdateUser(userID, userName, userLogin, userRole, userPassword)
+}
+
+func (MySQLStore) DeleteUser(userID string) error { return DeleteUser(userID) }
+
+func (MySQLStore) GetUserByLogin(userLogin string) (*User, error) { return GetUserByLogin(userLogin) }
+
+func (MySQLStore) GetUserByID(userID string) (*User, error) { return GetUserByID(userID) }
+
+func (MySQLStore) GetUsersByRole(role string) ([]*User, error) { return GetUsersByRole(role) }
+
+func (MySQLStore) GetAllUsers() ([]*User, error) { return GetAllUsers() }
+
+func (MySQLStore) FetchUserIDByName(userName string) (string, error) {
+	return FetchUserIDByName(userName)
+}
+
+func (MySQLStore) AuthenticateUser(username string, password string) (string, error) {
+	return AuthenticateUser(username, password)
+}
+
+func (MySQLStore) ChangePassword(userID string, newPassword string) error {
+	return ChangePassword(userID, newPassword)
+}
+
+func (MySQLStore) LogoutUser(userID string) error { return LogoutUser(userID) }
+
+func (MySQLStore) GetUserRole(userID string) (string, error) { return GetUserRole(userID) }
+
+func (MySQLStore) IsUserActive(userID string) (bool, error) { return IsUserActive(userID) }
+
+func (MySQLStore) AuthorizeUser(userID string, requiredRole string) (bool, error) {
+	return AuthorizeUser(userID, requiredRole)
+}
+
+func (MySQLStore) UpdateUserRole(userID, newRole string) error {
+	return UpdateUserRole(userID, newRole)
+}
+
+func (MySQLStore) DeactivateUser(userID string) error { return DeactivateUser(userID) }
+
+func (MySQLStore) GetPermissionsForRole(userRole string) ([]Permission, error) {
+	return GetPermissionsForRole(userRole)
+}
+
+func (MySQLStore) CheckPermission(userRole, action, resource string) (bool, error) {
+	return CheckPermission(userRole, action, resource)
+}
+
+func (MySQLStore) AddPermission(userRole, action, resource string) error {
+	return AddPermission(userRole, action, resource)
+}
+
+func (MySQLStore) HasPermission(userID, action, resource string) (bool, error) {
+	return HasPermission(userID, action, resource)
+}
+
+func (MySQLStore) APIRole(userID string) (access.Role, error) { return APIRole(userID) }
+
+func (MySQLStore) AuditAPICall(entry access.AuditEntry) { AuditAPICall(entry) }
+
+func (MySQLStore) CreateWebCrawler(sourceURL string) (string, error) {
+	return CreateWebCrawler(sourceURL)
+}
+
+func (MySQLStore) CreateScraperEngine(engineName, engineDescription string) (string, error) {
+	return CreateScraperEngine(engineName, engineDescription)
+}
+
+func (MySQLStore) GetScraperEngine(engineID string) (ScraperEngine, error) {
+	return GetScraperEngine(engineID)
+}
+
+func (MySQLStore) ListScraperEngines() ([]ScraperEngine, error) { return ListScraperEngines() }
+
+func (MySQLStore) UpdateScraperEngine(engine ScraperEngine) (ScraperEngine, error) {
+	return UpdateScraperEngine(engine)
+}
+
+func (MySQLStore) DeleteScraperEngine(engineID string, version int) error {
+	return DeleteScraperEngine(engineID, version)
+}
+
+func (MySQLStore) InsertURL(url, domain string, tags map[string]interface{}) (string, error) {
+	return InsertURL(url, domain, tags)
+}
+
+func (MySQLStore) UpdateURL(id, url, domain string, tags map[string]interface{}) error {
+	return UpdateURL(id, url, domain, tags)
+}
+
+func (MySQLStore) GetURLTagsAndDomain(id string) (map[string]interface{}, string, error) {
+	return GetURLTagsAndDomain(id)
+}
+
+func (MySQLStore) GetURLsFromDomain(domain string) ([]string, error) {
+	return GetURLsFromDomain(domain)
+}
+
+func (MySQLStore) InsertPrediction(algorithm, queryIdentifier, fileName, predictionInfo, skills string) error {
+	return InsertPrediction(algorithm, queryIdentifier, fileName, predictionInfo, skills)
+}
+
+func (MySQLStore) FetchPredictionData(queryIdentifier, domain string) (PredictionData, error) {
+	return FetchPredictionData(queryIdentifier, domain)
+}
+
+func (MySQLStore) DeletePrediction(algorithm, predictionID string) error {
+	return DeletePrediction(algorithm, predictionID)
+}
+
+func (MySQLStore) RestorePrediction(algorithm, predictionID string) error {
+	return RestorePrediction(algorithm, predictionID)
+}
+
+func (MySQLStore) ArchivePredictions(options ArchiveOptions) (int, error) {
+	return ArchivePredictions(options)
+}
+
+func (MySQLStore) SavePredictionRequest(request PredictionRequest) error {
+	return SavePredictionRequest(request)
+}
+
+func (MySQLStore) GetPredictionRequest(requestID string) (PredictionRequest, error) {
+	return GetPredictionRequest(requestID)
+}
+
+func (MySQLStore) SavePredictionOutcomes(outcomes []PredictionOutcome) error {
+	return SavePredictionOutcomes(outcomes)
+}
+
+func (MySQLStore) ListPredictionOutcomes(since time.Time) ([]PredictionOutcome, error) {
+	return ListPredictionOutcomes(since)
+}
+
+func (MySQLStore) InsertLog(statusCode, message, goEngineArea string) {
+	InsertLog(statusCode, message, goEngineArea)
+}
+
+func (MySQLStore) StoreLog(statusCode string, message string, goEngineArea string) error {
+	return StoreLog(statusCode, message, goEngineArea)
+}
+
+func (MySQLStore) WriteLog(logID string, statusCode string, message string, goEngineArea string, dateTime time.Time) error {
+	return WriteLog(logID, statusCode, message, goEngineArea, dateTime)
+}
+
+func (MySQLStore) InsertOrUpdateStatusCode(statusCode, statusMessage string) error {
+	return InsertOrUpdateStatusCode(statusCode, statusMessage)
+}
+
+func (MySQLStore) GetLog() ([]Log, error) { return GetLog() }
+
+func (MySQLStore) GetSuccess() ([]Log, error) { return GetSuccess() }
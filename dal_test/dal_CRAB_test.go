@@ -1,6 +1,7 @@
 package dal_test
 
 import (
+	"cmpscfa23team2/crab"
 	"cmpscfa23team2/dal"
 	"reflect"
 	"testing"
@@ -31,6 +32,34 @@ func TestCreateScraperEngine(t *testing.T) {
 	}
 }
 
+func TestUpdateScraperEngineConflict(t *testing.T) {
+	id, err := dal.CreateScraperEngine("versioned engine", "first")
+	if err != nil {
+		t.Fatalf("CreateScraperEngine() error = %v", err)
+	}
+	apiCopy, err := dal.GetScraperEngine(id)
+	if err != nil || apiCopy.Version != 1 {
+		t.Fatalf("GetScraperEngine() = %+v, %v", apiCopy, err)
+	}
+	schedulerCopy := apiCopy
+
+	apiCopy.Description = "from the API"
+	updated, err := dal.UpdateScraperEngine(apiCopy)
+	if err != nil || updated.Version != 2 || updated.Description != "from the API" {
+		t.Errorf("UpdateScraperEngine() = %+v, %v", updated, err)
+	}
+	schedulerCopy.Description = "from the scheduler"
+	if _, err := dal.UpdateScraperEngine(schedulerCopy); err != dal.ErrVersionConflict {
+		t.Errorf("UpdateScraperEngine() of a stale version error = %v, want ErrVersionConflict", err)
+	}
+	if err := dal.DeleteScraperEngine(id, 1); err != dal.ErrVersionConflict {
+		t.Errorf("DeleteScraperEngine() of a stale version error = %v, want ErrVersionConflict", err)
+	}
+	if err := dal.DeleteScraperEngine(id, updated.Version); err != nil {
+		t.Errorf("DeleteScraperEngine() error = %v", err)
+	}
+}
+
 func TestInsertURL(t *testing.T) {
 	url := "http://example.com"
 	domain := "example.com"
@@ -94,3 +123,24 @@ func TestGetURLsFromDomain(t *testing.T) {
 	//	t.Errorf("Expected urls: %v, got: %v", expectedURLs, urls)
 	//}
 }
+
+func TestBulkLoadDataset(t *testing.T) {
+	ds := crab.Dataset{Name: "housing", Columns: []string{"city", "state", "zip_code", "price"},
+		Rows: [][]string{{"Boston", "MA", "02108", "$1,200,000"}, {"Erie", "PA", "", "$180,000"}, {"Tab\tCity", "NY", "10001", ""}}}
+	var progress []int
+	loaded, err := dal.BulkLoadDataset("properties", ds, dal.BulkLoader{BatchSize: 2, Progress: func(n int) { progress = append(progress, n) }})
+	if err != nil || loaded != 3 {
+		t.Errorf("BulkLoadDataset() = %d, %v, want 3 rows", loaded, err)
+	}
+	if !reflect.DeepEqual(progress, []int{2, 3}) {
+		t.Errorf("progress = %v, want [2 3]", progress)
+	}
+
+	loaded, err = dal.BulkLoadDataset("properties", ds, dal.BulkLoader{LocalInfile: true, DisableKeys: true})
+	if err != nil || loaded != 3 {
+		t.Errorf("BulkLoadDataset(LocalInfile) = %d, %v, want 3 rows", loaded, err)
+	}
+	if _, err := dal.BulkLoadDataset("properties`; DROP TABLE properties; --", ds, dal.BulkLoader{}); err == nil {
+		t.Errorf("BulkLoadDataset() accepted an invalid table name")
+	}
+}
@@ -1,10 +1,17 @@
 package dal_test
 
 import (
+	"cmpscfa23team2/crab"
 	"cmpscfa23team2/dal"
+	"compress/gzip"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestSearchJobByTitle(t *testing.T) {
@@ -131,3 +138,86 @@ func TestLoadDataFromJSON(t *testing.T) {
 		t.Errorf("LoadDataFromJSON returned incorrect job data: got %v, want %v", specificJob, &expectedJob)
 	}
 }
+
+func TestDeleteAndArchivePredictions(t *testing.T) {
+	if err := dal.InitDB(); err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	queryIdentifier := "archive test " + time.Now().Format(time.RFC3339Nano)
+	if err := dal.InsertPrediction("KNN", queryIdentifier, "", "archived", "Go"); err != nil {
+		t.Fatalf("InsertPrediction() error = %v", err)
+	}
+	var predictionID string
+	if err := dal.DB.QueryRow("SELECT prediction_id FROM knn_predictions WHERE query_identifier = ?", queryIdentifier).Scan(&predictionID); err != nil {
+		t.Fatalf("Error finding the inserted prediction: %v", err)
+	}
+
+	if err := dal.DeletePrediction("KNN", predictionID); err != nil {
+		t.Fatalf("DeletePrediction() error = %v", err)
+	}
+	if err := dal.DeletePrediction("KNN", predictionID); err == nil {
+		t.Errorf("DeletePrediction() of a deleted prediction succeeded")
+	}
+	if err := dal.RestorePrediction("KNN", predictionID); err != nil {
+		t.Errorf("RestorePrediction() error = %v", err)
+	}
+	if err := dal.DeletePrediction("KNN", predictionID); err != nil {
+		t.Fatalf("DeletePrediction() error = %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "predictions.ndjson.gz")
+	archived, err := dal.ArchivePredictions(dal.ArchiveOptions{Before: time.Now().Add(time.Minute), DeletedOnly: true, File: file})
+	if err != nil || archived < 1 {
+		t.Fatalf("ArchivePredictions() = %d, %v", archived, err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for decoder := json.NewDecoder(r); decoder.More(); {
+		var p dal.ArchivedPrediction
+		if err := decoder.Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		found = found || (p.PredictionID == predictionID && p.Algorithm == "KNN" && p.DeletedAt != "")
+	}
+	if !found {
+		t.Errorf("archive file has no prediction %s", predictionID)
+	}
+	if err := dal.RestorePrediction("KNN", predictionID); err == nil {
+		t.Errorf("RestorePrediction() of an archived prediction succeeded")
+	}
+}
+
+func TestPredictionRequests(t *testing.T) {
+	request := dal.NewPredictionRequest([]string{"Data Scientist", "Nurse"})
+	if err := dal.SavePredictionRequest(request); err != nil {
+		t.Fatalf("SavePredictionRequest() error = %v", err)
+	}
+	request.JobID, request.State = "job-1", crab.JobSucceeded
+	request.Results = []string{"Prediction result for Data Scientist", "Prediction result for Nurse"}
+	request.Backends = []string{"simulated", "simulated"}
+	request.FinishedAt = time.Now()
+	if err := dal.SavePredictionRequest(request); err != nil {
+		t.Fatalf("SavePredictionRequest() update error = %v", err)
+	}
+
+	got, err := dal.GetPredictionRequest(request.RequestID)
+	if err != nil {
+		t.Fatalf("GetPredictionRequest() error = %v", err)
+	}
+	if got.JobID != "job-1" || got.State != crab.JobSucceeded || got.FinishedAt.IsZero() ||
+		!reflect.DeepEqual(got.Inputs, request.Inputs) || !reflect.DeepEqual(got.Results, request.Results) ||
+		!reflect.DeepEqual(got.Backends, request.Backends) {
+		t.Errorf("GetPredictionRequest() = %+v, want %+v", got, request)
+	}
+	if _, err := dal.GetPredictionRequest("missing"); err != sql.ErrNoRows {
+		t.Errorf("GetPredictionRequest() of a missing request error = %v, want sql.ErrNoRows", err)
+	}
+}
@@ -2,13 +2,25 @@ package dal_test
 
 import (
 	"cmpscfa23team2/dal"
+	"cmpscfa23team2/dal/daltest"
+	"log"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 )
 
+// fixtureDB is the throwaway database the tests run on when $CRAB_TEST_DB_DSN or $CRAB_TEST_DOCKER is set.
+var fixtureDB *daltest.Database
+
 func TestMain(m *testing.M) {
-	// Setup: Initialize the database
-	err := dal.InitDB()
+	// Setup: Initialize the database, a throwaway one with the fixtures if asked for
+	var err error
+	if os.Getenv("CRAB_TEST_DB_DSN") != "" || os.Getenv("CRAB_TEST_DOCKER") != "" {
+		fixtureDB, err = daltest.Start(daltest.Options{Fixtures: []string{"testdata/fixtures.yaml"}})
+	} else {
+		err = dal.InitDB()
+	}
 	if err != nil {
 		panic("Failed to initialize the database: " + err.Error())
 	}
@@ -17,7 +29,62 @@ func TestMain(m *testing.M) {
 	code := m.Run()
 
 	// Teardown: Close the database
-	dal.CloseDb()
+	if fixtureDB != nil {
+		if err := fixtureDB.Close(); err != nil {
+			log.Printf("Error dropping the test database: %v", err)
+		}
+	} else {
+		dal.CloseDb()
+	}
 
 	os.Exit(code)
 }
+
+func TestSplitStatements(t *testing.T) {
+	script := "-- Tables\nCREATE TABLE t (a TEXT DEFAULT 'x;y');\n# note\nDELIMITER //\nCREATE PROCEDURE p()\nBEGIN\n    SELECT 1; /* ; */\nEND //\nDELIMITER ;\nCALL p();\n"
+	want := []string{"CREATE TABLE t (a TEXT DEFAULT 'x;y')", "CREATE PROCEDURE p()\nBEGIN\n    SELECT 1;  \nEND", "CALL p()"}
+	if got := daltest.SplitStatements(script); !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitStatements() = %q, want %q", got, want)
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	if fixtureDB == nil {
+		t.Skip("Fixtures are loaded only into a throwaway database; set $CRAB_TEST_DB_DSN or $CRAB_TEST_DOCKER")
+	}
+	engine, err := dal.GetScraperEngine("fixture-engine")
+	if err != nil || engine.Name != "Fixture engine" || engine.Version != 3 {
+		t.Errorf("GetScraperEngine() = %+v, %v", engine, err)
+	}
+	engine.Version = 2
+	if _, err := dal.UpdateScraperEngine(engine); err != dal.ErrVersionConflict {
+		t.Errorf("UpdateScraperEngine() of a stale version error = %v, want ErrVersionConflict", err)
+	}
+	data, err := dal.FetchPredictionData("Fixture query", "Airfare Prices")
+	if err != nil || data.PredictionInfo != "live" {
+		t.Errorf("FetchPredictionData() = %+v, %v, want the prediction that is not soft-deleted", data, err)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	if health := dal.Health(); health.Status != "up" || health.Failures != 0 {
+		t.Errorf("Health() = %+v, want the database up", health)
+	}
+}
+
+func TestQueryMetrics(t *testing.T) {
+	dal.SetSlowQueryThreshold(time.Nanosecond)
+	defer dal.SetSlowQueryThreshold(500 * time.Millisecond)
+	if _, err := dal.GetAllUsers(); err != nil {
+		t.Fatal(err)
+	}
+	for _, stats := range dal.QueryMetrics() {
+		if stats.Statement == "CALL get_users" {
+			if stats.Calls == 0 || stats.Slow == 0 || stats.Mean() <= 0 || stats.Max < stats.Mean() {
+				t.Errorf("stats of CALL get_users = %+v", stats)
+			}
+			return
+		}
+	}
+	t.Errorf("QueryMetrics() = %+v, want CALL get_users", dal.QueryMetrics())
+}
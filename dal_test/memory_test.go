@@ -0,0 +1,155 @@
+package dal_test
+
+import (
+	"cmpscfa23team2/access"
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/dal"
+	"database/sql"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreUsers(t *testing.T) {
+	var store dal.DataStore = dal.NewMemoryStore()
+	id, err := store.RegisterUser("Ada", "ada@example.com", "DEV", "secret", true)
+	if err != nil {
+		t.Fatalf("RegisterUser() error = %v", err)
+	}
+	if _, err := store.RegisterUser("Ada", "ada@example.com", "DEV", "secret", true); err == nil {
+		t.Errorf("RegisterUser() with a taken login succeeded")
+	}
+	if token, err := store.AuthenticateUser("ada@example.com", "secret"); err != nil || token == "" {
+		t.Errorf("AuthenticateUser() = %q, %v", token, err)
+	}
+	if _, err := store.AuthenticateUser("ada@example.com", "wrong"); err == nil {
+		t.Errorf("AuthenticateUser() with a wrong password succeeded")
+	}
+	if role, err := store.APIRole(id); err != nil || role != access.RoleOperator {
+		t.Errorf("APIRole() = %v, %v, want operator", role, err)
+	}
+	store.DeactivateUser(id)
+	if _, err := store.APIRole(id); err == nil {
+		t.Errorf("APIRole() of an inactive user succeeded")
+	}
+	if _, err := store.GetUserByID("missing"); err != sql.ErrNoRows {
+		t.Errorf("GetUserByID() of a missing user error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestMemoryStoreEngines(t *testing.T) {
+	store := dal.NewMemoryStore()
+	id, _ := store.CreateScraperEngine("engine", "first")
+	engine, _ := store.GetScraperEngine(id)
+	stale := engine
+	engine.Description = "second"
+	if updated, err := store.UpdateScraperEngine(engine); err != nil || updated.Version != 2 {
+		t.Errorf("UpdateScraperEngine() = %+v, %v", updated, err)
+	}
+	if _, err := store.UpdateScraperEngine(stale); err != dal.ErrVersionConflict {
+		t.Errorf("UpdateScraperEngine() of a stale version error = %v, want ErrVersionConflict", err)
+	}
+}
+
+func TestMemoryStorePredictions(t *testing.T) {
+	store := dal.NewMemoryStore()
+	store.InsertPrediction("KNN", "fares", "", "knn", "")
+	store.InsertPrediction("LinearRegression", "fares", "", "linear", "")
+	if data, err := store.FetchPredictionData("fares", "Airfare Prices"); err != nil || data.PredictionInfo != "knn" {
+		t.Errorf("FetchPredictionData() = %+v, %v, want the KNN prediction", data, err)
+	}
+
+	if err := store.DeletePrediction("KNN", "missing"); err == nil {
+		t.Errorf("DeletePrediction() of a missing prediction succeeded")
+	}
+	if archived, err := store.ArchivePredictions(dal.ArchiveOptions{Before: time.Now().Add(-time.Hour)}); err != nil || archived != 0 {
+		t.Errorf("ArchivePredictions() before the predictions were made = %d, %v, want 0", archived, err)
+	}
+	archived, err := store.ArchivePredictions(dal.ArchiveOptions{Before: time.Now().Add(time.Minute)})
+	if err != nil || archived != 2 || len(store.ArchivedPredictions()) != 2 {
+		t.Fatalf("ArchivePredictions() = %d, %v, want 2", archived, err)
+	}
+	if err := store.RestorePrediction("KNN", store.ArchivedPredictions()[0].PredictionID); err == nil {
+		t.Errorf("RestorePrediction() of an archived prediction succeeded")
+	}
+	if _, err := store.FetchPredictionData("fares", "Airfare Prices"); err == nil {
+		t.Errorf("FetchPredictionData() found an archived prediction")
+	}
+}
+
+func TestMemoryStoreLogs(t *testing.T) {
+	store := dal.NewMemoryStore()
+	store.AuditAPICall(access.AuditEntry{Method: "POST", Path: "/api/jobs", Status: 403})
+	if err := store.StoreLog("BAD", "unknown status code", "test"); err == nil {
+		t.Errorf("StoreLog() with an unknown status code succeeded")
+	}
+	if messages := store.Messages("API audit"); len(messages) != 1 {
+		t.Errorf("Messages() = %q, want the audited call", messages)
+	}
+	if logs, _ := store.GetSuccess(); len(logs) != 0 {
+		t.Errorf("GetSuccess() = %v, want no entries as the call was rejected", logs)
+	}
+}
+
+func TestMemoryStoreRunMetrics(t *testing.T) {
+	store := dal.NewMemoryStore()
+	week := 7 * 24 * time.Hour
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for n := 2; n >= 0; n-- {
+		summary := crab.RunSummary{RunID: fmt.Sprintf("run-%d", n), Kind: "scrape", Name: "gasoline",
+			StartedAt: start.Add(time.Duration(n) * week), Pages: 10 + n,
+			Datasets: []crab.DatasetStats{{Dataset: "gasoline", Rows: 100 * n}}}
+		store.SaveRunMetrics(crab.RunMetrics(summary))
+	}
+	// Saving a run again replaces its metrics
+	store.SaveRunMetrics([]crab.RunMetric{{RunID: "run-1", Kind: "scrape", Name: "gasoline", Time: start.Add(week),
+		Metric: crab.MetricPages, Value: 42}})
+
+	pages, err := store.LoadRunMetrics(crab.MetricQuery{Metric: crab.MetricPages})
+	if err != nil || len(pages) != 3 {
+		t.Fatalf("LoadRunMetrics(pages) = %+v, %v, want three runs", pages, err)
+	}
+	if pages[0].RunID != "run-0" || pages[1].Value != 42 || pages[2].Value != 12 {
+		t.Errorf("LoadRunMetrics(pages) = %+v, want the runs oldest first with run-1 replaced", pages)
+	}
+	rows, _ := store.LoadRunMetrics(crab.MetricQuery{Metric: crab.MetricDatasetRows, Label: "gasoline", From: start.Add(week)})
+	if len(rows) != 2 || rows[0].Value != 100 || rows[1].Value != 200 {
+		t.Errorf("LoadRunMetrics(dataset_rows from the second week) = %+v", rows)
+	}
+}
+
+// Every store of the dal is every store crab writes to.
+var (
+	_ crab.JobStore         = dal.DataStore(nil)
+	_ crab.SnapshotStore    = dal.DataStore(nil)
+	_ crab.QualityStore     = dal.DataStore(nil)
+	_ crab.LatencyStore     = dal.DataStore(nil)
+	_ crab.MetricsStore     = dal.DataStore(nil)
+	_ crab.AlertStore       = dal.DataStore(nil)
+	_ crab.WorkflowStore    = dal.DataStore(nil)
+	_ crab.IdempotencyStore = dal.DataStore(nil)
+	_ dal.DataStore         = dal.MySQLStore{}
+	_ dal.DataStore         = dal.NewMemoryStore()
+)
+
+func TestDalDoesNotImportCrab(t *testing.T) {
+	files, _ := filepath.Glob("../dal/*.go")
+	for _, file := range files {
+		f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, spec := range f.Imports {
+			if path, _ := strconv.Unquote(spec.Path.Value); path == "cmpscfa23team2/crab" {
+				t.Errorf("%s imports crab", file)
+			}
+		}
+	}
+	if len(files) == 0 {
+		t.Fatal("no files in ../dal")
+	}
+}
@@ -0,0 +1,58 @@
+package dal_test
+
+import (
+	"cmpscfa23team2/dal"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPredictorRouterWeights(t *testing.T) {
+	router := dal.NewPredictorRouter()
+	if outcome := router.Predict("x"); outcome.Error == "" {
+		t.Errorf("Predict() without backends = %+v, want an error", outcome)
+	}
+	router.Register("a", dal.PredictorFunc(func(input string) (string, error) { return "a:" + input, nil }), 3)
+	router.Register("b", dal.PredictorFunc(func(input string) (string, error) { return "b:" + input, nil }), 1)
+	router.Register("off", dal.PredictorFunc(func(string) (string, error) { return "", errors.New("off") }), 0)
+	if err := router.Register("bad", nil, 1); err == nil {
+		t.Errorf("Register() of a nil backend succeeded")
+	}
+
+	served := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		outcome := router.Predict("x")
+		if outcome.Output != outcome.Backend+":x" || outcome.Error != "" {
+			t.Fatalf("Predict() = %+v", outcome)
+		}
+		served[outcome.Backend]++
+	}
+	if served["off"] != 0 || served["a"] < 2700 || served["a"] > 3300 {
+		t.Errorf("Predict() served %v, want about 3000 by a, 1000 by b and none by off", served)
+	}
+}
+
+func TestComparePredictors(t *testing.T) {
+	outcomes := []dal.PredictionOutcome{
+		{Backend: "b", Output: "yes", Latency: 4 * time.Millisecond},
+		{Backend: "a", Output: "yes", Latency: 1 * time.Millisecond},
+		{Backend: "a", Output: "no", Latency: 2 * time.Millisecond},
+		{Backend: "a", Output: "yes", Latency: 3 * time.Millisecond},
+		{Backend: "a", Error: "timeout", Latency: 10 * time.Millisecond},
+	}
+	reports := dal.ComparePredictors(outcomes)
+	if len(reports) != 2 || reports[0].Backend != "a" || reports[1].Backend != "b" {
+		t.Fatalf("ComparePredictors() = %+v, want reports of a and b", reports)
+	}
+	a := reports[0]
+	if a.Predictions != 4 || a.Errors != 1 || a.DistinctOutputs != 2 {
+		t.Errorf("report of a = %+v", a)
+	}
+	if a.MeanLatency != 4*time.Millisecond || a.P50Latency != 2*time.Millisecond || a.P95Latency != 10*time.Millisecond ||
+		a.MaxLatency != 10*time.Millisecond {
+		t.Errorf("latencies of a = %v mean, %v p50, %v p95, %v max", a.MeanLatency, a.P50Latency, a.P95Latency, a.MaxLatency)
+	}
+	if len(a.TopOutputs) != 2 || a.TopOutputs[0] != (dal.OutputShare{Output: "yes", Count: 2, Share: 2.0 / 3}) {
+		t.Errorf("outputs of a = %+v, want yes first with 2 of 3", a.TopOutputs)
+	}
+}
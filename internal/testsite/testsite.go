@@ -0,0 +1,193 @@
+// Package testsite serves a synthetic website for crawler integration tests: a fixed number of pages
+// linked in a configurable graph, an optional robots.txt, and endpoints that are slow, fail, or fail a
+// few times before succeeding. Every request is logged so tests can assert on what was fetched and when.
+package testsite
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config describes the synthetic site.
+type Config struct {
+	// Pages is the number of pages, served at /page/0 to /page/{Pages-1}. "/" serves page 0.
+	Pages int
+	// Links returns the pages linked from page i. Chain is used when nil.
+	Links func(i int) []int
+	// Paragraphs is the number of paragraphs of filler text on each page, to give pages a realistic size.
+	Paragraphs int
+	// Robots is served as /robots.txt; the site has no robots.txt when it is empty.
+	Robots string
+	// Slow delays the response of the given paths.
+	Slow map[string]time.Duration
+	// Status answers the given paths with a fixed status code.
+	Status map[string]int
+	// Flaky answers the given paths with 503 the given number of times before serving them normally.
+	Flaky map[string]int
+	// RetryAfter is sent with every 429 and 503 response when set, e.g. "1".
+	RetryAfter string
+}
+
+// Request is one request the site received.
+type Request struct {
+	Method    string
+	Path      string
+	UserAgent string
+	Header    http.Header
+	Time      time.Time
+}
+
+// Site is a running synthetic site.
+type Site struct {
+	*httptest.Server
+	config Config
+
+	mu       sync.Mutex
+	requests []Request
+	failures map[string]int
+}
+
+// Chain links each page to the next one.
+func Chain(pages int) func(i int) []int {
+	return func(i int) []int {
+		if i+1 < pages {
+			return []int{i + 1}
+		}
+		return nil
+	}
+}
+
+// Tree links page i to pages fanout*i+1 ... fanout*i+fanout, so page 0 is the root of a tree.
+func Tree(pages, fanout int) func(i int) []int {
+	return func(i int) []int {
+		var links []int
+		for j := fanout*i + 1; j <= fanout*i+fanout && j < pages; j++ {
+			links = append(links, j)
+		}
+		return links
+	}
+}
+
+// Complete links every page to every other page.
+func Complete(pages int) func(i int) []int {
+	return func(i int) []int {
+		links := make([]int, 0, pages-1)
+		for j := 0; j < pages; j++ {
+			if j != i {
+				links = append(links, j)
+			}
+		}
+		return links
+	}
+}
+
+// New starts a site. Close it when the test is done.
+func New(config Config) *Site {
+	if config.Links == nil {
+		config.Links = Chain(config.Pages)
+	}
+	s := &Site{config: config, failures: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// PageURL returns the absolute URL of page i.
+func (s *Site) PageURL(i int) string {
+	return fmt.Sprintf("%s/page/%d", s.URL, i)
+}
+
+// Requests returns every request received so far, in arrival order.
+func (s *Site) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Count returns how many requests were made for path.
+func (s *Site) Count(path string) int {
+	n := 0
+	for _, r := range s.Requests() {
+		if r.Path == path {
+			n++
+		}
+	}
+	return n
+}
+
+// Reset forgets the logged requests and restarts the flaky endpoints' failure counts.
+func (s *Site) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = nil
+	s.failures = map[string]int{}
+}
+
+func (s *Site) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, UserAgent: r.UserAgent(), Header: r.Header.Clone(), Time: time.Now()})
+	flaky := s.failures[r.URL.Path] < s.config.Flaky[r.URL.Path]
+	if flaky {
+		s.failures[r.URL.Path]++
+	}
+	s.mu.Unlock()
+
+	if delay, ok := s.config.Slow[r.URL.Path]; ok {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if flaky {
+		s.fail(w, http.StatusServiceUnavailable)
+		return
+	}
+	if status, ok := s.config.Status[r.URL.Path]; ok {
+		s.fail(w, status)
+		return
+	}
+
+	if r.URL.Path == "/robots.txt" {
+		if s.config.Robots == "" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprint(w, s.config.Robots)
+		return
+	}
+	page := 0
+	if r.URL.Path != "/" {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/page/"))
+		if err != nil || !strings.HasPrefix(r.URL.Path, "/page/") || n < 0 || n >= s.config.Pages {
+			http.NotFound(w, r)
+			return
+		}
+		page = n
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<html><head><title>Page %d</title></head><body><h1>Page %d</h1>\n", page, page)
+	for p := 0; p < s.config.Paragraphs; p++ {
+		fmt.Fprintf(w, "<p>Paragraph %d of page %d. The quick brown fox jumps over the lazy dog.</p>\n", p, page)
+	}
+	fmt.Fprint(w, "<ul>\n")
+	for _, link := range s.config.Links(page) {
+		fmt.Fprintf(w, "<li><a href=\"/page/%d\">Page %d</a></li>\n", link, link)
+	}
+	fmt.Fprint(w, "</ul></body></html>\n")
+}
+
+// fail writes an error page with the status code.
+func (s *Site) fail(w http.ResponseWriter, status int) {
+	if s.config.RetryAfter != "" && (status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable) {
+		w.Header().Set("Retry-After", s.config.RetryAfter)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<html><body><h1>%d %s</h1></body></html>\n", status, http.StatusText(status))
+}
@@ -114,6 +114,16 @@ CREATE TABLE IF NOT EXISTS webcrawlers (
                                            created_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP()
 );
 
+-- Table for scraper engines. version is bumped by every update, which must name the version it read, so
+-- concurrent updates from the API and the scheduler cannot overwrite each other unnoticed
+CREATE TABLE IF NOT EXISTS scraper_engines (
+                                               engine_id CHAR(36) PRIMARY KEY,
+                                               engine_name NVARCHAR(255) NOT NULL,
+                                               engine_description LONGTEXT,
+                                               version INT NOT NULL DEFAULT 1,
+                                               created_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP(),
+                                               updated_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP() ON UPDATE CURRENT_TIMESTAMP()
+);
 
 -- Table for predictions
 -- Table for K-Nearest Neighbors Predictions
@@ -122,7 +132,9 @@ CREATE TABLE IF NOT EXISTS knn_predictions (
                                                query_identifier VARCHAR(255),
                                                input_data VARCHAR(255),
                                                prediction_info TEXT(255),
-                                               prediction_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP()
+                                               prediction_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP(),
+                                               deleted_at DATETIME NULL, -- Set when the prediction is soft-deleted
+                                               INDEX (prediction_time)
 );
 
 -- Table for Linear Regression Predictions
@@ -131,7 +143,9 @@ CREATE TABLE IF NOT EXISTS linear_regression_predictions (
                                                              query_identifier VARCHAR(255),
                                                              input_data TEXT(255),
                                                              prediction_info TEXT(255),
-                                                             prediction_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP()
+                                                             prediction_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP(),
+                                                             deleted_at DATETIME NULL, -- Set when the prediction is soft-deleted
+                                                             INDEX (prediction_time)
 );
 
 -- Table for Naive Bayes Predictions
@@ -140,7 +154,48 @@ CREATE TABLE IF NOT EXISTS naive_bayes_predictions (
                                                        query_identifier VARCHAR(255),
                                                        input_data VARCHAR(255),
                                                        prediction_info LONGTEXT,
-                                                       prediction_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP()
+                                                       prediction_time TIMESTAMP DEFAULT CURRENT_TIMESTAMP(),
+                                                       deleted_at DATETIME NULL, -- Set when the prediction is soft-deleted
+                                                       INDEX (prediction_time)
+);
+
+-- Predictions moved out of the tables above by the archive job, to keep them small
+CREATE TABLE IF NOT EXISTS predictions_archive (
+                                                   prediction_id VARCHAR(36) PRIMARY KEY,
+                                                   algorithm NVARCHAR(32) NOT NULL,
+                                                   query_identifier VARCHAR(255),
+                                                   input_data LONGTEXT,
+                                                   prediction_info LONGTEXT,
+                                                   prediction_time TIMESTAMP NULL,
+                                                   deleted_at DATETIME NULL,
+                                                   archived_at DATETIME NOT NULL,
+                                                   INDEX (algorithm, query_identifier)
+);
+
+-- Predictions requested through the REST API, polled by ID while large batches run as jobs
+CREATE TABLE IF NOT EXISTS prediction_requests (
+                                                   request_id CHAR(36) PRIMARY KEY,
+                                                   job_id CHAR(36) NULL, -- Job running the batch, NULL when run synchronously
+                                                   state NVARCHAR(20) NOT NULL,
+                                                   inputs JSON NOT NULL,
+                                                   results JSON NULL,
+                                                   backends JSON NULL, -- Predictor backend of each result
+                                                   error_message TEXT,
+                                                   created_time DATETIME NOT NULL,
+                                                   finished_time DATETIME NULL
+);
+
+-- Every prediction served to a prediction request, to compare the backends A/B tested against each other
+CREATE TABLE IF NOT EXISTS prediction_outcomes (
+                                                   request_id CHAR(36) NOT NULL,
+                                                   input_index INT NOT NULL,
+                                                   backend NVARCHAR(64) NOT NULL,
+                                                   output LONGTEXT,
+                                                   latency_ns BIGINT NOT NULL,
+                                                   error_message TEXT,
+                                                   served_time DATETIME(3) NOT NULL,
+                                                   PRIMARY KEY (request_id, input_index),
+                                                   INDEX (served_time)
 );
 
 
@@ -190,6 +245,133 @@ CREATE TABLE ETFs (
                       created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Table for crawl and scrape jobs
+CREATE TABLE IF NOT EXISTS jobs (
+                                    job_id CHAR(36) PRIMARY KEY,
+                                    job_type NVARCHAR(20) NOT NULL,
+                                    params JSON,
+                                    state NVARCHAR(20) NOT NULL,
+                                    created_time DATETIME NOT NULL,
+                                    started_time DATETIME NULL,
+                                    finished_time DATETIME NULL,
+                                    error_message TEXT
+);
+
+-- Table for gzipped HTML snapshots of crawled pages, keyed by URL hash and fetch time
+CREATE TABLE IF NOT EXISTS page_snapshots (
+                                    url_hash CHAR(64) NOT NULL,
+                                    fetched_time DATETIME(3) NOT NULL,
+                                    url TEXT NOT NULL,
+                                    status_code INT,
+                                    content_type NVARCHAR(255),
+                                    body LONGBLOB NOT NULL,
+                                    run_id VARCHAR(32) NULL, -- Run that fetched the page, for point-in-time views
+                                    PRIMARY KEY (url_hash, fetched_time),
+                                    INDEX (run_id)
+);
+
+-- Results of the data quality expectations checked on each scraped dataset
+CREATE TABLE IF NOT EXISTS data_quality (
+                                    result_id INT AUTO_INCREMENT PRIMARY KEY,
+                                    dataset NVARCHAR(64) NOT NULL,
+                                    run_id VARCHAR(32) NULL,
+                                    expectation NVARCHAR(255) NOT NULL,
+                                    column_name NVARCHAR(64) NOT NULL,
+                                    severity NVARCHAR(8) NOT NULL, -- fail or warn
+                                    success BOOLEAN NOT NULL,
+                                    checked_count INT NOT NULL,
+                                    failed_count INT NOT NULL,
+                                    unexpected_values JSON, -- Up to five offending values
+                                    checked_time DATETIME(3) NOT NULL,
+                                    INDEX (dataset, checked_time),
+                                    INDEX (run_id)
+);
+
+-- Response time percentiles of each domain in each crawl run, to follow the performance of monitored sites
+CREATE TABLE IF NOT EXISTS crawl_latency (
+                                    run_id VARCHAR(32) NOT NULL,
+                                    domain NVARCHAR(255) NOT NULL,
+                                    started_time DATETIME(3) NOT NULL, -- When the run started
+                                    requests INT NOT NULL,
+                                    ttfb_p50_ms DOUBLE NOT NULL,
+                                    ttfb_p95_ms DOUBLE NOT NULL,
+                                    ttfb_p99_ms DOUBLE NOT NULL,
+                                    fetch_p50_ms DOUBLE NOT NULL,
+                                    fetch_p95_ms DOUBLE NOT NULL,
+                                    fetch_p99_ms DOUBLE NOT NULL,
+                                    PRIMARY KEY (run_id, domain),
+                                    INDEX (domain, started_time)
+);
+
+-- Metrics of each crawl and scrape run (pages, errors, latency, dataset rows), to chart their trends
+CREATE TABLE IF NOT EXISTS run_metrics (
+                                    run_id VARCHAR(32) NOT NULL,
+                                    kind NVARCHAR(16) NOT NULL, -- crawl or scrape
+                                    name NVARCHAR(255) NOT NULL, -- Domain or job name
+                                    started_time DATETIME(3) NOT NULL, -- When the run started
+                                    metric NVARCHAR(64) NOT NULL,
+                                    label NVARCHAR(255) NOT NULL DEFAULT '', -- The domain or dataset of the metric
+                                    value DOUBLE NOT NULL,
+                                    PRIMARY KEY (run_id, metric, label),
+                                    INDEX (metric, started_time)
+);
+
+-- Alerts fired by the alert rules of crab after its runs
+CREATE TABLE IF NOT EXISTS alert_history (
+                                    alert_id INT AUTO_INCREMENT PRIMARY KEY,
+                                    rule_name NVARCHAR(64) NOT NULL,
+                                    kind NVARCHAR(16) NOT NULL, -- error_rate, row_drop, unhealthy or quality
+                                    run_id VARCHAR(32) NULL,
+                                    job NVARCHAR(255) NOT NULL, -- The crawled domain, scraper or dataset
+                                    label NVARCHAR(255) NOT NULL DEFAULT '', -- The dataset of the rules of datasets
+                                    value DOUBLE NOT NULL,
+                                    threshold DOUBLE NOT NULL,
+                                    message TEXT NOT NULL,
+                                    fired_time DATETIME(3) NOT NULL,
+                                    INDEX (job, fired_time),
+                                    INDEX (fired_time)
+);
+
+-- State of each crab pipeline run, so a failed run can resume from the stages that did not succeed
+CREATE TABLE IF NOT EXISTS workflow_runs (
+                                    run_id VARCHAR(32) PRIMARY KEY,
+                                    workflow NVARCHAR(64) NOT NULL,
+                                    status NVARCHAR(16) NOT NULL, -- running, succeeded or failed
+                                    record LONGTEXT NOT NULL, -- crab.WorkflowRecord as JSON
+                                    started_time DATETIME(3) NOT NULL,
+                                    updated_time DATETIME(3) NOT NULL,
+                                    INDEX (workflow, started_time)
+);
+
+-- Idempotency keys of API requests, so a retried POST gets the job or prediction request of the first
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+                                    scope NVARCHAR(320) NOT NULL, -- The endpoint and the caller, e.g. POST /api/jobs for key:ci
+                                    idempotency_key NVARCHAR(255) NOT NULL,
+                                    request_hash CHAR(64) NOT NULL, -- SHA-256 of the request body
+                                    resource_id VARCHAR(64) NULL, -- NULL while the first request is handled
+                                    status INT NOT NULL DEFAULT 0,
+                                    created_time DATETIME(3) NOT NULL,
+                                    PRIMARY KEY (scope, idempotency_key),
+                                    INDEX (created_time)
+);
+
+-- Property listings, bulk loaded from the housing dataset and downloaded listings (see dal.BulkLoader)
+CREATE TABLE IF NOT EXISTS properties (
+                                    property_id BIGINT AUTO_INCREMENT PRIMARY KEY,
+                                    status NVARCHAR(32),
+                                    bedrooms NVARCHAR(16),
+                                    bathrooms NVARCHAR(16),
+                                    acre_lot NVARCHAR(32),
+                                    city NVARCHAR(128),
+                                    state NVARCHAR(64),
+                                    zip_code NVARCHAR(16),
+                                    house_size NVARCHAR(32),
+                                    prev_sold_date NVARCHAR(32),
+                                    price NVARCHAR(32),
+                                    INDEX (state, city),
+                                    INDEX (zip_code)
+);
+
 
 
 -- ================================================
@@ -490,6 +672,131 @@ END //
 
 DELIMITER ;
 
+-- SPROC to create a new scraper engine
+DELIMITER //
+CREATE PROCEDURE create_scraper_engine(
+    IN p_engine_name NVARCHAR(255),
+    IN p_engine_description LONGTEXT
+)
+BEGIN
+    DECLARE v_engine_id CHAR(36);
+    SET v_engine_id = UUID();
+    INSERT INTO scraper_engines (engine_id, engine_name, engine_description)
+    VALUES (v_engine_id, p_engine_name, p_engine_description);
+    SELECT v_engine_id;
+END //
+DELIMITER ;
+
+-- SPROC to get a scraper engine
+DELIMITER //
+CREATE PROCEDURE get_scraper_engine(
+    IN p_engine_id CHAR(36)
+)
+BEGIN
+    SELECT engine_id, engine_name, engine_description, version, created_time, updated_time
+    FROM scraper_engines
+    WHERE engine_id = p_engine_id;
+END //
+DELIMITER ;
+
+-- SPROC to list the scraper engines
+DELIMITER //
+CREATE PROCEDURE list_scraper_engines()
+BEGIN
+    SELECT engine_id, engine_name, engine_description, version, created_time, updated_time
+    FROM scraper_engines
+    ORDER BY engine_name;
+END //
+DELIMITER ;
+
+-- SPROC to update a scraper engine if it is still at the version the caller read, returning the rows changed
+DELIMITER //
+CREATE PROCEDURE update_scraper_engine(
+    IN p_engine_id CHAR(36),
+    IN p_engine_name NVARCHAR(255),
+    IN p_engine_description LONGTEXT,
+    IN p_version INT
+)
+BEGIN
+    UPDATE scraper_engines
+    SET engine_name = p_engine_name, engine_description = p_engine_description, version = version + 1
+    WHERE engine_id = p_engine_id AND version = p_version;
+    SELECT ROW_COUNT();
+END //
+DELIMITER ;
+
+-- SPROC to delete a scraper engine if it is still at the version the caller read, returning the rows deleted
+DELIMITER //
+CREATE PROCEDURE delete_scraper_engine(
+    IN p_engine_id CHAR(36),
+    IN p_version INT
+)
+BEGIN
+    DELETE FROM scraper_engines WHERE engine_id = p_engine_id AND version = p_version;
+    SELECT ROW_COUNT();
+END //
+DELIMITER ;
+
+-- SPROC to insert or update a prediction request
+DELIMITER //
+CREATE PROCEDURE save_prediction_request(
+    IN p_request_id CHAR(36),
+    IN p_job_id CHAR(36),
+    IN p_state NVARCHAR(20),
+    IN p_inputs JSON,
+    IN p_results JSON,
+    IN p_backends JSON,
+    IN p_error_message TEXT,
+    IN p_created_time DATETIME,
+    IN p_finished_time DATETIME
+)
+BEGIN
+    INSERT INTO prediction_requests (request_id, job_id, state, inputs, results, backends, error_message, created_time,
+                                     finished_time)
+    VALUES (p_request_id, p_job_id, p_state, p_inputs, p_results, p_backends, p_error_message, p_created_time,
+            p_finished_time)
+    ON DUPLICATE KEY UPDATE job_id = p_job_id, state = p_state, results = p_results, backends = p_backends,
+                            error_message = p_error_message, finished_time = p_finished_time;
+END //
+DELIMITER ;
+
+-- SPROC to get a prediction request by ID
+DELIMITER //
+CREATE PROCEDURE get_prediction_request(IN p_request_id CHAR(36))
+BEGIN
+    SELECT request_id, job_id, state, inputs, results, backends, error_message, created_time, finished_time
+    FROM prediction_requests WHERE request_id = p_request_id;
+END //
+DELIMITER ;
+
+-- SPROC to record a prediction served to a prediction request
+DELIMITER //
+CREATE PROCEDURE save_prediction_outcome(
+    IN p_request_id CHAR(36),
+    IN p_input_index INT,
+    IN p_backend NVARCHAR(64),
+    IN p_output LONGTEXT,
+    IN p_latency_ns BIGINT,
+    IN p_error_message TEXT,
+    IN p_served_time DATETIME(3)
+)
+BEGIN
+    INSERT INTO prediction_outcomes (request_id, input_index, backend, output, latency_ns, error_message, served_time)
+    VALUES (p_request_id, p_input_index, p_backend, p_output, p_latency_ns, p_error_message, p_served_time)
+    ON DUPLICATE KEY UPDATE backend = p_backend, output = p_output, latency_ns = p_latency_ns,
+                            error_message = p_error_message, served_time = p_served_time;
+END //
+DELIMITER ;
+
+-- SPROC to list the predictions served since a time, oldest first
+DELIMITER //
+CREATE PROCEDURE list_prediction_outcomes(IN p_since DATETIME(3))
+BEGIN
+    SELECT request_id, input_index, backend, output, latency_ns, error_message, served_time
+    FROM prediction_outcomes WHERE served_time >= p_since ORDER BY served_time;
+END //
+DELIMITER ;
+
 -- SPROC to insert URL records into the URLs table
 DELIMITER //
 CREATE PROCEDURE insert_url(IN p_url LONGTEXT, IN p_tags JSON, IN p_domain LONGTEXT)
@@ -665,6 +972,297 @@ DELIMITER $$
 # END$$
 # DELIMITER ;
 
+-- SPROC to insert or update a job
+DELIMITER //
+CREATE PROCEDURE save_job(
+    IN p_job_id CHAR(36),
+    IN p_job_type NVARCHAR(20),
+    IN p_params JSON,
+    IN p_state NVARCHAR(20),
+    IN p_created_time DATETIME,
+    IN p_started_time DATETIME,
+    IN p_finished_time DATETIME,
+    IN p_error_message TEXT
+)
+BEGIN
+    INSERT INTO jobs (job_id, job_type, params, state, created_time, started_time, finished_time, error_message)
+    VALUES (p_job_id, p_job_type, p_params, p_state, p_created_time, p_started_time, p_finished_time, p_error_message)
+    ON DUPLICATE KEY UPDATE state = p_state, started_time = p_started_time,
+                            finished_time = p_finished_time, error_message = p_error_message;
+END //
+DELIMITER ;
+
+-- SPROC to get a job by ID
+DELIMITER //
+CREATE PROCEDURE get_job(IN p_job_id CHAR(36))
+BEGIN
+    SELECT job_id, job_type, params, state, created_time, started_time, finished_time, error_message
+    FROM jobs WHERE job_id = p_job_id;
+END //
+DELIMITER ;
+
+-- SPROC to list the job history, newest first
+DELIMITER //
+CREATE PROCEDURE list_jobs()
+BEGIN
+    SELECT job_id, job_type, params, state, created_time, started_time, finished_time, error_message
+    FROM jobs ORDER BY created_time DESC;
+END //
+DELIMITER ;
+
+-- SPROC to store a page snapshot
+DELIMITER //
+CREATE PROCEDURE save_page_snapshot(
+    IN p_url_hash CHAR(64),
+    IN p_fetched_time DATETIME(3),
+    IN p_url TEXT,
+    IN p_status_code INT,
+    IN p_content_type NVARCHAR(255),
+    IN p_body LONGBLOB,
+    IN p_run_id VARCHAR(32)
+)
+BEGIN
+    INSERT INTO page_snapshots (url_hash, fetched_time, url, status_code, content_type, body, run_id)
+    VALUES (p_url_hash, p_fetched_time, p_url, p_status_code, p_content_type, p_body, p_run_id)
+    ON DUPLICATE KEY UPDATE status_code = p_status_code, content_type = p_content_type, body = p_body, run_id = p_run_id;
+END //
+DELIMITER ;
+
+-- SPROC to list the snapshots of a URL, oldest first, without their bodies
+DELIMITER //
+CREATE PROCEDURE list_page_snapshots(IN p_url_hash CHAR(64))
+BEGIN
+    SELECT url, url_hash, fetched_time, status_code, content_type, run_id
+    FROM page_snapshots WHERE url_hash = p_url_hash ORDER BY fetched_time;
+END //
+DELIMITER ;
+
+-- SPROC to get one snapshot of a URL, or its latest when no time is given
+DELIMITER //
+CREATE PROCEDURE get_page_snapshot(IN p_url_hash CHAR(64), IN p_fetched_time DATETIME(3))
+BEGIN
+    SELECT url, url_hash, fetched_time, status_code, content_type, run_id, body
+    FROM page_snapshots
+    WHERE url_hash = p_url_hash AND (p_fetched_time IS NULL OR fetched_time = p_fetched_time)
+    ORDER BY fetched_time DESC LIMIT 1;
+END //
+DELIMITER ;
+
+-- SPROC to store the result of a data quality expectation
+DELIMITER //
+CREATE PROCEDURE save_data_quality_result(
+    IN p_dataset NVARCHAR(64),
+    IN p_run_id VARCHAR(32),
+    IN p_expectation NVARCHAR(255),
+    IN p_column_name NVARCHAR(64),
+    IN p_severity NVARCHAR(8),
+    IN p_success BOOLEAN,
+    IN p_checked_count INT,
+    IN p_failed_count INT,
+    IN p_unexpected_values JSON,
+    IN p_checked_time DATETIME(3)
+)
+BEGIN
+    INSERT INTO data_quality (dataset, run_id, expectation, column_name, severity, success, checked_count,
+                              failed_count, unexpected_values, checked_time)
+    VALUES (p_dataset, p_run_id, p_expectation, p_column_name, p_severity, p_success, p_checked_count,
+            p_failed_count, p_unexpected_values, p_checked_time);
+END //
+DELIMITER ;
+
+-- SPROC to store the latency of a domain in a crawl run
+DELIMITER //
+CREATE PROCEDURE save_crawl_latency(
+    IN p_run_id VARCHAR(32),
+    IN p_domain NVARCHAR(255),
+    IN p_started_time DATETIME(3),
+    IN p_requests INT,
+    IN p_ttfb_p50_ms DOUBLE,
+    IN p_ttfb_p95_ms DOUBLE,
+    IN p_ttfb_p99_ms DOUBLE,
+    IN p_fetch_p50_ms DOUBLE,
+    IN p_fetch_p95_ms DOUBLE,
+    IN p_fetch_p99_ms DOUBLE
+)
+BEGIN
+    INSERT INTO crawl_latency (run_id, domain, started_time, requests, ttfb_p50_ms, ttfb_p95_ms, ttfb_p99_ms,
+                               fetch_p50_ms, fetch_p95_ms, fetch_p99_ms)
+    VALUES (p_run_id, p_domain, p_started_time, p_requests, p_ttfb_p50_ms, p_ttfb_p95_ms, p_ttfb_p99_ms,
+            p_fetch_p50_ms, p_fetch_p95_ms, p_fetch_p99_ms)
+    ON DUPLICATE KEY UPDATE requests = p_requests, ttfb_p50_ms = p_ttfb_p50_ms, ttfb_p95_ms = p_ttfb_p95_ms,
+                            ttfb_p99_ms = p_ttfb_p99_ms, fetch_p50_ms = p_fetch_p50_ms,
+                            fetch_p95_ms = p_fetch_p95_ms, fetch_p99_ms = p_fetch_p99_ms;
+END //
+DELIMITER ;
+
+-- SPROC to get the latency of a domain (every domain when NULL) over the crawl runs started between two times
+DELIMITER //
+CREATE PROCEDURE get_crawl_latency(
+    IN p_domain NVARCHAR(255),
+    IN p_from DATETIME(3),
+    IN p_to DATETIME(3)
+)
+BEGIN
+    SELECT run_id, domain, started_time, requests, ttfb_p50_ms, ttfb_p95_ms, ttfb_p99_ms,
+           fetch_p50_ms, fetch_p95_ms, fetch_p99_ms
+    FROM crawl_latency
+    WHERE (p_domain IS NULL OR domain = p_domain)
+      AND (p_from IS NULL OR started_time >= p_from)
+      AND (p_to IS NULL OR started_time <= p_to)
+    ORDER BY started_time, domain;
+END //
+DELIMITER ;
+
+-- SPROC to store a metric of a run
+DELIMITER //
+CREATE PROCEDURE save_run_metric(
+    IN p_run_id VARCHAR(32),
+    IN p_kind NVARCHAR(16),
+    IN p_name NVARCHAR(255),
+    IN p_started_time DATETIME(3),
+    IN p_metric NVARCHAR(64),
+    IN p_label NVARCHAR(255),
+    IN p_value DOUBLE
+)
+BEGIN
+    INSERT INTO run_metrics (run_id, kind, name, started_time, metric, label, value)
+    VALUES (p_run_id, p_kind, p_name, p_started_time, p_metric, p_label, p_value)
+    ON DUPLICATE KEY UPDATE value = p_value;
+END //
+DELIMITER ;
+
+-- SPROC to get the metrics of the runs started between two times, each filter matching everything when NULL
+DELIMITER //
+CREATE PROCEDURE get_run_metrics(
+    IN p_kind NVARCHAR(16),
+    IN p_name NVARCHAR(255),
+    IN p_metric NVARCHAR(64),
+    IN p_label NVARCHAR(255),
+    IN p_from DATETIME(3),
+    IN p_to DATETIME(3)
+)
+BEGIN
+    SELECT run_id, kind, name, started_time, metric, label, value
+    FROM run_metrics
+    WHERE (p_kind IS NULL OR kind = p_kind)
+      AND (p_name IS NULL OR name = p_name)
+      AND (p_metric IS NULL OR metric = p_metric)
+      AND (p_label IS NULL OR label = p_label)
+      AND (p_from IS NULL OR started_time >= p_from)
+      AND (p_to IS NULL OR started_time <= p_to)
+    ORDER BY started_time, metric, label;
+END //
+DELIMITER ;
+
+-- SPROC to record a fired alert
+DELIMITER //
+CREATE PROCEDURE save_alert(
+    IN p_rule_name NVARCHAR(64),
+    IN p_kind NVARCHAR(16),
+    IN p_run_id VARCHAR(32),
+    IN p_job NVARCHAR(255),
+    IN p_label NVARCHAR(255),
+    IN p_value DOUBLE,
+    IN p_threshold DOUBLE,
+    IN p_message TEXT,
+    IN p_fired_time DATETIME(3)
+)
+BEGIN
+    INSERT INTO alert_history (rule_name, kind, run_id, job, label, value, threshold, message, fired_time)
+    VALUES (p_rule_name, p_kind, p_run_id, p_job, p_label, p_value, p_threshold, p_message, p_fired_time);
+END //
+DELIMITER ;
+
+-- SPROC to get the alerts of a job (every job when NULL) fired since a time (ever when NULL)
+DELIMITER //
+CREATE PROCEDURE get_alerts(
+    IN p_job NVARCHAR(255),
+    IN p_since DATETIME(3)
+)
+BEGIN
+    SELECT rule_name, kind, run_id, job, label, value, threshold, message, fired_time
+    FROM alert_history
+    WHERE (p_job IS NULL OR job = p_job)
+      AND (p_since IS NULL OR fired_time >= p_since)
+    ORDER BY fired_time, alert_id;
+END //
+DELIMITER ;
+
+-- SPROC to insert or update the state of a pipeline run
+DELIMITER //
+CREATE PROCEDURE save_workflow_run(
+    IN p_run_id VARCHAR(32),
+    IN p_workflow NVARCHAR(64),
+    IN p_status NVARCHAR(16),
+    IN p_record LONGTEXT,
+    IN p_started_time DATETIME(3),
+    IN p_updated_time DATETIME(3)
+)
+BEGIN
+    INSERT INTO workflow_runs (run_id, workflow, status, record, started_time, updated_time)
+    VALUES (p_run_id, p_workflow, p_status, p_record, p_started_time, p_updated_time)
+    ON DUPLICATE KEY UPDATE status = p_status, record = p_record, updated_time = p_updated_time;
+END //
+DELIMITER ;
+
+-- SPROC to get the state of a pipeline run
+DELIMITER //
+CREATE PROCEDURE get_workflow_run(IN p_run_id VARCHAR(32))
+BEGIN
+    SELECT record FROM workflow_runs WHERE run_id = p_run_id;
+END //
+DELIMITER ;
+
+-- SPROC to claim the idempotency key of a request, replacing an expired claim; returns the stored claim and
+-- whether it is this one
+DELIMITER //
+CREATE PROCEDURE claim_idempotency_key(
+    IN p_scope NVARCHAR(320),
+    IN p_key NVARCHAR(255),
+    IN p_request_hash CHAR(64),
+    IN p_created_time DATETIME(3),
+    IN p_expired_before DATETIME(3)
+)
+BEGIN
+    DECLARE v_claimed INT;
+
+    DELETE FROM idempotency_keys
+    WHERE scope = p_scope AND idempotency_key = p_key AND created_time < p_expired_before;
+    INSERT IGNORE INTO idempotency_keys (scope, idempotency_key, request_hash, created_time)
+    VALUES (p_scope, p_key, p_request_hash, p_created_time);
+    SET v_claimed = ROW_COUNT();
+
+    SELECT request_hash, resource_id, status, created_time, v_claimed
+    FROM idempotency_keys
+    WHERE scope = p_scope AND idempotency_key = p_key;
+END //
+DELIMITER ;
+
+-- SPROC to record the response to a claimed idempotency key
+DELIMITER //
+CREATE PROCEDURE complete_idempotency_key(
+    IN p_scope NVARCHAR(320),
+    IN p_key NVARCHAR(255),
+    IN p_resource_id VARCHAR(64),
+    IN p_status INT
+)
+BEGIN
+    UPDATE idempotency_keys SET resource_id = p_resource_id, status = p_status
+    WHERE scope = p_scope AND idempotency_key = p_key;
+END //
+DELIMITER ;
+
+-- SPROC to forget the idempotency key of a failed request
+DELIMITER //
+CREATE PROCEDURE release_idempotency_key(
+    IN p_scope NVARCHAR(320),
+    IN p_key NVARCHAR(255)
+)
+BEGIN
+    DELETE FROM idempotency_keys WHERE scope = p_scope AND idempotency_key = p_key;
+END //
+DELIMITER ;
+
 --
 
 -- ================================================
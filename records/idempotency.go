@@ -0,0 +1,65 @@
+package records
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// IdempotencyRecord is a key a client sent with a request to an endpoint, and the response it got.
+type IdempotencyRecord struct {
+	Scope       string    // The endpoint and the caller, e.g. "POST /jobs for key:ci"; keys are only unique within it
+	Key         string    // The Idempotency-Key header
+	RequestHash string    // SHA-256 of the request body as canonical JSON, so a key reused for another request is refused
+	ResourceID  string    // The job or request the first request created; empty while it is handled
+	Status      int       // The status of the response to the first request
+	CreatedAt   time.Time // When the key was first seen
+}
+
+// MemoryIdempotencyStore is an in-process IdempotencyStore.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[[2]string]IdempotencyRecord // By scope and key
+}
+
+// NewMemoryIdempotencyStore creates an empty in-process idempotency store.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{records: map[[2]string]IdempotencyRecord{}}
+}
+
+// ClaimIdempotencyKey stores record unless its key is stored for its scope since expiredBefore.
+func (s *MemoryIdempotencyStore) ClaimIdempotencyKey(record IdempotencyRecord, expiredBefore time.Time) (IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, stored := range s.records {
+		if stored.CreatedAt.Before(expiredBefore) {
+			delete(s.records, id)
+		}
+	}
+	id := [2]string{record.Scope, record.Key}
+	if stored, ok := s.records[id]; ok {
+		return stored, false, nil
+	}
+	s.records[id] = record
+	return record, true, nil
+}
+
+// CompleteIdempotencyKey records the response to a claimed key.
+func (s *MemoryIdempotencyStore) CompleteIdempotencyKey(record IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := [2]string{record.Scope, record.Key}
+	if _, ok := s.records[id]; !ok {
+		return fmt.Errorf("idempotency key %q of %s not found", record.Key, record.Scope)
+	}
+	s.records[id] = record
+	return nil
+}
+
+// ReleaseIdempotencyKey forgets a claimed key.
+func (s *MemoryIdempotencyStore) ReleaseIdempotencyKey(scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, [2]string{scope, key})
+	return nil
+}
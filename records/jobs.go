@@ -0,0 +1,88 @@
+// Package records holds what the crawler hands its stores and the data layer keeps: jobs, page snapshots,
+// data quality results, latencies, run metrics, alerts, workflow runs and idempotency keys. The stores
+// themselves are interfaces of the crab package, which the dal implements without importing it.
+package records
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// JobState is the lifecycle state of a Job.
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+	JobSkipped   JobState = "skipped" // Another run of the same job held the run lock
+)
+
+// Job is a unit of crawl or scrape work. Crawls and scrapes started through the JobQueue share this one
+// lifecycle model so anything that triggers or inspects work (REST handlers, schedulers) sees the same
+// records.
+type Job struct {
+	ID         string            `json:"id"`
+	Type       string            `json:"type"` // "crawl", "scrape", or one registered by the caller
+	Params     map[string]string `json:"params"`
+	State      JobState          `json:"state"`
+	CreatedAt  time.Time         `json:"created_at"`
+	StartedAt  time.Time         `json:"started_at,omitempty"`
+	FinishedAt time.Time         `json:"finished_at,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// Finished reports whether the job has reached a terminal state.
+func (j Job) Finished() bool {
+	return j.State == JobSucceeded || j.State == JobFailed || j.State == JobCancelled || j.State == JobSkipped
+}
+
+// MemoryJobStore is an in-process JobStore.
+type MemoryJobStore struct {
+	mu   sync.RWMutex
+	jobs map[string]Job
+}
+
+// NewMemoryJobStore creates an empty in-process job store.
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{jobs: make(map[string]Job)}
+}
+
+// SaveJob inserts or replaces a job.
+func (s *MemoryJobStore) SaveJob(job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+	return nil
+}
+
+// GetJob returns the job with the given ID.
+func (s *MemoryJobStore) GetJob(id string) (Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("job %s not found", id)
+	}
+	return job, nil
+}
+
+// ListJobs returns all jobs, newest first.
+func (s *MemoryJobStore) ListJobs() ([]Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+// ErrRunLocked is returned by RunLocker.TryLock while another run holds the lock.
+var ErrRunLocked = errors.New("another run holds the lock")
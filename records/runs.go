@@ -0,0 +1,82 @@
+package records
+
+import "time"
+
+// ExpectationResult is the outcome of checking one expectation against a dataset.
+type ExpectationResult struct {
+	Dataset     string    `json:"dataset"`
+	RunID       string    `json:"run_id,omitempty"`
+	Expectation string    `json:"expectation"`
+	Column      string    `json:"column"`
+	Severity    string    `json:"severity"`
+	Success     bool      `json:"success"`
+	Checked     int       `json:"checked"` // Cells checked
+	Failed      int       `json:"failed"`  // Cells that did not meet the expectation
+	Unexpected  []string  `json:"unexpected,omitempty"`
+	CheckedAt   time.Time `json:"checked_at"`
+}
+
+// LatencyPercentiles are the nearest-rank percentiles of a set of timings, in milliseconds.
+type LatencyPercentiles struct {
+	P50 float64 `json:"p50_ms"`
+	P95 float64 `json:"p95_ms"`
+	P99 float64 `json:"p99_ms"`
+}
+
+// DomainLatency is how fast a domain answered the requests of a crawl: the time to the first byte of its
+// responses, and to the whole response.
+type DomainLatency struct {
+	Domain   string             `json:"domain"`
+	Requests int                `json:"requests"`
+	TTFB     LatencyPercentiles `json:"ttfb"`
+	Fetch    LatencyPercentiles `json:"fetch"`
+}
+
+// LatencySample is the latency of a domain during one crawl run.
+type LatencySample struct {
+	RunID string    `json:"run_id"`
+	Time  time.Time `json:"time"` // When the run started
+	DomainLatency
+}
+
+// RunMetric is one measurement of a run. Label tells apart the measurements of a metric taken per domain
+// or dataset, and is empty for those of the whole run.
+type RunMetric struct {
+	RunID  string    `json:"run_id"`
+	Kind   string    `json:"kind"` // "crawl" or "scrape"
+	Name   string    `json:"name"` // Domain or job name
+	Time   time.Time `json:"time"` // When the run started
+	Metric string    `json:"metric"`
+	Label  string    `json:"label,omitempty"`
+	Value  float64   `json:"value"`
+}
+
+// MetricQuery selects run metrics. Empty fields and zero times match everything.
+type MetricQuery struct {
+	Kind   string
+	Name   string
+	Metric string
+	Label  string
+	From   time.Time // The earliest start of the runs
+	To     time.Time // The latest start of the runs
+}
+
+// Matches reports whether m is one of the metrics q selects.
+func (q MetricQuery) Matches(m RunMetric) bool {
+	return (q.Kind == "" || m.Kind == q.Kind) && (q.Name == "" || m.Name == q.Name) &&
+		(q.Metric == "" || m.Metric == q.Metric) && (q.Label == "" || m.Label == q.Label) &&
+		(q.From.IsZero() || !m.Time.Before(q.From)) && (q.To.IsZero() || !m.Time.After(q.To))
+}
+
+// Alert is a rule that fired after a run.
+type Alert struct {
+	Rule      string    `json:"rule"`
+	Kind      string    `json:"kind"`
+	RunID     string    `json:"run_id,omitempty"`
+	Job       string    `json:"job"`
+	Label     string    `json:"label,omitempty"` // The dataset, for the rules of datasets
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Message   string    `json:"message"`
+	FiredAt   time.Time `json:"fired_at"`
+}
@@ -0,0 +1,33 @@
+package records
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/PuerkitoBio/goquery"
+	"time"
+)
+
+// Snapshot is the raw content of one page as it was fetched.
+type Snapshot struct {
+	URL         string    `json:"url"`
+	URLHash     string    `json:"url_hash"`
+	FetchedAt   time.Time `json:"fetched_at"`
+	StatusCode  int       `json:"status_code"`
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"-"`
+	TraceParent string    `json:"-"`                // W3C traceparent of the crawl span that fetched the page, if traced
+	RunID       string    `json:"run_id,omitempty"` // Run that fetched the page, when runs have output directories
+}
+
+// Document parses a snapshot's body so selectors can be run against it again, the same way the scrapers
+// run them against a live page.
+func (s Snapshot) Document() (*goquery.Document, error) {
+	return goquery.NewDocumentFromReader(bytes.NewReader(s.Body))
+}
+
+// URLHash returns the key snapshots of a URL are stored under.
+func URLHash(rawURL string) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	return hex.EncodeToString(sum[:])
+}
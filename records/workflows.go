@@ -0,0 +1,62 @@
+package records
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// Dataset is a flat, named table built from one of the scraped outputs. Columns holds the header names
+// (the JSON tags of the source struct) and every row holds one string cell per column, so exporters can
+// treat inflation, gasoline, housing and airfare data the same way.
+type Dataset struct {
+	Name    string
+	Columns []string
+	Rows    [][]string
+	RunID   string `json:",omitempty"` // The run that wrote the rows, when they were read from a run directory
+}
+
+// WriteCSV writes the dataset as CSV, header row first.
+func (ds Dataset) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(ds.Columns); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(ds.Rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// WorkflowRecord is the persisted state of a workflow run: how each finished stage went and what the
+// stages that succeeded handed on, so a failed run can resume from the stages that did not.
+type WorkflowRecord struct {
+	RunID     string                 `json:"run_id"`
+	Workflow  string                 `json:"workflow"`
+	Status    string                 `json:"status"` // running, succeeded or failed
+	Error     string                 `json:"error,omitempty"`
+	StartedAt time.Time              `json:"started_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+	Stages    []StageResult          `json:"stages"`  // Of the finished stages, in the order they finished
+	Outputs   map[string]StageOutput `json:"outputs"` // Of the stages that succeeded or were skipped, by name
+}
+
+// StageResult is how one stage of a workflow run went.
+type StageResult struct {
+	Name     string        `json:"name"`
+	Type     string        `json:"type"`
+	Status   string        `json:"status"` // succeeded, skipped (failed with on_error "skip") or failed
+	Attempts int           `json:"attempts"`
+	Rows     int           `json:"rows"` // In the dataset after the stage
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// StageOutput is the state a stage hands the stages that need it.
+type StageOutput struct {
+	Dataset  Dataset                    `json:"dataset"`
+	Features []string                   `json:"features,omitempty"`
+	Values   map[string]string          `json:"values,omitempty"`
+	Data     map[string]json.RawMessage `json:"data,omitempty"`
+}
@@ -0,0 +1,71 @@
+// Package scrape embeds crab's listing scrapers in other Go programs:
+//
+//	summary, err := scrape.New(scrape.Options{}).Run(ctx, "books", "http://books.toscrape.com/")
+//
+// A run follows the next page links of a listing from its start page and writes the items it finds to
+// <domain>_data.json in a run directory under the configured output directory, with the statistics and
+// event log of the run, exactly like a scrape job of the daemon, and returns its summary. Like those of a
+// crawler.Crawler, the options of a Scraper are its own and never change the crab configuration of the
+// process.
+package scrape
+
+import (
+	"cmpscfa23team2/crab"
+	"context"
+	"fmt"
+)
+
+// Options configure a Scraper. The zero value scrapes with the current crab config, following its
+// reloads.
+type Options struct {
+	Config  *crab.Config // Settings of the scrape, e.g. from crab.LoadConfig; the current crab config when nil
+	Profile string       // Configuration profile of Config to scrape with
+	Trace   bool         // Write a per-request timeline to trace.json
+}
+
+// Scraper scrapes listings with fixed options.
+type Scraper struct {
+	options Options
+}
+
+// New creates a Scraper.
+func New(options Options) *Scraper {
+	return &Scraper{options: options}
+}
+
+// Run scrapes the listing of the domain configuration named domain, e.g. "books", from startURL and
+// returns the summary of the run. It fails without scraping when the options or domain are invalid, and
+// with the summary of what was scraped when ctx is done first or the scrape failed.
+func (s *Scraper) Run(ctx context.Context, domain, startURL string) (crab.RunSummary, error) {
+	if startURL == "" {
+		return crab.RunSummary{}, fmt.Errorf("no start URL to scrape %s from", domain)
+	}
+	config := crab.CurrentConfig
+	if s.options.Config != nil {
+		fixed := *s.options.Config
+		config = func() crab.Config { return fixed }
+	}
+	if _, err := config().WithProfile(s.options.Profile); err != nil {
+		return crab.RunSummary{}, err
+	}
+	summary, err := crab.ScrapeWithConfig(ctx, func() crab.Config { return s.settings(config()) }, domain, startURL)
+	if err != nil {
+		return summary, err
+	}
+	if summary.Error != "" {
+		return summary, fmt.Errorf("%s", summary.Error)
+	}
+	return summary, nil
+}
+
+// settings returns config with the profile and options of the Scraper applied. A profile that went
+// missing from a reloaded config leaves config as it is.
+func (s *Scraper) settings(config crab.Config) crab.Config {
+	if profiled, err := config.WithProfile(s.options.Profile); err == nil {
+		config = profiled
+	}
+	if s.options.Trace {
+		config.Trace.Enabled = true
+	}
+	return config
+}
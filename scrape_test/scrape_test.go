@@ -0,0 +1,68 @@
+package scrape_test
+
+import (
+	"cmpscfa23team2/crab"
+	"cmpscfa23team2/scrape"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// listing serves two pages of two books each, the first linking to the second.
+func listing() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := 1
+		if r.URL.Path == "/page-2.html" {
+			page = 2
+		}
+		fmt.Fprint(w, "<html><body>")
+		for i := 1; i <= 2; i++ {
+			fmt.Fprintf(w, `<article class="product_pod"><h3><a href="/book-%d-%d.html">Book %d.%d</a></h3><div><p class="price_color">£1%d.00</p></div></article>`, page, i, page, i, i)
+		}
+		if page == 1 {
+			fmt.Fprint(w, `<ul><li class="next"><a href="/page-2.html">next</a></li></ul>`)
+		}
+		fmt.Fprint(w, "</body></html>")
+	}))
+}
+
+func TestRun(t *testing.T) {
+	site := listing()
+	defer site.Close()
+	config := crab.Config{Output: crab.OutputConfig{Dir: t.TempDir()}}
+
+	summary, err := scrape.New(scrape.Options{Config: &config}).Run(context.Background(), "books", site.URL+"/")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if summary.Event != crab.EventCompleted || summary.Pages != 2 || summary.Items != 4 || summary.RunID == "" {
+		t.Errorf("Run() summary = %+v, want 2 pages with 4 books", summary)
+	}
+	data, err := os.ReadFile(filepath.Join(config.Output.Dir, summary.RunID, "books_data.json"))
+	if err != nil || !strings.Contains(string(data), "Book 2.2") {
+		t.Errorf("books_data.json = %s, %v", data, err)
+	}
+	if crab.CurrentConfig().Output.Dir == config.Output.Dir {
+		t.Errorf("Run() left its config in place")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	summary, err = scrape.New(scrape.Options{Config: &config}).Run(ctx, "books", site.URL+"/")
+	if err == nil || summary.Pages != 0 || summary.Event != crab.EventFailed {
+		t.Errorf("Run() with a cancelled context = %+v, %v", summary, err)
+	}
+	if _, err := scrape.New(scrape.Options{Config: &config}).Run(context.Background(), "missing", site.URL); err == nil {
+		t.Errorf("Run() of an unknown domain succeeded")
+	}
+	disabled := config
+	disabled.Scrapers = []string{"airfare"}
+	if _, err := scrape.New(scrape.Options{Config: &disabled}).Run(context.Background(), "books", site.URL); err == nil {
+		t.Errorf("Run() of a disabled scraper succeeded")
+	}
+}
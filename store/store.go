@@ -0,0 +1,68 @@
+// Package store reads and keeps the outputs of crab's crawls and scrapes from other Go programs:
+//
+//	datasets, err := store.Datasets(filepath.Join(dir, runID))
+//
+// Every run writes its outputs to a directory of its own under the output directory, named by its run ID
+// and sealed by a manifest once it finishes. The datasets scraped by earlier runs stay readable as they
+// stood after any run, so an analysis can be repeated on the same data.
+package store
+
+import (
+	"cmpscfa23team2/crab"
+	"path/filepath"
+)
+
+// Runs returns the IDs of the runs in dir, oldest first.
+func Runs(dir string) ([]string, error) {
+	return crab.ListRuns(dir)
+}
+
+// Latest returns the ID of the newest run in dir, or "" when it has none.
+func Latest(dir string) (string, error) {
+	runs, err := crab.ListRuns(dir)
+	if err != nil || len(runs) == 0 {
+		return "", err
+	}
+	return runs[len(runs)-1], nil
+}
+
+// Verify checks the files of run runID in dir against its manifest and describes each missing, resized
+// or modified one. An empty result means the run is intact.
+func Verify(dir, runID string) ([]string, error) {
+	return crab.VerifyRunManifest(filepath.Join(dir, runID))
+}
+
+// Prune deletes all but the newest keep runs in dir and returns the IDs it removed.
+func Prune(dir string, keep int) ([]string, error) {
+	return crab.PruneRuns(dir, keep)
+}
+
+// Datasets reads the scraped datasets written to runDir, the directory of one run.
+func Datasets(runDir string) ([]crab.Dataset, error) {
+	return crab.LoadScrapedDatasets(runDir)
+}
+
+// DatasetAsOf returns the named scraped dataset as it stood after run runID in dir, or its latest version
+// when runID is empty (see crab.LoadDatasetAsOf).
+func DatasetAsOf(dir, name, runID string) (crab.Dataset, error) {
+	return crab.LoadDatasetAsOf(dir, name, runID)
+}
+
+// ExportXLSX writes datasets to an Excel workbook, one sheet per dataset.
+func ExportXLSX(datasets []crab.Dataset, filename string) error {
+	return crab.ExportXLSX(datasets, filename)
+}
+
+// Upload copies the outputs of run runID in dir to the object store configured by the CRAB_STORAGE_*
+// environment variables and returns the keys it wrote.
+func Upload(dir, runID string) ([]string, error) {
+	started, err := crab.RunStartTime(runID)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := crab.NewObjectStoreSinkFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return sink.UploadRunOutputs(filepath.Join(dir, runID), started)
+}
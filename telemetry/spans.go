@@ -0,0 +1,309 @@
+// Package telemetry exports OpenTelemetry spans to an OTLP/HTTP collector. Crab traces its crawls and
+// scrapes with it, and the dal the database writes made for them, without either importing the other.
+package telemetry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config exports OpenTelemetry spans of crawls, scrapes and database operations to an OTLP/HTTP
+// collector (Jaeger, Tempo or an OpenTelemetry Collector) using the OTLP JSON encoding. Every run is one
+// trace: a page's fetch, its extraction and the database writes made for it are spans of that trace, so a
+// single page can be followed from the request to the insert.
+type Config struct {
+	Endpoint    string            `json:"endpoint"`     // e.g. "http://localhost:4318/v1/traces"; empty disables export
+	ServiceName string            `json:"service_name"` // "crab" when empty
+	Headers     map[string]string `json:"headers"`      // e.g. an authorization header for a hosted backend
+}
+
+// batchSize is how many ended spans are buffered before they are sent.
+const batchSize = 256
+
+// OTLP span kinds and status codes.
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+	spanStatusError  = 2
+)
+
+// SpanContext identifies a span within its trace. The zero value starts a new trace.
+type SpanContext struct {
+	TraceID string // 32 hex digits
+	SpanID  string // 16 hex digits
+}
+
+// IsValid reports whether the context names a span.
+func (sc SpanContext) IsValid() bool {
+	return len(sc.TraceID) == 32 && len(sc.SpanID) == 16
+}
+
+// TraceParent formats the context as a W3C traceparent value, or "" for the zero context.
+func (sc SpanContext) TraceParent() string {
+	if !sc.IsValid() {
+		return ""
+	}
+	return "00-" + sc.TraceID + "-" + sc.SpanID + "-01"
+}
+
+// ParseTraceParent reads a W3C traceparent value. Invalid values give the zero context.
+func ParseTraceParent(value string) SpanContext {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return SpanContext{}
+	}
+	sc := SpanContext{TraceID: parts[1], SpanID: parts[2]}
+	if _, err := hex.DecodeString(sc.TraceID + sc.SpanID); err != nil || !sc.IsValid() {
+		return SpanContext{}
+	}
+	return sc
+}
+
+// Span is one timed operation. StartSpan returns nil when telemetry is off; every method of a nil *Span
+// does nothing, so callers need not check.
+type Span struct {
+	ctx      SpanContext
+	parentID string
+	name     string
+	kind     int
+	start    time.Time
+
+	mu         sync.Mutex
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+var (
+	configMu sync.RWMutex
+	config   Config
+)
+
+// Use sets the collector spans are exported to. Crab's SetConfig calls it with the crab configuration.
+func Use(c Config) {
+	configMu.Lock()
+	defer configMu.Unlock()
+	config = c
+}
+
+// current returns the configuration set by Use.
+func current() Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return config
+}
+
+// StartSpan starts a span as a child of parent, or as the root of a new trace when parent is the zero
+// context.
+func StartSpan(parent SpanContext, name string) *Span {
+	return startSpan(parent, name, spanKindInternal)
+}
+
+// StartClientSpan starts a span of a request to another service, such as a page fetch.
+func StartClientSpan(parent SpanContext, name string) *Span {
+	return startSpan(parent, name, spanKindClient)
+}
+
+// startSpan is StartSpan for spans of the given kind.
+func startSpan(parent SpanContext, name string, kind int) *Span {
+	if current().Endpoint == "" {
+		return nil
+	}
+	span := &Span{name: name, kind: kind, start: time.Now(), attributes: map[string]interface{}{}}
+	if parent.IsValid() {
+		span.ctx.TraceID, span.parentID = parent.TraceID, parent.SpanID
+	} else {
+		span.ctx.TraceID = randomHex(16)
+	}
+	span.ctx.SpanID = randomHex(8)
+	return span
+}
+
+// Context returns the span's context, to start child spans or pass it to another layer.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.ctx
+}
+
+// SetAttribute records a string, integer, float or boolean attribute on the span.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[key] = value
+}
+
+// RecordError marks the span as failed.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+// End finishes the span and queues it for export. Ending a span twice has no effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	span := otlpSpan{
+		TraceID:           s.ctx.TraceID,
+		SpanID:            s.ctx.SpanID,
+		ParentSpanID:      s.parentID,
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(time.Now().UnixNano(), 10),
+		Attributes:        otlpAttributes(s.attributes),
+	}
+	if s.err != nil {
+		span.Status = &otlpStatus{Code: spanStatusError, Message: s.err.Error()}
+	}
+	s.mu.Unlock()
+
+	pendingMu.Lock()
+	pendingSpans = append(pendingSpans, span)
+	full := len(pendingSpans) >= batchSize
+	pendingMu.Unlock()
+	if full {
+		go func() {
+			if err := Flush(); err != nil {
+				log.Printf("Error exporting spans: %v", err)
+			}
+		}()
+	}
+}
+
+// randomHex returns n random bytes as hex.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// The OTLP JSON encoding of a batch of spans.
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// otlpAttributes encodes attributes as OTLP AnyValues, sorted by key. 64-bit integers are strings in
+// OTLP JSON.
+func otlpAttributes(attributes map[string]interface{}) []otlpAttribute {
+	out := make([]otlpAttribute, 0, len(attributes))
+	for key, value := range attributes {
+		var v map[string]interface{}
+		switch value := value.(type) {
+		case string:
+			v = map[string]interface{}{"stringValue": value}
+		case bool:
+			v = map[string]interface{}{"boolValue": value}
+		case int:
+			v = map[string]interface{}{"intValue": strconv.Itoa(value)}
+		case int64:
+			v = map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}
+		case float64:
+			v = map[string]interface{}{"doubleValue": value}
+		default:
+			v = map[string]interface{}{"stringValue": fmt.Sprint(value)}
+		}
+		out = append(out, otlpAttribute{Key: key, Value: v})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+var (
+	pendingMu    sync.Mutex
+	pendingSpans []otlpSpan
+)
+
+// Flush sends the spans ended so far to the configured collector.
+func Flush() error {
+	pendingMu.Lock()
+	spans := pendingSpans
+	pendingSpans = nil
+	pendingMu.Unlock()
+	config := current()
+	if len(spans) == 0 || config.Endpoint == "" {
+		return nil
+	}
+
+	service := config.ServiceName
+	if service == "" {
+		service = "crab"
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": service}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "cmpscfa23team2/crab"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, config.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range config.Headers {
+		req.Header.Set(name, value)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("exporting %d spans to %s: status %d", len(spans), config.Endpoint, resp.StatusCode)
+	}
+	return nil
+}